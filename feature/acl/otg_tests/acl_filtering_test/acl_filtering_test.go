@@ -0,0 +1,439 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl_filtering_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1 and dut:port2 -> ate:port2.
+const (
+	ipv4PrefixLen = 30
+	ipv6PrefixLen = 126
+	packets       = 1000
+	frameSize     = 512
+
+	ipv4ACL = "ipv4-filter"
+	ipv6ACL = "ipv6-filter"
+
+	// The sequence numbers of the ACL entries. The entries below permitSeq
+	// drop the packets they match.
+	prefixSeq      = 10
+	icmpSeq        = 20
+	udpDstRangeSeq = 30
+	tcpSrcRangeSeq = 40
+	tcpSynSeq      = 50
+	permitSeq      = 100
+	udpDstRange    = "5000..5099"
+	tcpSrcRange    = "30000..30099"
+	tcpSynDstPort  = 8080
+	permittedPort  = 6000
+	srcPort        = 40000
+
+	// The destination prefixes of the flows are routed to ate:port2. The
+	// denied prefix is part of them.
+	ipv4Routed = "203.0.113.0/24"
+	ipv4Denied = "203.0.113.0/28"
+	ipv6Routed = "2001:db8:1::/64"
+	ipv6Denied = "2001:db8:1::/124"
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::192:0:2:2",
+		IPv6Len: ipv6PrefixLen,
+	}
+	dutSrc = attrs.Attributes{
+		Desc:    "DUT to ATE source",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::192:0:2:1",
+		IPv6Len: ipv6PrefixLen,
+	}
+	dutDst = attrs.Attributes{
+		Desc:    "DUT to ATE destination",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::192:0:2:5",
+		IPv6Len: ipv6PrefixLen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::192:0:2:6",
+		IPv6Len: ipv6PrefixLen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// family is the IPv4 or IPv6 parameters of the test.
+type family struct {
+	name    string
+	aclName string
+	aclType oc.E_Acl_ACL_TYPE
+	// deniedDst is an address in the denied prefix, and permittedDst an
+	// address in the routed prefix outside it.
+	deniedDst    string
+	permittedDst string
+}
+
+var families = []*family{{
+	name:         "IPv4",
+	aclName:      ipv4ACL,
+	aclType:      oc.Acl_ACL_TYPE_ACL_IPV4,
+	deniedDst:    "203.0.113.1",
+	permittedDst: "203.0.113.100",
+}, {
+	name:         "IPv6",
+	aclName:      ipv6ACL,
+	aclType:      oc.Acl_ACL_TYPE_ACL_IPV6,
+	deniedDst:    "2001:db8:1::1",
+	permittedDst: "2001:db8:1::100",
+}}
+
+// configureDUT configures the DUT interfaces and the static routes of the
+// destination prefixes of the flows.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for _, p := range []struct {
+		port  *ondatra.Port
+		attrs attrs.Attributes
+	}{
+		{dut.Port(t, "port1"), dutSrc},
+		{dut.Port(t, "port2"), dutDst},
+	} {
+		gnmi.Replace(t, dut, gnmi.OC().Interface(p.port.Name()).Config(), p.attrs.NewOCInterface(p.port.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, p.port.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, p.port)
+		}
+	}
+
+	b := &gnmi.SetBatch{}
+	for prefix, nh := range map[string]string{ipv4Routed: ateDst.IPv4, ipv6Routed: ateDst.IPv6} {
+		cfg := &cfgplugins.StaticRouteCfg{
+			NetworkInstance: deviations.DefaultNetworkInstance(dut),
+			Prefix:          prefix,
+			NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+				"0": oc.UnionString(nh),
+			},
+		}
+		if _, err := cfgplugins.NewStaticRouteCfg(b, cfg, dut); err != nil {
+			t.Fatalf("Failed to configure the static route to %s: %v", prefix, err)
+		}
+	}
+	b.Set(t, dut)
+}
+
+// ipMatch sets the destination address dst and the IP protocol protocol
+// matched by entry e of ACL type typ, unless they are empty or 0.
+func ipMatch(e *oc.Acl_AclSet_AclEntry, typ oc.E_Acl_ACL_TYPE, dst string, protocol uint8) {
+	if typ == oc.Acl_ACL_TYPE_ACL_IPV6 {
+		ip := e.GetOrCreateIpv6()
+		if dst != "" {
+			ip.SetDestinationAddress(dst)
+		}
+		if protocol != 0 {
+			ip.SetProtocol(oc.UnionUint8(protocol))
+		}
+		return
+	}
+	ip := e.GetOrCreateIpv4()
+	if dst != "" {
+		ip.SetDestinationAddress(dst)
+	}
+	if protocol != 0 {
+		ip.SetProtocol(oc.UnionUint8(protocol))
+	}
+}
+
+// The IP protocol numbers.
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+)
+
+// aclSet returns the ACL of family f, with an entry dropping each kind of
+// the denied packets and a final entry accepting all the other packets.
+func aclSet(f *family) *oc.Acl_AclSet {
+	a := &oc.Acl_AclSet{Name: ygot.String(f.aclName), Type: f.aclType}
+	entry := func(seq uint32, desc string, action oc.E_Acl_FORWARDING_ACTION) *oc.Acl_AclSet_AclEntry {
+		e := a.GetOrCreateAclEntry(seq)
+		e.SetDescription(desc)
+		e.GetOrCreateActions().SetForwardingAction(action)
+		return e
+	}
+	v6 := f.aclType == oc.Acl_ACL_TYPE_ACL_IPV6
+
+	denied := ipv4Denied
+	if v6 {
+		denied = ipv6Denied
+	}
+	ipMatch(entry(prefixSeq, "deny destination prefix", oc.Acl_FORWARDING_ACTION_DROP), f.aclType, denied, 0)
+
+	e := entry(icmpSeq, "deny ICMP echo requests", oc.Acl_FORWARDING_ACTION_DROP)
+	if v6 {
+		ipMatch(e, f.aclType, "", protoICMPv6)
+		e.GetOrCreateIpv6().GetOrCreateIcmpv6().SetType(oc.Icmpv6Types_TYPE_ECHO_REQUEST)
+	} else {
+		ipMatch(e, f.aclType, "", protoICMP)
+		e.GetOrCreateIpv4().GetOrCreateIcmpv4().SetType(oc.Icmpv4Types_TYPE_ECHO)
+	}
+
+	e = entry(udpDstRangeSeq, "deny UDP destination port range", oc.Acl_FORWARDING_ACTION_DROP)
+	ipMatch(e, f.aclType, "", protoUDP)
+	e.GetOrCreateTransport().SetDestinationPort(oc.UnionString(udpDstRange))
+
+	e = entry(tcpSrcRangeSeq, "deny TCP source port range", oc.Acl_FORWARDING_ACTION_DROP)
+	ipMatch(e, f.aclType, "", protoTCP)
+	e.GetOrCreateTransport().SetSourcePort(oc.UnionString(tcpSrcRange))
+
+	e = entry(tcpSynSeq, "deny TCP SYN", oc.Acl_FORWARDING_ACTION_DROP)
+	ipMatch(e, f.aclType, "", protoTCP)
+	tr := e.GetOrCreateTransport()
+	tr.SetDestinationPort(oc.UnionUint16(tcpSynDstPort))
+	tr.SetDetailMode(oc.Transport_DetailMode_EXPLICIT)
+	tr.SetExplicitDetailMatchMode(oc.Transport_ExplicitDetailMatchMode_ALL)
+	tr.SetExplicitTcpFlags([]oc.E_PacketMatchTypes_TCP_FLAGS{oc.PacketMatchTypes_TCP_FLAGS_TCP_SYN})
+
+	e = entry(permitSeq, "permit all", oc.Acl_FORWARDING_ACTION_ACCEPT)
+	if v6 {
+		e.GetOrCreateIpv6().SetSourceAddress("::/0")
+		e.GetOrCreateIpv6().SetDestinationAddress("::/0")
+	} else {
+		e.GetOrCreateIpv4().SetSourceAddress("0.0.0.0/0")
+		e.GetOrCreateIpv4().SetDestinationAddress("0.0.0.0/0")
+	}
+	return a
+}
+
+// applyACLs applies the ACLs of all the families to interface intf, on its
+// input if ingress or else on its output.
+func applyACLs(t *testing.T, dut *ondatra.DUTDevice, intf string, ingress bool) {
+	t.Helper()
+	a := &oc.Acl_Interface{Id: ygot.String(intf)}
+	a.GetOrCreateInterfaceRef().SetInterface(intf)
+	a.GetOrCreateInterfaceRef().SetSubinterface(0)
+	for _, f := range families {
+		if ingress {
+			a.GetOrCreateIngressAclSet(f.aclName, f.aclType)
+		} else {
+			a.GetOrCreateEgressAclSet(f.aclName, f.aclType)
+		}
+	}
+	gnmi.Replace(t, dut, gnmi.OC().Acl().Interface(intf).Config(), a)
+}
+
+// matchedPackets returns the matched packets of the entry seq of the ACL of
+// family f on the input of interface intf if ingress, or else on its output.
+func matchedPackets(t *testing.T, dut *ondatra.DUTDevice, intf string, ingress bool, f *family, seq uint32) uint64 {
+	t.Helper()
+	p := gnmi.OC().Acl().Interface(intf)
+	var q ygnmi.SingletonQuery[uint64] = p.EgressAclSet(f.aclName, f.aclType).AclEntry(seq).MatchedPackets().State()
+	if ingress {
+		q = p.IngressAclSet(f.aclName, f.aclType).AclEntry(seq).MatchedPackets().State()
+	}
+	// The counter is 0 if the device has not matched any packet yet.
+	v, _ := gnmi.Lookup(t, dut, q).Val()
+	return v
+}
+
+// aclFlow is a flow of a family, which is dropped by the ACL entry seq, or
+// accepted by the entry permitSeq.
+type aclFlow struct {
+	name string
+	seq  uint32
+	// dst returns the destination address of the flow of family f.
+	dst func(f *family) string
+	// addL4 adds the headers above the IP header to the packet of the flow
+	// of family f.
+	addL4 func(pkt gosnappi.FlowFlowHeaderIter, f *family)
+}
+
+func deniedDst(f *family) string    { return f.deniedDst }
+func permittedDst(f *family) string { return f.permittedDst }
+
+// udp returns a function adding a UDP header with the ports src and dst.
+func udp(src, dst uint32) func(gosnappi.FlowFlowHeaderIter, *family) {
+	return func(pkt gosnappi.FlowFlowHeaderIter, _ *family) {
+		h := pkt.Add().Udp()
+		h.SrcPort().SetValue(src)
+		h.DstPort().SetValue(dst)
+	}
+}
+
+// tcp returns a function adding a TCP header with the ports src and dst, and
+// the SYN or ACK flag.
+func tcp(src, dst uint32, syn bool) func(gosnappi.FlowFlowHeaderIter, *family) {
+	return func(pkt gosnappi.FlowFlowHeaderIter, _ *family) {
+		h := pkt.Add().Tcp()
+		h.SrcPort().SetValue(src)
+		h.DstPort().SetValue(dst)
+		if syn {
+			h.CtlSyn().SetValue(1)
+		} else {
+			h.CtlAck().SetValue(1)
+		}
+	}
+}
+
+// icmpEcho adds an ICMP or ICMPv6 echo request header.
+func icmpEcho(pkt gosnappi.FlowFlowHeaderIter, f *family) {
+	if f.aclType == oc.Acl_ACL_TYPE_ACL_IPV6 {
+		pkt.Add().Icmpv6().Echo()
+		return
+	}
+	pkt.Add().Icmp().Echo()
+}
+
+var aclFlows = []*aclFlow{
+	{name: "prefix", seq: prefixSeq, dst: deniedDst, addL4: udp(srcPort, permittedPort)},
+	{name: "icmp", seq: icmpSeq, dst: permittedDst, addL4: icmpEcho},
+	{name: "udp-dst-range", seq: udpDstRangeSeq, dst: permittedDst, addL4: udp(srcPort, 5050)},
+	{name: "tcp-src-range", seq: tcpSrcRangeSeq, dst: permittedDst, addL4: tcp(30050, permittedPort, false)},
+	{name: "tcp-syn", seq: tcpSynSeq, dst: permittedDst, addL4: tcp(srcPort, tcpSynDstPort, true)},
+	{name: "tcp-ack", seq: permitSeq, dst: permittedDst, addL4: tcp(srcPort, tcpSynDstPort, false)},
+	{name: "udp", seq: permitSeq, dst: permittedDst, addL4: udp(srcPort, permittedPort)},
+}
+
+// flowName returns the name of flow fl of family f.
+func flowName(f *family, fl *aclFlow) string {
+	return f.name + "-" + fl.name
+}
+
+// addFlows adds the flows of all the families to top.
+func addFlows(top gosnappi.Config) {
+	top.Flows().Clear()
+	for _, f := range families {
+		for _, fl := range aclFlows {
+			flow := top.Flows().Add().SetName(flowName(f, fl))
+			flow.Metrics().SetEnable(true)
+			flow.TxRx().Device().SetTxNames([]string{ateSrc.Name + "." + f.name}).SetRxNames([]string{ateDst.Name + "." + f.name})
+			flow.Packet().Add().Ethernet().Src().SetValue(ateSrc.MAC)
+			if f.aclType == oc.Acl_ACL_TYPE_ACL_IPV6 {
+				ip := flow.Packet().Add().Ipv6()
+				ip.Src().SetValue(ateSrc.IPv6)
+				ip.Dst().SetValue(fl.dst(f))
+			} else {
+				ip := flow.Packet().Add().Ipv4()
+				ip.Src().SetValue(ateSrc.IPv4)
+				ip.Dst().SetValue(fl.dst(f))
+			}
+			fl.addL4(flow.Packet(), f)
+			flow.Size().SetFixed(frameSize)
+			flow.Rate().SetPps(100)
+			flow.Duration().FixedPackets().SetPackets(packets)
+		}
+	}
+}
+
+func TestACLFiltering(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+	for _, f := range families {
+		gnmi.Replace(t, dut, gnmi.OC().Acl().AclSet(f.aclName, f.aclType).Config(), aclSet(f))
+	}
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutSrc)
+	ateDst.AddToOTG(top, ate.Port(t, "port2"), &dutDst)
+	addFlows(top)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+
+	cases := []struct {
+		desc    string
+		port    string
+		ingress bool
+	}{
+		{desc: "Ingress", port: "port1", ingress: true},
+		{desc: "Egress", port: "port2", ingress: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			intf := dut.Port(t, tc.port).Name()
+			applyACLs(t, dut, intf, tc.ingress)
+			defer gnmi.Delete(t, dut, gnmi.OC().Acl().Interface(intf).Config())
+
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+			before := map[string]map[uint32]uint64{}
+			for _, f := range families {
+				before[f.name] = map[uint32]uint64{}
+				for _, fl := range aclFlows {
+					before[f.name][fl.seq] = matchedPackets(t, dut, intf, tc.ingress, f, fl.seq)
+				}
+			}
+			ate.OTG().StartTraffic(t)
+			time.Sleep(packets/100*time.Second + 5*time.Second)
+			ate.OTG().StopTraffic(t)
+			time.Sleep(15 * time.Second)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+			for _, f := range families {
+				want := map[uint32]uint64{}
+				for _, fl := range aclFlows {
+					name := flowName(f, fl)
+					counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(name).Counters().State())
+					tx, rx := counters.GetOutPkts(), counters.GetInPkts()
+					if tx == 0 {
+						t.Fatalf("Flow %s sent no packets", name)
+					}
+					want[fl.seq] += tx
+					switch {
+					case fl.seq != permitSeq && rx != 0:
+						t.Errorf("Flow %s: got %d packets received, want all %d packets dropped by entry %d", name, rx, tx, fl.seq)
+					case fl.seq == permitSeq && rx != tx:
+						t.Errorf("Flow %s: got %d packets received, want all %d packets", name, rx, tx)
+					}
+				}
+				for seq, w := range want {
+					got := matchedPackets(t, dut, intf, tc.ingress, f, seq) - before[f.name][seq]
+					t.Logf("ACL %s entry %d: %d matched packets", f.aclName, seq, got)
+					if got < w {
+						t.Errorf("ACL %s entry %d: got %d matched packets, want at least %d", f.aclName, seq, got, w)
+					}
+				}
+			}
+		})
+	}
+}
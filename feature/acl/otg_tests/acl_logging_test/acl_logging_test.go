@@ -0,0 +1,323 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl_logging_test
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+)
+
+var (
+	collectorAddress = flag.String("collector_address", "", "address of the test host reachable by the DUT, where the test runs the syslog collector")
+	collectorPort    = flag.Int("collector_port", 5514, "UDP port of the syslog collector")
+	collectorNI      = flag.String("collector_network_instance", "", "network instance of the DUT through which the collector is reachable, or empty for the default network instance")
+	logWait          = flag.Duration("log_wait", 30*time.Second, "time to wait for the syslog messages after the traffic stops")
+)
+
+// The testbed consists of ate:port1 -> dut:port1 and dut:port2 -> ate:port2.
+const (
+	plen      = 30
+	aclName   = "log-filter"
+	denySeq   = 10
+	permitSeq = 20
+	packets   = 10000
+	ppsRate   = 1000
+	frameSize = 256
+
+	// routedPrefix is routed to ate:port2, and is denied and logged by the
+	// ACL.
+	routedPrefix = "198.51.100.0/24"
+	deniedDst    = "198.51.100.1"
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dutSrc = attrs.Attributes{
+		Desc:    "Logged input",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dutDst = attrs.Attributes{
+		Desc:    "Routed output",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// collector is a syslog collector receiving the messages sent over UDP.
+type collector struct {
+	conn net.PacketConn
+	done chan struct{}
+
+	mu       sync.Mutex
+	messages []string
+}
+
+// startCollector starts a collector listening on UDP port port.
+func startCollector(port int) (*collector, error) {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	c := &collector{conn: conn, done: make(chan struct{})}
+	go c.receive()
+	return c, nil
+}
+
+func (c *collector) receive() {
+	defer close(c.done)
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := c.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		c.mu.Lock()
+		c.messages = append(c.messages, string(buf[:n]))
+		c.mu.Unlock()
+	}
+}
+
+// reset discards the messages received so far.
+func (c *collector) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = nil
+}
+
+// matching returns the messages received so far containing s.
+func (c *collector) matching(s string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ms []string
+	for _, m := range c.messages {
+		if strings.Contains(m, s) {
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+// stop stops the collector.
+func (c *collector) stop() {
+	c.conn.Close()
+	<-c.done
+}
+
+// configureDUT configures the DUT interfaces, the static route of
+// routedPrefix and the remote syslog server of the collector.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dutSrc},
+		{"port2", dutDst},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	b := &gnmi.SetBatch{}
+	cfg := &cfgplugins.StaticRouteCfg{
+		NetworkInstance: deviations.DefaultNetworkInstance(dut),
+		Prefix:          routedPrefix,
+		NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+			"0": oc.UnionString(ateDst.IPv4),
+		},
+	}
+	if _, err := cfgplugins.NewStaticRouteCfg(b, cfg, dut); err != nil {
+		t.Fatalf("Failed to configure the static route to %s: %v", routedPrefix, err)
+	}
+
+	rs := &oc.System_Logging_RemoteServer{Host: ygot.String(*collectorAddress)}
+	rs.SetRemotePort(uint16(*collectorPort))
+	ni := *collectorNI
+	if ni == "" {
+		ni = deviations.DefaultNetworkInstance(dut)
+	}
+	rs.SetNetworkInstance(ni)
+	rs.GetOrCreateSelector(oc.SystemLogging_SYSLOG_FACILITY_ALL, oc.SystemLogging_SyslogSeverity_INFORMATIONAL)
+	gnmi.BatchReplace(b, gnmi.OC().System().Logging().RemoteServer(*collectorAddress).Config(), rs)
+	b.Set(t, dut)
+}
+
+// aclSet returns the ACL denying and logging the packets to routedPrefix,
+// and accepting the other packets without logging them.
+func aclSet() *oc.Acl_AclSet {
+	a := &oc.Acl_AclSet{Name: ygot.String(aclName), Type: oc.Acl_ACL_TYPE_ACL_IPV4}
+	e := a.GetOrCreateAclEntry(denySeq)
+	e.GetOrCreateActions().SetForwardingAction(oc.Acl_FORWARDING_ACTION_DROP)
+	e.GetOrCreateActions().SetLogAction(oc.Acl_LOG_ACTION_LOG_SYSLOG)
+	e.GetOrCreateIpv4().SetDestinationAddress(routedPrefix)
+	e = a.GetOrCreateAclEntry(permitSeq)
+	e.GetOrCreateActions().SetForwardingAction(oc.Acl_FORWARDING_ACTION_ACCEPT)
+	e.GetOrCreateActions().SetLogAction(oc.Acl_LOG_ACTION_LOG_NONE)
+	e.GetOrCreateIpv4().SetSourceAddress("0.0.0.0/0")
+	e.GetOrCreateIpv4().SetDestinationAddress("0.0.0.0/0")
+	return a
+}
+
+// applyACL configures the ACL and applies it to the input of interface
+// intf.
+func applyACL(t *testing.T, dut *ondatra.DUTDevice, intf string) {
+	t.Helper()
+	ai := &oc.Acl_Interface{Id: ygot.String(intf)}
+	ai.GetOrCreateInterfaceRef().SetInterface(intf)
+	ai.GetOrCreateInterfaceRef().SetSubinterface(0)
+	ai.GetOrCreateIngressAclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4)
+
+	b := &gnmi.SetBatch{}
+	gnmi.BatchReplace(b, gnmi.OC().Acl().AclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4).Config(), aclSet())
+	gnmi.BatchReplace(b, gnmi.OC().Acl().Interface(intf).Config(), ai)
+	b.Set(t, dut)
+}
+
+// addFlow adds a flow named name from ate:port1 to dst.
+func addFlow(top gosnappi.Config, name, dst string) {
+	flow := top.Flows().Add().SetName(name)
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Device().SetTxNames([]string{ateSrc.Name + ".IPv4"}).SetRxNames([]string{ateDst.Name + ".IPv4"})
+	flow.Packet().Add().Ethernet().Src().SetValue(ateSrc.MAC)
+	ip := flow.Packet().Add().Ipv4()
+	ip.Src().SetValue(ateSrc.IPv4)
+	ip.Dst().SetValue(dst)
+	flow.Size().SetFixed(frameSize)
+	flow.Rate().SetPps(ppsRate)
+	flow.Duration().FixedPackets().SetPackets(packets)
+}
+
+func TestACLLogging(t *testing.T) {
+	if *collectorAddress == "" {
+		t.Skip("The syslog collector requires -collector_address")
+	}
+	c, err := startCollector(*collectorPort)
+	if err != nil {
+		t.Fatalf("Cannot start the syslog collector on port %d: %v", *collectorPort, err)
+	}
+	defer c.stop()
+
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+	intf := dut.Port(t, "port1").Name()
+	applyACL(t, dut, intf)
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutSrc)
+	ateDst.AddToOTG(top, ate.Port(t, "port2"), &dutDst)
+
+	cases := []struct {
+		desc string
+		dst  string
+		// wantLogged is whether the packets are denied and logged.
+		wantLogged bool
+	}{{
+		desc:       "Denied",
+		dst:        deniedDst,
+		wantLogged: true,
+	}, {
+		desc: "Permitted",
+		dst:  ateDst.IPv4,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			top.Flows().Clear()
+			addFlow(top, tc.desc, tc.dst)
+			ate.OTG().PushConfig(t, top)
+			ate.OTG().StartProtocols(t)
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+			c.reset()
+			ate.OTG().StartTraffic(t)
+			time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+			ate.OTG().StopTraffic(t)
+			time.Sleep(*logWait)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+			counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(tc.desc).Counters().State())
+			sent := counters.GetOutPkts()
+			switch {
+			case sent == 0:
+				t.Fatalf("Flow %s sent no packets", tc.desc)
+			case tc.wantLogged && counters.GetInPkts() != 0:
+				t.Errorf("Flow %s: got %d packets received of %d sent, want all dropped", tc.desc, counters.GetInPkts(), sent)
+			case !tc.wantLogged && counters.GetInPkts() != sent:
+				t.Errorf("Flow %s: got %d packets received of %d sent, want no loss", tc.desc, counters.GetInPkts(), sent)
+			}
+
+			logged := c.matching(tc.dst)
+			t.Logf("Received %d syslog messages for %s", len(logged), tc.dst)
+			if len(logged) > 0 {
+				t.Logf("First message: %s", logged[0])
+			}
+			switch {
+			case tc.wantLogged && len(logged) == 0:
+				t.Errorf("Got no syslog messages for the packets to %s, want at least one", tc.dst)
+			case tc.wantLogged && uint64(len(logged)) >= sent:
+				t.Errorf("Got %d syslog messages for %d packets to %s, want them rate limited", len(logged), sent, tc.dst)
+			case !tc.wantLogged && len(logged) != 0:
+				t.Errorf("Got %d syslog messages for the packets to %s, want none", len(logged), tc.dst)
+			}
+		})
+	}
+
+	gnmi.Delete(t, dut, gnmi.OC().Acl().Interface(intf).Config())
+	gnmi.Delete(t, dut, gnmi.OC().Acl().AclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4).Config())
+	gnmi.Delete(t, dut, gnmi.OC().System().Logging().RemoteServer(*collectorAddress).Config())
+}
@@ -0,0 +1,315 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl_scale_test
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+var (
+	entries      = flag.Int("entries", 4000, "number of deny entries of the ACL")
+	maxApplyTime = flag.Duration("max_apply_time", time.Minute, "maximum time from the Set of the ACL until the DUT reports all its entries")
+	spotChecks   = flag.Int("spot_checks", 10, "number of randomly chosen entries verified with traffic")
+	seed         = flag.Int64("seed", 0, "seed of the random choice of the entries, or 0 for a seed from the current time")
+)
+
+// The testbed consists of ate:port1 -> dut:port1 -> dut:port2 -> ate:port2,
+// which carries the traffic filtered by the ACL, and ate:port3 -> dut:port3
+// -> dut:port4 -> ate:port4, which carries the unrelated traffic.
+const (
+	plen      = 30
+	aclName   = "scale-filter"
+	packets   = 1000
+	frameSize = 256
+
+	// routedPrefix is routed to ate:port2, and contains the destination
+	// addresses of all the entries and permittedDst.
+	routedPrefix = "100.64.0.0/10"
+	permittedDst = "100.127.255.1"
+	// maxEntries is the number of destination addresses of the entries in
+	// routedPrefix below permittedDst.
+	maxEntries = 63 * 256 * 256
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dutSrc = attrs.Attributes{
+		Desc:    "Filtered input",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dutDst = attrs.Attributes{
+		Desc:    "Filtered output",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	ateOtherSrc = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv4Len: plen,
+	}
+	dutOtherSrc = attrs.Attributes{
+		Desc:    "Unrelated input",
+		IPv4:    "192.0.2.9",
+		IPv4Len: plen,
+	}
+	dutOtherDst = attrs.Attributes{
+		Desc:    "Unrelated output",
+		IPv4:    "192.0.2.13",
+		IPv4Len: plen,
+	}
+	ateOtherDst = attrs.Attributes{
+		Name:    "ate4",
+		MAC:     "02:00:04:01:01:01",
+		IPv4:    "192.0.2.14",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// entryDst returns the destination address of the deny entry with the
+// sequence number seq, which starts at 1.
+func entryDst(seq int) string {
+	i := seq - 1
+	return fmt.Sprintf("100.%d.%d.%d", 64+i/(256*256), i/256%256, i%256)
+}
+
+// permitSeq returns the sequence number of the entry accepting all the
+// packets, which follows the deny entries.
+func permitSeq() uint32 {
+	return uint32(*entries) + 1
+}
+
+// configureDUT configures the DUT interfaces and the static route of
+// routedPrefix.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dutSrc},
+		{"port2", dutDst},
+		{"port3", dutOtherSrc},
+		{"port4", dutOtherDst},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	b := &gnmi.SetBatch{}
+	cfg := &cfgplugins.StaticRouteCfg{
+		NetworkInstance: deviations.DefaultNetworkInstance(dut),
+		Prefix:          routedPrefix,
+		NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+			"0": oc.UnionString(ateDst.IPv4),
+		},
+	}
+	if _, err := cfgplugins.NewStaticRouteCfg(b, cfg, dut); err != nil {
+		t.Fatalf("Failed to configure the static route to %s: %v", routedPrefix, err)
+	}
+	b.Set(t, dut)
+}
+
+// aclSet returns the ACL with a deny entry of the destination address of
+// each sequence number up to the number of entries, followed by an entry
+// accepting all the packets.
+func aclSet() *oc.Acl_AclSet {
+	a := &oc.Acl_AclSet{Name: ygot.String(aclName), Type: oc.Acl_ACL_TYPE_ACL_IPV4}
+	for seq := 1; seq <= *entries; seq++ {
+		e := a.GetOrCreateAclEntry(uint32(seq))
+		e.GetOrCreateActions().SetForwardingAction(oc.Acl_FORWARDING_ACTION_DROP)
+		e.GetOrCreateIpv4().SetDestinationAddress(entryDst(seq) + "/32")
+	}
+	e := a.GetOrCreateAclEntry(permitSeq())
+	e.GetOrCreateActions().SetForwardingAction(oc.Acl_FORWARDING_ACTION_ACCEPT)
+	e.GetOrCreateIpv4().SetSourceAddress("0.0.0.0/0")
+	e.GetOrCreateIpv4().SetDestinationAddress("0.0.0.0/0")
+	return a
+}
+
+// aclInterface returns the binding of the ACL to the input of interface
+// intf.
+func aclInterface(intf string) *oc.Acl_Interface {
+	a := &oc.Acl_Interface{Id: ygot.String(intf)}
+	a.GetOrCreateInterfaceRef().SetInterface(intf)
+	a.GetOrCreateInterfaceRef().SetSubinterface(0)
+	a.GetOrCreateIngressAclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4)
+	return a
+}
+
+// addFlow adds a flow named name from src to the address dst routed to
+// rx. The flow sends count packets if count is not 0, or else continuously.
+func addFlow(top gosnappi.Config, name string, src, rx attrs.Attributes, dst string, count uint32) {
+	flow := top.Flows().Add().SetName(name)
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Device().SetTxNames([]string{src.Name + ".IPv4"}).SetRxNames([]string{rx.Name + ".IPv4"})
+	flow.Packet().Add().Ethernet().Src().SetValue(src.MAC)
+	ip := flow.Packet().Add().Ipv4()
+	ip.Src().SetValue(src.IPv4)
+	ip.Dst().SetValue(dst)
+	flow.Size().SetFixed(frameSize)
+	flow.Rate().SetPps(1000)
+	if count != 0 {
+		flow.Duration().FixedPackets().SetPackets(count)
+	}
+}
+
+func TestACLScale(t *testing.T) {
+	if *entries < 1 || *entries > maxEntries {
+		t.Fatalf("Invalid number of entries %d, want 1 to %d", *entries, maxEntries)
+	}
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+	intf := dut.Port(t, "port1").Name()
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutSrc)
+	ateDst.AddToOTG(top, ate.Port(t, "port2"), &dutDst)
+	ateOtherSrc.AddToOTG(top, ate.Port(t, "port3"), &dutOtherSrc)
+	ateOtherDst.AddToOTG(top, ate.Port(t, "port4"), &dutOtherDst)
+	addFlow(top, "unrelated", ateOtherSrc, ateOtherDst, ateOtherDst.IPv4, 0)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+	t.Run("Programming", func(t *testing.T) {
+		ate.OTG().StartTraffic(t)
+		b := &gnmi.SetBatch{}
+		gnmi.BatchReplace(b, gnmi.OC().Acl().AclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4).Config(), aclSet())
+		gnmi.BatchReplace(b, gnmi.OC().Acl().Interface(intf).Config(), aclInterface(intf))
+		start := time.Now()
+		b.Set(t, dut)
+		t.Logf("Set of the ACL with %d entries took %v", *entries+1, time.Since(start))
+
+		last := gnmi.OC().Acl().AclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4).AclEntry(permitSeq()).SequenceId().State()
+		_, ok := gnmi.Watch(t, dut, last, *maxApplyTime, func(v *ygnmi.Value[uint32]) bool {
+			seq, present := v.Val()
+			return present && seq == permitSeq()
+		}).Await(t)
+		applyTime := time.Since(start)
+		if !ok {
+			t.Errorf("DUT did not report the last entry of the ACL within %v", *maxApplyTime)
+		} else {
+			t.Logf("DUT reported all the entries of the ACL %v after the start of the Set", applyTime)
+		}
+
+		// Keep the unrelated traffic running for a while after the ACL is
+		// programmed.
+		time.Sleep(10 * time.Second)
+		ate.OTG().StopTraffic(t)
+		time.Sleep(10 * time.Second)
+		otgutils.LogFlowMetrics(t, ate.OTG(), top)
+		counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow("unrelated").Counters().State())
+		if counters.GetOutPkts() == 0 || counters.GetInPkts() != counters.GetOutPkts() {
+			t.Errorf("Unrelated flow: got %d packets received of %d sent, want no loss", counters.GetInPkts(), counters.GetOutPkts())
+		}
+	})
+
+	t.Run("Spot checks", func(t *testing.T) {
+		s := *seed
+		if s == 0 {
+			s = time.Now().UnixNano()
+		}
+		t.Logf("Seed of the spot checks: %d", s)
+		r := rand.New(rand.NewSource(s))
+		checked := map[int]bool{}
+		for len(checked) < *spotChecks && len(checked) < *entries {
+			checked[r.Intn(*entries)+1] = true
+		}
+
+		top.Flows().Clear()
+		for seq := range checked {
+			addFlow(top, fmt.Sprintf("entry-%d", seq), ateSrc, ateDst, entryDst(seq), packets)
+		}
+		addFlow(top, "permitted", ateSrc, ateDst, permittedDst, packets)
+		ate.OTG().PushConfig(t, top)
+		ate.OTG().StartProtocols(t)
+		otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+		matched := func(seq uint32) uint64 {
+			q := gnmi.OC().Acl().Interface(intf).IngressAclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4).AclEntry(seq).MatchedPackets().State()
+			// The counter is 0 if the device has not matched any packet yet.
+			v, _ := gnmi.Lookup(t, dut, q).Val()
+			return v
+		}
+		before := map[int]uint64{}
+		for seq := range checked {
+			before[seq] = matched(uint32(seq))
+		}
+
+		ate.OTG().StartTraffic(t)
+		time.Sleep(packets/1000*time.Second + 5*time.Second)
+		ate.OTG().StopTraffic(t)
+		time.Sleep(10 * time.Second)
+		otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+		for seq := range checked {
+			name := fmt.Sprintf("entry-%d", seq)
+			counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(name).Counters().State())
+			if counters.GetOutPkts() == 0 || counters.GetInPkts() != 0 {
+				t.Errorf("Flow %s to %s: got %d packets received of %d sent, want all dropped", name, entryDst(seq), counters.GetInPkts(), counters.GetOutPkts())
+			}
+			if got := matched(uint32(seq)) - before[seq]; got < counters.GetOutPkts() {
+				t.Errorf("Entry %d: got %d matched packets, want at least %d", seq, got, counters.GetOutPkts())
+			}
+		}
+		counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow("permitted").Counters().State())
+		if counters.GetOutPkts() == 0 || counters.GetInPkts() != counters.GetOutPkts() {
+			t.Errorf("Flow permitted: got %d packets received of %d sent, want no loss", counters.GetInPkts(), counters.GetOutPkts())
+		}
+	})
+
+	gnmi.Delete(t, dut, gnmi.OC().Acl().Interface(intf).Config())
+	gnmi.Delete(t, dut, gnmi.OC().Acl().AclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4).Config())
+}
@@ -0,0 +1,342 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dhcp_client_test
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, on which the DUT is a DHCP
+// client. The management interface of the DUT, of which the DHCP client is
+// usually enabled, is not connected to the ATE, so the DHCP client is
+// verified on dut:port1.
+//
+// The ATE emulates two DHCP servers of the LAN, serverA and serverB. The OTG
+// does not emulate DHCP servers, so the ATE sends their messages as raw
+// flows, and the messages of the DUT are captured. The replies of the
+// servers depend on the messages of the DUT, so their flows are added once
+// the messages have been captured.
+const (
+	plen = 24
+
+	// leaseTime, renewalTime and rebindingTime are the lease time, T1 and
+	// T2 of the leases of the servers.
+	leaseTime     = 60 * time.Second
+	renewalTime   = 30 * time.Second
+	rebindingTime = 52 * time.Second
+
+	captureName = "dhcp-capture"
+)
+
+var (
+	serverA = attrs.Attributes{
+		Name:    "serverA",
+		MAC:     "02:00:01:01:01:02",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	serverB = attrs.Attributes{
+		Name:    "serverB",
+		MAC:     "02:00:01:01:01:03",
+		IPv4:    "192.0.2.3",
+		IPv4Len: plen,
+	}
+
+	// offers are the addresses offered by the servers.
+	offers = map[string]string{
+		serverA.IPv4: "192.0.2.100",
+		serverB.IPv4: "192.0.2.200",
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT enables the DHCP client on dut:port1.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	p1 := dut.Port(t, "port1")
+	i := (&attrs.Attributes{Desc: "DHCP client"}).NewOCInterface(p1.Name(), dut)
+	s4 := i.GetOrCreateSubinterface(0).GetOrCreateIpv4()
+	if deviations.InterfaceEnabled(dut) && !deviations.IPv4MissingEnabled(dut) {
+		s4.SetEnabled(true)
+	}
+	s4.SetDhcpClient(true)
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p1.Name()).Config(), i)
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+	}
+}
+
+// reply is a reply of a server to the DUT.
+type reply struct {
+	server attrs.Attributes
+	// dstMAC and dst are the destination of the reply, broadcast before
+	// the DUT has an address.
+	dstMAC, dst string
+	msg         *layers.DHCPv4
+}
+
+// configureATE configures the flows of replies, each sent 3 times, and the
+// capture of ate:port1.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice, replies ...*reply) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	p1 := ate.Port(t, "port1")
+	top.Ports().Add().SetName(p1.ID())
+	for _, r := range replies {
+		fl := top.Flows().Add().SetName(r.server.Name)
+		fl.TxRx().Port().SetTxName(p1.ID())
+		fl.Duration().FixedPackets().SetPackets(3)
+		fl.Rate().SetPps(1)
+		eth := fl.Packet().Add().Ethernet()
+		eth.Src().SetValue(r.server.MAC)
+		eth.Dst().SetValue(r.dstMAC)
+		ip := fl.Packet().Add().Ipv4()
+		ip.Src().SetValue(r.server.IPv4)
+		ip.Dst().SetValue(r.dst)
+		udp := fl.Packet().Add().Udp()
+		udp.SrcPort().SetValue(67)
+		udp.DstPort().SetValue(68)
+		buf := gopacket.NewSerializeBuffer()
+		if err := r.msg.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+			t.Fatalf("Cannot serialize the reply of %s: %v", r.server.Name, err)
+		}
+		fl.Packet().Add().Custom().SetBytes(hex.EncodeToString(buf.Bytes()))
+	}
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{p1.ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// serverMessage returns the message of type typ of server to the client
+// message m, with the address addr and the lease of the servers.
+func serverMessage(server attrs.Attributes, typ layers.DHCPMsgType, m *layers.DHCPv4, addr string) *layers.DHCPv4 {
+	seconds := func(d time.Duration) []byte {
+		return binary.BigEndian.AppendUint32(nil, uint32(d/time.Second))
+	}
+	return &layers.DHCPv4{
+		Operation:    layers.DHCPOpReply,
+		HardwareType: layers.LinkTypeEthernet,
+		Xid:          m.Xid,
+		Flags:        m.Flags,
+		ClientIP:     m.ClientIP,
+		YourClientIP: net.ParseIP(addr),
+		ClientHWAddr: m.ClientHWAddr,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(typ)}),
+			layers.NewDHCPOption(layers.DHCPOptServerID, net.ParseIP(server.IPv4).To4()),
+			layers.NewDHCPOption(layers.DHCPOptLeaseTime, seconds(leaseTime)),
+			layers.NewDHCPOption(layers.DHCPOptT1, seconds(renewalTime)),
+			layers.NewDHCPOption(layers.DHCPOptT2, seconds(rebindingTime)),
+			layers.NewDHCPOption(layers.DHCPOptSubnetMask, net.CIDRMask(plen, 32)),
+		},
+	}
+}
+
+// broadcast returns the broadcast reply of server to m.
+func broadcast(server attrs.Attributes, msg *layers.DHCPv4) *reply {
+	return &reply{server: server, dstMAC: "ff:ff:ff:ff:ff:ff", dst: "255.255.255.255", msg: msg}
+}
+
+// startReplies pushes the flows of replies and starts them with the capture
+// of ate:port1.
+func startReplies(t *testing.T, ate *ondatra.ATEDevice, replies ...*reply) {
+	t.Helper()
+	ate.OTG().PushConfig(t, configureATE(t, ate, replies...))
+	ate.OTG().StartProtocols(t)
+	otgutils.StartCapture(t, ate.OTG())
+	if len(replies) > 0 {
+		ate.OTG().StartTraffic(t)
+	}
+}
+
+// clientMessage is a captured message of the DUT.
+type clientMessage struct {
+	ip  *layers.IPv4
+	msg *layers.DHCPv4
+}
+
+// stopCapture stops the capture of ate:port1 and returns the DHCP messages
+// of type typ of the DUT captured.
+func stopCapture(t *testing.T, ate *ondatra.ATEDevice, typ layers.DHCPMsgType) []clientMessage {
+	t.Helper()
+	otgutils.StopCapture(t, ate.OTG())
+	var msgs []clientMessage
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port1").ID()) {
+		d, ok := p.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+		if !ok || d.Operation != layers.DHCPOpRequest {
+			continue
+		}
+		if got := option(d, layers.DHCPOptMessageType); len(got) == 1 && layers.DHCPMsgType(got[0]) == typ {
+			msgs = append(msgs, clientMessage{ip: p.Layer(layers.LayerTypeIPv4).(*layers.IPv4), msg: d})
+		}
+	}
+	return msgs
+}
+
+// option returns the data of the option typ of d, or nil.
+func option(d *layers.DHCPv4, typ layers.DHCPOpt) []byte {
+	for _, o := range d.Options {
+		if o.Type == typ {
+			return o.Data
+		}
+	}
+	return nil
+}
+
+// awaitAddress waits for addr to be the address of dut:port1 assigned by
+// DHCP if present, or to be removed otherwise.
+func awaitAddress(t *testing.T, dut *ondatra.DUTDevice, addr string, present bool, timeout time.Duration) {
+	t.Helper()
+	q := gnmi.OC().Interface(dut.Port(t, "port1").Name()).Subinterface(0).Ipv4().Address(addr).State()
+	v, ok := gnmi.Watch(t, dut, q, timeout, func(v *ygnmi.Value[*oc.Interface_Subinterface_Ipv4_Address]) bool {
+		return v.IsPresent() == present
+	}).Await(t)
+	if !ok {
+		t.Fatalf("Address %s of port1: got present %t, want %t", addr, !present, present)
+	}
+	if !present {
+		return
+	}
+	a, _ := v.Val()
+	if got := a.GetPrefixLength(); got != plen {
+		t.Errorf("Prefix length of %s: got %d, want %d", addr, got, plen)
+	}
+	if got := a.GetOrigin(); got != oc.IfIp_IpAddressOrigin_DHCP {
+		t.Errorf("Origin of %s: got %v, want %v", addr, got, oc.IfIp_IpAddressOrigin_DHCP)
+	}
+}
+
+func TestDHCPClient(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	dutMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port1").Name()).Ethernet().MacAddress().State())
+
+	startReplies(t, ate)
+	configureDUT(t, dut)
+	time.Sleep(10 * time.Second)
+	discovers := stopCapture(t, ate, layers.DHCPMsgTypeDiscover)
+	if len(discovers) == 0 {
+		t.Fatalf("No DHCPDISCOVER of the DUT captured")
+	}
+	discover := discovers[len(discovers)-1].msg
+	if got := discover.ClientHWAddr.String(); got != dutMAC {
+		t.Errorf("Client hardware address of the discover: got %s, want %s", got, dutMAC)
+	}
+
+	var server attrs.Attributes
+	var request *layers.DHCPv4
+	t.Run("ConflictingOffers", func(t *testing.T) {
+		startReplies(t, ate,
+			broadcast(serverA, serverMessage(serverA, layers.DHCPMsgTypeOffer, discover, offers[serverA.IPv4])),
+			broadcast(serverB, serverMessage(serverB, layers.DHCPMsgTypeOffer, discover, offers[serverB.IPv4])))
+		time.Sleep(10 * time.Second)
+		requests := stopCapture(t, ate, layers.DHCPMsgTypeRequest)
+		if len(requests) == 0 {
+			t.Fatalf("No DHCPREQUEST of the DUT captured")
+		}
+		// The DUT requests one of the offers, which it keeps requesting
+		// until acknowledged.
+		for _, r := range requests {
+			serverID := net.IP(option(r.msg, layers.DHCPOptServerID)).String()
+			requested := net.IP(option(r.msg, layers.DHCPOptRequestIP)).String()
+			want, ok := offers[serverID]
+			if !ok {
+				t.Fatalf("Server identifier of the request: got %s, want %s or %s", serverID, serverA.IPv4, serverB.IPv4)
+			}
+			if requested != want {
+				t.Errorf("Requested address: got %s, want %s offered by %s", requested, want, serverID)
+			}
+			if request != nil && serverID != net.IP(option(request, layers.DHCPOptServerID)).String() {
+				t.Errorf("Server identifier of the requests: got %s and %s, want one of them", serverID, net.IP(option(request, layers.DHCPOptServerID)))
+			}
+			request = r.msg
+		}
+		server = serverA
+		if net.IP(option(request, layers.DHCPOptServerID)).String() == serverB.IPv4 {
+			server = serverB
+		}
+		t.Logf("DUT requested the offer of %s", server.Name)
+	})
+	if request == nil {
+		t.Fatalf("DUT did not request an offer")
+	}
+	addr := offers[server.IPv4]
+
+	acked := time.Now()
+	t.Run("Lease", func(t *testing.T) {
+		startReplies(t, ate, broadcast(server, serverMessage(server, layers.DHCPMsgTypeAck, request, addr)))
+		awaitAddress(t, dut, addr, true, time.Minute)
+	})
+
+	var renewal clientMessage
+	t.Run("Renewal", func(t *testing.T) {
+		// The DUT renews its lease with its server from T1 until T2.
+		time.Sleep(time.Until(acked.Add(rebindingTime)))
+		var found bool
+		for _, r := range stopCapture(t, ate, layers.DHCPMsgTypeRequest) {
+			// The requests retransmitted before the acknowledgement have
+			// no client address.
+			if !r.msg.ClientIP.IsUnspecified() {
+				renewal, found = r, true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("No renewal of the lease of the DUT captured before T2")
+		}
+		if got := renewal.ip.DstIP.String(); got != server.IPv4 {
+			t.Errorf("Destination of the renewal: got %s, want %s", got, server.IPv4)
+		}
+		if got := renewal.msg.ClientIP.String(); got != addr {
+			t.Errorf("Client address of the renewal: got %s, want %s", got, addr)
+		}
+		if id := option(renewal.msg, layers.DHCPOptServerID); id != nil {
+			t.Errorf("Renewal with server identifier %s, want none", net.IP(id))
+		}
+
+		renewed := serverMessage(server, layers.DHCPMsgTypeAck, renewal.msg, addr)
+		startReplies(t, ate, &reply{server: server, dstMAC: dutMAC, dst: addr, msg: renewed})
+		acked = time.Now()
+		// The address is kept after the end of the first lease.
+		time.Sleep(leaseTime - rebindingTime + 10*time.Second)
+		awaitAddress(t, dut, addr, true, time.Second)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		// Without renewal, the address is removed at the end of the lease.
+		awaitAddress(t, dut, addr, false, time.Until(acked.Add(leaseTime+10*time.Second)))
+	})
+}
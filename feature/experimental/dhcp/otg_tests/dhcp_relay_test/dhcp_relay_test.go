@@ -0,0 +1,690 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dhcp_relay_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/mcast"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the client LAN, and
+// dut:port2 -> ate:port2, the LAN of the DHCP server.
+//
+// The client LAN is the VLAN subinterface vlanID of dut:port1, on which the
+// DUT relays the DHCP and DHCPv6 messages of the clients to the server. The
+// OTG does not emulate DHCP clients and servers, so the ATE sends the
+// messages of the client and the server as raw flows, and the messages
+// relayed by the DUT are captured. The reply of the server echoes the relay
+// agent information, or interface-id, option of the relayed request, so the
+// flow of the reply is added once the request has been relayed.
+//
+// The relay agent model is not part of the OpenConfig schema of ondatra, so
+// the relay is configured, and its counters read, with raw gNMI requests on
+// the OpenConfig paths.
+const (
+	vlanID = 10
+
+	clientMAC = "02:00:01:01:01:01"
+	xid       = 0x12345678
+
+	captureName = "dhcp-capture"
+)
+
+var (
+	dutClient = attrs.Attributes{
+		IPv4:    "192.0.2.1",
+		IPv4Len: 24,
+		IPv6:    "2001:db8:1::1",
+		IPv6Len: 64,
+	}
+	dutServer = attrs.Attributes{
+		Desc:    "DHCP server LAN",
+		IPv4:    "198.51.100.1",
+		IPv4Len: 30,
+		IPv6:    "2001:db8:2::1",
+		IPv6Len: 126,
+	}
+	ateServer = attrs.Attributes{
+		Name:    "server",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "198.51.100.2",
+		IPv4Len: 30,
+		IPv6:    "2001:db8:2::2",
+		IPv6Len: 126,
+	}
+
+	// clientLinkLocal is the address of the DHCPv6 client.
+	clientLinkLocal = mcast.LinkLocal(clientMAC)
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// relayed is what the relay adds to a relayed request, of which the reply
+// of the server is built.
+type relayed struct {
+	// src is the source address of the relayed request, and the
+	// destination of the reply.
+	src net.IP
+	// option is the relay agent information option of a DHCP request, or
+	// the interface-id option of a DHCPv6 request.
+	option []byte
+	// linkAddr is the link address of the relay-forward message of a
+	// DHCPv6 request.
+	linkAddr net.IP
+}
+
+// family is the DHCP version of an address family.
+type family struct {
+	name string
+	ipv6 bool
+	// model is the container of the family in the relay agent model.
+	model string
+	// requestCounters and replyCounters are the counters of the relay
+	// incremented by the relay of the request and of the reply.
+	requestCounters []string
+	replyCounters   []string
+}
+
+var (
+	ipv4 = &family{
+		name:            "IPv4",
+		model:           "dhcp",
+		requestCounters: []string{"dhcp-discover-received", "bootrequest-sent"},
+		replyCounters:   []string{"dhcp-offer-sent", "bootreply-sent"},
+	}
+	ipv6 = &family{
+		name:            "IPv6",
+		ipv6:            true,
+		model:           "dhcpv6",
+		requestCounters: []string{"dhcpv6-solicit-received", "dhcpv6-relay-forw-sent"},
+		replyCounters:   []string{"dhcpv6-relay-reply-received", "dhcpv6-adverstise-sent"},
+	}
+)
+
+// relayInterface returns the name of the subinterface of the client LAN.
+func relayInterface(t *testing.T, dut *ondatra.DUTDevice) string {
+	return fmt.Sprintf("%s.%d", dut.Port(t, "port1").Name(), vlanID)
+}
+
+// configureDUT configures the client LAN on the subinterface vlanID of
+// dut:port1, and the LAN of the server on dut:port2.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+
+	i := &oc.Interface{Name: ygot.String(p1.Name()), Type: oc.IETFInterfaces_InterfaceType_ethernetCsmacd}
+	if deviations.InterfaceEnabled(dut) {
+		i.Enabled = ygot.Bool(true)
+	}
+	s := i.GetOrCreateSubinterface(vlanID)
+	if deviations.DeprecatedVlanID(dut) {
+		s.GetOrCreateVlan().VlanId = oc.UnionUint16(vlanID)
+	} else {
+		s.GetOrCreateVlan().GetOrCreateMatch().GetOrCreateSingleTagged().VlanId = ygot.Uint16(vlanID)
+	}
+	s4 := s.GetOrCreateIpv4()
+	s6 := s.GetOrCreateIpv6()
+	if deviations.InterfaceEnabled(dut) {
+		if !deviations.IPv4MissingEnabled(dut) {
+			s4.Enabled = ygot.Bool(true)
+		}
+		s6.Enabled = ygot.Bool(true)
+	}
+	s4.GetOrCreateAddress(dutClient.IPv4).PrefixLength = ygot.Uint8(dutClient.IPv4Len)
+	s6.GetOrCreateAddress(dutClient.IPv6).PrefixLength = ygot.Uint8(dutClient.IPv6Len)
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p1.Name()).Config(), i)
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p2.Name()).Config(), dutServer.NewOCInterface(p2.Name(), dut))
+
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), dni, vlanID)
+		fptest.AssignToNetworkInstance(t, dut, p2.Name(), dni, 0)
+	}
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+}
+
+// configureRelay configures the DHCP and DHCPv6 relay on the client LAN to
+// ateServer, with the relay agent information and interface-id options.
+func configureRelay(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	intf := func(helper string) map[string]any {
+		id := relayInterface(t, dut)
+		return map[string]any{
+			"interface": []any{map[string]any{
+				"id": id,
+				"config": map[string]any{
+					"id":             id,
+					"enable":         true,
+					"helper-address": []string{helper},
+				},
+				"interface-ref": map[string]any{
+					"config": map[string]any{
+						"interface":    dut.Port(t, "port1").Name(),
+						"subinterface": vlanID,
+					},
+				},
+			}},
+		}
+	}
+	config := map[string]any{
+		"dhcp": map[string]any{
+			"config": map[string]any{"enable-relay-agent": true},
+			"agent-information-option": map[string]any{
+				"config": map[string]any{"enable": true},
+			},
+			"interfaces": intf(ateServer.IPv4),
+		},
+		"dhcpv6": map[string]any{
+			"config": map[string]any{"enable-relay-agent": true},
+			"options": map[string]any{
+				"config": map[string]any{"enable-interface-id": true},
+			},
+			"interfaces": intf(ateServer.IPv6),
+		},
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("Cannot marshal the relay configuration: %v", err)
+	}
+	req := &gpb.SetRequest{
+		Replace: []*gpb.Update{{
+			Path: &gpb.Path{Origin: "openconfig", Elem: []*gpb.PathElem{{Name: "relay-agent"}}},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: b}},
+		}},
+	}
+	if _, err := dut.RawAPIs().GNMI(t).Set(context.Background(), req); err != nil {
+		t.Fatalf("Failed to configure the DHCP relay: %v", err)
+	}
+}
+
+// relayCounters returns the counters of the relay of f on the client LAN,
+// keyed by name.
+func relayCounters(t *testing.T, dut *ondatra.DUTDevice, f *family) map[string]uint64 {
+	t.Helper()
+	p, err := ygot.StringToStructuredPath(fmt.Sprintf("/relay-agent/%s/interfaces/interface[id=%s]/state/counters", f.model, relayInterface(t, dut)))
+	if err != nil {
+		t.Fatalf("Cannot parse the path of the relay counters: %v", err)
+	}
+	p.Origin = "openconfig"
+	resp, err := dut.RawAPIs().GNMI(t).Get(context.Background(), &gpb.GetRequest{
+		Path:     []*gpb.Path{p},
+		Type:     gpb.GetRequest_STATE,
+		Encoding: gpb.Encoding_JSON_IETF,
+	})
+	if err != nil {
+		t.Fatalf("Failed to get the %s relay counters: %v", f.name, err)
+	}
+	counters := map[string]uint64{}
+	for _, n := range resp.GetNotification() {
+		for _, u := range n.GetUpdate() {
+			var name string
+			if elems := u.GetPath().GetElem(); len(elems) > 0 {
+				name = elems[len(elems)-1].GetName()
+			}
+			d := json.NewDecoder(bytes.NewReader(u.GetVal().GetJsonIetfVal()))
+			d.UseNumber()
+			var v any
+			if err := d.Decode(&v); err != nil {
+				t.Fatalf("Cannot decode the %s relay counters: %v", f.name, err)
+			}
+			addCounters(counters, name, v)
+		}
+	}
+	return counters
+}
+
+// addCounters adds to counters the counter name of value v, or the counters
+// of v if it is a container. The 64-bit counters are encoded as strings in
+// JSON_IETF.
+func addCounters(counters map[string]uint64, name string, v any) {
+	// Remove the module prefix of the name.
+	if _, after, ok := strings.Cut(name, ":"); ok {
+		name = after
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for k, c := range v {
+			addCounters(counters, k, c)
+		}
+	case string:
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			counters[name] = n
+		}
+	case json.Number:
+		if n, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			counters[name] = n
+		}
+	}
+}
+
+// verifyCounters verifies that the relay counters names of f were
+// incremented since before.
+func verifyCounters(t *testing.T, dut *ondatra.DUTDevice, f *family, before map[string]uint64, names []string) {
+	t.Helper()
+	after := relayCounters(t, dut, f)
+	for _, name := range names {
+		got, ok := after[name]
+		if !ok {
+			t.Errorf("%s relay counter %s not found", f.name, name)
+			continue
+		}
+		if got <= before[name] {
+			t.Errorf("%s relay counter %s: got %d, want more than %d", f.name, name, got, before[name])
+		}
+	}
+}
+
+// configureATE configures ateServer and the flow of the request of the
+// client of f, with the flow of the reply of the server to the relayed
+// request r if not nil, sent to the DUT at dutMAC.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice, f *family, r *relayed, dutMAC string) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	p1 := ate.Port(t, "port1")
+	p2 := ate.Port(t, "port2")
+	top.Ports().Add().SetName(p1.ID())
+	ateServer.AddToOTG(top, p2, &dutServer)
+
+	fl := top.Flows().Add().SetName("request")
+	fl.TxRx().Port().SetTxName(p1.ID())
+	fl.Duration().FixedPackets().SetPackets(1)
+	eth := fl.Packet().Add().Ethernet()
+	eth.Src().SetValue(clientMAC)
+	fl.Packet().Add().Vlan().Id().SetValue(vlanID)
+	if f.ipv6 {
+		const allRelayAgents = "ff02::1:2"
+		eth.Dst().SetValue(mcast.MAC(allRelayAgents))
+		ip := fl.Packet().Add().Ipv6()
+		ip.Src().SetValue(clientLinkLocal)
+		ip.Dst().SetValue(allRelayAgents)
+		udp := fl.Packet().Add().Udp()
+		udp.SrcPort().SetValue(546)
+		udp.DstPort().SetValue(547)
+		fl.Packet().Add().Custom().SetBytes(hex.EncodeToString(serialize(t, solicit())))
+	} else {
+		eth.Dst().SetValue("ff:ff:ff:ff:ff:ff")
+		ip := fl.Packet().Add().Ipv4()
+		ip.Src().SetValue("0.0.0.0")
+		ip.Dst().SetValue("255.255.255.255")
+		udp := fl.Packet().Add().Udp()
+		udp.SrcPort().SetValue(68)
+		udp.DstPort().SetValue(67)
+		fl.Packet().Add().Custom().SetBytes(hex.EncodeToString(serialize(t, discover())))
+	}
+
+	if r != nil {
+		fl := top.Flows().Add().SetName("reply")
+		fl.TxRx().Port().SetTxName(p2.ID())
+		fl.Duration().FixedPackets().SetPackets(1)
+		eth := fl.Packet().Add().Ethernet()
+		eth.Src().SetValue(ateServer.MAC)
+		eth.Dst().SetValue(dutMAC)
+		if f.ipv6 {
+			ip := fl.Packet().Add().Ipv6()
+			ip.Src().SetValue(ateServer.IPv6)
+			ip.Dst().SetValue(r.src.String())
+			udp := fl.Packet().Add().Udp()
+			udp.SrcPort().SetValue(547)
+			udp.DstPort().SetValue(547)
+			fl.Packet().Add().Custom().SetBytes(hex.EncodeToString(serialize(t, relayReply(t, r))))
+		} else {
+			ip := fl.Packet().Add().Ipv4()
+			ip.Src().SetValue(ateServer.IPv4)
+			ip.Dst().SetValue(r.src.String())
+			udp := fl.Packet().Add().Udp()
+			udp.SrcPort().SetValue(67)
+			udp.DstPort().SetValue(67)
+			fl.Packet().Add().Custom().SetBytes(hex.EncodeToString(serialize(t, offer(r))))
+		}
+	}
+
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{p1.ID(), p2.ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// serialize returns the bytes of the layer l.
+func serialize(t *testing.T, l gopacket.SerializableLayer) []byte {
+	t.Helper()
+	buf := gopacket.NewSerializeBuffer()
+	if err := l.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		t.Fatalf("Cannot serialize %v: %v", l.LayerType(), err)
+	}
+	return buf.Bytes()
+}
+
+// discover returns the DHCPDISCOVER of the client, with the broadcast flag
+// for the offer to be broadcast.
+func discover() *layers.DHCPv4 {
+	mac, _ := net.ParseMAC(clientMAC)
+	return &layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		Xid:          xid,
+		Flags:        0x8000,
+		ClientHWAddr: mac,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeDiscover)}),
+		},
+	}
+}
+
+// offerAddress is the address offered to the client.
+const offerAddress = "192.0.2.100"
+
+// offer returns the DHCPOFFER of the server to the relayed discover r, which
+// echoes its relay agent information option.
+func offer(r *relayed) *layers.DHCPv4 {
+	mac, _ := net.ParseMAC(clientMAC)
+	lease := binary.BigEndian.AppendUint32(nil, 3600)
+	return &layers.DHCPv4{
+		Operation:    layers.DHCPOpReply,
+		HardwareType: layers.LinkTypeEthernet,
+		Xid:          xid,
+		Flags:        0x8000,
+		YourClientIP: net.ParseIP(offerAddress),
+		RelayAgentIP: r.src,
+		ClientHWAddr: mac,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeOffer)}),
+			layers.NewDHCPOption(layers.DHCPOptServerID, net.ParseIP(ateServer.IPv4).To4()),
+			layers.NewDHCPOption(layers.DHCPOptLeaseTime, lease),
+			layers.NewDHCPOption(layers.DHCPOptSubnetMask, net.CIDRMask(int(dutClient.IPv4Len), 32)),
+			layers.NewDHCPOption(layers.DHCPOptRouter, net.ParseIP(dutClient.IPv4).To4()),
+			layers.NewDHCPOption(optRelayAgentInfo, r.option),
+		},
+	}
+}
+
+// duid returns the link-layer address DUID of mac.
+func duid(mac string) []byte {
+	hw, _ := net.ParseMAC(mac)
+	return append([]byte{0, 3, 0, 1}, hw...)
+}
+
+// transactionID is the transaction ID of the DHCPv6 client.
+var transactionID = []byte{0x12, 0x34, 0x56}
+
+// solicit returns the SOLICIT of the client.
+func solicit() *layers.DHCPv6 {
+	return &layers.DHCPv6{
+		MsgType:       layers.DHCPv6MsgTypeSolicit,
+		TransactionID: transactionID,
+		Options: layers.DHCPv6Options{
+			layers.NewDHCPv6Option(layers.DHCPv6OptClientID, duid(clientMAC)),
+			layers.NewDHCPv6Option(layers.DHCPv6OptElapsedTime, []byte{0, 0}),
+			// The IA_NA of IAID 1, without T1 and T2.
+			layers.NewDHCPv6Option(layers.DHCPv6OptIANA, []byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}),
+		},
+	}
+}
+
+// advertiseAddress is the address advertised to the client.
+const advertiseAddress = "2001:db8:1::100"
+
+// relayReply returns the relay-reply of the server to the relayed solicit
+// r, which echoes its interface-id option, with the ADVERTISE to the
+// client.
+func relayReply(t *testing.T, r *relayed) *layers.DHCPv6 {
+	t.Helper()
+	// The IA address, with preferred and valid lifetimes of an hour.
+	iaAddr := append(net.ParseIP(advertiseAddress).To16(), 0, 0, 0x0e, 0x10, 0, 0, 0x0e, 0x10)
+	iaNA := append([]byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}, serializeOption(layers.DHCPv6OptIAAddr, iaAddr)...)
+	adv := &layers.DHCPv6{
+		MsgType:       layers.DHCPv6MsgTypeAdverstise,
+		TransactionID: transactionID,
+		Options: layers.DHCPv6Options{
+			layers.NewDHCPv6Option(layers.DHCPv6OptClientID, duid(clientMAC)),
+			layers.NewDHCPv6Option(layers.DHCPv6OptServerID, duid(ateServer.MAC)),
+			layers.NewDHCPv6Option(layers.DHCPv6OptIANA, iaNA),
+		},
+	}
+	opts := layers.DHCPv6Options{}
+	if r.option != nil {
+		opts = append(opts, layers.NewDHCPv6Option(layers.DHCPv6OptInterfaceID, r.option))
+	}
+	opts = append(opts, layers.NewDHCPv6Option(layers.DHCPv6OptRelayMessage, serialize(t, adv)))
+	return &layers.DHCPv6{
+		MsgType:  layers.DHCPv6MsgTypeRelayReply,
+		LinkAddr: r.linkAddr,
+		PeerAddr: net.ParseIP(clientLinkLocal),
+		Options:  opts,
+	}
+}
+
+// serializeOption returns the bytes of the DHCPv6 option code with data.
+func serializeOption(code layers.DHCPv6Opt, data []byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(code))
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// optRelayAgentInfo is the relay agent information option of RFC 3046, and
+// subOptCircuitID its circuit ID sub-option.
+const (
+	optRelayAgentInfo layers.DHCPOpt = 82
+	subOptCircuitID                  = 1
+)
+
+// subOptions returns the sub-options of the relay agent information option
+// b, keyed by code.
+func subOptions(b []byte) map[byte][]byte {
+	subs := map[byte][]byte{}
+	for len(b) >= 2 && len(b) >= 2+int(b[1]) {
+		subs[b[0]] = b[2 : 2+b[1]]
+		b = b[2+b[1]:]
+	}
+	return subs
+}
+
+// sendFlow sends the flow name of the ATE, and returns the packets captured
+// on port meanwhile.
+func sendFlow(t *testing.T, ate *ondatra.ATEDevice, name, port string) []gopacket.Packet {
+	t.Helper()
+	otgutils.StartCapture(t, ate.OTG())
+	cs := gosnappi.NewControlState()
+	cs.Traffic().FlowTransmit().SetState(gosnappi.StateTrafficFlowTransmitState.START).SetFlowNames([]string{name})
+	ate.OTG().SetControlState(t, cs)
+	time.Sleep(5 * time.Second)
+	otgutils.StopCapture(t, ate.OTG())
+	return otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, port).ID())
+}
+
+// verifyRelayedDiscover verifies the discover relayed by the DUT in pkts,
+// with the address of the client LAN as giaddr and the relay agent
+// information option with a circuit ID.
+func verifyRelayedDiscover(t *testing.T, pkts []gopacket.Packet) *relayed {
+	t.Helper()
+	for _, p := range pkts {
+		d, ok := p.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+		if !ok || d.Operation != layers.DHCPOpRequest || d.Xid != xid {
+			continue
+		}
+		if got := d.RelayAgentIP; !got.Equal(net.ParseIP(dutClient.IPv4)) {
+			t.Errorf("giaddr of the relayed discover: got %s, want %s", got, dutClient.IPv4)
+		}
+		r := &relayed{src: d.RelayAgentIP}
+		for _, o := range d.Options {
+			if o.Type == optRelayAgentInfo {
+				r.option = o.Data
+			}
+		}
+		if r.option == nil {
+			t.Fatalf("Relayed discover without relay agent information option")
+		}
+		if len(subOptions(r.option)[subOptCircuitID]) == 0 {
+			t.Errorf("Relay agent information option %x of the relayed discover: got no circuit ID", r.option)
+		}
+		return r
+	}
+	t.Fatalf("No discover relayed to the server captured")
+	return nil
+}
+
+// verifyRelayedOffer verifies the offer relayed by the DUT in pkts to the
+// client, without the relay agent information option.
+func verifyRelayedOffer(t *testing.T, pkts []gopacket.Packet) {
+	t.Helper()
+	for _, p := range pkts {
+		d, ok := p.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+		if !ok || d.Operation != layers.DHCPOpReply || d.Xid != xid {
+			continue
+		}
+		if got := d.YourClientIP; !got.Equal(net.ParseIP(offerAddress)) {
+			t.Errorf("yiaddr of the relayed offer: got %s, want %s", got, offerAddress)
+		}
+		for _, o := range d.Options {
+			if o.Type == optRelayAgentInfo {
+				t.Errorf("Relayed offer: got relay agent information option %x, want it removed", o.Data)
+			}
+		}
+		return
+	}
+	t.Errorf("No offer relayed to the client captured")
+}
+
+// verifyRelayForward verifies the relay-forward of the solicit of the client
+// relayed by the DUT in pkts, with a link address of the client LAN and the
+// interface-id option.
+func verifyRelayForward(t *testing.T, pkts []gopacket.Packet) *relayed {
+	t.Helper()
+	_, clientLAN, _ := net.ParseCIDR(dutClient.IPv6CIDR())
+	for _, p := range pkts {
+		d, ok := p.Layer(layers.LayerTypeDHCPv6).(*layers.DHCPv6)
+		if !ok || d.MsgType != layers.DHCPv6MsgTypeRelayForward {
+			continue
+		}
+		r := &relayed{src: p.NetworkLayer().(*layers.IPv6).SrcIP, linkAddr: d.LinkAddr}
+		if !clientLAN.Contains(d.LinkAddr) {
+			t.Errorf("Link address of the relay-forward: got %s, want an address of %s", d.LinkAddr, clientLAN)
+		}
+		if got := d.PeerAddr; !got.Equal(net.ParseIP(clientLinkLocal)) {
+			t.Errorf("Peer address of the relay-forward: got %s, want %s", got, clientLinkLocal)
+		}
+		var msg []byte
+		for _, o := range d.Options {
+			switch o.Code {
+			case layers.DHCPv6OptInterfaceID:
+				r.option = o.Data
+			case layers.DHCPv6OptRelayMessage:
+				msg = o.Data
+			}
+		}
+		if len(r.option) == 0 {
+			t.Errorf("Relay-forward: got no interface-id option")
+		}
+		if want := serialize(t, solicit()); !bytes.Equal(msg, want) {
+			t.Errorf("Relay message of the relay-forward: got %x, want the solicit %x", msg, want)
+		}
+		return r
+	}
+	t.Fatalf("No relay-forward to the server captured")
+	return nil
+}
+
+// verifyRelayedAdvertise verifies the advertise relayed by the DUT in pkts
+// to the client.
+func verifyRelayedAdvertise(t *testing.T, pkts []gopacket.Packet) {
+	t.Helper()
+	for _, p := range pkts {
+		d, ok := p.Layer(layers.LayerTypeDHCPv6).(*layers.DHCPv6)
+		if !ok || d.MsgType != layers.DHCPv6MsgTypeAdverstise || !bytes.Equal(d.TransactionID, transactionID) {
+			continue
+		}
+		if got := p.NetworkLayer().(*layers.IPv6).DstIP; !got.Equal(net.ParseIP(clientLinkLocal)) {
+			t.Errorf("Destination of the relayed advertise: got %s, want %s", got, clientLinkLocal)
+		}
+		return
+	}
+	t.Errorf("No advertise relayed to the client captured")
+}
+
+func TestDHCPRelay(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	configureDUT(t, dut)
+	configureRelay(t, dut)
+	dutMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port2").Name()).Ethernet().MacAddress().State())
+
+	for _, f := range []*family{ipv4, ipv6} {
+		t.Run(f.name, func(t *testing.T) {
+			ipType := "IPv4"
+			if f.ipv6 {
+				ipType = "IPv6"
+			}
+			start := func(top gosnappi.Config) {
+				ate.OTG().PushConfig(t, top)
+				ate.OTG().StartProtocols(t)
+				otgutils.WaitForARP(t, ate.OTG(), top, ipType)
+			}
+			before := relayCounters(t, dut, f)
+
+			var r *relayed
+			t.Run("Request", func(t *testing.T) {
+				start(configureATE(t, ate, f, nil, dutMAC))
+				pkts := sendFlow(t, ate, "request", "port2")
+				if f.ipv6 {
+					r = verifyRelayForward(t, pkts)
+				} else {
+					r = verifyRelayedDiscover(t, pkts)
+				}
+				verifyCounters(t, dut, f, before, f.requestCounters)
+			})
+			if r == nil {
+				t.Fatalf("%s request not relayed", f.name)
+			}
+
+			t.Run("Reply", func(t *testing.T) {
+				start(configureATE(t, ate, f, r, dutMAC))
+				pkts := sendFlow(t, ate, "reply", "port1")
+				if f.ipv6 {
+					verifyRelayedAdvertise(t, pkts)
+				} else {
+					verifyRelayedOffer(t, pkts)
+				}
+				verifyCounters(t, dut, f, before, f.replyCounters)
+			})
+		})
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dhcp_server_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/mcast"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the client LAN, on which
+// the DUT is the DHCP and DHCPv6 server of the address pools of the LAN.
+//
+// OpenConfig does not model DHCP servers, so the server is configured, and
+// its leases verified, with the CLI of the vendor. The OTG does not emulate
+// DHCP clients, so the ATE sends the messages of the client as raw flows,
+// and the replies of the DUT are captured. The request of the client
+// depends on the offer of the DUT, so its flow is added once the offer has
+// been captured.
+const (
+	clientMAC = "02:00:01:01:01:01"
+	xid       = 0x12345678
+
+	// The ranges of the address pools of the LAN.
+	poolStart  = "192.0.2.100"
+	poolEnd    = "192.0.2.199"
+	pool6Start = "2001:db8:1::100"
+	pool6End   = "2001:db8:1::1ff"
+
+	captureName = "dhcp-capture"
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "DHCP client LAN",
+		IPv4:    "192.0.2.1",
+		IPv4Len: 24,
+		IPv6:    "2001:db8:1::1",
+		IPv6Len: 64,
+	}
+
+	// clientLinkLocal is the address of the DHCPv6 client.
+	clientLinkLocal = mcast.LinkLocal(clientMAC)
+
+	// transactionID is the transaction ID of the DHCPv6 client.
+	transactionID = []byte{0x12, 0x34, 0x56}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// serverCLI is the DHCP server CLI of a vendor.
+type serverCLI struct {
+	// config is the configuration of the DHCP and DHCPv6 servers on the
+	// interface %[1]s, of the subnet %[2]s with the range from %[3]s to
+	// %[4]s and the default gateway %[5]s, and of the subnet %[6]s with the
+	// range from %[7]s to %[8]s.
+	config string
+	// leases and leases6 are the commands showing the DHCP and DHCPv6
+	// leases.
+	leases, leases6 string
+}
+
+var serverCLIs = map[ondatra.Vendor]serverCLI{
+	ondatra.ARISTA: {
+		config: `
+dhcp server
+   subnet %[2]s
+      range %[3]s %[4]s
+      default-gateway %[5]s
+   subnet %[6]s
+      range %[7]s %[8]s
+!
+interface %[1]s
+   dhcp server ipv4
+   dhcp server ipv6
+`,
+		leases:  "show dhcp server ipv4 leases",
+		leases6: "show dhcp server ipv6 leases",
+	},
+	ondatra.CISCO: {
+		config: `
+pool vrf default ipv4 CLIENTS
+ network %[2]s default-router %[5]s
+ address-range %[3]s %[4]s
+!
+pool vrf default ipv6 CLIENTS6
+ address-range %[7]s %[8]s
+!
+dhcp ipv4
+ profile CLIENTS server
+  pool CLIENTS
+ !
+ interface %[1]s server profile CLIENTS
+!
+dhcp ipv6
+ profile CLIENTS6 server
+  address-pool CLIENTS6
+ !
+ interface %[1]s server profile CLIENTS6
+!
+`,
+		leases:  "show dhcp ipv4 server binding",
+		leases6: "show dhcp ipv6 server binding",
+	},
+}
+
+// subnet returns the subnet of the CIDR address cidr.
+func subnet(cidr string) string {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+	return n.String()
+}
+
+// serverCLIFor returns the DHCP server CLI of the vendor of dut, skipping
+// the test if there is none.
+func serverCLIFor(t *testing.T, dut *ondatra.DUTDevice) serverCLI {
+	t.Helper()
+	c, ok := serverCLIs[dut.Vendor()]
+	if !ok {
+		t.Skipf("DHCP server is not supported for vendor %v", dut.Vendor())
+	}
+	return c
+}
+
+// configureDUT configures dut:port1 and the DHCP and DHCPv6 servers of the
+// client LAN.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	p1 := dut.Port(t, "port1")
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p1.Name()).Config(), dutPort1.NewOCInterface(p1.Name(), dut))
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+	}
+	clihelper.Push(t, dut, &clihelper.Config{
+		Reason: "DHCP server",
+		CLI: map[ondatra.Vendor]string{dut.Vendor(): fmt.Sprintf(serverCLIFor(t, dut).config, p1.Name(),
+			subnet(dutPort1.IPv4CIDR()), poolStart, poolEnd, dutPort1.IPv4,
+			subnet(dutPort1.IPv6CIDR()), pool6Start, pool6End)},
+	})
+}
+
+// configureATE configures the flow of the message of the client, and the
+// capture of ate:port1.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice, ipv6 bool, msg gopacket.SerializableLayer) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	p1 := ate.Port(t, "port1")
+	top.Ports().Add().SetName(p1.ID())
+
+	fl := top.Flows().Add().SetName("client")
+	fl.TxRx().Port().SetTxName(p1.ID())
+	fl.Duration().FixedPackets().SetPackets(1)
+	eth := fl.Packet().Add().Ethernet()
+	eth.Src().SetValue(clientMAC)
+	if ipv6 {
+		const allServers = "ff02::1:2"
+		eth.Dst().SetValue(mcast.MAC(allServers))
+		ip := fl.Packet().Add().Ipv6()
+		ip.Src().SetValue(clientLinkLocal)
+		ip.Dst().SetValue(allServers)
+		udp := fl.Packet().Add().Udp()
+		udp.SrcPort().SetValue(546)
+		udp.DstPort().SetValue(547)
+	} else {
+		eth.Dst().SetValue("ff:ff:ff:ff:ff:ff")
+		ip := fl.Packet().Add().Ipv4()
+		ip.Src().SetValue("0.0.0.0")
+		ip.Dst().SetValue("255.255.255.255")
+		udp := fl.Packet().Add().Udp()
+		udp.SrcPort().SetValue(68)
+		udp.DstPort().SetValue(67)
+	}
+	fl.Packet().Add().Custom().SetBytes(hex.EncodeToString(serialize(t, msg)))
+
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{p1.ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// serialize returns the bytes of the layer l.
+func serialize(t *testing.T, l gopacket.SerializableLayer) []byte {
+	t.Helper()
+	buf := gopacket.NewSerializeBuffer()
+	if err := l.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		t.Fatalf("Cannot serialize %v: %v", l.LayerType(), err)
+	}
+	return buf.Bytes()
+}
+
+// clientMessage returns the DHCP message of the client of type typ, with the
+// broadcast flag for the replies to be broadcast, and the options opts.
+func clientMessage(typ layers.DHCPMsgType, opts ...layers.DHCPOption) *layers.DHCPv4 {
+	mac, _ := net.ParseMAC(clientMAC)
+	return &layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		Xid:          xid,
+		Flags:        0x8000,
+		ClientHWAddr: mac,
+		Options:      append(layers.DHCPOptions{layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(typ)})}, opts...),
+	}
+}
+
+// clientMessage6 returns the DHCPv6 message of the client of type typ, with
+// its IA_NA of the address addr if not empty, and the options opts.
+func clientMessage6(typ layers.DHCPv6MsgType, addr string, opts ...layers.DHCPv6Option) *layers.DHCPv6 {
+	hw, _ := net.ParseMAC(clientMAC)
+	// The IA_NA of IAID 1, without T1 and T2.
+	iaNA := []byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}
+	if addr != "" {
+		iaAddr := append(net.ParseIP(addr).To16(), make([]byte, 8)...)
+		iaNA = append(iaNA, 0, byte(layers.DHCPv6OptIAAddr), 0, byte(len(iaAddr)))
+		iaNA = append(iaNA, iaAddr...)
+	}
+	return &layers.DHCPv6{
+		MsgType:       typ,
+		TransactionID: transactionID,
+		Options: append(layers.DHCPv6Options{
+			layers.NewDHCPv6Option(layers.DHCPv6OptClientID, append([]byte{0, 3, 0, 1}, hw...)),
+			layers.NewDHCPv6Option(layers.DHCPv6OptElapsedTime, []byte{0, 0}),
+			layers.NewDHCPv6Option(layers.DHCPv6OptIANA, iaNA),
+		}, opts...),
+	}
+}
+
+// send sends the message msg of the client, and returns the packets
+// captured on ate:port1 meanwhile.
+func send(t *testing.T, ate *ondatra.ATEDevice, ipv6 bool, msg gopacket.SerializableLayer) []gopacket.Packet {
+	t.Helper()
+	ate.OTG().PushConfig(t, configureATE(t, ate, ipv6, msg))
+	ate.OTG().StartProtocols(t)
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartTraffic(t)
+	time.Sleep(5 * time.Second)
+	ate.OTG().StopTraffic(t)
+	otgutils.StopCapture(t, ate.OTG())
+	return otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port1").ID())
+}
+
+// serverReply returns the DHCP reply of the DUT of type typ in pkts.
+func serverReply(t *testing.T, pkts []gopacket.Packet, typ layers.DHCPMsgType) *layers.DHCPv4 {
+	t.Helper()
+	for _, p := range pkts {
+		d, ok := p.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+		if !ok || d.Operation != layers.DHCPOpReply || d.Xid != xid {
+			continue
+		}
+		for _, o := range d.Options {
+			if o.Type == layers.DHCPOptMessageType && len(o.Data) == 1 && layers.DHCPMsgType(o.Data[0]) == typ {
+				return d
+			}
+		}
+	}
+	t.Fatalf("No DHCP %v of the DUT captured", typ)
+	return nil
+}
+
+// serverReply6 returns the DHCPv6 reply of the DUT of type typ in pkts.
+func serverReply6(t *testing.T, pkts []gopacket.Packet, typ layers.DHCPv6MsgType) *layers.DHCPv6 {
+	t.Helper()
+	for _, p := range pkts {
+		d, ok := p.Layer(layers.LayerTypeDHCPv6).(*layers.DHCPv6)
+		if ok && d.MsgType == typ && bytes.Equal(d.TransactionID, transactionID) {
+			return d
+		}
+	}
+	t.Fatalf("No DHCPv6 %v of the DUT captured", typ)
+	return nil
+}
+
+// option returns the data of the option typ of d, or nil.
+func option(d *layers.DHCPv4, typ layers.DHCPOpt) []byte {
+	for _, o := range d.Options {
+		if o.Type == typ {
+			return o.Data
+		}
+	}
+	return nil
+}
+
+// option6 returns the data of the option code of d, or nil.
+func option6(d *layers.DHCPv6, code layers.DHCPv6Opt) []byte {
+	for _, o := range d.Options {
+		if o.Code == code {
+			return o.Data
+		}
+	}
+	return nil
+}
+
+// iaAddress returns the address of the IA address option of the IA_NA
+// option b, or nil.
+func iaAddress(b []byte) net.IP {
+	// The IA_NA options follow its IAID, T1 and T2.
+	for b = b[min(len(b), 12):]; len(b) >= 4; {
+		code := layers.DHCPv6Opt(uint16(b[0])<<8 | uint16(b[1]))
+		n := int(uint16(b[2])<<8 | uint16(b[3]))
+		if len(b) < 4+n {
+			return nil
+		}
+		if code == layers.DHCPv6OptIAAddr && n >= 16 {
+			return net.IP(b[4:20])
+		}
+		b = b[4+n:]
+	}
+	return nil
+}
+
+// inRange returns whether ip is in the range from start to end.
+func inRange(ip net.IP, start, end string) bool {
+	ip = ip.To16()
+	return ip != nil && bytes.Compare(ip, net.ParseIP(start).To16()) >= 0 && bytes.Compare(ip, net.ParseIP(end).To16()) <= 0
+}
+
+// awaitLease waits for the lease of addr to be shown by the command cmd of
+// the DUT.
+func awaitLease(t *testing.T, dut *ondatra.DUTDevice, cmd string, addr net.IP) {
+	t.Helper()
+	var out string
+	for start := time.Now(); time.Since(start) < time.Minute; time.Sleep(5 * time.Second) {
+		out = dut.CLI().Run(t, cmd)
+		if strings.Contains(out, addr.String()) {
+			return
+		}
+	}
+	t.Errorf("Lease of %s not found in the output of %q:\n%s", addr, cmd, out)
+}
+
+func TestDHCPServer(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	configureDUT(t, dut)
+	cli := serverCLIFor(t, dut)
+
+	t.Run("IPv4", func(t *testing.T) {
+		offer := serverReply(t, send(t, ate, false, clientMessage(layers.DHCPMsgTypeDiscover)), layers.DHCPMsgTypeOffer)
+		addr := offer.YourClientIP
+		if !inRange(addr, poolStart, poolEnd) {
+			t.Errorf("Offered address: got %s, want an address from %s to %s", addr, poolStart, poolEnd)
+		}
+		serverID := option(offer, layers.DHCPOptServerID)
+		if !net.IP(serverID).Equal(net.ParseIP(dutPort1.IPv4)) {
+			t.Errorf("Server identifier of the offer: got %v, want %s", net.IP(serverID), dutPort1.IPv4)
+		}
+		if option(offer, layers.DHCPOptLeaseTime) == nil {
+			t.Errorf("Offer without lease time")
+		}
+		if got := option(offer, layers.DHCPOptRouter); !net.IP(got).Equal(net.ParseIP(dutPort1.IPv4)) {
+			t.Errorf("Router of the offer: got %v, want %s", net.IP(got), dutPort1.IPv4)
+		}
+
+		request := clientMessage(layers.DHCPMsgTypeRequest,
+			layers.NewDHCPOption(layers.DHCPOptRequestIP, addr.To4()),
+			layers.NewDHCPOption(layers.DHCPOptServerID, serverID))
+		ack := serverReply(t, send(t, ate, false, request), layers.DHCPMsgTypeAck)
+		if !ack.YourClientIP.Equal(addr) {
+			t.Errorf("Acknowledged address: got %s, want %s", ack.YourClientIP, addr)
+		}
+		awaitLease(t, dut, cli.leases, addr)
+	})
+
+	t.Run("IPv6", func(t *testing.T) {
+		adv := serverReply6(t, send(t, ate, true, clientMessage6(layers.DHCPv6MsgTypeSolicit, "")), layers.DHCPv6MsgTypeAdverstise)
+		addr := iaAddress(option6(adv, layers.DHCPv6OptIANA))
+		if !inRange(addr, pool6Start, pool6End) {
+			t.Errorf("Advertised address: got %s, want an address from %s to %s", addr, pool6Start, pool6End)
+		}
+		serverID := option6(adv, layers.DHCPv6OptServerID)
+		if serverID == nil {
+			t.Fatalf("Advertise without server identifier")
+		}
+
+		request := clientMessage6(layers.DHCPv6MsgTypeRequest, addr.String(), layers.NewDHCPv6Option(layers.DHCPv6OptServerID, serverID))
+		reply := serverReply6(t, send(t, ate, true, request), layers.DHCPv6MsgTypeReply)
+		if got := iaAddress(option6(reply, layers.DHCPv6OptIANA)); !got.Equal(addr) {
+			t.Errorf("Replied address: got %s, want %s", got, addr)
+		}
+		awaitLease(t, dut, cli.leases6, addr)
+	})
+}
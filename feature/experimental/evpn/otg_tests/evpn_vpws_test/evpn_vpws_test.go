@@ -0,0 +1,615 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evpn_vpws_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the attachment circuit of
+// the VPWS in VLAN vlanID, and dut:port2 -> ate:port2, the MPLS core to the
+// remote PE emulated by ate:port2.
+//
+// The DUT runs iBGP with the L2VPN EVPN address family with the remote PE.
+// OpenConfig does not model the service identifiers of EVPN VPWS, so the
+// VPWS of the DUT is configured with the CLI of the vendor. The OTG does not
+// originate Ethernet A-D routes with MPLS labels, so the route of the remote
+// PE is replayed as a raw UPDATE message, and the label allocated by the DUT
+// is learned from its UPDATE messages captured on ate:port2.
+const (
+	plen = 30
+
+	asn     = 65000
+	bgpName = "BGP"
+	evi     = 100
+	vlanID  = 100
+
+	// localID and remoteID are the VPWS service identifiers of the DUT and
+	// of the remote PE, advertised as the Ethernet tag of their Ethernet A-D
+	// per EVI routes.
+	localID     = 1
+	remoteID    = 2
+	remoteLabel = 100002
+
+	pwName = "PW-1"
+
+	// acMAC is the MAC address of the host behind the attachment circuit,
+	// and remoteMAC of the host behind the remote PE.
+	acMAC     = "02:00:01:0a:0a:01"
+	acIP      = "198.51.100.1"
+	remoteMAC = "02:00:02:0a:0a:02"
+	remoteIP  = "198.51.100.2"
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	captureName = "vpws"
+	// advertisementWait is the time allowed for the DUT to advertise its
+	// Ethernet A-D route.
+	advertisementWait = 30 * time.Second
+)
+
+var (
+	dutLoopback = attrs.Attributes{
+		Desc:    "Router ID",
+		IPv4:    "203.0.113.1",
+		IPv4Len: 32,
+	}
+	dut2 = attrs.Attributes{
+		Desc:    "MPLS core",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ate2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+
+	// localRD and remoteRD are the route distinguishers of the EVI on the
+	// DUT and on the remote PE.
+	localRD  = fmt.Sprintf("%s:%d", dutLoopback.IPv4, evi)
+	remoteRD = fmt.Sprintf("%s:%d", ate2.IPv4, evi)
+	rt       = fmt.Sprintf("%d:%d", asn, evi)
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the core interface with MPLS, iBGP with the
+// remote PE and the VPWS with the CLI of the vendor.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	lb := netutil.LoopbackInterface(t, dut, 0)
+	lo := dutLoopback.NewOCInterface(lb, dut)
+	lo.Type = oc.IETFInterfaces_InterfaceType_softwareLoopback
+	gnmi.Replace(t, dut, gnmi.OC().Interface(lb).Config(), lo)
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, lb, dni, 0)
+	}
+
+	p1, p2 := dut.Port(t, "port1"), dut.Port(t, "port2")
+	ac := &oc.Interface{Name: ygot.String(p1.Name())}
+	ac.SetType(oc.IETFInterfaces_InterfaceType_ethernetCsmacd)
+	ac.SetDescription("Attachment circuit")
+	if deviations.InterfaceEnabled(dut) {
+		ac.SetEnabled(true)
+	}
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p1.Name()).Config(), ac)
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p2.Name()).Config(), dut2.NewOCInterface(p2.Name(), dut))
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p2.Name(), dni, 0)
+	}
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+
+	ni := &oc.NetworkInstance{Name: ygot.String(dni)}
+	mpls := ni.GetOrCreateMpls().GetOrCreateGlobal().GetOrCreateInterface(p2.Name())
+	mpls.SetMplsEnabled(true)
+	mpls.GetOrCreateInterfaceRef().SetInterface(p2.Name())
+	bgp := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).GetOrCreateBgp()
+	bgp.GetOrCreateGlobal().SetAs(asn)
+	bgp.GetOrCreateGlobal().SetRouterId(dutLoopback.IPv4)
+	bgp.GetOrCreateGlobal().GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_L2VPN_EVPN).SetEnabled(true)
+	nbr := bgp.GetOrCreateNeighbor(ate2.IPv4)
+	nbr.SetPeerAs(asn)
+	nbr.SetEnabled(true)
+	nbr.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_L2VPN_EVPN).SetEnabled(true)
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(dni).Config(), ni)
+
+	if _, err := dut.RawAPIs().GNMI(t).Set(context.Background(), cliSetRequest(vpwsConfig(t, dut, p1.Name()))); err != nil {
+		t.Fatalf("Failed to configure the VPWS: %v", err)
+	}
+}
+
+// vpwsConfig returns the CLI configuration of the VPWS between VLAN vlanID
+// of the attachment circuit ac and the remote PE.
+func vpwsConfig(t *testing.T, dut *ondatra.DUTDevice, ac string) string {
+	t.Helper()
+	switch dut.Vendor() {
+	case ondatra.ARISTA:
+		return fmt.Sprintf(`
+router bgp %[1]d
+   vpws %[2]d
+      rd %[3]s
+      route-target import export evpn %[4]s
+      pseudowire %[5]s
+         evpn vpws id local %[6]d remote %[7]d
+!
+patch panel
+   patch %[5]s
+      connector 1 interface %[8]s dot1q vlan %[9]d
+      connector 2 pseudowire bgp vpws %[2]d pseudowire %[5]s
+!
+`, asn, evi, localRD, rt, pwName, localID, remoteID, ac, vlanID)
+	case ondatra.CISCO:
+		return fmt.Sprintf(`
+interface %[8]s.%[9]d l2transport
+ encapsulation dot1q %[9]d
+!
+evpn
+ evi %[2]d
+  bgp
+   rd %[3]s
+   route-target import %[4]s
+   route-target export %[4]s
+  !
+ !
+!
+l2vpn
+ xconnect group VPWS
+  p2p %[5]s
+   interface %[8]s.%[9]d
+   neighbor evpn evi %[2]d target %[7]d source %[6]d
+  !
+ !
+!
+`, asn, evi, localRD, rt, pwName, localID, remoteID, ac, vlanID)
+	default:
+		t.Skipf("EVPN VPWS configuration is not supported for vendor %v", dut.Vendor())
+	}
+	return ""
+}
+
+func cliSetRequest(config string) *gpb.SetRequest {
+	return &gpb.SetRequest{
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{
+				Origin: "cli",
+			},
+			Val: &gpb.TypedValue{
+				Value: &gpb.TypedValue_AsciiVal{
+					AsciiVal: config,
+				},
+			},
+		}},
+	}
+}
+
+// configureATE configures the remote PE replaying its Ethernet A-D per EVI
+// route, and the capture on both ports.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	ports := []string{ate.Port(t, "port1").ID(), ate.Port(t, "port2").ID()}
+	top.Ports().Add().SetName(ports[0])
+	dev := ate2.AddToOTG(top, ate.Port(t, "port2"), &dut2)
+	v4 := dev.Ethernets().Items()[0].Ipv4Addresses().Items()[0]
+	peer := dev.Bgp().SetRouterId(ate2.IPv4).Ipv4Interfaces().Add().SetIpv4Name(v4.Name()).Peers().Add().SetName(ate2.Name + ".BGP4.peer")
+	peer.SetPeerAddress(dut2.IPv4).SetAsNumber(asn).SetAsType(gosnappi.BgpV4PeerAsType.IBGP)
+	peer.Capability().SetEvpn(true)
+	peer.ReplayUpdates().RawBytes().Updates().Add().SetTimeGap(1000).SetUpdateBytes(adUpdate())
+	top.Captures().Add().SetName(captureName).SetPortNames(ports).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// BGP message and path attribute codes of RFC 4271, RFC 4360, RFC 4760,
+// RFC 7432 and RFC 8214.
+const (
+	bgpHeader    = 19
+	bgpUpdate    = 2
+	attrOrigin   = 1
+	attrASPath   = 2
+	attrLocPref  = 5
+	attrMPReach  = 14
+	attrExtComm  = 16
+	flagOptional = 0x80
+	flagTransit  = 0x40
+	flagExtended = 0x10
+	afiL2VPN     = 25
+	safiEVPN     = 70
+	routeTypeAD  = 1
+	// adLength is the length of an Ethernet A-D route: the route
+	// distinguisher, the ESI, the Ethernet tag and the label.
+	adLength = 8 + 10 + 4 + 3
+)
+
+// pathAttr returns the path attribute typ with the value v.
+func pathAttr(flags, typ byte, v []byte) []byte {
+	if len(v) > 255 {
+		b := []byte{flags | flagExtended, typ, 0, 0}
+		binary.BigEndian.PutUint16(b[2:], uint16(len(v)))
+		return append(b, v...)
+	}
+	return append([]byte{flags, typ, byte(len(v))}, v...)
+}
+
+// adUpdate returns the body, after the header, of the UPDATE message with
+// the Ethernet A-D per EVI route of the remote PE, as a hex string.
+func adUpdate() string {
+	nh := net.ParseIP(ate2.IPv4).To4()
+	mpReach := binary.BigEndian.AppendUint16(nil, afiL2VPN)
+	mpReach = append(mpReach, safiEVPN, byte(len(nh)))
+	mpReach = append(mpReach, nh...)
+	mpReach = append(mpReach, 0, routeTypeAD, adLength)
+	// The type 1 route distinguisher of the remote PE, the zero ESI of a
+	// single-homed attachment circuit, the service identifier and the label
+	// with the bottom of stack bit.
+	mpReach = binary.BigEndian.AppendUint16(mpReach, 1)
+	mpReach = append(mpReach, nh...)
+	mpReach = binary.BigEndian.AppendUint16(mpReach, evi)
+	mpReach = append(mpReach, make([]byte, 10)...)
+	mpReach = binary.BigEndian.AppendUint32(mpReach, remoteID)
+	label := uint32(remoteLabel)
+	mpReach = append(mpReach, byte(label>>12), byte(label>>4), byte(label<<4)|1)
+
+	// The route target is a two-octet AS specific extended community, and
+	// the EVPN Layer 2 attributes extended community has no flag set and
+	// no MTU.
+	extComm := []byte{0x00, 0x02}
+	extComm = binary.BigEndian.AppendUint16(extComm, asn)
+	extComm = binary.BigEndian.AppendUint32(extComm, evi)
+	extComm = append(extComm, 0x06, 0x04, 0, 0, 0, 0, 0, 0)
+
+	var attrs []byte
+	attrs = append(attrs, pathAttr(flagTransit, attrOrigin, []byte{0})...)
+	attrs = append(attrs, pathAttr(flagTransit, attrASPath, nil)...)
+	attrs = append(attrs, pathAttr(flagTransit, attrLocPref, binary.BigEndian.AppendUint32(nil, 100))...)
+	attrs = append(attrs, pathAttr(flagOptional|flagTransit, attrExtComm, extComm)...)
+	attrs = append(attrs, pathAttr(flagOptional|flagExtended, attrMPReach, mpReach)...)
+
+	b := binary.BigEndian.AppendUint16(nil, 0)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(attrs)))
+	return hex.EncodeToString(append(b, attrs...))
+}
+
+// awaitBGP waits for the BGP session of the DUT with the remote PE to be
+// established.
+func awaitBGP(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).Bgp().Neighbor(ate2.IPv4).SessionState().State()
+	_, ok := gnmi.Watch(t, dut, q, 2*time.Minute, func(v *ygnmi.Value[oc.E_Bgp_Neighbor_SessionState]) bool {
+		state, present := v.Val()
+		return present && state == oc.Bgp_Neighbor_SessionState_ESTABLISHED
+	}).Await(t)
+	if !ok {
+		t.Fatalf("BGP session with %s is not established", ate2.IPv4)
+	}
+}
+
+// awaitADRoute waits for the Ethernet A-D route with the route
+// distinguisher rd and the Ethernet tag id to be in the L2VPN EVPN RIB of the
+// DUT.
+func awaitADRoute(t *testing.T, dut *ondatra.DUTDevice, rd string, id uint32) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).Bgp().
+		Rib().AfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_L2VPN_EVPN).L2VpnEvpn().LocRib().State()
+	var got []uint32
+	for deadline := time.Now().Add(2 * time.Minute); time.Now().Before(deadline); time.Sleep(5 * time.Second) {
+		got = nil
+		rib, ok := gnmi.Lookup(t, dut, q).Val()
+		if !ok {
+			continue
+		}
+		for k := range rib.GetRouteDistinguisher(rd).TypeOneRoute {
+			got = append(got, k.EthernetTag)
+			if k.EthernetTag == id {
+				t.Logf("Got Ethernet A-D route with route distinguisher %s and Ethernet tag %d", rd, id)
+				return
+			}
+		}
+	}
+	t.Errorf("Ethernet A-D routes with route distinguisher %s: got Ethernet tags %v, want %d", rd, got, id)
+}
+
+// parseADLabel returns the label of the Ethernet A-D route with the Ethernet
+// tag localID advertised by the DUT in pkts.
+func parseADLabel(pkts []gopacket.Packet) (uint32, error) {
+	// segments are the TCP payloads sent by the DUT, by sequence number.
+	segments := map[uint32][]byte{}
+	for _, p := range pkts {
+		ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok || !ip.SrcIP.Equal(net.ParseIP(dut2.IPv4)) {
+			continue
+		}
+		tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		if !ok || (tcp.SrcPort != 179 && tcp.DstPort != 179) || len(tcp.Payload) == 0 {
+			continue
+		}
+		segments[tcp.Seq] = tcp.Payload
+	}
+	var seqs []uint32
+	for seq := range segments {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	var stream []byte
+	for _, seq := range seqs {
+		stream = append(stream, segments[seq]...)
+	}
+
+	for len(stream) >= bgpHeader {
+		n := int(binary.BigEndian.Uint16(stream[16:18]))
+		if n < bgpHeader || len(stream) < n {
+			break
+		}
+		if stream[18] == bgpUpdate {
+			label, ok, err := parseUpdate(stream[bgpHeader:n])
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				return label, nil
+			}
+		}
+		stream = stream[n:]
+	}
+	return 0, fmt.Errorf("no Ethernet A-D route with Ethernet tag %d", localID)
+}
+
+// parseUpdate returns the label of the Ethernet A-D route with the Ethernet
+// tag localID in the UPDATE message b, if any.
+func parseUpdate(b []byte) (uint32, bool, error) {
+	if len(b) < 2 {
+		return 0, false, fmt.Errorf("truncated UPDATE")
+	}
+	b = b[2+int(binary.BigEndian.Uint16(b)):]
+	if len(b) < 2 {
+		return 0, false, fmt.Errorf("truncated UPDATE")
+	}
+	attrs := b[2 : 2+int(binary.BigEndian.Uint16(b))]
+	for len(attrs) >= 3 {
+		flags, typ := attrs[0], attrs[1]
+		hdr, n := 3, int(attrs[2])
+		if flags&flagExtended != 0 {
+			hdr, n = 4, int(binary.BigEndian.Uint16(attrs[2:4]))
+		}
+		if len(attrs) < hdr+n {
+			return 0, false, fmt.Errorf("truncated attribute %d", typ)
+		}
+		v := attrs[hdr : hdr+n]
+		attrs = attrs[hdr+n:]
+		if typ != attrMPReach || len(v) < 4 || binary.BigEndian.Uint16(v) != afiL2VPN || v[2] != safiEVPN || len(v) < 5+int(v[3]) {
+			continue
+		}
+		// Each NLRI is its route type, its length and the route.
+		for nlri := v[5+int(v[3]):]; len(nlri) >= 2; {
+			typ, n := nlri[0], int(nlri[1])
+			if len(nlri) < 2+n {
+				return 0, false, fmt.Errorf("truncated EVPN NLRI")
+			}
+			route := nlri[2 : 2+n]
+			nlri = nlri[2+n:]
+			if typ != routeTypeAD || n != adLength || binary.BigEndian.Uint32(route[18:22]) != localID {
+				continue
+			}
+			return uint32(route[22])<<12 | uint32(route[23])<<4 | uint32(route[24])>>4, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// flow is a flow of frames of VLAN vlanID between the host behind the
+// attachment circuit and the host behind the remote PE.
+type flow struct {
+	name     string
+	tx, rx   string
+	src, dst string
+	srcIP    string
+	dstIP    string
+	// label is the label of the frames sent by the remote PE.
+	label uint32
+}
+
+// addFlow replaces the flows of top with f. dstMAC is the MAC address of
+// dut:port2, used by the frames sent by the remote PE.
+func addFlow(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config, f flow, dstMAC string) {
+	t.Helper()
+	top.Flows().Clear()
+	fl := top.Flows().Add().SetName(f.name)
+	fl.Metrics().SetEnable(true)
+	fl.TxRx().Port().SetTxName(ate.Port(t, f.tx).ID()).SetRxNames([]string{ate.Port(t, f.rx).ID()})
+	if f.label != 0 {
+		eth := fl.Packet().Add().Ethernet()
+		eth.Src().SetValue(ate2.MAC)
+		eth.Dst().SetValue(dstMAC)
+		fl.Packet().Add().Mpls().Label().SetValue(f.label)
+	}
+	eth := fl.Packet().Add().Ethernet()
+	eth.Src().SetValue(f.src)
+	eth.Dst().SetValue(f.dst)
+	fl.Packet().Add().Vlan().Id().SetValue(vlanID)
+	ip := fl.Packet().Add().Ipv4()
+	ip.Src().SetValue(f.srcIP)
+	ip.Dst().SetValue(f.dstIP)
+	fl.Packet().Add().Udp()
+	fl.Size().SetFixed(frameSize)
+	fl.Rate().SetPps(ppsRate)
+	fl.Duration().FixedPackets().SetPackets(packets)
+}
+
+// frame is a frame of the VLAN received by the ATE, with the labels of the
+// MPLS packet carrying it, if any.
+type frame struct {
+	labels   []uint32
+	src, dst string
+	vlan     uint16
+	tagged   bool
+}
+
+// decode returns the frame of the VLAN sent by src in p, if any. The payload
+// of an MPLS packet is decoded as an Ethernet frame without control word.
+func decode(p gopacket.Packet, src string) (frame, bool) {
+	var f frame
+	for _, l := range p.Layers() {
+		if mpls, ok := l.(*layers.MPLS); ok {
+			f.labels = append(f.labels, mpls.Label)
+			if mpls.StackBottom {
+				p = gopacket.NewPacket(mpls.Payload, layers.LayerTypeEthernet, gopacket.Default)
+				break
+			}
+		}
+	}
+	eth, ok := p.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	if !ok {
+		return f, false
+	}
+	f.src, f.dst = eth.SrcMAC.String(), eth.DstMAC.String()
+	if dot1q, ok := p.Layer(layers.LayerTypeDot1Q).(*layers.Dot1Q); ok {
+		f.vlan, f.tagged = dot1q.VLANIdentifier, true
+	}
+	return f, f.src == src
+}
+
+// verifyFlow sends f and verifies that it is received without loss on f.rx
+// as frames of VLAN vlanID, with the labels want.
+func verifyFlow(t *testing.T, dut *ondatra.DUTDevice, ate *ondatra.ATEDevice, top gosnappi.Config, f flow, want []uint32) {
+	t.Helper()
+	dstMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port2").Name()).Ethernet().MacAddress().State())
+	addFlow(t, ate, top, f, dstMAC)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	awaitBGP(t, dut)
+
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+	otgutils.StopCapture(t, ate.OTG())
+	time.Sleep(10 * time.Second)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+	counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.name).Counters().State())
+	if sent := counters.GetOutPkts(); sent == 0 || counters.GetInPkts() != sent {
+		t.Errorf("Flow %s: got %d packets received on %s of %d sent, want no loss", f.name, counters.GetInPkts(), f.rx, sent)
+	}
+
+	var good, bad int
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, f.rx).ID()) {
+		fr, ok := decode(p, f.src)
+		if !ok {
+			continue
+		}
+		if fmt.Sprint(fr.labels) != fmt.Sprint(want) || fr.dst != f.dst || !fr.tagged || fr.vlan != vlanID {
+			if bad == 0 {
+				t.Errorf("Flow %s: got frame %+v on %s, want frame to %s in VLAN %d with labels %v", f.name, fr, f.rx, f.dst, vlanID, want)
+			}
+			bad++
+			continue
+		}
+		good++
+	}
+	t.Logf("Flow %s: captured %d frames transported as expected and %d not", f.name, good, bad)
+	if good == 0 {
+		t.Errorf("Flow %s: got no frames transported as expected", f.name)
+	}
+	if bad != 0 {
+		t.Errorf("Flow %s: got %d frames not transported as expected", f.name, bad)
+	}
+}
+
+func TestEVPNVPWS(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+
+	ate := ondatra.ATE(t, "ate")
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	awaitBGP(t, dut)
+	time.Sleep(advertisementWait)
+	otgutils.StopCapture(t, ate.OTG())
+
+	var localLabel uint32
+	t.Run("ADRoutes", func(t *testing.T) {
+		awaitADRoute(t, dut, remoteRD, remoteID)
+		awaitADRoute(t, dut, localRD, localID)
+		var err error
+		if localLabel, err = parseADLabel(otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port2").ID())); err != nil {
+			t.Fatalf("Cannot find the Ethernet A-D route of the DUT: %v", err)
+		}
+		t.Logf("DUT advertised the label %d for the VPWS %d", localLabel, localID)
+	})
+	if localLabel == 0 {
+		t.Fatalf("Label of the VPWS of the DUT is not known")
+	}
+
+	t.Run("ToRemotePE", func(t *testing.T) {
+		verifyFlow(t, dut, ate, top, flow{
+			name:  "to-remote-pe",
+			tx:    "port1",
+			rx:    "port2",
+			src:   acMAC,
+			dst:   remoteMAC,
+			srcIP: acIP,
+			dstIP: remoteIP,
+		}, []uint32{remoteLabel})
+	})
+
+	t.Run("FromRemotePE", func(t *testing.T) {
+		verifyFlow(t, dut, ate, top, flow{
+			name:  "from-remote-pe",
+			tx:    "port2",
+			rx:    "port1",
+			src:   remoteMAC,
+			dst:   acMAC,
+			srcIP: remoteIP,
+			dstIP: acIP,
+			label: localLabel,
+		}, nil)
+	})
+}
@@ -0,0 +1,584 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evpn_vxlan_l2_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, an access port of the
+// MAC-VRF macVrfName in VLAN vlanID, and dut:port2 -> ate:port2 and
+// dut:port3 -> ate:port3, the IPv4 underlay to the remote VTEPs emulated by
+// ate:port2 and ate:port3.
+//
+// The DUT is a VTEP sourced from its loopback, mapping vlanID to vni, and runs
+// eBGP with the L2VPN EVPN address family with ate:port2 and ate:port3. Each
+// ATE VTEP advertises the MAC/IP route (type 2) of the host behind it and its
+// inclusive multicast route (type 3) for ingress replication.
+const (
+	plen = 30
+
+	dutAS  = 65001
+	ate2AS = 65002
+	ate3AS = 65003
+
+	bgpName      = "BGP"
+	peerGroup    = "EVPN"
+	policyName   = "PERMIT-ALL"
+	macVrfName   = "MAC-VRF-10"
+	vtepEndpoint = "VTEP"
+	evi          = "10"
+	vlanID       = 10
+	vni          = 10010
+	routeTarget  = "100:10010"
+	vxlanPort    = 4789
+
+	// The hosts of the VLAN behind ate:port1, ate:port2 and ate:port3. The
+	// unknown MAC address is not advertised by any VTEP.
+	host1MAC   = "02:00:01:0a:0a:01"
+	host1IP    = "198.51.100.1"
+	host2MAC   = "02:00:02:0a:0a:02"
+	host2IP    = "198.51.100.2"
+	host3MAC   = "02:00:03:0a:0a:03"
+	host3IP    = "198.51.100.3"
+	unknownMAC = "02:00:0f:0a:0a:0f"
+	broadcast  = "ff:ff:ff:ff:ff:ff"
+
+	captureName = "evpn"
+	ppsRate     = 100
+	packets     = 1000
+	frameSize   = 256
+)
+
+var (
+	dutLoopback = attrs.Attributes{
+		Desc:    "VTEP source",
+		IPv4:    "203.0.113.1",
+		IPv4Len: 32,
+	}
+	dut1 = attrs.Attributes{
+		Desc: "Access port",
+	}
+	dut2 = attrs.Attributes{
+		Desc:    "Underlay to VTEP 2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ate2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	dut3 = attrs.Attributes{
+		Desc:    "Underlay to VTEP 3",
+		IPv4:    "192.0.2.9",
+		IPv4Len: plen,
+	}
+	ate3 = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// routeDistinguisher returns the route distinguisher of the EVI advertised
+// by the VTEP ip.
+func routeDistinguisher(ip string) string {
+	return ip + ":" + evi
+}
+
+// configureDUT configures the underlay interfaces, the VTEP, the MAC-VRF
+// with its access port, and BGP with the ATE VTEPs.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	lb := netutil.LoopbackInterface(t, dut, 0)
+	lo := dutLoopback.NewOCInterface(lb, dut)
+	lo.Type = oc.IETFInterfaces_InterfaceType_softwareLoopback
+	gnmi.Replace(t, dut, gnmi.OC().Interface(lb).Config(), lo)
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, lb, dni, 0)
+	}
+
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port2", dut2},
+		{"port3", dut3},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), dni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	p1 := dut.Port(t, "port1")
+	access := dut1.NewOCInterface(p1.Name(), dut)
+	sv := access.GetOrCreateEthernet().GetOrCreateSwitchedVlan()
+	sv.SetInterfaceMode(oc.Vlan_VlanModeType_ACCESS)
+	sv.SetAccessVlan(vlanID)
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p1.Name()).Config(), access)
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+	}
+
+	rp := &oc.RoutingPolicy{}
+	stmt, err := rp.GetOrCreatePolicyDefinition(policyName).AppendNewStatement("10")
+	if err != nil {
+		t.Fatalf("Cannot create the statement of %s: %v", policyName, err)
+	}
+	stmt.GetOrCreateActions().SetPolicyResult(oc.RoutingPolicy_PolicyResultType_ACCEPT_ROUTE)
+	gnmi.Update(t, dut, gnmi.OC().RoutingPolicy().Config(), rp)
+
+	ni := &oc.NetworkInstance{Name: ygot.String(dni)}
+	vxlan := ni.GetOrCreateConnectionPoint(vtepEndpoint).GetOrCreateEndpoint(vtepEndpoint).GetOrCreateVxlan()
+	vxlan.SetSourceInterface(lb)
+	vxlan.SetEnabled(true)
+	addBGP(dut, ni)
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(dni).Config(), ni)
+
+	gnmi.Replace(t, dut, gnmi.OC().NetworkInstance(macVrfName).Config(), macVrf(dut, p1.Name()))
+}
+
+// macVrf returns the MAC-VRF mapping vlanID to vni with the access port
+// name, advertising its MAC addresses and flooding BUM traffic to the VTEPs
+// discovered with BGP.
+func macVrf(dut *ondatra.DUTDevice, name string) *oc.NetworkInstance {
+	ni := &oc.NetworkInstance{Name: ygot.String(macVrfName)}
+	ni.SetType(oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_L2VSI)
+	ni.GetOrCreateVlan(vlanID).SetName(fmt.Sprintf("VLAN%d", vlanID))
+	intf := ni.GetOrCreateInterface(name)
+	intf.SetInterface(name)
+	intf.SetSubinterface(0)
+
+	inst := ni.GetOrCreateEvpn().GetOrCreateEvpnInstance(evi)
+	inst.SetEncapsulationType(oc.NetworkInstanceTypes_ENCAPSULATION_VXLAN)
+	inst.SetServiceType(oc.EvpnTypes_EVPN_TYPE_VLAN_BASED)
+	inst.SetReplicationMode(oc.EvpnInstance_ReplicationMode_BGP)
+	inst.SetRouteDistinguisher(oc.UnionString(routeDistinguisher(dutLoopback.IPv4)))
+	policy := inst.GetOrCreateImportExportPolicy()
+	policy.SetImportRouteTarget([]oc.NetworkInstance_Evpn_EvpnInstance_ImportExportPolicy_ImportRouteTarget_Union{oc.UnionString(routeTarget)})
+	policy.SetExportRouteTarget([]oc.NetworkInstance_Evpn_EvpnInstance_ImportExportPolicy_ExportRouteTarget_Union{oc.UnionString(routeTarget)})
+	vxlan := inst.GetOrCreateVxlan()
+	vxlan.SetVni(vni)
+	vxlan.SetOverlayEndpoint(vtepEndpoint)
+	vxlan.SetOverlayEndpointNetworkInstance(deviations.DefaultNetworkInstance(dut))
+	vxlan.SetHostReachabilityBgp(true)
+	return ni
+}
+
+// addBGP adds to ni BGP with the L2VPN EVPN address family with ate2 and
+// ate3.
+func addBGP(dut *ondatra.DUTDevice, ni *oc.NetworkInstance) {
+	bgp := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).GetOrCreateBgp()
+	glob := bgp.GetOrCreateGlobal()
+	glob.SetAs(dutAS)
+	glob.SetRouterId(dutLoopback.IPv4)
+	glob.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_L2VPN_EVPN).SetEnabled(true)
+
+	pg := bgp.GetOrCreatePeerGroup(peerGroup)
+	pg.SetPeerGroupName(peerGroup)
+	if deviations.RoutePolicyUnderAFIUnsupported(dut) {
+		pg.GetOrCreateApplyPolicy().SetImportPolicy([]string{policyName})
+		pg.GetOrCreateApplyPolicy().SetExportPolicy([]string{policyName})
+	} else {
+		af := pg.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_L2VPN_EVPN)
+		af.SetEnabled(true)
+		af.GetOrCreateApplyPolicy().SetImportPolicy([]string{policyName})
+		af.GetOrCreateApplyPolicy().SetExportPolicy([]string{policyName})
+	}
+	for _, n := range []struct {
+		addr string
+		as   uint32
+	}{
+		{ate2.IPv4, ate2AS},
+		{ate3.IPv4, ate3AS},
+	} {
+		nbr := bgp.GetOrCreateNeighbor(n.addr)
+		nbr.SetPeerAs(n.as)
+		nbr.SetPeerGroup(peerGroup)
+		nbr.SetEnabled(true)
+		nbr.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_L2VPN_EVPN).SetEnabled(true)
+	}
+}
+
+// configureATE configures the VTEPs of ate2 and ate3, each advertising the
+// MAC/IP route of its host and its inclusive multicast route, and the
+// capture on all the ports.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	ports := []string{ate.Port(t, "port1").ID()}
+	top.Ports().Add().SetName(ports[0])
+	for _, a := range []struct {
+		port            string
+		ate             attrs.Attributes
+		dut             attrs.Attributes
+		as              uint32
+		hostMAC, hostIP string
+	}{
+		{"port2", ate2, dut2, ate2AS, host2MAC, host2IP},
+		{"port3", ate3, dut3, ate3AS, host3MAC, host3IP},
+	} {
+		ports = append(ports, ate.Port(t, a.port).ID())
+		dev := a.ate.AddToOTG(top, ate.Port(t, a.port), &a.dut)
+		v4 := dev.Ethernets().Items()[0].Ipv4Addresses().Items()[0]
+		peer := dev.Bgp().SetRouterId(a.ate.IPv4).Ipv4Interfaces().Add().SetIpv4Name(v4.Name()).
+			Peers().Add().SetName(a.ate.Name + ".BGP4.peer")
+		peer.SetPeerAddress(a.dut.IPv4).SetAsNumber(a.as).SetAsType(gosnappi.BgpV4PeerAsType.EBGP)
+		peer.Capability().SetEvpn(true)
+
+		es := peer.EvpnEthernetSegments().Add().SetActiveMode(gosnappi.BgpV4EthernetSegmentActiveMode.SINGLE_ACTIVE)
+		eviVxlan := es.Evis().Add().EviVxlan().
+			SetReplicationType(gosnappi.BgpV4EviVxlanReplicationType.INGRESS_REPLICATION).
+			SetPmsiLabel(vni).
+			SetAdLabel(vni)
+		eviVxlan.RouteDistinguisher().SetRdType(gosnappi.BgpRouteDistinguisherRdType.IPV4_ADDRESS).SetRdValue(routeDistinguisher(a.ate.IPv4))
+		eviVxlan.RouteTargetExport().Add().SetRtType(gosnappi.BgpRouteTargetRtType.AS_2OCTET).SetRtValue(routeTarget)
+		eviVxlan.RouteTargetImport().Add().SetRtType(gosnappi.BgpRouteTargetRtType.AS_2OCTET).SetRtValue(routeTarget)
+		hosts := eviVxlan.BroadcastDomains().Add().CmacIpRange().Add().SetName(a.ate.Name + ".host").SetL2Vni(vni)
+		hosts.MacAddresses().SetAddress(a.hostMAC).SetPrefix(48).SetCount(1)
+		hosts.Ipv4Addresses().SetAddress(a.hostIP).SetPrefix(32).SetCount(1)
+	}
+	top.Captures().Add().SetName(captureName).SetPortNames(ports).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// awaitBGP waits for the BGP sessions of the DUT with ate2 and ate3 to be
+// established.
+func awaitBGP(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	bgp := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).Bgp()
+	for _, addr := range []string{ate2.IPv4, ate3.IPv4} {
+		_, ok := gnmi.Watch(t, dut, bgp.Neighbor(addr).SessionState().State(), 2*time.Minute, func(v *ygnmi.Value[oc.E_Bgp_Neighbor_SessionState]) bool {
+			state, present := v.Val()
+			return present && state == oc.Bgp_Neighbor_SessionState_ESTABLISHED
+		}).Await(t)
+		if !ok {
+			t.Fatalf("BGP session with %s is not established", addr)
+		}
+	}
+}
+
+// evpnRoutes returns the MAC addresses of the MAC/IP routes and the
+// originating router IPs of the inclusive multicast routes in the L2VPN EVPN
+// RIB of the DUT, by route distinguisher.
+func evpnRoutes(t *testing.T, dut *ondatra.DUTDevice) (macs, vteps map[string][]string) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).Bgp().
+		Rib().AfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_L2VPN_EVPN).L2VpnEvpn().LocRib().State()
+	macs, vteps = map[string][]string{}, map[string][]string{}
+	rib, ok := gnmi.Lookup(t, dut, q).Val()
+	if !ok {
+		return macs, vteps
+	}
+	for rd, r := range rib.RouteDistinguisher {
+		for k := range r.TypeTwoRoute {
+			macs[rd] = append(macs[rd], strings.ToLower(k.MacAddress))
+		}
+		for k := range r.TypeThreeRoute {
+			vteps[rd] = append(vteps[rd], k.OriginatingRouterIp)
+		}
+	}
+	return macs, vteps
+}
+
+// awaitRoute waits for the MAC/IP route of mac and the inclusive multicast
+// route of vtep with the route distinguisher of vtep to be in the L2VPN EVPN
+// RIB of the DUT.
+func awaitRoute(t *testing.T, dut *ondatra.DUTDevice, vtep, mac string) {
+	t.Helper()
+	rd := routeDistinguisher(vtep)
+	var macs, vteps map[string][]string
+	for deadline := time.Now().Add(2 * time.Minute); time.Now().Before(deadline); time.Sleep(5 * time.Second) {
+		macs, vteps = evpnRoutes(t, dut)
+		if contains(macs[rd], mac) && contains(vteps[rd], vtep) {
+			t.Logf("Got MAC/IP route of %s and inclusive multicast route of %s with route distinguisher %s", mac, vtep, rd)
+			return
+		}
+	}
+	t.Errorf("Routes with route distinguisher %s: got MAC/IP routes of %v and inclusive multicast routes of %v, want %s and %s", rd, macs[rd], vteps[rd], mac, vtep)
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// flow is a flow of frames of the VLAN sent on port. Frames sent on an
+// underlay port are encapsulated in VXLAN to the DUT.
+type flow struct {
+	name     string
+	port     string
+	src, dst string
+	srcIP    string
+	dstIP    string
+}
+
+// addFlow replaces the flows of top with f. dstMAC is the MAC address of the
+// DUT port of the flow, used by the encapsulated flows.
+func addFlow(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config, f flow, dstMAC string) {
+	t.Helper()
+	top.Flows().Clear()
+	fl := top.Flows().Add().SetName(f.name)
+	fl.Metrics().SetEnable(true)
+	rx := []string{ate.Port(t, "port1").ID()}
+	if f.port == "port1" {
+		rx = []string{ate.Port(t, "port2").ID(), ate.Port(t, "port3").ID()}
+	}
+	fl.TxRx().Port().SetTxName(ate.Port(t, f.port).ID()).SetRxNames(rx)
+	if f.port != "port1" {
+		a := ate2
+		if f.port == "port3" {
+			a = ate3
+		}
+		eth := fl.Packet().Add().Ethernet()
+		eth.Src().SetValue(a.MAC)
+		eth.Dst().SetValue(dstMAC)
+		ip := fl.Packet().Add().Ipv4()
+		ip.Src().SetValue(a.IPv4)
+		ip.Dst().SetValue(dutLoopback.IPv4)
+		fl.Packet().Add().Udp().DstPort().SetValue(vxlanPort)
+		fl.Packet().Add().Vxlan().Vni().SetValue(vni)
+	}
+	eth := fl.Packet().Add().Ethernet()
+	eth.Src().SetValue(f.src)
+	eth.Dst().SetValue(f.dst)
+	ip := fl.Packet().Add().Ipv4()
+	ip.Src().SetValue(f.srcIP)
+	ip.Dst().SetValue(f.dstIP)
+	fl.Packet().Add().Udp()
+	fl.Size().SetFixed(frameSize)
+	fl.Rate().SetPps(ppsRate)
+	fl.Duration().FixedPackets().SetPackets(packets)
+}
+
+// sendFlow sends f and returns the packets captured on each port of the
+// ATE.
+func sendFlow(t *testing.T, dut *ondatra.DUTDevice, ate *ondatra.ATEDevice, top gosnappi.Config, f flow) map[string][]gopacket.Packet {
+	t.Helper()
+	dstMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, f.port).Name()).Ethernet().MacAddress().State())
+	addFlow(t, ate, top, f, dstMAC)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	awaitBGP(t, dut)
+
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+	otgutils.StopCapture(t, ate.OTG())
+	time.Sleep(10 * time.Second)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+	pkts := map[string][]gopacket.Packet{}
+	for _, port := range []string{"port1", "port2", "port3"} {
+		pkts[port] = otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, port).ID())
+	}
+	return pkts
+}
+
+// frame is an Ethernet frame of the VLAN received by the ATE, with the
+// outer addresses and the VNI of its VXLAN header if it was encapsulated.
+type frame struct {
+	src, dst string
+	outerSrc string
+	outerDst string
+	vni      uint32
+	vxlan    bool
+}
+
+// frames returns the frames of the VLAN sent by src in pkts.
+func frames(pkts []gopacket.Packet, src string) []frame {
+	var fs []frame
+	for _, p := range pkts {
+		var f frame
+		var outer *layers.IPv4
+		for _, l := range p.Layers() {
+			switch l := l.(type) {
+			case *layers.IPv4:
+				if outer == nil {
+					outer = l
+				}
+			case *layers.VXLAN:
+				f.vxlan, f.vni = true, l.VNI
+				f.outerSrc, f.outerDst = outer.SrcIP.String(), outer.DstIP.String()
+			case *layers.Ethernet:
+				// The last Ethernet header is the inner one of an
+				// encapsulated frame.
+				f.src, f.dst = l.SrcMAC.String(), l.DstMAC.String()
+			}
+		}
+		if f.src == src {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// verifyEncapsulated verifies that the frames of f captured on port are
+// encapsulated in VXLAN with vni from the DUT to the VTEP of the port, and
+// that they are received on the port if and only if want is set.
+func verifyEncapsulated(t *testing.T, pkts map[string][]gopacket.Packet, f flow, port string, want bool) {
+	t.Helper()
+	vtep := ate2.IPv4
+	if port == "port3" {
+		vtep = ate3.IPv4
+	}
+	fs := frames(pkts[port], f.src)
+	var bad int
+	for _, fr := range fs {
+		if !fr.vxlan || fr.vni != vni || fr.outerSrc != dutLoopback.IPv4 || fr.outerDst != vtep || fr.dst != f.dst {
+			if bad == 0 {
+				t.Errorf("Flow %s: got frame %+v on %s, want frame to %s encapsulated with VNI %d from %s to %s", f.name, fr, port, f.dst, vni, dutLoopback.IPv4, vtep)
+			}
+			bad++
+		}
+	}
+	t.Logf("Flow %s: captured %d frames on %s, %d not encapsulated as expected", f.name, len(fs), port, bad)
+	switch {
+	case want && len(fs) < packets:
+		t.Errorf("Flow %s: got %d frames on %s, want %d", f.name, len(fs), port, packets)
+	case !want && len(fs) != 0:
+		t.Errorf("Flow %s: got %d frames on %s, want none", f.name, len(fs), port)
+	}
+}
+
+func TestEVPNVXLAN(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+
+	ate := ondatra.ATE(t, "ate")
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	awaitBGP(t, dut)
+
+	t.Run("RemoteRoutes", func(t *testing.T) {
+		awaitRoute(t, dut, ate2.IPv4, host2MAC)
+		awaitRoute(t, dut, ate3.IPv4, host3MAC)
+	})
+
+	for _, f := range []flow{{
+		name:  "Broadcast",
+		port:  "port1",
+		src:   host1MAC,
+		dst:   broadcast,
+		srcIP: host1IP,
+		dstIP: "198.51.100.255",
+	}, {
+		name:  "UnknownUnicast",
+		port:  "port1",
+		src:   host1MAC,
+		dst:   unknownMAC,
+		srcIP: host1IP,
+		dstIP: "198.51.100.15",
+	}} {
+		t.Run(f.name, func(t *testing.T) {
+			pkts := sendFlow(t, dut, ate, top, f)
+			verifyEncapsulated(t, pkts, f, "port2", true)
+			verifyEncapsulated(t, pkts, f, "port3", true)
+		})
+	}
+
+	t.Run("LocalMACAdvertisement", func(t *testing.T) {
+		fdb := gnmi.OC().NetworkInstance(macVrfName).Fdb().MacTable().Entry(host1MAC, vlanID).State()
+		entry, ok := gnmi.Watch(t, dut, fdb, time.Minute, func(v *ygnmi.Value[*oc.NetworkInstance_Fdb_MacTable_Entry]) bool {
+			return v.IsPresent()
+		}).Await(t)
+		if !ok {
+			t.Fatalf("MAC address %s is not learned in VLAN %d", host1MAC, vlanID)
+		}
+		e, _ := entry.Val()
+		if got, want := e.GetInterface().GetInterfaceRef().GetInterface(), dut.Port(t, "port1").Name(); got != want {
+			t.Errorf("MAC address %s learned on interface %s, want %s", host1MAC, got, want)
+		}
+		awaitRoute(t, dut, dutLoopback.IPv4, host1MAC)
+	})
+
+	t.Run("KnownUnicast", func(t *testing.T) {
+		f := flow{
+			name:  "KnownUnicast",
+			port:  "port1",
+			src:   host1MAC,
+			dst:   host2MAC,
+			srcIP: host1IP,
+			dstIP: host2IP,
+		}
+		pkts := sendFlow(t, dut, ate, top, f)
+		verifyEncapsulated(t, pkts, f, "port2", true)
+		verifyEncapsulated(t, pkts, f, "port3", false)
+	})
+
+	t.Run("Decapsulation", func(t *testing.T) {
+		f := flow{
+			name:  "Decapsulation",
+			port:  "port2",
+			src:   host2MAC,
+			dst:   host1MAC,
+			srcIP: host2IP,
+			dstIP: host1IP,
+		}
+		pkts := sendFlow(t, dut, ate, top, f)
+		fs := frames(pkts["port1"], host2MAC)
+		var bad int
+		for _, fr := range fs {
+			if fr.vxlan || fr.dst != host1MAC {
+				bad++
+			}
+		}
+		t.Logf("Flow %s: captured %d frames on port1, %d not decapsulated to %s", f.name, len(fs), bad, host1MAC)
+		if len(fs) < packets || bad != 0 {
+			t.Errorf("Flow %s: got %d frames on port1 with %d not decapsulated to %s, want %d decapsulated", f.name, len(fs), bad, host1MAC, packets)
+		}
+		if fs := frames(pkts["port3"], host2MAC); len(fs) != 0 {
+			t.Errorf("Flow %s: got %d frames on port3, want none", f.name, len(fs))
+		}
+	})
+}
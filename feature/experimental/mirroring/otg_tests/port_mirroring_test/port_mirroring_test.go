@@ -0,0 +1,367 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package port_mirroring_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, dut:port2 -> ate:port2,
+// which receives the original traffic, dut:port3 -> ate:port3, the local
+// mirroring destination, and dut:port4 -> ate:port4, to which the ERSPAN
+// collector address is routed.
+//
+// Only the packets of the ingress traffic of dut:port1 to UDP port
+// mirroredPort are mirrored.
+const (
+	plen = 30
+
+	mirrorACL     = "mirror-select"
+	spanSession   = "span1"
+	erspanSession = "erspan1"
+	mirroredPort  = 5001
+	otherPort     = 5002
+	greProtocol   = 47
+
+	collectorNet = "203.0.113.0/24"
+	collectorDst = "203.0.113.1"
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	spanCapture   = "port3-capture"
+	erspanCapture = "port4-capture"
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dutSrc = attrs.Attributes{
+		Desc:    "Mirror source",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dutDst = attrs.Attributes{
+		Desc:    "Original traffic output",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	dutSpan = attrs.Attributes{
+		Desc: "Local mirroring destination",
+	}
+	dutErspan = attrs.Attributes{
+		Desc:    "ERSPAN output",
+		IPv4:    "192.0.2.13",
+		IPv4Len: plen,
+	}
+	ateErspan = attrs.Attributes{
+		Name:    "ate4",
+		MAC:     "02:00:04:01:01:01",
+		IPv4:    "192.0.2.14",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the DUT interfaces and the static route to the
+// ERSPAN collector. dut:port3 has no IP address, since it only sends the
+// mirrored packets.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dutSrc},
+		{"port2", dutDst},
+		{"port3", dutSpan},
+		{"port4", dutErspan},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if p.attrs.IPv4 != "" && deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	b := &gnmi.SetBatch{}
+	cfg := &cfgplugins.StaticRouteCfg{
+		NetworkInstance: deviations.DefaultNetworkInstance(dut),
+		Prefix:          collectorNet,
+		NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+			"0": oc.UnionString(ateErspan.IPv4),
+		},
+	}
+	if _, err := cfgplugins.NewStaticRouteCfg(b, cfg, dut); err != nil {
+		t.Fatalf("Failed to configure the static route to %s: %v", collectorNet, err)
+	}
+	b.Set(t, dut)
+}
+
+// mirrorConfig returns the CLI configuring the mirroring session of the
+// ingress traffic of dut:port1 selected by mirrorACL, to dut:port3 if
+// erspan is false, or in GRE to collectorDst otherwise. The session is
+// removed if remove is true. OpenConfig does not model the mirroring
+// sessions, so the configuration is vendor specific.
+func mirrorConfig(t *testing.T, dut *ondatra.DUTDevice, erspan, remove bool) string {
+	t.Helper()
+	src := dut.Port(t, "port1").Name()
+	span := dut.Port(t, "port3").Name()
+	switch dut.Vendor() {
+	case ondatra.ARISTA:
+		session := spanSession
+		dst := "destination " + span
+		if erspan {
+			session = erspanSession
+			dst = fmt.Sprintf("destination tunnel mode gre source %s destination %s", dutErspan.IPv4, collectorDst)
+		}
+		if remove {
+			return fmt.Sprintf("no monitor session %s\nno ip access-list %s\n", session, mirrorACL)
+		}
+		return fmt.Sprintf(`
+ip access-list %[1]s
+   10 permit udp any any eq %[2]d
+monitor session %[3]s source %[4]s rx ip access-group %[1]s
+monitor session %[3]s %[5]s
+`, mirrorACL, mirroredPort, session, src, dst)
+	case ondatra.CISCO:
+		session := spanSession
+		dst := span
+		if erspan {
+			session = erspanSession
+			dst = "tunnel-ip1"
+		}
+		if remove {
+			cfg := fmt.Sprintf(`
+interface %[1]s
+ no monitor-session %[2]s ethernet
+ no ipv4 access-group %[3]s ingress
+!
+no monitor-session %[2]s
+no ipv4 access-list %[3]s
+`, src, session, mirrorACL)
+			if erspan {
+				cfg += "no interface tunnel-ip1\n"
+			}
+			return cfg
+		}
+		cfg := fmt.Sprintf(`
+ipv4 access-list %[1]s
+ 10 permit udp any any eq %[2]d capture
+ 20 permit ipv4 any any
+!
+`, mirrorACL, mirroredPort)
+		if erspan {
+			cfg += fmt.Sprintf(`
+interface tunnel-ip1
+ tunnel mode gre ipv4
+ tunnel source %s
+ tunnel destination %s
+!
+`, dutErspan.IPv4, collectorDst)
+		}
+		return cfg + fmt.Sprintf(`
+monitor-session %[1]s ethernet
+ destination interface %[2]s
+!
+interface %[3]s
+ monitor-session %[1]s ethernet direction rx-only port-level acl
+ ipv4 access-group %[4]s ingress
+!
+`, session, dst, src, mirrorACL)
+	default:
+		t.Skipf("Mirroring configuration is not supported for vendor %v", dut.Vendor())
+	}
+	return ""
+}
+
+// configureMirroring adds or removes the mirroring session.
+func configureMirroring(t *testing.T, dut *ondatra.DUTDevice, erspan, remove bool) {
+	t.Helper()
+	cli := mirrorConfig(t, dut, erspan, remove)
+	if _, err := dut.RawAPIs().GNMI(t).Set(context.Background(), cliSetRequest(cli)); err != nil {
+		t.Fatalf("Failed to configure the mirroring session: %v", err)
+	}
+}
+
+func cliSetRequest(config string) *gpb.SetRequest {
+	return &gpb.SetRequest{
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{
+				Origin: "cli",
+			},
+			Val: &gpb.TypedValue{
+				Value: &gpb.TypedValue_AsciiVal{
+					AsciiVal: config,
+				},
+			},
+		}},
+	}
+}
+
+// mirrorCounts returns the numbers of mirrored packets captured on port of
+// the ATE by UDP destination port. If erspan is true, only the packets
+// encapsulated in GRE from dut:port4 to collectorDst are counted, and the
+// number of other GRE packets is also returned.
+func mirrorCounts(t *testing.T, ate *ondatra.ATEDevice, port string, erspan bool) (map[uint16]int, int) {
+	t.Helper()
+	counts := map[uint16]int{}
+	bad := 0
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, port).ID()) {
+		udp, ok := p.Layer(layers.LayerTypeUDP).(*layers.UDP)
+		if !ok {
+			continue
+		}
+		if erspan {
+			outer, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+			if !ok || p.Layer(layers.LayerTypeGRE) == nil {
+				continue
+			}
+			if outer.Protocol != greProtocol || outer.SrcIP.String() != dutErspan.IPv4 || outer.DstIP.String() != collectorDst {
+				bad++
+				continue
+			}
+		}
+		counts[uint16(udp.DstPort)]++
+	}
+	return counts, bad
+}
+
+// addFlow adds a flow named name from ate:port1 to ate:port2 with UDP
+// destination port dstPort.
+func addFlow(top gosnappi.Config, name string, dstPort uint32) {
+	flow := top.Flows().Add().SetName(name)
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Device().SetTxNames([]string{ateSrc.Name + ".IPv4"}).SetRxNames([]string{ateDst.Name + ".IPv4"})
+	flow.Packet().Add().Ethernet().Src().SetValue(ateSrc.MAC)
+	ip := flow.Packet().Add().Ipv4()
+	ip.Src().SetValue(ateSrc.IPv4)
+	ip.Dst().SetValue(ateDst.IPv4)
+	udp := flow.Packet().Add().Udp()
+	udp.SrcPort().SetValue(50000)
+	udp.DstPort().SetValue(dstPort)
+	flow.Size().SetFixed(frameSize)
+	flow.Rate().SetPps(ppsRate)
+	flow.Duration().FixedPackets().SetPackets(packets)
+}
+
+// runFlows sends the flows of top, checks that they are received without
+// loss, and returns the numbers of packets sent by flow.
+func runFlows(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config) map[string]uint64 {
+	t.Helper()
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+	time.Sleep(10 * time.Second)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+	sent := map[string]uint64{}
+	for _, f := range top.Flows().Items() {
+		counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.Name()).Counters().State())
+		if counters.GetOutPkts() == 0 || counters.GetInPkts() != counters.GetOutPkts() {
+			t.Errorf("Flow %s: got %d packets received of %d sent, want no loss", f.Name(), counters.GetInPkts(), counters.GetOutPkts())
+		}
+		sent[f.Name()] = counters.GetOutPkts()
+	}
+	return sent
+}
+
+func TestPortMirroring(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutSrc)
+	ateDst.AddToOTG(top, ate.Port(t, "port2"), &dutDst)
+	top.Ports().Add().SetName(ate.Port(t, "port3").ID())
+	ateErspan.AddToOTG(top, ate.Port(t, "port4"), &dutErspan)
+	top.Captures().Add().SetName(spanCapture).SetPortNames([]string{ate.Port(t, "port3").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	top.Captures().Add().SetName(erspanCapture).SetPortNames([]string{ate.Port(t, "port4").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	addFlow(top, "mirrored", mirroredPort)
+	addFlow(top, "not-mirrored", otherPort)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+	t.Run("NoMirroring", func(t *testing.T) {
+		runFlows(t, ate, top)
+	})
+
+	for _, tc := range []struct {
+		desc   string
+		erspan bool
+		port   string
+	}{
+		{"LocalMirroring", false, "port3"},
+		{"ERSPAN", true, "port4"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			configureMirroring(t, dut, tc.erspan, false)
+			defer configureMirroring(t, dut, tc.erspan, true)
+			// Let the session become active before sending the traffic.
+			time.Sleep(5 * time.Second)
+
+			otgutils.StartCapture(t, ate.OTG())
+			sent := runFlows(t, ate, top)
+			otgutils.StopCapture(t, ate.OTG())
+
+			counts, bad := mirrorCounts(t, ate, tc.port, tc.erspan)
+			t.Logf("Mirrored packets captured on %s by UDP port: %v", tc.port, counts)
+			if bad > 0 {
+				t.Errorf("Got %d GRE packets with bad outer headers, want source %s and destination %s", bad, dutErspan.IPv4, collectorDst)
+			}
+			if got, want := uint64(counts[mirroredPort]), sent["mirrored"]; got != want {
+				t.Errorf("Got %d mirrored copies of flow mirrored, want %d", got, want)
+			}
+			if got := counts[otherPort]; got != 0 {
+				t.Errorf("Got %d mirrored copies of flow not-mirrored, want 0", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,618 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entropy_label_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/gribi"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/gribigo/client"
+	"github.com/openconfig/gribigo/constants"
+	"github.com/openconfig/gribigo/fluent"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the ingress LSR, and
+// dut:port2 -> ate:port2 and dut:port3 -> ate:port3, the members of the ECMP
+// next hop group of transitLabel.
+//
+// The DUT runs level 2 IS-IS with segment routing with ate:port1, which
+// captures its LSPs to verify the signaled entropy label capability. The
+// transit LSP of the DUT is programmed with gRIBI, swapping transitLabel to
+// swapLabel towards ate:port2 and ate:port3. ate:port1 sends packets with the
+// entropy label indicator and an entropy label below transitLabel, with
+// identical IP headers, so that only the entropy label varies between the
+// packets.
+const (
+	plen = 30
+
+	isisName    = "DEFAULT"
+	areaAddress = "49.0001"
+	dutSysID    = "1920.0000.2001"
+	ate1SysID   = "640000000001"
+
+	srgbBlock = "srgb-block"
+	srgbName  = "srgb"
+	srgbBase  = 16000
+	srgbSize  = 8000
+	nodeIndex = 1
+
+	transitLabel = 100001
+	swapLabel    = 200001
+	// eli is the entropy label indicator of RFC 6790.
+	eli = 7
+	// entropyBase and entropyCount are the range of the entropy labels of
+	// the flow with distinct entropy labels.
+	entropyBase  = 1000
+	entropyCount = 1000
+	// minERLD is the entropy readable label depth needed to read the
+	// entropy label below transitLabel and the entropy label indicator.
+	minERLD = 3
+
+	nhIndex2 = 2
+	nhIndex3 = 3
+	nhgIndex = 1
+
+	targetDst = "198.51.100.1"
+
+	ttl = 64
+
+	packets   = 60000
+	frameSize = 512
+	ppsRate   = 1000
+	// lbTolerancePct is the tolerated deviation in percent of the frames
+	// received on each ECMP member from an even distribution, and idlePct the
+	// percentage of the frames sent below which a member is idle.
+	lbTolerancePct = 20
+	idlePct        = 1
+
+	captureName = "el-capture"
+	// lspWait is the time allowed for the DUT to flood its LSP.
+	lspWait = 30 * time.Second
+)
+
+var (
+	dutLoopback = attrs.Attributes{
+		Desc:    "Node SID",
+		IPv4:    "203.0.113.1",
+		IPv4Len: 32,
+	}
+	ate1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dut1 = attrs.Attributes{
+		Desc:    "Ingress LSR",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dut2 = attrs.Attributes{
+		Desc:    "ECMP member 1",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ate2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	dut3 = attrs.Attributes{
+		Desc:    "ECMP member 2",
+		IPv4:    "192.0.2.9",
+		IPv4Len: plen,
+	}
+	ate3 = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv4Len: plen,
+	}
+
+	// members are the ports of the ECMP members.
+	members = []string{"port2", "port3"}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// isisInterface returns the name of the IS-IS interface of the interface
+// name.
+func isisInterface(dut *ondatra.DUTDevice, name string) string {
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		return name + ".0"
+	}
+	return name
+}
+
+// configureDUT configures the interfaces with MPLS, and IS-IS with segment
+// routing with ate1.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	lb := netutil.LoopbackInterface(t, dut, 0)
+	lo := dutLoopback.NewOCInterface(lb, dut)
+	lo.Type = oc.IETFInterfaces_InterfaceType_softwareLoopback
+	gnmi.Replace(t, dut, gnmi.OC().Interface(lb).Config(), lo)
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, lb, dni, 0)
+	}
+
+	var links []string
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dut1},
+		{"port2", dut2},
+		{"port3", dut3},
+	} {
+		dp := dut.Port(t, p.port)
+		links = append(links, dp.Name())
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), dni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	ni := &oc.NetworkInstance{Name: ygot.String(dni)}
+	mpls := ni.GetOrCreateMpls().GetOrCreateGlobal()
+	rlb := mpls.GetOrCreateReservedLabelBlock(srgbBlock)
+	rlb.SetLowerBound(oc.UnionUint32(srgbBase))
+	rlb.SetUpperBound(oc.UnionUint32(srgbBase + srgbSize - 1))
+	for _, name := range links {
+		intf := mpls.GetOrCreateInterface(name)
+		intf.SetMplsEnabled(true)
+		intf.GetOrCreateInterfaceRef().SetInterface(name)
+	}
+	srgb := ni.GetOrCreateSegmentRouting().GetOrCreateSrgb(srgbName)
+	srgb.SetMplsLabelBlocks([]string{srgbBlock})
+	srgb.SetDataplaneType(oc.SegmentRouting_SrDataplaneType_MPLS)
+	addISIS(dut, ni, lb, links[0])
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(dni).Config(), ni)
+}
+
+// addISIS adds to ni the level 2 IS-IS instance with segment routing over
+// link, advertising the loopback lb passively with its prefix-SID.
+func addISIS(dut *ondatra.DUTDevice, ni *oc.NetworkInstance, lb, link string) {
+	prot := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_ISIS, isisName)
+	prot.SetEnabled(true)
+	isis := prot.GetOrCreateIsis()
+	glob := isis.GetOrCreateGlobal()
+	if deviations.ISISInstanceEnabledRequired(dut) {
+		glob.SetInstance(isisName)
+	}
+	glob.SetNet([]string{fmt.Sprintf("%s.%s.00", areaAddress, dutSysID)})
+	glob.SetLevelCapability(oc.Isis_LevelType_LEVEL_2)
+	glob.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+	sr := glob.GetOrCreateSegmentRouting()
+	sr.SetEnabled(true)
+	sr.SetSrgb(srgbName)
+	level := isis.GetOrCreateLevel(2)
+	level.SetMetricStyle(oc.Isis_MetricStyle_WIDE_METRIC)
+	if deviations.ISISLevelEnabled(dut) {
+		level.SetEnabled(true)
+	}
+	for _, name := range []string{lb, link} {
+		intf := isis.GetOrCreateInterface(isisInterface(dut, name))
+		intf.SetEnabled(true)
+		if name == lb {
+			intf.SetPassive(true)
+		} else {
+			intf.SetCircuitType(oc.Isis_CircuitType_POINT_TO_POINT)
+		}
+		if deviations.ISISInterfaceLevel1DisableRequired(dut) {
+			intf.GetOrCreateLevel(1).SetEnabled(false)
+		} else {
+			intf.GetOrCreateLevel(2).SetEnabled(true)
+		}
+		if !deviations.ISISInterfaceAfiUnsupported(dut) {
+			intf.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+		}
+	}
+	af := isis.GetOrCreateInterface(isisInterface(dut, lb)).GetOrCreateLevel(2).GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST)
+	af.GetOrCreateSegmentRouting().GetOrCreatePrefixSid(dutLoopback.IPv4CIDR()).SetSidId(oc.UnionUint32(srgbBase + nodeIndex))
+}
+
+// configureATE configures IS-IS on ate1, the addresses of ate2 and ate3, and
+// the capture of ate:port1, ate:port2 and ate:port3.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	dev := ate1.AddToOTG(top, ate.Port(t, "port1"), &dut1)
+	isis := dev.Isis().SetSystemId(ate1SysID).SetName(ate1.Name + ".isis")
+	isis.Basic().SetHostname(isis.Name()).SetLearnedLspFilter(true)
+	isis.Advanced().SetAreaAddresses([]string{strings.ReplaceAll(areaAddress, ".", "")})
+	isis.Interfaces().Add().
+		SetEthName(dev.Ethernets().Items()[0].Name()).
+		SetName(ate1.Name + ".isis.intf").
+		SetNetworkType(gosnappi.IsisInterfaceNetworkType.POINT_TO_POINT).
+		SetLevelType(gosnappi.IsisInterfaceLevelType.LEVEL_2).
+		SetMetric(10)
+	ate2.AddToOTG(top, ate.Port(t, "port2"), &dut2)
+	ate3.AddToOTG(top, ate.Port(t, "port3"), &dut3)
+	var ports []string
+	for _, port := range []string{"port1", "port2", "port3"} {
+		ports = append(ports, ate.Port(t, port).ID())
+	}
+	top.Captures().Add().SetName(captureName).SetPortNames(ports).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// awaitAdjacency waits for the IS-IS adjacency of the DUT with ate1 to be up.
+func awaitAdjacency(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	intf := isisInterface(dut, dut.Port(t, "port1").Name())
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_ISIS, isisName).Isis().
+		Interface(intf).Level(2).AdjacencyAny().AdjacencyState().State()
+	_, ok := gnmi.WatchAll(t, dut, q, time.Minute, func(v *ygnmi.Value[oc.E_Isis_IsisInterfaceAdjState]) bool {
+		state, present := v.Val()
+		return present && state == oc.Isis_IsisInterfaceAdjState_UP
+	}).Await(t)
+	if !ok {
+		t.Fatalf("IS-IS adjacency on %s is not up", intf)
+	}
+}
+
+// elAdvertisement is the entropy label capability signaled in the LSP of
+// the DUT, as specified in RFC 9088.
+type elAdvertisement struct {
+	// erld is the value of the ERLD-MSD of the Node MSD sub-TLV, or 0 if it
+	// is not advertised.
+	erld byte
+	// elc are the prefixes advertised with the ELC flag.
+	elc map[string]bool
+}
+
+const (
+	isisLSPL2     = 20
+	isisLSPHeader = 27
+
+	tlvExtIPReach     = 135
+	tlvRouterCap      = 242
+	subTLVNodeMSD     = 23
+	subTLVPrefixAttrs = 4
+	msdTypeERLD       = 2
+	prefixAttrFlagELC = 0x10
+)
+
+// tlvs calls fn with the type and value of the TLVs of b.
+func tlvs(b []byte, fn func(typ byte, v []byte)) {
+	for len(b) >= 2 && len(b) >= 2+int(b[1]) {
+		fn(b[0], b[2:2+int(b[1])])
+		b = b[2+int(b[1]):]
+	}
+}
+
+// parseLSPs returns the entropy label capability signaled in the last level
+// 2 LSP fragments of the DUT in pkts.
+func parseLSPs(pkts []gopacket.Packet) (*elAdvertisement, error) {
+	sysID, err := hex.DecodeString(strings.ReplaceAll(dutSysID, ".", ""))
+	if err != nil {
+		return nil, err
+	}
+	// fragments are the TLVs of the LSP fragments of the DUT by number.
+	fragments := map[byte][]byte{}
+	for _, p := range pkts {
+		llc, ok := p.Layer(layers.LayerTypeLLC).(*layers.LLC)
+		if !ok || llc.DSAP != 0xfe {
+			continue
+		}
+		pdu := llc.LayerPayload()
+		if len(pdu) < isisLSPHeader || pdu[0] != 0x83 || pdu[4]&0x1f != isisLSPL2 {
+			continue
+		}
+		// The LSP ID is at offset 12, followed by the pseudonode ID and
+		// the fragment number.
+		if !bytes.Equal(pdu[12:18], sysID) || pdu[18] != 0 {
+			continue
+		}
+		fragments[pdu[19]] = pdu[isisLSPHeader:]
+	}
+	if len(fragments) == 0 {
+		return nil, fmt.Errorf("no LSP of %s captured", dutSysID)
+	}
+
+	adv := &elAdvertisement{elc: map[string]bool{}}
+	for _, b := range fragments {
+		tlvs(b, func(typ byte, v []byte) {
+			switch typ {
+			case tlvRouterCap:
+				// Router ID and flags.
+				if len(v) < 5 {
+					return
+				}
+				tlvs(v[5:], func(typ byte, v []byte) {
+					if typ != subTLVNodeMSD {
+						return
+					}
+					// Pairs of MSD type and value.
+					for ; len(v) >= 2; v = v[2:] {
+						if v[0] == msdTypeERLD {
+							adv.erld = v[1]
+						}
+					}
+				})
+			case tlvExtIPReach:
+				for len(v) >= 5 {
+					ctrl := v[4]
+					plen := int(ctrl & 0x3f)
+					n := 5 + (plen+7)/8
+					if len(v) < n {
+						return
+					}
+					ip := make(net.IP, 4)
+					copy(ip, v[5:n])
+					prefix := fmt.Sprintf("%s/%d", ip, plen)
+					v = v[n:]
+					if ctrl&0x40 == 0 {
+						continue
+					}
+					if len(v) < 1 || len(v) < 1+int(v[0]) {
+						return
+					}
+					tlvs(v[1:1+int(v[0])], func(typ byte, s []byte) {
+						if typ == subTLVPrefixAttrs && len(s) >= 1 && s[0]&prefixAttrFlagELC != 0 {
+							adv.elc[prefix] = true
+						}
+					})
+					v = v[1+int(v[0]):]
+				}
+			}
+		})
+	}
+	return adv, nil
+}
+
+// programTransitLSP programs with gRIBI the transit LSP of transitLabel,
+// swapped to swapLabel towards ate2 and ate3 with equal weights.
+func programTransitLSP(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	c := &gribi.Client{
+		DUT:         dut,
+		FIBACK:      true,
+		Persistence: true,
+	}
+	if err := c.Start(t); err != nil {
+		t.Fatalf("gRIBI Connection can not be established")
+	}
+	defer c.Close(t)
+	c.BecomeLeader(t)
+	c.FlushAll(t)
+
+	var entries []fluent.GRIBIEntry
+	var results []*client.OpResult
+	for _, nh := range []struct {
+		index uint64
+		addr  string
+	}{
+		{nhIndex2, ate2.IPv4},
+		{nhIndex3, ate3.IPv4},
+	} {
+		entries = append(entries, fluent.NextHopEntry().
+			WithNetworkInstance(dni).
+			WithIndex(nh.index).
+			WithIPAddress(nh.addr).
+			WithPopTopLabel().
+			WithPushedLabelStack(swapLabel))
+		results = append(results, fluent.OperationResult().
+			WithNextHopOperation(nh.index).
+			WithOperationType(constants.Add).
+			WithProgrammingResult(fluent.InstalledInFIB).
+			AsResult())
+	}
+	nhg, result := gribi.NHGEntry(nhgIndex, map[uint64]uint64{nhIndex2: 1, nhIndex3: 1}, dni, fluent.InstalledInFIB)
+	entries = append(entries, nhg, fluent.LabelEntry().
+		WithLabel(transitLabel).
+		WithNetworkInstance(dni).
+		WithNextHopGroupNetworkInstance(dni).
+		WithNextHopGroup(nhgIndex))
+	results = append(results, result, fluent.OperationResult().
+		WithMPLSOperation(transitLabel).
+		WithOperationType(constants.Add).
+		WithProgrammingResult(fluent.InstalledInFIB).
+		AsResult())
+	c.AddEntries(t, entries, results)
+}
+
+// flow is a flow sent from ate:port1 to transitLabel, with count entropy
+// labels starting at entropy.
+type flow struct {
+	name    string
+	entropy uint32
+	count   uint32
+}
+
+// addFlow replaces the flows of top with f, sent to dstMAC, the MAC address
+// of dut:port1.
+func addFlow(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config, f flow, dstMAC string) {
+	t.Helper()
+	top.Flows().Clear()
+	fl := top.Flows().Add().SetName(f.name)
+	fl.Metrics().SetEnable(true)
+	var rx []string
+	for _, port := range members {
+		rx = append(rx, ate.Port(t, port).ID())
+	}
+	fl.TxRx().Port().SetTxName(ate.Port(t, "port1").ID()).SetRxNames(rx)
+	eth := fl.Packet().Add().Ethernet()
+	eth.Src().SetValue(ate1.MAC)
+	eth.Dst().SetValue(dstMAC)
+	transit := fl.Packet().Add().Mpls()
+	transit.Label().SetValue(transitLabel)
+	transit.TimeToLive().SetValue(ttl)
+	transit.BottomOfStack().SetValue(0)
+	indicator := fl.Packet().Add().Mpls()
+	indicator.Label().SetValue(eli)
+	indicator.TimeToLive().SetValue(ttl)
+	indicator.BottomOfStack().SetValue(0)
+	// The entropy label is sent with a TTL of 0, as specified in RFC 6790.
+	entropy := fl.Packet().Add().Mpls()
+	if f.count > 1 {
+		entropy.Label().Increment().SetStart(f.entropy).SetStep(1).SetCount(f.count)
+	} else {
+		entropy.Label().SetValue(f.entropy)
+	}
+	entropy.TimeToLive().SetValue(0)
+	entropy.BottomOfStack().SetValue(1)
+	ip := fl.Packet().Add().Ipv4()
+	ip.Src().SetValue(ate1.IPv4)
+	ip.Dst().SetValue(targetDst)
+	udp := fl.Packet().Add().Udp()
+	udp.SrcPort().SetValue(50000)
+	udp.DstPort().SetValue(50000)
+	fl.Size().SetFixed(frameSize)
+	fl.Rate().SetPps(ppsRate)
+	fl.Duration().FixedPackets().SetPackets(packets)
+}
+
+// verifyFlow sends f, verifies that it is received without loss with the
+// label stack of the transit LSP, and returns the number of frames sent and
+// the number of frames received on each ECMP member.
+func verifyFlow(t *testing.T, dut *ondatra.DUTDevice, ate *ondatra.ATEDevice, top gosnappi.Config, f flow) (uint64, map[string]uint64) {
+	t.Helper()
+	dstMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port1").Name()).Ethernet().MacAddress().State())
+	addFlow(t, ate, top, f, dstMAC)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	awaitAdjacency(t, dut)
+
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+	otgutils.StopCapture(t, ate.OTG())
+	time.Sleep(10 * time.Second)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+	otgutils.LogPortMetrics(t, ate.OTG(), top)
+
+	counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.name).Counters().State())
+	sent := counters.GetOutPkts()
+	if sent == 0 || counters.GetInPkts() != sent {
+		t.Errorf("Flow %s: got %d packets received of %d sent, want no loss", f.name, counters.GetInPkts(), sent)
+	}
+
+	received := map[string]uint64{}
+	for _, port := range members {
+		received[port] = gnmi.Get(t, ate.OTG(), gnmi.OTG().Port(ate.Port(t, port).ID()).Counters().InFrames().State())
+
+		// good and bad count the captured packets of the flow with and
+		// without the label stack of the transit LSP.
+		var good, bad int
+		for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, port).ID()) {
+			ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+			if !ok || ip.SrcIP.String() != ate1.IPv4 || p.Layer(layers.LayerTypeUDP) == nil {
+				continue
+			}
+			var labels []uint32
+			for _, l := range p.Layers() {
+				if m, ok := l.(*layers.MPLS); ok {
+					labels = append(labels, m.Label)
+				}
+			}
+			if len(labels) != 3 || labels[0] != swapLabel || labels[1] != eli || labels[2] < f.entropy || labels[2] >= f.entropy+f.count {
+				if bad == 0 {
+					t.Errorf("Flow %s: got packet with labels %v on %s, want [%d %d <entropy label>]", f.name, labels, port, swapLabel, eli)
+				}
+				bad++
+				continue
+			}
+			good++
+		}
+		t.Logf("Flow %s: captured %d packets with the expected labels and %d not on %s", f.name, good, bad, port)
+	}
+	return sent, received
+}
+
+func TestEntropyLabel(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+
+	ate := ondatra.ATE(t, "ate")
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	awaitAdjacency(t, dut)
+	time.Sleep(lspWait)
+	otgutils.StopCapture(t, ate.OTG())
+
+	t.Run("Capability", func(t *testing.T) {
+		adv, err := parseLSPs(otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port1").ID()))
+		if err != nil {
+			t.Fatalf("Cannot parse the LSPs of the DUT: %v", err)
+		}
+		t.Logf("Entropy label capability of the DUT: %+v", adv)
+		if adv.erld < minERLD {
+			t.Errorf("ERLD-MSD: got %d, want at least %d", adv.erld, minERLD)
+		}
+		if !adv.elc[dutLoopback.IPv4CIDR()] {
+			t.Errorf("Prefix %s is advertised without the ELC flag", dutLoopback.IPv4CIDR())
+		}
+	})
+
+	programTransitLSP(t, dut)
+
+	t.Run("DistinctEntropyLabels", func(t *testing.T) {
+		sent, received := verifyFlow(t, dut, ate, top, flow{name: "distinct-entropy", entropy: entropyBase, count: entropyCount})
+		want := sent / uint64(len(members))
+		min, max := want-want*lbTolerancePct/100, want+want*lbTolerancePct/100
+		for _, port := range members {
+			if got := received[port]; got < min || got > max {
+				t.Errorf("Frames received on %s: got %d, want between %d and %d", port, got, min, max)
+			}
+		}
+	})
+
+	t.Run("FixedEntropyLabel", func(t *testing.T) {
+		sent, received := verifyFlow(t, dut, ate, top, flow{name: "fixed-entropy", entropy: entropyBase, count: 1})
+		var used []string
+		for _, port := range members {
+			if received[port] > sent*idlePct/100 {
+				used = append(used, port)
+			}
+		}
+		if len(used) != 1 {
+			t.Errorf("ECMP members receiving the flow: got %v, want exactly one", used)
+		}
+	})
+}
@@ -0,0 +1,693 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package l3vpn_test
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1 and ate:port3 -> dut:port3,
+// the CEs of the VRFs with the same overlapping addresses, and
+// dut:port2 -> ate:port2, the MPLS core.
+//
+// ate:port2 emulates a route reflector of AS asn, with which the DUT runs iBGP
+// with the VPNv4 and VPNv6 address families. The route reflector reflects the
+// routes of a remote PE, directly connected as ate:port2, advertising the same
+// remotePrefix in both VRFs with different labels. The OTG does not originate
+// VPN routes, so these are replayed as raw UPDATE messages, and the labels
+// allocated by the DUT are learned from its UPDATE messages captured on
+// ate:port2.
+const (
+	plenIPv4 = 30
+	plenIPv6 = 126
+
+	asn     = 65000
+	bgpName = "BGP"
+
+	// clusterID is the cluster ID of the route reflector, and originatorID
+	// the router ID of the remote PE.
+	clusterID    = "198.18.0.1"
+	originatorID = "198.18.0.2"
+
+	remotePrefixV4 = "198.51.100.0/24"
+	remoteDstV4    = "198.51.100.1"
+	remotePrefixV6 = "2001:db8:100::/64"
+	remoteDstV6    = "2001:db8:100::1"
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	captureName = "l3vpn"
+	// advertisementWait is the time allowed for the DUT to advertise the
+	// routes of the VRFs.
+	advertisementWait = 30 * time.Second
+)
+
+// vrf is a VRF of the DUT with its CE port and the labels of remotePrefixV4
+// and remotePrefixV6 advertised by the remote PE.
+type vrf struct {
+	name string
+	// id is the assigned number of the route distinguisher and of the route
+	// target of the VRF.
+	id     uint32
+	port   string
+	ce     attrs.Attributes
+	labels map[string]uint32
+}
+
+func (v vrf) rd() string {
+	return fmt.Sprintf("%d:%d", asn, v.id)
+}
+
+var (
+	dutLoopback = attrs.Attributes{
+		Desc:    "Router ID",
+		IPv4:    "203.0.113.1",
+		IPv4Len: 32,
+	}
+	// dutCE is the address of both CE ports of the DUT, in different VRFs.
+	dutCE = attrs.Attributes{
+		Desc:    "CE",
+		IPv4:    "192.0.2.1",
+		IPv6:    "2001:db8::1",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	ate1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv6:    "2001:db8::2",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dut2 = attrs.Attributes{
+		Desc:    "MPLS core",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plenIPv4,
+	}
+	ate2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plenIPv4,
+	}
+	ate3 = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv6:    "2001:db8::2",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+
+	vrfs = []vrf{{
+		name:   "VRF-A",
+		id:     1,
+		port:   "port1",
+		ce:     ate1,
+		labels: map[string]uint32{"IPv4": 100001, "IPv6": 100011},
+	}, {
+		name:   "VRF-B",
+		id:     2,
+		port:   "port3",
+		ce:     ate3,
+		labels: map[string]uint32{"IPv4": 100002, "IPv6": 100012},
+	}}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the VRFs with their CE ports, MPLS on the core
+// port, and iBGP with the route reflector.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	for _, v := range vrfs {
+		gnmi.Replace(t, dut, gnmi.OC().NetworkInstance(v.name).Config(), vrfConfig(dut, v))
+	}
+
+	lb := netutil.LoopbackInterface(t, dut, 0)
+	lo := dutLoopback.NewOCInterface(lb, dut)
+	lo.Type = oc.IETFInterfaces_InterfaceType_softwareLoopback
+	gnmi.Replace(t, dut, gnmi.OC().Interface(lb).Config(), lo)
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, lb, dni, 0)
+	}
+
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+		ni    string
+	}{
+		{"port1", dutCE, vrfs[0].name},
+		{"port2", dut2, dni},
+		{"port3", dutCE, vrfs[1].name},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if p.ni != dni || deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), p.ni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	core := dut.Port(t, "port2").Name()
+	ni := &oc.NetworkInstance{Name: ygot.String(dni)}
+	mpls := ni.GetOrCreateMpls().GetOrCreateGlobal().GetOrCreateInterface(core)
+	mpls.SetMplsEnabled(true)
+	mpls.GetOrCreateInterfaceRef().SetInterface(core)
+	bgp := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).GetOrCreateBgp()
+	bgp.GetOrCreateGlobal().SetAs(asn)
+	bgp.GetOrCreateGlobal().SetRouterId(dutLoopback.IPv4)
+	nbr := bgp.GetOrCreateNeighbor(ate2.IPv4)
+	nbr.SetPeerAs(asn)
+	nbr.SetEnabled(true)
+	for _, afiSafi := range []oc.E_BgpTypes_AFI_SAFI_TYPE{oc.BgpTypes_AFI_SAFI_TYPE_L3VPN_IPV4_UNICAST, oc.BgpTypes_AFI_SAFI_TYPE_L3VPN_IPV6_UNICAST} {
+		bgp.GetOrCreateGlobal().GetOrCreateAfiSafi(afiSafi).SetEnabled(true)
+		nbr.GetOrCreateAfiSafi(afiSafi).SetEnabled(true)
+	}
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(dni).Config(), ni)
+}
+
+// vrfConfig returns the configuration of v, importing and exporting the
+// route target of v and exporting its connected routes.
+func vrfConfig(dut *ondatra.DUTDevice, v vrf) *oc.NetworkInstance {
+	ni := &oc.NetworkInstance{Name: ygot.String(v.name)}
+	ni.SetType(oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_L3VRF)
+	ni.SetRouteDistinguisher(v.rd())
+	policy := ni.GetOrCreateInterInstancePolicies().GetOrCreateImportExportPolicy()
+	policy.SetImportRouteTarget([]oc.NetworkInstance_InterInstancePolicies_ImportExportPolicy_ImportRouteTarget_Union{oc.UnionString(v.rd())})
+	policy.SetExportRouteTarget([]oc.NetworkInstance_InterInstancePolicies_ImportExportPolicy_ExportRouteTarget_Union{oc.UnionString(v.rd())})
+
+	bgp := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).GetOrCreateBgp()
+	bgp.GetOrCreateGlobal().SetAs(asn)
+	bgp.GetOrCreateGlobal().SetRouterId(dutLoopback.IPv4)
+	for _, af := range []struct {
+		afiSafi oc.E_BgpTypes_AFI_SAFI_TYPE
+		family  oc.E_Types_ADDRESS_FAMILY
+	}{
+		{oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST, oc.Types_ADDRESS_FAMILY_IPV4},
+		{oc.BgpTypes_AFI_SAFI_TYPE_IPV6_UNICAST, oc.Types_ADDRESS_FAMILY_IPV6},
+	} {
+		bgp.GetOrCreateGlobal().GetOrCreateAfiSafi(af.afiSafi).SetEnabled(true)
+		tc := ni.GetOrCreateTableConnection(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_DIRECTLY_CONNECTED, oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, af.family)
+		tc.SetDefaultImportPolicy(oc.RoutingPolicy_DefaultPolicyType_ACCEPT_ROUTE)
+		if !deviations.SkipSettingDisableMetricPropagation(dut) {
+			tc.SetDisableMetricPropagation(false)
+		}
+	}
+	return ni
+}
+
+// configureATE configures the CEs of the VRFs and the route reflector
+// replaying the VPN routes of the remote PE.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	var ports []string
+	for _, v := range vrfs {
+		ports = append(ports, ate.Port(t, v.port).ID())
+		v.ce.AddToOTG(top, ate.Port(t, v.port), &dutCE)
+	}
+	ports = append(ports, ate.Port(t, "port2").ID())
+	dev := ate2.AddToOTG(top, ate.Port(t, "port2"), &dut2)
+	v4 := dev.Ethernets().Items()[0].Ipv4Addresses().Items()[0]
+	peer := dev.Bgp().SetRouterId(clusterID).Ipv4Interfaces().Add().SetIpv4Name(v4.Name()).Peers().Add().SetName(ate2.Name + ".BGP4.peer")
+	peer.SetPeerAddress(dut2.IPv4).SetAsNumber(asn).SetAsType(gosnappi.BgpV4PeerAsType.IBGP)
+	peer.Capability().SetIpv4MplsVpn(true).SetIpv6MplsVpn(true)
+	updates := peer.ReplayUpdates().RawBytes().Updates()
+	for _, v := range vrfs {
+		updates.Add().SetTimeGap(1000).SetUpdateBytes(vpnUpdate(remotePrefixV4, v, v.labels["IPv4"]))
+		updates.Add().SetTimeGap(1000).SetUpdateBytes(vpnUpdate(remotePrefixV6, v, v.labels["IPv6"]))
+	}
+	top.Captures().Add().SetName(captureName).SetPortNames(ports).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// BGP message and path attribute codes of RFC 4271, RFC 4456, RFC 4360 and
+// RFC 4760.
+const (
+	bgpHeader    = 19
+	bgpUpdate    = 2
+	attrOrigin   = 1
+	attrASPath   = 2
+	attrLocPref  = 5
+	attrOrigID   = 9
+	attrCluster  = 10
+	attrMPReach  = 14
+	attrExtComm  = 16
+	flagOptional = 0x80
+	flagTransit  = 0x40
+	flagExtended = 0x10
+	afiIPv4      = 1
+	afiIPv6      = 2
+	safiVPN      = 128
+)
+
+// pathAttr returns the path attribute typ with the value v.
+func pathAttr(flags, typ byte, v []byte) []byte {
+	if len(v) > 255 {
+		b := []byte{flags | flagExtended, typ, 0, 0}
+		binary.BigEndian.PutUint16(b[2:], uint16(len(v)))
+		return append(b, v...)
+	}
+	return append([]byte{flags, typ, byte(len(v))}, v...)
+}
+
+// vpnUpdate returns the body, after the header, of the UPDATE message with
+// the route of prefix in v with label, reflected from the remote PE, as a hex
+// string.
+func vpnUpdate(prefix string, v vrf, label uint32) string {
+	_, ipNet, _ := net.ParseCIDR(prefix)
+	plen, _ := ipNet.Mask.Size()
+
+	// The next hop is the remote PE with a zero route distinguisher, as an
+	// IPv4-mapped IPv6 address for VPNv6 (RFC 4659).
+	afi, nh := uint16(afiIPv4), net.ParseIP(ate2.IPv4).To4()
+	if ipNet.IP.To4() == nil {
+		afi, nh = afiIPv6, net.ParseIP(ate2.IPv4).To16()
+	}
+	mpReach := binary.BigEndian.AppendUint16(nil, afi)
+	mpReach = append(mpReach, safiVPN, byte(8+len(nh)))
+	mpReach = append(mpReach, make([]byte, 8)...)
+	mpReach = append(mpReach, nh...)
+	mpReach = append(mpReach, 0)
+	// The NLRI is the label with the bottom of stack bit, the type 0 route
+	// distinguisher and the prefix.
+	mpReach = append(mpReach, byte(24+64+plen), byte(label>>12), byte(label>>4), byte(label<<4)|1)
+	mpReach = binary.BigEndian.AppendUint16(mpReach, 0)
+	mpReach = binary.BigEndian.AppendUint16(mpReach, asn)
+	mpReach = binary.BigEndian.AppendUint32(mpReach, v.id)
+	mpReach = append(mpReach, ipNet.IP[:(plen+7)/8]...)
+
+	// The route target is a two-octet AS specific extended community.
+	rt := []byte{0x00, 0x02}
+	rt = binary.BigEndian.AppendUint16(rt, asn)
+	rt = binary.BigEndian.AppendUint32(rt, v.id)
+
+	var attrs []byte
+	attrs = append(attrs, pathAttr(flagTransit, attrOrigin, []byte{0})...)
+	attrs = append(attrs, pathAttr(flagTransit, attrASPath, nil)...)
+	attrs = append(attrs, pathAttr(flagTransit, attrLocPref, binary.BigEndian.AppendUint32(nil, 100))...)
+	attrs = append(attrs, pathAttr(flagOptional, attrOrigID, net.ParseIP(originatorID).To4())...)
+	attrs = append(attrs, pathAttr(flagOptional, attrCluster, net.ParseIP(clusterID).To4())...)
+	attrs = append(attrs, pathAttr(flagOptional|flagTransit, attrExtComm, rt)...)
+	attrs = append(attrs, pathAttr(flagOptional|flagExtended, attrMPReach, mpReach)...)
+
+	b := binary.BigEndian.AppendUint16(nil, 0)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(attrs)))
+	return hex.EncodeToString(append(b, attrs...))
+}
+
+// awaitBGP waits for the BGP session of the DUT with the route reflector to
+// be established.
+func awaitBGP(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).Bgp().Neighbor(ate2.IPv4).SessionState().State()
+	_, ok := gnmi.Watch(t, dut, q, 2*time.Minute, func(v *ygnmi.Value[oc.E_Bgp_Neighbor_SessionState]) bool {
+		state, present := v.Val()
+		return present && state == oc.Bgp_Neighbor_SessionState_ESTABLISHED
+	}).Await(t)
+	if !ok {
+		t.Fatalf("BGP session with %s is not established", ate2.IPv4)
+	}
+}
+
+// pushedLabels returns the labels pushed by the next hops of prefix of the
+// address family af in the AFT of the network instance ni.
+func pushedLabels(t *testing.T, dut *ondatra.DUTDevice, ni, af, prefix string) ([]uint32, bool) {
+	t.Helper()
+	afts := gnmi.OC().NetworkInstance(ni).Afts()
+	var nhgID uint64
+	if af == "IPv4" {
+		entry, ok := gnmi.Lookup(t, dut, afts.Ipv4Entry(prefix).State()).Val()
+		if !ok {
+			return nil, false
+		}
+		nhgID = entry.GetNextHopGroup()
+	} else {
+		entry, ok := gnmi.Lookup(t, dut, afts.Ipv6Entry(prefix).State()).Val()
+		if !ok {
+			return nil, false
+		}
+		nhgID = entry.GetNextHopGroup()
+	}
+	nhg, ok := gnmi.Lookup(t, dut, afts.NextHopGroup(nhgID).State()).Val()
+	if !ok {
+		return nil, false
+	}
+	var labels []uint32
+	for idx := range nhg.NextHop {
+		nh, ok := gnmi.Lookup(t, dut, afts.NextHop(idx).State()).Val()
+		if !ok {
+			return nil, false
+		}
+		for _, l := range nh.GetPushedMplsLabelStack() {
+			if u, ok := l.(oc.UnionUint32); ok {
+				labels = append(labels, uint32(u))
+			}
+		}
+	}
+	return labels, true
+}
+
+// awaitLabel waits for the AFT entry of prefix in v to push the label of
+// the address family af advertised by the remote PE.
+func awaitLabel(t *testing.T, dut *ondatra.DUTDevice, v vrf, af, prefix string) {
+	t.Helper()
+	want := v.labels[af]
+	var got []uint32
+	for deadline := time.Now().Add(2 * time.Minute); time.Now().Before(deadline); time.Sleep(5 * time.Second) {
+		var ok bool
+		if got, ok = pushedLabels(t, dut, v.name, af, prefix); ok && len(got) == 1 && got[0] == want {
+			t.Logf("AFT entry of %s in %s pushes label %d", prefix, v.name, want)
+			return
+		}
+	}
+	t.Errorf("AFT entry of %s in %s: got pushed labels %v, want [%d]", prefix, v.name, got, want)
+}
+
+// vpnRoute identifies a VPN route by its route distinguisher and prefix.
+type vpnRoute struct {
+	rd     string
+	prefix string
+}
+
+// parseUpdates returns the labels of the VPN routes advertised by the DUT in
+// pkts.
+func parseUpdates(pkts []gopacket.Packet) (map[vpnRoute]uint32, error) {
+	// segments are the TCP payloads sent by the DUT, by sequence number.
+	segments := map[uint32][]byte{}
+	for _, p := range pkts {
+		ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok || !ip.SrcIP.Equal(net.ParseIP(dut2.IPv4)) {
+			continue
+		}
+		tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		if !ok || (tcp.SrcPort != 179 && tcp.DstPort != 179) || len(tcp.Payload) == 0 {
+			continue
+		}
+		segments[tcp.Seq] = tcp.Payload
+	}
+	var seqs []uint32
+	for seq := range segments {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	var stream []byte
+	for _, seq := range seqs {
+		stream = append(stream, segments[seq]...)
+	}
+
+	labels := map[vpnRoute]uint32{}
+	for len(stream) >= bgpHeader {
+		n := int(binary.BigEndian.Uint16(stream[16:18]))
+		if n < bgpHeader || len(stream) < n {
+			break
+		}
+		if stream[18] == bgpUpdate {
+			if err := parseUpdate(stream[bgpHeader:n], labels); err != nil {
+				return nil, err
+			}
+		}
+		stream = stream[n:]
+	}
+	return labels, nil
+}
+
+// parseUpdate adds to labels the labels of the VPN routes of the UPDATE
+// message b.
+func parseUpdate(b []byte, labels map[vpnRoute]uint32) error {
+	if len(b) < 2 {
+		return fmt.Errorf("truncated UPDATE")
+	}
+	b = b[2+int(binary.BigEndian.Uint16(b)):]
+	if len(b) < 2 {
+		return fmt.Errorf("truncated UPDATE")
+	}
+	attrs := b[2 : 2+int(binary.BigEndian.Uint16(b))]
+	for len(attrs) >= 3 {
+		flags, typ := attrs[0], attrs[1]
+		hdr, n := 3, int(attrs[2])
+		if flags&flagExtended != 0 {
+			hdr, n = 4, int(binary.BigEndian.Uint16(attrs[2:4]))
+		}
+		if len(attrs) < hdr+n {
+			return fmt.Errorf("truncated attribute %d", typ)
+		}
+		v := attrs[hdr : hdr+n]
+		attrs = attrs[hdr+n:]
+		if typ != attrMPReach || len(v) < 4 || v[2] != safiVPN || len(v) < 5+int(v[3]) {
+			continue
+		}
+		size := net.IPv4len
+		if binary.BigEndian.Uint16(v) == afiIPv6 {
+			size = net.IPv6len
+		}
+		// Each NLRI is its length in bits, one label, the route
+		// distinguisher and the prefix.
+		for nlri := v[5+int(v[3]):]; len(nlri) > 0; {
+			bits := int(nlri[0])
+			n := (bits + 7) / 8
+			if bits < 88 || len(nlri) < 1+n || bits-88 > 8*size {
+				return fmt.Errorf("malformed VPN NLRI")
+			}
+			label := uint32(nlri[1])<<12 | uint32(nlri[2])<<4 | uint32(nlri[3])>>4
+			rd := fmt.Sprintf("%d:%d", binary.BigEndian.Uint16(nlri[6:8]), binary.BigEndian.Uint32(nlri[8:12]))
+			ip := make(net.IP, size)
+			copy(ip, nlri[12:1+n])
+			prefix := &net.IPNet{IP: ip, Mask: net.CIDRMask(bits-88, 8*size)}
+			labels[vpnRoute{rd: rd, prefix: prefix.String()}] = label
+			nlri = nlri[1+n:]
+		}
+	}
+	return nil
+}
+
+// flow is a flow between a CE and the remote PE.
+type flow struct {
+	name   string
+	af     string
+	tx     string
+	rx     string
+	srcMAC string
+	src    string
+	dst    string
+	// labels are the labels of the flows sent by the remote PE.
+	labels []uint32
+	check  func(p gopacket.Packet) error
+}
+
+// addFlow replaces the flows of top with f, sent to dstMAC, the MAC address
+// of the DUT port of the flow.
+func addFlow(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config, f flow, dstMAC string) {
+	t.Helper()
+	top.Flows().Clear()
+	fl := top.Flows().Add().SetName(f.name)
+	fl.Metrics().SetEnable(true)
+	fl.TxRx().Port().SetTxName(ate.Port(t, f.tx).ID()).SetRxNames([]string{ate.Port(t, f.rx).ID()})
+	eth := fl.Packet().Add().Ethernet()
+	eth.Src().SetValue(f.srcMAC)
+	eth.Dst().SetValue(dstMAC)
+	for _, l := range f.labels {
+		fl.Packet().Add().Mpls().Label().SetValue(l)
+	}
+	if f.af == "IPv6" {
+		ip := fl.Packet().Add().Ipv6()
+		ip.Src().SetValue(f.src)
+		ip.Dst().SetValue(f.dst)
+	} else {
+		ip := fl.Packet().Add().Ipv4()
+		ip.Src().SetValue(f.src)
+		ip.Dst().SetValue(f.dst)
+	}
+	fl.Packet().Add().Udp()
+	fl.Size().SetFixed(frameSize)
+	fl.Rate().SetPps(ppsRate)
+	fl.Duration().FixedPackets().SetPackets(packets)
+}
+
+// verifyFlow sends f and verifies that it is received without loss and that
+// the received packets pass f.check.
+func verifyFlow(t *testing.T, dut *ondatra.DUTDevice, ate *ondatra.ATEDevice, top gosnappi.Config, f flow) {
+	t.Helper()
+	dstMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, f.tx).Name()).Ethernet().MacAddress().State())
+	addFlow(t, ate, top, f, dstMAC)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+	awaitBGP(t, dut)
+
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+	otgutils.StopCapture(t, ate.OTG())
+	time.Sleep(10 * time.Second)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+	counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.name).Counters().State())
+	if sent := counters.GetOutPkts(); sent == 0 || counters.GetInPkts() != sent {
+		t.Errorf("Flow %s: got %d packets received on %s of %d sent, want no loss", f.name, counters.GetInPkts(), f.rx, sent)
+	}
+
+	var good, bad int
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, f.rx).ID()) {
+		if p.Layer(layers.LayerTypeUDP) == nil {
+			continue
+		}
+		if err := f.check(p); err != nil {
+			if bad == 0 {
+				t.Errorf("Flow %s: %v", f.name, err)
+			}
+			bad++
+			continue
+		}
+		good++
+	}
+	t.Logf("Flow %s: captured %d packets forwarded as expected and %d not", f.name, good, bad)
+	if good == 0 {
+		t.Errorf("Flow %s: got no packets forwarded as expected", f.name)
+	}
+	if bad != 0 {
+		t.Errorf("Flow %s: got %d packets not forwarded as expected", f.name, bad)
+	}
+}
+
+// checkPacket returns a check of the packets with the label stack labels and
+// the destination address dst.
+func checkPacket(labels []uint32, dst string) func(gopacket.Packet) error {
+	return func(p gopacket.Packet) error {
+		var got []uint32
+		var ip net.IP
+		for _, l := range p.Layers() {
+			switch l := l.(type) {
+			case *layers.MPLS:
+				got = append(got, l.Label)
+			case *layers.IPv4:
+				ip = l.DstIP
+			case *layers.IPv6:
+				ip = l.DstIP
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(labels) {
+			return fmt.Errorf("got label stack %v, want %v", got, labels)
+		}
+		if !ip.Equal(net.ParseIP(dst)) {
+			return fmt.Errorf("got destination address %s, want %s", ip, dst)
+		}
+		return nil
+	}
+}
+
+func TestL3VPN(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+
+	ate := ondatra.ATE(t, "ate")
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+	awaitBGP(t, dut)
+	time.Sleep(advertisementWait)
+	otgutils.StopCapture(t, ate.OTG())
+	dutLabels, err := parseUpdates(otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port2").ID()))
+	if err != nil {
+		t.Fatalf("Cannot parse the UPDATE messages of the DUT: %v", err)
+	}
+	t.Logf("Labels of the VPN routes advertised by the DUT: %v", dutLabels)
+
+	prefixes := map[string]string{
+		"IPv4": dutCE.IPv4CIDR(),
+		"IPv6": dutCE.IPv6CIDR(),
+	}
+	remotePrefixes := map[string]string{
+		"IPv4": remotePrefixV4,
+		"IPv6": remotePrefixV6,
+	}
+	remoteDsts := map[string]string{
+		"IPv4": remoteDstV4,
+		"IPv6": remoteDstV6,
+	}
+
+	for _, v := range vrfs {
+		for _, af := range []string{"IPv4", "IPv6"} {
+			t.Run(fmt.Sprintf("%s/%s", v.name, af), func(t *testing.T) {
+				_, ipNet, _ := net.ParseCIDR(prefixes[af])
+				label, ok := dutLabels[vpnRoute{rd: v.rd(), prefix: ipNet.String()}]
+				if !ok {
+					t.Fatalf("DUT did not advertise %s with route distinguisher %s", ipNet, v.rd())
+				}
+				awaitLabel(t, dut, v, af, remotePrefixes[af])
+
+				ce := v.ce.IPv4
+				if af == "IPv6" {
+					ce = v.ce.IPv6
+				}
+				verifyFlow(t, dut, ate, top, flow{
+					name:   v.name + "-" + af + "-encap",
+					af:     af,
+					tx:     v.port,
+					rx:     "port2",
+					srcMAC: v.ce.MAC,
+					src:    ce,
+					dst:    remoteDsts[af],
+					check:  checkPacket([]uint32{v.labels[af]}, remoteDsts[af]),
+				})
+				verifyFlow(t, dut, ate, top, flow{
+					name:   v.name + "-" + af + "-decap",
+					af:     af,
+					tx:     "port2",
+					rx:     v.port,
+					srcMAC: ate2.MAC,
+					src:    remoteDsts[af],
+					dst:    ce,
+					labels: []uint32{label},
+					check:  checkPacket(nil, ce),
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package static_lsp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, dut:port2 -> ate:port2,
+// the next hop of the swap and pop LSPs, and dut:port3 -> ate:port3, the
+// next hop of egressPrefix.
+//
+// The MPLS flows are sent from ate:port1 with one label. The DUT swaps
+// swapInLabel to swapOutLabel, pops popLabel, and pops bindingLabel, the
+// label bound to egressPrefix, forwarding the packets to its next hop.
+const (
+	plen = 30
+
+	swapInLabel  = 100001
+	swapOutLabel = 200001
+	popLabel     = 100002
+	bindingLabel = 100003
+
+	egressPrefix = "198.51.100.0/24"
+	egressDst    = "198.51.100.1"
+
+	// ttl is the TTL of the label of the MPLS flows.
+	ttl = 64
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	captureName = "port2-3-capture"
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dutSrc = attrs.Attributes{
+		Desc:    "MPLS input",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dutDst = attrs.Attributes{
+		Desc:    "Swap and pop output",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	dutEgress = attrs.Attributes{
+		Desc:    "Egress prefix output",
+		IPv4:    "192.0.2.9",
+		IPv4Len: plen,
+	}
+	ateEgress = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the DUT interfaces, the static route to
+// egressPrefix and the static LSPs.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	var ports []*ondatra.Port
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dutSrc},
+		{"port2", dutDst},
+		{"port3", dutEgress},
+	} {
+		dp := dut.Port(t, p.port)
+		ports = append(ports, dp)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	b := &gnmi.SetBatch{}
+	cfg := &cfgplugins.StaticRouteCfg{
+		NetworkInstance: deviations.DefaultNetworkInstance(dut),
+		Prefix:          egressPrefix,
+		NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+			"0": oc.UnionString(ateEgress.IPv4),
+		},
+	}
+	if _, err := cfgplugins.NewStaticRouteCfg(b, cfg, dut); err != nil {
+		t.Fatalf("Failed to configure the static route to %s: %v", egressPrefix, err)
+	}
+	b.Set(t, dut)
+
+	configureStaticLSPs(t, dut, ports...)
+}
+
+// configureStaticLSPs enables MPLS on ports and configures the swap LSP, and
+// the pop LSPs of popLabel to ate:port2 and of bindingLabel to the next hop
+// of egressPrefix.
+func configureStaticLSPs(t *testing.T, dut *ondatra.DUTDevice, ports ...*ondatra.Port) {
+	t.Helper()
+	mpls := &oc.NetworkInstance_Mpls{}
+	for _, p := range ports {
+		intf := mpls.GetOrCreateGlobal().GetOrCreateInterface(p.Name())
+		intf.SetMplsEnabled(true)
+		intf.GetOrCreateInterfaceRef().SetInterface(p.Name())
+	}
+	lsps := mpls.GetOrCreateLsps()
+	transit := lsps.GetOrCreateStaticLsp("swap").GetOrCreateTransit()
+	transit.SetIncomingLabel(oc.UnionUint32(swapInLabel))
+	transit.SetPushLabel(oc.UnionUint32(swapOutLabel))
+	transit.SetNextHop(ateDst.IPv4)
+
+	pop := lsps.GetOrCreateStaticLsp("pop").GetOrCreateEgress()
+	pop.SetIncomingLabel(oc.UnionUint32(popLabel))
+	pop.SetPushLabel(oc.Egress_PushLabel_IMPLICIT_NULL)
+	pop.SetNextHop(ateDst.IPv4)
+
+	binding := lsps.GetOrCreateStaticLsp("egress-prefix").GetOrCreateEgress()
+	binding.SetIncomingLabel(oc.UnionUint32(bindingLabel))
+	binding.SetPushLabel(oc.Egress_PushLabel_IMPLICIT_NULL)
+	binding.SetNextHop(ateEgress.IPv4)
+
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Mpls().Config(), mpls)
+}
+
+// lsp is a static LSP of the DUT, and the flow sent to it.
+type lsp struct {
+	name  string
+	label uint32
+	dst   string
+	rx    string
+	// outLabel is the label of the packets received on rx, or 0 if they
+	// are received without a label.
+	outLabel uint32
+}
+
+var lsps = []lsp{
+	{name: "swap", label: swapInLabel, dst: ateDst.IPv4, rx: "port2", outLabel: swapOutLabel},
+	{name: "pop", label: popLabel, dst: ateDst.IPv4, rx: "port2"},
+	{name: "egress-prefix", label: bindingLabel, dst: egressDst, rx: "port3"},
+}
+
+// addFlow replaces the flows of top with a flow of packets with the label
+// of l, sent to dstMAC, the MAC address of dut:port1.
+func addFlow(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config, l lsp, dstMAC string) {
+	t.Helper()
+	top.Flows().Clear()
+	flow := top.Flows().Add().SetName(l.name)
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Port().SetTxName(ate.Port(t, "port1").ID()).SetRxNames([]string{ate.Port(t, l.rx).ID()})
+	eth := flow.Packet().Add().Ethernet()
+	eth.Src().SetValue(ateSrc.MAC)
+	eth.Dst().SetValue(dstMAC)
+	label := flow.Packet().Add().Mpls()
+	label.Label().SetValue(l.label)
+	label.TimeToLive().SetValue(ttl)
+	label.BottomOfStack().SetValue(1)
+	ip := flow.Packet().Add().Ipv4()
+	ip.Src().SetValue(ateSrc.IPv4)
+	ip.Dst().SetValue(l.dst)
+	flow.Packet().Add().Udp().DstPort().SetValue(50000)
+	flow.Size().SetFixed(frameSize)
+	flow.Rate().SetPps(ppsRate)
+	flow.Duration().FixedPackets().SetPackets(packets)
+}
+
+// captureResult is the result of the capture of the packets of a flow.
+type captureResult struct {
+	// labeled counts the MPLS packets by label and TTL.
+	labeled map[[2]uint32]int
+	// unlabeled is the number of IPv4 packets without a label.
+	unlabeled int
+}
+
+// readCapture reads the packets of the flows captured on port of the ATE.
+func readCapture(t *testing.T, ate *ondatra.ATEDevice, port string) captureResult {
+	t.Helper()
+	res := captureResult{labeled: map[[2]uint32]int{}}
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, port).ID()) {
+		ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok || ip.SrcIP.String() != ateSrc.IPv4 || p.Layer(layers.LayerTypeUDP) == nil {
+			continue
+		}
+		if label, ok := p.Layer(layers.LayerTypeMPLS).(*layers.MPLS); ok {
+			res.labeled[[2]uint32{label.Label, uint32(label.TTL)}]++
+		} else {
+			res.unlabeled++
+		}
+	}
+	return res
+}
+
+// packetsForwarded returns the number of packets forwarded by the label
+// entry of label in the AFT, and whether it is reported.
+func packetsForwarded(t *testing.T, dut *ondatra.DUTDevice, label uint32) (uint64, bool) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Afts().LabelEntry(oc.UnionUint32(label)).State()
+	e, ok := gnmi.Lookup(t, dut, q).Val()
+	if !ok || e.GetCounters().PacketsForwarded == nil {
+		return 0, false
+	}
+	return e.GetCounters().GetPacketsForwarded(), true
+}
+
+func TestStaticLSP(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+	dstMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port1").Name()).Ethernet().MacAddress().State())
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutSrc)
+	ateDst.AddToOTG(top, ate.Port(t, "port2"), &dutDst)
+	ateEgress.AddToOTG(top, ate.Port(t, "port3"), &dutEgress)
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{ate.Port(t, "port2").ID(), ate.Port(t, "port3").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+
+	for _, l := range lsps {
+		t.Run(l.name, func(t *testing.T) {
+			addFlow(t, ate, top, l, dstMAC)
+			ate.OTG().PushConfig(t, top)
+			ate.OTG().StartProtocols(t)
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+			before, _ := packetsForwarded(t, dut, l.label)
+			otgutils.StartCapture(t, ate.OTG())
+			ate.OTG().StartTraffic(t)
+			time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+			ate.OTG().StopTraffic(t)
+			otgutils.StopCapture(t, ate.OTG())
+			time.Sleep(10 * time.Second)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+			counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(l.name).Counters().State())
+			sent := counters.GetOutPkts()
+			if sent == 0 || counters.GetInPkts() != sent {
+				t.Errorf("Flow %s: got %d packets received on %s of %d sent, want no loss", l.name, counters.GetInPkts(), l.rx, sent)
+			}
+
+			after, ok := packetsForwarded(t, dut, l.label)
+			if !ok {
+				t.Errorf("Label entry %d: packets-forwarded is not reported", l.label)
+			} else if got := after - before; got < sent {
+				t.Errorf("Label entry %d: got %d packets forwarded, want at least %d", l.label, got, sent)
+			}
+
+			res := readCapture(t, ate, l.rx)
+			t.Logf("Flow %s: captured labeled packets by label and TTL: %v, unlabeled packets: %d", l.name, res.labeled, res.unlabeled)
+			if l.outLabel == 0 {
+				if res.unlabeled == 0 {
+					t.Errorf("Flow %s: got no unlabeled packets", l.name)
+				}
+				for k, n := range res.labeled {
+					t.Errorf("Flow %s: got %d packets with label %d, want no label", l.name, n, k[0])
+				}
+				return
+			}
+			want := [2]uint32{l.outLabel, ttl - 1}
+			if res.labeled[want] == 0 {
+				t.Errorf("Flow %s: got no packets with label %d and TTL %d", l.name, want[0], want[1])
+			}
+			if res.unlabeled != 0 {
+				t.Errorf("Flow %s: got %d unlabeled packets, want label %d", l.name, res.unlabeled, want[0])
+			}
+			for k, n := range res.labeled {
+				if k != want {
+					t.Errorf("Flow %s: got %d packets with label %d and TTL %d, want label %d and TTL %d", l.name, n, k[0], k[1], want[0], want[1])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldp_base_test
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+var convergenceTimeout = flag.Duration("convergence_timeout", time.Minute, "maximum time for the LDP session and the label entries to converge")
+
+// The testbed consists of dut1:port1 -> dut2:port1 and dut1:port2 ->
+// dut2:port2. The DUTs run IS-IS and LDP over both links, with their
+// loopback addresses as the LSR IDs. The OTG does not emulate LDP, so dut2 is
+// the LDP peer of dut1.
+const (
+	plen = 30
+
+	isisName    = "DEFAULT"
+	areaAddress = "49.0001"
+	// ldpLabelSpace is the label space ID of the platform-wide label space.
+	ldpLabelSpace = 0
+)
+
+// dut is the configuration of one of the DUTs.
+type dut struct {
+	id       string
+	sysID    string
+	loopback attrs.Attributes
+	links    []attrs.Attributes
+}
+
+var (
+	dut1 = dut{
+		id:       "dut1",
+		sysID:    "1920.0000.2001",
+		loopback: attrs.Attributes{Desc: "LSR ID", IPv4: "203.0.113.1", IPv4Len: 32},
+		links: []attrs.Attributes{
+			{Desc: "Link 1 to dut2", IPv4: "192.0.2.1", IPv4Len: plen},
+			{Desc: "Link 2 to dut2", IPv4: "192.0.2.5", IPv4Len: plen},
+		},
+	}
+	dut2 = dut{
+		id:       "dut2",
+		sysID:    "1920.0000.2002",
+		loopback: attrs.Attributes{Desc: "LSR ID", IPv4: "203.0.113.2", IPv4Len: 32},
+		links: []attrs.Attributes{
+			{Desc: "Link 1 to dut1", IPv4: "192.0.2.2", IPv4Len: plen},
+			{Desc: "Link 2 to dut1", IPv4: "192.0.2.6", IPv4Len: plen},
+		},
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// linkPorts are the ports of the links, in the order of dut.links.
+var linkPorts = []string{"port1", "port2"}
+
+// configureDUT configures the interfaces, IS-IS and LDP of d on dev.
+func configureDUT(t *testing.T, dev *ondatra.DUTDevice, d dut) {
+	t.Helper()
+	lb := netutil.LoopbackInterface(t, dev, 0)
+	lo := d.loopback.NewOCInterface(lb, dev)
+	lo.Type = oc.IETFInterfaces_InterfaceType_softwareLoopback
+	gnmi.Replace(t, dev, gnmi.OC().Interface(lb).Config(), lo)
+	if deviations.ExplicitInterfaceInDefaultVRF(dev) {
+		fptest.AssignToNetworkInstance(t, dev, lb, deviations.DefaultNetworkInstance(dev), 0)
+	}
+
+	var links []string
+	for i, port := range linkPorts {
+		dp := dev.Port(t, port)
+		links = append(links, dp.Name())
+		gnmi.Replace(t, dev, gnmi.OC().Interface(dp.Name()).Config(), d.links[i].NewOCInterface(dp.Name(), dev))
+		if deviations.ExplicitInterfaceInDefaultVRF(dev) {
+			fptest.AssignToNetworkInstance(t, dev, dp.Name(), deviations.DefaultNetworkInstance(dev), 0)
+		}
+		if deviations.ExplicitPortSpeed(dev) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	ni := &oc.NetworkInstance{Name: ygot.String(deviations.DefaultNetworkInstance(dev))}
+	addISIS(dev, ni, d.sysID, lb, links)
+	addLDP(ni, d.loopback.IPv4, links)
+	gnmi.Update(t, dev, gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dev)).Config(), ni)
+}
+
+// addISIS adds to ni the level 2 IS-IS instance over the links, advertising
+// the loopback lb passively.
+func addISIS(dev *ondatra.DUTDevice, ni *oc.NetworkInstance, sysID, lb string, links []string) {
+	prot := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_ISIS, isisName)
+	prot.SetEnabled(true)
+	isis := prot.GetOrCreateIsis()
+	glob := isis.GetOrCreateGlobal()
+	if deviations.ISISInstanceEnabledRequired(dev) {
+		glob.SetInstance(isisName)
+	}
+	glob.SetNet([]string{fmt.Sprintf("%s.%s.00", areaAddress, sysID)})
+	glob.SetLevelCapability(oc.Isis_LevelType_LEVEL_2)
+	glob.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+	level := isis.GetOrCreateLevel(2)
+	level.SetMetricStyle(oc.Isis_MetricStyle_WIDE_METRIC)
+	if deviations.ISISLevelEnabled(dev) {
+		level.SetEnabled(true)
+	}
+	for _, name := range append([]string{lb}, links...) {
+		intf := isis.GetOrCreateInterface(name)
+		intf.SetEnabled(true)
+		if name == lb {
+			intf.SetPassive(true)
+		} else {
+			intf.SetCircuitType(oc.Isis_CircuitType_POINT_TO_POINT)
+		}
+		if deviations.ISISInterfaceLevel1DisableRequired(dev) {
+			intf.GetOrCreateLevel(1).SetEnabled(false)
+		} else {
+			intf.GetOrCreateLevel(2).SetEnabled(true)
+		}
+		if !deviations.ISISInterfaceAfiUnsupported(dev) {
+			intf.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+		}
+	}
+}
+
+// addLDP adds to ni MPLS and LDP over the links, with the LSR ID lsrID.
+func addLDP(ni *oc.NetworkInstance, lsrID string, links []string) {
+	mpls := ni.GetOrCreateMpls()
+	ldp := mpls.GetOrCreateSignalingProtocols().GetOrCreateLdp()
+	ldp.GetOrCreateGlobal().SetLsrId(lsrID)
+	for _, name := range links {
+		mi := mpls.GetOrCreateGlobal().GetOrCreateInterface(name)
+		mi.SetMplsEnabled(true)
+		mi.GetOrCreateInterfaceRef().SetInterface(name)
+
+		li := ldp.GetOrCreateInterfaceAttributes().GetOrCreateInterface(name)
+		li.GetOrCreateInterfaceRef().SetInterface(name)
+		li.GetOrCreateInterfaceRef().SetSubinterface(0)
+		li.GetOrCreateAddressFamily(oc.MplsLdp_MplsLdpAfi_IPV4).SetEnabled(true)
+	}
+}
+
+// awaitSession waits for the LDP session of dev with the LSR ID of peer to
+// reach the state want, and returns the time it took.
+func awaitSession(t *testing.T, dev *ondatra.DUTDevice, peer dut, want oc.E_MplsLdp_Neighbor_SessionState) time.Duration {
+	t.Helper()
+	start := time.Now()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dev)).Mpls().SignalingProtocols().Ldp().Neighbor(peer.loopback.IPv4, ldpLabelSpace).SessionState().State()
+	_, ok := gnmi.Watch(t, dev, q, *convergenceTimeout, func(v *ygnmi.Value[oc.E_MplsLdp_Neighbor_SessionState]) bool {
+		got, present := v.Val()
+		// The neighbor may be removed from the state once the session is down.
+		return got == want || (!present && want != oc.MplsLdp_Neighbor_SessionState_OPERATIONAL)
+	}).Await(t)
+	if !ok {
+		t.Fatalf("LDP session of %s with %s did not reach state %v within %v", dev.ID(), peer.loopback.IPv4, want, *convergenceTimeout)
+	}
+	return time.Since(start)
+}
+
+// helloAdjacencies returns the sorted remote addresses of the hello
+// adjacencies of the LDP session of dev with the LSR ID of peer.
+func helloAdjacencies(t *testing.T, dev *ondatra.DUTDevice, peer dut) []string {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dev)).Mpls().SignalingProtocols().Ldp().Neighbor(peer.loopback.IPv4, ldpLabelSpace).HelloAdjacencyAny().State()
+	var addrs []string
+	for _, a := range gnmi.GetAll(t, dev, q) {
+		addrs = append(addrs, a.GetRemoteAddress())
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// labelNextHops returns the sorted next-hop addresses of the label entries
+// of the AFT of dev. The label entries are the bindings of dev for the IGP
+// prefixes, whose next hops are the peer addresses on the links.
+func labelNextHops(t *testing.T, dev *ondatra.DUTDevice) []string {
+	t.Helper()
+	afts := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dev)).Afts()
+	seen := map[string]bool{}
+	for _, e := range gnmi.GetAll(t, dev, afts.LabelEntryAny().State()) {
+		// The entries may change while they are read during convergence.
+		nhg, ok := gnmi.Lookup(t, dev, afts.NextHopGroup(e.GetNextHopGroup()).State()).Val()
+		if !ok {
+			continue
+		}
+		for idx := range nhg.NextHop {
+			if nh, ok := gnmi.Lookup(t, dev, afts.NextHop(idx).State()).Val(); ok && nh.GetIpAddress() != "" {
+				seen[nh.GetIpAddress()] = true
+			}
+		}
+	}
+	var addrs []string
+	for a := range seen {
+		addrs = append(addrs, a)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// awaitLabelNextHops waits for the next hops of the label entries of dev to
+// be want, and returns the time it took.
+func awaitLabelNextHops(t *testing.T, dev *ondatra.DUTDevice, want []string) time.Duration {
+	t.Helper()
+	start := time.Now()
+	var got []string
+	for time.Since(start) < *convergenceTimeout {
+		got = labelNextHops(t, dev)
+		if cmp.Equal(got, want) {
+			return time.Since(start)
+		}
+		time.Sleep(time.Second)
+	}
+	t.Fatalf("Label entries of %s: got next hops %v after %v, want %v", dev.ID(), got, *convergenceTimeout, want)
+	return 0
+}
+
+// setLinkEnabled enables or disables the interface of the link i of dev.
+func setLinkEnabled(t *testing.T, dev *ondatra.DUTDevice, i int, enabled bool) {
+	t.Helper()
+	gnmi.Update(t, dev, gnmi.OC().Interface(dev.Port(t, linkPorts[i]).Name()).Enabled().Config(), enabled)
+}
+
+func TestLDP(t *testing.T) {
+	d1 := ondatra.DUT(t, dut1.id)
+	d2 := ondatra.DUT(t, dut2.id)
+	configureDUT(t, d1, dut1)
+	configureDUT(t, d2, dut2)
+	bothLinks := []string{dut2.links[0].IPv4, dut2.links[1].IPv4}
+
+	t.Run("SessionEstablishment", func(t *testing.T) {
+		t.Logf("LDP session established after %v", awaitSession(t, d1, dut2, oc.MplsLdp_Neighbor_SessionState_OPERATIONAL))
+		if got := helloAdjacencies(t, d1, dut2); !cmp.Equal(got, bothLinks) {
+			t.Errorf("Hello adjacencies of %s: got remote addresses %v, want %v", d1.ID(), got, bothLinks)
+		}
+		lsrID := gnmi.Get(t, d1, gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(d1)).Mpls().SignalingProtocols().Ldp().Global().LsrId().State())
+		if lsrID != dut1.loopback.IPv4 {
+			t.Errorf("LSR ID of %s: got %s, want %s", d1.ID(), lsrID, dut1.loopback.IPv4)
+		}
+	})
+
+	t.Run("LabelBindings", func(t *testing.T) {
+		t.Logf("Label entries installed after %v", awaitLabelNextHops(t, d1, bothLinks))
+	})
+
+	t.Run("LinkDown", func(t *testing.T) {
+		setLinkEnabled(t, d1, 0, false)
+		defer setLinkEnabled(t, d1, 0, true)
+		t.Logf("Label entries converged to link 2 after %v", awaitLabelNextHops(t, d1, bothLinks[1:]))
+		// The session is kept by the hello adjacency of link 2.
+		awaitSession(t, d1, dut2, oc.MplsLdp_Neighbor_SessionState_OPERATIONAL)
+		if got := helloAdjacencies(t, d1, dut2); !cmp.Equal(got, bothLinks[1:]) {
+			t.Errorf("Hello adjacencies of %s: got remote addresses %v, want %v", d1.ID(), got, bothLinks[1:])
+		}
+	})
+
+	t.Run("SessionDown", func(t *testing.T) {
+		awaitLabelNextHops(t, d1, bothLinks)
+		for i := range linkPorts {
+			setLinkEnabled(t, d1, i, false)
+		}
+		awaitSession(t, d1, dut2, oc.MplsLdp_Neighbor_SessionState_NON_EXISTENT)
+		for i := range linkPorts {
+			setLinkEnabled(t, d1, i, true)
+		}
+		start := time.Now()
+		awaitSession(t, d1, dut2, oc.MplsLdp_Neighbor_SessionState_OPERATIONAL)
+		awaitLabelNextHops(t, d1, bothLinks)
+		t.Logf("LDP session and label entries reconverged %v after the links are enabled", time.Since(start))
+	})
+}
@@ -0,0 +1,436 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package igmp_mld_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/mcast"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/gnmi/oc/networkinstance"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the host LAN of the DUT.
+//
+// The OTG does not emulate IGMP and MLD hosts, so ate1 sends the reports and
+// the leaves of each version with the raw flows of the mcast package, and
+// captures the queries of the DUT to verify its query interval and the group specific queries triggered
+// by the leaves. The IGMP membership of the DUT is verified with telemetry,
+// while the MLD membership, which OpenConfig does not model, is inferred from
+// the group specific queries, which the DUT only sends for groups with
+// listeners.
+const (
+	plen4 = 30
+	plen6 = 126
+
+	igmpName = "IGMP"
+
+	// queryInterval is the query interval configured on the DUT, and
+	// queryTolerance the tolerated deviation of the interval between two
+	// captured general queries.
+	queryInterval  = 10
+	queryTolerance = 2 * time.Second
+	// queryWindow is the time waited after the report of a host, long enough
+	// for the DUT to send its startup queries and at least two general
+	// queries at the query interval.
+	queryWindow = 4 * queryInterval * time.Second
+	// maxLeaveLatency is the maximum time allowed for the DUT to remove a
+	// group after a leave, which is the default last member query time of
+	// two queries one second apart, with a margin for the telemetry update.
+	maxLeaveLatency = 5 * time.Second
+	// leaveWait is the time waited after a leave for the group specific
+	// queries of the DUT.
+	leaveWait = 10 * time.Second
+
+	captureName = "query-capture"
+)
+
+var (
+	dut1 = attrs.Attributes{
+		Desc:    "Host LAN",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen4,
+		IPv6:    "2001:db8::1",
+		IPv6Len: plen6,
+	}
+	ate1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen4,
+		IPv6:    "2001:db8::2",
+		IPv6Len: plen6,
+	}
+)
+
+// hostCase is an IGMP or MLD version with the group joined and left by ate1.
+type hostCase struct {
+	v mcast.Version
+	// version is the version number configured on the DUT.
+	version uint8
+	// group is the group joined and left, from its source for IGMPv3 and
+	// MLDv2.
+	group mcast.Group
+}
+
+// ipv6 returns whether c is an MLD version.
+func (c hostCase) ipv6() bool {
+	return c.v == mcast.MLDv1 || c.v == mcast.MLDv2
+}
+
+var hostCases = []hostCase{{
+	v:       mcast.IGMPv2,
+	version: 2,
+	group:   mcast.Group{Address: "239.1.1.1"},
+}, {
+	v:       mcast.IGMPv3,
+	version: 3,
+	group:   mcast.Group{Address: "232.1.1.1", Source: "198.51.100.1"},
+}, {
+	v:       mcast.MLDv1,
+	version: 1,
+	group:   mcast.Group{Address: "ff05::db8:1"},
+}, {
+	v:       mcast.MLDv2,
+	version: 2,
+	group:   mcast.Group{Address: "ff35::db8:1", Source: "2001:db8:100::1"},
+}}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the host LAN interface.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	p1 := dut.Port(t, "port1")
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p1.Name()).Config(), dut1.NewOCInterface(p1.Name(), dut))
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+	}
+}
+
+// igmpInterface returns the path of the IGMP interface of the host LAN.
+func igmpInterface(t *testing.T, dut *ondatra.DUTDevice) *networkinstance.NetworkInstance_Protocol_Igmp_InterfacePath {
+	return gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).
+		Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_IGMP, igmpName).Igmp().Interface(dut.Port(t, "port1").Name())
+}
+
+// configureIGMP enables IGMP version on the host LAN with queryInterval.
+func configureIGMP(t *testing.T, dut *ondatra.DUTDevice, version uint8) {
+	t.Helper()
+	name := dut.Port(t, "port1").Name()
+	prot := &oc.NetworkInstance_Protocol{
+		Identifier: oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_IGMP,
+		Name:       ygot.String(igmpName),
+	}
+	intf := prot.GetOrCreateIgmp().GetOrCreateInterface(name)
+	intf.SetEnabled(true)
+	intf.SetVersion(version)
+	intf.SetQueryInterval(queryInterval)
+	ref := intf.GetOrCreateInterfaceRef()
+	ref.SetInterface(name)
+	ref.SetSubinterface(0)
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).
+		Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_IGMP, igmpName).Config(), prot)
+}
+
+// configureMLD enables MLD version on the host LAN with queryInterval.
+// OpenConfig does not model MLD, so it is configured with the CLI of the
+// vendor.
+func configureMLD(t *testing.T, dut *ondatra.DUTDevice, version uint8) {
+	t.Helper()
+	var config string
+	switch dut.Vendor() {
+	case ondatra.CISCO:
+		config = fmt.Sprintf(`
+multicast-routing
+ address-family ipv6
+  interface %[1]s
+   enable
+  !
+ !
+!
+router mld
+ interface %[1]s
+  version %[2]d
+  query-interval %[3]d
+ !
+!
+`, dut.Port(t, "port1").Name(), version, queryInterval)
+	default:
+		t.Skipf("MLD configuration is not supported for vendor %v", dut.Vendor())
+	}
+	if _, err := dut.RawAPIs().GNMI(t).Set(context.Background(), cliSetRequest(config)); err != nil {
+		t.Fatalf("Failed to configure MLD: %v", err)
+	}
+}
+
+// cliSetRequest returns the SetRequest of the CLI configuration config.
+func cliSetRequest(config string) *gpb.SetRequest {
+	return &gpb.SetRequest{
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{
+				Origin: "cli",
+			},
+			Val: &gpb.TypedValue{
+				Value: &gpb.TypedValue_AsciiVal{
+					AsciiVal: config,
+				},
+			},
+		}},
+	}
+}
+
+// receiver returns the IGMP and MLD host ate1.
+func receiver(t *testing.T, ate *ondatra.ATEDevice) *mcast.Receiver {
+	return &mcast.Receiver{Port: ate.Port(t, "port1"), Host: ate1}
+}
+
+// configureATE configures ate1, the flows of its reports and leaves of
+// hostCases, and the capture of ate:port1.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	r := receiver(t, ate)
+	ate1.AddToOTG(top, r.Port, &dut1)
+	for _, c := range hostCases {
+		mcast.AddMembershipFlows(top, c.v, r, c.group)
+	}
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{r.Port.ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// query is a captured IGMP or MLD query of the DUT.
+type query struct {
+	time time.Time
+	// group is the group of a group specific query, or the unspecified
+	// address of a general query.
+	group net.IP
+	// length is the length of the query message, which tells the IGMPv2
+	// and MLDv1 queries from the longer IGMPv3 and MLDv2 queries.
+	length int
+}
+
+// isGeneral returns whether q is a general query.
+func (q query) isGeneral() bool {
+	return q.group.IsUnspecified()
+}
+
+// parseQueries returns the IGMP queries, or the MLD queries if ipv6, in
+// pkts.
+func parseQueries(pkts []gopacket.Packet, ipv6 bool) []query {
+	var qs []query
+	for _, p := range pkts {
+		var length int
+		var group net.IP
+		if ipv6 {
+			l, ok := p.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6)
+			if !ok || l.TypeCode.Type() != layers.ICMPv6TypeMLDv1MulticastListenerQueryMessage || len(l.Payload) < 20 {
+				continue
+			}
+			length = len(l.Contents) + len(l.Payload)
+			group = net.IP(l.Payload[4:20])
+		} else {
+			l, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+			if !ok || l.Protocol != layers.IPProtocolIGMP || len(l.Payload) < 8 || l.Payload[0] != 0x11 {
+				continue
+			}
+			length = len(l.Payload)
+			group = net.IP(l.Payload[4:8])
+		}
+		qs = append(qs, query{time: p.Metadata().Timestamp, group: group, length: length})
+	}
+	return qs
+}
+
+// verifyGeneralQueries verifies that the general queries in qs are of the
+// version of c and sent every queryInterval.
+func verifyGeneralQueries(t *testing.T, c hostCase, qs []query) {
+	t.Helper()
+	// minLength and maxLength bound the length of the queries of the
+	// version of c.
+	minLength, maxLength := 8, 8
+	switch {
+	case c.ipv6() && c.version == 1:
+		minLength, maxLength = 24, 24
+	case c.ipv6():
+		minLength, maxLength = 28, 1<<16
+	case c.version == 3:
+		minLength, maxLength = 12, 1<<16
+	}
+	var general []query
+	for _, q := range qs {
+		if !q.isGeneral() {
+			continue
+		}
+		if q.length < minLength || q.length > maxLength {
+			t.Errorf("General query of %d bytes captured, want %s queries of %d to %d bytes", q.length, c.v, minLength, maxLength)
+		}
+		general = append(general, q)
+	}
+	if len(general) < 2 {
+		t.Fatalf("Got %d general queries captured, want at least 2", len(general))
+	}
+	want := queryInterval * time.Second
+	for i := 1; i < len(general); i++ {
+		if gap := general[i].time.Sub(general[i-1].time); gap > want+queryTolerance {
+			t.Errorf("Got general queries %v apart, want at most %v", gap, want+queryTolerance)
+		}
+	}
+	// The queries of the DUT before the last one may be its startup
+	// queries, sent more often.
+	if gap := general[len(general)-1].time.Sub(general[len(general)-2].time); gap < want-queryTolerance {
+		t.Errorf("Got last general queries %v apart, want %v", gap, want)
+	}
+}
+
+// verifyGroupQueries verifies that the DUT sent group specific queries for
+// the group of c after its leave, within maxLeaveLatency.
+func verifyGroupQueries(t *testing.T, c hostCase, qs []query) {
+	t.Helper()
+	group := net.ParseIP(c.group.Address)
+	var specific []query
+	for _, q := range qs {
+		if q.group.Equal(group) {
+			specific = append(specific, q)
+		}
+	}
+	if len(specific) == 0 {
+		t.Fatalf("No group specific query for %s captured", c.group.Address)
+	}
+	span := specific[len(specific)-1].time.Sub(specific[0].time)
+	t.Logf("Captured %d group specific queries for %s over %v", len(specific), c.group.Address, span)
+	if span > maxLeaveLatency {
+		t.Errorf("Got group specific queries for %s over %v, want at most %v", c.group.Address, span, maxLeaveLatency)
+	}
+}
+
+// awaitIGMPGroup waits for the IGMP group of c to be reported by ate1, and
+// returns its state.
+func awaitIGMPGroup(t *testing.T, dut *ondatra.DUTDevice, c hostCase) *oc.NetworkInstance_Protocol_Igmp_Interface_Group {
+	t.Helper()
+	v, ok := gnmi.Watch(t, dut, igmpInterface(t, dut).Group(c.group.Address).State(), time.Minute, func(v *ygnmi.Value[*oc.NetworkInstance_Protocol_Igmp_Interface_Group]) bool {
+		g, present := v.Val()
+		return present && g.GetReporter() == ate1.IPv4
+	}).Await(t)
+	if !ok {
+		t.Fatalf("IGMP group %s reported by %s not found", c.group.Address, ate1.IPv4)
+	}
+	g, _ := v.Val()
+	return g
+}
+
+// awaitIGMPLeave waits for the IGMP group of c to be removed, and returns the
+// time it took since start.
+func awaitIGMPLeave(t *testing.T, dut *ondatra.DUTDevice, c hostCase, start time.Time) time.Duration {
+	t.Helper()
+	_, ok := gnmi.Watch(t, dut, igmpInterface(t, dut).Group(c.group.Address).State(), time.Minute, func(v *ygnmi.Value[*oc.NetworkInstance_Protocol_Igmp_Interface_Group]) bool {
+		return !v.IsPresent()
+	}).Await(t)
+	if !ok {
+		t.Fatalf("IGMP group %s not removed after the leave", c.group.Address)
+	}
+	return time.Since(start)
+}
+
+// verifyIGMPMembership verifies the telemetry of the IGMP group of c, the
+// reports counted, and the query interval.
+func verifyIGMPMembership(t *testing.T, dut *ondatra.DUTDevice, c hostCase) {
+	t.Helper()
+	g := awaitIGMPGroup(t, dut, c)
+	if c.group.Source != "" && g.GetSource() != c.group.Source {
+		t.Errorf("IGMP group %s: got source %s, want %s", c.group.Address, g.GetSource(), c.group.Source)
+	}
+	intf := gnmi.Get(t, dut, igmpInterface(t, dut).State())
+	if got := intf.GetVersion(); got != c.version {
+		t.Errorf("IGMP version: got %d, want %d", got, c.version)
+	}
+	if got := intf.GetQueryInterval(); got != queryInterval {
+		t.Errorf("IGMP query interval: got %d, want %d", got, queryInterval)
+	}
+	reports := intf.GetCounters().GetReports()
+	got := reports.GetV2()
+	if c.version == 3 {
+		got = reports.GetV3()
+	}
+	if got == 0 {
+		t.Errorf("IGMP reports: got no %s report counted", c.v)
+	}
+}
+
+func TestIGMPMLDHost(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	configureDUT(t, dut)
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+
+	r := receiver(t, ate)
+	for _, c := range hostCases {
+		t.Run(c.v.String(), func(t *testing.T) {
+			if c.ipv6() {
+				configureMLD(t, dut, c.version)
+			} else {
+				configureIGMP(t, dut, c.version)
+			}
+			otgutils.StartCapture(t, ate.OTG())
+			mcast.Join(t, ate, r, c.group)
+			if !c.ipv6() {
+				verifyIGMPMembership(t, dut, c)
+			}
+			time.Sleep(queryWindow)
+
+			start := time.Now()
+			mcast.Leave(t, ate, r, c.group)
+			if !c.ipv6() {
+				latency := awaitIGMPLeave(t, dut, c, start)
+				t.Logf("IGMP group %s removed %v after the leave", c.group.Address, latency)
+				if latency > maxLeaveLatency {
+					t.Errorf("IGMP leave latency: got %v, want at most %v", latency, maxLeaveLatency)
+				}
+			}
+			time.Sleep(leaveWait)
+			otgutils.StopCapture(t, ate.OTG())
+
+			qs := parseQueries(otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port1").ID()), c.ipv6())
+			verifyGeneralQueries(t, c, qs)
+			verifyGroupQueries(t, c, qs)
+		})
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package msdp_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/mcast"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut1:port1, the LAN of the multicast
+// source, and dut1:port2 -> dut2:port1.
+//
+// dut1 and dut2 are the RPs of two PIM sparse mode domains, with their
+// loopbacks as RP addresses, and MSDP peers over their loopbacks. The OTG
+// does not emulate MSDP, which runs over TCP, so the MSDP peer of dut1 is
+// dut2 rather than the ATE. ate1 sends the multicast data of the source of
+// the domain of dut1, which dut1 advertises to dut2 in its SA messages. dut2
+// has a static member of the group on its loopback, so that it joins the
+// source learned over MSDP. OpenConfig does not model MSDP, so it is
+// configured, and its peers and SA cache verified, with the CLI of the
+// vendor.
+const (
+	plen = 30
+
+	pimName  = "PIM"
+	igmpName = "IGMP"
+
+	group   = "239.1.1.1"
+	ppsRate = 100
+
+	// msdpTimeout is the time allowed for the MSDP peering to come up and
+	// for the SA messages to be received, which includes the connect retry
+	// period of MSDP.
+	msdpTimeout = 3 * time.Minute
+)
+
+var (
+	ate1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dut1Port1 = attrs.Attributes{
+		Desc:    "Source LAN",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dut1Port2 = attrs.Attributes{
+		Desc:    "To dut2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	dut2Port1 = attrs.Attributes{
+		Desc:    "To dut1",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	dut1Loopback = attrs.Attributes{
+		Desc:    "RP and MSDP peer",
+		IPv4:    "203.0.113.1",
+		IPv4Len: 32,
+	}
+	dut2Loopback = attrs.Attributes{
+		Desc:    "RP and MSDP peer",
+		IPv4:    "203.0.113.2",
+		IPv4Len: 32,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// rpDomain is the configuration of a DUT as the RP of a PIM domain.
+type rpDomain struct {
+	ports    map[string]attrs.Attributes
+	loopback attrs.Attributes
+	// routes are the next hops of the static routes to the loopback of the
+	// MSDP peer and to the source LAN, keyed by prefix.
+	routes map[string]string
+	// staticGroup is whether the loopback is a static member of group.
+	staticGroup bool
+}
+
+// configureDUT configures the interfaces of dut and its loopback as the RP
+// of d, with PIM sparse mode on all of them.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice, d rpDomain) string {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	lb := netutil.LoopbackInterface(t, dut, 0)
+	lo := d.loopback.NewOCInterface(lb, dut)
+	lo.Type = oc.IETFInterfaces_InterfaceType_softwareLoopback
+	gnmi.Replace(t, dut, gnmi.OC().Interface(lb).Config(), lo)
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, lb, dni, 0)
+	}
+	intfs := []string{lb}
+	for port, a := range d.ports {
+		dp := dut.Port(t, port)
+		intfs = append(intfs, dp.Name())
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), a.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), dni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	ni := &oc.NetworkInstance{Name: ygot.String(dni)}
+	pim := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_PIM, pimName).GetOrCreatePim()
+	pim.GetOrCreateGlobal().GetOrCreateRendezvousPoint(d.loopback.IPv4).SetMulticastGroups("224.0.0.0/4")
+	for _, name := range intfs {
+		intf := pim.GetOrCreateInterface(name)
+		intf.SetEnabled(true)
+		intf.SetMode(oc.PimTypes_PIM_MODE_PIM_MODE_SPARSE)
+		ref := intf.GetOrCreateInterfaceRef()
+		ref.SetInterface(name)
+		ref.SetSubinterface(0)
+	}
+	if d.staticGroup {
+		intf := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_IGMP, igmpName).GetOrCreateIgmp().GetOrCreateInterface(lb)
+		intf.SetEnabled(true)
+		intf.GetOrCreateInterfaceRef().SetInterface(lb)
+		intf.GetOrCreateStaticGroups(group)
+	}
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(dni).Config(), ni)
+
+	b := &gnmi.SetBatch{}
+	for prefix, nh := range d.routes {
+		sr := &cfgplugins.StaticRouteCfg{
+			NetworkInstance: dni,
+			Prefix:          prefix,
+			NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+				"0": oc.UnionString(nh),
+			},
+		}
+		if _, err := cfgplugins.NewStaticRouteCfg(b, sr, dut); err != nil {
+			t.Fatalf("Failed to configure the static route to %s: %v", prefix, err)
+		}
+	}
+	b.Set(t, dut)
+	return lb
+}
+
+// msdpCLI is the MSDP CLI of a vendor.
+type msdpCLI struct {
+	// config is the configuration of the MSDP peer %[1]s over the loopback
+	// %[2]s.
+	config string
+	// peer is the command showing the MSDP peer %s, and established a
+	// string of its output when the peering is established.
+	peer        string
+	established string
+	// saCache is the command showing the SA cache.
+	saCache string
+}
+
+var msdpCLIs = map[ondatra.Vendor]msdpCLI{
+	ondatra.ARISTA: {
+		config: `
+router msdp
+   peer %[1]s
+      local-interface %[2]s
+`,
+		peer:        "show ip msdp peer %s",
+		established: "Established",
+		saCache:     "show ip msdp sa-cache",
+	},
+	ondatra.CISCO: {
+		config: `
+router msdp
+ originator-id %[2]s
+ peer %[1]s
+  connect-source %[2]s
+ !
+!
+`,
+		peer:        "show msdp peer %s",
+		established: "State: Up",
+		saCache:     "show msdp sa-cache",
+	},
+}
+
+// msdpCLIFor returns the MSDP CLI of the vendor of dut, skipping the test if
+// there is none.
+func msdpCLIFor(t *testing.T, dut *ondatra.DUTDevice) msdpCLI {
+	t.Helper()
+	c, ok := msdpCLIs[dut.Vendor()]
+	if !ok {
+		t.Skipf("MSDP is not supported for vendor %v", dut.Vendor())
+	}
+	return c
+}
+
+// configureMSDP configures the MSDP peer of dut over the loopback lb.
+func configureMSDP(t *testing.T, dut *ondatra.DUTDevice, peer, lb string) {
+	t.Helper()
+	clihelper.Push(t, dut, &clihelper.Config{
+		Reason: "MSDP peering",
+		CLI:    map[ondatra.Vendor]string{dut.Vendor(): fmt.Sprintf(msdpCLIFor(t, dut).config, peer, lb)},
+	})
+}
+
+// awaitCLI waits for the output of the command cmd of dut to contain all of
+// want.
+func awaitCLI(t *testing.T, dut *ondatra.DUTDevice, cmd string, want ...string) {
+	t.Helper()
+	var out string
+	for start := time.Now(); time.Since(start) < msdpTimeout; time.Sleep(10 * time.Second) {
+		out = dut.CLI().Run(t, cmd)
+		if containsAll(out, want) {
+			return
+		}
+	}
+	t.Fatalf("Output of %q of %s does not contain %q:\n%s", cmd, dut.Name(), want, out)
+}
+
+// containsAll returns whether s contains all of subs.
+func containsAll(s string, subs []string) bool {
+	for _, sub := range subs {
+		if !strings.Contains(s, sub) {
+			return false
+		}
+	}
+	return true
+}
+
+// configureATE configures ate1 and the multicast data it sends
+// continuously to group.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	p1 := ate.Port(t, "port1")
+	ate1.AddToOTG(top, p1, &dut1Port1)
+	f := top.Flows().Add().SetName("source")
+	f.TxRx().Port().SetTxName(p1.ID())
+	f.Duration().Continuous()
+	f.Rate().SetPps(ppsRate)
+	eth := f.Packet().Add().Ethernet()
+	eth.Src().SetValue(ate1.MAC)
+	eth.Dst().SetValue(mcast.MAC(group))
+	ip := f.Packet().Add().Ipv4()
+	ip.Src().SetValue(ate1.IPv4)
+	ip.Dst().SetValue(group)
+	return top
+}
+
+// awaitSource waits for dut to have the (S,G) state of ate1 for group, and
+// verifies that its upstream interface is the interface of port.
+func awaitSource(t *testing.T, dut *ondatra.DUTDevice, port string) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_PIM, pimName).Pim().
+		Global().Source(ate1.IPv4).State()
+	v, ok := gnmi.Watch(t, dut, q, time.Minute, func(v *ygnmi.Value[*oc.NetworkInstance_Protocol_Pim_Global_Source]) bool {
+		src, present := v.Val()
+		return present && src.GetGroup() == group
+	}).Await(t)
+	if !ok {
+		t.Fatalf("PIM (%s, %s) state of %s not found", ate1.IPv4, group, dut.Name())
+	}
+	src, _ := v.Val()
+	if got, want := src.GetUpstreamInterfaceId(), dut.Port(t, port).Name(); got != want {
+		t.Errorf("PIM (%s, %s) state of %s: got upstream interface %s, want %s", ate1.IPv4, group, dut.Name(), got, want)
+	}
+}
+
+func TestMSDP(t *testing.T) {
+	dut1 := ondatra.DUT(t, "dut1")
+	dut2 := ondatra.DUT(t, "dut2")
+	ate := ondatra.ATE(t, "ate")
+	cli1 := msdpCLIFor(t, dut1)
+	cli2 := msdpCLIFor(t, dut2)
+
+	lb1 := configureDUT(t, dut1, rpDomain{
+		ports:    map[string]attrs.Attributes{"port1": dut1Port1, "port2": dut1Port2},
+		loopback: dut1Loopback,
+		routes:   map[string]string{dut2Loopback.IPv4CIDR(): dut2Port1.IPv4},
+	})
+	lb2 := configureDUT(t, dut2, rpDomain{
+		ports:    map[string]attrs.Attributes{"port1": dut2Port1},
+		loopback: dut2Loopback,
+		routes: map[string]string{
+			dut1Loopback.IPv4CIDR(): dut1Port2.IPv4,
+			ate1.IPv4CIDR():         dut1Port2.IPv4,
+		},
+		staticGroup: true,
+	})
+	configureMSDP(t, dut1, dut2Loopback.IPv4, lb1)
+	configureMSDP(t, dut2, dut1Loopback.IPv4, lb2)
+
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	ate.OTG().StartTraffic(t)
+	defer ate.OTG().StopTraffic(t)
+
+	t.Run("Peering", func(t *testing.T) {
+		awaitCLI(t, dut1, fmt.Sprintf(cli1.peer, dut2Loopback.IPv4), cli1.established)
+		awaitCLI(t, dut2, fmt.Sprintf(cli2.peer, dut1Loopback.IPv4), cli2.established)
+	})
+
+	t.Run("SourceActive", func(t *testing.T) {
+		// dut1 registers the source as its RP, and advertises it to dut2
+		// with itself as the originating RP.
+		awaitSource(t, dut1, "port1")
+		awaitCLI(t, dut2, cli2.saCache, ate1.IPv4, group, dut1Loopback.IPv4)
+	})
+
+	t.Run("SourceJoined", func(t *testing.T) {
+		// dut2 joins the source learned over MSDP for its static member,
+		// towards dut1.
+		awaitSource(t, dut2, "port1")
+	})
+}
@@ -0,0 +1,500 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pim6_sm_test
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/mcast"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the LAN of the multicast
+// source, dut:port2 -> ate:port2 and dut:port3 -> ate:port3, the LANs of the
+// receivers, and dut:port4 -> ate:port4, the upstream PIM router.
+//
+// This is the IPv6 counterpart of the PIM sparse mode baseline test. The DUT
+// runs PIM sparse mode on all its ports, with MLDv1 on the receiver LANs, and
+// the static RP ate4. The OTG does not emulate PIM routers, so ate4 sends its
+// PIM hellos from its link local address as a raw flow, and ate2 and ate3
+// join the group with the raw MLD flows of the mcast package. OpenConfig does
+// not model MLD, so it is configured, and its groups verified, with the CLI
+// of the vendor. ate4 captures the PIM joins of the DUT towards the RP to
+// verify its (*,G) state. ate1 sends the multicast data of the directly
+// connected source, which creates the (S,G) state of the DUT.
+const (
+	plen = 126
+
+	pimName = "PIM"
+
+	// helloHoldtime is the holdtime of the hellos of ate4, sent every
+	// second.
+	helloHoldtime = 105
+
+	group    = "ff05::db8:1"
+	rpGroups = "ff00::/8"
+
+	// protoPIM is the IP protocol number of PIM.
+	protoPIM = 103
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	captureName = "join-capture"
+)
+
+var (
+	dut1 = attrs.Attributes{
+		Desc:    "Source LAN",
+		IPv6:    "2001:db8::1",
+		IPv6Len: plen,
+	}
+	ate1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv6:    "2001:db8::2",
+		IPv6Len: plen,
+	}
+	dut2 = attrs.Attributes{
+		Desc:    "Receiver LAN 1",
+		IPv6:    "2001:db8::5",
+		IPv6Len: plen,
+	}
+	ate2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv6:    "2001:db8::6",
+		IPv6Len: plen,
+	}
+	dut3 = attrs.Attributes{
+		Desc:    "Receiver LAN 2",
+		IPv6:    "2001:db8::9",
+		IPv6Len: plen,
+	}
+	ate3 = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv6:    "2001:db8::a",
+		IPv6Len: plen,
+	}
+	dut4 = attrs.Attributes{
+		Desc:    "Upstream PIM router",
+		IPv6:    "2001:db8::d",
+		IPv6Len: plen,
+	}
+	ate4 = attrs.Attributes{
+		Name:    "ate4",
+		MAC:     "02:00:04:01:01:01",
+		IPv6:    "2001:db8::e",
+		IPv6Len: plen,
+	}
+
+	// ate4LinkLocal is the address of the PIM neighbor ate4.
+	ate4LinkLocal = mcast.LinkLocal(ate4.MAC)
+
+	mcastGroup = mcast.Group{Address: group}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the interfaces with PIM sparse mode and the static
+// RP ate4.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	ni := &oc.NetworkInstance{Name: ygot.String(dni)}
+	pim := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_PIM, pimName).GetOrCreatePim()
+	rp := pim.GetOrCreateGlobal().GetOrCreateRendezvousPoint(ate4.IPv6)
+	rp.SetMulticastGroups(rpGroups)
+
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dut1},
+		{"port2", dut2},
+		{"port3", dut3},
+		{"port4", dut4},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), dni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+
+		intf := pim.GetOrCreateInterface(dp.Name())
+		intf.SetEnabled(true)
+		intf.SetMode(oc.PimTypes_PIM_MODE_PIM_MODE_SPARSE)
+		ref := intf.GetOrCreateInterfaceRef()
+		ref.SetInterface(dp.Name())
+		ref.SetSubinterface(0)
+	}
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(dni).Config(), ni)
+}
+
+// mldCLI is the MLD CLI of a vendor.
+type mldCLI struct {
+	// config enables IPv6 multicast routing on all the interfaces, and
+	// MLDv1 on the receiver LANs %[1]s and %[2]s.
+	config string
+	// groups is the command showing the MLD groups of the interface %s.
+	groups string
+}
+
+var mldCLIs = map[ondatra.Vendor]mldCLI{
+	ondatra.CISCO: {
+		config: `
+multicast-routing
+ address-family ipv6
+  interface all enable
+ !
+!
+router mld
+ interface %[1]s
+  version 1
+ !
+ interface %[2]s
+  version 1
+ !
+!
+`,
+		groups: "show mld groups %s",
+	},
+}
+
+// mldCLIFor returns the MLD CLI of the vendor of dut, skipping the test if
+// there is none.
+func mldCLIFor(t *testing.T, dut *ondatra.DUTDevice) mldCLI {
+	t.Helper()
+	c, ok := mldCLIs[dut.Vendor()]
+	if !ok {
+		t.Skipf("MLD is not supported for vendor %v", dut.Vendor())
+	}
+	return c
+}
+
+// configureMLD enables IPv6 multicast routing on the DUT and MLDv1 on the
+// receiver LANs.
+func configureMLD(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	config := fmt.Sprintf(mldCLIFor(t, dut).config, dut.Port(t, "port2").Name(), dut.Port(t, "port3").Name())
+	clihelper.Push(t, dut, &clihelper.Config{
+		Reason: "MLD",
+		CLI:    map[ondatra.Vendor]string{dut.Vendor(): config},
+	})
+}
+
+// configureATE configures the ATE ports, the flows of the PIM hellos of
+// ate4, of the MLD reports and dones of ate2 and ate3, and of the multicast
+// data of ate1, and the capture of ate:port4.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	ate1.AddToOTG(top, ate.Port(t, "port1"), &dut1)
+	ate2.AddToOTG(top, ate.Port(t, "port2"), &dut2)
+	ate3.AddToOTG(top, ate.Port(t, "port3"), &dut3)
+	ate4.AddToOTG(top, ate.Port(t, "port4"), &dut4)
+
+	addHelloFlow(top, ate.Port(t, "port4").ID())
+	rs := receivers(t, ate)
+	for _, r := range rs {
+		mcast.AddMembershipFlows(top, mcast.MLDv1, r, mcastGroup)
+	}
+	source(t, ate).AddFlow(top, rs)
+
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{ate.Port(t, "port4").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// receivers returns the MLD hosts ate2 and ate3 on the receiver LANs.
+func receivers(t *testing.T, ate *ondatra.ATEDevice) []*mcast.Receiver {
+	return []*mcast.Receiver{
+		{Port: ate.Port(t, "port2"), Host: ate2},
+		{Port: ate.Port(t, "port3"), Host: ate3},
+	}
+}
+
+// source returns the multicast stream of ate1 to group.
+func source(t *testing.T, ate *ondatra.ATEDevice) *mcast.Stream {
+	return &mcast.Stream{
+		Name:      "source",
+		Port:      ate.Port(t, "port1"),
+		Source:    ate1,
+		Group:     group,
+		Packets:   packets,
+		PPS:       ppsRate,
+		FrameSize: frameSize,
+	}
+}
+
+// addHelloFlow adds to top the flow of the PIM hellos of ate4 on port,
+// continuously sent every second.
+func addHelloFlow(top gosnappi.Config, port string) {
+	const allPIMRouters = "ff02::d"
+	msg := pimHello(ate4LinkLocal, allPIMRouters)
+	f := top.Flows().Add().SetName("ate4-hello")
+	f.TxRx().Port().SetTxName(port)
+	f.Duration().Continuous()
+	f.Rate().SetPps(1)
+	eth := f.Packet().Add().Ethernet()
+	eth.Src().SetValue(ate4.MAC)
+	eth.Dst().SetValue(mcast.MAC(allPIMRouters))
+	ip := f.Packet().Add().Ipv6()
+	ip.Src().SetValue(ate4LinkLocal)
+	ip.Dst().SetValue(allPIMRouters)
+	ip.HopLimit().SetValue(1)
+	ip.NextHeader().SetValue(protoPIM)
+	f.Packet().Add().Custom().SetBytes(hex.EncodeToString(msg))
+	// The size of the frame with its FCS.
+	f.Size().SetFixed(uint32(max(14+40+len(msg)+4, 64)))
+}
+
+// pimHello returns the PIM hello of ate4 from src to dst, with the holdtime,
+// DR priority and generation ID options of RFC 7761, and the address list
+// option with the global address of ate4. The checksum of IPv6 PIM messages
+// includes the IPv6 pseudo header.
+func pimHello(src, dst string) []byte {
+	b := []byte{
+		0x20, 0, 0, 0,
+		0, 1, 0, 2, 0, helloHoldtime,
+		0, 19, 0, 4, 0, 0, 0, 1,
+		0, 20, 0, 4, 0x0a, 0x0b, 0x0c, 0x0d,
+		0, 24, 0, 18, 2, 0,
+	}
+	b = append(b, net.ParseIP(ate4.IPv6).To16()...)
+	pseudo := append(net.ParseIP(src).To16(), net.ParseIP(dst).To16()...)
+	pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(b)))
+	pseudo = append(pseudo, 0, 0, 0, protoPIM)
+	binary.BigEndian.PutUint16(b[2:], otgutils.Checksum(append(pseudo, b...)))
+	return b
+}
+
+// sendFlow starts the flow name of the ATE.
+func sendFlow(t *testing.T, ate *ondatra.ATEDevice, name string) {
+	t.Helper()
+	cs := gosnappi.NewControlState()
+	cs.Traffic().FlowTransmit().SetState(gosnappi.StateTrafficFlowTransmitState.START).SetFlowNames([]string{name})
+	ate.OTG().SetControlState(t, cs)
+}
+
+// join is a joined source of a group of a PIM join/prune message.
+type join struct {
+	upstream net.IP
+	group    net.IP
+	source   net.IP
+	// flags are the sparse, wildcard and RPT bits of the source.
+	flags byte
+}
+
+// The wildcard and RPT bits of the encoded source address of RFC 7761.
+const (
+	wcBit  = 0x02
+	rptBit = 0x01
+)
+
+// parseJoins returns the joined sources of the IPv6 PIM join/prune messages
+// in pkts.
+func parseJoins(pkts []gopacket.Packet) []join {
+	var joins []join
+	for _, p := range pkts {
+		ip, ok := p.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+		if !ok || ip.NextHeader != protoPIM {
+			continue
+		}
+		b := ip.Payload
+		// The join/prune message is the PIM header, the encoded unicast
+		// upstream neighbor, and the reserved, group count and holdtime
+		// fields, followed by the groups. The encoded addresses of IPv6
+		// are 16 octets longer than those of IPv4 after their 2 or 4
+		// octets of family, encoding and flags.
+		if len(b) < 26 || b[0] != 0x23 || b[4] != 2 {
+			continue
+		}
+		upstream := net.IP(b[6:22])
+		groups := int(b[23])
+		b = b[26:]
+		for i := 0; i < groups && len(b) >= 24; i++ {
+			grp := net.IP(b[4:20])
+			joined := int(binary.BigEndian.Uint16(b[20:]))
+			pruned := int(binary.BigEndian.Uint16(b[22:]))
+			b = b[24:]
+			for j := 0; j < joined+pruned && len(b) >= 20; j++ {
+				if j < joined {
+					joins = append(joins, join{upstream: upstream, group: grp, source: net.IP(b[4:20]), flags: b[2]})
+				}
+				b = b[20:]
+			}
+		}
+	}
+	return joins
+}
+
+// awaitNeighbor waits for ate4 to be the PIM neighbor of the DUT on port4.
+func awaitNeighbor(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_PIM, pimName).Pim().
+		Interface(dut.Port(t, "port4").Name()).Neighbor(ate4LinkLocal).State()
+	_, ok := gnmi.Watch(t, dut, q, time.Minute, func(v *ygnmi.Value[*oc.NetworkInstance_Protocol_Pim_Interface_Neighbor]) bool {
+		return v.IsPresent()
+	}).Await(t)
+	if !ok {
+		t.Fatalf("PIM neighbor %s not found", ate4LinkLocal)
+	}
+}
+
+// awaitMLDGroup waits for group to be reported on port of the DUT if
+// present, or to be removed otherwise.
+func awaitMLDGroup(t *testing.T, dut *ondatra.DUTDevice, port string, present bool) {
+	t.Helper()
+	cmd := fmt.Sprintf(mldCLIFor(t, dut).groups, dut.Port(t, port).Name())
+	var out string
+	for start := time.Now(); time.Since(start) < time.Minute; time.Sleep(5 * time.Second) {
+		out = dut.CLI().Run(t, cmd)
+		if strings.Contains(out, group) == present {
+			return
+		}
+	}
+	t.Fatalf("MLD group %s on %s: got present %t, want %t:\n%s", group, port, !present, present, out)
+}
+
+func TestPIM6SM(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	configureDUT(t, dut)
+	configureMLD(t, dut)
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+	otgutils.StartCapture(t, ate.OTG())
+	sendFlow(t, ate, "ate4-hello")
+
+	pim := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_PIM, pimName).Pim()
+	rs := receivers(t, ate)
+	stream := source(t, ate)
+
+	t.Run("Neighbor", func(t *testing.T) {
+		awaitNeighbor(t, dut)
+		for _, port := range []string{"port1", "port2", "port3", "port4"} {
+			name := dut.Port(t, port).Name()
+			if got := gnmi.Get(t, dut, pim.Interface(name).Mode().State()); got != oc.PimTypes_PIM_MODE_PIM_MODE_SPARSE {
+				t.Errorf("PIM mode of %s: got %v, want %v", name, got, oc.PimTypes_PIM_MODE_PIM_MODE_SPARSE)
+			}
+		}
+		if got := gnmi.Get(t, dut, pim.Global().RendezvousPoint(ate4.IPv6).MulticastGroups().State()); got != rpGroups {
+			t.Errorf("Multicast groups of RP %s: got %s, want %s", ate4.IPv6, got, rpGroups)
+		}
+	})
+
+	t.Run("StarGJoin", func(t *testing.T) {
+		mcast.Join(t, ate, rs[0], mcastGroup)
+		awaitMLDGroup(t, dut, rs[0].Port.ID(), true)
+		// The DUT sends the (*,G) join as soon as the receiver joins, allow
+		// a few seconds for it to be captured.
+		time.Sleep(5 * time.Second)
+		otgutils.StopCapture(t, ate.OTG())
+
+		var found bool
+		for _, j := range parseJoins(otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port4").ID())) {
+			t.Logf("Captured join of (%s, %s) with flags %#x to %s", j.source, j.group, j.flags, j.upstream)
+			if j.group.Equal(net.ParseIP(group)) && j.source.Equal(net.ParseIP(ate4.IPv6)) && j.flags&(wcBit|rptBit) == wcBit|rptBit {
+				found = true
+				if !j.upstream.Equal(net.ParseIP(ate4LinkLocal)) {
+					t.Errorf("(*, %s) join: got upstream neighbor %s, want %s", group, j.upstream, ate4LinkLocal)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("No (*, %s) join towards RP %s captured", group, ate4.IPv6)
+		}
+	})
+
+	// The first packets of the source may be dropped while the DUT creates
+	// its (S,G) state, so the source is sent once before its replication is
+	// verified.
+	sendFlow(t, ate, stream.Name)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+
+	for _, tc := range []struct {
+		desc        string
+		join, leave []*mcast.Receiver
+		joined      []*mcast.Receiver
+	}{{
+		desc:   "OneReceiver",
+		joined: rs[:1],
+	}, {
+		desc:   "TwoReceivers",
+		join:   rs[1:],
+		joined: rs,
+	}, {
+		desc:   "ReceiverLeft",
+		leave:  rs[1:],
+		joined: rs[:1],
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			for _, r := range tc.join {
+				mcast.Join(t, ate, r, mcastGroup)
+			}
+			for _, r := range tc.leave {
+				mcast.Leave(t, ate, r, mcastGroup)
+			}
+			var joined []string
+			for _, r := range rs {
+				present := slices.Contains(tc.joined, r)
+				awaitMLDGroup(t, dut, r.Port.ID(), present)
+				if present {
+					joined = append(joined, r.Host.Name)
+				}
+			}
+			mcast.Verify(t, ate, []*mcast.Stream{stream}, rs, mcast.Joined{stream.Name: joined})
+
+			src, ok := gnmi.Lookup(t, dut, pim.Global().Source(ate1.IPv6).State()).Val()
+			if !ok {
+				t.Fatalf("PIM (%s, %s) state not found", ate1.IPv6, group)
+			}
+			if got := src.GetGroup(); got != group {
+				t.Errorf("PIM source %s: got group %s, want %s", ate1.IPv6, got, group)
+			}
+			if got, want := src.GetUpstreamInterfaceId(), dut.Port(t, "port1").Name(); got != want {
+				t.Errorf("PIM (%s, %s): got upstream interface %s, want %s", ate1.IPv6, group, got, want)
+			}
+		})
+	}
+}
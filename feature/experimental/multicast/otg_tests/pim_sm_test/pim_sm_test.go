@@ -0,0 +1,438 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pim_sm_test
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/mcast"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the LAN of the multicast
+// source, dut:port2 -> ate:port2 and dut:port3 -> ate:port3, the LANs of the
+// receivers, and dut:port4 -> ate:port4, the upstream PIM router.
+//
+// The DUT runs PIM sparse mode on all its ports, with IGMP on the receiver
+// LANs, and the static RP ate4. The OTG does not emulate PIM routers, so ate4
+// sends its PIM hellos as a raw flow, and ate2 and ate3 join the group with
+// the raw IGMP flows of the mcast package. ate4 captures the PIM joins of the
+// DUT towards the RP to verify its (*,G) state. ate1 sends the multicast data
+// of the directly connected source, which creates the (S,G) state of the DUT.
+const (
+	plen = 30
+
+	pimName  = "PIM"
+	igmpName = "IGMP"
+
+	// helloHoldtime is the holdtime of the hellos of ate4, sent every
+	// second.
+	helloHoldtime = 105
+
+	group       = "239.1.1.1"
+	rpGroups    = "224.0.0.0/4"
+	igmpVersion = 2
+
+	// protoPIM is the IP protocol number of PIM.
+	protoPIM = 103
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	captureName = "join-capture"
+)
+
+var (
+	dut1 = attrs.Attributes{
+		Desc:    "Source LAN",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	ate1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dut2 = attrs.Attributes{
+		Desc:    "Receiver LAN 1",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ate2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	dut3 = attrs.Attributes{
+		Desc:    "Receiver LAN 2",
+		IPv4:    "192.0.2.9",
+		IPv4Len: plen,
+	}
+	ate3 = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv4Len: plen,
+	}
+	dut4 = attrs.Attributes{
+		Desc:    "Upstream PIM router",
+		IPv4:    "192.0.2.13",
+		IPv4Len: plen,
+	}
+	ate4 = attrs.Attributes{
+		Name:    "ate4",
+		MAC:     "02:00:04:01:01:01",
+		IPv4:    "192.0.2.14",
+		IPv4Len: plen,
+	}
+
+	mcastGroup = mcast.Group{Address: group}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the interfaces with PIM sparse mode, the static RP
+// ate4, and IGMP on the receiver LANs.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	ni := &oc.NetworkInstance{Name: ygot.String(dni)}
+	pim := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_PIM, pimName).GetOrCreatePim()
+	rp := pim.GetOrCreateGlobal().GetOrCreateRendezvousPoint(ate4.IPv4)
+	rp.SetMulticastGroups(rpGroups)
+	igmp := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_IGMP, igmpName).GetOrCreateIgmp()
+
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dut1},
+		{"port2", dut2},
+		{"port3", dut3},
+		{"port4", dut4},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), dni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+
+		intf := pim.GetOrCreateInterface(dp.Name())
+		intf.SetEnabled(true)
+		intf.SetMode(oc.PimTypes_PIM_MODE_PIM_MODE_SPARSE)
+		ref := intf.GetOrCreateInterfaceRef()
+		ref.SetInterface(dp.Name())
+		ref.SetSubinterface(0)
+		if p.port == "port2" || p.port == "port3" {
+			intf := igmp.GetOrCreateInterface(dp.Name())
+			intf.SetEnabled(true)
+			intf.SetVersion(igmpVersion)
+			ref := intf.GetOrCreateInterfaceRef()
+			ref.SetInterface(dp.Name())
+			ref.SetSubinterface(0)
+		}
+	}
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(dni).Config(), ni)
+}
+
+// configureATE configures the ATE ports, the flows of the PIM hellos of
+// ate4, of the IGMP reports and leaves of ate2 and ate3, and of the
+// multicast data of ate1, and the capture of ate:port4.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	ate1.AddToOTG(top, ate.Port(t, "port1"), &dut1)
+	ate2.AddToOTG(top, ate.Port(t, "port2"), &dut2)
+	ate3.AddToOTG(top, ate.Port(t, "port3"), &dut3)
+	ate4.AddToOTG(top, ate.Port(t, "port4"), &dut4)
+
+	addHelloFlow(top, ate.Port(t, "port4").ID())
+	rs := receivers(t, ate)
+	for _, r := range rs {
+		mcast.AddMembershipFlows(top, mcast.IGMPv2, r, mcastGroup)
+	}
+	source(t, ate).AddFlow(top, rs)
+
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{ate.Port(t, "port4").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// receivers returns the IGMP hosts ate2 and ate3 on the receiver LANs.
+func receivers(t *testing.T, ate *ondatra.ATEDevice) []*mcast.Receiver {
+	return []*mcast.Receiver{
+		{Port: ate.Port(t, "port2"), Host: ate2},
+		{Port: ate.Port(t, "port3"), Host: ate3},
+	}
+}
+
+// source returns the multicast stream of ate1 to group.
+func source(t *testing.T, ate *ondatra.ATEDevice) *mcast.Stream {
+	return &mcast.Stream{
+		Name:      "source",
+		Port:      ate.Port(t, "port1"),
+		Source:    ate1,
+		Group:     group,
+		Packets:   packets,
+		PPS:       ppsRate,
+		FrameSize: frameSize,
+	}
+}
+
+// addHelloFlow adds to top the flow of the PIM hellos of ate4 on port,
+// continuously sent every second.
+func addHelloFlow(top gosnappi.Config, port string) {
+	msg := pimHello()
+	f := top.Flows().Add().SetName("ate4-hello")
+	f.TxRx().Port().SetTxName(port)
+	f.Duration().Continuous()
+	f.Rate().SetPps(1)
+	eth := f.Packet().Add().Ethernet()
+	eth.Src().SetValue(ate4.MAC)
+	eth.Dst().SetValue(mcast.MAC("224.0.0.13"))
+	ip := f.Packet().Add().Ipv4()
+	ip.Src().SetValue(ate4.IPv4)
+	ip.Dst().SetValue("224.0.0.13")
+	ip.TimeToLive().SetValue(1)
+	ip.Protocol().SetValue(protoPIM)
+	f.Packet().Add().Custom().SetBytes(hex.EncodeToString(msg))
+	// The size of the frame with its FCS.
+	f.Size().SetFixed(uint32(max(14+20+len(msg)+4, 64)))
+}
+
+// pimHello returns the PIM hello of ate4, with the holdtime, DR priority and
+// generation ID options of RFC 7761.
+func pimHello() []byte {
+	b := []byte{
+		0x20, 0, 0, 0,
+		0, 1, 0, 2, 0, helloHoldtime,
+		0, 19, 0, 4, 0, 0, 0, 1,
+		0, 20, 0, 4, 0x0a, 0x0b, 0x0c, 0x0d,
+	}
+	binary.BigEndian.PutUint16(b[2:], otgutils.Checksum(b))
+	return b
+}
+
+// sendFlow starts the flow name of the ATE.
+func sendFlow(t *testing.T, ate *ondatra.ATEDevice, name string) {
+	t.Helper()
+	cs := gosnappi.NewControlState()
+	cs.Traffic().FlowTransmit().SetState(gosnappi.StateTrafficFlowTransmitState.START).SetFlowNames([]string{name})
+	ate.OTG().SetControlState(t, cs)
+}
+
+// join is a joined source of a group of a PIM join/prune message.
+type join struct {
+	upstream net.IP
+	group    net.IP
+	source   net.IP
+	// flags are the sparse, wildcard and RPT bits of the source.
+	flags byte
+}
+
+// The wildcard and RPT bits of the encoded source address of RFC 7761.
+const (
+	wcBit  = 0x02
+	rptBit = 0x01
+)
+
+// parseJoins returns the joined sources of the IPv4 PIM join/prune messages
+// in pkts.
+func parseJoins(pkts []gopacket.Packet) []join {
+	var joins []join
+	for _, p := range pkts {
+		ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok || ip.Protocol != protoPIM {
+			continue
+		}
+		b := ip.Payload
+		// The join/prune message is the PIM header, the encoded unicast
+		// upstream neighbor, and the reserved, group count and holdtime
+		// fields, followed by the groups.
+		if len(b) < 14 || b[0] != 0x23 || b[4] != 1 {
+			continue
+		}
+		upstream := net.IP(b[6:10])
+		groups := int(b[11])
+		b = b[14:]
+		for i := 0; i < groups && len(b) >= 12; i++ {
+			grp := net.IP(b[4:8])
+			joined := int(binary.BigEndian.Uint16(b[8:]))
+			pruned := int(binary.BigEndian.Uint16(b[10:]))
+			b = b[12:]
+			for j := 0; j < joined+pruned && len(b) >= 8; j++ {
+				if j < joined {
+					joins = append(joins, join{upstream: upstream, group: grp, source: net.IP(b[4:8]), flags: b[2]})
+				}
+				b = b[8:]
+			}
+		}
+	}
+	return joins
+}
+
+// awaitNeighbor waits for ate4 to be the PIM neighbor of the DUT on port4.
+func awaitNeighbor(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_PIM, pimName).Pim().
+		Interface(dut.Port(t, "port4").Name()).Neighbor(ate4.IPv4).State()
+	_, ok := gnmi.Watch(t, dut, q, time.Minute, func(v *ygnmi.Value[*oc.NetworkInstance_Protocol_Pim_Interface_Neighbor]) bool {
+		return v.IsPresent()
+	}).Await(t)
+	if !ok {
+		t.Fatalf("PIM neighbor %s not found", ate4.IPv4)
+	}
+}
+
+// awaitIGMPGroup waits for group to be reported on port of the DUT if
+// present, or to be removed otherwise.
+func awaitIGMPGroup(t *testing.T, dut *ondatra.DUTDevice, port string, present bool) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_IGMP, igmpName).Igmp().
+		Interface(dut.Port(t, port).Name()).Group(group).State()
+	_, ok := gnmi.Watch(t, dut, q, time.Minute, func(v *ygnmi.Value[*oc.NetworkInstance_Protocol_Igmp_Interface_Group]) bool {
+		return v.IsPresent() == present
+	}).Await(t)
+	if !ok {
+		t.Fatalf("IGMP group %s on %s: got present %t, want %t", group, port, !present, present)
+	}
+}
+
+func TestPIMSM(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	configureDUT(t, dut)
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.StartCapture(t, ate.OTG())
+	sendFlow(t, ate, "ate4-hello")
+
+	pim := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_PIM, pimName).Pim()
+	rs := receivers(t, ate)
+	stream := source(t, ate)
+
+	t.Run("Neighbor", func(t *testing.T) {
+		awaitNeighbor(t, dut)
+		for _, port := range []string{"port1", "port2", "port3", "port4"} {
+			name := dut.Port(t, port).Name()
+			if got := gnmi.Get(t, dut, pim.Interface(name).Mode().State()); got != oc.PimTypes_PIM_MODE_PIM_MODE_SPARSE {
+				t.Errorf("PIM mode of %s: got %v, want %v", name, got, oc.PimTypes_PIM_MODE_PIM_MODE_SPARSE)
+			}
+		}
+		if got := gnmi.Get(t, dut, pim.Global().RendezvousPoint(ate4.IPv4).MulticastGroups().State()); got != rpGroups {
+			t.Errorf("Multicast groups of RP %s: got %s, want %s", ate4.IPv4, got, rpGroups)
+		}
+	})
+
+	t.Run("StarGJoin", func(t *testing.T) {
+		mcast.Join(t, ate, rs[0], mcastGroup)
+		awaitIGMPGroup(t, dut, rs[0].Port.ID(), true)
+		// The DUT sends the (*,G) join as soon as the receiver joins, allow
+		// a few seconds for it to be captured.
+		time.Sleep(5 * time.Second)
+		otgutils.StopCapture(t, ate.OTG())
+
+		var found bool
+		for _, j := range parseJoins(otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port4").ID())) {
+			t.Logf("Captured join of (%s, %s) with flags %#x to %s", j.source, j.group, j.flags, j.upstream)
+			if j.group.Equal(net.ParseIP(group)) && j.source.Equal(net.ParseIP(ate4.IPv4)) && j.flags&(wcBit|rptBit) == wcBit|rptBit {
+				found = true
+				if !j.upstream.Equal(net.ParseIP(ate4.IPv4)) {
+					t.Errorf("(*, %s) join: got upstream neighbor %s, want %s", group, j.upstream, ate4.IPv4)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("No (*, %s) join towards RP %s captured", group, ate4.IPv4)
+		}
+	})
+
+	// The first packets of the source may be dropped while the DUT creates
+	// its (S,G) state, so the source is sent once before its replication is
+	// verified.
+	sendFlow(t, ate, stream.Name)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+
+	for _, tc := range []struct {
+		desc        string
+		join, leave []*mcast.Receiver
+		joined      []*mcast.Receiver
+	}{{
+		desc:   "OneReceiver",
+		joined: rs[:1],
+	}, {
+		desc:   "TwoReceivers",
+		join:   rs[1:],
+		joined: rs,
+	}, {
+		desc:   "ReceiverLeft",
+		leave:  rs[1:],
+		joined: rs[:1],
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			for _, r := range tc.join {
+				mcast.Join(t, ate, r, mcastGroup)
+			}
+			for _, r := range tc.leave {
+				mcast.Leave(t, ate, r, mcastGroup)
+			}
+			var joined []string
+			for _, r := range rs {
+				present := slices.Contains(tc.joined, r)
+				awaitIGMPGroup(t, dut, r.Port.ID(), present)
+				if present {
+					joined = append(joined, r.Host.Name)
+				}
+			}
+			mcast.Verify(t, ate, []*mcast.Stream{stream}, rs, mcast.Joined{stream.Name: joined})
+
+			src, ok := gnmi.Lookup(t, dut, pim.Global().Source(ate1.IPv4).State()).Val()
+			if !ok {
+				t.Fatalf("PIM (%s, %s) state not found", ate1.IPv4, group)
+			}
+			if got := src.GetGroup(); got != group {
+				t.Errorf("PIM source %s: got group %s, want %s", ate1.IPv4, got, group)
+			}
+			if got, want := src.GetUpstreamInterfaceId(), dut.Port(t, "port1").Name(); got != want {
+				t.Errorf("PIM (%s, %s): got upstream interface %s, want %s", ate1.IPv4, group, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google_discovery_protocol_punt_inject_test
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/featureprofiles/internal/p4rtutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+)
+
+var (
+	p4InfoFile = flag.String("p4info_file_location", "../../wbb.p4info.pb.txt", "Path to the p4info file.")
+)
+
+const (
+	ipv4PrefixLen  = 30
+	deviceID       = 1
+	portID         = 10
+	electionID     = 100
+	pipelineCookie = 159
+	// packetCount is the number of packets sent by the ATE, and of each
+	// PacketOut.
+	packetCount = 100
+	frameRate   = 10
+	frameSize   = 300
+	// The IDs of the ingress_port and target_egress_port metadata of
+	// packet_in, and of the egress_port and submit_to_ingress metadata of
+	// packet_out, in the p4info file.
+	metadataIngressPort      = 1
+	metadataTargetEgressPort = 2
+	metadataEgressPort       = 1
+	metadataSubmitToIngress  = 2
+	// minReceived is the fraction of the packets sent which must be
+	// received.
+	minReceived = 0.95
+
+	gdpEtherType layers.EthernetType = 0x6007
+	gdpMAC                           = "00:0a:da:f0:f0:f0"
+	// routingMAC is the router MAC of the DUT, which is the destination of
+	// the packets submitted to ingress to be routed.
+	routingMAC = "02:f6:65:64:00:08"
+	// packetOutMAC is the source MAC of the PacketOut frames, and
+	// packetOutSrcPort the source TCP port of the routed PacketOut packets,
+	// which identify them in the captures.
+	packetOutMAC     = "00:aa:00:aa:00:aa"
+	packetOutSrcPort = 10000
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:11:01:00:00:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:12:01:00:00:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+	}
+)
+
+// port is a DUT port connected to the ATE, with the P4RT port ID configured
+// on the DUT.
+type port struct {
+	name     string
+	id       uint32
+	dut, ate *attrs.Attributes
+}
+
+var ports = []port{
+	{name: "port1", id: portID, dut: &dutPort1, ate: &atePort1},
+	{name: "port2", id: portID + 1, dut: &dutPort2, ate: &atePort2},
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the ports of the DUT with their P4RT port IDs, and
+// the router MAC of the DUT.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for _, p := range ports {
+		dp := dut.Port(t, p.name)
+		i := p.dut.NewOCInterface(dp.Name(), dut)
+		i.Id = ygot.Uint32(p.id)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), i)
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+	}
+	gnmi.Replace(t, dut, gnmi.OC().System().MacAddress().RoutingMac().Config(), routingMAC)
+}
+
+// configureDeviceID configures the P4RT device ID on the node of the ports of
+// the DUT.
+func configureDeviceID(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	nodes := p4rtutils.P4RTNodesByPort(t, dut)
+	node, ok := nodes[ports[0].name]
+	if !ok {
+		t.Fatalf("Couldn't find P4RT Node for port: %s", ports[0].name)
+	}
+	for _, p := range ports[1:] {
+		if nodes[p.name] != node {
+			t.Fatalf("Ports %s and %s are on P4RT nodes %q and %q, want the same node", ports[0].name, p.name, node, nodes[p.name])
+		}
+	}
+	t.Logf("Configuring P4RT Node: %s", node)
+	c := &oc.Component{Name: ygot.String(node)}
+	c.GetOrCreateIntegratedCircuit().NodeId = ygot.Uint64(deviceID)
+	gnmi.Replace(t, dut, gnmi.OC().Component(node).Config(), c)
+}
+
+// configureATE configures the ports of the ATE with a capture, and a GDP flow
+// sent on port1.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	for _, p := range ports {
+		ap := ate.Port(t, p.name)
+		p.ate.AddToOTG(top, ap, p.dut)
+		top.Captures().Add().SetName(p.name + "Capture").SetPortNames([]string{ap.ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	}
+	ap := ate.Port(t, ports[0].name)
+	flow := top.Flows().Add().SetName("GDP")
+	flow.TxRx().Port().SetTxName(ap.ID()).SetRxName(ap.ID())
+	flow.Metrics().SetEnable(true)
+	eth := flow.Packet().Add().Ethernet()
+	eth.Src().SetValue(ports[0].ate.MAC)
+	eth.Dst().SetValue(gdpMAC)
+	eth.EtherType().SetValue(uint32(gdpEtherType))
+	flow.Size().SetFixed(frameSize)
+	flow.Rate().SetPps(frameRate)
+	flow.Duration().FixedPackets().SetPackets(packetCount)
+	return top
+}
+
+// programEntry inserts or deletes the acl_wbb_ingress_table entry punting
+// GDP.
+func programEntry(c *p4rtutils.Client, typ p4_v1.Update_Type) error {
+	return c.WriteUpdates(p4rtutils.ACLWbbIngressTableEntryGet([]*p4rtutils.ACLWbbIngressTableEntryInfo{{
+		Type:          typ,
+		EtherType:     uint16(gdpEtherType),
+		EtherTypeMask: 0xFFFF,
+		Priority:      1,
+	}}))
+}
+
+// serialize returns the frame made of ls.
+func serialize(t *testing.T, ls ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ls...); err != nil {
+		t.Fatalf("Cannot serialize packet: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// mustParseMAC returns the MAC address s.
+func mustParseMAC(t *testing.T, s string) net.HardwareAddr {
+	t.Helper()
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		t.Fatalf("Cannot parse MAC %q: %v", s, err)
+	}
+	return mac
+}
+
+// gdpFrame returns a GDP frame from packetOutMAC.
+func gdpFrame(t *testing.T) []byte {
+	t.Helper()
+	payload := make(gopacket.Payload, 64)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	eth := &layers.Ethernet{
+		SrcMAC:       mustParseMAC(t, packetOutMAC),
+		DstMAC:       mustParseMAC(t, gdpMAC),
+		EthernetType: gdpEtherType,
+	}
+	return serialize(t, eth, payload)
+}
+
+// ipv4Frame returns an IPv4 TCP packet from packetOutMAC to routingMAC, from
+// atePort1 to atePort2.
+func ipv4Frame(t *testing.T) []byte {
+	t.Helper()
+	eth := &layers.Ethernet{
+		SrcMAC:       mustParseMAC(t, packetOutMAC),
+		DstMAC:       mustParseMAC(t, routingMAC),
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.ParseIP(atePort1.IPv4),
+		DstIP:    net.ParseIP(atePort2.IPv4),
+	}
+	tcp := &layers.TCP{SrcPort: packetOutSrcPort, DstPort: 20000, Seq: 11050}
+	tcp.SetNetworkLayerForChecksum(ip)
+	return serialize(t, eth, ip, tcp, gopacket.Payload(make([]byte, 64)))
+}
+
+// isPacketOut returns whether pkt is one of the PacketOut frames, or a routed
+// PacketOut packet.
+func isPacketOut(pkt gopacket.Packet) bool {
+	if eth, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok && strings.EqualFold(eth.SrcMAC.String(), packetOutMAC) {
+		return true
+	}
+	tcp, ok := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	return ok && tcp.SrcPort == packetOutSrcPort
+}
+
+// testPacketIn sends GDP frames from atePort1, and verifies that they are
+// received as PacketIn with the expected metadata.
+func testPacketIn(t *testing.T, ate *ondatra.ATEDevice, c *p4rtutils.Client) {
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packetCount/frameRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+
+	sent := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow("GDP").Counters().OutPkts().State())
+	if sent == 0 {
+		t.Fatalf("No GDP packets sent by the ATE")
+	}
+	packets, err := c.PacketsIn(sent, 30*time.Second)
+	if err != nil {
+		t.Errorf("Error fetching PacketIn messages: %v", err)
+	}
+
+	want := map[uint32]string{
+		metadataIngressPort:      fmt.Sprint(ports[0].id),
+		metadataTargetEgressPort: "0",
+	}
+	var got uint64
+	for _, pkt := range packets {
+		eth, ok := gopacket.NewPacket(pkt.GetPayload(), layers.LayerTypeEthernet, gopacket.Default).Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+		if !ok || eth.EthernetType != gdpEtherType || !strings.EqualFold(eth.SrcMAC.String(), ports[0].ate.MAC) {
+			continue
+		}
+		got++
+		md := map[uint32]string{}
+		for _, m := range pkt.GetMetadata() {
+			if _, ok := md[m.GetMetadataId()]; ok {
+				t.Errorf("PacketIn has metadata %d more than once", m.GetMetadataId())
+			}
+			md[m.GetMetadataId()] = string(m.GetValue())
+		}
+		for id, w := range want {
+			if v, ok := md[id]; !ok || v != w {
+				t.Errorf("PacketIn metadata %d: got %q (present %t), want %q", id, v, ok, w)
+			}
+		}
+		if len(md) != len(want) {
+			t.Errorf("PacketIn metadata: got %v, want %v", md, want)
+		}
+	}
+	t.Logf("%d GDP packets sent, %d PacketIn received", sent, got)
+	if got < uint64(float64(sent)*minReceived) {
+		t.Errorf("GDP PacketIn: got %d, want at least %.0f%% of %d", got, minReceived*100, sent)
+	}
+}
+
+// testPacketOut sends PacketOut with direct egress or submitted to ingress,
+// and verifies on which ATE port they are received, and whether they are
+// punted back.
+func testPacketOut(t *testing.T, ate *ondatra.ATEDevice, c *p4rtutils.Client) {
+	tests := []struct {
+		desc     string
+		payload  []byte
+		metadata *p4_v1.PacketMetadata
+		// wantPort is the ATE port on which the packets must be received,
+		// or empty if they must not be received on any port.
+		wantPort string
+		// wantPacketIn is whether the packets must be punted back as
+		// PacketIn.
+		wantPacketIn bool
+	}{{
+		desc:     "GDP direct egress",
+		payload:  gdpFrame(t),
+		metadata: &p4_v1.PacketMetadata{MetadataId: metadataEgressPort, Value: []byte(fmt.Sprint(ports[1].id))},
+		wantPort: ports[1].name,
+	}, {
+		desc:         "GDP submit to ingress",
+		payload:      gdpFrame(t),
+		metadata:     &p4_v1.PacketMetadata{MetadataId: metadataSubmitToIngress, Value: []byte{1}},
+		wantPacketIn: true,
+	}, {
+		desc:     "IPv4 submit to ingress",
+		payload:  ipv4Frame(t),
+		metadata: &p4_v1.PacketMetadata{MetadataId: metadataSubmitToIngress, Value: []byte{1}},
+		wantPort: ports[1].name,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			// Drain the PacketIn messages received so far.
+			if _, err := c.PacketsIn(0, time.Second); err != nil {
+				t.Fatalf("Error fetching PacketIn messages: %v", err)
+			}
+			otgutils.StartCapture(t, ate.OTG())
+			for i := 0; i < packetCount; i++ {
+				if err := c.SendPacketOut(tc.payload, tc.metadata); err != nil {
+					t.Fatalf("Error sending PacketOut: %v", err)
+				}
+			}
+			time.Sleep(10 * time.Second)
+			otgutils.StopCapture(t, ate.OTG())
+
+			for _, p := range ports {
+				got := 0
+				for _, pkt := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, p.name).ID()) {
+					if isPacketOut(pkt) {
+						got++
+					}
+				}
+				t.Logf("%d packets received on ATE %s", got, p.name)
+				switch {
+				case p.name == tc.wantPort && float64(got) < packetCount*minReceived:
+					t.Errorf("Packets received on ATE %s: got %d, want at least %.0f%% of %d", p.name, got, minReceived*100, packetCount)
+				case p.name != tc.wantPort && got != 0:
+					t.Errorf("Packets received on ATE %s: got %d, want 0", p.name, got)
+				}
+			}
+
+			wait := uint64(0)
+			if tc.wantPacketIn {
+				wait = packetCount
+			}
+			packets, err := c.PacketsIn(wait, 30*time.Second)
+			if err != nil && tc.wantPacketIn {
+				t.Errorf("Error fetching PacketIn messages: %v", err)
+			}
+			got := 0
+			for _, pkt := range packets {
+				if isPacketOut(gopacket.NewPacket(pkt.GetPayload(), layers.LayerTypeEthernet, gopacket.Default)) {
+					got++
+				}
+			}
+			t.Logf("%d packets punted back as PacketIn", got)
+			switch {
+			case tc.wantPacketIn && float64(got) < packetCount*minReceived:
+				t.Errorf("PacketIn: got %d, want at least %.0f%% of %d", got, minReceived*100, packetCount)
+			case !tc.wantPacketIn && got != 0:
+				t.Errorf("PacketIn: got %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestGDP(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	configureDUT(t, dut)
+	configureDeviceID(t, dut)
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+	c := p4rtutils.NewClient(t, dut, deviceID, electionID)
+	if primary, err := c.Arbitrate(); err != nil || !primary {
+		t.Fatalf("Could not become the primary P4RT client: primary %t, error %v", primary, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.LoadPipeline(*p4InfoFile, pipelineCookie); err != nil {
+		t.Fatalf("Could not set the forwarding pipeline config: %v", err)
+	}
+	if err := programEntry(c, p4_v1.Update_INSERT); err != nil {
+		t.Fatalf("Could not insert the GDP table entry: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := programEntry(c, p4_v1.Update_DELETE); err != nil {
+			t.Errorf("Could not delete the GDP table entry: %v", err)
+		}
+	})
+
+	t.Run("PacketIn", func(t *testing.T) { testPacketIn(t, ate, c) })
+	t.Run("PacketOut", func(t *testing.T) { testPacketOut(t, ate, c) })
+}
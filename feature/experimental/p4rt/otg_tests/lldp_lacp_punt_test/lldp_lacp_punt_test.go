@@ -0,0 +1,407 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lldp_lacp_punt_test
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/featureprofiles/internal/p4rtutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+)
+
+var (
+	p4InfoFile = flag.String("p4info_file_location", "../../wbb.p4info.pb.txt", "Path to the p4info file.")
+)
+
+const (
+	ipv4PrefixLen  = 30
+	deviceID       = 1
+	portID         = 10
+	electionID     = 100
+	pipelineCookie = 159
+	// packetCount is the number of packets sent per protocol and port, either
+	// by the ATE or as PacketOut.
+	packetCount = 100
+	frameRate   = 10
+	frameSize   = 300
+	// metadataIngressPort is the ID of the ingress_port metadata of
+	// packet_in, and metadataEgressPort the ID of the egress_port metadata
+	// of packet_out, in the p4info file.
+	metadataIngressPort = 1
+	metadataEgressPort  = 1
+	// minReceived is the fraction of the packets sent which must be
+	// received.
+	minReceived = 0.95
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:11:01:00:00:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:12:01:00:00:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+	}
+)
+
+// port is a DUT port connected to the ATE, with the P4RT port ID configured
+// on the DUT.
+type port struct {
+	name     string
+	id       uint32
+	dut, ate *attrs.Attributes
+	// packetOutMAC is the source MAC of the PacketOut frames sent to the
+	// port, which identifies them in the captures.
+	packetOutMAC string
+}
+
+var ports = []port{
+	{name: "port1", id: portID, dut: &dutPort1, ate: &atePort1, packetOutMAC: "00:aa:00:aa:00:01"},
+	{name: "port2", id: portID + 1, dut: &dutPort2, ate: &atePort2, packetOutMAC: "00:aa:00:aa:00:02"},
+}
+
+// protocol is a link-layer control protocol punted to the controller.
+type protocol struct {
+	name      string
+	dstMAC    string
+	etherType layers.EthernetType
+	// pdu returns the payload of the Ethernet frames sent as PacketOut.
+	pdu func() gopacket.SerializableLayer
+}
+
+var protocols = []protocol{{
+	name:      "LLDP",
+	dstMAC:    "01:80:c2:00:00:0e",
+	etherType: layers.EthernetTypeLinkLayerDiscovery,
+	pdu:       lldpPDU,
+}, {
+	name:      "LACP",
+	dstMAC:    "01:80:c2:00:00:02",
+	etherType: 0x8809, // Slow protocols.
+	pdu:       lacpPDU,
+}}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// lldpPDU returns an LLDPDU with the mandatory TLVs.
+func lldpPDU() gopacket.SerializableLayer {
+	return &layers.LinkLayerDiscovery{
+		ChassisID: layers.LLDPChassisID{
+			Subtype: layers.LLDPChassisIDSubTypeMACAddr,
+			ID:      []byte{0x01, 0x01, 0x01, 0x01, 0x01, 0x01},
+		},
+		PortID: layers.LLDPPortID{
+			Subtype: layers.LLDPPortIDSubtypeIfaceName,
+			ID:      []byte("port1"),
+		},
+		TTL: 100,
+	}
+}
+
+// lacpPDU returns an LACPDU of 110 bytes with its header and the header of the
+// actor information TLV, the remaining fields being zero.
+func lacpPDU() gopacket.SerializableLayer {
+	pdu := make(gopacket.Payload, 110)
+	pdu[0], pdu[1] = 0x01, 0x01 // Subtype LACP, version 1.
+	pdu[2], pdu[3] = 0x01, 0x14 // Actor information TLV.
+	return pdu
+}
+
+// frame returns the Ethernet frame of proto from srcMAC sent as PacketOut.
+func frame(t *testing.T, proto protocol, srcMAC string) []byte {
+	t.Helper()
+	src, err := net.ParseMAC(srcMAC)
+	if err != nil {
+		t.Fatalf("Cannot parse MAC %q: %v", srcMAC, err)
+	}
+	dst, err := net.ParseMAC(proto.dstMAC)
+	if err != nil {
+		t.Fatalf("Cannot parse MAC %q: %v", proto.dstMAC, err)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	eth := &layers.Ethernet{SrcMAC: src, DstMAC: dst, EthernetType: proto.etherType}
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, eth, proto.pdu()); err != nil {
+		t.Fatalf("Cannot serialize %s frame: %v", proto.name, err)
+	}
+	return buf.Bytes()
+}
+
+// configureDUT configures the ports of the DUT with their P4RT port IDs, and
+// disables the on-box processing of LLDP.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for _, p := range ports {
+		dp := dut.Port(t, p.name)
+		i := p.dut.NewOCInterface(dp.Name(), dut)
+		i.Id = ygot.Uint32(p.id)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), i)
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+	}
+	gnmi.Replace(t, dut, gnmi.OC().Lldp().Enabled().Config(), false)
+}
+
+// configureDeviceID configures the P4RT device ID on the node of the ports of
+// the DUT.
+func configureDeviceID(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	nodes := p4rtutils.P4RTNodesByPort(t, dut)
+	node, ok := nodes[ports[0].name]
+	if !ok {
+		t.Fatalf("Couldn't find P4RT Node for port: %s", ports[0].name)
+	}
+	for _, p := range ports[1:] {
+		if nodes[p.name] != node {
+			t.Fatalf("Ports %s and %s are on P4RT nodes %q and %q, want the same node", ports[0].name, p.name, node, nodes[p.name])
+		}
+	}
+	t.Logf("Configuring P4RT Node: %s", node)
+	c := &oc.Component{Name: ygot.String(node)}
+	c.GetOrCreateIntegratedCircuit().NodeId = ygot.Uint64(deviceID)
+	gnmi.Replace(t, dut, gnmi.OC().Component(node).Config(), c)
+}
+
+// flowName returns the name of the ATE flow of proto sent on p.
+func flowName(proto protocol, p port) string {
+	return proto.name + "-" + p.name
+}
+
+// configureATE configures the ports of the ATE with a capture, and a flow of
+// each protocol sent on each port.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	for _, p := range ports {
+		ap := ate.Port(t, p.name)
+		p.ate.AddToOTG(top, ap, p.dut)
+		top.Captures().Add().SetName(p.name + "Capture").SetPortNames([]string{ap.ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+		for _, proto := range protocols {
+			flow := top.Flows().Add().SetName(flowName(proto, p))
+			flow.TxRx().Port().SetTxName(ap.ID()).SetRxName(ap.ID())
+			flow.Metrics().SetEnable(true)
+			eth := flow.Packet().Add().Ethernet()
+			eth.Src().SetValue(p.ate.MAC)
+			eth.Dst().SetValue(proto.dstMAC)
+			eth.EtherType().SetValue(uint32(proto.etherType))
+			flow.Size().SetFixed(frameSize)
+			flow.Rate().SetPps(frameRate)
+			flow.Duration().FixedPackets().SetPackets(packetCount)
+		}
+	}
+	return top
+}
+
+// programEntries inserts or deletes the acl_wbb_ingress_table entries
+// punting the protocols.
+func programEntries(c *p4rtutils.Client, typ p4_v1.Update_Type) error {
+	var infos []*p4rtutils.ACLWbbIngressTableEntryInfo
+	for _, proto := range protocols {
+		infos = append(infos, &p4rtutils.ACLWbbIngressTableEntryInfo{
+			Type:          typ,
+			EtherType:     uint16(proto.etherType),
+			EtherTypeMask: 0xFFFF,
+			Priority:      1,
+		})
+	}
+	return c.WriteUpdates(p4rtutils.ACLWbbIngressTableEntryGet(infos))
+}
+
+// ethernet returns the Ethernet header of pkt, or nil if it has none.
+func ethernet(pkt gopacket.Packet) *layers.Ethernet {
+	if l, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+		return l
+	}
+	return nil
+}
+
+// testPacketIn sends the flows of the ATE, and verifies that they are received
+// as PacketIn with the ID of the port they were sent on as ingress_port.
+func testPacketIn(t *testing.T, ate *ondatra.ATEDevice, c *p4rtutils.Client) {
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packetCount/frameRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+
+	sent := map[string]uint64{}
+	var total uint64
+	for _, p := range ports {
+		for _, proto := range protocols {
+			name := flowName(proto, p)
+			sent[name] = gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(name).Counters().OutPkts().State())
+			total += sent[name]
+		}
+	}
+	packets, err := c.PacketsIn(total, 30*time.Second)
+	if err != nil {
+		t.Errorf("Error fetching PacketIn messages: %v", err)
+	}
+
+	got := map[string]uint64{}
+	for _, p := range ports {
+		for _, proto := range protocols {
+			name := flowName(proto, p)
+			for _, pkt := range packets {
+				eth := ethernet(gopacket.NewPacket(pkt.GetPayload(), layers.LayerTypeEthernet, gopacket.Default))
+				if eth == nil || eth.EthernetType != proto.etherType || !strings.EqualFold(eth.SrcMAC.String(), p.ate.MAC) {
+					continue
+				}
+				got[name]++
+				for _, md := range pkt.GetMetadata() {
+					if md.GetMetadataId() != metadataIngressPort {
+						continue
+					}
+					if want := fmt.Sprint(p.id); string(md.GetValue()) != want {
+						t.Errorf("%s PacketIn ingress_port: got %q, want %q", name, md.GetValue(), want)
+					}
+				}
+			}
+		}
+	}
+
+	for _, p := range ports {
+		for _, proto := range protocols {
+			name := flowName(proto, p)
+			t.Run(name, func(t *testing.T) {
+				t.Logf("%s: %d packets sent, %d PacketIn received", name, sent[name], got[name])
+				if sent[name] == 0 {
+					t.Fatalf("No packets sent by flow %s", name)
+				}
+				if got[name] < uint64(float64(sent[name])*minReceived) {
+					t.Errorf("%s PacketIn: got %d, want at least %.0f%% of %d", name, got[name], minReceived*100, sent[name])
+				}
+			})
+		}
+	}
+}
+
+// testPacketOut sends PacketOut frames of each protocol to each port, and
+// verifies that they egress the requested port only.
+func testPacketOut(t *testing.T, ate *ondatra.ATEDevice, c *p4rtutils.Client) {
+	otgutils.StartCapture(t, ate.OTG())
+	for _, p := range ports {
+		for _, proto := range protocols {
+			payload := frame(t, proto, p.packetOutMAC)
+			for i := 0; i < packetCount; i++ {
+				if err := c.SendPacketOut(payload, &p4_v1.PacketMetadata{
+					MetadataId: metadataEgressPort,
+					Value:      []byte(fmt.Sprint(p.id)),
+				}); err != nil {
+					t.Fatalf("Error sending %s PacketOut to %s: %v", proto.name, p.name, err)
+				}
+			}
+		}
+	}
+	time.Sleep(10 * time.Second)
+	otgutils.StopCapture(t, ate.OTG())
+
+	// received counts the frames captured on each ATE port per protocol and
+	// PacketOut source MAC.
+	received := map[string]map[string]int{}
+	for _, ap := range ports {
+		received[ap.name] = map[string]int{}
+		for _, pkt := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, ap.name).ID()) {
+			eth := ethernet(pkt)
+			if eth == nil {
+				continue
+			}
+			received[ap.name][eth.EthernetType.String()+"/"+eth.SrcMAC.String()]++
+		}
+	}
+
+	for _, p := range ports {
+		for _, proto := range protocols {
+			t.Run(flowName(proto, p), func(t *testing.T) {
+				key := proto.etherType.String() + "/" + p.packetOutMAC
+				for _, ap := range ports {
+					got := received[ap.name][key]
+					t.Logf("%s PacketOut to %s: %d frames received on ATE %s", proto.name, p.name, got, ap.name)
+					switch {
+					case ap.name == p.name && float64(got) < packetCount*minReceived:
+						t.Errorf("%s PacketOut to %s: got %d frames, want at least %.0f%% of %d", proto.name, p.name, got, minReceived*100, packetCount)
+					case ap.name != p.name && got != 0:
+						t.Errorf("%s PacketOut to %s: got %d frames on %s, want 0", proto.name, p.name, got, ap.name)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPunt(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	configureDUT(t, dut)
+	configureDeviceID(t, dut)
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+
+	c := p4rtutils.NewClient(t, dut, deviceID, electionID)
+	if primary, err := c.Arbitrate(); err != nil || !primary {
+		t.Fatalf("Could not become the primary P4RT client: primary %t, error %v", primary, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.LoadPipeline(*p4InfoFile, pipelineCookie); err != nil {
+		t.Fatalf("Could not set the forwarding pipeline config: %v", err)
+	}
+	if err := programEntries(c, p4_v1.Update_INSERT); err != nil {
+		t.Fatalf("Could not insert the punt table entries: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := programEntries(c, p4_v1.Update_DELETE); err != nil {
+			t.Errorf("Could not delete the punt table entries: %v", err)
+		}
+	})
+
+	t.Run("PacketIn", func(t *testing.T) { testPacketIn(t, ate, c) })
+	t.Run("PacketOut", func(t *testing.T) { testPacketOut(t, ate, c) })
+}
@@ -0,0 +1,269 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p4rt_id_test
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/p4rtutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+)
+
+var (
+	p4InfoFile = flag.String("p4info_file_location", "../../wbb.p4info.pb.txt", "Path to the p4info file.")
+)
+
+const (
+	ipv4PrefixLen = 30
+	// firstNodeID and firstPortID are the first P4RT node and port IDs
+	// configured on the DUT.
+	firstNodeID    = 1
+	firstPortID    = 10
+	electionID     = 100
+	pipelineCookie = 159
+	// packetCount is the number of packets sent from each ATE port.
+	packetCount = 100
+	frameRate   = 10
+	frameSize   = 300
+	// metadataIngressPort is the ID of the ingress_port metadata of
+	// packet_in in the p4info file.
+	metadataIngressPort = 1
+	// minReceived is the fraction of the packets sent which must be punted.
+	minReceived = 0.95
+
+	gdpEtherType layers.EthernetType = 0x6007
+	gdpMAC                           = "00:0a:da:f0:f0:f0"
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:11:01:00:00:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:12:01:00:00:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+	}
+)
+
+// port is a DUT port connected to the ATE.
+type port struct {
+	name     string
+	dut, ate *attrs.Attributes
+}
+
+var ports = []port{
+	{name: "port1", dut: &dutPort1, ate: &atePort1},
+	{name: "port2", dut: &dutPort2, ate: &atePort2},
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the ports of the DUT, without their P4RT IDs.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for _, p := range ports {
+		dp := dut.Port(t, p.name)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.dut.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+	}
+}
+
+// configureATE configures the ports of the ATE, with a GDP flow sent on each
+// port.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	for _, p := range ports {
+		ap := ate.Port(t, p.name)
+		p.ate.AddToOTG(top, ap, p.dut)
+		flow := top.Flows().Add().SetName("GDP-" + p.name)
+		flow.TxRx().Port().SetTxName(ap.ID()).SetRxName(ap.ID())
+		flow.Metrics().SetEnable(true)
+		eth := flow.Packet().Add().Ethernet()
+		eth.Src().SetValue(p.ate.MAC)
+		eth.Dst().SetValue(gdpMAC)
+		eth.EtherType().SetValue(uint32(gdpEtherType))
+		flow.Size().SetFixed(frameSize)
+		flow.Rate().SetPps(frameRate)
+		flow.Duration().FixedPackets().SetPackets(packetCount)
+	}
+	return top
+}
+
+// programEntry inserts or deletes the acl_wbb_ingress_table entry punting GDP
+// with c.
+func programEntry(c *p4rtutils.Client, typ p4_v1.Update_Type) error {
+	return c.WriteUpdates(p4rtutils.ACLWbbIngressTableEntryGet([]*p4rtutils.ACLWbbIngressTableEntryInfo{{
+		Type:          typ,
+		EtherType:     uint16(gdpEtherType),
+		EtherTypeMask: 0xFFFF,
+		Priority:      1,
+	}}))
+}
+
+// connect returns a primary client for each P4RT device of ids, by device
+// ID, with the forwarding pipeline config pushed and the GDP entry
+// installed.
+func connect(t *testing.T, dut *ondatra.DUTDevice, ids map[string]p4rtutils.PortIDs) map[uint64]*p4rtutils.Client {
+	t.Helper()
+	clients := map[uint64]*p4rtutils.Client{}
+	for _, id := range ids {
+		if _, ok := clients[id.NodeID]; ok {
+			continue
+		}
+		c := p4rtutils.NewClient(t, dut, id.NodeID, electionID)
+		if primary, err := c.Arbitrate(); err != nil || !primary {
+			t.Fatalf("Could not become the primary P4RT client of device %d (%s): primary %t, error %v", id.NodeID, id.Node, primary, err)
+		}
+		t.Cleanup(func() { c.Close() })
+		if err := c.LoadPipeline(*p4InfoFile, pipelineCookie); err != nil {
+			t.Fatalf("Could not set the forwarding pipeline config of device %d: %v", id.NodeID, err)
+		}
+		if err := programEntry(c, p4_v1.Update_INSERT); err != nil {
+			t.Fatalf("Could not insert the GDP table entry on device %d: %v", id.NodeID, err)
+		}
+		t.Cleanup(func() {
+			if err := programEntry(c, p4_v1.Update_DELETE); err != nil {
+				t.Errorf("Could not delete the GDP table entry on device %d: %v", c.DeviceID, err)
+			}
+		})
+		clients[id.NodeID] = c
+	}
+	return clients
+}
+
+// testTelemetry verifies that the configured P4RT IDs are reported in the
+// state of the interfaces and of the integrated circuits.
+func testTelemetry(t *testing.T, dut *ondatra.DUTDevice, ids map[string]p4rtutils.PortIDs) {
+	for _, p := range ports {
+		id, ok := ids[p.name]
+		if !ok {
+			t.Errorf("No P4RT IDs configured for %s", p.name)
+			continue
+		}
+		name := dut.Port(t, p.name).Name()
+		if v, ok := gnmi.Await(t, dut, gnmi.OC().Interface(name).Id().State(), time.Minute, id.PortID).Val(); !ok || v != id.PortID {
+			t.Errorf("Interface %s id: got %d (present %t), want %d", name, v, ok, id.PortID)
+		}
+		if v, ok := gnmi.Await(t, dut, gnmi.OC().Component(id.Node).IntegratedCircuit().NodeId().State(), time.Minute, id.NodeID).Val(); !ok || v != id.NodeID {
+			t.Errorf("Component %s node-id: got %d (present %t), want %d", id.Node, v, ok, id.NodeID)
+		}
+	}
+}
+
+// testPacketIn sends GDP frames from each ATE port, and verifies that they are
+// received by the client of the device of the port as PacketIn with the port
+// ID of the port as ingress_port.
+func testPacketIn(t *testing.T, ate *ondatra.ATEDevice, ids map[string]p4rtutils.PortIDs, clients map[uint64]*p4rtutils.Client) {
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packetCount/frameRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+
+	// sent are the numbers of packets sent per flow, and packets the
+	// PacketIn messages received by the clients, by device ID.
+	sent := map[string]uint64{}
+	perDevice := map[uint64]uint64{}
+	for _, p := range ports {
+		sent[p.name] = gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow("GDP-"+p.name).Counters().OutPkts().State())
+		perDevice[ids[p.name].NodeID] += sent[p.name]
+	}
+	packets := map[uint64][]*p4_v1.PacketIn{}
+	for nodeID, c := range clients {
+		pkts, err := c.PacketsIn(perDevice[nodeID], 30*time.Second)
+		if err != nil {
+			t.Errorf("Error fetching PacketIn messages of device %d: %v", nodeID, err)
+		}
+		packets[nodeID] = pkts
+	}
+
+	for _, p := range ports {
+		t.Run(p.name, func(t *testing.T) {
+			id := ids[p.name]
+			sent := sent[p.name]
+			if sent == 0 {
+				t.Fatalf("No packets sent by flow GDP-%s", p.name)
+			}
+			var got uint64
+			for _, pkt := range packets[id.NodeID] {
+				eth, ok := gopacket.NewPacket(pkt.GetPayload(), layers.LayerTypeEthernet, gopacket.Default).Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+				if !ok || eth.EthernetType != gdpEtherType || !strings.EqualFold(eth.SrcMAC.String(), p.ate.MAC) {
+					continue
+				}
+				got++
+				for _, md := range pkt.GetMetadata() {
+					if md.GetMetadataId() != metadataIngressPort {
+						continue
+					}
+					if want := fmt.Sprint(id.PortID); string(md.GetValue()) != want {
+						t.Errorf("PacketIn ingress_port: got %q, want %q", md.GetValue(), want)
+					}
+				}
+			}
+			t.Logf("%d packets sent, %d PacketIn received by device %d", sent, got, id.NodeID)
+			if got < uint64(float64(sent)*minReceived) {
+				t.Errorf("PacketIn: got %d, want at least %.0f%% of %d", got, minReceived*100, sent)
+			}
+		})
+	}
+}
+
+func TestIDs(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	configureDUT(t, dut)
+	ids := p4rtutils.ConfigureIDs(t, dut, firstNodeID, firstPortID)
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+
+	t.Run("Telemetry", func(t *testing.T) { testTelemetry(t, dut, ids) })
+	clients := connect(t, dut, ids)
+	t.Run("PacketIn", func(t *testing.T) { testPacketIn(t, ate, ids, clients) })
+}
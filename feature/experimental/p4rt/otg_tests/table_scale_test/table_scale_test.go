@@ -0,0 +1,351 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table_scale_test
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cisco-open/go-p4/utils"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/p4rtutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	p4InfoFile = flag.String("p4info_file_location", "../../wbb.p4info.pb.txt", "Path to the p4info file.")
+	entryCount = flag.Int("entry_count", 0,
+		"number of acl_wbb_ingress_table entries installed; if 0, the size of the table in the p4info file")
+	batchSize = flag.Int("batch_size", 1,
+		"number of updates per write request")
+	iterations = flag.Int("iterations", 10,
+		"number of times the entries are installed and deleted to measure the write throughput")
+	minWriteRate = flag.Float64("min_write_rate", 0,
+		"minimum write throughput, in entries per second; if 0, the throughput is only logged")
+	sampleSize = flag.Int("sample_size", 4,
+		"number of installed entries whose dataplane behavior is verified")
+)
+
+const (
+	ipv4PrefixLen  = 30
+	firstNodeID    = 1
+	firstPortID    = 10
+	electionID     = 100
+	pipelineCookie = 159
+	// etherTypeBase is the ether type matched by the first entry, the
+	// following entries matching the next ether types.
+	etherTypeBase = 0xA000
+	// packetCount is the number of packets sent per sampled entry.
+	packetCount = 100
+	frameRate   = 10
+	frameSize   = 300
+	// minReceived is the fraction of the packets sent which must be punted.
+	minReceived = 0.95
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:11:01:00:00:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:12:01:00:00:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures port1 and port2 of the DUT.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for i, a := range []*attrs.Attributes{&dutPort1, &dutPort2} {
+		dp := dut.Port(t, fmt.Sprintf("port%d", i+1))
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), a.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+	}
+}
+
+// flowName returns the name of the ATE flow of the frames matched by the
+// entry for etherType.
+func flowName(etherType uint16) string {
+	return fmt.Sprintf("EtherType-%#04x", etherType)
+}
+
+// configureATE configures port1 and port2 of the ATE, with a flow sent on
+// port1 for each of etherTypes.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice, etherTypes []uint16) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	p1 := ate.Port(t, "port1")
+	atePort1.AddToOTG(top, p1, &dutPort1)
+	atePort2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+	for _, et := range etherTypes {
+		flow := top.Flows().Add().SetName(flowName(et))
+		flow.TxRx().Port().SetTxName(p1.ID()).SetRxName(p1.ID())
+		flow.Metrics().SetEnable(true)
+		eth := flow.Packet().Add().Ethernet()
+		eth.Src().SetValue(atePort1.MAC)
+		eth.Dst().SetValue(atePort2.MAC)
+		eth.EtherType().SetValue(uint32(et))
+		flow.Size().SetFixed(frameSize)
+		flow.Rate().SetPps(frameRate)
+		flow.Duration().FixedPackets().SetPackets(packetCount)
+	}
+	return top
+}
+
+// tableSize returns the size of acl_wbb_ingress_table in the p4info file.
+func tableSize(t *testing.T) int {
+	t.Helper()
+	p4Info, err := utils.P4InfoLoad(p4InfoFile)
+	if err != nil {
+		t.Fatalf("Could not load p4info file %q: %v", *p4InfoFile, err)
+	}
+	for _, tbl := range p4Info.GetTables() {
+		if tbl.GetPreamble().GetId() == p4rtutils.WbbTableMap["acl_wbb_ingress_table"] {
+			return int(tbl.GetSize())
+		}
+	}
+	t.Fatalf("No acl_wbb_ingress_table in p4info file %q", *p4InfoFile)
+	return 0
+}
+
+// entries returns n table entries, matching consecutive ether types from
+// etherTypeBase with distinct priorities, by ether type.
+func entries(n int) map[uint16]*p4_v1.Entity {
+	var infos []*p4rtutils.ACLWbbIngressTableEntryInfo
+	for i := 0; i < n; i++ {
+		infos = append(infos, &p4rtutils.ACLWbbIngressTableEntryInfo{
+			EtherType:     uint16(etherTypeBase + i),
+			EtherTypeMask: 0xFFFF,
+			Priority:      uint32(i + 1),
+		})
+	}
+	es := map[uint16]*p4_v1.Entity{}
+	for i, u := range p4rtutils.ACLWbbIngressTableEntryGet(infos) {
+		es[infos[i].EtherType] = u.GetEntity()
+	}
+	return es
+}
+
+// write writes es with updates of type typ in batches of -batch_size, and
+// returns the time taken.
+func write(t *testing.T, c *p4rtutils.Client, typ p4_v1.Update_Type, es map[uint16]*p4_v1.Entity) time.Duration {
+	t.Helper()
+	var all []*p4_v1.Entity
+	for _, e := range es {
+		all = append(all, e)
+	}
+	start := time.Now()
+	for len(all) > 0 {
+		n := min(*batchSize, len(all))
+		if err := c.WriteUpdates(p4rtutils.Updates(typ, all[:n]...)); err != nil {
+			t.Fatalf("Write of %d %v updates failed: %v", n, typ, err)
+		}
+		all = all[n:]
+	}
+	return time.Since(start)
+}
+
+// sameEntry returns whether the table entry read got is the entry written
+// want, ignoring the fields which are only set on read.
+func sameEntry(got, want *p4_v1.TableEntry) bool {
+	return got.GetTableId() == want.GetTableId() &&
+		got.GetPriority() == want.GetPriority() &&
+		proto.Equal(got.GetAction(), want.GetAction()) &&
+		proto.Equal(&p4_v1.TableEntry{Match: got.GetMatch()}, &p4_v1.TableEntry{Match: want.GetMatch()})
+}
+
+// verifyReadBack verifies that the entries of acl_wbb_ingress_table read
+// with c are want.
+func verifyReadBack(t *testing.T, c *p4rtutils.Client, want map[uint16]*p4_v1.Entity) {
+	t.Helper()
+	start := time.Now()
+	got, err := c.ReadEntities(p4rtutils.TableEntries(&p4_v1.TableEntry{
+		TableId: p4rtutils.WbbTableMap["acl_wbb_ingress_table"],
+	})...)
+	if err != nil {
+		t.Fatalf("Could not read the table entries: %v", err)
+	}
+	t.Logf("Read %d table entries in %v", len(got), time.Since(start))
+	if len(got) != len(want) {
+		t.Errorf("Read %d table entries, want %d", len(got), len(want))
+	}
+	for et, w := range want {
+		found := false
+		for _, g := range got {
+			if sameEntry(g.GetTableEntry(), w.GetTableEntry()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Table entry for ether type %#04x not read back", et)
+		}
+	}
+}
+
+// testWriteRead installs and deletes es -iterations times, verifying the
+// entries read back after each installation, and verifies the write
+// throughput. The entries are left installed.
+func testWriteRead(t *testing.T, c *p4rtutils.Client, es map[uint16]*p4_v1.Entity) {
+	var written int
+	var elapsed time.Duration
+	for i := 0; i < *iterations; i++ {
+		d := write(t, c, p4_v1.Update_INSERT, es)
+		t.Logf("Iteration %d: installed %d entries in %v", i, len(es), d)
+		written += len(es)
+		elapsed += d
+		verifyReadBack(t, c, es)
+		if i == *iterations-1 {
+			break
+		}
+		d = write(t, c, p4_v1.Update_DELETE, es)
+		t.Logf("Iteration %d: deleted %d entries in %v", i, len(es), d)
+		written += len(es)
+		elapsed += d
+		verifyReadBack(t, c, nil)
+	}
+
+	rate := float64(written) / elapsed.Seconds()
+	t.Logf("Write throughput: %d updates in %v", written, elapsed)
+	fptest.RecordValue(t, "write_throughput", rate, "entries/s")
+	if *minWriteRate > 0 {
+		fptest.Validate(t, rate >= *minWriteRate, "Write throughput: got %.1f entries/s, want at least %.1f", rate, *minWriteRate)
+	}
+}
+
+// testDataplane sends the flows of the ATE, and verifies that the frames
+// matching each sampled entry are punted as PacketIn.
+func testDataplane(t *testing.T, ate *ondatra.ATEDevice, c *p4rtutils.Client, sample []uint16) {
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packetCount/frameRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+
+	sent := map[uint16]uint64{}
+	var total uint64
+	for _, et := range sample {
+		sent[et] = gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(flowName(et)).Counters().OutPkts().State())
+		total += sent[et]
+	}
+	packets, err := c.PacketsIn(total, 30*time.Second)
+	if err != nil {
+		t.Errorf("Error fetching PacketIn messages: %v", err)
+	}
+	got := map[uint16]uint64{}
+	for _, pkt := range packets {
+		eth, ok := gopacket.NewPacket(pkt.GetPayload(), layers.LayerTypeEthernet, gopacket.Default).Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+		if ok && strings.EqualFold(eth.SrcMAC.String(), atePort1.MAC) {
+			got[uint16(eth.EthernetType)]++
+		}
+	}
+
+	for _, et := range sample {
+		t.Run(flowName(et), func(t *testing.T) {
+			t.Logf("%d packets sent, %d PacketIn received", sent[et], got[et])
+			if sent[et] == 0 {
+				t.Fatalf("No packets sent by flow %s", flowName(et))
+			}
+			if got[et] < uint64(float64(sent[et])*minReceived) {
+				t.Errorf("PacketIn: got %d, want at least %.0f%% of %d", got[et], minReceived*100, sent[et])
+			}
+		})
+	}
+}
+
+func TestTableScale(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	if *iterations < 1 || *batchSize < 1 {
+		t.Fatalf("-iterations %d and -batch_size %d must be positive", *iterations, *batchSize)
+	}
+	n := *entryCount
+	if n == 0 {
+		n = tableSize(t)
+	}
+	es := entries(n)
+	// The sample is spread over the entries, including the first and the
+	// last ones.
+	var sample []uint16
+	k := min(*sampleSize, n)
+	for i := 0; i < k; i++ {
+		idx := 0
+		if k > 1 {
+			idx = i * (n - 1) / (k - 1)
+		}
+		sample = append(sample, uint16(etherTypeBase+idx))
+	}
+
+	configureDUT(t, dut)
+	ids := p4rtutils.ConfigureIDs(t, dut, firstNodeID, firstPortID)
+	top := configureATE(t, ate, sample)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+
+	c := p4rtutils.NewClient(t, dut, ids["port1"].NodeID, electionID)
+	if primary, err := c.Arbitrate(); err != nil || !primary {
+		t.Fatalf("Could not become the primary P4RT client: primary %t, error %v", primary, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.LoadPipeline(*p4InfoFile, pipelineCookie); err != nil {
+		t.Fatalf("Could not set the forwarding pipeline config: %v", err)
+	}
+	t.Logf("Installing %d entries in batches of %d, %d times", n, *batchSize, *iterations)
+	t.Cleanup(func() {
+		for et, e := range es {
+			// The entries may already be deleted if the test failed.
+			if err := c.Delete(e); err != nil {
+				t.Logf("Could not delete the table entry for ether type %#04x: %v", et, err)
+			}
+		}
+	})
+
+	t.Run("WriteRead", func(t *testing.T) { testWriteRead(t, c, es) })
+	t.Run("Dataplane", func(t *testing.T) { testDataplane(t, ate, c, sample) })
+}
@@ -0,0 +1,363 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package traceroute_ttl_test
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/featureprofiles/internal/p4rtutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+)
+
+var (
+	p4InfoFile = flag.String("p4info_file_location", "../../wbb.p4info.pb.txt", "Path to the p4info file.")
+)
+
+const (
+	ipv4PrefixLen  = 30
+	ipv6PrefixLen  = 126
+	deviceID       = 1
+	portID         = 10
+	electionID     = 100
+	pipelineCookie = 159
+	// packetCount is the number of packets of each flow.
+	packetCount = 100
+	frameRate   = 10
+	frameSize   = 300
+	// The IDs of the ingress_port and target_egress_port metadata of
+	// packet_in in the p4info file.
+	metadataIngressPort      = 1
+	metadataTargetEgressPort = 2
+	// minReceived is the fraction of the packets sent which must be punted.
+	minReceived = 0.95
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv6:    "2001:db8::1",
+		IPv4Len: ipv4PrefixLen,
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:11:01:00:00:01",
+		IPv4:    "192.0.2.2",
+		IPv6:    "2001:db8::2",
+		IPv4Len: ipv4PrefixLen,
+		IPv6Len: ipv6PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv6:    "2001:db8::5",
+		IPv4Len: ipv4PrefixLen,
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:12:01:00:00:01",
+		IPv4:    "192.0.2.6",
+		IPv6:    "2001:db8::6",
+		IPv4Len: ipv4PrefixLen,
+		IPv6Len: ipv6PrefixLen,
+	}
+)
+
+// family is an IP address family, with the flow of the ATE sending packets of
+// the family with a TTL or hop limit of 1 from atePort1 to atePort2.
+type family struct {
+	name string
+	// isIPv4 and isIPv6 are the values of the is_ipv4 and is_ipv6 match
+	// fields of the table entry of the family.
+	isIPv4, isIPv6 uint8
+	// src and dst are the addresses of the packets of the flow, and
+	// dutAddr the address of dutPort1, the source of the time exceeded
+	// messages.
+	src, dst, dutAddr string
+}
+
+var families = []family{
+	{name: "IPv4", isIPv4: 1, src: atePort1.IPv4, dst: atePort2.IPv4, dutAddr: dutPort1.IPv4},
+	{name: "IPv6", isIPv6: 1, src: atePort1.IPv6, dst: atePort2.IPv6, dutAddr: dutPort1.IPv6},
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures port1 and port2 of the DUT with P4RT port IDs.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for i, a := range []*attrs.Attributes{&dutPort1, &dutPort2} {
+		dp := dut.Port(t, fmt.Sprintf("port%d", i+1))
+		intf := a.NewOCInterface(dp.Name(), dut)
+		intf.Id = ygot.Uint32(portID + uint32(i))
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), intf)
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+	}
+}
+
+// configureDeviceID configures the P4RT device ID on the node of port1 of the
+// DUT.
+func configureDeviceID(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	node, ok := p4rtutils.P4RTNodesByPort(t, dut)["port1"]
+	if !ok {
+		t.Fatal("Couldn't find P4RT Node for port: port1")
+	}
+	t.Logf("Configuring P4RT Node: %s", node)
+	c := &oc.Component{Name: ygot.String(node)}
+	c.GetOrCreateIntegratedCircuit().NodeId = ygot.Uint64(deviceID)
+	gnmi.Replace(t, dut, gnmi.OC().Component(node).Config(), c)
+}
+
+// configureATE configures port1 and port2 of the ATE, with a capture on
+// port1, and a flow per family from port1 to port2 sent to dutMAC.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice, dutMAC string) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	p1, p2 := ate.Port(t, "port1"), ate.Port(t, "port2")
+	atePort1.AddToOTG(top, p1, &dutPort1)
+	atePort2.AddToOTG(top, p2, &dutPort2)
+	top.Captures().Add().SetName("port1Capture").SetPortNames([]string{p1.ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+
+	for _, f := range families {
+		flow := top.Flows().Add().SetName(f.name)
+		flow.TxRx().Port().SetTxName(p1.ID()).SetRxName(p2.ID())
+		flow.Metrics().SetEnable(true)
+		eth := flow.Packet().Add().Ethernet()
+		eth.Src().SetValue(atePort1.MAC)
+		eth.Dst().SetValue(dutMAC)
+		if f.isIPv4 == 1 {
+			ip := flow.Packet().Add().Ipv4()
+			ip.Src().SetValue(f.src)
+			ip.Dst().SetValue(f.dst)
+			ip.TimeToLive().SetValue(1)
+		} else {
+			ip := flow.Packet().Add().Ipv6()
+			ip.Src().SetValue(f.src)
+			ip.Dst().SetValue(f.dst)
+			ip.HopLimit().SetValue(1)
+		}
+		flow.Size().SetFixed(frameSize)
+		flow.Rate().SetPps(frameRate)
+		flow.Duration().FixedPackets().SetPackets(packetCount)
+	}
+	return top
+}
+
+// programEntries inserts or deletes the acl_wbb_ingress_table entries
+// punting the IPv4 and IPv6 packets with a TTL or hop limit of 1.
+func programEntries(c *p4rtutils.Client, typ p4_v1.Update_Type) error {
+	var infos []*p4rtutils.ACLWbbIngressTableEntryInfo
+	for _, f := range families {
+		infos = append(infos, &p4rtutils.ACLWbbIngressTableEntryInfo{
+			Type:     typ,
+			IsIpv4:   f.isIPv4,
+			IsIpv6:   f.isIPv6,
+			TTL:      1,
+			TTLMask:  0xFF,
+			Priority: 1,
+		})
+	}
+	return c.WriteUpdates(p4rtutils.ACLWbbIngressTableEntryGet(infos))
+}
+
+// isFlowPacket returns whether pkt is a packet of the flow of f, with an
+// unchanged TTL or hop limit of 1.
+func isFlowPacket(pkt gopacket.Packet, f family) bool {
+	src, dst := net.ParseIP(f.src), net.ParseIP(f.dst)
+	if ip, ok := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ok && f.isIPv4 == 1 {
+		return ip.SrcIP.Equal(src) && ip.DstIP.Equal(dst) && ip.TTL == 1
+	}
+	if ip, ok := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6); ok && f.isIPv6 == 1 {
+		return ip.SrcIP.Equal(src) && ip.DstIP.Equal(dst) && ip.HopLimit == 1
+	}
+	return false
+}
+
+// isTimeExceeded returns whether pkt is a time exceeded message of the DUT
+// for a packet of the flow of f.
+func isTimeExceeded(pkt gopacket.Packet, f family) bool {
+	dutAddr, src := net.ParseIP(f.dutAddr), net.ParseIP(f.src)
+	if f.isIPv4 == 1 {
+		ip, ok := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		icmp, isICMP := pkt.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+		return ok && isICMP && ip.SrcIP.Equal(dutAddr) && ip.DstIP.Equal(src) &&
+			icmp.TypeCode.Type() == layers.ICMPv4TypeTimeExceeded
+	}
+	ip, ok := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	icmp, isICMP := pkt.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6)
+	return ok && isICMP && ip.SrcIP.Equal(dutAddr) && ip.DstIP.Equal(src) &&
+		icmp.TypeCode.Type() == layers.ICMPv6TypeTimeExceeded
+}
+
+// sendTraffic sends the flows of the ATE with the capture of port1 running,
+// and returns the number of packets sent per flow.
+func sendTraffic(t *testing.T, ate *ondatra.ATEDevice) map[string]uint64 {
+	t.Helper()
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packetCount/frameRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+	otgutils.StopCapture(t, ate.OTG())
+
+	sent := map[string]uint64{}
+	for _, f := range families {
+		sent[f.name] = gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.name).Counters().OutPkts().State())
+		if sent[f.name] == 0 {
+			t.Fatalf("No packets sent by flow %s", f.name)
+		}
+		if rx := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.name).Counters().InPkts().State()); rx != 0 {
+			t.Errorf("Flow %s: %d packets with TTL 1 forwarded to atePort2, want 0", f.name, rx)
+		}
+	}
+	return sent
+}
+
+// testPunt verifies that the packets with a TTL or hop limit of 1 are punted
+// to the controller with their ingress and target egress ports.
+func testPunt(t *testing.T, ate *ondatra.ATEDevice, c *p4rtutils.Client) {
+	if err := programEntries(c, p4_v1.Update_INSERT); err != nil {
+		t.Fatalf("Could not insert the traceroute table entries: %v", err)
+	}
+	defer func() {
+		if err := programEntries(c, p4_v1.Update_DELETE); err != nil {
+			t.Fatalf("Could not delete the traceroute table entries: %v", err)
+		}
+	}()
+
+	sent := sendTraffic(t, ate)
+	var total uint64
+	for _, n := range sent {
+		total += n
+	}
+	packets, err := c.PacketsIn(total, 30*time.Second)
+	if err != nil {
+		t.Errorf("Error fetching PacketIn messages: %v", err)
+	}
+
+	want := map[uint32]string{
+		metadataIngressPort:      fmt.Sprint(portID),
+		metadataTargetEgressPort: fmt.Sprint(portID + 1),
+	}
+	for _, f := range families {
+		t.Run(f.name, func(t *testing.T) {
+			var got uint64
+			for _, pkt := range packets {
+				if !isFlowPacket(gopacket.NewPacket(pkt.GetPayload(), layers.LayerTypeEthernet, gopacket.Default), f) {
+					continue
+				}
+				got++
+				for _, md := range pkt.GetMetadata() {
+					if w, ok := want[md.GetMetadataId()]; ok && string(md.GetValue()) != w {
+						t.Errorf("PacketIn metadata %d: got %q, want %q", md.GetMetadataId(), md.GetValue(), w)
+					}
+				}
+			}
+			t.Logf("%d packets sent, %d PacketIn received", sent[f.name], got)
+			if got < uint64(float64(sent[f.name])*minReceived) {
+				t.Errorf("PacketIn: got %d, want at least %.0f%% of %d", got, minReceived*100, sent[f.name])
+			}
+		})
+	}
+}
+
+// testTimeExceeded verifies that without the table entries, the packets with
+// a TTL or hop limit of 1 are not punted to the controller, and that the DUT
+// replies with time exceeded messages.
+func testTimeExceeded(t *testing.T, ate *ondatra.ATEDevice, c *p4rtutils.Client) {
+	// Drain the PacketIn messages received so far.
+	if _, err := c.PacketsIn(0, time.Second); err != nil {
+		t.Fatalf("Error fetching PacketIn messages: %v", err)
+	}
+	sendTraffic(t, ate)
+	packets, _ := c.PacketsIn(0, 10*time.Second)
+	captured := otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port1").ID())
+
+	for _, f := range families {
+		t.Run(f.name, func(t *testing.T) {
+			punted := 0
+			for _, pkt := range packets {
+				if isFlowPacket(gopacket.NewPacket(pkt.GetPayload(), layers.LayerTypeEthernet, gopacket.Default), f) {
+					punted++
+				}
+			}
+			if punted != 0 {
+				t.Errorf("PacketIn: got %d, want 0", punted)
+			}
+			exceeded := 0
+			for _, pkt := range captured {
+				if isTimeExceeded(pkt, f) {
+					exceeded++
+				}
+			}
+			// The generation of time exceeded messages may be rate limited,
+			// so that not every packet gets one.
+			t.Logf("%d time exceeded messages received", exceeded)
+			if exceeded == 0 {
+				t.Errorf("No time exceeded message received from %s", f.dutAddr)
+			}
+		})
+	}
+}
+
+func TestTraceroute(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	configureDUT(t, dut)
+	configureDeviceID(t, dut)
+	dutMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port1").Name()).Ethernet().MacAddress().State())
+	top := configureATE(t, ate, dutMAC)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+
+	c := p4rtutils.NewClient(t, dut, deviceID, electionID)
+	if primary, err := c.Arbitrate(); err != nil || !primary {
+		t.Fatalf("Could not become the primary P4RT client: primary %t, error %v", primary, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.LoadPipeline(*p4InfoFile, pipelineCookie); err != nil {
+		t.Fatalf("Could not set the forwarding pipeline config: %v", err)
+	}
+
+	t.Run("Punt", func(t *testing.T) { testPunt(t, ate, c) })
+	t.Run("TimeExceeded", func(t *testing.T) { testTimeExceeded(t, ate, c) })
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p4rt_failover_test
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/p4rtutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	p4InfoFile = flag.String("p4info_file_location", "../../wbb.p4info.pb.txt", "Path to the p4info file.")
+)
+
+const (
+	deviceID       = 1
+	portID         = 10
+	pipelineCookie = 159
+	// primaryID is the election ID of the first primary, whose backup has
+	// primaryID-1, and takeoverID the election ID with which the backup
+	// takes over.
+	primaryID  = 100
+	takeoverID = 101
+	// arbitrationTimeout is the time within which the clients must be
+	// notified of a change of primary.
+	arbitrationTimeout = 30 * time.Second
+	// gdpEtherType and lldpEtherType are the ether types matched by the table
+	// entries written by the test.
+	gdpEtherType  = 0x6007
+	lldpEtherType = 0x88cc
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the P4RT port ID of port1 of the DUT, and the P4RT
+// device ID on its node.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	name := dut.Port(t, "port1").Name()
+	gnmi.Replace(t, dut, gnmi.OC().Interface(name).Config(), &oc.Interface{
+		Name: ygot.String(name),
+		Type: oc.IETFInterfaces_InterfaceType_ethernetCsmacd,
+		Id:   ygot.Uint32(portID),
+	})
+
+	node, ok := p4rtutils.P4RTNodesByPort(t, dut)["port1"]
+	if !ok {
+		t.Fatal("Couldn't find P4RT Node for port: port1")
+	}
+	t.Logf("Configuring P4RT Node: %s", node)
+	c := &oc.Component{Name: ygot.String(node)}
+	c.GetOrCreateIntegratedCircuit().NodeId = ygot.Uint64(deviceID)
+	gnmi.Replace(t, dut, gnmi.OC().Component(node).Config(), c)
+}
+
+// entry returns the acl_wbb_ingress_table entry matching etherType.
+func entry(etherType uint16) *p4_v1.Entity {
+	return p4rtutils.ACLWbbIngressTableEntryGet([]*p4rtutils.ACLWbbIngressTableEntryInfo{{
+		EtherType:     etherType,
+		EtherTypeMask: 0xFFFF,
+		Priority:      1,
+	}})[0].GetEntity()
+}
+
+// etherType returns the ether type matched by table entry e, or 0 if it does
+// not match on the ether type.
+func etherType(e *p4_v1.TableEntry) uint16 {
+	for _, m := range e.GetMatch() {
+		if m.GetFieldId() != p4rtutils.WbbMatchMap["ether_type"] {
+			continue
+		}
+		v := m.GetTernary().GetValue()
+		if len(v) > 2 {
+			return 0
+		}
+		// The value may be sent without its leading zero byte.
+		v = append(bytes.Repeat([]byte{0}, 2-len(v)), v...)
+		return uint16(v[0])<<8 | uint16(v[1])
+	}
+	return 0
+}
+
+// verifyEntries verifies that c reads the entries of acl_wbb_ingress_table
+// matching the ether types want.
+func verifyEntries(t *testing.T, c *p4rtutils.Client, want ...uint16) {
+	t.Helper()
+	entities, err := c.ReadEntities(p4rtutils.TableEntries(&p4_v1.TableEntry{
+		TableId: p4rtutils.WbbTableMap["acl_wbb_ingress_table"],
+	})...)
+	if err != nil {
+		t.Fatalf("Client with election ID %d could not read the table entries: %v", c.ElectionID.GetLow(), err)
+	}
+	got := map[uint16]bool{}
+	for _, e := range entities {
+		got[etherType(e.GetTableEntry())] = true
+	}
+	for _, et := range want {
+		if !got[et] {
+			t.Errorf("Client with election ID %d reads no table entry for ether type %#04x, got entries %v", c.ElectionID.GetLow(), et, entities)
+		}
+	}
+}
+
+// verifyWrite verifies that c can insert e if wantAllowed, or otherwise that
+// the insertion is denied.
+func verifyWrite(t *testing.T, c *p4rtutils.Client, e *p4_v1.Entity, wantAllowed bool) {
+	t.Helper()
+	err := c.Insert(e)
+	switch {
+	case wantAllowed && err != nil:
+		t.Errorf("Client with election ID %d could not write: %v", c.ElectionID.GetLow(), err)
+	case !wantAllowed && err == nil:
+		t.Errorf("Client with election ID %d could write, want denied", c.ElectionID.GetLow())
+		if err := c.Delete(e); err != nil {
+			t.Errorf("Could not delete the unexpected entry: %v", err)
+		}
+	case !wantAllowed && status.Code(err) != codes.PermissionDenied:
+		t.Errorf("Client with election ID %d write error: got %v, want code %v", c.ElectionID.GetLow(), err, codes.PermissionDenied)
+	}
+}
+
+// arbitrate sets the election ID of c to electionID, and verifies that c
+// becomes the primary.
+func arbitrate(t *testing.T, c *p4rtutils.Client, electionID uint64) {
+	t.Helper()
+	c.ElectionID = &p4_v1.Uint128{Low: electionID}
+	primary, err := c.Arbitrate()
+	if err != nil {
+		t.Fatalf("Client with election ID %d could not arbitrate: %v", electionID, err)
+	}
+	if !primary {
+		t.Fatalf("Client with election ID %d is not the primary", electionID)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+
+	// a and b are the two controllers: a is the first primary, and b takes
+	// over from it.
+	a, b := p4rtutils.NewPrimaryBackup(t, dut, deviceID, primaryID)
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	if err := a.LoadPipeline(*p4InfoFile, pipelineCookie); err != nil {
+		t.Fatalf("Could not set the forwarding pipeline config: %v", err)
+	}
+	primary := a
+	t.Cleanup(func() {
+		for _, et := range []uint16{gdpEtherType, lldpEtherType} {
+			if err := primary.Delete(entry(et)); err != nil {
+				t.Errorf("Could not delete the table entry for ether type %#04x: %v", et, err)
+			}
+		}
+	})
+
+	t.Run("WriteAccess", func(t *testing.T) {
+		verifyWrite(t, a, entry(gdpEtherType), true)
+		verifyWrite(t, b, entry(lldpEtherType), false)
+		verifyEntries(t, a, gdpEtherType)
+		verifyEntries(t, b, gdpEtherType)
+	})
+
+	t.Run("Handover", func(t *testing.T) {
+		arbitrate(t, b, takeoverID)
+		primary = b
+
+		arb, err := a.NextArbitration(arbitrationTimeout)
+		if err != nil {
+			t.Fatalf("Former primary was not notified of the new primary: %v", err)
+		}
+		if got, want := codes.Code(arb.GetStatus().GetCode()), codes.AlreadyExists; got != want {
+			t.Errorf("Former primary notification status: got %v, want %v", got, want)
+		}
+		if got, want := arb.GetElectionId().GetLow(), uint64(takeoverID); got != want {
+			t.Errorf("Former primary notification election ID: got %d, want %d", got, want)
+		}
+
+		verifyWrite(t, a, entry(lldpEtherType), false)
+		verifyWrite(t, b, entry(lldpEtherType), true)
+		verifyEntries(t, a, gdpEtherType, lldpEtherType)
+		verifyEntries(t, b, gdpEtherType, lldpEtherType)
+	})
+
+	t.Run("Failover", func(t *testing.T) {
+		if err := b.Close(); err != nil {
+			t.Fatalf("Could not close the stream channel of the primary: %v", err)
+		}
+		// The remaining controller takes over with the election ID of the
+		// failed primary.
+		arbitrate(t, a, takeoverID)
+		primary = a
+
+		verifyEntries(t, a, gdpEtherType, lldpEtherType)
+		if err := a.Modify(entry(lldpEtherType)); err != nil {
+			t.Errorf("New primary could not modify the table entry of the failed primary: %v", err)
+		}
+	})
+}
@@ -0,0 +1,372 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pbf_redirect_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1 and dut:port{2,3,4} ->
+// ate:port{2,3,4}. The routes of the destination prefixes point to ate:port2
+// in the default network instance and to ate:port4 in redirectVRF, whose
+// only interface is dut:port4. The policy redirects the packets matching its
+// DSCP rules to ate:port3, and the packets matching its destination rules to
+// redirectVRF.
+const (
+	plenIPv4 = 30
+	plenIPv6 = 126
+
+	policyName   = "redirect"
+	redirectVRF  = "VRF-B"
+	redirectDSCP = 10
+
+	// routedIPv4 and routedIPv6 are routed to ate:port2 in the default
+	// network instance and to ate:port4 in redirectVRF.
+	routedIPv4 = "198.51.100.0/24"
+	routedIPv6 = "2001:db8:100::/48"
+	// vrfIPv4 and vrfIPv6 are the parts of the routed prefixes redirected
+	// to redirectVRF.
+	vrfIPv4 = "198.51.100.128/25"
+	vrfIPv6 = "2001:db8:100:1::/64"
+
+	dstIPv4    = "198.51.100.1"
+	dstVRFIPv4 = "198.51.100.129"
+	dstIPv6    = "2001:db8:100::1"
+	dstVRFIPv6 = "2001:db8:100:1::1"
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	ethertypeIPv4 = oc.PacketMatchTypes_ETHERTYPE_ETHERTYPE_IPV4
+	ethertypeIPv6 = oc.PacketMatchTypes_ETHERTYPE_ETHERTYPE_IPV6
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv6:    "2001:db8::192:0:2:2",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dutSrc = attrs.Attributes{
+		Desc:    "Policy input",
+		IPv4:    "192.0.2.1",
+		IPv6:    "2001:db8::192:0:2:1",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dutDefault = attrs.Attributes{
+		Desc:    "Routed output",
+		IPv4:    "192.0.2.5",
+		IPv6:    "2001:db8::192:0:2:5",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	ateDefault = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv6:    "2001:db8::192:0:2:6",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dutNextHop = attrs.Attributes{
+		Desc:    "Redirect next hop output",
+		IPv4:    "192.0.2.9",
+		IPv6:    "2001:db8::192:0:2:9",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	ateNextHop = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv6:    "2001:db8::192:0:2:a",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dutVRF = attrs.Attributes{
+		Desc:    "Redirect network instance output",
+		IPv4:    "192.0.2.13",
+		IPv6:    "2001:db8::192:0:2:d",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	ateVRF = attrs.Attributes{
+		Name:    "ate4",
+		MAC:     "02:00:04:01:01:01",
+		IPv4:    "192.0.2.14",
+		IPv6:    "2001:db8::192:0:2:e",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+)
+
+// rule is a rule of the policy, which matches either dscp or dst, and
+// redirects the packets either to nextHop or to networkInstance.
+type rule struct {
+	seq             uint32
+	ipv6            bool
+	dscp            uint8
+	dst             string
+	nextHop         string
+	networkInstance string
+}
+
+var rules = []rule{
+	{seq: 10, dscp: redirectDSCP, nextHop: ateNextHop.IPv4},
+	{seq: 20, ipv6: true, dscp: redirectDSCP, nextHop: ateNextHop.IPv6},
+	{seq: 30, dst: vrfIPv4, networkInstance: redirectVRF},
+	{seq: 40, ipv6: true, dst: vrfIPv6, networkInstance: redirectVRF},
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the DUT interfaces, redirectVRF and the static
+// routes of the routed prefixes in both network instances.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	ni := &oc.NetworkInstance{Name: ygot.String(redirectVRF)}
+	ni.SetType(oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_L3VRF)
+	gnmi.Replace(t, dut, gnmi.OC().NetworkInstance(redirectVRF).Config(), ni)
+
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+		ni    string
+	}{
+		{"port1", dutSrc, deviations.DefaultNetworkInstance(dut)},
+		{"port2", dutDefault, deviations.DefaultNetworkInstance(dut)},
+		{"port3", dutNextHop, deviations.DefaultNetworkInstance(dut)},
+		{"port4", dutVRF, redirectVRF},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if p.ni != deviations.DefaultNetworkInstance(dut) || deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), p.ni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	b := &gnmi.SetBatch{}
+	for _, r := range []struct {
+		ni, prefix, nextHop string
+	}{
+		{deviations.DefaultNetworkInstance(dut), routedIPv4, ateDefault.IPv4},
+		{deviations.DefaultNetworkInstance(dut), routedIPv6, ateDefault.IPv6},
+		{redirectVRF, routedIPv4, ateVRF.IPv4},
+		{redirectVRF, routedIPv6, ateVRF.IPv6},
+	} {
+		cfg := &cfgplugins.StaticRouteCfg{
+			NetworkInstance: r.ni,
+			Prefix:          r.prefix,
+			NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+				"0": oc.UnionString(r.nextHop),
+			},
+		}
+		if _, err := cfgplugins.NewStaticRouteCfg(b, cfg, dut); err != nil {
+			t.Fatalf("Failed to configure the static route to %s in %s: %v", r.prefix, r.ni, err)
+		}
+	}
+	b.Set(t, dut)
+}
+
+// forwardingPolicy returns the policy with the redirect rules, followed by
+// the rules forwarding the other packets in the default network instance
+// if the DUT requires them.
+func forwardingPolicy(dut *ondatra.DUTDevice) *oc.NetworkInstance_PolicyForwarding_Policy {
+	p := &oc.NetworkInstance_PolicyForwarding_Policy{PolicyId: ygot.String(policyName)}
+	p.SetType(oc.Policy_Type_PBR_POLICY)
+	for _, r := range rules {
+		pr := p.GetOrCreateRule(r.seq)
+		switch {
+		case r.ipv6 && r.dscp != 0:
+			pr.GetOrCreateIpv6().SetDscpSet([]uint8{r.dscp})
+		case r.ipv6:
+			pr.GetOrCreateIpv6().SetDestinationAddress(r.dst)
+		case r.dscp != 0:
+			pr.GetOrCreateIpv4().SetDscpSet([]uint8{r.dscp})
+		default:
+			pr.GetOrCreateIpv4().SetDestinationAddress(r.dst)
+		}
+		if r.nextHop != "" {
+			pr.GetOrCreateAction().SetNextHop(r.nextHop)
+		} else {
+			pr.GetOrCreateAction().SetNetworkInstance(r.networkInstance)
+		}
+	}
+	if deviations.PfRequireMatchDefaultRule(dut) {
+		for i, et := range []oc.NetworkInstance_PolicyForwarding_Policy_Rule_L2_Ethertype_Union{ethertypeIPv4, ethertypeIPv6} {
+			pr := p.GetOrCreateRule(uint32(100 + i))
+			pr.GetOrCreateL2().SetEthertype(et)
+			pr.GetOrCreateAction().SetNetworkInstance(deviations.DefaultNetworkInstance(dut))
+		}
+	}
+	return p
+}
+
+// applyForwardingPolicy configures the policy and applies it to the input of
+// interface intf.
+func applyForwardingPolicy(t *testing.T, dut *ondatra.DUTDevice, intf string) {
+	t.Helper()
+	interfaceID := intf
+	if deviations.InterfaceRefInterfaceIDFormat(dut) {
+		interfaceID = intf + ".0"
+	}
+	pfi := &oc.NetworkInstance_PolicyForwarding_Interface{InterfaceId: ygot.String(interfaceID)}
+	pfi.SetApplyForwardingPolicy(policyName)
+	if !deviations.InterfaceRefConfigUnsupported(dut) {
+		pfi.GetOrCreateInterfaceRef().SetInterface(intf)
+		pfi.GetOrCreateInterfaceRef().SetSubinterface(0)
+	}
+
+	pf := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding()
+	b := &gnmi.SetBatch{}
+	gnmi.BatchReplace(b, pf.Policy(policyName).Config(), forwardingPolicy(dut))
+	gnmi.BatchReplace(b, pf.Interface(interfaceID).Config(), pfi)
+	b.Set(t, dut)
+}
+
+// flow is a flow from ate:port1 expected to be received by rx.
+type flow struct {
+	name string
+	ipv6 bool
+	dst  string
+	dscp uint8
+	rx   attrs.Attributes
+	// rule is the sequence number of the rule matching the flow, or 0 if
+	// none does.
+	rule uint32
+}
+
+var flows = []flow{
+	{name: "ipv4-dscp", dst: dstIPv4, dscp: redirectDSCP, rx: ateNextHop, rule: 10},
+	{name: "ipv6-dscp", ipv6: true, dst: dstIPv6, dscp: redirectDSCP, rx: ateNextHop, rule: 20},
+	{name: "ipv4-prefix", dst: dstVRFIPv4, rx: ateVRF, rule: 30},
+	{name: "ipv6-prefix", ipv6: true, dst: dstVRFIPv6, rx: ateVRF, rule: 40},
+	{name: "ipv4-unmatched", dst: dstIPv4, rx: ateDefault},
+	{name: "ipv6-unmatched", ipv6: true, dst: dstIPv6, rx: ateDefault},
+	{name: "ipv4-other-dscp", dst: dstIPv4, dscp: redirectDSCP + 8, rx: ateDefault},
+}
+
+// addFlow adds f to top.
+func addFlow(top gosnappi.Config, f flow) {
+	fl := top.Flows().Add().SetName(f.name)
+	fl.Metrics().SetEnable(true)
+	fl.Packet().Add().Ethernet().Src().SetValue(ateSrc.MAC)
+	if f.ipv6 {
+		fl.TxRx().Device().SetTxNames([]string{ateSrc.Name + ".IPv6"}).SetRxNames([]string{f.rx.Name + ".IPv6"})
+		ip := fl.Packet().Add().Ipv6()
+		ip.Src().SetValue(ateSrc.IPv6)
+		ip.Dst().SetValue(f.dst)
+		ip.TrafficClass().SetValue(uint32(f.dscp) << 2)
+	} else {
+		fl.TxRx().Device().SetTxNames([]string{ateSrc.Name + ".IPv4"}).SetRxNames([]string{f.rx.Name + ".IPv4"})
+		ip := fl.Packet().Add().Ipv4()
+		ip.Src().SetValue(ateSrc.IPv4)
+		ip.Dst().SetValue(f.dst)
+		ip.Priority().Dscp().Phb().SetValue(uint32(f.dscp))
+	}
+	fl.Size().SetFixed(frameSize)
+	fl.Rate().SetPps(ppsRate)
+	fl.Duration().FixedPackets().SetPackets(packets)
+}
+
+func TestPolicyForwardingRedirect(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+	applyForwardingPolicy(t, dut, dut.Port(t, "port1").Name())
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutSrc)
+	ateDefault.AddToOTG(top, ate.Port(t, "port2"), &dutDefault)
+	ateNextHop.AddToOTG(top, ate.Port(t, "port3"), &dutNextHop)
+	ateVRF.AddToOTG(top, ate.Port(t, "port4"), &dutVRF)
+
+	for _, f := range flows {
+		t.Run(f.name, func(t *testing.T) {
+			top.Flows().Clear()
+			addFlow(top, f)
+			ate.OTG().PushConfig(t, top)
+			ate.OTG().StartProtocols(t)
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+
+			matched := map[uint32]uint64{}
+			for _, r := range rules {
+				matched[r.seq] = matchedPkts(t, dut, r.seq)
+			}
+
+			ate.OTG().StartTraffic(t)
+			time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+			ate.OTG().StopTraffic(t)
+			time.Sleep(10 * time.Second)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+			counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.name).Counters().State())
+			if counters.GetOutPkts() == 0 || counters.GetInPkts() != counters.GetOutPkts() {
+				t.Errorf("Flow %s: got %d packets received on %s of %d sent, want no loss", f.name, counters.GetInPkts(), f.rx.Name, counters.GetOutPkts())
+			}
+
+			for _, r := range rules {
+				got := matchedPkts(t, dut, r.seq) - matched[r.seq]
+				switch {
+				case r.seq == f.rule && got < counters.GetOutPkts():
+					t.Errorf("Rule %d: got %d matched packets, want at least %d", r.seq, got, counters.GetOutPkts())
+				case r.seq != f.rule && got != 0:
+					t.Errorf("Rule %d: got %d matched packets, want 0", r.seq, got)
+				}
+			}
+		})
+	}
+
+	pf := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding()
+	interfaceID := dut.Port(t, "port1").Name()
+	if deviations.InterfaceRefInterfaceIDFormat(dut) {
+		interfaceID += ".0"
+	}
+	gnmi.Delete(t, dut, pf.Interface(interfaceID).Config())
+	gnmi.Delete(t, dut, pf.Policy(policyName).Config())
+}
+
+// matchedPkts returns the number of packets matched by the rule with
+// sequence number seq.
+func matchedPkts(t *testing.T, dut *ondatra.DUTDevice, seq uint32) uint64 {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding().Policy(policyName).Rule(seq).MatchedPkts().State()
+	// The counter is 0 if the device has not matched any packet yet.
+	v, _ := gnmi.Lookup(t, dut, q).Val()
+	return v
+}
@@ -0,0 +1,379 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vrf_selection_default_route_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the input of the VRF
+// selection policy, and dut:port2 -> ate:port2, dut:port3 -> ate:port3 and
+// dut:port4 -> ate:port4, the only interfaces of vrfA, vrfB and the default
+// network instance respectively. Each network instance has a default route
+// to its own ATE port, so the ATE port receiving a flow shows the network
+// instance selected for it.
+const (
+	plenIPv4 = 30
+	plenIPv6 = 126
+
+	policyName = "vrf-select"
+	vrfA       = "VRF-A"
+	vrfB       = "VRF-B"
+	dscpA      = 10
+	dscpB      = 20
+
+	defaultIPv4 = "0.0.0.0/0"
+	defaultIPv6 = "::/0"
+	dstIPv4     = "198.51.100.1"
+	dstIPv6     = "2001:db8:100::1"
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	ethertypeIPv4 = oc.PacketMatchTypes_ETHERTYPE_ETHERTYPE_IPV4
+	ethertypeIPv6 = oc.PacketMatchTypes_ETHERTYPE_ETHERTYPE_IPV6
+
+	protocolUDP = oc.PacketMatchTypes_IP_PROTOCOL_IP_UDP
+	protocolTCP = oc.PacketMatchTypes_IP_PROTOCOL_IP_TCP
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv6:    "2001:db8::192:0:2:2",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dutSrc = attrs.Attributes{
+		Desc:    "VRF selection input",
+		IPv4:    "192.0.2.1",
+		IPv6:    "2001:db8::192:0:2:1",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dutA = attrs.Attributes{
+		Desc:    "VRF-A output",
+		IPv4:    "192.0.2.5",
+		IPv6:    "2001:db8::192:0:2:5",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	ateA = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv6:    "2001:db8::192:0:2:6",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dutB = attrs.Attributes{
+		Desc:    "VRF-B output",
+		IPv4:    "192.0.2.9",
+		IPv6:    "2001:db8::192:0:2:9",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	ateB = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv6:    "2001:db8::192:0:2:a",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dutDefault = attrs.Attributes{
+		Desc:    "Default network instance output",
+		IPv4:    "192.0.2.13",
+		IPv6:    "2001:db8::192:0:2:d",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	ateDefault = attrs.Attributes{
+		Name:    "ate4",
+		MAC:     "02:00:04:01:01:01",
+		IPv4:    "192.0.2.14",
+		IPv6:    "2001:db8::192:0:2:e",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+)
+
+// rule is a rule of the policy, which selects networkInstance for the
+// packets with protocol and dscp.
+type rule struct {
+	seq             uint32
+	ipv6            bool
+	protocol        oc.E_PacketMatchTypes_IP_PROTOCOL
+	dscp            uint8
+	networkInstance string
+}
+
+var rules = []rule{
+	{seq: 10, protocol: protocolUDP, dscp: dscpA, networkInstance: vrfA},
+	{seq: 20, protocol: protocolTCP, dscp: dscpB, networkInstance: vrfB},
+	{seq: 30, ipv6: true, protocol: protocolUDP, dscp: dscpA, networkInstance: vrfA},
+	{seq: 40, ipv6: true, protocol: protocolTCP, dscp: dscpB, networkInstance: vrfB},
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the DUT interfaces, vrfA, vrfB and the default
+// routes of the three network instances.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for _, name := range []string{vrfA, vrfB} {
+		ni := &oc.NetworkInstance{Name: ygot.String(name)}
+		ni.SetType(oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_L3VRF)
+		gnmi.Replace(t, dut, gnmi.OC().NetworkInstance(name).Config(), ni)
+	}
+
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+		ni    string
+	}{
+		{"port1", dutSrc, deviations.DefaultNetworkInstance(dut)},
+		{"port2", dutA, vrfA},
+		{"port3", dutB, vrfB},
+		{"port4", dutDefault, deviations.DefaultNetworkInstance(dut)},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if p.ni != deviations.DefaultNetworkInstance(dut) || deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), p.ni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	b := &gnmi.SetBatch{}
+	for _, r := range []struct {
+		ni, prefix, nextHop string
+	}{
+		{vrfA, defaultIPv4, ateA.IPv4},
+		{vrfA, defaultIPv6, ateA.IPv6},
+		{vrfB, defaultIPv4, ateB.IPv4},
+		{vrfB, defaultIPv6, ateB.IPv6},
+		{deviations.DefaultNetworkInstance(dut), defaultIPv4, ateDefault.IPv4},
+		{deviations.DefaultNetworkInstance(dut), defaultIPv6, ateDefault.IPv6},
+	} {
+		cfg := &cfgplugins.StaticRouteCfg{
+			NetworkInstance: r.ni,
+			Prefix:          r.prefix,
+			NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+				"0": oc.UnionString(r.nextHop),
+			},
+		}
+		if _, err := cfgplugins.NewStaticRouteCfg(b, cfg, dut); err != nil {
+			t.Fatalf("Failed to configure the static route to %s in %s: %v", r.prefix, r.ni, err)
+		}
+	}
+	b.Set(t, dut)
+}
+
+// vrfSelectionPolicy returns the policy with the VRF selection rules,
+// followed by the rules selecting the default network instance for the
+// other packets if the DUT requires them.
+func vrfSelectionPolicy(dut *ondatra.DUTDevice) *oc.NetworkInstance_PolicyForwarding_Policy {
+	p := &oc.NetworkInstance_PolicyForwarding_Policy{PolicyId: ygot.String(policyName)}
+	p.SetType(oc.Policy_Type_VRF_SELECTION_POLICY)
+	for _, r := range rules {
+		pr := p.GetOrCreateRule(r.seq)
+		if r.ipv6 {
+			pr.GetOrCreateIpv6().SetProtocol(r.protocol)
+			pr.GetOrCreateIpv6().SetDscpSet([]uint8{r.dscp})
+		} else {
+			pr.GetOrCreateIpv4().SetProtocol(r.protocol)
+			pr.GetOrCreateIpv4().SetDscpSet([]uint8{r.dscp})
+		}
+		pr.GetOrCreateAction().SetNetworkInstance(r.networkInstance)
+	}
+	if deviations.PfRequireMatchDefaultRule(dut) {
+		for i, et := range []oc.NetworkInstance_PolicyForwarding_Policy_Rule_L2_Ethertype_Union{ethertypeIPv4, ethertypeIPv6} {
+			pr := p.GetOrCreateRule(uint32(100 + i))
+			pr.GetOrCreateL2().SetEthertype(et)
+			pr.GetOrCreateAction().SetNetworkInstance(deviations.DefaultNetworkInstance(dut))
+		}
+	}
+	return p
+}
+
+// interfaceID returns the ID of interface intf in policy-forwarding.
+func interfaceID(dut *ondatra.DUTDevice, intf string) string {
+	if deviations.InterfaceRefInterfaceIDFormat(dut) {
+		return intf + ".0"
+	}
+	return intf
+}
+
+// applyVRFSelectionPolicy configures the policy and applies it to the input
+// of interface intf.
+func applyVRFSelectionPolicy(t *testing.T, dut *ondatra.DUTDevice, intf string) {
+	t.Helper()
+	pfi := &oc.NetworkInstance_PolicyForwarding_Interface{InterfaceId: ygot.String(interfaceID(dut, intf))}
+	pfi.SetApplyVrfSelectionPolicy(policyName)
+	if !deviations.InterfaceRefConfigUnsupported(dut) {
+		pfi.GetOrCreateInterfaceRef().SetInterface(intf)
+		pfi.GetOrCreateInterfaceRef().SetSubinterface(0)
+	}
+
+	pf := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding()
+	b := &gnmi.SetBatch{}
+	gnmi.BatchReplace(b, pf.Policy(policyName).Config(), vrfSelectionPolicy(dut))
+	gnmi.BatchReplace(b, pf.Interface(interfaceID(dut, intf)).Config(), pfi)
+	b.Set(t, dut)
+}
+
+// flow is a flow from ate:port1 expected to be received by rx.
+type flow struct {
+	name string
+	ipv6 bool
+	tcp  bool
+	dscp uint8
+	rx   attrs.Attributes
+	// rule is the sequence number of the rule matching the flow, or 0 if
+	// none does.
+	rule uint32
+}
+
+var flows = []flow{
+	{name: "ipv4-udp-dscp10", dscp: dscpA, rx: ateA, rule: 10},
+	{name: "ipv4-tcp-dscp20", tcp: true, dscp: dscpB, rx: ateB, rule: 20},
+	{name: "ipv6-udp-dscp10", ipv6: true, dscp: dscpA, rx: ateA, rule: 30},
+	{name: "ipv6-tcp-dscp20", ipv6: true, tcp: true, dscp: dscpB, rx: ateB, rule: 40},
+	// The flows below match the DSCP of a rule but not its protocol, or the
+	// reverse, and fall back to the default network instance.
+	{name: "ipv4-tcp-dscp10", tcp: true, dscp: dscpA, rx: ateDefault},
+	{name: "ipv4-udp-dscp20", dscp: dscpB, rx: ateDefault},
+	{name: "ipv4-udp-dscp0", rx: ateDefault},
+	{name: "ipv6-tcp-dscp10", ipv6: true, tcp: true, dscp: dscpA, rx: ateDefault},
+	{name: "ipv6-udp-dscp0", ipv6: true, rx: ateDefault},
+}
+
+// addFlow adds f to top.
+func addFlow(top gosnappi.Config, f flow) {
+	fl := top.Flows().Add().SetName(f.name)
+	fl.Metrics().SetEnable(true)
+	fl.Packet().Add().Ethernet().Src().SetValue(ateSrc.MAC)
+	if f.ipv6 {
+		fl.TxRx().Device().SetTxNames([]string{ateSrc.Name + ".IPv6"}).SetRxNames([]string{f.rx.Name + ".IPv6"})
+		ip := fl.Packet().Add().Ipv6()
+		ip.Src().SetValue(ateSrc.IPv6)
+		ip.Dst().SetValue(dstIPv6)
+		ip.TrafficClass().SetValue(uint32(f.dscp) << 2)
+	} else {
+		fl.TxRx().Device().SetTxNames([]string{ateSrc.Name + ".IPv4"}).SetRxNames([]string{f.rx.Name + ".IPv4"})
+		ip := fl.Packet().Add().Ipv4()
+		ip.Src().SetValue(ateSrc.IPv4)
+		ip.Dst().SetValue(dstIPv4)
+		ip.Priority().Dscp().Phb().SetValue(uint32(f.dscp))
+	}
+	if f.tcp {
+		tcp := fl.Packet().Add().Tcp()
+		tcp.SrcPort().SetValue(50000)
+		tcp.DstPort().SetValue(5001)
+	} else {
+		udp := fl.Packet().Add().Udp()
+		udp.SrcPort().SetValue(50000)
+		udp.DstPort().SetValue(5001)
+	}
+	fl.Size().SetFixed(frameSize)
+	fl.Rate().SetPps(ppsRate)
+	fl.Duration().FixedPackets().SetPackets(packets)
+}
+
+// matchedPkts returns the number of packets matched by the rule with
+// sequence number seq.
+func matchedPkts(t *testing.T, dut *ondatra.DUTDevice, seq uint32) uint64 {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding().Policy(policyName).Rule(seq).MatchedPkts().State()
+	// The counter is 0 if the device has not matched any packet yet.
+	v, _ := gnmi.Lookup(t, dut, q).Val()
+	return v
+}
+
+func TestVRFSelection(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+	intf := dut.Port(t, "port1").Name()
+	applyVRFSelectionPolicy(t, dut, intf)
+	defer func() {
+		pf := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding()
+		gnmi.Delete(t, dut, pf.Interface(interfaceID(dut, intf)).Config())
+		gnmi.Delete(t, dut, pf.Policy(policyName).Config())
+	}()
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutSrc)
+	ateA.AddToOTG(top, ate.Port(t, "port2"), &dutA)
+	ateB.AddToOTG(top, ate.Port(t, "port3"), &dutB)
+	ateDefault.AddToOTG(top, ate.Port(t, "port4"), &dutDefault)
+
+	for _, f := range flows {
+		t.Run(f.name, func(t *testing.T) {
+			top.Flows().Clear()
+			addFlow(top, f)
+			ate.OTG().PushConfig(t, top)
+			ate.OTG().StartProtocols(t)
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+
+			matched := map[uint32]uint64{}
+			for _, r := range rules {
+				matched[r.seq] = matchedPkts(t, dut, r.seq)
+			}
+
+			ate.OTG().StartTraffic(t)
+			time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+			ate.OTG().StopTraffic(t)
+			time.Sleep(10 * time.Second)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+			counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.name).Counters().State())
+			if counters.GetOutPkts() == 0 || counters.GetInPkts() != counters.GetOutPkts() {
+				t.Errorf("Flow %s: got %d packets received on %s of %d sent, want no loss", f.name, counters.GetInPkts(), f.rx.Name, counters.GetOutPkts())
+			}
+
+			for _, r := range rules {
+				got := matchedPkts(t, dut, r.seq) - matched[r.seq]
+				switch {
+				case r.seq == f.rule && got < counters.GetOutPkts():
+					t.Errorf("Rule %d: got %d matched packets, want at least %d", r.seq, got, counters.GetOutPkts())
+				case r.seq != f.rule && got != 0:
+					t.Errorf("Rule %d: got %d matched packets, want 0", r.seq, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,636 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sr_mpls_isis_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1 and dut:port2 -> ate:port2.
+// The DUT runs level 2 IS-IS with segment routing over both links, with
+// ate:port1 and ate:port2 as its neighbors. ate:port2 advertises
+// targetPrefix.
+//
+// The OTG does not originate SR sub-TLVs, so the DUT is the only segment
+// routing node: its LSPs are captured on ate:port1 to verify the advertised
+// SIDs, and ate:port1 sends the MPLS packets that a penultimate hop would
+// send to the SIDs of the DUT.
+const (
+	plen = 30
+
+	isisName    = "DEFAULT"
+	areaAddress = "49.0001"
+	dutSysID    = "1920.0000.2001"
+	ate1SysID   = "640000000001"
+	ate2SysID   = "640000000002"
+
+	srgbBlock = "srgb-block"
+	srlbBlock = "srlb-block"
+	srgbName  = "srgb"
+	srlbName  = "srlb"
+	srgbBase  = 16000
+	srgbSize  = 8000
+	srlbBase  = 15000
+	srlbSize  = 1000
+
+	// nodeIndex is the index of the prefix-SID of the loopback of the DUT.
+	nodeIndex = 1
+	nodeLabel = srgbBase + nodeIndex
+	adjLabel1 = srlbBase + 1
+	adjLabel2 = srlbBase + 2
+	// innerLabel is the label below the adjacency SID of the adj-sid flow.
+	innerLabel = 100100
+
+	targetPrefix = "198.51.100.0"
+	targetLen    = 24
+	targetDst    = "198.51.100.1"
+
+	ttl = 64
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	captureName = "sr-capture"
+	// lspWait is the time allowed for the DUT to flood a new LSP.
+	lspWait = 30 * time.Second
+)
+
+var (
+	dutLoopback = attrs.Attributes{
+		Desc:    "Node SID",
+		IPv4:    "203.0.113.1",
+		IPv4Len: 32,
+	}
+	ate1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dut1 = attrs.Attributes{
+		Desc:    "SR link to ate1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dut2 = attrs.Attributes{
+		Desc:    "SR link to ate2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ate2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// isisInterface returns the name of the IS-IS interface of the interface
+// name.
+func isisInterface(dut *ondatra.DUTDevice, name string) string {
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		return name + ".0"
+	}
+	return name
+}
+
+// configureDUT configures the interfaces, the reserved label blocks, and
+// IS-IS with segment routing, with the prefix-SID of the loopback advertised
+// with the label option opt.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice, opt oc.E_PrefixSid_LabelOptions) {
+	t.Helper()
+	lb := netutil.LoopbackInterface(t, dut, 0)
+	lo := dutLoopback.NewOCInterface(lb, dut)
+	lo.Type = oc.IETFInterfaces_InterfaceType_softwareLoopback
+	gnmi.Replace(t, dut, gnmi.OC().Interface(lb).Config(), lo)
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, lb, deviations.DefaultNetworkInstance(dut), 0)
+	}
+
+	var links []string
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dut1},
+		{"port2", dut2},
+	} {
+		dp := dut.Port(t, p.port)
+		links = append(links, dp.Name())
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	ni := &oc.NetworkInstance{Name: ygot.String(deviations.DefaultNetworkInstance(dut))}
+	addLabelBlocks(ni, links)
+	isis := addISIS(dut, ni, lb, links)
+	addSIDs(dut, isis, lb, links, opt)
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Config(), ni)
+}
+
+// addLabelBlocks adds to ni the reserved label blocks of the SRGB and the
+// SRLB, and enables MPLS on the links.
+func addLabelBlocks(ni *oc.NetworkInstance, links []string) {
+	mpls := ni.GetOrCreateMpls().GetOrCreateGlobal()
+	for _, b := range []struct {
+		name       string
+		base, size uint32
+	}{
+		{name: srgbBlock, base: srgbBase, size: srgbSize},
+		{name: srlbBlock, base: srlbBase, size: srlbSize},
+	} {
+		rlb := mpls.GetOrCreateReservedLabelBlock(b.name)
+		rlb.SetLowerBound(oc.UnionUint32(b.base))
+		rlb.SetUpperBound(oc.UnionUint32(b.base + b.size - 1))
+	}
+	for _, name := range links {
+		intf := mpls.GetOrCreateInterface(name)
+		intf.SetMplsEnabled(true)
+		intf.GetOrCreateInterfaceRef().SetInterface(name)
+	}
+
+	sr := ni.GetOrCreateSegmentRouting()
+	srgb := sr.GetOrCreateSrgb(srgbName)
+	srgb.SetMplsLabelBlocks([]string{srgbBlock})
+	srgb.SetDataplaneType(oc.SegmentRouting_SrDataplaneType_MPLS)
+	srlb := sr.GetOrCreateSrlb(srlbName)
+	srlb.SetMplsLabelBlock(srlbBlock)
+	srlb.SetDataplaneType(oc.SegmentRouting_SrDataplaneType_MPLS)
+}
+
+// addISIS adds to ni the level 2 IS-IS instance with segment routing over
+// the links, advertising the loopback lb passively.
+func addISIS(dut *ondatra.DUTDevice, ni *oc.NetworkInstance, lb string, links []string) *oc.NetworkInstance_Protocol_Isis {
+	prot := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_ISIS, isisName)
+	prot.SetEnabled(true)
+	isis := prot.GetOrCreateIsis()
+	glob := isis.GetOrCreateGlobal()
+	if deviations.ISISInstanceEnabledRequired(dut) {
+		glob.SetInstance(isisName)
+	}
+	glob.SetNet([]string{fmt.Sprintf("%s.%s.00", areaAddress, dutSysID)})
+	glob.SetLevelCapability(oc.Isis_LevelType_LEVEL_2)
+	glob.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+	sr := glob.GetOrCreateSegmentRouting()
+	sr.SetEnabled(true)
+	sr.SetSrgb(srgbName)
+	sr.SetSrlb(srlbName)
+	level := isis.GetOrCreateLevel(2)
+	level.SetMetricStyle(oc.Isis_MetricStyle_WIDE_METRIC)
+	if deviations.ISISLevelEnabled(dut) {
+		level.SetEnabled(true)
+	}
+	for _, name := range append([]string{lb}, links...) {
+		intf := isis.GetOrCreateInterface(isisInterface(dut, name))
+		intf.SetEnabled(true)
+		if name == lb {
+			intf.SetPassive(true)
+		} else {
+			intf.SetCircuitType(oc.Isis_CircuitType_POINT_TO_POINT)
+		}
+		if deviations.ISISInterfaceLevel1DisableRequired(dut) {
+			intf.GetOrCreateLevel(1).SetEnabled(false)
+		} else {
+			intf.GetOrCreateLevel(2).SetEnabled(true)
+		}
+		if !deviations.ISISInterfaceAfiUnsupported(dut) {
+			intf.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+		}
+	}
+	return isis
+}
+
+// addSIDs adds to isis the prefix-SID of the loopback lb with the label
+// option opt, and the adjacency SIDs of the links to ate1 and ate2.
+func addSIDs(dut *ondatra.DUTDevice, isis *oc.NetworkInstance_Protocol_Isis, lb string, links []string, opt oc.E_PrefixSid_LabelOptions) {
+	af := isis.GetOrCreateInterface(isisInterface(dut, lb)).GetOrCreateLevel(2).GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST)
+	psid := af.GetOrCreateSegmentRouting().GetOrCreatePrefixSid(dutLoopback.IPv4CIDR())
+	psid.SetSidId(oc.UnionUint32(nodeLabel))
+	if opt != oc.PrefixSid_LabelOptions_UNSET {
+		psid.SetLabelOptions(opt)
+	}
+
+	for i, a := range []struct {
+		neighbor string
+		label    uint32
+	}{
+		{ate1.IPv4, adjLabel1},
+		{ate2.IPv4, adjLabel2},
+	} {
+		af := isis.GetOrCreateInterface(isisInterface(dut, links[i])).GetOrCreateLevel(2).GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST)
+		af.GetOrCreateSegmentRouting().GetOrCreateAdjacencySid(a.neighbor, oc.UnionUint32(a.label))
+	}
+}
+
+// configureATE configures IS-IS on ate1 and ate2, with ate2 advertising
+// targetPrefix, and the capture of ate:port1 and ate:port2.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	for _, a := range []struct {
+		port  string
+		ate   attrs.Attributes
+		dut   attrs.Attributes
+		sysID string
+	}{
+		{"port1", ate1, dut1, ate1SysID},
+		{"port2", ate2, dut2, ate2SysID},
+	} {
+		dev := a.ate.AddToOTG(top, ate.Port(t, a.port), &a.dut)
+		isis := dev.Isis().SetSystemId(a.sysID).SetName(a.ate.Name + ".isis")
+		isis.Basic().SetHostname(isis.Name()).SetLearnedLspFilter(true)
+		isis.Advanced().SetAreaAddresses([]string{strings.ReplaceAll(areaAddress, ".", "")})
+		isis.Interfaces().Add().
+			SetEthName(dev.Ethernets().Items()[0].Name()).
+			SetName(a.ate.Name + ".isis.intf").
+			SetNetworkType(gosnappi.IsisInterfaceNetworkType.POINT_TO_POINT).
+			SetLevelType(gosnappi.IsisInterfaceLevelType.LEVEL_2).
+			SetMetric(10)
+		if a.port == "port2" {
+			routes := isis.V4Routes().Add().SetName("target").SetLinkMetric(10)
+			routes.Addresses().Add().SetAddress(targetPrefix).SetPrefix(targetLen)
+		}
+	}
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{ate.Port(t, "port1").ID(), ate.Port(t, "port2").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// awaitAdjacencies waits for the IS-IS adjacencies of the DUT with ate1 and
+// ate2 to be up.
+func awaitAdjacencies(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	isis := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_ISIS, isisName).Isis()
+	for _, port := range []string{"port1", "port2"} {
+		intf := isisInterface(dut, dut.Port(t, port).Name())
+		_, ok := gnmi.WatchAll(t, dut, isis.Interface(intf).Level(2).AdjacencyAny().AdjacencyState().State(), time.Minute, func(v *ygnmi.Value[oc.E_Isis_IsisInterfaceAdjState]) bool {
+			state, present := v.Val()
+			return present && state == oc.Isis_IsisInterfaceAdjState_UP
+		}).Await(t)
+		if !ok {
+			t.Fatalf("IS-IS adjacency on %s is not up", intf)
+		}
+	}
+}
+
+// prefixSID is an IS-IS prefix-SID sub-TLV.
+type prefixSID struct {
+	index uint32
+	// noPHP and explicitNull are the P and E flags.
+	noPHP, explicitNull bool
+}
+
+// srAdvertisement is the segment routing information of the LSP of the DUT.
+type srAdvertisement struct {
+	srgbBase, srgbRange uint32
+	// prefixSIDs are the prefix-SIDs by prefix.
+	prefixSIDs map[string]prefixSID
+	// adjSIDs are the labels of the adjacency SIDs by neighbor system ID.
+	adjSIDs map[string]uint32
+}
+
+const (
+	isisLSPL2     = 20
+	isisLSPHeader = 27
+
+	tlvExtISReach   = 22
+	tlvExtIPReach   = 135
+	tlvRouterCap    = 242
+	subTLVSRCap     = 2
+	subTLVSIDLabel  = 1
+	subTLVPrefixSID = 3
+	subTLVAdjSID    = 31
+
+	prefixSIDFlagP = 0x20
+	prefixSIDFlagE = 0x10
+	adjSIDFlagV    = 0x20
+)
+
+// tlvs calls fn with the type and value of the TLVs of b.
+func tlvs(b []byte, fn func(typ byte, v []byte)) {
+	for len(b) >= 2 && len(b) >= 2+int(b[1]) {
+		fn(b[0], b[2:2+int(b[1])])
+		b = b[2+int(b[1]):]
+	}
+}
+
+// label returns the 20 bit label encoded in the 3 bytes of b.
+func label(b []byte) uint32 {
+	return (uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])) & 0xfffff
+}
+
+// parseLSPs returns the segment routing information of the last level 2
+// LSP fragments of the DUT in pkts.
+func parseLSPs(pkts []gopacket.Packet) (*srAdvertisement, error) {
+	sysID, err := hex.DecodeString(strings.ReplaceAll(dutSysID, ".", ""))
+	if err != nil {
+		return nil, err
+	}
+	// fragments are the TLVs of the LSP fragments of the DUT by number.
+	fragments := map[byte][]byte{}
+	for _, p := range pkts {
+		llc, ok := p.Layer(layers.LayerTypeLLC).(*layers.LLC)
+		if !ok || llc.DSAP != 0xfe {
+			continue
+		}
+		pdu := llc.LayerPayload()
+		if len(pdu) < isisLSPHeader || pdu[0] != 0x83 || pdu[4]&0x1f != isisLSPL2 {
+			continue
+		}
+		// The LSP ID is at offset 12, followed by the pseudonode ID and
+		// the fragment number.
+		if !bytes.Equal(pdu[12:18], sysID) || pdu[18] != 0 {
+			continue
+		}
+		fragments[pdu[19]] = pdu[isisLSPHeader:]
+	}
+	if len(fragments) == 0 {
+		return nil, fmt.Errorf("no LSP of %s captured", dutSysID)
+	}
+
+	adv := &srAdvertisement{prefixSIDs: map[string]prefixSID{}, adjSIDs: map[string]uint32{}}
+	for _, b := range fragments {
+		tlvs(b, func(typ byte, v []byte) {
+			switch typ {
+			case tlvRouterCap:
+				// Router ID and flags.
+				if len(v) < 5 {
+					return
+				}
+				tlvs(v[5:], func(typ byte, v []byte) {
+					// Flags, range and the SID/label sub-TLV of the
+					// first SRGB descriptor.
+					if typ != subTLVSRCap || len(v) < 9 {
+						return
+					}
+					adv.srgbRange = uint32(v[1])<<16 | uint32(v[2])<<8 | uint32(v[3])
+					if v[4] == subTLVSIDLabel && v[5] == 3 {
+						adv.srgbBase = label(v[6:9])
+					}
+				})
+			case tlvExtIPReach:
+				for len(v) >= 5 {
+					ctrl := v[4]
+					plen := int(ctrl & 0x3f)
+					n := 5 + (plen+7)/8
+					if len(v) < n {
+						return
+					}
+					ip := make(net.IP, 4)
+					copy(ip, v[5:n])
+					prefix := fmt.Sprintf("%s/%d", ip, plen)
+					v = v[n:]
+					if ctrl&0x40 == 0 {
+						continue
+					}
+					if len(v) < 1 || len(v) < 1+int(v[0]) {
+						return
+					}
+					tlvs(v[1:1+int(v[0])], func(typ byte, s []byte) {
+						// Flags, algorithm and index.
+						if typ != subTLVPrefixSID || len(s) != 6 {
+							return
+						}
+						adv.prefixSIDs[prefix] = prefixSID{
+							index:        binary.BigEndian.Uint32(s[2:6]),
+							noPHP:        s[0]&prefixSIDFlagP != 0,
+							explicitNull: s[0]&prefixSIDFlagE != 0,
+						}
+					})
+					v = v[1+int(v[0]):]
+				}
+			case tlvExtISReach:
+				for len(v) >= 11 && len(v) >= 11+int(v[10]) {
+					neighbor := hex.EncodeToString(v[:6])
+					tlvs(v[11:11+int(v[10])], func(typ byte, s []byte) {
+						// Flags, weight and the label.
+						if typ == subTLVAdjSID && len(s) == 5 && s[0]&adjSIDFlagV != 0 {
+							adv.adjSIDs[neighbor] = label(s[2:5])
+						}
+					})
+					v = v[11+int(v[10]):]
+				}
+			}
+		})
+	}
+	return adv, nil
+}
+
+// verifyAdvertisement verifies the SRGB, the prefix-SID of the loopback with
+// the flags of opt, and the adjacency SIDs advertised in the LSPs of the DUT
+// captured on ate:port1.
+func verifyAdvertisement(t *testing.T, ate *ondatra.ATEDevice, opt oc.E_PrefixSid_LabelOptions) {
+	t.Helper()
+	adv, err := parseLSPs(otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port1").ID()))
+	if err != nil {
+		t.Fatalf("Cannot parse the LSPs of the DUT: %v", err)
+	}
+	t.Logf("SR advertisement of the DUT: %+v", adv)
+	if adv.srgbBase != srgbBase || adv.srgbRange != srgbSize {
+		t.Errorf("SRGB: got base %d and range %d, want base %d and range %d", adv.srgbBase, adv.srgbRange, srgbBase, srgbSize)
+	}
+	want := prefixSID{
+		index:        nodeIndex,
+		noPHP:        opt == oc.PrefixSid_LabelOptions_NO_PHP || opt == oc.PrefixSid_LabelOptions_EXPLICIT_NULL,
+		explicitNull: opt == oc.PrefixSid_LabelOptions_EXPLICIT_NULL,
+	}
+	if got, ok := adv.prefixSIDs[dutLoopback.IPv4CIDR()]; !ok {
+		t.Errorf("Prefix-SID of %s is not advertised", dutLoopback.IPv4CIDR())
+	} else if got != want {
+		t.Errorf("Prefix-SID of %s: got %+v, want %+v", dutLoopback.IPv4CIDR(), got, want)
+	}
+	for sysID, want := range map[string]uint32{ate1SysID: adjLabel1, ate2SysID: adjLabel2} {
+		if got := adv.adjSIDs[sysID]; got != want {
+			t.Errorf("Adjacency SID of %s: got label %d, want %d", sysID, got, want)
+		}
+	}
+}
+
+// flow is a flow sent from ate:port1 to ate:port2 with the label stack
+// labels, and the labels expected on ate:port2.
+type flow struct {
+	name   string
+	labels []uint32
+	want   []uint32
+}
+
+// addFlow replaces the flows of top with f, sent to dstMAC, the MAC address
+// of dut:port1.
+func addFlow(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config, f flow, dstMAC string) {
+	t.Helper()
+	top.Flows().Clear()
+	fl := top.Flows().Add().SetName(f.name)
+	fl.Metrics().SetEnable(true)
+	fl.TxRx().Port().SetTxName(ate.Port(t, "port1").ID()).SetRxNames([]string{ate.Port(t, "port2").ID()})
+	eth := fl.Packet().Add().Ethernet()
+	eth.Src().SetValue(ate1.MAC)
+	eth.Dst().SetValue(dstMAC)
+	for i, l := range f.labels {
+		mpls := fl.Packet().Add().Mpls()
+		mpls.Label().SetValue(l)
+		mpls.TimeToLive().SetValue(ttl)
+		if i == len(f.labels)-1 {
+			mpls.BottomOfStack().SetValue(1)
+		} else {
+			mpls.BottomOfStack().SetValue(0)
+		}
+	}
+	ip := fl.Packet().Add().Ipv4()
+	ip.Src().SetValue(ate1.IPv4)
+	ip.Dst().SetValue(targetDst)
+	fl.Packet().Add().Udp().DstPort().SetValue(50000)
+	fl.Size().SetFixed(frameSize)
+	fl.Rate().SetPps(ppsRate)
+	fl.Duration().FixedPackets().SetPackets(packets)
+}
+
+// verifyFlow sends f and verifies that it is received on ate:port2 without
+// loss and with the labels f.want.
+func verifyFlow(t *testing.T, dut *ondatra.DUTDevice, ate *ondatra.ATEDevice, top gosnappi.Config, f flow, dstMAC string) {
+	t.Helper()
+	addFlow(t, ate, top, f, dstMAC)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	awaitAdjacencies(t, dut)
+
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+	otgutils.StopCapture(t, ate.OTG())
+	time.Sleep(10 * time.Second)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+	counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.name).Counters().State())
+	if sent := counters.GetOutPkts(); sent == 0 || counters.GetInPkts() != sent {
+		t.Errorf("Flow %s: got %d packets received of %d sent, want no loss", f.name, counters.GetInPkts(), sent)
+	}
+
+	// stacks counts the received packets of the flow by label stack.
+	stacks := map[string]int{}
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port2").ID()) {
+		ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok || ip.SrcIP.String() != ate1.IPv4 || p.Layer(layers.LayerTypeUDP) == nil {
+			continue
+		}
+		var labels []uint32
+		for _, l := range p.Layers() {
+			if m, ok := l.(*layers.MPLS); ok {
+				labels = append(labels, m.Label)
+			}
+		}
+		stacks[fmt.Sprint(labels)]++
+	}
+	t.Logf("Flow %s: captured packets by label stack: %v", f.name, stacks)
+	want := fmt.Sprint(f.want)
+	for stack, n := range stacks {
+		if stack != want {
+			t.Errorf("Flow %s: got %d packets with labels %s, want %s", f.name, n, stack, want)
+		}
+	}
+	if stacks[want] == 0 {
+		t.Errorf("Flow %s: got no packets with labels %s", f.name, want)
+	}
+}
+
+func TestSRMPLS(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	top := configureATE(t, ate)
+
+	cases := []struct {
+		desc string
+		opt  oc.E_PrefixSid_LabelOptions
+		// phpFlow is the flow a penultimate hop sends to the node SID of
+		// the DUT.
+		phpFlow flow
+	}{{
+		desc:    "PHP",
+		opt:     oc.PrefixSid_LabelOptions_UNSET,
+		phpFlow: flow{name: "php", labels: nil},
+	}, {
+		desc:    "NoPHP",
+		opt:     oc.PrefixSid_LabelOptions_NO_PHP,
+		phpFlow: flow{name: "no-php", labels: []uint32{nodeLabel}},
+	}, {
+		desc:    "ExplicitNull",
+		opt:     oc.PrefixSid_LabelOptions_EXPLICIT_NULL,
+		phpFlow: flow{name: "explicit-null", labels: []uint32{0}},
+	}}
+
+	configureDUT(t, dut, cases[0].opt)
+	dstMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port1").Name()).Ethernet().MacAddress().State())
+
+	for i, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			// The LSPs of the DUT are captured from the start of the
+			// protocols of the ATE in the first case, and from the change
+			// of the label option in the others.
+			if i == 0 {
+				ate.OTG().PushConfig(t, top)
+				otgutils.StartCapture(t, ate.OTG())
+				ate.OTG().StartProtocols(t)
+			} else {
+				otgutils.StartCapture(t, ate.OTG())
+				configureDUT(t, dut, tc.opt)
+			}
+			awaitAdjacencies(t, dut)
+			time.Sleep(lspWait)
+			otgutils.StopCapture(t, ate.OTG())
+
+			t.Run("Advertisement", func(t *testing.T) {
+				verifyAdvertisement(t, ate, tc.opt)
+			})
+			t.Run("Forwarding", func(t *testing.T) {
+				verifyFlow(t, dut, ate, top, tc.phpFlow, dstMAC)
+			})
+		})
+	}
+
+	t.Run("AdjacencySID", func(t *testing.T) {
+		verifyFlow(t, dut, ate, top, flow{name: "adj-sid", labels: []uint32{adjLabel2, innerLabel}, want: []uint32{innerLabel}}, dstMAC)
+	})
+}
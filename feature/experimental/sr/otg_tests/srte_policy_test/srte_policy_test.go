@@ -0,0 +1,640 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srte_policy_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the source of the traffic,
+// dut:port2 -> ate:port2 and dut:port3 -> ate:port3, the first hops of the
+// primary and the secondary candidate paths of the policy, and dut:port4 ->
+// ate:port4, the route reflector advertising the routes of the remote PE.
+//
+// The DUT runs level 2 IS-IS with segment routing with ate2 and ate3, with
+// the adjacency SIDs adjLabel2 and adjLabel3 as the first segments of the
+// segment lists of the policy. OpenConfig models the state of the SR-TE
+// policies only, so the policy is configured with the CLI of the vendor.
+// ate4 advertises coloredPrefix with the color of the policy and the
+// endpoint of the policy as next hop, and plainPrefix without color with
+// ate4 as next hop.
+const (
+	plen = 30
+
+	isisName    = "DEFAULT"
+	areaAddress = "49.0001"
+	dutSysID    = "1920.0000.2001"
+	ate2SysID   = "640000000002"
+	ate3SysID   = "640000000003"
+
+	srgbBlock = "srgb-block"
+	srlbBlock = "srlb-block"
+	srgbName  = "srgb"
+	srlbName  = "srlb"
+	srgbBase  = 16000
+	srgbSize  = 8000
+	srlbBase  = 15000
+	srlbSize  = 1000
+
+	adjLabel2 = srlbBase + 2
+	adjLabel3 = srlbBase + 3
+
+	asn        = 65000
+	bgpName    = "BGP"
+	policyName = "PERMIT-ALL"
+
+	// color and endpoint identify the SR-TE policy. primaryPreference and
+	// secondaryPreference are the preferences of its candidate paths.
+	color               = 100
+	endpoint            = "203.0.113.100"
+	primaryPreference   = 200
+	secondaryPreference = 100
+	// primaryLabel and secondaryLabel are the node SIDs beyond ate2 and
+	// ate3, and endpointLabel the node SID of the endpoint, in the segment
+	// lists of the primary and the secondary candidate paths.
+	primaryLabel   = 300002
+	secondaryLabel = 300003
+	endpointLabel  = 400100
+
+	coloredPrefix = "198.51.100.0"
+	coloredDst    = "198.51.100.1"
+	plainPrefix   = "198.18.0.0"
+	plainDst      = "198.18.0.1"
+	routeLen      = 24
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	captureName = "srte-capture"
+	// convergenceTimeout is the time allowed for the policy to switch to
+	// another candidate path.
+	convergenceTimeout = 2 * time.Minute
+)
+
+var (
+	dutLoopback = attrs.Attributes{
+		Desc:    "Router ID",
+		IPv4:    "203.0.113.1",
+		IPv4Len: 32,
+	}
+	ate1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dut1 = attrs.Attributes{
+		Desc:    "Traffic source",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dut2 = attrs.Attributes{
+		Desc:    "Primary path",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ate2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	dut3 = attrs.Attributes{
+		Desc:    "Secondary path",
+		IPv4:    "192.0.2.9",
+		IPv4Len: plen,
+	}
+	ate3 = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv4Len: plen,
+	}
+	dut4 = attrs.Attributes{
+		Desc:    "Route reflector",
+		IPv4:    "192.0.2.13",
+		IPv4Len: plen,
+	}
+	ate4 = attrs.Attributes{
+		Name:    "ate4",
+		MAC:     "02:00:04:01:01:01",
+		IPv4:    "192.0.2.14",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// isisInterface returns the name of the IS-IS interface of the interface
+// name.
+func isisInterface(dut *ondatra.DUTDevice, name string) string {
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		return name + ".0"
+	}
+	return name
+}
+
+// configureDUT configures the interfaces, IS-IS with segment routing with
+// ate2 and ate3, iBGP with ate4 and the SR-TE policy.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	lb := netutil.LoopbackInterface(t, dut, 0)
+	lo := dutLoopback.NewOCInterface(lb, dut)
+	lo.Type = oc.IETFInterfaces_InterfaceType_softwareLoopback
+	gnmi.Replace(t, dut, gnmi.OC().Interface(lb).Config(), lo)
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, lb, dni, 0)
+	}
+
+	var links []string
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dut1},
+		{"port2", dut2},
+		{"port3", dut3},
+		{"port4", dut4},
+	} {
+		dp := dut.Port(t, p.port)
+		links = append(links, dp.Name())
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), dni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	rp := &oc.RoutingPolicy{}
+	stmt, err := rp.GetOrCreatePolicyDefinition(policyName).AppendNewStatement("10")
+	if err != nil {
+		t.Fatalf("Cannot create the statement of %s: %v", policyName, err)
+	}
+	stmt.GetOrCreateActions().SetPolicyResult(oc.RoutingPolicy_PolicyResultType_ACCEPT_ROUTE)
+	gnmi.Update(t, dut, gnmi.OC().RoutingPolicy().Config(), rp)
+
+	ni := &oc.NetworkInstance{Name: ygot.String(dni)}
+	pathLinks := links[1:3]
+	addLabelBlocks(ni, pathLinks)
+	addISIS(dut, ni, pathLinks)
+	addBGP(dut, ni)
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(dni).Config(), ni)
+
+	if _, err := dut.RawAPIs().GNMI(t).Set(context.Background(), cliSetRequest(srtePolicyConfig(t, dut))); err != nil {
+		t.Fatalf("Failed to configure the SR-TE policy: %v", err)
+	}
+}
+
+// addLabelBlocks adds to ni the reserved label blocks of the SRGB and the
+// SRLB, and enables MPLS on the links.
+func addLabelBlocks(ni *oc.NetworkInstance, links []string) {
+	mpls := ni.GetOrCreateMpls().GetOrCreateGlobal()
+	for _, b := range []struct {
+		name       string
+		base, size uint32
+	}{
+		{name: srgbBlock, base: srgbBase, size: srgbSize},
+		{name: srlbBlock, base: srlbBase, size: srlbSize},
+	} {
+		rlb := mpls.GetOrCreateReservedLabelBlock(b.name)
+		rlb.SetLowerBound(oc.UnionUint32(b.base))
+		rlb.SetUpperBound(oc.UnionUint32(b.base + b.size - 1))
+	}
+	for _, name := range links {
+		intf := mpls.GetOrCreateInterface(name)
+		intf.SetMplsEnabled(true)
+		intf.GetOrCreateInterfaceRef().SetInterface(name)
+	}
+
+	sr := ni.GetOrCreateSegmentRouting()
+	srgb := sr.GetOrCreateSrgb(srgbName)
+	srgb.SetMplsLabelBlocks([]string{srgbBlock})
+	srgb.SetDataplaneType(oc.SegmentRouting_SrDataplaneType_MPLS)
+	srlb := sr.GetOrCreateSrlb(srlbName)
+	srlb.SetMplsLabelBlock(srlbBlock)
+	srlb.SetDataplaneType(oc.SegmentRouting_SrDataplaneType_MPLS)
+}
+
+// addISIS adds to ni the level 2 IS-IS instance with segment routing over
+// the links to ate2 and ate3, with their adjacency SIDs.
+func addISIS(dut *ondatra.DUTDevice, ni *oc.NetworkInstance, links []string) {
+	prot := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_ISIS, isisName)
+	prot.SetEnabled(true)
+	isis := prot.GetOrCreateIsis()
+	glob := isis.GetOrCreateGlobal()
+	if deviations.ISISInstanceEnabledRequired(dut) {
+		glob.SetInstance(isisName)
+	}
+	glob.SetNet([]string{fmt.Sprintf("%s.%s.00", areaAddress, dutSysID)})
+	glob.SetLevelCapability(oc.Isis_LevelType_LEVEL_2)
+	glob.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+	sr := glob.GetOrCreateSegmentRouting()
+	sr.SetEnabled(true)
+	sr.SetSrgb(srgbName)
+	sr.SetSrlb(srlbName)
+	level := isis.GetOrCreateLevel(2)
+	level.SetMetricStyle(oc.Isis_MetricStyle_WIDE_METRIC)
+	if deviations.ISISLevelEnabled(dut) {
+		level.SetEnabled(true)
+	}
+	for i, a := range []struct {
+		neighbor string
+		label    uint32
+	}{
+		{ate2.IPv4, adjLabel2},
+		{ate3.IPv4, adjLabel3},
+	} {
+		intf := isis.GetOrCreateInterface(isisInterface(dut, links[i]))
+		intf.SetEnabled(true)
+		intf.SetCircuitType(oc.Isis_CircuitType_POINT_TO_POINT)
+		if deviations.ISISInterfaceLevel1DisableRequired(dut) {
+			intf.GetOrCreateLevel(1).SetEnabled(false)
+		} else {
+			intf.GetOrCreateLevel(2).SetEnabled(true)
+		}
+		if !deviations.ISISInterfaceAfiUnsupported(dut) {
+			intf.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+		}
+		af := intf.GetOrCreateLevel(2).GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST)
+		af.GetOrCreateSegmentRouting().GetOrCreateAdjacencySid(a.neighbor, oc.UnionUint32(a.label))
+	}
+}
+
+// addBGP adds to ni iBGP with the IPv4 unicast address family with ate4.
+func addBGP(dut *ondatra.DUTDevice, ni *oc.NetworkInstance) {
+	bgp := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).GetOrCreateBgp()
+	glob := bgp.GetOrCreateGlobal()
+	glob.SetAs(asn)
+	glob.SetRouterId(dutLoopback.IPv4)
+	glob.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST).SetEnabled(true)
+
+	nbr := bgp.GetOrCreateNeighbor(ate4.IPv4)
+	nbr.SetPeerAs(asn)
+	nbr.SetEnabled(true)
+	af := nbr.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST)
+	af.SetEnabled(true)
+	if deviations.RoutePolicyUnderAFIUnsupported(dut) {
+		nbr.GetOrCreateApplyPolicy().SetImportPolicy([]string{policyName})
+		nbr.GetOrCreateApplyPolicy().SetExportPolicy([]string{policyName})
+	} else {
+		af.GetOrCreateApplyPolicy().SetImportPolicy([]string{policyName})
+		af.GetOrCreateApplyPolicy().SetExportPolicy([]string{policyName})
+	}
+}
+
+// srtePolicyConfig returns the CLI configuration of the SR-TE policy, with
+// the primary candidate path through ate2 and the secondary one through
+// ate3.
+func srtePolicyConfig(t *testing.T, dut *ondatra.DUTDevice) string {
+	t.Helper()
+	switch dut.Vendor() {
+	case ondatra.ARISTA:
+		return fmt.Sprintf(`
+router traffic-engineering
+   segment-routing
+      policy endpoint %[1]s color %[2]d
+         path-group preference %[3]d
+            segment-list label-stack %[5]d %[6]d %[9]d
+         path-group preference %[4]d
+            segment-list label-stack %[7]d %[8]d %[9]d
+!
+`, endpoint, color, primaryPreference, secondaryPreference, adjLabel2, primaryLabel, adjLabel3, secondaryLabel, endpointLabel)
+	case ondatra.CISCO:
+		return fmt.Sprintf(`
+segment-routing
+ traffic-eng
+  segment-list PRIMARY
+   index 10 mpls label %[5]d
+   index 20 mpls label %[6]d
+   index 30 mpls label %[9]d
+  !
+  segment-list SECONDARY
+   index 10 mpls label %[7]d
+   index 20 mpls label %[8]d
+   index 30 mpls label %[9]d
+  !
+  policy SRTE-%[2]d
+   color %[2]d end-point ipv4 %[1]s
+   candidate-paths
+    preference %[3]d
+     explicit segment-list PRIMARY
+     !
+    !
+    preference %[4]d
+     explicit segment-list SECONDARY
+     !
+    !
+   !
+  !
+ !
+!
+`, endpoint, color, primaryPreference, secondaryPreference, adjLabel2, primaryLabel, adjLabel3, secondaryLabel, endpointLabel)
+	default:
+		t.Skipf("SR-TE policy configuration is not supported for vendor %v", dut.Vendor())
+	}
+	return ""
+}
+
+func cliSetRequest(config string) *gpb.SetRequest {
+	return &gpb.SetRequest{
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{
+				Origin: "cli",
+			},
+			Val: &gpb.TypedValue{
+				Value: &gpb.TypedValue_AsciiVal{
+					AsciiVal: config,
+				},
+			},
+		}},
+	}
+}
+
+// configureATE configures IS-IS on ate2 and ate3, the routes of the remote
+// PE advertised by ate4, and the capture of ate:port2, ate:port3 and
+// ate:port4.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	ate1.AddToOTG(top, ate.Port(t, "port1"), &dut1)
+	for _, a := range []struct {
+		port  string
+		ate   attrs.Attributes
+		dut   attrs.Attributes
+		sysID string
+	}{
+		{"port2", ate2, dut2, ate2SysID},
+		{"port3", ate3, dut3, ate3SysID},
+	} {
+		dev := a.ate.AddToOTG(top, ate.Port(t, a.port), &a.dut)
+		isis := dev.Isis().SetSystemId(a.sysID).SetName(a.ate.Name + ".isis")
+		isis.Basic().SetHostname(isis.Name()).SetLearnedLspFilter(true)
+		isis.Advanced().SetAreaAddresses([]string{strings.ReplaceAll(areaAddress, ".", "")})
+		isis.Interfaces().Add().
+			SetEthName(dev.Ethernets().Items()[0].Name()).
+			SetName(a.ate.Name + ".isis.intf").
+			SetNetworkType(gosnappi.IsisInterfaceNetworkType.POINT_TO_POINT).
+			SetLevelType(gosnappi.IsisInterfaceLevelType.LEVEL_2).
+			SetMetric(10)
+	}
+
+	dev := ate4.AddToOTG(top, ate.Port(t, "port4"), &dut4)
+	v4 := dev.Ethernets().Items()[0].Ipv4Addresses().Items()[0]
+	peer := dev.Bgp().SetRouterId(ate4.IPv4).Ipv4Interfaces().Add().SetIpv4Name(v4.Name()).Peers().Add().SetName(ate4.Name + ".BGP4.peer")
+	peer.SetPeerAddress(dut4.IPv4).SetAsNumber(asn).SetAsType(gosnappi.BgpV4PeerAsType.IBGP)
+	for _, r := range []struct {
+		name    string
+		prefix  string
+		nextHop string
+		colored bool
+	}{
+		{"colored", coloredPrefix, endpoint, true},
+		{"plain", plainPrefix, ate4.IPv4, false},
+	} {
+		routes := peer.V4Routes().Add().SetName(ate4.Name + "." + r.name)
+		routes.SetNextHopIpv4Address(r.nextHop).
+			SetNextHopAddressType(gosnappi.BgpV4RouteRangeNextHopAddressType.IPV4).
+			SetNextHopMode(gosnappi.BgpV4RouteRangeNextHopMode.MANUAL)
+		routes.Addresses().Add().SetAddress(r.prefix).SetPrefix(routeLen)
+		if r.colored {
+			routes.ExtendedCommunities().Add().TransitiveOpaqueType().ColorSubtype().SetColor(color)
+		}
+	}
+
+	var ports []string
+	for _, port := range []string{"port2", "port3", "port4"} {
+		ports = append(ports, ate.Port(t, port).ID())
+	}
+	top.Captures().Add().SetName(captureName).SetPortNames(ports).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// awaitProtocols waits for the IS-IS adjacencies on the ports of the DUT
+// and the BGP session with ate4 to be up.
+func awaitProtocols(t *testing.T, dut *ondatra.DUTDevice, ports ...string) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	isis := gnmi.OC().NetworkInstance(dni).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_ISIS, isisName).Isis()
+	for _, port := range ports {
+		intf := isisInterface(dut, dut.Port(t, port).Name())
+		_, ok := gnmi.WatchAll(t, dut, isis.Interface(intf).Level(2).AdjacencyAny().AdjacencyState().State(), time.Minute, func(v *ygnmi.Value[oc.E_Isis_IsisInterfaceAdjState]) bool {
+			state, present := v.Val()
+			return present && state == oc.Isis_IsisInterfaceAdjState_UP
+		}).Await(t)
+		if !ok {
+			t.Fatalf("IS-IS adjacency on %s is not up", intf)
+		}
+	}
+	q := gnmi.OC().NetworkInstance(dni).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).Bgp().Neighbor(ate4.IPv4).SessionState().State()
+	_, ok := gnmi.Watch(t, dut, q, 2*time.Minute, func(v *ygnmi.Value[oc.E_Bgp_Neighbor_SessionState]) bool {
+		state, present := v.Val()
+		return present && state == oc.Bgp_Neighbor_SessionState_ESTABLISHED
+	}).Await(t)
+	if !ok {
+		t.Fatalf("BGP session with %s is not established", ate4.IPv4)
+	}
+}
+
+// activePreference returns the preference of the active candidate path of
+// the SR-TE policy, and whether the policy is active.
+func activePreference(t *testing.T, dut *ondatra.DUTDevice) (uint32, bool) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).SegmentRouting().TePolicy(color, endpoint).State()
+	policy, ok := gnmi.Lookup(t, dut, q).Val()
+	if !ok || !policy.GetActive() {
+		return 0, false
+	}
+	for _, path := range policy.CandidatePath {
+		if path.GetActive() {
+			return path.GetPreference(), true
+		}
+	}
+	return 0, false
+}
+
+// awaitActivePath waits for the candidate path with the preference want to
+// be the active path of the SR-TE policy.
+func awaitActivePath(t *testing.T, dut *ondatra.DUTDevice, want uint32) {
+	t.Helper()
+	var got uint32
+	var active bool
+	for deadline := time.Now().Add(convergenceTimeout); time.Now().Before(deadline); time.Sleep(5 * time.Second) {
+		if got, active = activePreference(t, dut); active && got == want {
+			t.Logf("SR-TE policy of color %d to %s is active with the candidate path of preference %d", color, endpoint, got)
+			return
+		}
+	}
+	t.Fatalf("SR-TE policy of color %d to %s: got active %t with the candidate path of preference %d, want active with preference %d", color, endpoint, active, got, want)
+}
+
+// setPrimaryLinkEnabled enables or disables the interface of dut:port2. The
+// interface of the DUT is used rather than the link of the ATE, as the OTG
+// configuration is pushed again for each flow.
+func setPrimaryLinkEnabled(t *testing.T, dut *ondatra.DUTDevice, enabled bool) {
+	t.Helper()
+	gnmi.Replace(t, dut, gnmi.OC().Interface(dut.Port(t, "port2").Name()).Enabled().Config(), enabled)
+}
+
+// flow is a flow sent from ate:port1 to dst, expected on rx with the label
+// stack want. isisPorts are the ports with an IS-IS adjacency while the flow
+// is sent.
+type flow struct {
+	name      string
+	dst       string
+	rx        string
+	want      []uint32
+	isisPorts []string
+}
+
+// addFlow replaces the flows of top with f, sent to dstMAC, the MAC address
+// of dut:port1.
+func addFlow(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config, f flow, dstMAC string) {
+	t.Helper()
+	top.Flows().Clear()
+	fl := top.Flows().Add().SetName(f.name)
+	fl.Metrics().SetEnable(true)
+	fl.TxRx().Port().SetTxName(ate.Port(t, "port1").ID()).SetRxNames([]string{ate.Port(t, f.rx).ID()})
+	eth := fl.Packet().Add().Ethernet()
+	eth.Src().SetValue(ate1.MAC)
+	eth.Dst().SetValue(dstMAC)
+	ip := fl.Packet().Add().Ipv4()
+	ip.Src().SetValue(ate1.IPv4)
+	ip.Dst().SetValue(f.dst)
+	fl.Packet().Add().Udp().DstPort().SetValue(50000)
+	fl.Size().SetFixed(frameSize)
+	fl.Rate().SetPps(ppsRate)
+	fl.Duration().FixedPackets().SetPackets(packets)
+}
+
+// verifyFlow sends f and verifies that it is received on f.rx without loss
+// and with the labels f.want.
+func verifyFlow(t *testing.T, dut *ondatra.DUTDevice, ate *ondatra.ATEDevice, top gosnappi.Config, f flow) {
+	t.Helper()
+	dstMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port1").Name()).Ethernet().MacAddress().State())
+	addFlow(t, ate, top, f, dstMAC)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	awaitProtocols(t, dut, f.isisPorts...)
+
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+	otgutils.StopCapture(t, ate.OTG())
+	time.Sleep(10 * time.Second)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+	counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.name).Counters().State())
+	if sent := counters.GetOutPkts(); sent == 0 || counters.GetInPkts() != sent {
+		t.Errorf("Flow %s: got %d packets received on %s of %d sent, want no loss", f.name, counters.GetInPkts(), f.rx, sent)
+	}
+
+	// stacks counts the received packets of the flow by label stack.
+	stacks := map[string]int{}
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, f.rx).ID()) {
+		ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok || ip.SrcIP.String() != ate1.IPv4 || p.Layer(layers.LayerTypeUDP) == nil {
+			continue
+		}
+		var labels []uint32
+		for _, l := range p.Layers() {
+			if m, ok := l.(*layers.MPLS); ok {
+				labels = append(labels, m.Label)
+			}
+		}
+		stacks[fmt.Sprint(labels)]++
+	}
+	t.Logf("Flow %s: captured packets by label stack: %v", f.name, stacks)
+	want := fmt.Sprint(f.want)
+	for stack, n := range stacks {
+		if stack != want {
+			t.Errorf("Flow %s: got %d packets with labels %s, want %s", f.name, n, stack, want)
+		}
+	}
+	if stacks[want] == 0 {
+		t.Errorf("Flow %s: got no packets with labels %s", f.name, want)
+	}
+}
+
+func TestSRTEPolicy(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+
+	ate := ondatra.ATE(t, "ate")
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	awaitProtocols(t, dut, "port2", "port3")
+
+	t.Run("PrimaryPath", func(t *testing.T) {
+		awaitActivePath(t, dut, primaryPreference)
+		verifyFlow(t, dut, ate, top, flow{
+			name:      "colored-primary",
+			dst:       coloredDst,
+			rx:        "port2",
+			want:      []uint32{primaryLabel, endpointLabel},
+			isisPorts: []string{"port2", "port3"},
+		})
+	})
+
+	t.Run("UncoloredRoute", func(t *testing.T) {
+		verifyFlow(t, dut, ate, top, flow{
+			name:      "plain",
+			dst:       plainDst,
+			rx:        "port4",
+			isisPorts: []string{"port2", "port3"},
+		})
+	})
+
+	t.Run("SecondaryPath", func(t *testing.T) {
+		setPrimaryLinkEnabled(t, dut, false)
+		defer setPrimaryLinkEnabled(t, dut, true)
+		awaitActivePath(t, dut, secondaryPreference)
+		verifyFlow(t, dut, ate, top, flow{
+			name:      "colored-secondary",
+			dst:       coloredDst,
+			rx:        "port3",
+			want:      []uint32{secondaryLabel, endpointLabel},
+			isisPorts: []string{"port3"},
+		})
+	})
+}
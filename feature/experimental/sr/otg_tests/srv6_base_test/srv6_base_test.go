@@ -0,0 +1,974 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv6_base_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the source of the SRv6
+// traffic, dut:port2 -> ate:port2 in vrfName, and dut:port3 -> ate:port3 in
+// the default network instance.
+//
+// The DUT runs IS-IS with SRv6 with ate:port1 and ate:port3, and iBGP with
+// the VPN address families with ate:port1, advertising the routes of vrfName
+// with its End.DT4 and End.DT6 SIDs. OpenConfig does not model SRv6 locators
+// and the OTG does not originate SRv6 SIDs, so the SRv6 configuration of the
+// DUT is set with the CLI of the vendor, and the SIDs allocated by the DUT are
+// learned from its LSPs and BGP updates captured on ate:port1.
+const (
+	plenIPv4 = 30
+	plenIPv6 = 126
+
+	isisName    = "DEFAULT"
+	areaAddress = "49.0001"
+	dutSysID    = "1920.0000.2001"
+	ate1SysID   = "640000000001"
+	ate3SysID   = "640000000003"
+
+	asn       = 65000
+	vrfName   = "VRF-A"
+	routeDist = "65000:1"
+
+	locatorName = "LOC"
+	locator     = "2001:db8:f001::/48"
+	usidName    = "USID"
+	// usidLocator is the uSID 0001 of the DUT in the 32-bit uSID block
+	// 2001:db8::/32.
+	usidLocator = "2001:db8:1::/48"
+	// usidNext is the uSID 0002 of the next node, routed to ate:port3.
+	usidNext = "2001:db8:2::/48"
+	// usidCarrier is the destination address of the uSID flow, with the
+	// uSIDs of the DUT and of the next node, and usidShifted is the address
+	// after the DUT shifts it.
+	usidCarrier = "2001:db8:1:2::"
+	usidShifted = "2001:db8:2::"
+
+	// endXFinalDst is the last segment of the End.X flow, not routed by
+	// the DUT.
+	endXFinalDst = "2001:db8:ffff::1"
+	dt4InnerSrc  = "198.51.100.1"
+	dt6InnerSrc  = "2001:db8:100::1"
+
+	hopLimit = 64
+	udpPort  = 50001
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	captureName = "srv6-capture"
+	// advertisementWait is the time allowed for the DUT to advertise its
+	// SIDs.
+	advertisementWait = 30 * time.Second
+)
+
+var (
+	ate1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv6:    "2001:db8::2",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dut1 = attrs.Attributes{
+		Desc:    "SRv6 source",
+		IPv4:    "192.0.2.1",
+		IPv6:    "2001:db8::1",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dut2 = attrs.Attributes{
+		Desc:    "VRF output",
+		IPv4:    "192.0.2.5",
+		IPv6:    "2001:db8::5",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	ate2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv6:    "2001:db8::6",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	dut3 = attrs.Attributes{
+		Desc:    "SRv6 output",
+		IPv4:    "192.0.2.9",
+		IPv6:    "2001:db8::9",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+	ate3 = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv6:    "2001:db8::a",
+		IPv4Len: plenIPv4,
+		IPv6Len: plenIPv6,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// isisInterface returns the name of the IS-IS interface of the interface
+// name.
+func isisInterface(dut *ondatra.DUTDevice, name string) string {
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		return name + ".0"
+	}
+	return name
+}
+
+// configureDUT configures the interfaces, vrfName, IS-IS, the static route to
+// usidNext and the SRv6 configuration of the vendor. It returns whether the
+// DUT is configured with a uSID locator.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) bool {
+	t.Helper()
+	vrf := &oc.NetworkInstance{Name: ygot.String(vrfName)}
+	vrf.SetType(oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_L3VRF)
+	gnmi.Replace(t, dut, gnmi.OC().NetworkInstance(vrfName).Config(), vrf)
+
+	var links []string
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+		ni    string
+	}{
+		{"port1", dut1, deviations.DefaultNetworkInstance(dut)},
+		{"port2", dut2, vrfName},
+		{"port3", dut3, deviations.DefaultNetworkInstance(dut)},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if p.ni != deviations.DefaultNetworkInstance(dut) || deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), p.ni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+		if p.ni != vrfName {
+			links = append(links, dp.Name())
+		}
+	}
+
+	ni := &oc.NetworkInstance{Name: ygot.String(deviations.DefaultNetworkInstance(dut))}
+	addISIS(dut, ni, links)
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Config(), ni)
+
+	b := &gnmi.SetBatch{}
+	cfg := &cfgplugins.StaticRouteCfg{
+		NetworkInstance: deviations.DefaultNetworkInstance(dut),
+		Prefix:          usidNext,
+		NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+			"0": oc.UnionString(ate3.IPv6),
+		},
+	}
+	if _, err := cfgplugins.NewStaticRouteCfg(b, cfg, dut); err != nil {
+		t.Fatalf("Failed to configure the static route to %s: %v", usidNext, err)
+	}
+	b.Set(t, dut)
+
+	config, usid := srv6Config(t, dut)
+	if _, err := dut.RawAPIs().GNMI(t).Set(context.Background(), cliSetRequest(config)); err != nil {
+		t.Fatalf("Failed to set the SRv6 configuration: %v", err)
+	}
+	return usid
+}
+
+// addISIS adds to ni the level 2 IS-IS instance over the links, with the
+// IPv6 address family.
+func addISIS(dut *ondatra.DUTDevice, ni *oc.NetworkInstance, links []string) {
+	prot := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_ISIS, isisName)
+	prot.SetEnabled(true)
+	isis := prot.GetOrCreateIsis()
+	glob := isis.GetOrCreateGlobal()
+	if deviations.ISISInstanceEnabledRequired(dut) {
+		glob.SetInstance(isisName)
+	}
+	glob.SetNet([]string{fmt.Sprintf("%s.%s.00", areaAddress, dutSysID)})
+	glob.SetLevelCapability(oc.Isis_LevelType_LEVEL_2)
+	glob.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV6, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+	level := isis.GetOrCreateLevel(2)
+	level.SetMetricStyle(oc.Isis_MetricStyle_WIDE_METRIC)
+	if deviations.ISISLevelEnabled(dut) {
+		level.SetEnabled(true)
+	}
+	for _, name := range links {
+		intf := isis.GetOrCreateInterface(isisInterface(dut, name))
+		intf.SetEnabled(true)
+		intf.SetCircuitType(oc.Isis_CircuitType_POINT_TO_POINT)
+		if deviations.ISISInterfaceLevel1DisableRequired(dut) {
+			intf.GetOrCreateLevel(1).SetEnabled(false)
+		} else {
+			intf.GetOrCreateLevel(2).SetEnabled(true)
+		}
+		if !deviations.ISISInterfaceAfiUnsupported(dut) {
+			intf.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV6, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+		}
+	}
+}
+
+// srv6Config returns the CLI configuration of the SRv6 locators, of SRv6 in
+// IS-IS, and of the BGP VPN session with ate:port1 allocating the End.DT4 and
+// End.DT6 SIDs of vrfName, and whether it includes a uSID locator.
+func srv6Config(t *testing.T, dut *ondatra.DUTDevice) (string, bool) {
+	t.Helper()
+	switch dut.Vendor() {
+	case ondatra.CISCO:
+		return fmt.Sprintf(`
+segment-routing
+ srv6
+  encapsulation
+   source-address %[1]s
+  !
+  locators
+   locator %[2]s
+    prefix %[3]s
+   !
+   locator %[4]s
+    micro-segment behavior unode psp-usd
+    prefix %[5]s
+   !
+  !
+ !
+!
+router isis %[6]s
+ address-family ipv6 unicast
+  segment-routing srv6
+   locator %[2]s
+   !
+   locator %[4]s
+   !
+  !
+ !
+!
+vrf %[7]s
+ address-family ipv4 unicast
+  import route-target %[8]s
+  export route-target %[8]s
+ !
+ address-family ipv6 unicast
+  import route-target %[8]s
+  export route-target %[8]s
+ !
+!
+router bgp %[9]d
+ bgp router-id %[10]s
+ address-family vpnv4 unicast
+ !
+ address-family vpnv6 unicast
+ !
+ neighbor %[11]s
+  remote-as %[9]d
+  address-family vpnv4 unicast
+  !
+  address-family vpnv6 unicast
+  !
+ !
+ vrf %[7]s
+  rd %[8]s
+  address-family ipv4 unicast
+   segment-routing srv6
+    locator %[2]s
+    alloc mode per-vrf
+   !
+   redistribute connected
+  !
+  address-family ipv6 unicast
+   segment-routing srv6
+    locator %[2]s
+    alloc mode per-vrf
+   !
+   redistribute connected
+  !
+ !
+!
+`, dut1.IPv6, locatorName, locator, usidName, usidLocator, isisName, vrfName, routeDist, asn, dut1.IPv4, ate1.IPv6), true
+	default:
+		t.Skipf("SRv6 configuration is not supported for vendor %v", dut.Vendor())
+	}
+	return "", false
+}
+
+func cliSetRequest(config string) *gpb.SetRequest {
+	return &gpb.SetRequest{
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{
+				Origin: "cli",
+			},
+			Val: &gpb.TypedValue{
+				Value: &gpb.TypedValue_AsciiVal{
+					AsciiVal: config,
+				},
+			},
+		}},
+	}
+}
+
+// configureATE configures IS-IS on ate1 and ate3, the iBGP VPN session of
+// ate1 with the DUT, and the capture of ate:port1, ate:port2 and ate:port3.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	var ports []string
+	for _, a := range []struct {
+		port  string
+		ate   attrs.Attributes
+		dut   attrs.Attributes
+		sysID string
+	}{
+		{"port1", ate1, dut1, ate1SysID},
+		{"port2", ate2, dut2, ""},
+		{"port3", ate3, dut3, ate3SysID},
+	} {
+		ports = append(ports, ate.Port(t, a.port).ID())
+		dev := a.ate.AddToOTG(top, ate.Port(t, a.port), &a.dut)
+		if a.sysID == "" {
+			continue
+		}
+		isis := dev.Isis().SetSystemId(a.sysID).SetName(a.ate.Name + ".isis")
+		isis.Basic().SetHostname(isis.Name()).SetLearnedLspFilter(true)
+		isis.Advanced().SetAreaAddresses([]string{strings.ReplaceAll(areaAddress, ".", "")})
+		isis.Interfaces().Add().
+			SetEthName(dev.Ethernets().Items()[0].Name()).
+			SetName(a.ate.Name + ".isis.intf").
+			SetNetworkType(gosnappi.IsisInterfaceNetworkType.POINT_TO_POINT).
+			SetLevelType(gosnappi.IsisInterfaceLevelType.LEVEL_2).
+			SetMetric(10)
+
+		if a.port != "port1" {
+			continue
+		}
+		bgp := dev.Bgp().SetRouterId(a.ate.IPv4)
+		v6 := dev.Ethernets().Items()[0].Ipv6Addresses().Items()[0]
+		peer := bgp.Ipv6Interfaces().Add().SetIpv6Name(v6.Name()).Peers().Add().SetName(a.ate.Name + ".BGP6.peer")
+		peer.SetPeerAddress(a.dut.IPv6).SetAsNumber(asn).SetAsType(gosnappi.BgpV6PeerAsType.IBGP)
+		peer.Capability().SetIpv4MplsVpn(true).SetIpv6MplsVpn(true)
+	}
+	top.Captures().Add().SetName(captureName).SetPortNames(ports).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// awaitAdjacencies waits for the IS-IS adjacencies of the DUT with ate1 and
+// ate3 to be up.
+func awaitAdjacencies(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	isis := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_ISIS, isisName).Isis()
+	for _, port := range []string{"port1", "port3"} {
+		intf := isisInterface(dut, dut.Port(t, port).Name())
+		_, ok := gnmi.WatchAll(t, dut, isis.Interface(intf).Level(2).AdjacencyAny().AdjacencyState().State(), time.Minute, func(v *ygnmi.Value[oc.E_Isis_IsisInterfaceAdjState]) bool {
+			state, present := v.Val()
+			return present && state == oc.Isis_IsisInterfaceAdjState_UP
+		}).Await(t)
+		if !ok {
+			t.Fatalf("IS-IS adjacency on %s is not up", intf)
+		}
+	}
+}
+
+// awaitBGP waits for the BGP session of the DUT with ate1 to be established.
+func awaitBGP(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, "BGP").Bgp().Neighbor(ate1.IPv6).SessionState().State()
+	_, ok := gnmi.Watch(t, dut, q, 2*time.Minute, func(v *ygnmi.Value[oc.E_Bgp_Neighbor_SessionState]) bool {
+		state, present := v.Val()
+		return present && state == oc.Bgp_Neighbor_SessionState_ESTABLISHED
+	}).Await(t)
+	if !ok {
+		t.Fatalf("BGP session with %s is not established", ate1.IPv6)
+	}
+}
+
+// Endpoint behaviors of RFC 8986.
+const (
+	behaviorEnd     = 1
+	behaviorEndPSP  = 4
+	behaviorEndX    = 5
+	behaviorEndXPSP = 8
+	behaviorEndDT6  = 18
+	behaviorEndDT4  = 19
+)
+
+// sid is an SRv6 SID and its endpoint behavior.
+type sid struct {
+	addr     net.IP
+	behavior uint16
+}
+
+func (s sid) String() string {
+	return fmt.Sprintf("%s (behavior %d)", s.addr, s.behavior)
+}
+
+// isisSIDs are the SRv6 SIDs advertised in the LSPs of the DUT.
+type isisSIDs struct {
+	// locators are the End SIDs by locator.
+	locators map[string][]sid
+	// endX are the End.X SIDs by neighbor system ID.
+	endX map[string][]sid
+}
+
+const (
+	isisLSPL2     = 20
+	isisLSPHeader = 27
+
+	tlvExtISReach     = 22
+	tlvSRv6Locator    = 27
+	tlvMTISReach      = 222
+	subTLVEndSID      = 5
+	subTLVEndXSID     = 43
+	isNeighborEntry   = 11
+	locatorEntryFixed = 7
+)
+
+// tlvs calls fn with the type and value of the TLVs of b.
+func tlvs(b []byte, fn func(typ byte, v []byte)) {
+	for len(b) >= 2 && len(b) >= 2+int(b[1]) {
+		fn(b[0], b[2:2+int(b[1])])
+		b = b[2+int(b[1]):]
+	}
+}
+
+// parseLSPs returns the SRv6 SIDs of the last level 2 LSP fragments of the
+// DUT in pkts.
+func parseLSPs(pkts []gopacket.Packet) (*isisSIDs, error) {
+	sysID, err := hex.DecodeString(strings.ReplaceAll(dutSysID, ".", ""))
+	if err != nil {
+		return nil, err
+	}
+	fragments := map[byte][]byte{}
+	for _, p := range pkts {
+		llc, ok := p.Layer(layers.LayerTypeLLC).(*layers.LLC)
+		if !ok || llc.DSAP != 0xfe {
+			continue
+		}
+		pdu := llc.LayerPayload()
+		if len(pdu) < isisLSPHeader || pdu[0] != 0x83 || pdu[4]&0x1f != isisLSPL2 {
+			continue
+		}
+		if !bytes.Equal(pdu[12:18], sysID) || pdu[18] != 0 {
+			continue
+		}
+		fragments[pdu[19]] = pdu[isisLSPHeader:]
+	}
+	if len(fragments) == 0 {
+		return nil, fmt.Errorf("no LSP of %s captured", dutSysID)
+	}
+
+	sids := &isisSIDs{locators: map[string][]sid{}, endX: map[string][]sid{}}
+	for _, b := range fragments {
+		tlvs(b, func(typ byte, v []byte) {
+			switch typ {
+			case tlvSRv6Locator:
+				// The MT ID is followed by the locator entries.
+				if len(v) < 2 {
+					return
+				}
+				v = v[2:]
+				for len(v) >= locatorEntryFixed {
+					bits := int(v[6])
+					n := locatorEntryFixed + (bits+7)/8
+					if len(v) < n+1 || len(v) < n+1+int(v[n]) {
+						return
+					}
+					addr := make(net.IP, net.IPv6len)
+					copy(addr, v[locatorEntryFixed:n])
+					loc := fmt.Sprintf("%s/%d", addr, bits)
+					tlvs(v[n+1:n+1+int(v[n])], func(typ byte, s []byte) {
+						// Flags, behavior and SID.
+						if typ == subTLVEndSID && len(s) >= 19 {
+							sids.locators[loc] = append(sids.locators[loc], sid{addr: net.IP(s[3:19]), behavior: binary.BigEndian.Uint16(s[1:3])})
+						}
+					})
+					v = v[n+1+int(v[n]):]
+				}
+			case tlvExtISReach, tlvMTISReach:
+				if typ == tlvMTISReach {
+					if len(v) < 2 {
+						return
+					}
+					v = v[2:]
+				}
+				for len(v) >= isNeighborEntry && len(v) >= isNeighborEntry+int(v[10]) {
+					neighbor := hex.EncodeToString(v[:6])
+					tlvs(v[isNeighborEntry:isNeighborEntry+int(v[10])], func(typ byte, s []byte) {
+						// Flags, algorithm, weight, behavior and SID.
+						if typ == subTLVEndXSID && len(s) >= 21 {
+							sids.endX[neighbor] = append(sids.endX[neighbor], sid{addr: net.IP(s[5:21]), behavior: binary.BigEndian.Uint16(s[3:5])})
+						}
+					})
+					v = v[isNeighborEntry+int(v[10]):]
+				}
+			}
+		})
+	}
+	return sids, nil
+}
+
+const (
+	bgpHeader      = 19
+	bgpUpdate      = 2
+	attrMPReach    = 14
+	attrPrefixSID  = 40
+	tlvSRv6L3      = 5
+	subSIDInfo     = 1
+	subSubSIDStruc = 1
+	afiIPv4        = 1
+	afiIPv6        = 2
+	safiVPN        = 128
+)
+
+// parseUpdates returns the SRv6 service SIDs of the VPN routes advertised by
+// the DUT in pkts, by AFI.
+func parseUpdates(pkts []gopacket.Packet) (map[uint16]sid, error) {
+	// segments are the TCP payloads sent by the DUT, by sequence number.
+	segments := map[uint32][]byte{}
+	for _, p := range pkts {
+		ip, ok := p.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+		if !ok || !ip.SrcIP.Equal(net.ParseIP(dut1.IPv6)) {
+			continue
+		}
+		tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		if !ok || tcp.SrcPort != 179 || len(tcp.Payload) == 0 {
+			continue
+		}
+		segments[tcp.Seq] = tcp.Payload
+	}
+	var seqs []uint32
+	for seq := range segments {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	var stream []byte
+	for _, seq := range seqs {
+		stream = append(stream, segments[seq]...)
+	}
+
+	sids := map[uint16]sid{}
+	for len(stream) >= bgpHeader {
+		n := int(binary.BigEndian.Uint16(stream[16:18]))
+		if n < bgpHeader || len(stream) < n {
+			break
+		}
+		if stream[18] == bgpUpdate {
+			if err := parseUpdate(stream[bgpHeader:n], sids); err != nil {
+				return nil, err
+			}
+		}
+		stream = stream[n:]
+	}
+	return sids, nil
+}
+
+// parseUpdate adds to sids the SRv6 service SID of the VPN routes of the
+// UPDATE message b.
+func parseUpdate(b []byte, sids map[uint16]sid) error {
+	if len(b) < 2 {
+		return fmt.Errorf("truncated UPDATE")
+	}
+	b = b[2+int(binary.BigEndian.Uint16(b)):]
+	if len(b) < 2 {
+		return fmt.Errorf("truncated UPDATE")
+	}
+	attrs := b[2 : 2+int(binary.BigEndian.Uint16(b))]
+
+	var (
+		afi   uint16
+		label []byte
+		s     *sid
+		// transposition is the offset and length of the SID bits carried
+		// in the label of the NLRI.
+		transposition [2]int
+	)
+	for len(attrs) >= 3 {
+		flags, typ := attrs[0], attrs[1]
+		hdr, n := 3, int(attrs[2])
+		if flags&0x10 != 0 {
+			hdr, n = 4, int(binary.BigEndian.Uint16(attrs[2:4]))
+		}
+		if len(attrs) < hdr+n {
+			return fmt.Errorf("truncated attribute %d", typ)
+		}
+		v := attrs[hdr : hdr+n]
+		attrs = attrs[hdr+n:]
+		switch typ {
+		case attrMPReach:
+			// AFI, SAFI, next hop, reserved byte and the first NLRI with
+			// its length and label.
+			if len(v) < 4 || v[2] != safiVPN || len(v) < 5+int(v[3])+4 {
+				continue
+			}
+			afi = binary.BigEndian.Uint16(v)
+			nlri := v[5+int(v[3]):]
+			label = nlri[1:4]
+		case attrPrefixSID:
+			for len(v) >= 3 {
+				tlv, l := v[0], int(binary.BigEndian.Uint16(v[1:3]))
+				if len(v) < 3+l {
+					break
+				}
+				if tlv == tlvSRv6L3 && l > 1 {
+					// The reserved byte is followed by the SID information
+					// sub-TLV, with the reserved byte, SID, flags,
+					// behavior, reserved byte and the SID structure.
+					sub := v[4 : 3+l]
+					if len(sub) >= 3 && sub[0] == subSIDInfo && len(sub) >= 3+21 {
+						info := sub[3:]
+						s = &sid{addr: append(net.IP{}, info[1:17]...), behavior: binary.BigEndian.Uint16(info[18:20])}
+						ss := info[21:]
+						if len(ss) >= 9 && ss[0] == subSubSIDStruc {
+							transposition = [2]int{int(ss[8]), int(ss[7])}
+						}
+					}
+				}
+				v = v[3+l:]
+			}
+		}
+	}
+	if afi == 0 || s == nil {
+		return nil
+	}
+	if offset, length := transposition[0], transposition[1]; length > 0 && label != nil {
+		bits := uint32(label[0])<<16 | uint32(label[1])<<8 | uint32(label[2])
+		bits >>= 24 - length
+		for i := 0; i < length; i++ {
+			pos := offset + i
+			if bits&(1<<(length-1-i)) != 0 {
+				s.addr[pos/8] |= 0x80 >> (pos % 8)
+			} else {
+				s.addr[pos/8] &^= 0x80 >> (pos % 8)
+			}
+		}
+	}
+	sids[afi] = *s
+	return nil
+}
+
+// inPrefix returns whether addr is in prefix.
+func inPrefix(addr net.IP, prefix string) bool {
+	_, n, err := net.ParseCIDR(prefix)
+	return err == nil && n.Contains(addr)
+}
+
+// findSID returns the first SID of sids in prefix with a behavior in
+// [minBehavior, maxBehavior].
+func findSID(sids []sid, prefix string, minBehavior, maxBehavior uint16) (sid, bool) {
+	for _, s := range sids {
+		if inPrefix(s.addr, prefix) && s.behavior >= minBehavior && s.behavior <= maxBehavior {
+			return s, true
+		}
+	}
+	return sid{}, false
+}
+
+// srh returns the hex encoding of a segment routing header with the segment
+// list segments, in the order of the path, and the next header nextHeader.
+func srh(segments []string, nextHeader byte) string {
+	n := len(segments)
+	b := []byte{nextHeader, byte(2 * n), 4, byte(n - 1), byte(n - 1), 0, 0, 0}
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, net.ParseIP(segments[i]).To16()...)
+	}
+	return hex.EncodeToString(b)
+}
+
+// flow is an SRv6 flow sent from ate:port1, and the check of its packets
+// received on rx.
+type flow struct {
+	name string
+	dst  string
+	// segments are the segments following dst in the SRH, or empty for no
+	// SRH.
+	segments []string
+	// inner is the address family of the inner packet of the flow, or ""
+	// for a UDP payload.
+	inner string
+	rx    string
+	// check returns an error if a received packet was not processed as
+	// expected.
+	check func(p gopacket.Packet) error
+}
+
+// addFlow replaces the flows of top with f, sent to dstMAC, the MAC address
+// of dut:port1.
+func addFlow(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config, f flow, dstMAC string) {
+	t.Helper()
+	top.Flows().Clear()
+	fl := top.Flows().Add().SetName(f.name)
+	fl.Metrics().SetEnable(true)
+	fl.TxRx().Port().SetTxName(ate.Port(t, "port1").ID()).SetRxNames([]string{ate.Port(t, f.rx).ID()})
+	eth := fl.Packet().Add().Ethernet()
+	eth.Src().SetValue(ate1.MAC)
+	eth.Dst().SetValue(dstMAC)
+	outer := fl.Packet().Add().Ipv6()
+	outer.Src().SetValue(ate1.IPv6)
+	outer.Dst().SetValue(f.dst)
+	outer.HopLimit().SetValue(hopLimit)
+
+	var next byte
+	switch f.inner {
+	case "IPv4":
+		next = byte(layers.IPProtocolIPv4)
+	case "IPv6":
+		next = byte(layers.IPProtocolIPv6)
+	default:
+		next = byte(layers.IPProtocolUDP)
+	}
+	if len(f.segments) > 0 {
+		outer.NextHeader().SetValue(uint32(layers.IPProtocolIPv6Routing))
+		fl.Packet().Add().Custom().SetBytes(srh(append([]string{f.dst}, f.segments...), next))
+	} else {
+		outer.NextHeader().SetValue(uint32(next))
+	}
+	switch f.inner {
+	case "IPv4":
+		ip := fl.Packet().Add().Ipv4()
+		ip.Src().SetValue(dt4InnerSrc)
+		ip.Dst().SetValue(ate2.IPv4)
+	case "IPv6":
+		ip := fl.Packet().Add().Ipv6()
+		ip.Src().SetValue(dt6InnerSrc)
+		ip.Dst().SetValue(ate2.IPv6)
+	}
+	fl.Packet().Add().Udp().DstPort().SetValue(udpPort)
+	fl.Size().SetFixed(frameSize)
+	fl.Rate().SetPps(ppsRate)
+	fl.Duration().FixedPackets().SetPackets(packets)
+}
+
+// verifyFlow sends f and verifies that it is received without loss and that
+// the received packets pass f.check.
+func verifyFlow(t *testing.T, dut *ondatra.DUTDevice, ate *ondatra.ATEDevice, top gosnappi.Config, f flow, dstMAC string) {
+	t.Helper()
+	addFlow(t, ate, top, f, dstMAC)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+	awaitAdjacencies(t, dut)
+
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+	otgutils.StopCapture(t, ate.OTG())
+	time.Sleep(10 * time.Second)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+	counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.name).Counters().State())
+	if sent := counters.GetOutPkts(); sent == 0 || counters.GetInPkts() != sent {
+		t.Errorf("Flow %s: got %d packets received on %s of %d sent, want no loss", f.name, counters.GetInPkts(), f.rx, sent)
+	}
+
+	var good, bad int
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, f.rx).ID()) {
+		udp, ok := p.Layer(layers.LayerTypeUDP).(*layers.UDP)
+		if !ok || udp.DstPort != udpPort {
+			continue
+		}
+		if err := f.check(p); err != nil {
+			if bad == 0 {
+				t.Errorf("Flow %s: %v", f.name, err)
+			}
+			bad++
+			continue
+		}
+		good++
+	}
+	t.Logf("Flow %s: captured %d packets processed as expected and %d not", f.name, good, bad)
+	if good == 0 {
+		t.Errorf("Flow %s: got no packets processed as expected", f.name)
+	}
+	if bad != 0 {
+		t.Errorf("Flow %s: got %d packets not processed as expected", f.name, bad)
+	}
+}
+
+// checkForwarded returns a check of the packets forwarded with the outer
+// destination address dst, the hop limit decremented, and no segments left.
+func checkForwarded(dst string) func(gopacket.Packet) error {
+	return func(p gopacket.Packet) error {
+		ip, ok := p.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+		if !ok {
+			return fmt.Errorf("got a packet without IPv6 header")
+		}
+		if !ip.DstIP.Equal(net.ParseIP(dst)) {
+			return fmt.Errorf("got destination address %s, want %s", ip.DstIP, dst)
+		}
+		if ip.HopLimit != hopLimit-1 {
+			return fmt.Errorf("got hop limit %d, want %d", ip.HopLimit, hopLimit-1)
+		}
+		if rh, ok := p.Layer(layers.LayerTypeIPv6Routing).(*layers.IPv6Routing); ok && rh.SegmentsLeft != 0 {
+			return fmt.Errorf("got %d segments left, want 0", rh.SegmentsLeft)
+		}
+		return nil
+	}
+}
+
+// checkDecapsulated returns a check of the packets decapsulated to an inner
+// packet of the address family af to the address dst.
+func checkDecapsulated(af, dst string) func(gopacket.Packet) error {
+	return func(p gopacket.Packet) error {
+		var ips []net.IP
+		for _, l := range p.Layers() {
+			switch ip := l.(type) {
+			case *layers.IPv4:
+				ips = append(ips, ip.DstIP)
+			case *layers.IPv6:
+				ips = append(ips, ip.DstIP)
+			}
+		}
+		if len(ips) != 1 {
+			return fmt.Errorf("got %d IP headers with destination addresses %v, want 1", len(ips), ips)
+		}
+		if (af == "IPv4") != (ips[0].To4() != nil) || !ips[0].Equal(net.ParseIP(dst)) {
+			return fmt.Errorf("got destination address %s, want %s address %s", ips[0], af, dst)
+		}
+		return nil
+	}
+}
+
+func TestSRv6(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	usid := configureDUT(t, dut)
+	dstMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port1").Name()).Ethernet().MacAddress().State())
+
+	ate := ondatra.ATE(t, "ate")
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	otgutils.StartCapture(t, ate.OTG())
+	ate.OTG().StartProtocols(t)
+	awaitAdjacencies(t, dut)
+	awaitBGP(t, dut)
+	time.Sleep(advertisementWait)
+	otgutils.StopCapture(t, ate.OTG())
+	pkts := otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port1").ID())
+
+	var end, endX, dt4, dt6 sid
+	t.Run("ISISAdvertisement", func(t *testing.T) {
+		sids, err := parseLSPs(pkts)
+		if err != nil {
+			t.Fatalf("Cannot parse the LSPs of the DUT: %v", err)
+		}
+		t.Logf("SRv6 SIDs of the DUT in IS-IS: %+v", sids)
+		locators := []string{locator}
+		if usid {
+			locators = append(locators, usidLocator)
+		}
+		for _, loc := range locators {
+			if len(sids.locators[loc]) == 0 {
+				t.Errorf("Locator %s: got no End SID advertised", loc)
+			}
+		}
+		var ok bool
+		if end, ok = findSID(sids.locators[locator], locator, behaviorEnd, behaviorEndPSP); !ok {
+			t.Errorf("Locator %s: got End SIDs %v, want an End SID", locator, sids.locators[locator])
+		}
+		for _, sysID := range []string{ate1SysID, ate3SysID} {
+			s, ok := findSID(sids.endX[sysID], locator, behaviorEndX, behaviorEndXPSP)
+			if !ok {
+				t.Errorf("Neighbor %s: got End.X SIDs %v, want an End.X SID in %s", sysID, sids.endX[sysID], locator)
+			}
+			if sysID == ate3SysID {
+				endX = s
+			}
+		}
+	})
+	t.Run("BGPAdvertisement", func(t *testing.T) {
+		sids, err := parseUpdates(pkts)
+		if err != nil {
+			t.Fatalf("Cannot parse the BGP updates of the DUT: %v", err)
+		}
+		t.Logf("SRv6 service SIDs of the DUT in BGP by AFI: %v", sids)
+		for _, want := range []struct {
+			afi      uint16
+			behavior uint16
+			sid      *sid
+		}{
+			{afiIPv4, behaviorEndDT4, &dt4},
+			{afiIPv6, behaviorEndDT6, &dt6},
+		} {
+			got, ok := sids[want.afi]
+			switch {
+			case !ok:
+				t.Errorf("AFI %d: got no SRv6 service SID", want.afi)
+			case !inPrefix(got.addr, locator) || got.behavior != want.behavior:
+				t.Errorf("AFI %d: got SRv6 service SID %v, want behavior %d in %s", want.afi, got, want.behavior, locator)
+			default:
+				*want.sid = got
+			}
+		}
+	})
+
+	for _, f := range []struct {
+		flow
+		sid *sid
+	}{{
+		flow: flow{name: "End", segments: []string{ate3.IPv6}, rx: "port3", check: checkForwarded(ate3.IPv6)},
+		sid:  &end,
+	}, {
+		flow: flow{name: "End.X", segments: []string{endXFinalDst}, rx: "port3", check: checkForwarded(endXFinalDst)},
+		sid:  &endX,
+	}, {
+		flow: flow{name: "End.DT4", inner: "IPv4", rx: "port2", check: checkDecapsulated("IPv4", ate2.IPv4)},
+		sid:  &dt4,
+	}, {
+		flow: flow{name: "End.DT6", inner: "IPv6", rx: "port2", check: checkDecapsulated("IPv6", ate2.IPv6)},
+		sid:  &dt6,
+	}} {
+		t.Run(f.name, func(t *testing.T) {
+			if f.sid.addr == nil {
+				t.Skipf("No %s SID learned from the DUT", f.name)
+			}
+			f.flow.dst = f.sid.addr.String()
+			verifyFlow(t, dut, ate, top, f.flow, dstMAC)
+		})
+	}
+
+	t.Run("uSID", func(t *testing.T) {
+		if !usid {
+			t.Skip("uSID is not supported by the DUT")
+		}
+		verifyFlow(t, dut, ate, top, flow{name: "uSID", dst: usidCarrier, rx: "port3", check: checkForwarded(usidShifted)}, dstMAC)
+	})
+}
@@ -0,0 +1,450 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tilfa_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	failoverBudget = flag.Duration("failover_budget", 50*time.Millisecond,
+		"maximum traffic loss allowed when the primary link fails")
+	convergenceTimeout = flag.Duration("convergence_timeout", time.Minute,
+		"time allowed for the primary and backup paths to be installed in the AFT")
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the source of the traffic,
+// and dut:port2 -> ate:port2 and dut:port3 -> ate:port3, IS-IS neighbors of
+// the DUT both advertising targetPrefix. The path via ate:port2 has the lower
+// metric and is the primary path, protected by TI-LFA with a backup path via
+// ate:port3.
+const (
+	plen = 30
+
+	isisName    = "DEFAULT"
+	areaAddress = "49.0001"
+	dutSysID    = "1920.0000.2001"
+	ate2SysID   = "640000000002"
+	ate3SysID   = "640000000003"
+
+	srgbBlock = "srgb-block"
+	srgbName  = "srgb"
+	srgbBase  = 16000
+	srgbSize  = 8000
+	nodeLabel = srgbBase + 1
+
+	targetPrefix  = "198.51.100.0"
+	targetLen     = 24
+	targetDst     = "198.51.100.1"
+	primaryMetric = 10
+	backupMetric  = 20
+
+	flowName = "tilfa"
+	// ppsRate is high enough to measure the loss duration with a
+	// resolution of 10us.
+	ppsRate   = 100000
+	frameSize = 128
+)
+
+var (
+	dutLoopback = attrs.Attributes{
+		Desc:    "Node SID",
+		IPv4:    "203.0.113.1",
+		IPv4Len: 32,
+	}
+	ate1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dut1 = attrs.Attributes{
+		Desc:    "Traffic source",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dut2 = attrs.Attributes{
+		Desc:    "Primary path",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ate2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	dut3 = attrs.Attributes{
+		Desc:    "Backup path",
+		IPv4:    "192.0.2.9",
+		IPv4Len: plen,
+	}
+	ate3 = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// isisInterface returns the name of the IS-IS interface of the interface
+// name.
+func isisInterface(dut *ondatra.DUTDevice, name string) string {
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		return name + ".0"
+	}
+	return name
+}
+
+// configureDUT configures the interfaces, IS-IS with segment routing on
+// dut:port2 and dut:port3, and TI-LFA with the CLI of the vendor.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	lb := netutil.LoopbackInterface(t, dut, 0)
+	lo := dutLoopback.NewOCInterface(lb, dut)
+	lo.Type = oc.IETFInterfaces_InterfaceType_softwareLoopback
+	gnmi.Replace(t, dut, gnmi.OC().Interface(lb).Config(), lo)
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, lb, deviations.DefaultNetworkInstance(dut), 0)
+	}
+
+	var links []string
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dut1},
+		{"port2", dut2},
+		{"port3", dut3},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+		if p.port != "port1" {
+			links = append(links, dp.Name())
+		}
+	}
+
+	ni := &oc.NetworkInstance{Name: ygot.String(deviations.DefaultNetworkInstance(dut))}
+	addSegmentRouting(ni, links)
+	addISIS(dut, ni, lb, links)
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Config(), ni)
+
+	if _, err := dut.RawAPIs().GNMI(t).Set(context.Background(), cliSetRequest(tilfaConfig(t, dut, links))); err != nil {
+		t.Fatalf("Failed to configure TI-LFA: %v", err)
+	}
+}
+
+// addSegmentRouting adds to ni the SRGB and MPLS on the links.
+func addSegmentRouting(ni *oc.NetworkInstance, links []string) {
+	mpls := ni.GetOrCreateMpls().GetOrCreateGlobal()
+	rlb := mpls.GetOrCreateReservedLabelBlock(srgbBlock)
+	rlb.SetLowerBound(oc.UnionUint32(srgbBase))
+	rlb.SetUpperBound(oc.UnionUint32(srgbBase + srgbSize - 1))
+	for _, name := range links {
+		intf := mpls.GetOrCreateInterface(name)
+		intf.SetMplsEnabled(true)
+		intf.GetOrCreateInterfaceRef().SetInterface(name)
+	}
+	srgb := ni.GetOrCreateSegmentRouting().GetOrCreateSrgb(srgbName)
+	srgb.SetMplsLabelBlocks([]string{srgbBlock})
+	srgb.SetDataplaneType(oc.SegmentRouting_SrDataplaneType_MPLS)
+}
+
+// addISIS adds to ni the level 2 IS-IS instance with segment routing over
+// the links, advertising the loopback lb passively with its node SID.
+func addISIS(dut *ondatra.DUTDevice, ni *oc.NetworkInstance, lb string, links []string) {
+	prot := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_ISIS, isisName)
+	prot.SetEnabled(true)
+	isis := prot.GetOrCreateIsis()
+	glob := isis.GetOrCreateGlobal()
+	if deviations.ISISInstanceEnabledRequired(dut) {
+		glob.SetInstance(isisName)
+	}
+	glob.SetNet([]string{fmt.Sprintf("%s.%s.00", areaAddress, dutSysID)})
+	glob.SetLevelCapability(oc.Isis_LevelType_LEVEL_2)
+	glob.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+	sr := glob.GetOrCreateSegmentRouting()
+	sr.SetEnabled(true)
+	sr.SetSrgb(srgbName)
+	level := isis.GetOrCreateLevel(2)
+	level.SetMetricStyle(oc.Isis_MetricStyle_WIDE_METRIC)
+	if deviations.ISISLevelEnabled(dut) {
+		level.SetEnabled(true)
+	}
+	for _, name := range append([]string{lb}, links...) {
+		intf := isis.GetOrCreateInterface(isisInterface(dut, name))
+		intf.SetEnabled(true)
+		if name == lb {
+			intf.SetPassive(true)
+		} else {
+			intf.SetCircuitType(oc.Isis_CircuitType_POINT_TO_POINT)
+		}
+		if deviations.ISISInterfaceLevel1DisableRequired(dut) {
+			intf.GetOrCreateLevel(1).SetEnabled(false)
+		} else {
+			intf.GetOrCreateLevel(2).SetEnabled(true)
+		}
+		if name == lb {
+			af := intf.GetOrCreateLevel(2).GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST)
+			af.GetOrCreateSegmentRouting().GetOrCreatePrefixSid(dutLoopback.IPv4CIDR()).SetSidId(oc.UnionUint32(nodeLabel))
+		}
+		if !deviations.ISISInterfaceAfiUnsupported(dut) {
+			intf.GetOrCreateAf(oc.IsisTypes_AFI_TYPE_IPV4, oc.IsisTypes_SAFI_TYPE_UNICAST).SetEnabled(true)
+		}
+	}
+}
+
+// tilfaConfig returns the CLI configuration enabling TI-LFA link protection
+// on the IS-IS links.
+func tilfaConfig(t *testing.T, dut *ondatra.DUTDevice, links []string) string {
+	t.Helper()
+	var b strings.Builder
+	switch dut.Vendor() {
+	case ondatra.ARISTA:
+		fmt.Fprintf(&b, "router isis %s\n   address-family ipv4 unicast\n      fast-reroute ti-lfa mode link-protection\n", isisName)
+	case ondatra.CISCO:
+		fmt.Fprintf(&b, "router isis %s\n", isisName)
+		for _, name := range links {
+			fmt.Fprintf(&b, " interface %s\n  address-family ipv4 unicast\n   fast-reroute per-prefix\n   fast-reroute per-prefix ti-lfa\n  !\n !\n", name)
+		}
+	default:
+		t.Skipf("TI-LFA configuration is not supported for vendor %v", dut.Vendor())
+	}
+	return b.String()
+}
+
+func cliSetRequest(config string) *gpb.SetRequest {
+	return &gpb.SetRequest{
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{
+				Origin: "cli",
+			},
+			Val: &gpb.TypedValue{
+				Value: &gpb.TypedValue_AsciiVal{
+					AsciiVal: config,
+				},
+			},
+		}},
+	}
+}
+
+// configureATE configures IS-IS on ate2 and ate3, both advertising
+// targetPrefix with the primary and the backup metric, and the flow from
+// ate1 to targetDst.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	ate1.AddToOTG(top, ate.Port(t, "port1"), &dut1)
+	for _, a := range []struct {
+		port   string
+		ate    attrs.Attributes
+		dut    attrs.Attributes
+		sysID  string
+		metric uint32
+	}{
+		{"port2", ate2, dut2, ate2SysID, primaryMetric},
+		{"port3", ate3, dut3, ate3SysID, backupMetric},
+	} {
+		dev := a.ate.AddToOTG(top, ate.Port(t, a.port), &a.dut)
+		isis := dev.Isis().SetSystemId(a.sysID).SetName(a.ate.Name + ".isis")
+		isis.Basic().SetHostname(isis.Name()).SetLearnedLspFilter(true)
+		isis.Advanced().SetAreaAddresses([]string{strings.ReplaceAll(areaAddress, ".", "")})
+		isis.Interfaces().Add().
+			SetEthName(dev.Ethernets().Items()[0].Name()).
+			SetName(a.ate.Name + ".isis.intf").
+			SetNetworkType(gosnappi.IsisInterfaceNetworkType.POINT_TO_POINT).
+			SetLevelType(gosnappi.IsisInterfaceLevelType.LEVEL_2).
+			SetMetric(10)
+		routes := isis.V4Routes().Add().SetName(a.ate.Name + ".target").SetLinkMetric(a.metric)
+		routes.Addresses().Add().SetAddress(targetPrefix).SetPrefix(targetLen)
+	}
+
+	flow := top.Flows().Add().SetName(flowName)
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Device().
+		SetTxNames([]string{ate1.Name + ".IPv4"}).
+		SetRxNames([]string{ate2.Name + ".IPv4", ate3.Name + ".IPv4"})
+	flow.Packet().Add().Ethernet().Src().SetValue(ate1.MAC)
+	ip := flow.Packet().Add().Ipv4()
+	ip.Src().SetValue(ate1.IPv4)
+	ip.Dst().SetValue(targetDst)
+	flow.Size().SetFixed(frameSize)
+	flow.Rate().SetPps(ppsRate)
+	return top
+}
+
+// paths returns the next hops of the primary path of targetPrefix in the AFT
+// of the DUT, and of its backup path.
+func paths(t *testing.T, dut *ondatra.DUTDevice) (primary, backup []string) {
+	t.Helper()
+	afts := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Afts()
+	entry, ok := gnmi.Lookup(t, dut, afts.Ipv4Entry(fmt.Sprintf("%s/%d", targetPrefix, targetLen)).State()).Val()
+	if !ok {
+		return nil, nil
+	}
+	nextHops := func(id uint64) []string {
+		nhg, ok := gnmi.Lookup(t, dut, afts.NextHopGroup(id).State()).Val()
+		if !ok {
+			return nil
+		}
+		var ips []string
+		for idx := range nhg.NextHop {
+			if nh, ok := gnmi.Lookup(t, dut, afts.NextHop(idx).State()).Val(); ok {
+				ips = append(ips, nh.GetIpAddress())
+			}
+		}
+		return ips
+	}
+	nhg, ok := gnmi.Lookup(t, dut, afts.NextHopGroup(entry.GetNextHopGroup()).State()).Val()
+	if !ok {
+		return nil, nil
+	}
+	primary = nextHops(nhg.GetId())
+	if nhg.BackupNextHopGroup != nil {
+		backup = nextHops(nhg.GetBackupNextHopGroup())
+	}
+	return primary, backup
+}
+
+// awaitPaths waits for the primary path of targetPrefix to be via ate2 and
+// its backup path via ate3 in the AFT of the DUT.
+func awaitPaths(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Afts().Ipv4Entry(fmt.Sprintf("%s/%d", targetPrefix, targetLen)).State()
+	gnmi.Watch(t, dut, q, *convergenceTimeout, func(v *ygnmi.Value[*oc.NetworkInstance_Afts_Ipv4Entry]) bool {
+		return v.IsPresent()
+	}).Await(t)
+
+	var primary, backup []string
+	deadline := time.Now().Add(*convergenceTimeout)
+	for time.Now().Before(deadline) {
+		primary, backup = paths(t, dut)
+		if len(primary) == 1 && primary[0] == ate2.IPv4 && len(backup) == 1 && backup[0] == ate3.IPv4 {
+			t.Logf("Primary path of %s/%d via %v, backup path via %v", targetPrefix, targetLen, primary, backup)
+			return
+		}
+		time.Sleep(5 * time.Second)
+	}
+	t.Fatalf("Paths of %s/%d: got primary next hops %v and backup next hops %v, want %s and %s", targetPrefix, targetLen, primary, backup, ate2.IPv4, ate3.IPv4)
+}
+
+// setLinkState sets the state of the link of port2 from the ATE, or of the
+// interface of the DUT if the ATE does not support it.
+func setLinkState(t *testing.T, dut *ondatra.DUTDevice, ate *ondatra.ATEDevice, up bool) {
+	t.Helper()
+	if deviations.ATEPortLinkStateOperationsUnsupported(ate) {
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dut.Port(t, "port2").Name()).Enabled().Config(), up)
+		return
+	}
+	state := gosnappi.StatePortLinkState.DOWN
+	if up {
+		state = gosnappi.StatePortLinkState.UP
+	}
+	cs := gosnappi.NewControlState()
+	cs.Port().Link().SetPortNames([]string{ate.Port(t, "port2").ID()}).SetState(state)
+	ate.OTG().SetControlState(t, cs)
+}
+
+// lossDuration returns the traffic loss of the flow expressed as the time it
+// takes to send the lost packets.
+func lossDuration(t *testing.T, ate *ondatra.ATEDevice) time.Duration {
+	t.Helper()
+	counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(flowName).Counters().State())
+	tx, rx := counters.GetOutPkts(), counters.GetInPkts()
+	if tx == 0 {
+		t.Fatalf("No traffic was sent on flow %s", flowName)
+	}
+	var lost uint64
+	if tx > rx {
+		lost = tx - rx
+	}
+	return time.Duration(lost) * time.Second / ppsRate
+}
+
+// portRxPkts returns the number of packets received on port of the ATE.
+func portRxPkts(t *testing.T, ate *ondatra.ATEDevice, port string) uint64 {
+	t.Helper()
+	return gnmi.Get(t, ate.OTG(), gnmi.OTG().Port(ate.Port(t, port).ID()).Counters().InFrames().State())
+}
+
+func TestTILFA(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+
+	ate := ondatra.ATE(t, "ate")
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+	t.Run("BackupPath", func(t *testing.T) {
+		awaitPaths(t, dut)
+	})
+
+	t.Run("Failover", func(t *testing.T) {
+		ate.OTG().StartTraffic(t)
+		time.Sleep(10 * time.Second)
+		before := portRxPkts(t, ate, "port3")
+		setLinkState(t, dut, ate, false)
+		defer setLinkState(t, dut, ate, true)
+		gnmi.Watch(t, dut, gnmi.OC().Interface(dut.Port(t, "port2").Name()).OperStatus().State(), time.Minute, func(v *ygnmi.Value[oc.E_Interface_OperStatus]) bool {
+			status, present := v.Val()
+			return present && status != oc.Interface_OperStatus_UP
+		}).Await(t)
+		time.Sleep(10 * time.Second)
+		ate.OTG().StopTraffic(t)
+		time.Sleep(5 * time.Second)
+		otgutils.LogFlowMetrics(t, ate.OTG(), top)
+		otgutils.LogPortMetrics(t, ate.OTG(), top)
+
+		if got := portRxPkts(t, ate, "port3") - before; got == 0 {
+			t.Errorf("Got no packets received on the backup path after the failure of the primary link")
+		}
+		loss := lossDuration(t, ate)
+		t.Logf("Traffic loss after the failure of the primary link: %v", loss)
+		if loss > *failoverBudget {
+			t.Errorf("Traffic loss after the failure of the primary link: got %v, want at most %v", loss, *failoverBudget)
+		}
+	})
+}
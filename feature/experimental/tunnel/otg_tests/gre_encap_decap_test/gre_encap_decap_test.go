@@ -0,0 +1,409 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gre_encap_decap_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, dut:port2 -> ate:port2,
+// which carries the GRE packets in both directions, and dut:port3 ->
+// ate:port3, the only interface of greVRF.
+//
+// The encap policy applied to the input of dut:port1 encapsulates the
+// packets to encapPrefix in GRE to tunnelDst, which is routed to ate:port2.
+// The decap policy applied to the input of dut:port2 decapsulates the GRE
+// packets to dut:port2, and looks up the inner packets in greVRF, where
+// innerPrefix is routed to ate:port3. In the default network instance,
+// innerPrefix is routed to ate:port1.
+const (
+	plen = 30
+
+	encapPolicy = "gre-encap"
+	decapPolicy = "gre-decap"
+	encapRule   = 10
+	decapRule   = 10
+	greVRF      = "GRE-VRF"
+	greProtocol = 47
+
+	encapPrefix = "100.64.0.0/24"
+	encapDst    = "100.64.0.1"
+	tunnelNet   = "203.0.113.0/24"
+	tunnelDst   = "203.0.113.1"
+	tunnelTTL   = 32
+
+	innerPrefix = "198.51.100.0/24"
+	innerSrc    = "100.64.1.1"
+	innerDst    = "198.51.100.1"
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	captureName = "port2-capture"
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dutSrc = attrs.Attributes{
+		Desc:    "Encap input",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dutTunnel = attrs.Attributes{
+		Desc:    "GRE tunnel underlay",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ateTunnel = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	dutVRF = attrs.Attributes{
+		Desc:    "Decap output",
+		IPv4:    "192.0.2.9",
+		IPv4Len: plen,
+	}
+	ateVRF = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:03:01:01:01",
+		IPv4:    "192.0.2.10",
+		IPv4Len: plen,
+	}
+)
+
+// encapDSCPs are the DSCPs of the packets encapsulated by the DUT, which
+// are copied to the outer header.
+var encapDSCPs = []uint8{0, 10, 46}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the DUT interfaces, greVRF and the static routes.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	ni := &oc.NetworkInstance{Name: ygot.String(greVRF)}
+	ni.SetType(oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_L3VRF)
+	gnmi.Replace(t, dut, gnmi.OC().NetworkInstance(greVRF).Config(), ni)
+
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+		ni    string
+	}{
+		{"port1", dutSrc, deviations.DefaultNetworkInstance(dut)},
+		{"port2", dutTunnel, deviations.DefaultNetworkInstance(dut)},
+		{"port3", dutVRF, greVRF},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if p.ni != deviations.DefaultNetworkInstance(dut) || deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), p.ni, 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	b := &gnmi.SetBatch{}
+	for _, r := range []struct {
+		ni, prefix, nextHop string
+	}{
+		{deviations.DefaultNetworkInstance(dut), tunnelNet, ateTunnel.IPv4},
+		{deviations.DefaultNetworkInstance(dut), innerPrefix, ateSrc.IPv4},
+		{greVRF, innerPrefix, ateVRF.IPv4},
+	} {
+		cfg := &cfgplugins.StaticRouteCfg{
+			NetworkInstance: r.ni,
+			Prefix:          r.prefix,
+			NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+				"0": oc.UnionString(r.nextHop),
+			},
+		}
+		if _, err := cfgplugins.NewStaticRouteCfg(b, cfg, dut); err != nil {
+			t.Fatalf("Failed to configure the static route to %s in %s: %v", r.prefix, r.ni, err)
+		}
+	}
+	b.Set(t, dut)
+}
+
+// addDefaultRules adds to p the rules forwarding the packets not matched by
+// the other rules in the default network instance, if the DUT requires
+// them.
+func addDefaultRules(dut *ondatra.DUTDevice, p *oc.NetworkInstance_PolicyForwarding_Policy) {
+	if !deviations.PfRequireMatchDefaultRule(dut) {
+		return
+	}
+	for i, et := range []oc.NetworkInstance_PolicyForwarding_Policy_Rule_L2_Ethertype_Union{
+		oc.PacketMatchTypes_ETHERTYPE_ETHERTYPE_IPV4,
+		oc.PacketMatchTypes_ETHERTYPE_ETHERTYPE_IPV6,
+	} {
+		r := p.GetOrCreateRule(uint32(100 + i))
+		r.GetOrCreateL2().SetEthertype(et)
+		r.GetOrCreateAction().SetNetworkInstance(deviations.DefaultNetworkInstance(dut))
+	}
+}
+
+// encapForwardingPolicy returns the policy encapsulating the packets to
+// encapPrefix in GRE from dut:port2 to tunnelDst.
+func encapForwardingPolicy(dut *ondatra.DUTDevice) *oc.NetworkInstance_PolicyForwarding_Policy {
+	p := &oc.NetworkInstance_PolicyForwarding_Policy{PolicyId: ygot.String(encapPolicy)}
+	p.SetType(oc.Policy_Type_PBR_POLICY)
+	r := p.GetOrCreateRule(encapRule)
+	r.GetOrCreateIpv4().SetDestinationAddress(encapPrefix)
+	target := r.GetOrCreateAction().GetOrCreateEncapsulateGre().GetOrCreateTarget("1")
+	target.SetSource(dutTunnel.IPv4)
+	target.SetDestination(tunnelDst + "/32")
+	target.SetIpTtl(tunnelTTL)
+	addDefaultRules(dut, p)
+	return p
+}
+
+// decapForwardingPolicy returns the policy decapsulating the GRE packets to
+// dut:port2 into greVRF.
+func decapForwardingPolicy(dut *ondatra.DUTDevice) *oc.NetworkInstance_PolicyForwarding_Policy {
+	p := &oc.NetworkInstance_PolicyForwarding_Policy{PolicyId: ygot.String(decapPolicy)}
+	p.SetType(oc.Policy_Type_PBR_POLICY)
+	r := p.GetOrCreateRule(decapRule)
+	r.GetOrCreateIpv4().SetDestinationAddress(dutTunnel.IPv4 + "/32")
+	r.GetOrCreateIpv4().SetProtocol(oc.UnionUint8(greProtocol))
+	r.GetOrCreateAction().SetDecapsulateGre(true)
+	r.GetOrCreateAction().SetPostDecapNetworkInstance(greVRF)
+	addDefaultRules(dut, p)
+	return p
+}
+
+// interfaceID returns the ID of interface intf in policy-forwarding.
+func interfaceID(dut *ondatra.DUTDevice, intf string) string {
+	if deviations.InterfaceRefInterfaceIDFormat(dut) {
+		return intf + ".0"
+	}
+	return intf
+}
+
+// applyForwardingPolicies configures the encap and decap policies and
+// applies them to the input of dut:port1 and dut:port2.
+func applyForwardingPolicies(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	pf := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding()
+	b := &gnmi.SetBatch{}
+	gnmi.BatchReplace(b, pf.Policy(encapPolicy).Config(), encapForwardingPolicy(dut))
+	gnmi.BatchReplace(b, pf.Policy(decapPolicy).Config(), decapForwardingPolicy(dut))
+	for _, p := range []struct {
+		port, policy string
+	}{
+		{"port1", encapPolicy},
+		{"port2", decapPolicy},
+	} {
+		intf := dut.Port(t, p.port).Name()
+		pfi := &oc.NetworkInstance_PolicyForwarding_Interface{InterfaceId: ygot.String(interfaceID(dut, intf))}
+		pfi.SetApplyForwardingPolicy(p.policy)
+		if !deviations.InterfaceRefConfigUnsupported(dut) {
+			pfi.GetOrCreateInterfaceRef().SetInterface(intf)
+			pfi.GetOrCreateInterfaceRef().SetSubinterface(0)
+		}
+		gnmi.BatchReplace(b, pf.Interface(interfaceID(dut, intf)).Config(), pfi)
+	}
+	b.Set(t, dut)
+}
+
+// matchedPkts returns the number of packets matched by the rule with
+// sequence number seq of policy.
+func matchedPkts(t *testing.T, dut *ondatra.DUTDevice, policy string, seq uint32) uint64 {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding().Policy(policy).Rule(seq).MatchedPkts().State()
+	// The counter is 0 if the device has not matched any packet yet.
+	v, _ := gnmi.Lookup(t, dut, q).Val()
+	return v
+}
+
+// checkEncapCapture checks the outer headers of the GRE packets captured on
+// ate:port2, and returns the counts of the encapsulated packets by inner
+// DSCP.
+func checkEncapCapture(t *testing.T, ate *ondatra.ATEDevice) map[uint8]int {
+	t.Helper()
+	counts := map[uint8]int{}
+	bad := 0
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port2").ID()) {
+		var ips []*layers.IPv4
+		for _, l := range p.Layers() {
+			if ip, ok := l.(*layers.IPv4); ok {
+				ips = append(ips, ip)
+			}
+		}
+		if p.Layer(layers.LayerTypeGRE) == nil || len(ips) != 2 || ips[1].DstIP.String() != encapDst {
+			continue
+		}
+		outer, inner := ips[0], ips[1]
+		dscp := inner.TOS >> 2
+		counts[dscp]++
+		if err := checkOuter(outer, dscp); err != nil {
+			// Only report the first few bad packets.
+			if bad < 5 {
+				t.Errorf("Encapsulated packet with DSCP %d: %v", dscp, err)
+			}
+			bad++
+		}
+	}
+	if bad > 0 {
+		t.Errorf("Got %d encapsulated packets with bad outer headers", bad)
+	}
+	return counts
+}
+
+// checkOuter checks the outer header of an encapsulated packet with inner
+// DSCP dscp.
+func checkOuter(outer *layers.IPv4, dscp uint8) error {
+	switch {
+	case outer.SrcIP.String() != dutTunnel.IPv4:
+		return fmt.Errorf("got outer source %v, want %s", outer.SrcIP, dutTunnel.IPv4)
+	case outer.DstIP.String() != tunnelDst:
+		return fmt.Errorf("got outer destination %v, want %s", outer.DstIP, tunnelDst)
+	case outer.Protocol != greProtocol:
+		return fmt.Errorf("got outer protocol %d, want %d", outer.Protocol, greProtocol)
+	case outer.TTL != tunnelTTL:
+		return fmt.Errorf("got outer TTL %d, want %d", outer.TTL, tunnelTTL)
+	case outer.TOS>>2 != dscp:
+		return fmt.Errorf("got outer DSCP %d, want the inner DSCP %d", outer.TOS>>2, dscp)
+	}
+	return nil
+}
+
+// runFlows sends the flows of top, checks that they are received without
+// loss, and returns the number of packets sent.
+func runFlows(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config) uint64 {
+	t.Helper()
+	ate.OTG().StartTraffic(t)
+	time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+	ate.OTG().StopTraffic(t)
+	time.Sleep(10 * time.Second)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+	var sent uint64
+	for _, f := range top.Flows().Items() {
+		counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(f.Name()).Counters().State())
+		if counters.GetOutPkts() == 0 || counters.GetInPkts() != counters.GetOutPkts() {
+			t.Errorf("Flow %s: got %d packets received of %d sent, want no loss", f.Name(), counters.GetInPkts(), counters.GetOutPkts())
+		}
+		sent += counters.GetOutPkts()
+	}
+	return sent
+}
+
+// addFlow adds a flow named name from src to rx, whose packets have the
+// headers added by the caller.
+func addFlow(top gosnappi.Config, name string, src, rx attrs.Attributes) gosnappi.Flow {
+	flow := top.Flows().Add().SetName(name)
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Device().SetTxNames([]string{src.Name + ".IPv4"}).SetRxNames([]string{rx.Name + ".IPv4"})
+	flow.Packet().Add().Ethernet().Src().SetValue(src.MAC)
+	flow.Size().SetFixed(frameSize)
+	flow.Rate().SetPps(ppsRate)
+	flow.Duration().FixedPackets().SetPackets(packets)
+	return flow
+}
+
+func TestGREEncapDecap(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+	applyForwardingPolicies(t, dut)
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutSrc)
+	ateTunnel.AddToOTG(top, ate.Port(t, "port2"), &dutTunnel)
+	ateVRF.AddToOTG(top, ate.Port(t, "port3"), &dutVRF)
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{ate.Port(t, "port2").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+
+	t.Run("Encap", func(t *testing.T) {
+		top.Flows().Clear()
+		for _, dscp := range encapDSCPs {
+			flow := addFlow(top, fmt.Sprintf("encap-dscp-%d", dscp), ateSrc, ateTunnel)
+			ip := flow.Packet().Add().Ipv4()
+			ip.Src().SetValue(ateSrc.IPv4)
+			ip.Dst().SetValue(encapDst)
+			ip.Priority().Dscp().Phb().SetValue(uint32(dscp))
+		}
+		ate.OTG().PushConfig(t, top)
+		ate.OTG().StartProtocols(t)
+		otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+		before := matchedPkts(t, dut, encapPolicy, encapRule)
+		otgutils.StartCapture(t, ate.OTG())
+		sent := runFlows(t, ate, top)
+		otgutils.StopCapture(t, ate.OTG())
+		if got := matchedPkts(t, dut, encapPolicy, encapRule) - before; got < sent {
+			t.Errorf("Encap rule: got %d matched packets, want at least %d", got, sent)
+		}
+
+		counts := checkEncapCapture(t, ate)
+		t.Logf("Captured encapsulated packets by DSCP: %v", counts)
+		for _, dscp := range encapDSCPs {
+			if counts[dscp] == 0 {
+				t.Errorf("No encapsulated packets captured with DSCP %d", dscp)
+			}
+		}
+	})
+
+	t.Run("Decap", func(t *testing.T) {
+		top.Flows().Clear()
+		flow := addFlow(top, "decap", ateTunnel, ateVRF)
+		outer := flow.Packet().Add().Ipv4()
+		outer.Src().SetValue(tunnelDst)
+		outer.Dst().SetValue(dutTunnel.IPv4)
+		flow.Packet().Add().Gre()
+		inner := flow.Packet().Add().Ipv4()
+		inner.Src().SetValue(innerSrc)
+		inner.Dst().SetValue(innerDst)
+		ate.OTG().PushConfig(t, top)
+		ate.OTG().StartProtocols(t)
+		otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+		before := matchedPkts(t, dut, decapPolicy, decapRule)
+		sent := runFlows(t, ate, top)
+		if got := matchedPkts(t, dut, decapPolicy, decapRule) - before; got < sent {
+			t.Errorf("Decap rule: got %d matched packets, want at least %d", got, sent)
+		}
+	})
+
+	pf := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding()
+	for _, port := range []string{"port1", "port2"} {
+		gnmi.Delete(t, dut, pf.Interface(interfaceID(dut, dut.Port(t, port).Name())).Config())
+	}
+	gnmi.Delete(t, dut, pf.Policy(encapPolicy).Config())
+	gnmi.Delete(t, dut, pf.Policy(decapPolicy).Config())
+}
@@ -0,0 +1,354 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipip_gue_decap_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/gribi"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/gribigo/fluent"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1 -> dut:port2 -> ate:port2.
+//
+// decapRange is routed to ate:port2, except gueDecapIPv4, which is the
+// address of a DUT loopback, and ipipDecapIPv4, which is programmed with
+// gRIBI to decapsulate IP-in-IP packets. The policy applied to the input of
+// dut:port1 decapsulates the GUE packets to decapRange with the UDP
+// destination port guePort. The inner packets are sent to innerDst, which is
+// routed to ate:port2.
+const (
+	plen = 30
+
+	policyName = "gue-decap"
+	gueRule    = 10
+	guePort    = 6080
+	otherPort  = 6081
+
+	decapRange    = "203.0.113.0/24"
+	gueDecapIPv4  = "203.0.113.1"
+	ipipDecapIPv4 = "203.0.113.2"
+	transitIPv4   = "203.0.113.129"
+
+	innerPrefix = "198.51.100.0/24"
+	innerSrc    = "100.64.0.1"
+	innerDst    = "198.51.100.1"
+
+	nhIndex  = 1
+	nhgIndex = 1
+
+	packets   = 10000
+	frameSize = 512
+	ppsRate   = 1000
+
+	captureName = "port2-capture"
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: plen,
+	}
+	dutSrc = attrs.Attributes{
+		Desc:    "Decap input",
+		IPv4:    "192.0.2.1",
+		IPv4Len: plen,
+	}
+	dutDst = attrs.Attributes{
+		Desc:    "Decap output",
+		IPv4:    "192.0.2.5",
+		IPv4Len: plen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: plen,
+	}
+	dutLoopback = attrs.Attributes{
+		Desc:    "GUE decap address",
+		IPv4:    gueDecapIPv4,
+		IPv4Len: 32,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures the DUT interfaces, the loopback with
+// gueDecapIPv4 and the static routes of decapRange and innerPrefix.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	for _, p := range []struct {
+		port  string
+		attrs attrs.Attributes
+	}{
+		{"port1", dutSrc},
+		{"port2", dutDst},
+	} {
+		dp := dut.Port(t, p.port)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.attrs.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+	}
+
+	lb := netutil.LoopbackInterface(t, dut, 1)
+	lo := dutLoopback.NewOCInterface(lb, dut)
+	lo.Type = oc.IETFInterfaces_InterfaceType_softwareLoopback
+	gnmi.Replace(t, dut, gnmi.OC().Interface(lb).Config(), lo)
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, lb, deviations.DefaultNetworkInstance(dut), 0)
+	}
+
+	b := &gnmi.SetBatch{}
+	for _, prefix := range []string{decapRange, innerPrefix} {
+		cfg := &cfgplugins.StaticRouteCfg{
+			NetworkInstance: deviations.DefaultNetworkInstance(dut),
+			Prefix:          prefix,
+			NextHops: map[string]oc.NetworkInstance_Protocol_Static_NextHop_NextHop_Union{
+				"0": oc.UnionString(ateDst.IPv4),
+			},
+		}
+		if _, err := cfgplugins.NewStaticRouteCfg(b, cfg, dut); err != nil {
+			t.Fatalf("Failed to configure the static route to %s: %v", prefix, err)
+		}
+	}
+	b.Set(t, dut)
+}
+
+// interfaceID returns the ID of interface intf in policy-forwarding.
+func interfaceID(dut *ondatra.DUTDevice, intf string) string {
+	if deviations.InterfaceRefInterfaceIDFormat(dut) {
+		return intf + ".0"
+	}
+	return intf
+}
+
+// applyForwardingPolicy configures the policy decapsulating the GUE packets
+// and applies it to the input of interface intf.
+func applyForwardingPolicy(t *testing.T, dut *ondatra.DUTDevice, intf string) {
+	t.Helper()
+	p := &oc.NetworkInstance_PolicyForwarding_Policy{PolicyId: ygot.String(policyName)}
+	p.SetType(oc.Policy_Type_PBR_POLICY)
+	r := p.GetOrCreateRule(gueRule)
+	r.GetOrCreateIpv4().SetDestinationAddress(decapRange)
+	r.GetOrCreateIpv4().SetProtocol(oc.PacketMatchTypes_IP_PROTOCOL_IP_UDP)
+	r.GetOrCreateTransport().SetDestinationPort(oc.UnionUint16(guePort))
+	r.GetOrCreateAction().SetDecapsulateGue(true)
+	if deviations.PfRequireMatchDefaultRule(dut) {
+		for i, et := range []oc.NetworkInstance_PolicyForwarding_Policy_Rule_L2_Ethertype_Union{
+			oc.PacketMatchTypes_ETHERTYPE_ETHERTYPE_IPV4,
+			oc.PacketMatchTypes_ETHERTYPE_ETHERTYPE_IPV6,
+		} {
+			r := p.GetOrCreateRule(uint32(100 + i))
+			r.GetOrCreateL2().SetEthertype(et)
+			r.GetOrCreateAction().SetNetworkInstance(deviations.DefaultNetworkInstance(dut))
+		}
+	}
+
+	pfi := &oc.NetworkInstance_PolicyForwarding_Interface{InterfaceId: ygot.String(interfaceID(dut, intf))}
+	pfi.SetApplyForwardingPolicy(policyName)
+	if !deviations.InterfaceRefConfigUnsupported(dut) {
+		pfi.GetOrCreateInterfaceRef().SetInterface(intf)
+		pfi.GetOrCreateInterfaceRef().SetSubinterface(0)
+	}
+
+	pf := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding()
+	b := &gnmi.SetBatch{}
+	gnmi.BatchReplace(b, pf.Policy(policyName).Config(), p)
+	gnmi.BatchReplace(b, pf.Interface(interfaceID(dut, intf)).Config(), pfi)
+	b.Set(t, dut)
+}
+
+// programIPinIPDecap programs with gRIBI the route of ipipDecapIPv4 to a
+// next hop decapsulating IP-in-IP packets, followed by a lookup of the inner
+// packets in the default network instance.
+func programIPinIPDecap(t *testing.T, dut *ondatra.DUTDevice, c *gribi.Client) {
+	t.Helper()
+	ni := deviations.DefaultNetworkInstance(dut)
+	c.AddNH(t, nhIndex, "Decap", ni, fluent.InstalledInFIB, &gribi.NHOptions{VrfName: ni})
+	c.AddNHG(t, nhgIndex, map[uint64]uint64{nhIndex: 1}, ni, fluent.InstalledInFIB)
+	c.AddIPv4(t, ipipDecapIPv4+"/32", nhgIndex, ni, "", fluent.InstalledInFIB)
+}
+
+// gueMatchedPkts returns the number of packets matched by the GUE rule.
+func gueMatchedPkts(t *testing.T, dut *ondatra.DUTDevice) uint64 {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding().Policy(policyName).Rule(gueRule).MatchedPkts().State()
+	// The counter is 0 if the device has not matched any packet yet.
+	v, _ := gnmi.Lookup(t, dut, q).Val()
+	return v
+}
+
+// captureCounts returns the number of packets captured on ate:port2 which
+// are still encapsulated, and the number of inner packets which are not.
+func captureCounts(t *testing.T, ate *ondatra.ATEDevice) (encapsulated, decapsulated int) {
+	t.Helper()
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port2").ID()) {
+		ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok {
+			continue
+		}
+		switch ip.DstIP.String() {
+		case innerDst:
+			decapsulated++
+		case gueDecapIPv4, ipipDecapIPv4, transitIPv4:
+			encapsulated++
+		}
+	}
+	return encapsulated, decapsulated
+}
+
+// addFlow adds a flow named name from ate:port1 to ate:port2 with outer
+// destination dst. The outer header is followed by a UDP header with
+// destination port udpPort if udpPort is not 0, and then by the inner IPv4
+// header.
+func addFlow(top gosnappi.Config, name, dst string, udpPort uint32) {
+	flow := top.Flows().Add().SetName(name)
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Device().SetTxNames([]string{ateSrc.Name + ".IPv4"}).SetRxNames([]string{ateDst.Name + ".IPv4"})
+	flow.Packet().Add().Ethernet().Src().SetValue(ateSrc.MAC)
+	outer := flow.Packet().Add().Ipv4()
+	outer.Src().SetValue(ateSrc.IPv4)
+	outer.Dst().SetValue(dst)
+	if udpPort != 0 {
+		udp := flow.Packet().Add().Udp()
+		udp.SrcPort().SetValue(49152)
+		udp.DstPort().SetValue(udpPort)
+	}
+	inner := flow.Packet().Add().Ipv4()
+	inner.Src().SetValue(innerSrc)
+	inner.Dst().SetValue(innerDst)
+	flow.Size().SetFixed(frameSize)
+	flow.Rate().SetPps(ppsRate)
+	flow.Duration().FixedPackets().SetPackets(packets)
+}
+
+func TestIPinIPAndGUEDecap(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+	intf := dut.Port(t, "port1").Name()
+	applyForwardingPolicy(t, dut, intf)
+
+	c := &gribi.Client{
+		DUT:         dut,
+		FIBACK:      true,
+		Persistence: true,
+	}
+	defer c.Close(t)
+	defer c.FlushAll(t)
+	if err := c.Start(t); err != nil {
+		t.Fatalf("gRIBI connection can not be established: %v", err)
+	}
+	c.BecomeLeader(t)
+	c.FlushAll(t)
+	programIPinIPDecap(t, dut, c)
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutSrc)
+	ateDst.AddToOTG(top, ate.Port(t, "port2"), &dutDst)
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{ate.Port(t, "port2").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+
+	cases := []struct {
+		desc    string
+		dst     string
+		udpPort uint32
+		// wantDecap is whether the DUT decapsulates the packets.
+		wantDecap bool
+		// wantGUE is whether the packets match the GUE rule.
+		wantGUE bool
+	}{{
+		desc:      "IP-in-IP",
+		dst:       ipipDecapIPv4,
+		wantDecap: true,
+	}, {
+		desc:      "GUE",
+		dst:       gueDecapIPv4,
+		udpPort:   guePort,
+		wantDecap: true,
+		wantGUE:   true,
+	}, {
+		desc:    "UDP other port",
+		dst:     transitIPv4,
+		udpPort: otherPort,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			top.Flows().Clear()
+			addFlow(top, tc.desc, tc.dst, tc.udpPort)
+			ate.OTG().PushConfig(t, top)
+			ate.OTG().StartProtocols(t)
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+			before := gueMatchedPkts(t, dut)
+			otgutils.StartCapture(t, ate.OTG())
+			ate.OTG().StartTraffic(t)
+			time.Sleep(packets/ppsRate*time.Second + 5*time.Second)
+			ate.OTG().StopTraffic(t)
+			otgutils.StopCapture(t, ate.OTG())
+			time.Sleep(10 * time.Second)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+			counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(tc.desc).Counters().State())
+			sent := counters.GetOutPkts()
+			if sent == 0 || counters.GetInPkts() != sent {
+				t.Errorf("Flow %s: got %d packets received of %d sent, want no loss", tc.desc, counters.GetInPkts(), sent)
+			}
+
+			matched := gueMatchedPkts(t, dut) - before
+			switch {
+			case tc.wantGUE && matched < sent:
+				t.Errorf("GUE rule: got %d matched packets, want at least %d", matched, sent)
+			case !tc.wantGUE && matched != 0:
+				t.Errorf("GUE rule: got %d matched packets, want 0", matched)
+			}
+
+			encapsulated, decapsulated := captureCounts(t, ate)
+			t.Logf("Captured %d encapsulated and %d decapsulated packets", encapsulated, decapsulated)
+			if tc.wantDecap && (decapsulated == 0 || encapsulated != 0) {
+				t.Errorf("Got %d encapsulated and %d decapsulated packets captured, want only decapsulated packets", encapsulated, decapsulated)
+			}
+			if !tc.wantDecap && (encapsulated == 0 || decapsulated != 0) {
+				t.Errorf("Got %d encapsulated and %d decapsulated packets captured, want only encapsulated packets", encapsulated, decapsulated)
+			}
+		})
+	}
+
+	pf := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).PolicyForwarding()
+	gnmi.Delete(t, dut, pf.Interface(interfaceID(dut, intf)).Config())
+	gnmi.Delete(t, dut, pf.Policy(policyName).Config())
+}
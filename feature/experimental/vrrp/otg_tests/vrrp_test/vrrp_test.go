@@ -0,0 +1,564 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vrrp_test
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/mcast"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The testbed consists of ate:port1 -> dut:port1, the VRRP LAN, and
+// dut:port2 -> ate:port2, the destination of the traffic of the LAN.
+//
+// The VRRP LAN is the VLAN subinterface vlanID of dut:port1, with a VRRP
+// group for IPv4 and for IPv6. On the LAN, the ATE emulates a host, of which
+// the default gateway is the virtual address, and the other VRRP router. The
+// OTG does not emulate VRRP, so the advertisements of the other router are
+// sent as raw flows, with a priority higher or lower than the DUT, and the
+// role of the DUT, which OpenConfig does not model, is inferred from its
+// captured advertisements and from the forwarding of the traffic of the host
+// to the virtual MAC address.
+const (
+	vlanID = 10
+	vrid   = 10
+
+	dutPriority  = 100
+	highPriority = 200
+	lowPriority  = 50
+	// advInterval is the advertisement interval, in centiseconds.
+	advInterval = 100
+
+	// maxFailover is the maximum time for the DUT to become master when the
+	// master stops its advertisements: its master down interval of 3
+	// advertisement intervals and its skew time, with a margin for the
+	// forwarding to converge.
+	maxFailover = 5 * time.Second
+
+	ppsRate = 1000
+
+	// protoVRRP is the IP protocol number of VRRP.
+	protoVRRP = 112
+
+	hostMAC   = "02:00:01:01:01:01"
+	routerMAC = "02:00:01:01:01:02"
+
+	// virtualLinkLocal is the virtual link local address of the IPv6
+	// group.
+	virtualLinkLocal = "fe80::1"
+
+	captureName = "vrrp-capture"
+)
+
+var (
+	dutDst = attrs.Attributes{
+		Desc:    "Destination",
+		IPv4:    "198.51.100.1",
+		IPv4Len: 30,
+		IPv6:    "2001:db8:2::1",
+		IPv6Len: 126,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ateDst",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "198.51.100.2",
+		IPv4Len: 30,
+		IPv6:    "2001:db8:2::2",
+		IPv6Len: 126,
+	}
+)
+
+// family is the VRRP group of an address family on the VRRP LAN.
+type family struct {
+	name string
+	ipv6 bool
+	// version is the VRRP version of the group, VRRPv2 for IPv4, and VRRPv3
+	// for IPv6, which VRRPv2 does not support.
+	version byte
+	plen    uint8
+	// dut, router and host are the addresses of the DUT, of the other VRRP
+	// router and of the host on the LAN, and virtual is the virtual address
+	// of the group.
+	dut, router, host, virtual string
+	// dst is the address of ateDst.
+	dst string
+	// vmac is the virtual MAC address of the group.
+	vmac string
+}
+
+var (
+	ipv4 = &family{
+		name:    "IPv4",
+		version: 2,
+		plen:    29,
+		dut:     "192.0.2.2",
+		router:  "192.0.2.3",
+		host:    "192.0.2.4",
+		virtual: "192.0.2.1",
+		dst:     ateDst.IPv4,
+		vmac:    "00:00:5e:00:01:0a",
+	}
+	ipv6 = &family{
+		name:    "IPv6",
+		ipv6:    true,
+		version: 3,
+		plen:    64,
+		dut:     "2001:db8:1::2",
+		// The VRRPv3 advertisements for IPv6 are sent from the link local
+		// address of the router.
+		router:  mcast.LinkLocal(routerMAC),
+		host:    "2001:db8:1::4",
+		virtual: "2001:db8:1::1",
+		dst:     ateDst.IPv6,
+		vmac:    "00:00:5e:00:02:0a",
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// advertFlow returns the name of the flow of the advertisements of the
+// router with priority.
+func (f *family) advertFlow(priority uint8) string {
+	if priority > dutPriority {
+		return f.name + "-advert-high"
+	}
+	return f.name + "-advert-low"
+}
+
+// trafficFlow returns the name of the flow of the host to ateDst.
+func (f *family) trafficFlow() string {
+	return f.name + "-traffic"
+}
+
+// group returns the multicast address of the VRRP advertisements.
+func (f *family) group() string {
+	if f.ipv6 {
+		return "ff02::12"
+	}
+	return "224.0.0.18"
+}
+
+// configureDUT configures the VRRP LAN on the subinterface vlanID of
+// dut:port1, with the VRRP groups of ipv4 and ipv6, and dut:port2.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(dut)
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+
+	i := &oc.Interface{Name: ygot.String(p1.Name()), Type: oc.IETFInterfaces_InterfaceType_ethernetCsmacd}
+	if deviations.InterfaceEnabled(dut) {
+		i.Enabled = ygot.Bool(true)
+	}
+	s := i.GetOrCreateSubinterface(vlanID)
+	if deviations.DeprecatedVlanID(dut) {
+		s.GetOrCreateVlan().VlanId = oc.UnionUint16(vlanID)
+	} else {
+		s.GetOrCreateVlan().GetOrCreateMatch().GetOrCreateSingleTagged().VlanId = ygot.Uint16(vlanID)
+	}
+	s4 := s.GetOrCreateIpv4()
+	s6 := s.GetOrCreateIpv6()
+	if deviations.InterfaceEnabled(dut) {
+		if !deviations.IPv4MissingEnabled(dut) {
+			s4.Enabled = ygot.Bool(true)
+		}
+		s6.Enabled = ygot.Bool(true)
+	}
+	a4 := s4.GetOrCreateAddress(ipv4.dut)
+	a4.PrefixLength = ygot.Uint8(ipv4.plen)
+	g4 := a4.GetOrCreateVrrpGroup(vrid)
+	g4.VirtualAddress = []string{ipv4.virtual}
+	g4.Priority = ygot.Uint8(dutPriority)
+	g4.Preempt = ygot.Bool(true)
+	g4.AdvertisementInterval = ygot.Uint16(advInterval)
+	a6 := s6.GetOrCreateAddress(ipv6.dut)
+	a6.PrefixLength = ygot.Uint8(ipv6.plen)
+	g6 := a6.GetOrCreateVrrpGroup(vrid)
+	g6.VirtualAddress = []string{ipv6.virtual}
+	g6.VirtualLinkLocal = ygot.String(virtualLinkLocal)
+	g6.Priority = ygot.Uint8(dutPriority)
+	g6.Preempt = ygot.Bool(true)
+	g6.AdvertisementInterval = ygot.Uint16(advInterval)
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p1.Name()).Config(), i)
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p2.Name()).Config(), dutDst.NewOCInterface(p2.Name(), dut))
+
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), dni, vlanID)
+		fptest.AssignToNetworkInstance(t, dut, p2.Name(), dni, 0)
+	}
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+}
+
+// setPreempt sets the preempt mode of the VRRP group of f on the DUT.
+func setPreempt(t *testing.T, dut *ondatra.DUTDevice, f *family, preempt bool) {
+	t.Helper()
+	s := gnmi.OC().Interface(dut.Port(t, "port1").Name()).Subinterface(vlanID)
+	if f.ipv6 {
+		gnmi.Replace(t, dut, s.Ipv6().Address(f.dut).VrrpGroup(vrid).Preempt().Config(), preempt)
+		return
+	}
+	gnmi.Replace(t, dut, s.Ipv4().Address(f.dut).VrrpGroup(vrid).Preempt().Config(), preempt)
+}
+
+// currentPriority returns the current priority of the VRRP group of f on
+// the DUT.
+func currentPriority(t *testing.T, dut *ondatra.DUTDevice, f *family) uint8 {
+	t.Helper()
+	s := gnmi.OC().Interface(dut.Port(t, "port1").Name()).Subinterface(vlanID)
+	if f.ipv6 {
+		return gnmi.Get(t, dut, s.Ipv6().Address(f.dut).VrrpGroup(vrid).CurrentPriority().State())
+	}
+	return gnmi.Get(t, dut, s.Ipv4().Address(f.dut).VrrpGroup(vrid).CurrentPriority().State())
+}
+
+// configureATE configures the host on the VRRP LAN and ateDst, the flows of
+// the advertisements of the other VRRP router and of the traffic of the
+// host to the virtual MAC address, and the capture of ate:port1.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	p1 := ate.Port(t, "port1")
+	p2 := ate.Port(t, "port2")
+
+	top.Ports().Add().SetName(p1.ID())
+	host := top.Devices().Add().SetName("host")
+	eth := host.Ethernets().Add().SetName("host.Eth").SetMac(hostMAC)
+	eth.Connection().SetPortName(p1.ID())
+	eth.Vlans().Add().SetName("host.Vlan").SetId(vlanID)
+	eth.Ipv4Addresses().Add().SetName("host.IPv4").SetAddress(ipv4.host).SetGateway(ipv4.virtual).SetPrefix(uint32(ipv4.plen))
+	eth.Ipv6Addresses().Add().SetName("host.IPv6").SetAddress(ipv6.host).SetGateway(ipv6.virtual).SetPrefix(uint32(ipv6.plen))
+	ateDst.AddToOTG(top, p2, &dutDst)
+
+	for _, f := range []*family{ipv4, ipv6} {
+		addAdvertFlow(top, p1.ID(), f, highPriority)
+		addAdvertFlow(top, p1.ID(), f, lowPriority)
+		addTrafficFlow(top, p1.ID(), p2.ID(), f)
+	}
+
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{p1.ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+	return top
+}
+
+// addAdvertFlow adds to top the flow of the advertisements of the other
+// VRRP router of f with priority on port, continuously sent every
+// advertisement interval.
+func addAdvertFlow(top gosnappi.Config, port string, f *family, priority uint8) {
+	msg := advertisement(f, priority)
+	fl := top.Flows().Add().SetName(f.advertFlow(priority))
+	fl.TxRx().Port().SetTxName(port)
+	fl.Duration().Continuous()
+	fl.Rate().SetPps(100 / advInterval)
+	eth := fl.Packet().Add().Ethernet()
+	// The master sends its advertisements from the virtual MAC address.
+	eth.Src().SetValue(f.vmac)
+	eth.Dst().SetValue(mcast.MAC(f.group()))
+	fl.Packet().Add().Vlan().Id().SetValue(vlanID)
+	// size is the size of the frame with its FCS.
+	size := 18 + len(msg) + 4
+	if f.ipv6 {
+		ip := fl.Packet().Add().Ipv6()
+		ip.Src().SetValue(f.router)
+		ip.Dst().SetValue(f.group())
+		ip.HopLimit().SetValue(255)
+		ip.NextHeader().SetValue(protoVRRP)
+		size += 40
+	} else {
+		ip := fl.Packet().Add().Ipv4()
+		ip.Src().SetValue(f.router)
+		ip.Dst().SetValue(f.group())
+		ip.TimeToLive().SetValue(255)
+		ip.Protocol().SetValue(protoVRRP)
+		size += 20
+	}
+	fl.Packet().Add().Custom().SetBytes(hex.EncodeToString(msg))
+	fl.Size().SetFixed(uint32(max(size, 64)))
+}
+
+// addTrafficFlow adds to top the flow of the host of f on port to ateDst on
+// rxPort, sent to the virtual MAC address.
+func addTrafficFlow(top gosnappi.Config, port, rxPort string, f *family) {
+	fl := top.Flows().Add().SetName(f.trafficFlow())
+	fl.Metrics().SetEnable(true)
+	fl.TxRx().Port().SetTxName(port).SetRxNames([]string{rxPort})
+	fl.Duration().Continuous()
+	fl.Rate().SetPps(ppsRate)
+	fl.Size().SetFixed(512)
+	eth := fl.Packet().Add().Ethernet()
+	eth.Src().SetValue(hostMAC)
+	eth.Dst().SetValue(f.vmac)
+	fl.Packet().Add().Vlan().Id().SetValue(vlanID)
+	if f.ipv6 {
+		ip := fl.Packet().Add().Ipv6()
+		ip.Src().SetValue(f.host)
+		ip.Dst().SetValue(f.dst)
+	} else {
+		ip := fl.Packet().Add().Ipv4()
+		ip.Src().SetValue(f.host)
+		ip.Dst().SetValue(f.dst)
+	}
+}
+
+// advertisement returns the advertisement of the other VRRP router of f with
+// priority: a VRRPv2 advertisement of RFC 3768, without authentication, for
+// IPv4, and a VRRPv3 advertisement of RFC 5798, of which the checksum
+// includes the IPv6 pseudo header and the first address is the virtual link
+// local address, for IPv6.
+func advertisement(f *family, priority uint8) []byte {
+	if !f.ipv6 {
+		b := []byte{0x21, vrid, priority, 1, 0, advInterval / 100, 0, 0}
+		b = append(b, net.ParseIP(f.virtual).To4()...)
+		b = append(b, make([]byte, 8)...)
+		binary.BigEndian.PutUint16(b[6:], otgutils.Checksum(b))
+		return b
+	}
+	b := []byte{0x31, vrid, priority, 2, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(b[4:], advInterval)
+	b = append(b, net.ParseIP(virtualLinkLocal).To16()...)
+	b = append(b, net.ParseIP(f.virtual).To16()...)
+	pseudo := append(net.ParseIP(f.router).To16(), net.ParseIP(f.group()).To16()...)
+	pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(b)))
+	pseudo = append(pseudo, 0, 0, 0, protoVRRP)
+	binary.BigEndian.PutUint16(b[6:], otgutils.Checksum(append(pseudo, b...)))
+	return b
+}
+
+// setFlowState starts or stops the flows names of the ATE.
+func setFlowState(t *testing.T, ate *ondatra.ATEDevice, state gosnappi.StateTrafficFlowTransmitStateEnum, names ...string) {
+	t.Helper()
+	cs := gosnappi.NewControlState()
+	cs.Traffic().FlowTransmit().SetState(state).SetFlowNames(names)
+	ate.OTG().SetControlState(t, cs)
+}
+
+// advert is a captured VRRP advertisement.
+type advert struct {
+	src      net.HardwareAddr
+	version  byte
+	vrid     byte
+	priority byte
+}
+
+// captureAdverts returns the advertisements of the DUT for f captured on
+// ate:port1 during d.
+func captureAdverts(t *testing.T, ate *ondatra.ATEDevice, f *family, d time.Duration) []advert {
+	t.Helper()
+	otgutils.StartCapture(t, ate.OTG())
+	time.Sleep(d)
+	otgutils.StopCapture(t, ate.OTG())
+
+	var adverts []advert
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port1").ID()) {
+		eth, ok := p.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+		if !ok {
+			continue
+		}
+		var b []byte
+		if f.ipv6 {
+			ip, ok := p.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+			if !ok || ip.NextHeader != protoVRRP || ip.SrcIP.Equal(net.ParseIP(f.router)) {
+				continue
+			}
+			b = ip.Payload
+		} else {
+			ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+			if !ok || ip.Protocol != protoVRRP || ip.SrcIP.Equal(net.ParseIP(f.router)) {
+				continue
+			}
+			b = ip.Payload
+		}
+		if len(b) < 4 {
+			continue
+		}
+		adverts = append(adverts, advert{src: eth.SrcMAC, version: b[0] >> 4, vrid: b[1], priority: b[2]})
+	}
+	return adverts
+}
+
+// sendTraffic sends the traffic of the host of f during d, and returns the
+// number of packets sent and received.
+func sendTraffic(t *testing.T, ate *ondatra.ATEDevice, f *family, d time.Duration) (uint64, uint64) {
+	t.Helper()
+	sent, received := flowPackets(t, ate, f.trafficFlow())
+	setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.START, f.trafficFlow())
+	time.Sleep(d)
+	setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.STOP, f.trafficFlow())
+	// Allow the packets in flight to be received.
+	time.Sleep(2 * time.Second)
+	s, r := flowPackets(t, ate, f.trafficFlow())
+	return s - sent, r - received
+}
+
+// flowPackets returns the number of packets sent and received by the flow
+// name.
+func flowPackets(t *testing.T, ate *ondatra.ATEDevice, name string) (uint64, uint64) {
+	t.Helper()
+	c := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(name).Counters().State())
+	return c.GetOutPkts(), c.GetInPkts()
+}
+
+// verifyMaster verifies that the DUT is the master of the VRRP group of f:
+// that it sends advertisements from the virtual MAC address with its
+// priority, and forwards the traffic sent to the virtual MAC address.
+func verifyMaster(t *testing.T, ate *ondatra.ATEDevice, f *family) {
+	t.Helper()
+	adverts := captureAdverts(t, ate, f, 3*time.Second)
+	if len(adverts) == 0 {
+		t.Errorf("No %s VRRP advertisement of the DUT captured, want the DUT to be master", f.name)
+	}
+	for _, a := range adverts {
+		if a.version != f.version || a.vrid != vrid || a.priority != dutPriority || a.src.String() != f.vmac {
+			t.Errorf("%s VRRP advertisement of the DUT: got version %d, VRID %d, priority %d from %s, want version %d, VRID %d, priority %d from %s",
+				f.name, a.version, a.vrid, a.priority, a.src, f.version, vrid, dutPriority, f.vmac)
+		}
+	}
+	if sent, received := sendTraffic(t, ate, f, 5*time.Second); sent == 0 || received != sent {
+		t.Errorf("Traffic of the host to the virtual MAC address: got %d packets received of %d sent, want all", received, sent)
+	}
+}
+
+// verifyBackup verifies that the DUT is a backup of the VRRP group of f:
+// that it sends no advertisements, and does not forward the traffic sent to
+// the virtual MAC address.
+func verifyBackup(t *testing.T, ate *ondatra.ATEDevice, f *family) {
+	t.Helper()
+	if adverts := captureAdverts(t, ate, f, 3*time.Second); len(adverts) != 0 {
+		t.Errorf("Got %d %s VRRP advertisements of the DUT, want none from a backup", len(adverts), f.name)
+	}
+	if sent, received := sendTraffic(t, ate, f, 5*time.Second); sent == 0 || received != 0 {
+		t.Errorf("Traffic of the host to the virtual MAC address: got %d packets received of %d sent, want none", received, sent)
+	}
+}
+
+// verifyVirtualMAC verifies that the virtual address of f is resolved by the
+// host to the virtual MAC address.
+func verifyVirtualMAC(t *testing.T, ate *ondatra.ATEDevice, f *family) {
+	t.Helper()
+	eth := gnmi.OTG().Interface("host.Eth")
+	var got string
+	if f.ipv6 {
+		got = gnmi.Get(t, ate.OTG(), eth.Ipv6Neighbor(f.virtual).LinkLayerAddress().State())
+	} else {
+		got = gnmi.Get(t, ate.OTG(), eth.Ipv4Neighbor(f.virtual).LinkLayerAddress().State())
+	}
+	if got != f.vmac {
+		t.Errorf("MAC address of %s: got %s, want %s", f.virtual, got, f.vmac)
+	}
+}
+
+func TestVRRP(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	configureDUT(t, dut)
+	// Without another VRRP router, the DUT becomes master of both groups
+	// after its master down interval, and then answers for the virtual
+	// addresses of the default gateway of the host.
+	time.Sleep(maxFailover)
+
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+
+	for _, f := range []*family{ipv4, ipv6} {
+		t.Run(f.name, func(t *testing.T) {
+			high := f.advertFlow(highPriority)
+			low := f.advertFlow(lowPriority)
+			defer setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.STOP, high, low)
+
+			t.Run("Master", func(t *testing.T) {
+				if got := currentPriority(t, dut, f); got != dutPriority {
+					t.Errorf("Current priority: got %d, want %d", got, dutPriority)
+				}
+				verifyVirtualMAC(t, ate, f)
+				verifyMaster(t, ate, f)
+			})
+
+			t.Run("HigherPriorityPeer", func(t *testing.T) {
+				setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.START, high)
+				// The master becomes backup on the first advertisement
+				// with a higher priority.
+				time.Sleep(2 * time.Second)
+				verifyBackup(t, ate, f)
+			})
+
+			t.Run("LowerPriorityPeerNoPreempt", func(t *testing.T) {
+				setPreempt(t, dut, f, false)
+				setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.STOP, high)
+				setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.START, low)
+				// Without preemption, the backup keeps accepting the
+				// master of lower priority.
+				time.Sleep(2 * maxFailover)
+				verifyBackup(t, ate, f)
+			})
+
+			t.Run("LowerPriorityPeerPreempt", func(t *testing.T) {
+				setPreempt(t, dut, f, true)
+				// With preemption, the backup ignores the advertisements
+				// of lower priority and becomes master when its master
+				// down timer expires.
+				time.Sleep(maxFailover)
+				verifyMaster(t, ate, f)
+				setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.STOP, low)
+			})
+
+			t.Run("Failover", func(t *testing.T) {
+				setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.START, high)
+				time.Sleep(2 * time.Second)
+				sent, received := flowPackets(t, ate, f.trafficFlow())
+				setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.START, f.trafficFlow())
+				time.Sleep(2 * time.Second)
+				// The master withdraws by stopping its advertisements.
+				setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.STOP, high)
+				time.Sleep(maxFailover + 5*time.Second)
+				setFlowState(t, ate, gosnappi.StateTrafficFlowTransmitState.STOP, f.trafficFlow())
+				time.Sleep(2 * time.Second)
+				s, r := flowPackets(t, ate, f.trafficFlow())
+				sent, received = s-sent, r-received
+				if received == 0 {
+					t.Fatalf("Traffic of the host to the virtual MAC address: got no packet received of %d sent, want the DUT to take over", sent)
+				}
+				// The packets sent before the withdrawal of the master are
+				// lost too, as it is emulated by raw advertisements and
+				// does not forward.
+				failover := time.Duration(sent-received)*time.Second/ppsRate - 2*time.Second
+				t.Logf("%s VRRP failover time: %v", f.name, failover)
+				if failover > maxFailover {
+					t.Errorf("%s VRRP failover time: got %v, want at most %v", f.name, failover, maxFailover)
+				}
+				verifyMaster(t, ate, f)
+			})
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model_coverage_test
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/modelcheck"
+	"github.com/openconfig/ondatra"
+)
+
+var (
+	publicDir = flag.String("oc_public_dir", "",
+		"directory of the github.com/openconfig/public release the generated bindings were built from, e.g. as checked out by tools/clone_oc_public.sh")
+	models = flag.String("models",
+		"openconfig-interfaces,openconfig-if-ip,openconfig-platform,openconfig-network-instance,openconfig-system,openconfig-lldp,openconfig-qos,openconfig-acl,openconfig-routing-policy",
+		"comma separated list of models the DUT must support; if empty all models of -oc_public_dir are checked")
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+func TestModelCoverage(t *testing.T) {
+	if *publicDir == "" {
+		t.Fatal("-oc_public_dir must be the directory of the OpenConfig models the generated bindings were built from")
+	}
+	var names []string
+	if *models != "" {
+		names = strings.Split(*models, ",")
+	}
+	want, err := modelcheck.FromYANG(*publicDir, names...)
+	if err != nil {
+		t.Fatalf("Cannot read the versions of the models: %v", err)
+	}
+
+	dut := ondatra.DUT(t, "dut")
+	got := modelcheck.Capabilities(t, dut)
+	t.Logf("%s supports %d models", dut.Name(), len(got))
+
+	r := modelcheck.Compare(want, got)
+	if _, err := fptest.WriteOutput("model_coverage", ".txt", r.String()); err != nil {
+		t.Errorf("Could not write the model coverage report: %v", err)
+	}
+	if err := r.Err(); err != nil {
+		t.Errorf("Models of %s are not compatible with the generated bindings: %v", dut.Name(), err)
+	}
+}
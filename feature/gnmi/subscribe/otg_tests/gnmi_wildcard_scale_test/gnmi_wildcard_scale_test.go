@@ -0,0 +1,332 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnmi_wildcard_scale_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/components"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	sampleInterval = flag.Duration("sample_interval", 10*time.Second, "sample interval of the wildcard subscriptions")
+	measureTime    = flag.Duration("measure_time", 2*time.Minute, "time updates are measured after the initial sync")
+	maxSyncTime    = flag.Duration("max_sync_time", time.Minute, "maximum time allowed for the initial sync")
+	maxCPU         = flag.Uint("max_cpu", 90, "maximum allowed CPU utilization in percent of any controller card during the subscriptions")
+)
+
+// The testbed consists of ate:port1 -> dut:port1 and dut:port2 -> ate:port2.
+// An IPv4 flow is sent from ate:port1 to ate:port2 while the subscriptions
+// are active.
+const (
+	ipv4PrefixLen = 30
+	linePct       = 50
+	flowName      = "IPv4Flow"
+	// trafficSettle is the time traffic runs before the subscriptions start.
+	trafficSettle = 15 * time.Second
+	// lossTolerance is the allowed traffic loss in percent.
+	lossTolerance = 1
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+	}
+
+	// wildcards are the subscribed paths.
+	wildcards = []*gpb.Path{
+		{Elem: []*gpb.PathElem{{Name: "interfaces"}, {Name: "interface", Key: map[string]string{"name": "*"}}, {Name: "state"}}},
+		{Elem: []*gpb.PathElem{{Name: "components"}, {Name: "component", Key: map[string]string{"name": "*"}}, {Name: "state"}}},
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures port1 and port2 on the DUT.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	d := gnmi.OC()
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+	gnmi.Replace(t, dut, d.Interface(p1.Name()).Config(), dutPort1.NewOCInterface(p1.Name(), dut))
+	gnmi.Replace(t, dut, d.Interface(p2.Name()).Config(), dutPort2.NewOCInterface(p2.Name(), dut))
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		fptest.AssignToNetworkInstance(t, dut, p2.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+}
+
+// configureATE configures port1 and port2 on the ATE and the IPv4 flow from
+// port1 to port2.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	atePort1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	atePort2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+
+	f := top.Flows().Add().SetName(flowName)
+	f.Metrics().SetEnable(true)
+	f.TxRx().Device().SetTxNames([]string{atePort1.Name + ".IPv4"}).SetRxNames([]string{atePort2.Name + ".IPv4"})
+	f.Rate().SetPercentage(linePct)
+	f.Duration().Continuous()
+	f.Packet().Add().Ethernet().Src().SetValue(atePort1.MAC)
+	ip4 := f.Packet().Add().Ipv4()
+	ip4.Src().SetValue(atePort1.IPv4)
+	ip4.Dst().SetValue(atePort2.IPv4)
+	return top
+}
+
+// usage is the resource usage of the controller cards of the DUT.
+type usage struct {
+	maxCPU      uint8  // highest instant CPU utilization of any card
+	memUtilized uint64 // sum of the utilized memory of all cards
+}
+
+func resourceUsage(t *testing.T, dut *ondatra.DUTDevice, cards []string) usage {
+	t.Helper()
+	var u usage
+	for _, c := range cards {
+		if v, ok := gnmi.Lookup(t, dut, gnmi.OC().Component(c).Cpu().Utilization().Instant().State()).Val(); ok && v > u.maxCPU {
+			u.maxCPU = v
+		}
+		if v, ok := gnmi.Lookup(t, dut, gnmi.OC().Component(c).Memory().Utilized().State()).Val(); ok {
+			u.memUtilized += v
+		}
+	}
+	return u
+}
+
+// measurement is the outcome of the wildcard subscriptions.
+type measurement struct {
+	syncTime      time.Duration
+	syncUpdates   int
+	updates       int // leaf updates after the initial sync
+	interfaces    map[string]bool
+	components    map[string]bool
+	usageDuring   []usage
+	measuredFor   time.Duration
+	updatesPerSec float64
+}
+
+// subscribe subscribes to the wildcards and measures the initial sync and the
+// updates for measureTime, sampling the resource usage meanwhile.
+func subscribe(t *testing.T, dut *ondatra.DUTDevice, cards []string) *measurement {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := dut.RawAPIs().GNMI(t).Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("gNMI Subscribe: %v", err)
+	}
+	sl := &gpb.SubscriptionList{Mode: gpb.SubscriptionList_STREAM, Encoding: gpb.Encoding_PROTO}
+	for _, p := range wildcards {
+		sl.Subscription = append(sl.Subscription, &gpb.Subscription{Path: p, Mode: gpb.SubscriptionMode_SAMPLE, SampleInterval: uint64(sampleInterval.Nanoseconds())})
+	}
+	start := time.Now()
+	if err := stream.Send(&gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: sl}}); err != nil {
+		t.Fatalf("gNMI Subscribe send: %v", err)
+	}
+
+	type received struct {
+		resp *gpb.SubscribeResponse
+		err  error
+	}
+	recvCh := make(chan received)
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			select {
+			case recvCh <- received{resp, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	m := &measurement{interfaces: map[string]bool{}, components: map[string]bool{}}
+	synced := false
+	var measureStart time.Time
+	var done <-chan time.Time
+	usageTick := time.NewTicker(*sampleInterval)
+	defer usageTick.Stop()
+	syncTimeout := time.After(*maxSyncTime)
+	for {
+		select {
+		case r := <-recvCh:
+			if r.err != nil {
+				t.Fatalf("gNMI Subscribe receive: %v", r.err)
+			}
+			if r.resp.GetSyncResponse() {
+				synced = true
+				m.syncTime = time.Since(start)
+				measureStart = time.Now()
+				done = time.After(*measureTime)
+				t.Logf("Initial sync of %d updates completed after %v", m.syncUpdates, m.syncTime)
+				continue
+			}
+			n := r.resp.GetUpdate()
+			if !synced {
+				m.syncUpdates += len(n.GetUpdate())
+				recordKeys(m, n)
+				continue
+			}
+			m.updates += len(n.GetUpdate())
+		case <-usageTick.C:
+			if synced {
+				m.usageDuring = append(m.usageDuring, resourceUsage(t, dut, cards))
+			}
+		case <-syncTimeout:
+			if !synced {
+				t.Fatalf("No sync response within %v", *maxSyncTime)
+			}
+		case <-done:
+			m.measuredFor = time.Since(measureStart)
+			m.updatesPerSec = float64(m.updates) / m.measuredFor.Seconds()
+			return m
+		}
+	}
+}
+
+// recordKeys records the interface and component names of the updates of n.
+func recordKeys(m *measurement, n *gpb.Notification) {
+	for _, u := range n.GetUpdate() {
+		elems := append(append([]*gpb.PathElem{}, n.GetPrefix().GetElem()...), u.GetPath().GetElem()...)
+		if len(elems) < 2 {
+			continue
+		}
+		name := elems[1].GetKey()["name"]
+		switch elems[0].GetName() {
+		case "interfaces":
+			m.interfaces[name] = true
+		case "components":
+			m.components[name] = true
+		}
+	}
+}
+
+func TestWildcardScale(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	cards := components.FindComponentsByType(t, dut, oc.PlatformTypes_OPENCONFIG_HARDWARE_COMPONENT_CONTROLLER_CARD)
+	if len(cards) == 0 {
+		cards = components.FindComponentsByType(t, dut, oc.PlatformTypes_OPENCONFIG_HARDWARE_COMPONENT_CHASSIS)
+	}
+
+	configureDUT(t, dut)
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	defer ate.OTG().StopProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+	ate.OTG().StartTraffic(t)
+	time.Sleep(trafficSettle)
+	before := resourceUsage(t, dut, cards)
+	m := subscribe(t, dut, cards)
+	ate.OTG().StopTraffic(t)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "sync_time,%v\nsync_updates,%d\nupdates,%d\nmeasured_for,%v\nupdates_per_second,%.1f\n",
+		m.syncTime, m.syncUpdates, m.updates, m.measuredFor, m.updatesPerSec)
+	fmt.Fprintf(&report, "cpu_before,%d\nmemory_utilized_before,%d\n", before.maxCPU, before.memUtilized)
+	for i, u := range m.usageDuring {
+		fmt.Fprintf(&report, "cpu_during_%d,%d\nmemory_utilized_during_%d,%d\n", i, u.maxCPU, i, u.memUtilized)
+	}
+	if _, err := fptest.WriteOutput("wildcard_scale", ".csv", report.String()); err != nil {
+		t.Errorf("Could not write the measurement report: %v", err)
+	}
+	t.Logf("Measurements:\n%s", report.String())
+
+	t.Run("Initial sync", func(t *testing.T) {
+		if m.syncTime > *maxSyncTime {
+			t.Errorf("Initial sync took %v, want <= %v", m.syncTime, *maxSyncTime)
+		}
+		for _, name := range gnmi.GetAll(t, dut, gnmi.OC().InterfaceAny().Name().State()) {
+			if !m.interfaces[name] {
+				t.Errorf("Interface %s missing from the initial sync", name)
+			}
+		}
+		for _, name := range gnmi.GetAll(t, dut, gnmi.OC().ComponentAny().Name().State()) {
+			if !m.components[name] {
+				t.Errorf("Component %s missing from the initial sync", name)
+			}
+		}
+	})
+
+	t.Run("Updates", func(t *testing.T) {
+		if m.updates == 0 {
+			t.Errorf("No updates within %v after the initial sync, want samples every %v", m.measuredFor, *sampleInterval)
+		}
+	})
+
+	t.Run("Resource usage", func(t *testing.T) {
+		for i, u := range m.usageDuring {
+			if uint(u.maxCPU) > *maxCPU {
+				t.Errorf("CPU utilization of a controller card at sample %d: got %d%%, want <= %d%%", i, u.maxCPU, *maxCPU)
+			}
+		}
+	})
+
+	t.Run("Traffic", func(t *testing.T) {
+		if loss := otgutils.GetFlowLossPct(t, ate.OTG(), flowName, 10*time.Second); loss > lossTolerance {
+			t.Errorf("Traffic loss of %s: got %.2f%%, want <= %d%%", flowName, loss, lossTolerance)
+		}
+	})
+}
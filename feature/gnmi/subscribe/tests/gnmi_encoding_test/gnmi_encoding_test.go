@@ -0,0 +1,187 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnmi_encoding_test
+
+import (
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/components"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/subscribe"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/protobuf/proto"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var floatTolerance = flag.Float64("float_tolerance", 0.5,
+	"allowed difference of floating point values, such as optical power, between the fetches in the two encodings")
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// float returns the floating point value of v, which is a decimal64 leaf or a
+// binary leaf of an IEEE 754 single precision float.
+func float(v *gpb.TypedValue) (float64, bool) {
+	switch v := v.GetValue().(type) {
+	case *gpb.TypedValue_DoubleVal:
+		return v.DoubleVal, true
+	case *gpb.TypedValue_FloatVal:
+		return float64(v.FloatVal), true
+	case *gpb.TypedValue_BytesVal:
+		if len(v.BytesVal) == 4 {
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(v.BytesVal))), true
+		}
+	}
+	return 0, false
+}
+
+// equal reports whether the values of a leaf in both encodings are the same.
+func equal(a, b *gpb.TypedValue) bool {
+	if fa, ok := float(a); ok {
+		if fb, ok := float(b); ok {
+			return math.Abs(fa-fb) <= *floatTolerance
+		}
+	}
+	return proto.Equal(a, b)
+}
+
+// compare reports the leaves which differ between the PROTO and the JSON_IETF
+// encoding as test errors.
+func compare(t *testing.T, protoLeaves, jsonLeaves map[string]*gpb.TypedValue) {
+	t.Helper()
+	var diffs []string
+	for p, pv := range protoLeaves {
+		if subscribe.IgnoreVolatile(p) {
+			continue
+		}
+		jv, ok := jsonLeaves[p]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("%s: only in PROTO = %v", p, pv))
+		case !equal(pv, jv):
+			diffs = append(diffs, fmt.Sprintf("%s: PROTO = %v, JSON_IETF = %v", p, pv, jv))
+		}
+	}
+	for p, jv := range jsonLeaves {
+		if _, ok := protoLeaves[p]; !ok && !subscribe.IgnoreVolatile(p) {
+			diffs = append(diffs, fmt.Sprintf("%s: only in JSON_IETF = %v", p, jv))
+		}
+	}
+	sort.Strings(diffs)
+	for _, d := range diffs {
+		t.Error(d)
+	}
+}
+
+// firstComponent returns the name of the first component of type typ, and
+// skips the test if there is none.
+func firstComponent(t *testing.T, dut *ondatra.DUTDevice, typ oc.E_PlatformTypes_OPENCONFIG_HARDWARE_COMPONENT) string {
+	t.Helper()
+	names := components.FindComponentsByType(t, dut, typ)
+	if len(names) == 0 {
+		t.Skipf("No component of type %v", typ)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+func TestEncodings(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	lb := netutil.LoopbackInterface(t, dut, 12)
+	lbPath := gnmi.OC().Interface(lb)
+	gnmi.Replace(t, dut, lbPath.Config(), &oc.Interface{
+		Name:        ygot.String(lb),
+		Type:        oc.IETFInterfaces_InterfaceType_softwareLoopback,
+		Description: ygot.String("encoding test"),
+		Enabled:     ygot.Bool(true),
+	})
+	defer gnmi.Delete(t, dut, lbPath.Config())
+	gnmi.Await(t, dut, lbPath.Description().State(), time.Minute, "encoding test")
+
+	subtrees := []struct {
+		desc string
+		path func(t *testing.T) string
+	}{{
+		desc: "Interface",
+		path: func(*testing.T) string { return fmt.Sprintf("/interfaces/interface[name=%s]/state", lb) },
+	}, {
+		desc: "System",
+		path: func(*testing.T) string { return "/system/state" },
+	}, {
+		desc: "Transceiver",
+		path: func(t *testing.T) string {
+			name := firstComponent(t, dut, oc.PlatformTypes_OPENCONFIG_HARDWARE_COMPONENT_TRANSCEIVER)
+			return fmt.Sprintf("/components/component[name=%s]/transceiver", name)
+		},
+	}, {
+		desc: "PowerSupply",
+		path: func(t *testing.T) string {
+			name := firstComponent(t, dut, oc.PlatformTypes_OPENCONFIG_HARDWARE_COMPONENT_POWER_SUPPLY)
+			return fmt.Sprintf("/components/component[name=%s]/power-supply/state", name)
+		},
+	}}
+
+	fetches := []struct {
+		rpc   string
+		fetch func(context.Context, gpb.GNMIClient, *subscribe.ConsistencySpec, gpb.Encoding) (map[string]*gpb.TypedValue, error)
+	}{
+		{rpc: "Get", fetch: subscribe.GetLeaves},
+		{rpc: "Subscribe", fetch: subscribe.SubscribeLeaves},
+	}
+
+	c := dut.RawAPIs().GNMI(t)
+	for _, st := range subtrees {
+		t.Run(st.desc, func(t *testing.T) {
+			p := st.path(t)
+			gp, err := ygot.StringToStructuredPath(p)
+			if err != nil {
+				t.Fatalf("Invalid path %q: %v", p, err)
+			}
+			spec := &subscribe.ConsistencySpec{Path: gp, NewSchema: oc.Schema, StrictEncoding: true}
+			for _, f := range fetches {
+				t.Run(f.rpc, func(t *testing.T) {
+					ctx, cancel := context.WithTimeout(context.Background(), subscribe.DefaultConsistencyTimeout)
+					defer cancel()
+					protoLeaves, err := f.fetch(ctx, c, spec, gpb.Encoding_PROTO)
+					if err != nil {
+						t.Fatalf("%s of %s in PROTO encoding: %v", f.rpc, p, err)
+					}
+					jsonLeaves, err := f.fetch(ctx, c, spec, gpb.Encoding_JSON_IETF)
+					if err != nil {
+						t.Fatalf("%s of %s in JSON_IETF encoding: %v", f.rpc, p, err)
+					}
+					t.Logf("%s of %s: %d leaves in PROTO, %d leaves in JSON_IETF encoding", f.rpc, p, len(protoLeaves), len(jsonLeaves))
+					if len(protoLeaves) == 0 || len(jsonLeaves) == 0 {
+						t.Errorf("%s of %s got no leaves", f.rpc, p)
+					}
+					compare(t, protoLeaves, jsonLeaves)
+				})
+			}
+		})
+	}
+}
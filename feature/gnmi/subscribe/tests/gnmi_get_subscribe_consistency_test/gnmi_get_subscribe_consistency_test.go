@@ -0,0 +1,43 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnmi_get_subscribe_consistency_test
+
+import (
+	"testing"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/subscribe"
+	"github.com/openconfig/ondatra"
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+func TestGetSubscribeConsistency(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	for _, p := range []string{
+		"/interfaces",
+		"/components",
+		"/network-instances",
+	} {
+		t.Run(p, func(t *testing.T) {
+			res := subscribe.GetSubscribeConsistency(t, dut, p)
+			if res.GetLeaves == 0 {
+				t.Errorf("gNMI Get of %s returned no leaves", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnmi_heartbeat_test
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygot/ygot"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	sampleInterval    = flag.Duration("sample_interval", time.Second, "sample interval of the subscription")
+	heartbeatInterval = flag.Duration("heartbeat_interval", 10*time.Second, "heartbeat interval of the subscription")
+	heartbeats        = flag.Int("heartbeats", 3, "number of heartbeats observed while the leaf is stable")
+	tolerance         = flag.Duration("tolerance", 2*time.Second, "allowed deviation of the timing of updates")
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// update is an update of the subscribed leaf.
+type update struct {
+	received time.Time
+	val      string
+}
+
+// subscribe subscribes in SAMPLE mode with suppress_redundant and
+// heartbeat_interval to path, and returns a channel of the updates received
+// after the initial sync.
+func subscribe(ctx context.Context, t *testing.T, dut *ondatra.DUTDevice, path *gpb.Path) <-chan update {
+	t.Helper()
+	stream, err := dut.RawAPIs().GNMI(t).Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("gNMI Subscribe: %v", err)
+	}
+	sl := &gpb.SubscriptionList{
+		Mode:     gpb.SubscriptionList_STREAM,
+		Encoding: gpb.Encoding_PROTO,
+		Subscription: []*gpb.Subscription{{
+			Path:              path,
+			Mode:              gpb.SubscriptionMode_SAMPLE,
+			SampleInterval:    uint64(sampleInterval.Nanoseconds()),
+			SuppressRedundant: true,
+			HeartbeatInterval: uint64(heartbeatInterval.Nanoseconds()),
+		}},
+	}
+	if err := stream.Send(&gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: sl}}); err != nil {
+		t.Fatalf("gNMI Subscribe send: %v", err)
+	}
+
+	synced := make(chan struct{})
+	updates := make(chan update, 100)
+	go func() {
+		defer close(updates)
+		isSynced := false
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			if resp.GetSyncResponse() {
+				isSynced = true
+				close(synced)
+				continue
+			}
+			if !isSynced {
+				continue
+			}
+			for _, u := range resp.GetUpdate().GetUpdate() {
+				select {
+				case updates <- update{received: time.Now(), val: u.GetVal().GetStringVal()}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	select {
+	case <-synced:
+	case <-time.After(time.Minute):
+		t.Fatal("No sync response within 1m")
+	}
+	return updates
+}
+
+// collect returns the updates received within d.
+func collect(t *testing.T, updates <-chan update, d time.Duration) []update {
+	t.Helper()
+	var got []update
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				t.Fatal("Subscription ended")
+			}
+			got = append(got, u)
+		case <-timer.C:
+			return got
+		}
+	}
+}
+
+func TestSuppressRedundantHeartbeat(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	name := netutil.LoopbackInterface(t, dut, 11)
+	path := gnmi.OC().Interface(name)
+	gnmi.Replace(t, dut, path.Config(), &oc.Interface{
+		Name:        ygot.String(name),
+		Type:        oc.IETFInterfaces_InterfaceType_softwareLoopback,
+		Description: ygot.String("heartbeat before"),
+	})
+	defer gnmi.Delete(t, dut, path.Config())
+	gnmi.Await(t, dut, path.Description().State(), time.Minute, "heartbeat before")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := subscribe(ctx, t, dut, &gpb.Path{Elem: []*gpb.PathElem{
+		{Name: "interfaces"},
+		{Name: "interface", Key: map[string]string{"name": name}},
+		{Name: "state"}, {Name: "description"},
+	}})
+	start := time.Now()
+
+	t.Run("Heartbeats", func(t *testing.T) {
+		window := time.Duration(*heartbeats)*(*heartbeatInterval) + *tolerance
+		got := collect(t, updates, window)
+		t.Logf("Received %d updates of the stable leaf in %v", len(got), window)
+		if len(got) < *heartbeats-1 || len(got) > *heartbeats+1 {
+			t.Errorf("Got %d updates of the stable leaf in %v, want about %d heartbeats", len(got), window, *heartbeats)
+		}
+		prev := start
+		for i, u := range got {
+			if u.val != "heartbeat before" {
+				t.Errorf("Update %d: got value %q, want %q", i, u.val, "heartbeat before")
+			}
+			// The first heartbeat may come early, since the heartbeat timer may
+			// have started before the sync response.
+			if d := u.received.Sub(prev); i > 0 && d < *heartbeatInterval-*tolerance {
+				t.Errorf("Update %d came %v after the previous one, want about the heartbeat interval %v", i, d, *heartbeatInterval)
+			}
+			prev = u.received
+		}
+	})
+
+	t.Run("Change", func(t *testing.T) {
+		changed := time.Now()
+		gnmi.Replace(t, dut, path.Description().Config(), "heartbeat after")
+		// The update is due at the next sample, well before the next heartbeat.
+		deadline := time.NewTimer(*sampleInterval + *tolerance)
+		defer deadline.Stop()
+		for {
+			select {
+			case u, ok := <-updates:
+				if !ok {
+					t.Fatal("Subscription ended")
+				}
+				if u.val != "heartbeat after" {
+					continue
+				}
+				t.Logf("Update of the changed leaf received %v after the change", u.received.Sub(changed))
+				return
+			case <-deadline.C:
+				t.Fatalf("No update of the changed leaf within %v of the change", *sampleInterval+*tolerance)
+			}
+		}
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnmi_onchange_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/components"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/subscribe"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+const (
+	dutAS        = 64500
+	peerAS       = 64501
+	routerID     = "192.0.2.1"
+	neighborIP   = "192.0.2.2"
+	powerTimeout = 10 * time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+func TestInterfaceOnChange(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	name := netutil.LoopbackInterface(t, dut, 10)
+	path := gnmi.OC().Interface(name)
+	i := &oc.Interface{
+		Name:        ygot.String(name),
+		Type:        oc.IETFInterfaces_InterfaceType_softwareLoopback,
+		Description: ygot.String("on-change before"),
+		Enabled:     ygot.Bool(true),
+	}
+	gnmi.Replace(t, dut, path.Config(), i)
+	defer gnmi.Delete(t, dut, path.Config())
+	gnmi.Await(t, dut, path.AdminStatus().State(), time.Minute, oc.Interface_AdminStatus_UP)
+
+	subscribe.OnChange(t, dut, &subscribe.Spec{
+		Changing: []ygnmi.UntypedQuery{
+			path.Description().State(),
+			path.AdminStatus().State(),
+		},
+		Stable: []ygnmi.UntypedQuery{
+			path.Type().State(),
+			path.Name().State(),
+		},
+		Stimulus: func() error {
+			i.Description = ygot.String("on-change after")
+			i.Enabled = ygot.Bool(false)
+			gnmi.Update(t, dut, path.Config(), i)
+			return nil
+		},
+	})
+}
+
+func TestComponentOnChange(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	fabrics := components.FindComponentsByType(t, dut, oc.PlatformTypes_OPENCONFIG_HARDWARE_COMPONENT_FABRIC)
+	if len(fabrics) == 0 {
+		t.Skipf("%s has no fabric components", dut.Name())
+	}
+	name := fabrics[0]
+	path := gnmi.OC().Component(name)
+	defer func() {
+		gnmi.Replace(t, dut, path.Fabric().PowerAdminState().Config(), oc.Platform_ComponentPowerType_POWER_ENABLED)
+		gnmi.Await(t, dut, path.OperStatus().State(), powerTimeout, oc.PlatformTypes_COMPONENT_OPER_STATUS_ACTIVE)
+	}()
+
+	subscribe.OnChange(t, dut, &subscribe.Spec{
+		Changing: []ygnmi.UntypedQuery{
+			path.Fabric().PowerAdminState().State(),
+			path.OperStatus().State(),
+		},
+		Stable: []ygnmi.UntypedQuery{
+			path.SerialNo().State(),
+			path.PartNo().State(),
+		},
+		Stimulus: func() error {
+			gnmi.Replace(t, dut, path.Fabric().PowerAdminState().Config(), oc.Platform_ComponentPowerType_POWER_DISABLED)
+			return nil
+		},
+		Timeout: powerTimeout,
+	})
+}
+
+func TestBGPOnChange(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	fptest.ConfigureDefaultNetworkInstance(t, dut)
+	path := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, "BGP")
+
+	proto := &oc.NetworkInstance_Protocol{
+		Identifier: oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP,
+		Name:       ygot.String("BGP"),
+	}
+	bgp := proto.GetOrCreateBgp()
+	global := bgp.GetOrCreateGlobal()
+	global.As = ygot.Uint32(dutAS)
+	global.RouterId = ygot.String(routerID)
+	global.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST).Enabled = ygot.Bool(true)
+	nbr := bgp.GetOrCreateNeighbor(neighborIP)
+	nbr.PeerAs = ygot.Uint32(peerAS)
+	nbr.Enabled = ygot.Bool(true)
+	nbr.Description = ygot.String("on-change before")
+	nbr.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST).Enabled = ygot.Bool(true)
+	gnmi.Replace(t, dut, path.Config(), proto)
+	defer gnmi.Delete(t, dut, path.Config())
+
+	nbrPath := path.Bgp().Neighbor(neighborIP)
+	gnmi.Await(t, dut, nbrPath.Enabled().State(), time.Minute, true)
+
+	subscribe.OnChange(t, dut, &subscribe.Spec{
+		Changing: []ygnmi.UntypedQuery{
+			nbrPath.Description().State(),
+			nbrPath.Enabled().State(),
+		},
+		Stable: []ygnmi.UntypedQuery{
+			path.Bgp().Global().As().State(),
+			path.Bgp().Global().RouterId().State(),
+			nbrPath.PeerAs().State(),
+		},
+		Stimulus: func() error {
+			gnmi.Update(t, dut, nbrPath.Config(), &oc.NetworkInstance_Protocol_Bgp_Neighbor{
+				NeighborAddress: ygot.String(neighborIP),
+				Description:     ygot.String("on-change after"),
+				Enabled:         ygot.Bool(false),
+			})
+			return nil
+		},
+	})
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnmi_sample_interval_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/helpers"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ygot/ygot"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	intfName = flag.String("interface", "",
+		"interface whose counters are subscribed; if empty the first interface with oper-status UP is used")
+	samples   = flag.Int("samples", 10, "number of samples collected after the initial sync for each sample interval")
+	tolerance = flag.Float64("tolerance", 0.1,
+		"allowed deviation of the 90th percentile of the spacing of samples from the sample interval, as a fraction of the interval")
+)
+
+var (
+	intervals = []time.Duration{time.Second, 10 * time.Second, 30 * time.Second}
+	// minJitterTolerance is the smallest allowed deviation, since the
+	// tolerance of short intervals is below the timestamp resolution of some
+	// DUTs.
+	minJitterTolerance = 200 * time.Millisecond
+	counters           = []string{"in-octets", "out-octets", "in-pkts", "out-pkts"}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// sample is a sample of one leaf.
+type sample struct {
+	path      string
+	timestamp time.Time // timestamp of the notification
+}
+
+// collect subscribes in SAMPLE mode with the given interval to the counters
+// of the interface and returns the samples received after the initial sync,
+// keyed by leaf.
+func collect(t *testing.T, dut *ondatra.DUTDevice, intf string, interval time.Duration, n int) map[string][]sample {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(n+3)*interval+time.Minute)
+	defer cancel()
+	stream, err := dut.RawAPIs().GNMI(t).Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("gNMI Subscribe: %v", err)
+	}
+	sl := &gpb.SubscriptionList{Mode: gpb.SubscriptionList_STREAM, Encoding: gpb.Encoding_PROTO}
+	for _, c := range counters {
+		sl.Subscription = append(sl.Subscription, &gpb.Subscription{
+			Path: &gpb.Path{Elem: []*gpb.PathElem{
+				{Name: "interfaces"},
+				{Name: "interface", Key: map[string]string{"name": intf}},
+				{Name: "state"}, {Name: "counters"}, {Name: c},
+			}},
+			Mode:           gpb.SubscriptionMode_SAMPLE,
+			SampleInterval: uint64(interval.Nanoseconds()),
+		})
+	}
+	if err := stream.Send(&gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: sl}}); err != nil {
+		t.Fatalf("gNMI Subscribe send: %v", err)
+	}
+
+	synced := false
+	got := map[string][]sample{}
+	done := func() bool {
+		for _, c := range counters {
+			if len(got[c]) < n {
+				return false
+			}
+		}
+		return true
+	}
+	for !done() {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("gNMI Subscribe receive after %d samples: %v", len(got[counters[0]]), err)
+		}
+		if resp.GetSyncResponse() {
+			synced = true
+			continue
+		}
+		if !synced {
+			continue
+		}
+		notif := resp.GetUpdate()
+		for _, u := range notif.GetUpdate() {
+			elems := append(append([]*gpb.PathElem{}, notif.GetPrefix().GetElem()...), u.GetPath().GetElem()...)
+			if len(elems) == 0 {
+				continue
+			}
+			leaf := elems[len(elems)-1].GetName()
+			p, err := ygot.PathToString(&gpb.Path{Elem: elems})
+			if err != nil {
+				p = leaf
+			}
+			got[leaf] = append(got[leaf], sample{path: p, timestamp: time.Unix(0, notif.GetTimestamp())})
+		}
+	}
+	return got
+}
+
+// percentile returns the p-th percentile of sorted values.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// jitter returns the deviations of the spacing of consecutive timestamps
+// from interval, sorted.
+func jitter(deltas []time.Duration, interval time.Duration) []time.Duration {
+	var js []time.Duration
+	for _, d := range deltas {
+		j := d - interval
+		if j < 0 {
+			j = -j
+		}
+		js = append(js, j)
+	}
+	sort.Slice(js, func(i, j int) bool { return js[i] < js[j] })
+	return js
+}
+
+func TestSampleInterval(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	intf := *intfName
+	if intf == "" {
+		up := helpers.FetchOperStatusUPIntfs(t, dut, false)
+		if len(up) == 0 {
+			t.Fatalf("No interface of %s is UP", dut.Name())
+		}
+		sort.Strings(up)
+		intf = up[0]
+	}
+	t.Logf("Subscribing to the counters of %s", intf)
+
+	var report strings.Builder
+	fmt.Fprintln(&report, "interval,leaf,samples,p50_jitter,p90_jitter,p99_jitter,max_jitter,mean_spacing")
+	for _, interval := range intervals {
+		t.Run(interval.String(), func(t *testing.T) {
+			allowed := time.Duration(*tolerance * float64(interval))
+			if allowed < minJitterTolerance {
+				allowed = minJitterTolerance
+			}
+			got := collect(t, dut, intf, interval, *samples)
+			for _, leaf := range counters {
+				ss := got[leaf]
+				var deltas []time.Duration
+				var total time.Duration
+				for i := 1; i < len(ss); i++ {
+					d := ss[i].timestamp.Sub(ss[i-1].timestamp)
+					if d <= 0 {
+						t.Errorf("%s: timestamp %v of sample %d is not after timestamp %v of the previous sample", ss[i].path, ss[i].timestamp, i, ss[i-1].timestamp)
+					}
+					if d < interval/2 {
+						t.Errorf("%s: samples %d and %d are %v apart, want about %v", ss[i].path, i-1, i, d, interval)
+					}
+					deltas = append(deltas, d)
+					total += d
+				}
+				if len(deltas) == 0 {
+					t.Errorf("%s: got %d samples, want at least 2", leaf, len(ss))
+					continue
+				}
+				js := jitter(deltas, interval)
+				p50, p90, p99, max := percentile(js, 50), percentile(js, 90), percentile(js, 99), js[len(js)-1]
+				mean := total / time.Duration(len(deltas))
+				t.Logf("%s: mean spacing %v, jitter p50 %v, p90 %v, p99 %v, max %v", leaf, mean, p50, p90, p99, max)
+				fmt.Fprintf(&report, "%v,%s,%d,%v,%v,%v,%v,%v\n", interval, leaf, len(ss), p50, p90, p99, max, mean)
+				if p90 > allowed {
+					t.Errorf("%s: 90th percentile of the jitter of the sample spacing is %v, want <= %v", leaf, p90, allowed)
+				}
+			}
+		})
+	}
+
+	if _, err := fptest.WriteOutput("sample_interval_jitter", ".csv", report.String()); err != nil {
+		t.Errorf("Could not write the jitter report: %v", err)
+	}
+}
@@ -0,0 +1,447 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cert_rotation_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/security/pki"
+	"github.com/openconfig/ondatra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	cmpb "github.com/openconfig/gnoi/cert"
+	certzpb "github.com/openconfig/gnsi/certz"
+	gribipb "github.com/openconfig/gribi/v1/proto/service"
+)
+
+var (
+	certID = flag.String("cert_id", "",
+		"certificate id used by the gRPC server of the DUT; if empty the first id returned by GetCertificates is used")
+	serverName = flag.String("server_name", "featureprofiles-dut",
+		"name included in the subject alternative names of the generated server certificates and used to verify them")
+	clientCert = flag.String("client_cert", "", "optional PEM client certificate presented when the DUT requires mutual TLS")
+	clientKey  = flag.String("client_key", "", "optional PEM client key presented when the DUT requires mutual TLS")
+	// The private key of the server certificate cannot be read from the DUT,
+	// so it must be provided for TestRotate to put the certificate back.
+	originalCert = flag.String("original_cert", "",
+		"PEM file of the server certificate of the DUT, which TestRotate restores when it completes; TestRotate is skipped unless -original_cert, -original_key and -original_ca are set")
+	originalKey = flag.String("original_key", "", "PEM file of the private key of -original_cert")
+	originalCA  = flag.String("original_ca", "", "PEM file of the CA certificate of -original_cert")
+)
+
+const (
+	installCertID = "featureprofiles-cert-install"
+	rpcTimeout    = time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// serverPKI is a certificate authority together with a server certificate it
+// issued, as loaded onto the DUT.
+type serverPKI struct {
+	caCert  *x509.Certificate
+	caPEM   []byte
+	certPEM []byte
+	keyPEM  []byte
+	pubPEM  []byte
+}
+
+// newPKI generates a self-signed CA and a server certificate signed by it.
+func newPKI(t *testing.T, name string) *serverPKI {
+	t.Helper()
+	ca := pki.NewCA(t, name+" CA", x509.ECDSA)
+	server := ca.Issue(t, pki.Spec{
+		CommonName:  *serverName,
+		DNSNames:    []string{*serverName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	return &serverPKI{
+		caCert:  ca.Cert,
+		caPEM:   pki.CertPEM(ca.Cert),
+		certPEM: pki.CertPEM(server.Leaf),
+		keyPEM:  pki.KeyPEM(t, server.PrivateKey),
+		pubPEM:  pki.PublicKeyPEM(t, server.PrivateKey.(crypto.Signer)),
+	}
+}
+
+// loadPKI loads the server certificate, its private key and its CA from the
+// PEM files certFile, keyFile and caFile.
+func loadPKI(t *testing.T, certFile, keyFile, caFile string) (*serverPKI, error) {
+	t.Helper()
+	p := &serverPKI{}
+	for _, f := range []struct {
+		name string
+		pem  *[]byte
+	}{{certFile, &p.certPEM}, {keyFile, &p.keyPEM}, {caFile, &p.caPEM}} {
+		b, err := os.ReadFile(f.name)
+		if err != nil {
+			return nil, err
+		}
+		*f.pem = b
+	}
+	pair, err := tls.X509KeyPair(p.certPEM, p.keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key pair %q and %q: %w", certFile, keyFile, err)
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("private key %q of type %T cannot sign", keyFile, pair.PrivateKey)
+	}
+	p.pubPEM = pki.PublicKeyPEM(t, signer)
+	block, _ := pem.Decode(p.caPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %q", caFile)
+	}
+	if p.caCert, err = x509.ParseCertificate(block.Bytes); err != nil {
+		return nil, fmt.Errorf("invalid CA certificate %q: %w", caFile, err)
+	}
+	return p, nil
+}
+
+// loadRequest returns a LoadCertificateRequest installing the server
+// certificate of p under the given certificate id.
+func (p *serverPKI) loadRequest(id string) *cmpb.LoadCertificateRequest {
+	return &cmpb.LoadCertificateRequest{
+		CertificateId: id,
+		Certificate:   &cmpb.Certificate{Type: cmpb.CertificateType_CT_X509, Certificate: p.certPEM},
+		KeyPair:       &cmpb.KeyPair{PrivateKey: p.keyPEM, PublicKey: p.pubPEM},
+		CaCertificates: []*cmpb.Certificate{{
+			Type:        cmpb.CertificateType_CT_X509,
+			Certificate: p.caPEM,
+		}},
+	}
+}
+
+// dialOpts returns dial options which only trust server certificates issued
+// by the CA of p.
+func (p *serverPKI) dialOpts(t *testing.T) []grpc.DialOption {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(p.caCert)
+	tlsConf := &tls.Config{RootCAs: roots, ServerName: *serverName}
+	if *clientCert != "" {
+		c, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
+		if err != nil {
+			t.Fatalf("Could not load client key pair: %v", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{c}
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConf))}
+}
+
+// gnmiGet issues a gNMI Get of /system/state/current-datetime.
+func gnmiGet(ctx context.Context, c gpb.GNMIClient) error {
+	_, err := c.Get(ctx, &gpb.GetRequest{
+		Path: []*gpb.Path{{Elem: []*gpb.PathElem{
+			{Name: "system"}, {Name: "state"}, {Name: "current-datetime"},
+		}}},
+		Type:     gpb.GetRequest_STATE,
+		Encoding: gpb.Encoding_JSON_IETF,
+	})
+	return err
+}
+
+// gribiGet issues a gRIBI Get of all entries in the default network instance.
+func gribiGet(ctx context.Context, c gribipb.GRIBIClient, ni string) error {
+	stream, err := c.Get(ctx, &gribipb.GetRequest{
+		NetworkInstance: &gribipb.GetRequest_Name{Name: ni},
+		Aft:             gribipb.AFTType_ALL,
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// verifyNewConnection checks that a new gNMI connection trusting only the CA
+// of p succeeds.
+func verifyNewConnection(t *testing.T, dut *ondatra.DUTDevice, p *serverPKI) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	c, err := dut.RawAPIs().BindingDUT().DialGNMI(ctx, p.dialOpts(t)...)
+	if err != nil {
+		t.Fatalf("Could not dial gNMI trusting %q: %v", p.caCert.Subject.CommonName, err)
+	}
+	if err := gnmiGet(ctx, c); err != nil {
+		t.Errorf("gNMI Get trusting %q failed: %v", p.caCert.Subject.CommonName, err)
+	}
+}
+
+// verifyBindingConnection checks that a new gNMI connection dialed with the
+// options of the binding succeeds.
+func verifyBindingConnection(t *testing.T, dut *ondatra.DUTDevice) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	c, err := dut.RawAPIs().BindingDUT().DialGNMI(ctx)
+	if err != nil {
+		return fmt.Errorf("could not dial gNMI with the binding: %w", err)
+	}
+	if err := gnmiGet(ctx, c); err != nil {
+		return fmt.Errorf("gNMI Get with the binding failed: %w", err)
+	}
+	return nil
+}
+
+// verifyRejected checks that a gNMI connection trusting only the CA of p is
+// rejected.
+func verifyRejected(t *testing.T, dut *ondatra.DUTDevice, p *serverPKI) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	c, err := dut.RawAPIs().BindingDUT().DialGNMI(ctx, p.dialOpts(t)...)
+	if err != nil {
+		t.Logf("Dial of gNMI trusting %q failed as expected: %v", p.caCert.Subject.CommonName, err)
+		return
+	}
+	err = gnmiGet(ctx, c)
+	if got := status.Code(err); got != codes.Unavailable {
+		t.Errorf("gNMI Get trusting %q: got code %v (%v), want %v", p.caCert.Subject.CommonName, got, err, codes.Unavailable)
+	}
+}
+
+// sessions holds gNMI and gRIBI connections established before a rotation,
+// which are expected to survive it.
+type sessions struct {
+	gnmi  gpb.GNMIClient
+	gribi gribipb.GRIBIClient
+}
+
+func openSessions(t *testing.T, dut *ondatra.DUTDevice) *sessions {
+	t.Helper()
+	ctx := context.Background()
+	gnmiC, err := dut.RawAPIs().BindingDUT().DialGNMI(ctx)
+	if err != nil {
+		t.Fatalf("Could not dial gNMI: %v", err)
+	}
+	gribiC, err := dut.RawAPIs().BindingDUT().DialGRIBI(ctx)
+	if err != nil {
+		t.Fatalf("Could not dial gRIBI: %v", err)
+	}
+	return &sessions{gnmi: gnmiC, gribi: gribiC}
+}
+
+func (s *sessions) verify(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	if err := gnmiGet(ctx, s.gnmi); err != nil {
+		t.Errorf("gNMI Get on connection established before rotation failed: %v", err)
+	}
+	if err := gribiGet(ctx, s.gribi, deviations.DefaultNetworkInstance(dut)); err != nil {
+		t.Errorf("gRIBI Get on connection established before rotation failed: %v", err)
+	}
+}
+
+// serverCertID returns the certificate id of the gRPC server of the DUT.
+func serverCertID(t *testing.T, c cmpb.CertificateManagementClient) string {
+	t.Helper()
+	if *certID != "" {
+		return *certID
+	}
+	resp, err := c.GetCertificates(context.Background(), &cmpb.GetCertificatesRequest{})
+	if err != nil {
+		t.Fatalf("GetCertificates failed: %v", err)
+	}
+	if len(resp.GetCertificateInfo()) == 0 {
+		t.Fatal("GetCertificates returned no certificates, set -cert_id")
+	}
+	return resp.GetCertificateInfo()[0].GetCertificateId()
+}
+
+// rotate rotates the certificate with the given id to the one of p. Before
+// finalizing, it verifies that new connections validate against the new CA
+// and that the connections in s survive.
+func rotate(t *testing.T, dut *ondatra.DUTDevice, c cmpb.CertificateManagementClient, id string, p *serverPKI, s *sessions) {
+	t.Helper()
+	if err := rotateCert(c, id, p, func() {
+		verifyNewConnection(t, dut, p)
+		s.verify(t, dut)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rotateCert rotates the certificate with the given id to the one of p, and
+// calls beforeFinalize, if not nil, before finalizing the rotation.
+func rotateCert(c cmpb.CertificateManagementClient, id string, p *serverPKI, beforeFinalize func()) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := c.Rotate(ctx)
+	if err != nil {
+		return fmt.Errorf("Rotate failed: %w", err)
+	}
+	if err := stream.Send(&cmpb.RotateCertificateRequest{
+		RotateRequest: &cmpb.RotateCertificateRequest_LoadCertificate{LoadCertificate: p.loadRequest(id)},
+	}); err != nil {
+		return fmt.Errorf("Rotate LoadCertificate send failed: %w", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("Rotate LoadCertificate failed: %w", err)
+	}
+	if resp.GetLoadCertificate() == nil {
+		return fmt.Errorf("Rotate LoadCertificate: got response %v, want LoadCertificateResponse", resp)
+	}
+
+	if beforeFinalize != nil {
+		beforeFinalize()
+	}
+
+	if err := stream.Send(&cmpb.RotateCertificateRequest{
+		RotateRequest: &cmpb.RotateCertificateRequest_FinalizeRotation{FinalizeRotation: &cmpb.FinalizeRequest{}},
+	}); err != nil {
+		return fmt.Errorf("Rotate FinalizeRotation send failed: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return fmt.Errorf("Rotate CloseSend failed: %w", err)
+	}
+	if _, err := stream.Recv(); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("Rotate FinalizeRotation failed: %w", err)
+	}
+	return nil
+}
+
+// TestInstall verifies that a certificate can be installed under a new
+// certificate id and is then reported by GetCertificates.
+func TestInstall(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	c := dut.RawAPIs().GNOI(t).CertificateManagement()
+	p := newPKI(t, "install")
+
+	stream, err := c.Install(context.Background())
+	if err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	if err := stream.Send(&cmpb.InstallCertificateRequest{
+		InstallRequest: &cmpb.InstallCertificateRequest_LoadCertificate{LoadCertificate: p.loadRequest(installCertID)},
+	}); err != nil {
+		t.Fatalf("Install LoadCertificate send failed: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Install LoadCertificate failed: %v", err)
+	}
+	if resp.GetLoadCertificate() == nil {
+		t.Fatalf("Install LoadCertificate: got response %v, want LoadCertificateResponse", resp)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("Install CloseSend failed: %v", err)
+	}
+	defer func() {
+		if _, err := c.RevokeCertificates(context.Background(), &cmpb.RevokeCertificatesRequest{CertificateId: []string{installCertID}}); err != nil {
+			t.Errorf("RevokeCertificates(%q) failed: %v", installCertID, err)
+		}
+	}()
+
+	certs, err := c.GetCertificates(context.Background(), &cmpb.GetCertificatesRequest{})
+	if err != nil {
+		t.Fatalf("GetCertificates failed: %v", err)
+	}
+	for _, info := range certs.GetCertificateInfo() {
+		if info.GetCertificateId() == installCertID {
+			return
+		}
+	}
+	t.Errorf("GetCertificates: certificate id %q not found in %v", installCertID, certs)
+}
+
+// TestRotate rotates the server certificate of the DUT twice and verifies
+// that gNMI and gRIBI connections survive each rotation, and that connections
+// trusting only the CA of the first certificate are rejected once the second
+// rotation is finalized. The original certificate of -original_cert is
+// rotated back at the end.
+func TestRotate(t *testing.T) {
+	if *originalCert == "" || *originalKey == "" || *originalCA == "" {
+		t.Skip("Rotating the server certificate requires -original_cert, -original_key and -original_ca to restore it")
+	}
+	original, err := loadPKI(t, *originalCert, *originalKey, *originalCA)
+	if err != nil {
+		t.Fatalf("Could not load the original server certificate: %v", err)
+	}
+	dut := ondatra.DUT(t, "dut")
+	c := dut.RawAPIs().GNOI(t).CertificateManagement()
+	id := serverCertID(t, c)
+	s := openSessions(t, dut)
+	t.Cleanup(func() {
+		if err := rotateCert(c, id, original, nil); err != nil {
+			t.Errorf("Could not restore the original server certificate %q: %v", id, err)
+			return
+		}
+		if err := verifyBindingConnection(t, dut); err != nil {
+			t.Errorf("After restoring the original server certificate %q: %v", id, err)
+		}
+	})
+
+	first := newPKI(t, "first")
+	second := newPKI(t, "second")
+
+	t.Run("Rotate to first certificate", func(t *testing.T) {
+		rotate(t, dut, c, id, first, s)
+		s.verify(t, dut)
+		verifyNewConnection(t, dut, first)
+	})
+	t.Run("Rotate to second certificate", func(t *testing.T) {
+		rotate(t, dut, c, id, second, s)
+		s.verify(t, dut)
+		verifyNewConnection(t, dut, second)
+	})
+	t.Run("Old certificate rejected", func(t *testing.T) {
+		verifyRejected(t, dut, first)
+	})
+	t.Run("Certz coexistence", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		defer cancel()
+		gnsiC, err := dut.RawAPIs().BindingDUT().DialGNSI(ctx, second.dialOpts(t)...)
+		if err != nil {
+			t.Fatalf("Could not dial gNSI: %v", err)
+		}
+		resp, err := gnsiC.Certz().GetProfileList(ctx, &certzpb.GetProfileListRequest{})
+		if status.Code(err) == codes.Unimplemented {
+			t.Skipf("gNSI Certz is not supported: %v", err)
+		}
+		if err != nil {
+			t.Fatalf("Certz GetProfileList after gNOI rotation failed: %v", err)
+		}
+		t.Logf("Certz profiles after gNOI rotation: %v", resp.GetSslProfileIds())
+	})
+}
@@ -2,6 +2,7 @@ package factoryreset
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"path"
 	"strings"
@@ -23,7 +24,12 @@ var (
 	fileCreate        = "bash fallocate -l %dM %s"
 )
 
-const maxRebootTime = 40 // 40 mins wait time for the factory reset and sztp to kick in
+var factoryResetTimeout = flag.Duration("factory_reset_timeout", 40*time.Minute, "time allowed for the factory reset and sztp to kick in and for the DUT to come back up")
+
+// resetMarker is configured before a factory reset and must be gone
+// afterwards, showing that the DUT came back with its baseline config.
+const resetMarker = "featureprofiles factory reset marker"
+
 func TestMain(m *testing.M) {
 	fptest.RunTests(m)
 }
@@ -93,8 +99,8 @@ func deviceBootStatus(t *testing.T, dut *ondatra.DUTDevice) {
 			break
 		}
 
-		if uint64(time.Since(startReboot).Minutes()) > maxRebootTime {
-			t.Fatalf("Check boot time: got %v, want < %v", time.Since(startReboot), maxRebootTime)
+		if time.Since(startReboot) > *factoryResetTimeout {
+			t.Fatalf("Check boot time: got %v, want < %v", time.Since(startReboot), *factoryResetTimeout)
 		}
 	}
 	t.Logf("Device boot time: %.2f minutes", time.Since(startReboot).Minutes())
@@ -167,3 +173,98 @@ func TestFactoryReset(t *testing.T) {
 		factoryReset(t, dut, enCiscoCommands.DevicePaths)
 	}
 }
+
+// startFactoryReset sends FactoryReset.Start with the given options and skips
+// the test if the DUT reports that an option is not supported.
+func startFactoryReset(t *testing.T, dut *ondatra.DUTDevice, req *frpb.StartRequest) {
+	t.Helper()
+	gnoiClient, err := dut.RawAPIs().BindingDUT().DialGNOI(context.Background())
+	if err != nil {
+		t.Fatalf("Error dialing gNOI: %v", err)
+	}
+	resp, err := gnoiClient.FactoryReset().Start(context.Background(), req)
+	if err != nil {
+		// The DUT may drop the connection before replying once the reset starts.
+		t.Logf("FactoryReset.Start(%v) returned error, assuming the reset is in progress: %v", req, err)
+		return
+	}
+	t.Logf("FactoryReset.Start(%v) response: %v", req, resp)
+	if resetErr := resp.GetResetError(); resetErr != nil {
+		switch {
+		case resetErr.GetFactoryOsUnsupported():
+			t.Skipf("DUT %s does not support factory_os: %v", dut.Name(), resetErr)
+		case resetErr.GetZeroFillUnsupported():
+			t.Skipf("DUT %s does not support zero_fill: %v", dut.Name(), resetErr)
+		default:
+			t.Fatalf("FactoryReset.Start(%v) failed: %v", req, resetErr)
+		}
+	}
+}
+
+// reprovision pushes configuration to the DUT using the credentials of the
+// binding, which are the bootstrap credentials after a factory reset.
+func reprovision(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	banner := gnmi.OC().System().LoginBanner()
+	gnmi.Replace(t, dut, banner.Config(), resetMarker)
+	if got := gnmi.Get(t, dut, banner.State()); got != resetMarker {
+		t.Errorf("Login banner after re-provisioning: got %q, want %q", got, resetMarker)
+	}
+	gnmi.Delete(t, dut, banner.Config())
+}
+
+// TestFactoryResetOptions performs a factory reset with each combination of
+// the zero_fill and factory_os options and verifies that the DUT comes back
+// with its baseline configuration, that the running OS is retained unless
+// factory_os is set, and that the DUT can be re-provisioned afterwards.
+func TestFactoryResetOptions(t *testing.T) {
+	cases := []struct {
+		desc string
+		req  *frpb.StartRequest
+	}{{
+		desc: "ZeroFill with OS retention",
+		req:  &frpb.StartRequest{ZeroFill: true},
+	}, {
+		desc: "Factory OS",
+		req:  &frpb.StartRequest{FactoryOs: true},
+	}, {
+		desc: "ZeroFill with Factory OS",
+		req:  &frpb.StartRequest{ZeroFill: true, FactoryOs: true},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			dut := ondatra.DUT(t, "dut")
+			version := gnmi.Get(t, dut, gnmi.OC().System().SoftwareVersion().State())
+			t.Logf("DUT %s running software version %q before factory reset", dut.Name(), version)
+			banner := gnmi.OC().System().LoginBanner()
+			gnmi.Replace(t, dut, banner.Config(), resetMarker)
+			// The marker is left configured if the reset is skipped or fails.
+			t.Cleanup(func() {
+				if got, ok := gnmi.Lookup(t, dut, banner.State()).Val(); ok && got == resetMarker {
+					gnmi.Delete(t, dut, banner.Config())
+				}
+			})
+
+			startFactoryReset(t, dut, tc.req)
+			fptest.WaitForGNMIReachable(t, dut, *factoryResetTimeout)
+
+			t.Run("Baseline state", func(t *testing.T) {
+				if got, ok := gnmi.Lookup(t, dut, banner.State()).Val(); ok && got == resetMarker {
+					t.Errorf("Login banner after factory reset: got %q, want it removed", got)
+				}
+			})
+			t.Run("OS version", func(t *testing.T) {
+				got := gnmi.Get(t, dut, gnmi.OC().System().SoftwareVersion().State())
+				switch {
+				case !tc.req.GetFactoryOs() && got != version:
+					t.Errorf("Software version after factory reset with OS retention: got %q, want %q", got, version)
+				case tc.req.GetFactoryOs():
+					t.Logf("Software version after factory reset to factory OS: %q (was %q)", got, version)
+				}
+			})
+			t.Run("Re-provision", func(t *testing.T) {
+				reprovision(t, dut)
+			})
+		})
+	}
+}
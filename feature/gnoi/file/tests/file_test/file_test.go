@@ -0,0 +1,340 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"testing"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+
+	cpb "github.com/openconfig/gnoi/common"
+	fpb "github.com/openconfig/gnoi/file"
+	tpb "github.com/openconfig/gnoi/types"
+)
+
+var (
+	fileDir        = flag.String("file_dir", "/tmp", "Directory on the DUT in which test files are created")
+	largeFileSize  = flag.Int("large_file_size", 64*1024*1024, "Size in bytes of the file used for the large file transfer test")
+	protectedPath  = flag.String("protected_path", "/proc/featureprofiles-file-test", "Path on the DUT that File.Put must not be allowed to write")
+	remotePath     = flag.String("remote_path", "", "Remote path, such as host:/path/file, that File.TransferToRemote uploads to. TransferToRemote is skipped when empty")
+	remoteProtocol = flag.String("remote_protocol", "SCP", "Protocol used by File.TransferToRemote: SFTP, HTTP, HTTPS or SCP")
+	remoteUsername = flag.String("remote_username", "", "Username for the remote server used by File.TransferToRemote")
+	remotePassword = flag.String("remote_password", "", "Password for the remote server used by File.TransferToRemote")
+)
+
+const (
+	// chunkSize is the maximum size of a single contents message.
+	chunkSize = 64 * 1024
+	// filePermissions is the octal UNIX permission of the test files.
+	filePermissions = 644
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// testContent returns size bytes of deterministic file content.
+func testContent(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+// newHash returns a hash.Hash for the given gNOI hash method.
+func newHash(m tpb.HashType_HashMethod) (hash.Hash, error) {
+	switch m {
+	case tpb.HashType_SHA256:
+		return sha256.New(), nil
+	case tpb.HashType_SHA512:
+		return sha512.New(), nil
+	case tpb.HashType_MD5:
+		return md5.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash method %v", m)
+	}
+}
+
+// sha256Hash returns the SHA256 HashType of content.
+func sha256Hash(content []byte) *tpb.HashType {
+	sum := sha256.Sum256(content)
+	return &tpb.HashType{Method: tpb.HashType_SHA256, Hash: sum[:]}
+}
+
+// putFile writes content to remoteFile on the DUT using File.Put, streaming it
+// in chunks and finishing with h.
+func putFile(ctx context.Context, fc fpb.FileClient, remoteFile string, content []byte, h *tpb.HashType) error {
+	pc, err := fc.Put(ctx)
+	if err != nil {
+		return err
+	}
+	open := &fpb.PutRequest{
+		Request: &fpb.PutRequest_Open{
+			Open: &fpb.PutRequest_Details{
+				RemoteFile:  remoteFile,
+				Permissions: filePermissions,
+			},
+		},
+	}
+	if err := pc.Send(open); err != nil {
+		return err
+	}
+	for len(content) > 0 {
+		n := min(chunkSize, len(content))
+		if err := pc.Send(&fpb.PutRequest{Request: &fpb.PutRequest_Contents{Contents: content[:n]}}); err != nil {
+			return err
+		}
+		content = content[n:]
+	}
+	if err := pc.Send(&fpb.PutRequest{Request: &fpb.PutRequest_Hash{Hash: h}}); err != nil {
+		return err
+	}
+	_, err = pc.CloseAndRecv()
+	return err
+}
+
+// getFile reads remoteFile from the DUT using File.Get and validates the
+// content against the hash sent at the end of the stream.
+func getFile(ctx context.Context, fc fpb.FileClient, remoteFile string) ([]byte, error) {
+	gc, err := fc.Get(ctx, &fpb.GetRequest{RemoteFile: remoteFile})
+	if err != nil {
+		return nil, err
+	}
+	var content []byte
+	for {
+		resp, err := gc.Recv()
+		if err == io.EOF {
+			return nil, fmt.Errorf("stream ended without a hash after %d bytes", len(content))
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch v := resp.GetResponse().(type) {
+		case *fpb.GetResponse_Contents:
+			content = append(content, v.Contents...)
+		case *fpb.GetResponse_Hash:
+			h, err := newHash(v.Hash.GetMethod())
+			if err != nil {
+				return nil, err
+			}
+			h.Write(content)
+			if got, want := h.Sum(nil), v.Hash.GetHash(); !bytes.Equal(got, want) {
+				return nil, fmt.Errorf("%v hash mismatch: got %x, want %x", v.Hash.GetMethod(), got, want)
+			}
+			return content, nil
+		default:
+			return nil, fmt.Errorf("unexpected response: got %v (%T)", v, v)
+		}
+	}
+}
+
+// statFile returns the StatInfo of remoteFile.
+func statFile(ctx context.Context, fc fpb.FileClient, remoteFile string) (*fpb.StatInfo, error) {
+	resp, err := fc.Stat(ctx, &fpb.StatRequest{Path: remoteFile})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range resp.GetStats() {
+		if s.GetPath() == remoteFile || path.Base(s.GetPath()) == path.Base(remoteFile) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("no stats for %s in %v", remoteFile, resp)
+}
+
+// removeFile removes remoteFile from the DUT, logging rather than failing on
+// error so that it can be deferred for cleanup.
+func removeFile(ctx context.Context, t *testing.T, fc fpb.FileClient, remoteFile string) {
+	t.Helper()
+	if _, err := fc.Remove(ctx, &fpb.RemoveRequest{RemoteFile: remoteFile}); err != nil {
+		t.Logf("File.Remove(%s) cleanup: %v", remoteFile, err)
+	}
+}
+
+// verifyRoundTrip writes content to remoteFile and validates it with
+// File.Stat and File.Get, then removes it and validates that it is gone.
+func verifyRoundTrip(ctx context.Context, t *testing.T, fc fpb.FileClient, remoteFile string, content []byte) {
+	t.Helper()
+	t.Logf("File.Put %d bytes to %s", len(content), remoteFile)
+	if err := putFile(ctx, fc, remoteFile, content, sha256Hash(content)); err != nil {
+		t.Fatalf("File.Put(%s) failed: %v", remoteFile, err)
+	}
+	defer removeFile(ctx, t, fc, remoteFile)
+
+	stat, err := statFile(ctx, fc, remoteFile)
+	if err != nil {
+		t.Fatalf("File.Stat(%s) failed: %v", remoteFile, err)
+	}
+	if got, want := stat.GetSize(), uint64(len(content)); got != want {
+		t.Errorf("File.Stat(%s) size: got %d, want %d", remoteFile, got, want)
+	}
+	if got, want := stat.GetPermissions(), uint32(filePermissions); got != want {
+		t.Errorf("File.Stat(%s) permissions: got %d, want %d", remoteFile, got, want)
+	}
+
+	got, err := getFile(ctx, fc, remoteFile)
+	if err != nil {
+		t.Fatalf("File.Get(%s) failed: %v", remoteFile, err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("File.Get(%s) returned %d bytes that differ from the %d bytes written", remoteFile, len(got), len(content))
+	}
+
+	if _, err := fc.Remove(ctx, &fpb.RemoveRequest{RemoteFile: remoteFile}); err != nil {
+		t.Fatalf("File.Remove(%s) failed: %v", remoteFile, err)
+	}
+	if _, err := statFile(ctx, fc, remoteFile); err == nil {
+		t.Errorf("File.Stat(%s) after File.Remove: got no error, want error", remoteFile)
+	}
+}
+
+func TestPutGetStatRemove(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	fc := dut.RawAPIs().GNOI(t).File()
+	verifyRoundTrip(context.Background(), t, fc, path.Join(*fileDir, "fp-file-test-small"), testContent(4096))
+}
+
+func TestLargeFileTransfer(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	fc := dut.RawAPIs().GNOI(t).File()
+	verifyRoundTrip(context.Background(), t, fc, path.Join(*fileDir, "fp-file-test-large"), testContent(*largeFileSize))
+}
+
+func TestTransferToRemote(t *testing.T) {
+	if *remotePath == "" {
+		t.Skip("remote_path is not set")
+	}
+	protocol, ok := cpb.RemoteDownload_Protocol_value[*remoteProtocol]
+	if !ok {
+		t.Fatalf("Invalid remote_protocol %q", *remoteProtocol)
+	}
+	ctx := context.Background()
+	dut := ondatra.DUT(t, "dut")
+	fc := dut.RawAPIs().GNOI(t).File()
+
+	localFile := path.Join(*fileDir, "fp-file-test-remote")
+	content := testContent(1024 * 1024)
+	if err := putFile(ctx, fc, localFile, content, sha256Hash(content)); err != nil {
+		t.Fatalf("File.Put(%s) failed: %v", localFile, err)
+	}
+	defer removeFile(ctx, t, fc, localFile)
+
+	req := &fpb.TransferToRemoteRequest{
+		LocalPath: localFile,
+		RemoteDownload: &cpb.RemoteDownload{
+			Path:     *remotePath,
+			Protocol: cpb.RemoteDownload_Protocol(protocol),
+			Credentials: &tpb.Credentials{
+				Username: *remoteUsername,
+				Password: &tpb.Credentials_Cleartext{Cleartext: *remotePassword},
+			},
+		},
+	}
+	t.Logf("File.TransferToRemote %s to %s", localFile, *remotePath)
+	resp, err := fc.TransferToRemote(ctx, req)
+	if err != nil {
+		t.Fatalf("File.TransferToRemote failed: %v", err)
+	}
+	h, err := newHash(resp.GetHash().GetMethod())
+	if err != nil {
+		t.Fatalf("File.TransferToRemote response hash: %v", err)
+	}
+	h.Write(content)
+	if got, want := resp.GetHash().GetHash(), h.Sum(nil); !bytes.Equal(got, want) {
+		t.Errorf("File.TransferToRemote %v hash: got %x, want %x", resp.GetHash().GetMethod(), got, want)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	ctx := context.Background()
+	dut := ondatra.DUT(t, "dut")
+	fc := dut.RawAPIs().GNOI(t).File()
+	missingFile := path.Join(*fileDir, "fp-file-test-missing")
+	badHashFile := path.Join(*fileDir, "fp-file-test-bad-hash")
+	content := testContent(4096)
+
+	cases := []struct {
+		desc string
+		op   func() error
+		// checkAbsent, if set, is a path that must not exist after op.
+		checkAbsent string
+	}{{
+		desc: "Put to protected path",
+		op: func() error {
+			return putFile(ctx, fc, *protectedPath, content, sha256Hash(content))
+		},
+		checkAbsent: *protectedPath,
+	}, {
+		desc: "Put with mismatched hash",
+		op: func() error {
+			return putFile(ctx, fc, badHashFile, content, sha256Hash(content[1:]))
+		},
+		checkAbsent: badHashFile,
+	}, {
+		desc: "Get missing file",
+		op: func() error {
+			_, err := getFile(ctx, fc, missingFile)
+			return err
+		},
+	}, {
+		desc: "Stat missing file",
+		op: func() error {
+			_, err := fc.Stat(ctx, &fpb.StatRequest{Path: missingFile})
+			return err
+		},
+	}, {
+		desc: "Remove missing file",
+		op: func() error {
+			_, err := fc.Remove(ctx, &fpb.RemoveRequest{RemoteFile: missingFile})
+			return err
+		},
+	}, {
+		desc: "Remove directory",
+		op: func() error {
+			_, err := fc.Remove(ctx, &fpb.RemoveRequest{RemoteFile: *fileDir})
+			return err
+		},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := tc.op()
+			if err == nil {
+				t.Errorf("%s: got no error, want error", tc.desc)
+			} else {
+				t.Logf("%s: got expected error: %v", tc.desc, err)
+			}
+			if tc.checkAbsent == "" {
+				return
+			}
+			if _, err := statFile(ctx, fc, tc.checkAbsent); err == nil {
+				removeFile(ctx, t, fc, tc.checkAbsent)
+				t.Errorf("File.Stat(%s): file exists after rejected Put, want absent", tc.checkAbsent)
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@
 package osinstall_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -89,6 +90,13 @@ var (
 const (
 	ipv4PrefixLen = 30
 	ipv6PrefixLen = 126
+
+	// badOSVersion is the version used for images which must not be accepted
+	// or activated by the DUT.
+	badOSVersion = "featureprofiles-bad-image"
+	// badImageSize is the number of bytes of corrupted image content sent to
+	// the DUT.
+	badImageSize = 1024 * 1024
 )
 
 type bgpAttrs struct {
@@ -422,6 +430,144 @@ func watchStatus(t *testing.T, ic ospb.OS_InstallClient, standby bool) error {
 	}
 }
 
+// TestOSInstallBadImage validates that the DUT rejects a corrupted image and
+// a request to activate a version which was never installed, and that the
+// running software version is unchanged afterwards.
+func TestOSInstallBadImage(t *testing.T) {
+	ctx := context.Background()
+	dut := ondatra.DUT(t, "dut")
+
+	tc := testCase{
+		dut: dut,
+		osc: dut.RawAPIs().GNOI(t).OS(),
+		sc:  dut.RawAPIs().GNOI(t).System(),
+	}
+	tc.fetchStandbySupervisorStatus(ctx, t)
+	wantVersion := tc.runningVersion(ctx, t)
+	t.Logf("DUT is running version %s", wantVersion)
+
+	t.Run("Install corrupted image", func(t *testing.T) {
+		tc.transferBadOS(ctx, t)
+		tc.verifyVersionUnchanged(ctx, t, wantVersion)
+	})
+
+	t.Run("Activate non-existent version", func(t *testing.T) {
+		act, err := tc.osc.Activate(ctx, &ospb.ActivateRequest{
+			Version:  badOSVersion,
+			NoReboot: true,
+		})
+		if err != nil {
+			t.Fatalf("OS.Activate request failed: %s", err)
+		}
+		actErr := act.GetActivateError()
+		if actErr == nil {
+			t.Fatalf("OS.Activate unexpected response: got %v, want ActivateError", act)
+		}
+		if got, want := actErr.GetType(), ospb.ActivateError_NON_EXISTENT_VERSION; got != want {
+			t.Errorf("OS.Activate error type: got %v, want %v", got, want)
+		}
+		tc.verifyVersionUnchanged(ctx, t, wantVersion)
+	})
+}
+
+// runningVersion returns the software version reported by OS.Verify.
+func (tc *testCase) runningVersion(ctx context.Context, t *testing.T) string {
+	t.Helper()
+	r, err := tc.osc.Verify(ctx, &ospb.VerifyRequest{})
+	if err != nil {
+		t.Fatalf("OS.Verify request failed: %v", err)
+	}
+	return r.GetVersion()
+}
+
+// transferBadOS sends an image with corrupted content to the DUT and expects
+// the transfer to fail with an InstallError.
+func (tc *testCase) transferBadOS(ctx context.Context, t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ic, err := tc.osc.Install(ctx)
+	if err != nil {
+		t.Fatalf("OS.Install client request failed: %s", err)
+	}
+	ireq := &ospb.InstallRequest{
+		Request: &ospb.InstallRequest_TransferRequest{
+			TransferRequest: &ospb.TransferRequest{
+				Version: badOSVersion,
+			},
+		},
+	}
+	if err = ic.Send(ireq); err != nil {
+		t.Fatalf("OS.Install error sending install request: %s", err)
+	}
+	iresp, err := ic.Recv()
+	if err != nil {
+		t.Fatalf("OS.Install error receiving: %s", err)
+	}
+	if _, ok := iresp.GetResponse().(*ospb.InstallResponse_TransferReady); !ok {
+		t.Fatalf("Expected TransferReady following TransferRequest: got %v (%T)", iresp.GetResponse(), iresp.GetResponse())
+	}
+
+	content := make([]byte, badImageSize)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	// Send errors are expected if the DUT aborts the transfer early. The
+	// reason is reported on the response stream.
+	if err := transferContent(ic, io.NopCloser(bytes.NewReader(content))); err != nil {
+		t.Logf("OS.Install transfer of corrupted image stopped: %v", err)
+	}
+
+	for {
+		iresp, err := ic.Recv()
+		if err == io.EOF {
+			t.Fatalf("OS.Install of corrupted image ended without InstallError")
+		}
+		if err != nil {
+			t.Fatalf("OS.Install of corrupted image ended with error: got %v, want InstallError", err)
+		}
+		switch v := iresp.GetResponse().(type) {
+		case *ospb.InstallResponse_InstallError:
+			t.Logf("OS.Install of corrupted image rejected with %v: %s", v.InstallError.GetType(), v.InstallError.GetDetail())
+			return
+		case *ospb.InstallResponse_TransferProgress:
+			t.Logf("Transfer progress: %v bytes received by DUT", v.TransferProgress.GetBytesReceived())
+		case *ospb.InstallResponse_Validated:
+			t.Fatalf("OS.Install validated corrupted image: got %v, want InstallError", v)
+		default:
+			t.Fatalf("Unexpected client install response: got %v (%T)", v, v)
+		}
+	}
+}
+
+// verifyVersionUnchanged validates that OS.Verify and, unless unsupported,
+// the software-version telemetry still report the given version and that no
+// activation failure is reported.
+func (tc *testCase) verifyVersionUnchanged(ctx context.Context, t *testing.T, want string) {
+	t.Helper()
+	r, err := tc.osc.Verify(ctx, &ospb.VerifyRequest{})
+	if err != nil {
+		t.Fatalf("OS.Verify request failed: %v", err)
+	}
+	if got := r.GetVersion(); got != want {
+		t.Errorf("OS.Verify version: got %s, want %s", got, want)
+	}
+	if got := r.GetActivationFailMessage(); got != "" {
+		t.Errorf("OS.Verify ActivationFailMessage: got %q, want empty", got)
+	}
+	if tc.dualSup {
+		if got := r.GetVerifyStandby().GetVerifyResponse().GetVersion(); got != want {
+			t.Errorf("OS.Verify standby version: got %s, want %s", got, want)
+		}
+	}
+	if !deviations.SwVersionUnsupported(tc.dut) {
+		if got := gnmi.Get(t, tc.dut, gnmi.OC().System().SoftwareVersion().State()); !strings.HasPrefix(got, want) {
+			t.Errorf("system/state/software-version: got %s, want prefix %s", got, want)
+		}
+	}
+}
+
 func TestPushAndVerifyInterfaceConfig(t *testing.T) {
 
 	dut := ondatra.DUT(t, "dut")
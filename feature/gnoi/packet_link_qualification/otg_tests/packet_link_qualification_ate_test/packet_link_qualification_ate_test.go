@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packet_link_qualification_ate_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	plqpb "github.com/openconfig/gnoi/packet_link_qualification"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// Topology:
+//   ate:port1 <--> port1:dut
+//
+// The DUT is the reflector of the link qualification and the ATE is the
+// packet generator.
+
+const (
+	packetRate = 138888
+	packetSize = 8184
+	// lossTolerance is the fraction of generated packets which may be lost
+	// around the start and the end of the qualification window.
+	lossTolerance = 0.0001
+
+	setupDuration    = 30 * time.Second
+	preSyncDuration  = 30 * time.Second
+	testDuration     = 120 * time.Second
+	postSyncDuration = 10 * time.Second
+	teardownDuration = 30 * time.Second
+
+	pollInterval = 10 * time.Second
+)
+
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice, dp *ondatra.Port) {
+	t.Helper()
+	i := &oc.Interface{
+		Name: ygot.String(dp.Name()),
+		Type: oc.IETFInterfaces_InterfaceType_ethernetCsmacd,
+	}
+	if deviations.InterfaceEnabled(dut) {
+		i.Enabled = ygot.Bool(true)
+	}
+	if !deviations.OmitL2MTU(dut) {
+		i.Mtu = ygot.Uint16(9000)
+	}
+	gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), i)
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, dp)
+	}
+}
+
+// reflectorRequest returns the request creating a FAR_END qualification on
+// the DUT port, using whichever loopback mode the DUT advertises.
+func reflectorRequest(t *testing.T, caps *plqpb.CapabilitiesResponse, id string, dp *ondatra.Port) *plqpb.CreateRequest {
+	t.Helper()
+	qc := &plqpb.QualificationConfiguration{
+		Id:            id,
+		InterfaceName: dp.Name(),
+		Timing: &plqpb.QualificationConfiguration_Rpc{
+			Rpc: &plqpb.RPCSyncedTiming{
+				SetupDuration:    durationpb.New(setupDuration),
+				PreSyncDuration:  durationpb.New(preSyncDuration),
+				Duration:         durationpb.New(testDuration),
+				PostSyncDuration: durationpb.New(postSyncDuration),
+				TeardownDuration: durationpb.New(teardownDuration),
+			},
+		},
+	}
+	switch {
+	case caps.GetReflector().GetAsicLoopback() != nil:
+		qc.EndpointType = &plqpb.QualificationConfiguration_AsicLoopback{
+			AsicLoopback: &plqpb.AsicLoopbackConfiguration{},
+		}
+	case caps.GetReflector().GetPmdLoopback() != nil:
+		qc.EndpointType = &plqpb.QualificationConfiguration_PmdLoopback{
+			PmdLoopback: &plqpb.PmdLoopbackConfiguration{},
+		}
+	default:
+		t.Skipf("DUT does not support a link qualification reflector: %v", caps.GetReflector())
+	}
+	return &plqpb.CreateRequest{Interfaces: []*plqpb.QualificationConfiguration{qc}}
+}
+
+// awaitState polls the qualification until it reaches state, and fails the
+// test if it does not do so within timeout.
+func awaitState(t *testing.T, plq plqpb.LinkQualificationClient, id string, state plqpb.QualificationState, timeout time.Duration) *plqpb.QualificationResult {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := plq.Get(context.Background(), &plqpb.GetRequest{Ids: []string{id}})
+		if err != nil {
+			t.Fatalf("LinkQualification().Get(%q): %v", id, err)
+		}
+		result := resp.GetResults()[id]
+		if result.GetState() == state {
+			return result
+		}
+		if result.GetState() == plqpb.QualificationState_QUALIFICATION_STATE_ERROR {
+			t.Fatalf("Qualification %q failed: %v", id, result.GetStatus())
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Qualification %q state: got %v after %v, want %v", id, result.GetState(), timeout, state)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// configureATE returns a flow of fixed size packets transmitted and received
+// on ATE port1 at the qualification rate for the qualification duration.
+func configureATE(t *testing.T, ap *ondatra.Port) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	top.Ports().Add().SetName(ap.ID())
+
+	flow := top.Flows().Add().SetName("plq")
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Port().SetTxName(ap.ID()).SetRxNames([]string{ap.ID()})
+	flow.Size().SetFixed(packetSize)
+	flow.Rate().SetPps(packetRate)
+	flow.Duration().FixedPackets().SetPackets(uint32(packetRate * testDuration.Seconds()))
+	eth := flow.Packet().Add().Ethernet()
+	eth.Src().SetValue("02:00:01:01:01:01")
+	eth.Dst().SetValue("02:00:02:01:01:01")
+	return top
+}
+
+func TestLinkQualificationWithATE(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	dp := dut.Port(t, "port1")
+	ap := ate.Port(t, "port1")
+
+	configureDUT(t, dut, dp)
+	otg := ate.OTG()
+	top := configureATE(t, ap)
+	otg.PushConfig(t, top)
+
+	plq := dut.RawAPIs().GNOI(t).LinkQualification()
+	caps, err := plq.Capabilities(context.Background(), &plqpb.CapabilitiesRequest{})
+	if err != nil {
+		t.Fatalf("LinkQualification().Capabilities(): %v", err)
+	}
+	t.Logf("LinkQualification().Capabilities(): %v", caps)
+
+	id := "ate:" + ap.Name() + "<->" + dut.Name() + ":" + dp.Name()
+	req := reflectorRequest(t, caps, id, dp)
+	t.Logf("LinkQualification().Create(): %v", req)
+	createResp, err := plq.Create(context.Background(), req)
+	if err != nil {
+		t.Fatalf("LinkQualification().Create(): %v", err)
+	}
+	if got, want := createResp.GetStatus()[id].GetCode(), int32(0); got != want {
+		t.Fatalf("LinkQualification().Create() status code: got %v, want %v", got, want)
+	}
+	t.Cleanup(func() {
+		if _, err := plq.Delete(context.Background(), &plqpb.DeleteRequest{Ids: []string{id}}); err != nil {
+			t.Errorf("LinkQualification().Delete(%q): %v", id, err)
+		}
+	})
+
+	awaitState(t, plq, id, plqpb.QualificationState_QUALIFICATION_STATE_RUNNING, setupDuration+preSyncDuration+pollInterval)
+	if !deviations.SkipPlqInterfaceOperStatusCheck(dut) {
+		if got, want := gnmi.Get(t, dut, gnmi.OC().Interface(dp.Name()).OperStatus().State()), oc.Interface_OperStatus_TESTING; got != want {
+			t.Errorf("Interface(%v) oper-status: got %v, want %v", dp.Name(), got, want)
+		}
+	}
+
+	t.Logf("Start ATE traffic for %v", testDuration)
+	otg.StartTraffic(t)
+	time.Sleep(testDuration)
+	otg.StopTraffic(t)
+
+	m := gnmi.Get(t, otg, gnmi.OTG().Flow("plq").Counters().State())
+	txPkts, rxPkts := float64(m.GetOutPkts()), float64(m.GetInPkts())
+	t.Logf("ATE flow plq: sent %v, received %v", txPkts, rxPkts)
+	if txPkts == 0 {
+		t.Fatalf("ATE flow plq sent no packets")
+	}
+	if loss := (txPkts - rxPkts) / txPkts; math.Abs(loss) > lossTolerance {
+		t.Errorf("ATE flow plq loss: got %0.4f%%, want <= %0.4f%%", loss*100, lossTolerance*100)
+	}
+
+	result := awaitState(t, plq, id, plqpb.QualificationState_QUALIFICATION_STATE_COMPLETED, postSyncDuration+teardownDuration+2*pollInterval)
+	t.Logf("LinkQualification().Get(): %v", result)
+	if got, want := result.GetStatus().GetCode(), int32(0); got != want {
+		t.Errorf("result.GetStatus().GetCode(): got %v, want %v", got, want)
+	}
+	if got := result.GetPacketsError(); got != 0 {
+		t.Errorf("result.GetPacketsError(): got %v, want 0", got)
+	}
+	if got := result.GetPacketsDropped(); got != 0 {
+		t.Errorf("result.GetPacketsDropped(): got %v, want 0", got)
+	}
+	if got := result.GetEndTime().AsTime().Sub(result.GetStartTime().AsTime()); got < testDuration {
+		t.Errorf("Qualification duration from start_time to end_time: got %v, want >= %v", got, testDuration)
+	}
+}
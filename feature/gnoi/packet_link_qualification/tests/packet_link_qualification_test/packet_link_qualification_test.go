@@ -198,6 +198,34 @@ func TestListDelete(t *testing.T) {
 	}
 }
 
+const (
+	plqPacketRate = 138888
+	plqPacketSize = 8184
+	// plqRateTolerance is the relative difference allowed between configured
+	// and reported generator rates and packet counts.
+	plqRateTolerance = 0.05
+)
+
+// verifyGeneratorResult checks that the rates, packet count and duration
+// reported for the generator end are consistent with its configuration.
+func verifyGeneratorResult(t *testing.T, result *plqpb.QualificationResult, testDuration time.Duration) {
+	t.Helper()
+	wantRate := float64(plqPacketRate) * float64(plqPacketSize)
+	if got := float64(result.GetExpectedRateBytesPerSecond()); math.Abs(got-wantRate) > wantRate*plqRateTolerance {
+		t.Errorf("result.GetExpectedRateBytesPerSecond(): got %v, want %v +/- %v%%", got, wantRate, plqRateTolerance*100)
+	}
+	if got, want := float64(result.GetQualificationRateBytesPerSecond()), float64(result.GetExpectedRateBytesPerSecond()); got < want*(1-plqRateTolerance) {
+		t.Errorf("result.GetQualificationRateBytesPerSecond(): got %v, want >= %v", got, want*(1-plqRateTolerance))
+	}
+	wantPkts := float64(plqPacketRate) * testDuration.Seconds()
+	if got := float64(result.GetPacketsSent()); math.Abs(got-wantPkts) > wantPkts*plqRateTolerance {
+		t.Errorf("result.GetPacketsSent(): got %v, want %v +/- %v%%", got, wantPkts, plqRateTolerance*100)
+	}
+	if got := result.GetEndTime().AsTime().Sub(result.GetStartTime().AsTime()); got < testDuration {
+		t.Errorf("Qualification duration from start_time to end_time: got %v, want >= %v", got, testDuration)
+	}
+}
+
 func configInterfaceMTU(i *oc.Interface, dut *ondatra.DUTDevice) *oc.Interface {
 	i.Type = oc.IETFInterfaces_InterfaceType_ethernetCsmacd
 	if deviations.InterfaceEnabled(dut) {
@@ -264,8 +292,8 @@ func TestLinkQualification(t *testing.T) {
 				InterfaceName: dp1.Name(),
 				EndpointType: &plqpb.QualificationConfiguration_PacketGenerator{
 					PacketGenerator: &plqpb.PacketGeneratorConfiguration{
-						PacketRate: uint64(138888),
-						PacketSize: uint32(8184),
+						PacketRate: uint64(plqPacketRate),
+						PacketSize: uint32(plqPacketSize),
 					},
 				},
 				Timing: &plqpb.QualificationConfiguration_Rpc{
@@ -411,6 +439,7 @@ func TestLinkQualification(t *testing.T) {
 		if client == gnoiClient1 {
 			generatorPktsSent = result.GetPacketsSent()
 			generatorPktsRxed = result.GetPacketsReceived()
+			verifyGeneratorResult(t, result, plqDuration.testDuration)
 		}
 
 		if client == gnoiClient2 {
@@ -0,0 +1,338 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kill_process_test
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/gnoihelper"
+	"github.com/openconfig/featureprofiles/internal/gribi"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/gribigo/fluent"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/testt"
+	"github.com/openconfig/ygnmi/ygnmi"
+
+	spb "github.com/openconfig/gnoi/system"
+)
+
+var (
+	routingLossBudget = flag.Duration("routing_loss_budget", 0,
+		"maximum traffic loss allowed while the routing daemon restarts")
+	gribiLossBudget = flag.Duration("gribi_loss_budget", 0,
+		"maximum traffic loss allowed while the gRIBI daemon restarts")
+	gnmiLossBudget = flag.Duration("gnmi_loss_budget", 0,
+		"maximum traffic loss allowed while the gNMI daemon restarts")
+	reconvergeTimeout = flag.Duration("reconverge_timeout", 5*time.Minute,
+		"time allowed for the control plane to recover after a daemon restart")
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// The testbed consists of ate:port1 -> dut:port1 and dut:port2 -> ate:port2.
+// ate:port2 is an eBGP peer of the DUT advertising bgpPrefix, and the gRIBI
+// client installs gribiPrefix with a next hop of ate:port2. One flow towards
+// each prefix is sent from ate:port1.
+const (
+	bgpPrefix      = "198.51.100.0/24"
+	bgpAddr        = "198.51.100.0"
+	bgpPrefixLen   = 24
+	bgpRouteName   = "port2.BGP4.route"
+	gribiPrefix    = "203.0.113.0/24"
+	bgpFlowName    = "BGPFlow"
+	gribiFlowName  = "GRIBIFlow"
+	nhIndex        = 1
+	nhgIndex       = 42
+	fps            = 10000 // traffic frames per second per flow
+	restartPoll    = 5 * time.Second
+	trafficSettle  = 15 * time.Second
+	processTimeout = 2 * time.Minute
+)
+
+// daemon is a DUT process killed and restarted by the test.
+type daemon struct {
+	desc string
+	// names are the process names of the daemon per vendor.
+	names map[ondatra.Vendor]string
+	// budget is the maximum traffic loss allowed while the daemon restarts.
+	budget *time.Duration
+	// recovered blocks until the control plane served by the daemon has
+	// recovered.
+	recovered func(t *testing.T, tc *testContext)
+}
+
+var daemons = []daemon{{
+	desc: "Routing",
+	names: map[ondatra.Vendor]string{
+		ondatra.ARISTA:  "Bgp-main",
+		ondatra.CISCO:   "bgp",
+		ondatra.JUNIPER: "rpd",
+		ondatra.NOKIA:   "sr_bgp_mgr",
+	},
+	budget:    routingLossBudget,
+	recovered: awaitBGP,
+}, {
+	desc: "gRIBI",
+	names: map[ondatra.Vendor]string{
+		ondatra.ARISTA:  "Gribi",
+		ondatra.CISCO:   "emsd",
+		ondatra.JUNIPER: "rpd",
+		ondatra.NOKIA:   "sr_gribi_server",
+	},
+	budget:    gribiLossBudget,
+	recovered: awaitGRIBI,
+}, {
+	desc: "gNMI",
+	names: map[ondatra.Vendor]string{
+		ondatra.ARISTA:  "Octa",
+		ondatra.CISCO:   "emsd",
+		ondatra.JUNIPER: "na-grpcd",
+		ondatra.NOKIA:   "sr_grpc_server",
+	},
+	budget:    gnmiLossBudget,
+	recovered: awaitGNMI,
+}}
+
+// testContext holds the objects shared by the test cases.
+type testContext struct {
+	dut *ondatra.DUTDevice
+	ate *ondatra.ATEDevice
+	top gosnappi.Config
+	bs  *cfgplugins.BGPSession
+}
+
+// configureBGP sets up the DUT and ATE interfaces, an eBGP session with
+// ate:port2 over which bgpPrefix is advertised, and the traffic flows.
+func configureBGP(t *testing.T) *cfgplugins.BGPSession {
+	t.Helper()
+	bs := cfgplugins.NewBGPSession(t, cfgplugins.PortCount2, nil)
+	bs.WithEBGP(t, []oc.E_BgpTypes_AFI_SAFI_TYPE{oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST}, []string{"port2"}, false, false)
+
+	for _, d := range bs.ATETop.Devices().Items() {
+		if d.Name() != bs.ATEPorts[1].Name {
+			continue
+		}
+		peer := d.Bgp().Ipv4Interfaces().Items()[0].Peers().Items()[0]
+		route := peer.V4Routes().Add().SetName(bgpRouteName)
+		route.SetNextHopIpv4Address(bs.ATEPorts[1].IPv4).
+			SetNextHopAddressType(gosnappi.BgpV4RouteRangeNextHopAddressType.IPV4).
+			SetNextHopMode(gosnappi.BgpV4RouteRangeNextHopMode.MANUAL)
+		route.Addresses().Add().SetAddress(bgpAddr).SetPrefix(bgpPrefixLen).SetCount(1)
+	}
+
+	for _, f := range []struct{ name, dst string }{
+		{bgpFlowName, "198.51.100.1"},
+		{gribiFlowName, "203.0.113.1"},
+	} {
+		flow := bs.ATETop.Flows().Add().SetName(f.name)
+		flow.Metrics().SetEnable(true)
+		flow.TxRx().Device().
+			SetTxNames([]string{bs.ATEPorts[0].Name + ".IPv4"}).
+			SetRxNames([]string{bs.ATEPorts[1].Name + ".IPv4"})
+		flow.Rate().SetPps(fps)
+		flow.Duration().Continuous()
+		flow.Packet().Add().Ethernet().Src().SetValue(bs.ATEPorts[0].MAC)
+		v4 := flow.Packet().Add().Ipv4()
+		v4.Src().SetValue(bs.ATEPorts[0].IPv4)
+		v4.Dst().Increment().SetStart(f.dst).SetCount(250)
+	}
+
+	if err := bs.PushAndStart(t); err != nil {
+		t.Fatalf("Failed to push BGP config: %v", err)
+	}
+	cfgplugins.VerifyDUTBGPEstablished(t, bs.DUT)
+	cfgplugins.VerifyOTGBGPEstablished(t, bs.ATE)
+	return bs
+}
+
+// programGRIBI installs gribiPrefix with a next hop of ate:port2 using a
+// persistent gRIBI client, which is closed once the entries are acked.
+func programGRIBI(t *testing.T, tc *testContext) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(tc.dut)
+	client := &gribi.Client{
+		DUT:         tc.dut,
+		FIBACK:      true,
+		Persistence: true,
+	}
+	if err := client.Start(t); err != nil {
+		t.Fatalf("gRIBI Connection can not be established")
+	}
+	defer client.Close(t)
+	client.BecomeLeader(t)
+	client.AddNH(t, nhIndex, tc.bs.ATEPorts[1].IPv4, dni, fluent.InstalledInFIB)
+	client.AddNHG(t, nhgIndex, map[uint64]uint64{nhIndex: 1}, dni, fluent.InstalledInFIB)
+	client.AddIPv4(t, gribiPrefix, nhgIndex, dni, "", fluent.InstalledInFIB)
+}
+
+// flushGRIBI removes all gRIBI entries from the DUT.
+func flushGRIBI(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	client := &gribi.Client{
+		DUT:         dut,
+		FIBACK:      true,
+		Persistence: true,
+	}
+	if err := client.Start(t); err != nil {
+		t.Fatalf("gRIBI Connection can not be established")
+	}
+	defer client.Close(t)
+	client.BecomeLeader(t)
+	client.FlushAll(t)
+}
+
+// awaitBGP waits for the eBGP session with ate:port2 to be re-established and
+// for bgpPrefix to be back in the AFT.
+func awaitBGP(t *testing.T, tc *testContext) {
+	t.Helper()
+	dni := deviations.DefaultNetworkInstance(tc.dut)
+	nbr := gnmi.OC().NetworkInstance(dni).Protocol(cfgplugins.PTBGP, "BGP").Bgp().Neighbor(tc.bs.ATEPorts[1].IPv4)
+	_, ok := gnmi.Watch(t, tc.dut, nbr.SessionState().State(), *reconvergeTimeout, func(val *ygnmi.Value[oc.E_Bgp_Neighbor_SessionState]) bool {
+		state, present := val.Val()
+		return present && state == oc.Bgp_Neighbor_SessionState_ESTABLISHED
+	}).Await(t)
+	if !ok {
+		t.Fatalf("BGP session with %s not re-established within %v", tc.bs.ATEPorts[1].IPv4, *reconvergeTimeout)
+	}
+	awaitAFT(t, tc.dut, bgpPrefix)
+}
+
+// awaitGRIBI waits for a gRIBI client to be able to connect again and for
+// gribiPrefix, which was installed with persistence, to still be in the AFT.
+func awaitGRIBI(t *testing.T, tc *testContext) {
+	t.Helper()
+	deadline := time.Now().Add(*reconvergeTimeout)
+	for {
+		client := &gribi.Client{
+			DUT:         tc.dut,
+			FIBACK:      true,
+			Persistence: true,
+		}
+		err := client.Start(t)
+		if err == nil {
+			client.Close(t)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("gRIBI not reachable within %v: %v", *reconvergeTimeout, err)
+		}
+		time.Sleep(restartPoll)
+	}
+	awaitAFT(t, tc.dut, gribiPrefix)
+}
+
+// awaitGNMI waits for the DUT to serve gNMI Get requests again.
+func awaitGNMI(t *testing.T, tc *testContext) {
+	t.Helper()
+	deadline := time.Now().Add(*reconvergeTimeout)
+	for {
+		errMsg := testt.CaptureFatal(t, func(t testing.TB) {
+			gnmi.Get(t, tc.dut, gnmi.OC().System().CurrentDatetime().State())
+		})
+		if errMsg == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("gNMI not reachable within %v: %s", *reconvergeTimeout, *errMsg)
+		}
+		time.Sleep(restartPoll)
+	}
+}
+
+// awaitAFT waits for prefix to be present in the AFT of the default network
+// instance.
+func awaitAFT(t *testing.T, dut *ondatra.DUTDevice, prefix string) {
+	t.Helper()
+	ipv4Path := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Afts().Ipv4Entry(prefix)
+	_, ok := gnmi.Watch(t, dut, ipv4Path.State(), *reconvergeTimeout, func(val *ygnmi.Value[*oc.NetworkInstance_Afts_Ipv4Entry]) bool {
+		entry, present := val.Val()
+		return present && entry.GetPrefix() == prefix
+	}).Await(t)
+	if !ok {
+		t.Fatalf("AFT entry for %s not present within %v", prefix, *reconvergeTimeout)
+	}
+}
+
+// lossDuration returns the traffic loss of the given flow expressed as the
+// time it takes to send the lost frames.
+func lossDuration(t *testing.T, ate *ondatra.ATEDevice, flow string) time.Duration {
+	t.Helper()
+	counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(flow).Counters().State())
+	tx, rx := counters.GetOutPkts(), counters.GetInPkts()
+	if tx == 0 {
+		t.Fatalf("No traffic was sent on flow %s", flow)
+	}
+	var lost uint64
+	if tx > rx {
+		lost = tx - rx
+	}
+	return time.Duration(lost) * time.Second / fps
+}
+
+func TestKillProcess(t *testing.T) {
+	bs := configureBGP(t)
+	tc := &testContext{
+		dut: bs.DUT,
+		ate: bs.ATE,
+		top: bs.ATETop,
+		bs:  bs,
+	}
+	defer tc.ate.OTG().StopProtocols(t)
+
+	programGRIBI(t, tc)
+	defer flushGRIBI(t, tc.dut)
+	awaitAFT(t, tc.dut, bgpPrefix)
+	awaitAFT(t, tc.dut, gribiPrefix)
+	otgutils.WaitForARP(t, tc.ate.OTG(), tc.top, "IPv4")
+
+	for _, d := range daemons {
+		t.Run(d.desc, func(t *testing.T) {
+			name, ok := d.names[tc.dut.Vendor()]
+			if !ok {
+				t.Skipf("%s daemon name is not known for vendor %v", d.desc, tc.dut.Vendor())
+			}
+			otg := tc.ate.OTG()
+			otg.StartTraffic(t)
+			time.Sleep(trafficSettle)
+
+			start := time.Now()
+			gnoihelper.KillAndWait(t, tc.dut, name, spb.KillProcessRequest_SIGNAL_TERM, processTimeout)
+			d.recovered(t, tc)
+			t.Logf("%s control plane reconverged after %v", d.desc, time.Since(start))
+
+			time.Sleep(trafficSettle)
+			otg.StopTraffic(t)
+			otgutils.LogFlowMetrics(t, otg, tc.top)
+
+			for _, flow := range []string{bgpFlowName, gribiFlowName} {
+				loss := lossDuration(t, tc.ate, flow)
+				t.Logf("Traffic loss of flow %s while restarting %s daemon: %v", flow, d.desc, loss)
+				if loss > *d.budget {
+					t.Errorf("Traffic loss of flow %s while restarting %s daemon: got %v, want <= %v", flow, d.desc, loss, *d.budget)
+				}
+			}
+		})
+	}
+}
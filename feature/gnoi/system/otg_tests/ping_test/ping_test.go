@@ -19,13 +19,18 @@ import (
 	"io"
 	"testing"
 
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
 	"github.com/openconfig/featureprofiles/internal/deviations"
 	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
 	spb "github.com/openconfig/gnoi/system"
 	tpb "github.com/openconfig/gnoi/types"
 	"github.com/openconfig/ondatra"
 	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
 	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygot/ygot"
 )
 
 const (
@@ -45,6 +50,47 @@ const (
 	minimumMaxTime           = 1
 	// StdDeviation would be 0 if we only send 1 ping.
 	minimumStdDev = 1
+
+	// ipv4HeaderSize and icmpEchoHeaderSize are added to the ping size to get
+	// the size of the IPv4 packet on the wire.
+	ipv4HeaderSize     = 20
+	icmpEchoHeaderSize = 8
+	interfaceMTU       = 1500
+	ateVRF             = "VRF-A"
+	atePingCount       = 5
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: 30,
+		IPv6:    "2001:db8::192:0:2:1",
+		IPv6Len: 126,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "port1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: 30,
+		IPv6:    "2001:db8::192:0:2:2",
+		IPv6Len: 126,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: 30,
+		IPv6:    "2001:db8::192:0:2:5",
+		IPv6Len: 126,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "port2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: 30,
+		IPv6:    "2001:db8::192:0:2:6",
+		IPv6Len: 126,
+	}
 )
 
 func TestMain(m *testing.M) {
@@ -476,6 +522,195 @@ func TestGNOIPing(t *testing.T) {
 	}
 }
 
+// configureDUT configures port1 in the default network instance and port2 in
+// ateVRF.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+
+	fptest.ConfigureDefaultNetworkInstance(t, dut)
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(ateVRF).Config(), &oc.NetworkInstance{
+		Name: ygot.String(ateVRF),
+		Type: oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_L3VRF,
+	})
+	fptest.AssignToNetworkInstance(t, dut, p2.Name(), ateVRF, 0)
+
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p1.Name()).Config(), dutPort1.NewOCInterface(p1.Name(), dut))
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p2.Name()).Config(), dutPort2.NewOCInterface(p2.Name(), dut))
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+}
+
+// configureATE configures port1 and port2 on the ATE and starts protocols so
+// that the ATE answers pings.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	atePort1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	atePort2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+}
+
+// TestGNOIPingATE sends gNOI pings to the ATE addresses with varying sizes,
+// the DF bit, an explicit source and a non-default VRF.
+func TestGNOIPingATE(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	configureDUT(t, dut)
+	configureATE(t, ate)
+	defer ate.OTG().StopProtocols(t)
+
+	// maxDFSize is the largest IPv4 ping size which fits the interface MTU.
+	maxDFSize := int32(interfaceMTU - ipv4HeaderSize - icmpEchoHeaderSize)
+
+	cases := []struct {
+		desc        string
+		pingRequest *spb.PingRequest
+		// wantReplies is false if the DUT must not receive any echo reply.
+		wantReplies bool
+	}{{
+		desc: "IPv4 to ATE with default size",
+		pingRequest: &spb.PingRequest{
+			Destination: atePort1.IPv4,
+			L3Protocol:  tpb.L3Protocol_IPV4,
+		},
+		wantReplies: true,
+	}, {
+		desc: "IPv4 to ATE with minimum size",
+		pingRequest: &spb.PingRequest{
+			Destination: atePort1.IPv4,
+			L3Protocol:  tpb.L3Protocol_IPV4,
+			Size:        minimumPingRequestSize,
+		},
+		wantReplies: true,
+	}, {
+		desc: "IPv4 to ATE with DF and MTU size",
+		pingRequest: &spb.PingRequest{
+			Destination:   atePort1.IPv4,
+			L3Protocol:    tpb.L3Protocol_IPV4,
+			Size:          maxDFSize,
+			DoNotFragment: true,
+		},
+		wantReplies: true,
+	}, {
+		desc: "IPv4 to ATE with DF and size over MTU",
+		pingRequest: &spb.PingRequest{
+			Destination:   atePort1.IPv4,
+			L3Protocol:    tpb.L3Protocol_IPV4,
+			Size:          maxDFSize + 1,
+			DoNotFragment: true,
+		},
+		wantReplies: false,
+	}, {
+		desc: "IPv4 to ATE without DF and size over MTU",
+		pingRequest: &spb.PingRequest{
+			Destination: atePort1.IPv4,
+			L3Protocol:  tpb.L3Protocol_IPV4,
+			Size:        maxDFSize + 1,
+		},
+		wantReplies: true,
+	}, {
+		desc: "IPv4 to ATE with interface source",
+		pingRequest: &spb.PingRequest{
+			Destination: atePort1.IPv4,
+			Source:      dutPort1.IPv4,
+			L3Protocol:  tpb.L3Protocol_IPV4,
+		},
+		wantReplies: true,
+	}, {
+		desc: "IPv6 to ATE with interface source",
+		pingRequest: &spb.PingRequest{
+			Destination: atePort1.IPv6,
+			Source:      dutPort1.IPv6,
+			L3Protocol:  tpb.L3Protocol_IPV6,
+		},
+		wantReplies: true,
+	}, {
+		desc: "IPv4 to ATE in non-default VRF",
+		pingRequest: &spb.PingRequest{
+			Destination:     atePort2.IPv4,
+			L3Protocol:      tpb.L3Protocol_IPV4,
+			NetworkInstance: ateVRF,
+		},
+		wantReplies: true,
+	}, {
+		desc: "IPv6 to ATE in non-default VRF",
+		pingRequest: &spb.PingRequest{
+			Destination:     atePort2.IPv6,
+			L3Protocol:      tpb.L3Protocol_IPV6,
+			NetworkInstance: ateVRF,
+		},
+		wantReplies: true,
+	}}
+
+	gnoiClient := dut.RawAPIs().GNOI(t)
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tc.pingRequest.Count = atePingCount
+			t.Logf("Sent ping request: %v", tc.pingRequest)
+			pingClient, err := gnoiClient.System().Ping(context.Background(), tc.pingRequest)
+			if err != nil {
+				t.Fatalf("Failed to query gnoi endpoint: %v", err)
+			}
+			responses, err := fetchResponses(pingClient)
+			if err != nil {
+				t.Fatalf("Failed to handle gnoi ping client stream: %v", err)
+			}
+			t.Logf("Got ping responses: %v", responses)
+			if len(responses) == 0 {
+				t.Fatalf("Number of responses to %v: got 0, want > 0", tc.pingRequest.Destination)
+			}
+
+			summary := responses[len(responses)-1]
+			replies := responses[:len(responses)-1]
+			if got, want := summary.GetSent(), int32(atePingCount); got != want {
+				t.Errorf("Ping summary sent: got %v, want %v", got, want)
+			}
+			if !tc.wantReplies {
+				if got := summary.GetReceived(); got != 0 {
+					t.Errorf("Ping summary received: got %v, want 0", got)
+				}
+				return
+			}
+			if got, want := summary.GetReceived(), int32(atePingCount); got != want {
+				t.Errorf("Ping summary received: got %v, want %v", got, want)
+			}
+			if !(summary.GetMinTime() <= summary.GetAvgTime() && summary.GetAvgTime() <= summary.GetMaxTime()) {
+				t.Errorf("Ping summary times: got min %v, avg %v, max %v, want min <= avg <= max", summary.GetMinTime(), summary.GetAvgTime(), summary.GetMaxTime())
+			}
+
+			if got, want := len(replies), atePingCount; got != want {
+				t.Errorf("Number of echo replies: got %v, want %v", got, want)
+			}
+			var lastSequence int32
+			for _, r := range replies {
+				if got, want := r.GetSource(), tc.pingRequest.GetDestination(); got != want {
+					t.Errorf("Ping reply source: got %v, want %v", got, want)
+				}
+				if r.GetTime() < minimumPingTime {
+					t.Errorf("Ping reply time: got %v, want >= %v", r.GetTime(), minimumPingTime)
+				}
+				if size := tc.pingRequest.GetSize(); size > 0 && r.GetBytes() < size {
+					t.Errorf("Ping reply bytes: got %v, want >= %v", r.GetBytes(), size)
+				}
+				if r.GetSequence() <= lastSequence {
+					t.Errorf("Ping reply sequence: got %v, want > %v", r.GetSequence(), lastSequence)
+				}
+				lastSequence = r.GetSequence()
+			}
+		})
+	}
+}
+
 func fetchResponses(c spb.System_PingClient) ([]*spb.PingResponse, error) {
 	pingResp := []*spb.PingResponse{}
 	for {
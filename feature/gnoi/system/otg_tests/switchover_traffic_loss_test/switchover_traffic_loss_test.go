@@ -0,0 +1,209 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package switchover_traffic_loss_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/args"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/components"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/gnoihelper"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// The testbed consists of ate:port1 -> dut:port1 and dut:port2 -> ate:port2.
+// Line-rate IPv4 and IPv6 flows are sent from ate:port1 to ate:port2.
+const (
+	ipv4PrefixLen = 30
+	ipv6PrefixLen = 126
+
+	// linePct is the share of the port line rate used by each flow, so that
+	// both flows together run at line rate.
+	linePct = 50
+
+	switchoverTimeout = 15 * time.Minute
+	// trafficSettle is the time traffic runs before the switchover and after
+	// the DUT has recovered.
+	trafficSettle = 30 * time.Second
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::1",
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::2",
+		IPv6Len: ipv6PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::5",
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::6",
+		IPv6Len: ipv6PrefixLen,
+	}
+
+	flowNames = []string{"IPv4Flow", "IPv6Flow"}
+)
+
+// configureDUT configures port1 and port2 on the DUT.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	d := gnmi.OC()
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+	gnmi.Replace(t, dut, d.Interface(p1.Name()).Config(), dutPort1.NewOCInterface(p1.Name(), dut))
+	gnmi.Replace(t, dut, d.Interface(p2.Name()).Config(), dutPort2.NewOCInterface(p2.Name(), dut))
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		fptest.AssignToNetworkInstance(t, dut, p2.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+}
+
+// configureATE configures port1 and port2 on the ATE and the IPv4 and IPv6
+// flows from port1 to port2, with timestamps enabled in the flow metrics.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	atePort1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	atePort2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+
+	v4 := top.Flows().Add().SetName(flowNames[0])
+	v4.Metrics().SetEnable(true).SetTimestamps(true)
+	v4.TxRx().Device().SetTxNames([]string{atePort1.Name + ".IPv4"}).SetRxNames([]string{atePort2.Name + ".IPv4"})
+	v4.Rate().SetPercentage(linePct)
+	v4.Duration().Continuous()
+	v4.Packet().Add().Ethernet().Src().SetValue(atePort1.MAC)
+	ip4 := v4.Packet().Add().Ipv4()
+	ip4.Src().SetValue(atePort1.IPv4)
+	ip4.Dst().SetValue(atePort2.IPv4)
+
+	v6 := top.Flows().Add().SetName(flowNames[1])
+	v6.Metrics().SetEnable(true).SetTimestamps(true)
+	v6.TxRx().Device().SetTxNames([]string{atePort1.Name + ".IPv6"}).SetRxNames([]string{atePort2.Name + ".IPv6"})
+	v6.Rate().SetPercentage(linePct)
+	v6.Duration().Continuous()
+	v6.Packet().Add().Ethernet().Src().SetValue(atePort1.MAC)
+	ip6 := v6.Packet().Add().Ipv6()
+	ip6.Src().SetValue(atePort1.IPv6)
+	ip6.Dst().SetValue(atePort2.IPv6)
+
+	return top
+}
+
+// lossDuration returns the traffic loss of a flow expressed as the time it
+// takes to send the lost frames. The frame rate is derived from the OTG
+// timestamps of the first and last received frames, which bound the time the
+// flow was running since loss is only expected in the middle of the run.
+func lossDuration(t *testing.T, api gosnappi.Api, flow string) time.Duration {
+	t.Helper()
+	req := gosnappi.NewMetricsRequest()
+	req.Flow().SetFlowNames([]string{flow})
+	resp, err := api.GetMetrics(req)
+	if err != nil {
+		t.Fatalf("GetMetrics(%s) failed: %v", flow, err)
+	}
+	items := resp.FlowMetrics().Items()
+	if len(items) != 1 {
+		t.Fatalf("GetMetrics(%s): got %d flow metrics, want 1", flow, len(items))
+	}
+	m := items[0]
+	tx, rx := m.FramesTx(), m.FramesRx()
+	window := time.Duration(m.Timestamps().LastTimestampNs() - m.Timestamps().FirstTimestampNs())
+	t.Logf("Flow %s: %d frames sent, %d frames received over %v", flow, tx, rx, window)
+	if tx == 0 || window <= 0 {
+		t.Fatalf("Flow %s: got %d frames sent over %v, want traffic", flow, tx, window)
+	}
+	if rx >= tx {
+		return 0
+	}
+	return time.Duration(float64(tx-rx) / float64(tx) * float64(window))
+}
+
+func TestSwitchoverTrafficLoss(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	controllerCards := components.FindComponentsByType(t, dut, oc.PlatformTypes_OPENCONFIG_HARDWARE_COMPONENT_CONTROLLER_CARD)
+	if len(controllerCards) < 2 {
+		t.Skipf("DUT %s has %d controller cards, want at least 2", dut.Name(), len(controllerCards))
+	}
+	standby, active := components.FindStandbyRP(t, dut, controllerCards)
+	t.Logf("Detected standby RP %s, active RP %s", standby, active)
+	gnmi.Await(t, dut, gnmi.OC().Component(active).SwitchoverReady().State(), 30*time.Minute, true)
+
+	configureDUT(t, dut)
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	defer ate.OTG().StopProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+
+	ate.OTG().StartTraffic(t)
+	time.Sleep(trafficSettle)
+	start := time.Now()
+	gnoihelper.SwitchoverAndWait(t, dut, standby, switchoverTimeout)
+	t.Logf("Switchover to %s completed after %v", standby, time.Since(start))
+	fptest.WaitForPortsUp(t, dut, switchoverTimeout)
+	time.Sleep(trafficSettle)
+	ate.OTG().StopTraffic(t)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+	api, err := ate.RawAPIs().BindingATE().DialOTG(context.Background())
+	if err != nil {
+		t.Fatalf("Could not dial OTG: %v", err)
+	}
+	for _, flow := range flowNames {
+		loss := lossDuration(t, api, flow)
+		t.Logf("Traffic loss of flow %s during switchover: %v", flow, loss)
+		if loss > *args.SwitchoverLossBudget {
+			t.Errorf("Traffic loss of flow %s during switchover: got %v, want <= %v", flow, loss, *args.SwitchoverLossBudget)
+		}
+	}
+}
@@ -20,19 +20,60 @@ import (
 	"testing"
 	"time"
 
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
 	"github.com/openconfig/featureprofiles/internal/deviations"
 	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
 	spb "github.com/openconfig/gnoi/system"
 	tpb "github.com/openconfig/gnoi/types"
 	"github.com/openconfig/ondatra"
 	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
 	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygot/ygot"
 )
 
 const (
 	minTracerouteHops        = 1
 	minTracerouteRTT         = 0 // the device traceroute to its loopback, the RTT can be zero.
 	maxDefaultTracerouteHops = 30
+	ateVRF                   = "VRF-A"
+	// ateMaxTTL bounds traceroutes to the directly connected ATE.
+	ateMaxTTL = 5
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: 30,
+		IPv6:    "2001:db8::192:0:2:1",
+		IPv6Len: 126,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "port1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: 30,
+		IPv6:    "2001:db8::192:0:2:2",
+		IPv6Len: 126,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: 30,
+		IPv6:    "2001:db8::192:0:2:5",
+		IPv6Len: 126,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "port2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: 30,
+		IPv6:    "2001:db8::192:0:2:6",
+		IPv6Len: 126,
+	}
 )
 
 func TestMain(m *testing.M) {
@@ -282,6 +323,167 @@ func TestGNOITraceroute(t *testing.T) {
 	}
 }
 
+// configureDUT configures port1 in the default network instance and port2 in
+// ateVRF.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+
+	fptest.ConfigureDefaultNetworkInstance(t, dut)
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(ateVRF).Config(), &oc.NetworkInstance{
+		Name: ygot.String(ateVRF),
+		Type: oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_L3VRF,
+	})
+	fptest.AssignToNetworkInstance(t, dut, p2.Name(), ateVRF, 0)
+
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p1.Name()).Config(), dutPort1.NewOCInterface(p1.Name(), dut))
+	gnmi.Replace(t, dut, gnmi.OC().Interface(p2.Name()).Config(), dutPort2.NewOCInterface(p2.Name(), dut))
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+}
+
+// configureATE configures port1 and port2 on the ATE and starts protocols so
+// that the ATE answers traceroute probes.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	atePort1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	atePort2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+}
+
+// TestGNOITracerouteATE sends gNOI traceroutes to the directly connected ATE
+// addresses with different L4 protocols, the DF bit, an explicit source and a
+// non-default VRF, and validates the hop structure of the responses.
+func TestGNOITracerouteATE(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	configureDUT(t, dut)
+	configureATE(t, ate)
+	defer ate.OTG().StopProtocols(t)
+
+	cases := []struct {
+		desc         string
+		traceRequest *spb.TracerouteRequest
+	}{{
+		desc: "IPv4 to ATE with L4protocol ICMP",
+		traceRequest: &spb.TracerouteRequest{
+			Destination: atePort1.IPv4,
+			L3Protocol:  tpb.L3Protocol_IPV4,
+			L4Protocol:  spb.TracerouteRequest_ICMP,
+		},
+	}, {
+		desc: "IPv4 to ATE with L4protocol UDP",
+		traceRequest: &spb.TracerouteRequest{
+			Destination: atePort1.IPv4,
+			L3Protocol:  tpb.L3Protocol_IPV4,
+			L4Protocol:  spb.TracerouteRequest_UDP,
+		},
+	}, {
+		desc: "IPv4 to ATE with L4protocol TCP",
+		traceRequest: &spb.TracerouteRequest{
+			Destination: atePort1.IPv4,
+			L3Protocol:  tpb.L3Protocol_IPV4,
+			L4Protocol:  spb.TracerouteRequest_TCP,
+		},
+	}, {
+		desc: "IPv4 to ATE with DF",
+		traceRequest: &spb.TracerouteRequest{
+			Destination:   atePort1.IPv4,
+			L3Protocol:    tpb.L3Protocol_IPV4,
+			DoNotFragment: true,
+		},
+	}, {
+		desc: "IPv4 to ATE with interface source",
+		traceRequest: &spb.TracerouteRequest{
+			Destination: atePort1.IPv4,
+			Source:      dutPort1.IPv4,
+			L3Protocol:  tpb.L3Protocol_IPV4,
+		},
+	}, {
+		desc: "IPv6 to ATE with interface source",
+		traceRequest: &spb.TracerouteRequest{
+			Destination: atePort1.IPv6,
+			Source:      dutPort1.IPv6,
+			L3Protocol:  tpb.L3Protocol_IPV6,
+		},
+	}, {
+		desc: "IPv4 to ATE in non-default VRF",
+		traceRequest: &spb.TracerouteRequest{
+			Destination:     atePort2.IPv4,
+			L3Protocol:      tpb.L3Protocol_IPV4,
+			NetworkInstance: ateVRF,
+		},
+	}, {
+		desc: "IPv6 to ATE in non-default VRF",
+		traceRequest: &spb.TracerouteRequest{
+			Destination:     atePort2.IPv6,
+			L3Protocol:      tpb.L3Protocol_IPV6,
+			NetworkInstance: ateVRF,
+		},
+	}}
+
+	gnoiClient := dut.RawAPIs().GNOI(t)
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			time.Sleep(1 * time.Second) // some devices do not allow back to back traceroute to prevent flooding
+			if deviations.TraceRouteL4ProtocolUDP(dut) {
+				if tc.traceRequest.L4Protocol == spb.TracerouteRequest_ICMP {
+					tc.traceRequest.L4Protocol = spb.TracerouteRequest_UDP
+				}
+				if tc.traceRequest.L4Protocol != spb.TracerouteRequest_UDP {
+					t.Skip("Test is skiped due to the TraceRouteL4ProtocolUDP deviation")
+				}
+			}
+			tc.traceRequest.MaxTtl = ateMaxTTL
+			tc.traceRequest.DoNotLookupAsn = true
+			t.Logf("Sent traceroute request: %v", tc.traceRequest)
+			traceClient, err := gnoiClient.System().Traceroute(context.Background(), tc.traceRequest)
+			if err != nil {
+				t.Fatalf("Failed to query gnoi endpoint: %v", err)
+			}
+			resps, err := fetchTracerouteResponses(traceClient)
+			if err != nil {
+				t.Fatalf("Failed to handle gnoi traceroute client stream: %v", err)
+			}
+			t.Logf("Got traceroute responses: %v", resps)
+			if len(resps) < 2 {
+				t.Fatalf("Number of responses to %v: got %v, want at least 2", tc.traceRequest.Destination, len(resps))
+			}
+
+			if got, want := resps[0].GetDestinationAddress(), tc.traceRequest.GetDestination(); got != want {
+				t.Errorf("Traceroute destination: got %v, want %v", got, want)
+			}
+			if got, want := resps[0].GetHops(), int32(ateMaxTTL); got != want {
+				t.Errorf("Traceroute hops: got %v, want %v", got, want)
+			}
+
+			// The ATE is directly connected, so every reply is for the first
+			// hop and comes from the destination itself.
+			for _, r := range resps[1:] {
+				if got, want := r.GetHop(), int32(1); got != want {
+					t.Errorf("Traceroute reply hop: got %v, want %v", got, want)
+				}
+				if got, want := r.GetAddress(), tc.traceRequest.GetDestination(); got != want {
+					t.Errorf("Traceroute reply address: got %v, want %v", got, want)
+				}
+				if r.GetRtt() <= minTracerouteRTT {
+					t.Errorf("Traceroute reply RTT: got %v, want > %v", r.GetRtt(), minTracerouteRTT)
+				}
+			}
+		})
+	}
+}
+
 func fetchTracerouteResponses(c spb.System_TracerouteClient) ([]*spb.TracerouteResponse, error) {
 	traceResp := []*spb.TracerouteResponse{}
 	for {
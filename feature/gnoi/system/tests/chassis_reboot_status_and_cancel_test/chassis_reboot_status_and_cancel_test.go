@@ -17,6 +17,7 @@ package chassis_reboot_status_and_cancel_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/openconfig/featureprofiles/internal/components"
 	"github.com/openconfig/featureprofiles/internal/deviations"
@@ -30,6 +31,9 @@ import (
 const (
 	oneMinuteInNanoSecond = 6e10
 	rebootDelay           = 120
+	// cancelTimeout is the time allowed for a cancelled reboot to become
+	// inactive.
+	cancelTimeout = 30 * time.Second
 )
 
 func TestMain(m *testing.M) {
@@ -179,14 +183,8 @@ func TestCancelReboot(t *testing.T) {
 		t.Fatalf("Failed to cancel reboot with unexpected err: %v", err)
 	}
 
-	rebootStatus, err = gnoiClient.System().RebootStatus(context.Background(), statusReq)
-	t.Logf("DUT rebootStatus: %v, err: %v", rebootStatus, err)
-	if err != nil {
-		t.Fatalf("Failed to get reboot status with unexpected err: %v", err)
-	}
-	if rebootStatus.GetActive() {
-		t.Errorf("rebootStatus.GetActive(): got %v, want false", rebootStatus.GetActive())
-	}
+	rebootStatus = fptest.WaitForRebootInactive(t, dut, statusReq, cancelTimeout)
+	t.Logf("DUT rebootStatus: %v", rebootStatus)
 }
 
 func getSubCompPath(t *testing.T, dut *ondatra.DUTDevice) *tpb.Path {
@@ -26,7 +26,6 @@ import (
 	"github.com/openconfig/ondatra"
 	"github.com/openconfig/ondatra/gnmi"
 	"github.com/openconfig/ondatra/gnmi/oc"
-	"github.com/openconfig/testt"
 )
 
 const (
@@ -159,26 +158,9 @@ func TestChassisReboot(t *testing.T) {
 				}
 			}
 
-			startReboot := time.Now()
 			t.Logf("Wait for DUT to boot up by polling the telemetry output.")
-			for {
-				var currentTime string
-				t.Logf("Time elapsed %.2f seconds since reboot started.", time.Since(startReboot).Seconds())
-				time.Sleep(30 * time.Second)
-				if errMsg := testt.CaptureFatal(t, func(t testing.TB) {
-					currentTime = gnmi.Get(t, dut, gnmi.OC().System().CurrentDatetime().State())
-				}); errMsg != nil {
-					t.Logf("Got testt.CaptureFatal errMsg: %s, keep polling ...", *errMsg)
-				} else {
-					t.Logf("Device rebooted successfully with received time: %v", currentTime)
-					break
-				}
-
-				if uint64(time.Since(startReboot).Seconds()) > maxRebootTime {
-					t.Errorf("Check boot time: got %v, want < %v", time.Since(startReboot), maxRebootTime)
-				}
-			}
-			t.Logf("Device boot time: %.2f seconds", time.Since(startReboot).Seconds())
+			rebootTime := fptest.WaitForGNMIReachable(t, dut, maxRebootTime*time.Second)
+			t.Logf("Device boot time: %.2f seconds", rebootTime.Seconds())
 
 			bootTimeAfterReboot := gnmi.Get(t, dut, gnmi.OC().System().BootTime().State())
 			t.Logf("DUT boot time after reboot: %v", bootTimeAfterReboot)
@@ -215,6 +197,9 @@ func TestChassisReboot(t *testing.T) {
 				time.Sleep(10 * time.Second)
 			}
 
+			t.Logf("Wait for all the ports on DUT to come up")
+			fptest.WaitForPortsUp(t, dut, maxCompWaitTime*time.Second)
+
 			versions = gnmi.GetAll(t, dut, gnmi.OC().ComponentAny().SoftwareVersion().State())
 			swVersion := FetchUniqueItems(t, versions)
 			sort.Strings(swVersion)
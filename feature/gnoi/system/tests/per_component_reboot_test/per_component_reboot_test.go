@@ -25,8 +25,6 @@ import (
 	"github.com/openconfig/featureprofiles/internal/fptest"
 	"github.com/openconfig/featureprofiles/internal/helpers"
 	"github.com/openconfig/ondatra"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 
 	spb "github.com/openconfig/gnoi/system"
 	tpb "github.com/openconfig/gnoi/types"
@@ -204,24 +202,7 @@ func TestLinecardReboot(t *testing.T) {
 	if deviations.GNOISubcomponentRebootStatusUnsupported(dut) {
 		req.Subcomponents = nil
 	}
-	rebootDeadline := time.Now().Add(linecardBoottime)
-	for retry := true; retry; {
-		t.Log("Waiting for 10 seconds before checking.")
-		time.Sleep(10 * time.Second)
-		if time.Now().After(rebootDeadline) {
-			retry = false
-			break
-		}
-		resp, err := gnoiClient.System().RebootStatus(context.Background(), req)
-		switch {
-		case status.Code(err) == codes.Unimplemented:
-			t.Fatalf("Unimplemented RebootStatus() is not fully compliant with the Reboot spec.")
-		case err == nil:
-			retry = resp.GetActive()
-		default:
-			// any other error just sleep.
-		}
-	}
+	fptest.WaitForRebootInactive(t, dut, req, linecardBoottime)
 
 	t.Logf("Validate removable linecard %v status", removableLinecard)
 	gnmi.Await(t, dut, gnmi.OC().Component(removableLinecard).Removable().State(), linecardBoottime, true)
@@ -292,21 +273,9 @@ func TestFabricReboot(t *testing.T) {
 	if deviations.GNOISubcomponentRebootStatusUnsupported(dut) {
 		req.Subcomponents = nil
 	}
-	rebootDeadline := time.Now().Add(fabricBootTime)
-	for {
-		t.Log("Waiting for 10 seconds before checking.")
-		time.Sleep(10 * time.Second)
-		if time.Now().After(rebootDeadline) {
-			break
-		}
-		resp, err := gnoiClient.System().RebootStatus(context.Background(), req)
-		if status.Code(err) == codes.Unimplemented {
-			t.Fatalf("Unimplemented RebootStatus() is not fully compliant with the Reboot spec.")
-		}
-		if !resp.GetActive() {
-			break
-		}
-	}
+	t.Logf("Wait for 10s to allow the sub component's reboot process to start")
+	time.Sleep(10 * time.Second)
+	fptest.WaitForRebootInactive(t, dut, req, fabricBootTime)
 
 	// Wait for the fabric component to come back up.
 	t.Logf("Validate removable fabric component %v status", removableFabric)
@@ -0,0 +1,203 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set_package_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"flag"
+	"hash"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	fpb "github.com/openconfig/gnoi/file"
+	spb "github.com/openconfig/gnoi/system"
+	tpb "github.com/openconfig/gnoi/types"
+)
+
+var (
+	packageFile = flag.String("package_file", "",
+		"local package pushed with SetPackage; if empty, a random payload of -package_size bytes is pushed")
+	packageSize = flag.Int("package_size", 8*1024*1024, "size in bytes of the random payload pushed when -package_file is empty")
+	packageDir  = flag.String("package_dir", "/tmp", "directory on the DUT to which packages are pushed")
+)
+
+const (
+	// chunkSize is the maximum size of a SetPackage contents message.
+	chunkSize  = 64 * 1024
+	rpcTimeout = 10 * time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// payload returns the contents of the package pushed by the test.
+func payload(t *testing.T) []byte {
+	t.Helper()
+	if *packageFile != "" {
+		b, err := os.ReadFile(*packageFile)
+		if err != nil {
+			t.Fatalf("Cannot read package file %q: %v", *packageFile, err)
+		}
+		return b
+	}
+	b := make([]byte, *packageSize)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Cannot generate random payload: %v", err)
+	}
+	return b
+}
+
+// hashOf returns the hash of b with the given method.
+func hashOf(t *testing.T, method tpb.HashType_HashMethod, b []byte) []byte {
+	t.Helper()
+	var h hash.Hash
+	switch method {
+	case tpb.HashType_SHA256:
+		h = sha256.New()
+	case tpb.HashType_SHA512:
+		h = sha512.New()
+	case tpb.HashType_MD5:
+		h = md5.New()
+	default:
+		t.Fatalf("Unsupported hash method %v", method)
+	}
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// setPackage streams content to the DUT with SetPackage, in chunks of at most
+// chunkSize bytes, followed by the given hash, and returns the result of the
+// RPC.
+func setPackage(t *testing.T, dut *ondatra.DUTDevice, filename string, content []byte, h *tpb.HashType) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	stream, err := dut.RawAPIs().GNOI(t).System().SetPackage(ctx)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&spb.SetPackageRequest{
+		Request: &spb.SetPackageRequest_Package{Package: &spb.Package{Filename: filename}},
+	}); err != nil {
+		return err
+	}
+	chunks := 0
+	for start := 0; start < len(content); start += chunkSize {
+		end := min(start+chunkSize, len(content))
+		if err := stream.Send(&spb.SetPackageRequest{
+			Request: &spb.SetPackageRequest_Contents{Contents: content[start:end]},
+		}); err != nil {
+			return err
+		}
+		chunks++
+	}
+	t.Logf("Sent %d bytes of %s in %d chunks", len(content), filename, chunks)
+	if err := stream.Send(&spb.SetPackageRequest{
+		Request: &spb.SetPackageRequest_Hash{Hash: h},
+	}); err != nil {
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// statFile returns the size of the file on the DUT, and whether it exists.
+func statFile(t *testing.T, dut *ondatra.DUTDevice, filename string) (uint64, bool) {
+	t.Helper()
+	resp, err := dut.RawAPIs().GNOI(t).File().Stat(context.Background(), &fpb.StatRequest{Path: filename})
+	if status.Code(err) == codes.NotFound {
+		return 0, false
+	}
+	if err != nil {
+		t.Fatalf("File.Stat(%q) failed: %v", filename, err)
+	}
+	for _, s := range resp.GetStats() {
+		if s.GetPath() == filename {
+			return s.GetSize(), true
+		}
+	}
+	return 0, false
+}
+
+// removeFile removes the file from the DUT if it exists.
+func removeFile(t *testing.T, dut *ondatra.DUTDevice, filename string) {
+	t.Helper()
+	if _, ok := statFile(t, dut, filename); !ok {
+		return
+	}
+	if _, err := dut.RawAPIs().GNOI(t).File().Remove(context.Background(), &fpb.RemoveRequest{RemoteFile: filename}); err != nil {
+		t.Errorf("File.Remove(%q) failed: %v", filename, err)
+	}
+}
+
+// TestSetPackage pushes a package with each hash method and verifies it is
+// stored on the DUT with the expected size.
+func TestSetPackage(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	content := payload(t)
+	for _, method := range []tpb.HashType_HashMethod{tpb.HashType_SHA256, tpb.HashType_SHA512, tpb.HashType_MD5} {
+		t.Run(method.String(), func(t *testing.T) {
+			filename := path.Join(*packageDir, "featureprofiles-package-"+method.String()+".bin")
+			defer removeFile(t, dut, filename)
+
+			h := &tpb.HashType{Method: method, Hash: hashOf(t, method, content)}
+			if err := setPackage(t, dut, filename, content, h); err != nil {
+				if status.Code(err) == codes.Unimplemented {
+					t.Skipf("SetPackage with %v is not supported: %v", method, err)
+				}
+				t.Fatalf("SetPackage(%q) with %v hash failed: %v", filename, method, err)
+			}
+			size, ok := statFile(t, dut, filename)
+			if !ok {
+				t.Fatalf("File.Stat(%q): file not found after SetPackage", filename)
+			}
+			if got, want := size, uint64(len(content)); got != want {
+				t.Errorf("File.Stat(%q) size: got %d, want %d", filename, got, want)
+			}
+		})
+	}
+}
+
+// TestSetPackageHashMismatch pushes a package with a hash which does not
+// match its contents, and verifies the DUT rejects it and does not keep it.
+func TestSetPackageHashMismatch(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	content := payload(t)
+	filename := path.Join(*packageDir, "featureprofiles-package-bad-hash.bin")
+	defer removeFile(t, dut, filename)
+
+	sum := hashOf(t, tpb.HashType_SHA256, content)
+	sum[0] ^= 0xff
+	err := setPackage(t, dut, filename, content, &tpb.HashType{Method: tpb.HashType_SHA256, Hash: sum})
+	if err == nil {
+		t.Fatalf("SetPackage(%q) with mismatched hash succeeded, want error", filename)
+	}
+	t.Logf("SetPackage(%q) with mismatched hash failed as expected: %v", filename, err)
+	if _, ok := statFile(t, dut, filename); ok {
+		t.Errorf("File.Stat(%q): file found after SetPackage with mismatched hash, want it removed", filename)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system_time_test
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/gnoigo/system"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnoi"
+)
+
+var (
+	maxHostSkew = flag.Duration("max_host_skew", 5*time.Second,
+		"maximum allowed difference between System.Time of the DUT and the clock of the test host")
+	maxTelemetrySkew = flag.Duration("max_telemetry_skew", 2*time.Second,
+		"maximum allowed difference between System.Time and the clock of the DUT reported by gNMI")
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// systemTime returns the DUT time reported by gNOI System.Time, and the
+// round-trip time of the RPC.
+func systemTime(t *testing.T, dut *ondatra.DUTDevice) (time.Time, time.Duration) {
+	t.Helper()
+	start := time.Now()
+	resp := gnoi.Execute(t, dut, system.NewTimeOperation())
+	rtt := time.Since(start)
+	if resp.GetTime() == 0 {
+		t.Fatalf("System.Time returned time 0, want current time")
+	}
+	return time.Unix(0, int64(resp.GetTime())), rtt
+}
+
+// skew returns the absolute difference between a and b.
+func skew(a, b time.Time) time.Duration {
+	if d := a.Sub(b); d >= 0 {
+		return d
+	}
+	return b.Sub(a)
+}
+
+// TestHostClockSkew verifies that System.Time of the DUT is within
+// -max_host_skew of the clock of the test host.
+func TestHostClockSkew(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	before := time.Now()
+	got, rtt := systemTime(t, dut)
+	// Compare against the midpoint of the RPC to discount network latency.
+	host := before.Add(rtt / 2)
+	t.Logf("System.Time: %v, host time: %v, RPC round-trip: %v", got, host, rtt)
+	if s := skew(got, host); s > *maxHostSkew {
+		t.Errorf("System.Time skew against host clock: got %v, want <= %v", s, *maxHostSkew)
+	}
+}
+
+// TestTelemetryClockSkew verifies that /system/state/current-datetime agrees
+// with System.Time.
+func TestTelemetryClockSkew(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	before, _ := systemTime(t, dut)
+	val := gnmi.Get(t, dut, gnmi.OC().System().CurrentDatetime().State())
+	after, _ := systemTime(t, dut)
+
+	got, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		t.Fatalf("Cannot parse current-datetime %q: %v", val, err)
+	}
+	t.Logf("current-datetime: %v, System.Time before: %v, after: %v", got, before, after)
+	// current-datetime has a resolution of one second, so allow for
+	// truncation on top of the configured skew.
+	if got.Before(before.Add(-*maxTelemetrySkew-time.Second)) || got.After(after.Add(*maxTelemetrySkew)) {
+		t.Errorf("current-datetime %v not within %v of System.Time range [%v, %v]", got, *maxTelemetrySkew, before, after)
+	}
+}
+
+// TestNotificationTimestamps verifies that the timestamps of gNMI
+// notifications are consistent with System.Time and do not go backwards.
+func TestNotificationTimestamps(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	const samples = 3
+
+	var last time.Time
+	for i := 0; i < samples; i++ {
+		before, _ := systemTime(t, dut)
+		val := gnmi.Lookup(t, dut, gnmi.OC().System().CurrentDatetime().State())
+		after, _ := systemTime(t, dut)
+
+		ts := val.Timestamp
+		t.Logf("Notification timestamp: %v, System.Time before: %v, after: %v", ts, before, after)
+		if ts.IsZero() {
+			t.Fatalf("Notification for %s has no timestamp", val.Path)
+		}
+		if ts.Before(before.Add(-*maxTelemetrySkew)) || ts.After(after.Add(*maxTelemetrySkew)) {
+			t.Errorf("Notification timestamp %v not within %v of System.Time range [%v, %v]", ts, *maxTelemetrySkew, before, after)
+		}
+		if ts.Before(last) {
+			t.Errorf("Notification timestamp went backwards: got %v after %v", ts, last)
+		}
+		last = ts
+		time.Sleep(time.Second)
+	}
+}
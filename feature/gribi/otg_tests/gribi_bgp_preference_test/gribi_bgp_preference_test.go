@@ -0,0 +1,314 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gribi_bgp_preference_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/args"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/gribi"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/gribigo/fluent"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+
+	spb "github.com/openconfig/gribi/v1/proto/service"
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// The testbed consists of ate:port1 -> dut:port1, dut:port2 -> ate:port2 and
+// dut:port3 -> ate:port3. ate:port2 is an eBGP peer of the DUT advertising
+// dstPrefix, and the gRIBI client installs the same prefix with a next hop
+// of ate:port3. Traffic is sent from ate:port1 to dstPrefix.
+const (
+	dstPrefix    = "198.51.100.0/24"
+	dstAddr      = "198.51.100.0"
+	dstPrefixLen = 24
+	bgpRouteName = "port2.BGP4.route"
+	flowName     = "PreferenceFlow"
+
+	nhIndex  = 1
+	nhgIndex = 42
+
+	// bgpPreferredDistance and gribiPreferredDistance are the BGP
+	// external-route-distance values used to make BGP respectively more and
+	// less preferred than gRIBI. The DUT's gRIBI preference must lie strictly
+	// between the two.
+	bgpPreferredDistance   = 1
+	gribiPreferredDistance = 250
+
+	fps             = 10000 // traffic frames per second
+	trafficDuration = 20 * time.Second
+	// lossTolerancePct is the share of frames that may be received on or lost
+	// towards the non-preferred port in steady state.
+	lossTolerancePct = 1
+)
+
+type testCase struct {
+	desc string
+	// distance is the BGP external-route-distance configured for the case.
+	distance uint8
+	// gribiResult is the expected programming result of the gRIBI IPv4Entry.
+	gribiResult fluent.ProgrammingResult
+	// wantProtocol is the origin protocol expected for dstPrefix in the AFT.
+	wantProtocol oc.E_PolicyTypes_INSTALL_PROTOCOL_TYPE
+	// wantPort and fallbackPort are the ATE ports expected to receive traffic
+	// before and after the preferred source is withdrawn.
+	wantPort, fallbackPort string
+	// withdraw removes the preferred source of dstPrefix.
+	withdraw func(t *testing.T, tc *testContext)
+}
+
+// testContext holds the objects shared by the test cases.
+type testContext struct {
+	dut    *ondatra.DUTDevice
+	ate    *ondatra.ATEDevice
+	top    gosnappi.Config
+	client *gribi.Client
+}
+
+// configureBGP sets up the DUT and ATE interfaces and an eBGP session with
+// ate:port2 over which dstPrefix is advertised.
+func configureBGP(t *testing.T) *cfgplugins.BGPSession {
+	t.Helper()
+	bs := cfgplugins.NewBGPSession(t, cfgplugins.PortCount4, nil)
+	bs.WithEBGP(t, []oc.E_BgpTypes_AFI_SAFI_TYPE{oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST}, []string{"port2"}, false, false)
+
+	for _, d := range bs.ATETop.Devices().Items() {
+		if d.Name() != bs.ATEPorts[1].Name {
+			continue
+		}
+		peer := d.Bgp().Ipv4Interfaces().Items()[0].Peers().Items()[0]
+		route := peer.V4Routes().Add().SetName(bgpRouteName)
+		route.SetNextHopIpv4Address(bs.ATEPorts[1].IPv4).
+			SetNextHopAddressType(gosnappi.BgpV4RouteRangeNextHopAddressType.IPV4).
+			SetNextHopMode(gosnappi.BgpV4RouteRangeNextHopMode.MANUAL)
+		route.Addresses().Add().SetAddress(dstAddr).SetPrefix(dstPrefixLen).SetCount(1)
+	}
+
+	flow := bs.ATETop.Flows().Add().SetName(flowName)
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Device().
+		SetTxNames([]string{bs.ATEPorts[0].Name + ".IPv4"}).
+		SetRxNames([]string{bs.ATEPorts[1].Name + ".IPv4", bs.ATEPorts[2].Name + ".IPv4"})
+	flow.Rate().SetPps(fps)
+	flow.Duration().Continuous()
+	flow.Packet().Add().Ethernet().Src().SetValue(bs.ATEPorts[0].MAC)
+	v4 := flow.Packet().Add().Ipv4()
+	v4.Src().SetValue(bs.ATEPorts[0].IPv4)
+	v4.Dst().Increment().SetStart("198.51.100.1").SetCount(250)
+
+	if err := bs.PushAndStart(t); err != nil {
+		t.Fatalf("Failed to push BGP config: %v", err)
+	}
+	cfgplugins.VerifyDUTBGPEstablished(t, bs.DUT)
+	cfgplugins.VerifyOTGBGPEstablished(t, bs.ATE)
+	return bs
+}
+
+// setRouteDistance configures the BGP external-route-distance on the DUT.
+func setRouteDistance(t *testing.T, dut *ondatra.DUTDevice, distance uint8) {
+	t.Helper()
+	bgpPath := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(cfgplugins.PTBGP, "BGP").Bgp()
+	gnmi.Update(t, dut, bgpPath.Global().DefaultRouteDistance().ExternalRouteDistance().Config(), distance)
+}
+
+// setBGPRoute advertises or withdraws dstPrefix from ate:port2.
+func setBGPRoute(t *testing.T, ate *ondatra.ATEDevice, state gosnappi.StateProtocolRouteStateEnum) {
+	t.Helper()
+	cs := gosnappi.NewControlState()
+	cs.Protocol().Route().SetNames([]string{bgpRouteName}).SetState(state)
+	ate.OTG().SetControlState(t, cs)
+}
+
+// awaitOriginProtocol waits for dstPrefix to be present in the AFT with the
+// given origin protocol.
+func awaitOriginProtocol(t *testing.T, dut *ondatra.DUTDevice, want oc.E_PolicyTypes_INSTALL_PROTOCOL_TYPE) {
+	t.Helper()
+	ipv4Path := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Afts().Ipv4Entry(dstPrefix)
+	_, ok := gnmi.Watch(t, dut, ipv4Path.State(), time.Minute, func(val *ygnmi.Value[*oc.NetworkInstance_Afts_Ipv4Entry]) bool {
+		entry, present := val.Val()
+		return present && entry.GetOriginProtocol() == want
+	}).Await(t)
+	if !ok {
+		t.Errorf("AFT origin-protocol for %s did not become %v", dstPrefix, want)
+	}
+}
+
+// hasFIBResult reports whether the gRIBI client received a FIB_PROGRAMMED
+// result for dstPrefix.
+func hasFIBResult(t *testing.T, c *gribi.Client) bool {
+	t.Helper()
+	for _, r := range c.Fluent(t).Results(t) {
+		if r.Details != nil && r.Details.IPv4Prefix == dstPrefix && r.ProgrammingResult == spb.AFTResult_FIB_PROGRAMMED {
+			return true
+		}
+	}
+	return false
+}
+
+// rxFrames returns the number of frames received on ate:port2 and ate:port3.
+func rxFrames(t *testing.T, ate *ondatra.ATEDevice) map[string]uint64 {
+	t.Helper()
+	rx := map[string]uint64{}
+	for _, p := range []string{"port2", "port3"} {
+		rx[p] = gnmi.Get(t, ate.OTG(), gnmi.OTG().Port(ate.Port(t, p).ID()).Counters().InFrames().State())
+	}
+	return rx
+}
+
+// sendTraffic runs the flow for trafficDuration, invoking trigger halfway
+// through if it is set. It returns the number of frames sent and the number
+// of frames received on each egress port during the run.
+func sendTraffic(t *testing.T, tc *testContext, trigger func()) (uint64, map[string]uint64) {
+	t.Helper()
+	otg := tc.ate.OTG()
+	before := rxFrames(t, tc.ate)
+	otg.StartTraffic(t)
+	time.Sleep(trafficDuration / 2)
+	if trigger != nil {
+		trigger()
+	}
+	time.Sleep(trafficDuration / 2)
+	otg.StopTraffic(t)
+	otgutils.LogFlowMetrics(t, otg, tc.top)
+
+	tx := gnmi.Get(t, otg, gnmi.OTG().Flow(flowName).Counters().OutPkts().State())
+	rx := rxFrames(t, tc.ate)
+	for p := range rx {
+		rx[p] -= before[p]
+	}
+	return tx, rx
+}
+
+// verifyForwarding checks that traffic to dstPrefix is received on wantPort
+// and not on otherPort.
+func verifyForwarding(t *testing.T, tc *testContext, wantPort, otherPort string) {
+	t.Helper()
+	tx, rx := sendTraffic(t, tc, nil)
+	if tx == 0 {
+		t.Fatalf("No traffic was sent on flow %s", flowName)
+	}
+	if got := rx[wantPort]; got < tx*(100-lossTolerancePct)/100 {
+		t.Errorf("Frames received on %s: got %d, want at least %d%% of %d sent", wantPort, got, 100-lossTolerancePct, tx)
+	}
+	if got := rx[otherPort]; got > tx*lossTolerancePct/100 {
+		t.Errorf("Frames received on %s: got %d, want none", otherPort, got)
+	}
+}
+
+// verifyConvergence withdraws the preferred source while traffic is running
+// and checks that the traffic loss during the switch to the fallback source
+// is within the configured convergence budget.
+func verifyConvergence(t *testing.T, tc *testContext, withdraw func()) {
+	t.Helper()
+	tx, rx := sendTraffic(t, tc, withdraw)
+	var received uint64
+	for _, n := range rx {
+		received += n
+	}
+	var lost uint64
+	if tx > received {
+		lost = tx - received
+	}
+	lossMs := lost / (fps / 1000)
+	if lossMs > *args.ConvergencePathChange {
+		t.Errorf("Traffic loss %v msecs more than expected %v msecs", lossMs, *args.ConvergencePathChange)
+	}
+	t.Logf("Traffic loss during path change: %v msecs", lossMs)
+}
+
+func TestGRIBIBGPPreference(t *testing.T) {
+	bs := configureBGP(t)
+	dut, ate := bs.DUT, bs.ATE
+	dni := deviations.DefaultNetworkInstance(dut)
+	defer ate.OTG().StopProtocols(t)
+
+	client := &gribi.Client{
+		DUT:         dut,
+		FIBACK:      true,
+		Persistence: true,
+	}
+	if err := client.Start(t); err != nil {
+		t.Fatalf("gRIBI Connection can not be established")
+	}
+	defer client.Close(t)
+	client.BecomeLeader(t)
+
+	tc := &testContext{
+		dut:    dut,
+		ate:    ate,
+		top:    bs.ATETop,
+		client: client,
+	}
+
+	cases := []testCase{{
+		desc:         "BGP preferred over gRIBI",
+		distance:     bgpPreferredDistance,
+		gribiResult:  fluent.InstalledInRIB,
+		wantProtocol: oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP,
+		wantPort:     "port2",
+		fallbackPort: "port3",
+		withdraw: func(t *testing.T, tc *testContext) {
+			setBGPRoute(t, tc.ate, gosnappi.StateProtocolRouteState.WITHDRAW)
+		},
+	}, {
+		desc:         "gRIBI preferred over BGP",
+		distance:     gribiPreferredDistance,
+		gribiResult:  fluent.InstalledInFIB,
+		wantProtocol: oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_GRIBI,
+		wantPort:     "port3",
+		fallbackPort: "port2",
+		withdraw: func(t *testing.T, tc *testContext) {
+			tc.client.DeleteIPv4(t, dstPrefix, dni, fluent.InstalledInRIB)
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			defer client.FlushAll(t)
+			defer setBGPRoute(t, ate, gosnappi.StateProtocolRouteState.ADVERTISE)
+
+			t.Logf("Setting BGP external-route-distance to %d", c.distance)
+			setRouteDistance(t, dut, c.distance)
+			awaitOriginProtocol(t, dut, oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP)
+
+			client.AddNH(t, nhIndex, bs.ATEPorts[2].IPv4, dni, fluent.InstalledInRIB)
+			client.AddNHG(t, nhgIndex, map[uint64]uint64{nhIndex: 1}, dni, fluent.InstalledInRIB)
+			client.AddIPv4(t, dstPrefix, nhgIndex, dni, "", c.gribiResult)
+			if c.gribiResult == fluent.InstalledInRIB && hasFIBResult(t, client) {
+				t.Errorf("Got FIB_PROGRAMMED for %s, want only RIB_PROGRAMMED while BGP is preferred", dstPrefix)
+			}
+			awaitOriginProtocol(t, dut, c.wantProtocol)
+
+			t.Logf("Verifying traffic is forwarded to ATE %s", c.wantPort)
+			verifyForwarding(t, tc, c.wantPort, c.fallbackPort)
+
+			t.Logf("Withdrawing preferred source, expecting fallback to ATE %s", c.fallbackPort)
+			verifyConvergence(t, tc, func() { c.withdraw(t, tc) })
+			verifyForwarding(t, tc, c.fallbackPort, c.wantPort)
+		})
+	}
+}
@@ -0,0 +1,457 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package negative_operations_test sends malformed or semantically invalid
+// gRIBI operations and validates the result or status code returned for each.
+package negative_operations_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/gribi"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/gribigo/chk"
+	"github.com/openconfig/gribigo/client"
+	"github.com/openconfig/gribigo/constants"
+	"github.com/openconfig/gribigo/fluent"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	aftpb "github.com/openconfig/gribi/v1/proto/gribi_aft"
+	spb "github.com/openconfig/gribi/v1/proto/service"
+)
+
+const (
+	nhID        = 42
+	nhgID       = 43
+	missingNHID = 142
+	missingNHG  = 143
+	dstPfx      = "198.51.100.0/24"
+	missingPfx  = "203.0.113.0/24"
+	missingNI   = "NEGATIVE-TEST-NO-SUCH-VRF"
+	timeout     = time.Minute
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: 30,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: 30,
+	}
+
+	atePort1 = attrs.Attributes{
+		Name:    "port1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: 30,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "port2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: 30,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureDUT configures port1 and port2 on the DUT.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	d := gnmi.OC()
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+
+	gnmi.Replace(t, dut, d.Interface(p1.Name()).Config(), dutPort1.NewOCInterface(p1.Name(), dut))
+	gnmi.Replace(t, dut, d.Interface(p2.Name()).Config(), dutPort2.NewOCInterface(p2.Name(), dut))
+
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		fptest.AssignToNetworkInstance(t, dut, p2.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+}
+
+// configureATE configures port1 and port2 on the ATE so that the next-hop used
+// by the valid entries in this test resolves.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	top := gosnappi.NewConfig()
+	atePort1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	atePort2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	return top
+}
+
+// aftCase describes a single invalid AFT operation.
+type aftCase struct {
+	desc string
+	// setup contains the entries that must be installed before the invalid
+	// operation is sent. Each of them is expected to be RIB_PROGRAMMED.
+	setup []fluent.GRIBIEntry
+	// inject sends the invalid operation on the elected client.
+	inject func(t *testing.T, c *fluent.GRIBIClient)
+	// want is the expected result of the invalid operation.
+	want *client.OpResult
+	// verify, if set, is called after the result has been validated.
+	verify func(t *testing.T, c *fluent.GRIBIClient)
+}
+
+// streamCase describes a ModifyRequest that must cause the DUT to close the
+// Modify RPC.
+type streamCase struct {
+	desc     string
+	req      *spb.ModifyRequest
+	wantCode codes.Code
+}
+
+// flushCase describes a FlushRequest that must be rejected by the DUT.
+type flushCase struct {
+	desc       string
+	req        func(electionID gribi.Uint128) *spb.FlushRequest
+	wantCode   codes.Code
+	wantReason spb.FlushResponseError_Reason
+}
+
+func awaitTimeout(ctx context.Context, t testing.TB, c *fluent.GRIBIClient, timeout time.Duration) error {
+	t.Helper()
+	subctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return c.Await(subctx, t)
+}
+
+// startClient starts an elected primary client with persistence PRESERVE and
+// RIB_ACK, and makes it the leader.
+func startClient(ctx context.Context, t *testing.T, gribic spb.GRIBIClient) (*fluent.GRIBIClient, gribi.Uint128) {
+	t.Helper()
+	c := fluent.NewClient()
+	c.Connection().WithStub(gribic).
+		WithRedundancyMode(fluent.ElectedPrimaryClient).
+		WithPersistence().
+		WithInitialElectionID(1 /* low */, 0 /* hi */)
+	c.Start(ctx, t)
+	c.StartSending(ctx, t)
+	if err := awaitTimeout(ctx, t, c, timeout); err != nil {
+		t.Fatalf("Await got error during session negotiation: %v", err)
+	}
+	eID := gribi.BecomeLeader(t, c)
+	return c, eID
+}
+
+// hasNoFailures fails the test if any of the AFT operations sent so far on
+// the client did not program successfully.
+func hasNoFailures(t *testing.T, c *fluent.GRIBIClient) {
+	t.Helper()
+	for _, r := range c.Results(t) {
+		if r.OperationID == 0 {
+			continue
+		}
+		if r.ProgrammingResult == spb.AFTResult_FAILED || r.ProgrammingResult == spb.AFTResult_FIB_FAILED {
+			t.Fatalf("Prerequisite operation %d failed: %v", r.OperationID, r)
+		}
+	}
+}
+
+func TestAFTOperations(t *testing.T) {
+	ctx := context.Background()
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+	ate := ondatra.ATE(t, "ate")
+	configureATE(t, ate)
+
+	gribic := dut.RawAPIs().GRIBI(t)
+	defaultNI := deviations.DefaultNetworkInstance(dut)
+
+	nh := fluent.NextHopEntry().WithNetworkInstance(defaultNI).
+		WithIndex(nhID).WithIPAddress(atePort2.IPv4)
+	nhg := fluent.NextHopGroupEntry().WithNetworkInstance(defaultNI).
+		WithID(nhgID).AddNextHop(nhID, 1)
+	ipv4 := fluent.IPv4Entry().WithNetworkInstance(defaultNI).
+		WithPrefix(dstPfx).WithNextHopGroup(nhgID)
+
+	cases := []aftCase{{
+		desc: "IPv4Entry references missing NextHopGroup",
+		inject: func(t *testing.T, c *fluent.GRIBIClient) {
+			c.Modify().AddEntry(t, fluent.IPv4Entry().WithNetworkInstance(defaultNI).
+				WithPrefix(dstPfx).WithNextHopGroup(missingNHG))
+		},
+		want: fluent.OperationResult().
+			WithIPv4Operation(dstPfx).
+			WithOperationType(constants.Add).
+			WithProgrammingResult(fluent.ProgrammingFailed).
+			AsResult(),
+	}, {
+		desc: "NextHopGroup references missing NextHop",
+		inject: func(t *testing.T, c *fluent.GRIBIClient) {
+			c.Modify().AddEntry(t, fluent.NextHopGroupEntry().WithNetworkInstance(defaultNI).
+				WithID(missingNHG).AddNextHop(missingNHID, 1))
+		},
+		want: fluent.OperationResult().
+			WithNextHopGroupOperation(missingNHG).
+			WithOperationType(constants.Add).
+			WithProgrammingResult(fluent.ProgrammingFailed).
+			AsResult(),
+	}, {
+		desc:  "Duplicate NextHopGroup ID references missing NextHop",
+		setup: []fluent.GRIBIEntry{nh, nhg},
+		inject: func(t *testing.T, c *fluent.GRIBIClient) {
+			c.Modify().AddEntry(t, fluent.NextHopGroupEntry().WithNetworkInstance(defaultNI).
+				WithID(nhgID).AddNextHop(missingNHID, 1))
+		},
+		want: fluent.OperationResult().
+			WithNextHopGroupOperation(nhgID).
+			WithOperationType(constants.Add).
+			WithProgrammingResult(fluent.ProgrammingFailed).
+			AsResult(),
+		verify: func(t *testing.T, c *fluent.GRIBIClient) {
+			res, err := c.Get().WithNetworkInstance(defaultNI).WithAFT(fluent.NextHopGroup).Send()
+			if err != nil {
+				t.Fatalf("gRIBI Get got unexpected error: %v", err)
+			}
+			chk.GetResponseHasEntries(t, res, nhg)
+		},
+	}, {
+		desc:  "Delete referenced NextHopGroup",
+		setup: []fluent.GRIBIEntry{nh, nhg, ipv4},
+		inject: func(t *testing.T, c *fluent.GRIBIClient) {
+			c.Modify().DeleteEntry(t, nhg)
+		},
+		want: fluent.OperationResult().
+			WithNextHopGroupOperation(nhgID).
+			WithOperationType(constants.Delete).
+			WithProgrammingResult(fluent.ProgrammingFailed).
+			AsResult(),
+	}, {
+		desc:  "Delete referenced NextHop",
+		setup: []fluent.GRIBIEntry{nh, nhg},
+		inject: func(t *testing.T, c *fluent.GRIBIClient) {
+			c.Modify().DeleteEntry(t, nh)
+		},
+		want: fluent.OperationResult().
+			WithNextHopOperation(nhID).
+			WithOperationType(constants.Delete).
+			WithProgrammingResult(fluent.ProgrammingFailed).
+			AsResult(),
+	}, {
+		// DELETE is required to be idempotent, see section 4.1.3.2.1 of the
+		// gRIBI specification.
+		desc: "Delete non-existent IPv4Entry",
+		inject: func(t *testing.T, c *fluent.GRIBIClient) {
+			c.Modify().DeleteEntry(t, fluent.IPv4Entry().WithNetworkInstance(defaultNI).
+				WithPrefix(missingPfx).WithNextHopGroup(nhgID))
+		},
+		want: fluent.OperationResult().
+			WithIPv4Operation(missingPfx).
+			WithOperationType(constants.Delete).
+			WithProgrammingResult(fluent.InstalledInRIB).
+			AsResult(),
+	}, {
+		desc:  "IPv4Entry in missing network instance",
+		setup: []fluent.GRIBIEntry{nh, nhg},
+		inject: func(t *testing.T, c *fluent.GRIBIClient) {
+			c.Modify().AddEntry(t, fluent.IPv4Entry().WithNetworkInstance(missingNI).
+				WithPrefix(dstPfx).WithNextHopGroup(nhgID).WithNextHopGroupNetworkInstance(defaultNI))
+		},
+		want: fluent.OperationResult().
+			WithIPv4Operation(dstPfx).
+			WithOperationType(constants.Add).
+			WithProgrammingResult(fluent.ProgrammingFailed).
+			AsResult(),
+	}, {
+		desc:  "IPv4Entry references NextHopGroup in missing network instance",
+		setup: []fluent.GRIBIEntry{nh, nhg},
+		inject: func(t *testing.T, c *fluent.GRIBIClient) {
+			c.Modify().AddEntry(t, fluent.IPv4Entry().WithNetworkInstance(defaultNI).
+				WithPrefix(dstPfx).WithNextHopGroup(nhgID).WithNextHopGroupNetworkInstance(missingNI))
+		},
+		want: fluent.OperationResult().
+			WithIPv4Operation(dstPfx).
+			WithOperationType(constants.Add).
+			WithProgrammingResult(fluent.ProgrammingFailed).
+			AsResult(),
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, _ := startClient(ctx, t, gribic)
+			defer c.Stop(t)
+			defer func() {
+				if err := gribi.FlushAll(c); err != nil {
+					t.Errorf("Cannot flush: %v", err)
+				}
+			}()
+
+			if len(tc.setup) > 0 {
+				c.Modify().AddEntry(t, tc.setup...)
+				if err := awaitTimeout(ctx, t, c, timeout); err != nil {
+					t.Fatalf("Await got error for prerequisite entries: %v", err)
+				}
+				hasNoFailures(t, c)
+			}
+
+			tc.inject(t, c)
+			if err := awaitTimeout(ctx, t, c, timeout); err != nil {
+				t.Fatalf("Await got error for invalid operation: %v", err)
+			}
+			chk.HasResult(t, c.Results(t), tc.want, chk.IgnoreOperationID())
+
+			if tc.verify != nil {
+				tc.verify(t, c)
+			}
+		})
+	}
+}
+
+func TestModifyStreamErrors(t *testing.T) {
+	ctx := context.Background()
+	dut := ondatra.DUT(t, "dut")
+	gribic := dut.RawAPIs().GRIBI(t)
+	defaultNI := deviations.DefaultNetworkInstance(dut)
+
+	cases := []streamCase{{
+		desc:     "Election ID zero",
+		req:      &spb.ModifyRequest{ElectionId: &spb.Uint128{Low: 0, High: 0}},
+		wantCode: codes.InvalidArgument,
+	}, {
+		desc: "SessionParameters and AFTOperation in same ModifyRequest",
+		req: &spb.ModifyRequest{
+			Params: &spb.SessionParameters{
+				Redundancy:  spb.SessionParameters_SINGLE_PRIMARY,
+				Persistence: spb.SessionParameters_PRESERVE,
+			},
+			Operation: []*spb.AFTOperation{{
+				Id:              1,
+				NetworkInstance: defaultNI,
+				Op:              spb.AFTOperation_ADD,
+				Entry: &spb.AFTOperation_NextHop{
+					NextHop: &aftpb.Afts_NextHopKey{
+						Index:   nhID,
+						NextHop: &aftpb.Afts_NextHop{},
+					},
+				},
+			}},
+		},
+		wantCode: codes.InvalidArgument,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, eID := startClient(ctx, t, gribic)
+			defer c.Stop(t)
+			if op := tc.req.GetOperation(); len(op) > 0 {
+				op[0].ElectionId = &spb.Uint128{Low: eID.Low, High: eID.High}
+			}
+			c.Modify().InjectRequest(t, tc.req)
+			err := awaitTimeout(ctx, t, c, timeout)
+			if err == nil {
+				t.Fatalf("Await got nil error, want Modify RPC closed with %v", tc.wantCode)
+			}
+			chk.HasRecvClientErrorWithStatus(t, err, fluent.ModifyError().WithCode(tc.wantCode).AsStatus(t), chk.IgnoreDetails())
+		})
+	}
+}
+
+func TestFlushErrors(t *testing.T) {
+	ctx := context.Background()
+	dut := ondatra.DUT(t, "dut")
+	gribic := dut.RawAPIs().GRIBI(t)
+
+	cases := []flushCase{{
+		desc: "Unspecified network instance",
+		req: func(eID gribi.Uint128) *spb.FlushRequest {
+			return &spb.FlushRequest{
+				Election: &spb.FlushRequest_Id{Id: &spb.Uint128{Low: eID.Low, High: eID.High}},
+			}
+		},
+		wantCode:   codes.InvalidArgument,
+		wantReason: spb.FlushResponseError_UNSPECIFIED_NETWORK_INSTANCE,
+	}, {
+		desc: "Empty network instance name",
+		req: func(eID gribi.Uint128) *spb.FlushRequest {
+			return &spb.FlushRequest{
+				NetworkInstance: &spb.FlushRequest_Name{Name: ""},
+				Election:        &spb.FlushRequest_Id{Id: &spb.Uint128{Low: eID.Low, High: eID.High}},
+			}
+		},
+		wantCode:   codes.InvalidArgument,
+		wantReason: spb.FlushResponseError_INVALID_NETWORK_INSTANCE,
+	}, {
+		desc: "Missing network instance",
+		req: func(eID gribi.Uint128) *spb.FlushRequest {
+			return &spb.FlushRequest{
+				NetworkInstance: &spb.FlushRequest_Name{Name: missingNI},
+				Election:        &spb.FlushRequest_Id{Id: &spb.Uint128{Low: eID.Low, High: eID.High}},
+			}
+		},
+		wantCode:   codes.InvalidArgument,
+		wantReason: spb.FlushResponseError_NO_SUCH_NETWORK_INSTANCE,
+	}, {
+		desc: "Election ID lower than primary",
+		req: func(eID gribi.Uint128) *spb.FlushRequest {
+			lower := eID.Decrement()
+			return &spb.FlushRequest{
+				NetworkInstance: &spb.FlushRequest_Name{Name: deviations.DefaultNetworkInstance(dut)},
+				Election:        &spb.FlushRequest_Id{Id: &spb.Uint128{Low: lower.Low, High: lower.High}},
+			}
+		},
+		wantCode:   codes.FailedPrecondition,
+		wantReason: spb.FlushResponseError_NOT_PRIMARY,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, eID := startClient(ctx, t, gribic)
+			defer c.Stop(t)
+
+			_, err := gribic.Flush(ctx, tc.req(eID))
+			if err == nil {
+				t.Fatalf("Flush got nil error, want %v", tc.wantCode)
+			}
+			s, ok := status.FromError(err)
+			if !ok {
+				t.Fatalf("Flush got non-status error: %v", err)
+			}
+			if got, want := s.Code(), tc.wantCode; got != want {
+				t.Errorf("Flush got status code %v, want %v", got, want)
+			}
+			var gotReason spb.FlushResponseError_Reason
+			for _, d := range s.Details() {
+				if fe, ok := d.(*spb.FlushResponseError); ok {
+					gotReason = fe.GetStatus()
+				}
+			}
+			if gotReason != tc.wantReason {
+				t.Errorf("Flush got FlushResponseError reason %v, want %v", gotReason, tc.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfix_export_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/ipfixcollector"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+)
+
+// The IPFIX collector runs on the test host, or in a container, which the DUT
+// reaches through its management network.
+var (
+	ipfixListen = flag.String("ipfix_listen", ":4739",
+		"UDP address on which the IPFIX collector listens")
+	ipfixCollector = flag.String("ipfix_collector", "",
+		"address of the IPFIX collector reachable by the DUT; the test is skipped when empty")
+)
+
+const (
+	ipv4PrefixLen = 30
+	ipv6PrefixLen = 126
+
+	// activeTimeout and inactiveTimeout are the timeouts of the flow cache,
+	// in seconds.
+	activeTimeout   = 30
+	inactiveTimeout = 15
+	// templateTimeout is the interval at which the templates are exported,
+	// in seconds.
+	templateTimeout = 30
+	frameSize       = 512
+	ppsRate         = 1000
+	// trafficDuration spans more than 2 active timeouts.
+	trafficDuration = 75 * time.Second
+	// exportSlack is the time the DUT may take, beyond a timeout, to export
+	// the records of the flows which timed out.
+	exportSlack = 15 * time.Second
+	// l2Overhead is the size of the Ethernet header and FCS of the frames,
+	// which the octet counts of the records do not include.
+	l2Overhead = 18
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::1",
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::2",
+		IPv6Len: ipv6PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::5",
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::6",
+		IPv6Len: ipv6PrefixLen,
+	}
+)
+
+// flow is a flow of the ATE, identified by its 5-tuple.
+type flow struct {
+	name             string
+	ipv6             bool
+	protocol         uint8
+	srcPort, dstPort uint16
+}
+
+var flows = []flow{
+	{name: "IPv4UDP", protocol: 17, srcPort: 49152, dstPort: 5001},
+	{name: "IPv6TCP", ipv6: true, protocol: 6, srcPort: 49153, dstPort: 5002},
+}
+
+func (f flow) addrs() (net.IP, net.IP) {
+	if f.ipv6 {
+		return net.ParseIP(atePort1.IPv6), net.ParseIP(atePort2.IPv6)
+	}
+	return net.ParseIP(atePort1.IPv4), net.ParseIP(atePort2.IPv4)
+}
+
+// fields returns the information elements of the 5-tuple and the counts of
+// the records of f.
+func (f flow) fields() []ipfixcollector.IE {
+	ies := []ipfixcollector.IE{
+		ipfixcollector.ProtocolIdentifier,
+		ipfixcollector.SourceTransportPort,
+		ipfixcollector.DestinationTransportPort,
+		ipfixcollector.PacketDeltaCount,
+		ipfixcollector.OctetDeltaCount,
+	}
+	if f.ipv6 {
+		return append(ies, ipfixcollector.SourceIPv6Address, ipfixcollector.DestinationIPv6Address)
+	}
+	return append(ies, ipfixcollector.SourceIPv4Address, ipfixcollector.DestinationIPv4Address)
+}
+
+// match returns whether r is a record of f.
+func (f flow) match(r *ipfixcollector.Record) bool {
+	src, dst := f.addrs()
+	srcIE, dstIE := ipfixcollector.SourceIPv4Address, ipfixcollector.DestinationIPv4Address
+	if f.ipv6 {
+		srcIE, dstIE = ipfixcollector.SourceIPv6Address, ipfixcollector.DestinationIPv6Address
+	}
+	proto, _ := r.Uint(ipfixcollector.ProtocolIdentifier)
+	sport, _ := r.Uint(ipfixcollector.SourceTransportPort)
+	dport, _ := r.Uint(ipfixcollector.DestinationTransportPort)
+	return r.IP(srcIE).Equal(src) && r.IP(dstIE).Equal(dst) &&
+		proto == uint64(f.protocol) && sport == uint64(f.srcPort) && dport == uint64(f.dstPort)
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// exportCLI is the CLI of flow export, which OpenConfig does not model.
+type exportCLI struct {
+	// config exports the IPv4 and IPv6 flows received on the interface %[5]s
+	// to the collector %[1]s on port %[2]d, with the active timeout %[3]d
+	// seconds, the inactive timeout %[4]d seconds and the template timeout
+	// %[6]d seconds.
+	config string
+	// restore deletes the configuration of config.
+	restore string
+}
+
+var exportCLIs = map[ondatra.Vendor]exportCLI{
+	ondatra.ARISTA: {
+		config: `flow tracking hardware
+   tracker fp-ipfix
+      record export on inactive timeout %[4]d000
+      record export on interval %[3]d000
+      exporter fp-collector
+         collector %[1]s port %[2]d
+         format ipfix version 10
+         template interval %[6]d000
+   no shutdown
+interface %[5]s
+   flow tracker hardware fp-ipfix
+`,
+		restore: `interface %[5]s
+   no flow tracker hardware
+no flow tracking hardware
+`,
+	},
+	ondatra.CISCO: {
+		config: `flow exporter-map fp-exporter
+ version v9
+  template data timeout %[6]d
+ !
+ transport udp %[2]d
+ destination %[1]s
+!
+flow monitor-map fp-monitor-v4
+ record ipv4
+ exporter fp-exporter
+ cache timeout active %[3]d
+ cache timeout inactive %[4]d
+!
+flow monitor-map fp-monitor-v6
+ record ipv6
+ exporter fp-exporter
+ cache timeout active %[3]d
+ cache timeout inactive %[4]d
+!
+sampler-map fp-sampler
+ random 1 out-of 1
+!
+interface %[5]s
+ flow ipv4 monitor fp-monitor-v4 sampler fp-sampler ingress
+ flow ipv6 monitor fp-monitor-v6 sampler fp-sampler ingress
+!
+`,
+		restore: `interface %[5]s
+ no flow ipv4 monitor fp-monitor-v4 sampler fp-sampler ingress
+ no flow ipv6 monitor fp-monitor-v6 sampler fp-sampler ingress
+!
+no flow monitor-map fp-monitor-v4
+no flow monitor-map fp-monitor-v6
+no sampler-map fp-sampler
+no flow exporter-map fp-exporter
+`,
+	},
+}
+
+// configureExport configures the DUT to export the flows received on port1 to
+// the collector on port, and deletes the configuration at the end of the
+// test.
+func configureExport(t *testing.T, dut *ondatra.DUTDevice, port uint16) {
+	t.Helper()
+	c, ok := exportCLIs[dut.Vendor()]
+	if !ok {
+		t.Skipf("Flow export is not supported for vendor %v", dut.Vendor())
+	}
+	args := []any{*ipfixCollector, port, activeTimeout, inactiveTimeout, dut.Port(t, "port1").Name(), templateTimeout}
+	clihelper.Push(t, dut, &clihelper.Config{
+		Reason: "IPFIX flow export",
+		CLI:    map[ondatra.Vendor]string{dut.Vendor(): fmt.Sprintf(c.config, args...)},
+	})
+	t.Cleanup(func() {
+		clihelper.Push(t, dut, &clihelper.Config{
+			Reason: "removal of IPFIX flow export",
+			CLI:    map[ondatra.Vendor]string{dut.Vendor(): fmt.Sprintf(c.restore, args...)},
+		})
+	})
+}
+
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	d := gnmi.OC()
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+	gnmi.Replace(t, dut, d.Interface(p1.Name()).Config(), dutPort1.NewOCInterface(p1.Name(), dut))
+	gnmi.Replace(t, dut, d.Interface(p2.Name()).Config(), dutPort2.NewOCInterface(p2.Name(), dut))
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		fptest.AssignToNetworkInstance(t, dut, p2.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+}
+
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	atePort1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	atePort2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+
+	for _, fl := range flows {
+		src, dst := fl.addrs()
+		f := top.Flows().Add().SetName(fl.name)
+		f.Metrics().SetEnable(true)
+		f.Size().SetFixed(frameSize)
+		f.Rate().SetPps(ppsRate)
+		f.Duration().Continuous()
+		f.Packet().Add().Ethernet().Src().SetValue(atePort1.MAC)
+		if fl.ipv6 {
+			f.TxRx().Device().SetTxNames([]string{atePort1.Name + ".IPv6"}).SetRxNames([]string{atePort2.Name + ".IPv6"})
+			ip := f.Packet().Add().Ipv6()
+			ip.Src().SetValue(src.String())
+			ip.Dst().SetValue(dst.String())
+		} else {
+			f.TxRx().Device().SetTxNames([]string{atePort1.Name + ".IPv4"}).SetRxNames([]string{atePort2.Name + ".IPv4"})
+			ip := f.Packet().Add().Ipv4()
+			ip.Src().SetValue(src.String())
+			ip.Dst().SetValue(dst.String())
+		}
+		switch fl.protocol {
+		case 6:
+			tcp := f.Packet().Add().Tcp()
+			tcp.SrcPort().SetValue(uint32(fl.srcPort))
+			tcp.DstPort().SetValue(uint32(fl.dstPort))
+		case 17:
+			udp := f.Packet().Add().Udp()
+			udp.SrcPort().SetValue(uint32(fl.srcPort))
+			udp.DstPort().SetValue(uint32(fl.dstPort))
+		}
+	}
+	return top
+}
+
+func TestIPFIXExport(t *testing.T) {
+	if *ipfixCollector == "" {
+		t.Skip("No IPFIX collector address given by -ipfix_collector")
+	}
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	c, err := ipfixcollector.Listen(*ipfixListen)
+	if err != nil {
+		t.Fatalf("Cannot start IPFIX collector: %v", err)
+	}
+	defer c.Close()
+
+	configureDUT(t, dut)
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	defer ate.OTG().StopProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+	configureExport(t, dut, c.Port())
+
+	t.Run("Templates", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*templateTimeout*time.Second)
+		defer cancel()
+		for _, fl := range flows {
+			tmpl, err := c.AwaitTemplate(ctx, func(tp *ipfixcollector.Template) bool { return tp.Has(fl.fields()...) })
+			if err != nil {
+				t.Errorf("No template with the fields %v of flow %s within %v: %v\nReceived templates: %v",
+					fl.fields(), fl.name, 2*templateTimeout*time.Second, err, c.Templates(nil))
+				continue
+			}
+			t.Logf("IPFIX collector received %v for flow %s", tmpl, fl.name)
+		}
+	})
+
+	// Records of earlier traffic are discarded; the templates are kept.
+	c.Reset()
+	ate.OTG().StartTraffic(t)
+	time.Sleep(trafficDuration)
+	ate.OTG().StopTraffic(t)
+	stop := time.Now()
+	time.Sleep(inactiveTimeout*time.Second + exportSlack)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+	for _, err := range c.Errors() {
+		t.Errorf("IPFIX collector could not decode a message: %v", err)
+	}
+
+	for _, fl := range flows {
+		t.Run(fl.name, func(t *testing.T) {
+			recs := c.Records(fl.match)
+			if len(recs) == 0 {
+				t.Fatalf("No record of flow %s, received %d records", fl.name, len(c.Records(nil)))
+			}
+
+			t.Run("Counts", func(t *testing.T) {
+				var pkts, octets uint64
+				for _, r := range recs {
+					p, _ := r.Uint(ipfixcollector.PacketDeltaCount)
+					o, _ := r.Uint(ipfixcollector.OctetDeltaCount)
+					pkts += p
+					octets += o
+				}
+				txPkts := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(fl.name).Counters().OutPkts().State())
+				if pkts != txPkts {
+					t.Errorf("Packets of the records of flow %s: got %d, want %d", fl.name, pkts, txPkts)
+				}
+				if want := pkts * (frameSize - l2Overhead); octets != want {
+					t.Errorf("Octets of the records of flow %s: got %d, want %d for %d packets of %d bytes", fl.name, octets, want, pkts, frameSize)
+				}
+			})
+
+			t.Run("ActiveTimeout", func(t *testing.T) {
+				// The flow is active throughout the traffic, so its records are
+				// exported at each active timeout.
+				var active []*ipfixcollector.Record
+				for _, r := range recs {
+					if r.Received.Before(stop) {
+						active = append(active, r)
+					}
+				}
+				if want := int(trafficDuration / (activeTimeout * time.Second)); len(active) < want {
+					t.Errorf("Records of flow %s during traffic: got %d, want at least %d with active timeout %ds", fl.name, len(active), want, activeTimeout)
+				}
+				for _, r := range active {
+					if reason, ok := r.Uint(ipfixcollector.FlowEndReason); ok && reason != ipfixcollector.ActiveTimeout {
+						t.Errorf("Flow end reason of %v during traffic: got %d, want %d", r, reason, ipfixcollector.ActiveTimeout)
+					}
+				}
+			})
+
+			t.Run("InactiveTimeout", func(t *testing.T) {
+				// The last record is exported once the flow is inactive, and no
+				// record follows it.
+				last := recs[len(recs)-1]
+				if !last.Received.After(stop) {
+					t.Fatalf("Last record of flow %s received at %v, want after the traffic stopped at %v", fl.name, last.Received, stop)
+				}
+				if reason, ok := last.Uint(ipfixcollector.FlowEndReason); ok && reason != ipfixcollector.IdleTimeout {
+					t.Errorf("Flow end reason of the last record of flow %s: got %d, want %d", fl.name, reason, ipfixcollector.IdleTimeout)
+				}
+				if p, _ := last.Uint(ipfixcollector.PacketDeltaCount); p == 0 {
+					t.Errorf("Last record of flow %s counts no packets", fl.name)
+				}
+				t.Logf("Last record of flow %s received %v after the traffic stopped", fl.name, last.Received.Sub(stop))
+			})
+		})
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wred_ecn_congestion_test
+
+import (
+	"flag"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/featureprofiles/internal/qoscfg"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+)
+
+var (
+	trafficDuration = flag.Duration("traffic_duration", 30*time.Second, "duration of the traffic of each test case")
+	minMarkedPct    = flag.Float64("min_marked_pct", 50, "minimum percentage of the received ECN capable packets which are CE marked under congestion")
+)
+
+// The testbed consists of ate:port1 -> dut:port1, ate:port2 -> dut:port2 and
+// dut:port3 -> ate:port3, where port3 is oversubscribed by port1 and port2.
+const (
+	plen        = 31
+	frameSize   = 1000
+	tolerance   = 2.0
+	captureName = "port3-capture"
+
+	// ECN codepoints of RFC 3168.
+	ecnNotECT = 0
+	ecnECT0   = 2
+	ecnCE     = 3
+
+	dscpECN  = 26
+	dscpDrop = 0
+
+	ecnProfile  = "ECNProfile"
+	dropProfile = "DropProfile"
+	// The WRED thresholds, in bytes.
+	minThreshold = 80000
+	maxThreshold = 160000
+)
+
+var (
+	ateSrc1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "198.51.100.1",
+		IPv4Len: plen,
+	}
+	ateSrc2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:01:01:01:02",
+		IPv4:    "198.51.100.3",
+		IPv4Len: plen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:01:01:01:03",
+		IPv4:    "198.51.100.5",
+		IPv4Len: plen,
+	}
+	dutPort1 = attrs.Attributes{
+		Desc:    "Input interface port1",
+		IPv4:    "198.51.100.0",
+		IPv4Len: plen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "Input interface port2",
+		IPv4:    "198.51.100.2",
+		IPv4Len: plen,
+	}
+	dutPort3 = attrs.Attributes{
+		Desc:    "Output interface port3",
+		IPv4:    "198.51.100.4",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// flowData is a flow from src to ateDst.
+type flowData struct {
+	src       attrs.Attributes
+	dscp      uint8
+	ecn       uint8
+	ratePct   float32
+	queue     string
+	wantRxPct float32
+}
+
+// configureDUT configures the DUT interfaces, and a QoS policy which
+// classifies DSCP dscpECN into queue ecnQueue with the WRED profile with ECN,
+// and DSCP dscpDrop into queue dropQueue with the WRED profile without ECN.
+// Both queues have the same weight on port3.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice, ecnQueue, dropQueue string) {
+	t.Helper()
+	for _, p := range []struct {
+		port  *ondatra.Port
+		attrs attrs.Attributes
+	}{
+		{dut.Port(t, "port1"), dutPort1},
+		{dut.Port(t, "port2"), dutPort2},
+		{dut.Port(t, "port3"), dutPort3},
+	} {
+		gnmi.Replace(t, dut, gnmi.OC().Interface(p.port.Name()).Config(), p.attrs.NewOCInterface(p.port.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, p.port.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, p.port)
+		}
+	}
+
+	b := qoscfg.New(dut)
+	if deviations.QOSQueueRequiresID(dut) {
+		b.AddQueue(ecnQueue, 5)
+		b.AddQueue(dropQueue, 1)
+	}
+	b.AddForwardingGroup("target-group-ecn", ecnQueue)
+	b.AddForwardingGroup("target-group-drop", dropQueue)
+	b.AddClassifier("dscp_based_classifier_ipv4", oc.Qos_Classifier_Type_IPV4,
+		qoscfg.ClassifierTerm{ID: "0", TargetGroup: "target-group-drop", DSCP: []uint8{0, 1, 2, 3}},
+		qoscfg.ClassifierTerm{ID: "1", TargetGroup: "target-group-ecn", DSCP: []uint8{24, 25, 26, 27}},
+	)
+	for _, port := range []string{"port1", "port2"} {
+		b.AddInputClassifier(dut.Port(t, port).Name(), oc.Input_Classifier_Type_IPV4, "dscp_based_classifier_ipv4")
+	}
+	b.AddScheduler("scheduler", 1, oc.Scheduler_Priority_UNSET,
+		qoscfg.SchedulerInput{ID: "ecn", Queue: ecnQueue, Weight: 50},
+		qoscfg.SchedulerInput{ID: "drop", Queue: dropQueue, Weight: 50},
+	)
+	wred := qoscfg.WREDProfile{MinThreshold: minThreshold, MaxThreshold: maxThreshold, MaxDropProbabilityPercent: 100}
+	b.AddWREDProfile(dropProfile, wred)
+	wred.ECN = true
+	b.AddWREDProfile(ecnProfile, wred)
+	dp3 := dut.Port(t, "port3").Name()
+	b.AddOutputSchedulerPolicy(dp3, "scheduler", ecnQueue, dropQueue)
+	b.AddOutputQueueManagementProfile(dp3, ecnQueue, ecnProfile)
+	b.AddOutputQueueManagementProfile(dp3, dropQueue, dropProfile)
+	b.Push(t, dut)
+}
+
+// addFlows replaces the flows of top with flows.
+func addFlows(top gosnappi.Config, flows map[string]*flowData) {
+	top.Flows().Clear()
+	for name, f := range flows {
+		flow := top.Flows().Add().SetName(name)
+		flow.Metrics().SetEnable(true)
+		flow.TxRx().Device().SetTxNames([]string{f.src.Name + ".IPv4"}).SetRxNames([]string{ateDst.Name + ".IPv4"})
+		flow.Packet().Add().Ethernet().Src().SetValue(f.src.MAC)
+		ip := flow.Packet().Add().Ipv4()
+		ip.Src().SetValue(f.src.IPv4)
+		ip.Dst().SetValue(ateDst.IPv4)
+		ip.Priority().Dscp().Phb().SetValue(uint32(f.dscp))
+		ip.Priority().Dscp().Ecn().SetValue(uint32(f.ecn))
+		flow.Size().SetFixed(frameSize)
+		flow.Rate().SetPercentage(f.ratePct)
+	}
+}
+
+// captureStats are the counts of the captured packets of a DSCP by ECN
+// codepoint.
+type captureStats map[uint8]map[uint8]int
+
+// readCapture returns the counts of the IPv4 packets captured on port3.
+func readCapture(t *testing.T, ate *ondatra.ATEDevice) captureStats {
+	t.Helper()
+	stats := captureStats{}
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port3").ID()) {
+		ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok || ip.DstIP.String() != ateDst.IPv4 {
+			continue
+		}
+		dscp, ecn := ip.TOS>>2, ip.TOS&0x3
+		if stats[dscp] == nil {
+			stats[dscp] = map[uint8]int{}
+		}
+		stats[dscp][ecn]++
+	}
+	return stats
+}
+
+// queueCounters returns the counters of the output queue of port3.
+func queueCounters(t *testing.T, dut *ondatra.DUTDevice, queue string) *oc.Qos_Interface_Output_Queue {
+	t.Helper()
+	return gnmi.Get(t, dut, gnmi.OC().Qos().Interface(dut.Port(t, "port3").Name()).Output().Queue(queue).State())
+}
+
+func TestWREDECNCongestion(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	queues := netutil.CommonTrafficQueues(t, dut)
+	ecnQueue, dropQueue := queues.AF3, queues.BE1
+	configureDUT(t, dut, ecnQueue, dropQueue)
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	ateSrc2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+	ateDst.AddToOTG(top, ate.Port(t, "port3"), &dutPort3)
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{ate.Port(t, "port3").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+
+	cases := []struct {
+		desc       string
+		congestion bool
+		flows      map[string]*flowData
+	}{{
+		desc: "No congestion",
+		flows: map[string]*flowData{
+			"ate1-ecn":  {src: ateSrc1, dscp: dscpECN, ecn: ecnECT0, ratePct: 20, queue: ecnQueue, wantRxPct: 100},
+			"ate1-drop": {src: ateSrc1, dscp: dscpDrop, ecn: ecnNotECT, ratePct: 20, queue: dropQueue, wantRxPct: 100},
+			"ate2-ecn":  {src: ateSrc2, dscp: dscpECN, ecn: ecnECT0, ratePct: 20, queue: ecnQueue, wantRxPct: 100},
+			"ate2-drop": {src: ateSrc2, dscp: dscpDrop, ecn: ecnNotECT, ratePct: 20, queue: dropQueue, wantRxPct: 100},
+		},
+	}, {
+		// Each queue is offered 60% and served 50% of the rate of port3.
+		desc:       "Congestion",
+		congestion: true,
+		flows: map[string]*flowData{
+			"ate1-ecn":  {src: ateSrc1, dscp: dscpECN, ecn: ecnECT0, ratePct: 30, queue: ecnQueue, wantRxPct: 83.3},
+			"ate1-drop": {src: ateSrc1, dscp: dscpDrop, ecn: ecnNotECT, ratePct: 30, queue: dropQueue, wantRxPct: 83.3},
+			"ate2-ecn":  {src: ateSrc2, dscp: dscpECN, ecn: ecnECT0, ratePct: 30, queue: ecnQueue, wantRxPct: 83.3},
+			"ate2-drop": {src: ateSrc2, dscp: dscpDrop, ecn: ecnNotECT, ratePct: 30, queue: dropQueue, wantRxPct: 83.3},
+		},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			addFlows(top, tc.flows)
+			ate.OTG().PushConfig(t, top)
+			ate.OTG().StartProtocols(t)
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+			before := map[string]*oc.Qos_Interface_Output_Queue{
+				ecnQueue:  queueCounters(t, dut, ecnQueue),
+				dropQueue: queueCounters(t, dut, dropQueue),
+			}
+			otgutils.StartCapture(t, ate.OTG())
+			ate.OTG().StartTraffic(t)
+			time.Sleep(*trafficDuration)
+			ate.OTG().StopTraffic(t)
+			otgutils.StopCapture(t, ate.OTG())
+			time.Sleep(30 * time.Second)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+			ateTx := map[string]uint64{}
+			ateLost := map[string]uint64{}
+			for name, f := range tc.flows {
+				counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(name).Counters().State())
+				tx, rx := counters.GetOutPkts(), counters.GetInPkts()
+				if tx == 0 {
+					t.Fatalf("Flow %s sent no packets", name)
+				}
+				ateTx[f.queue] += tx
+				ateLost[f.queue] += tx - rx
+				rxPct := float32(rx) * 100 / float32(tx)
+				t.Logf("Flow %s: %d sent, %d received (%.2f%%)", name, tx, rx, rxPct)
+				if rxPct < f.wantRxPct-tolerance || rxPct > f.wantRxPct+tolerance {
+					t.Errorf("Flow %s: got %.2f%% of the packets received, want %.2f%% ± %.2f%%", name, rxPct, f.wantRxPct, tolerance)
+				}
+			}
+
+			// The drops of each queue are the packets lost by its flows, and
+			// only the queue with ECN marks packets.
+			for _, queue := range []string{ecnQueue, dropQueue} {
+				after := queueCounters(t, dut, queue)
+				dropped := after.GetDroppedPkts() - before[queue].GetDroppedPkts()
+				marked := after.GetEcnMarkedPkts() - before[queue].GetEcnMarkedPkts()
+				t.Logf("Queue %s: %d packets dropped, %d packets ECN marked, %d packets lost by the ATE", queue, dropped, marked, ateLost[queue])
+				if diff := math.Abs(float64(dropped) - float64(ateLost[queue])); diff*100 > tolerance*float64(ateTx[queue]) {
+					t.Errorf("Queue %s: got %d dropped packets, want %d ± %.2f%% of %d sent", queue, dropped, ateLost[queue], tolerance, ateTx[queue])
+				}
+				switch {
+				case queue == ecnQueue && tc.congestion && marked == 0:
+					t.Errorf("Queue %s: got no ECN marked packets under congestion", queue)
+				case (queue == dropQueue || !tc.congestion) && marked != 0:
+					t.Errorf("Queue %s: got %d ECN marked packets, want 0", queue, marked)
+				}
+			}
+
+			stats := readCapture(t, ate)
+			t.Logf("Captured packets by DSCP and ECN codepoint: %v", stats)
+			ect := stats[dscpECN]
+			total := ect[ecnECT0] + ect[ecnCE]
+			if total == 0 {
+				t.Fatalf("No ECN capable packets captured")
+			}
+			markedPct := float64(ect[ecnCE]) * 100 / float64(total)
+			switch {
+			case tc.congestion && markedPct < *minMarkedPct:
+				t.Errorf("Got %.2f%% of the ECN capable packets CE marked under congestion, want at least %.2f%%", markedPct, *minMarkedPct)
+			case !tc.congestion && ect[ecnCE] != 0:
+				t.Errorf("Got %d ECN capable packets CE marked without congestion, want 0", ect[ecnCE])
+			}
+			for ecn, n := range stats[dscpDrop] {
+				if ecn != ecnNotECT {
+					t.Errorf("Got %d not ECN capable packets with ECN codepoint %d, want %d", n, ecn, ecnNotECT)
+				}
+			}
+		})
+	}
+}
@@ -564,363 +564,100 @@ func ConfigureQoS(t *testing.T, dut *ondatra.DUTDevice) {
 	dp1 := dut.Port(t, "port1")
 	dp2 := dut.Port(t, "port2")
 	dp3 := dut.Port(t, "port3")
-	d := &oc.Root{}
-	q := d.GetOrCreateQos()
+	b := qoscfg.New(dut)
 	queues := netutil.CommonTrafficQueues(t, dut)
 
 	if deviations.QOSQueueRequiresID(dut) {
 		queueNames := []string{queues.NC1, queues.AF4, queues.AF3, queues.AF2, queues.AF1, queues.BE0, queues.BE1}
 		for i, queue := range queueNames {
-			q1 := q.GetOrCreateQueue(queue)
-			q1.Name = ygot.String(queue)
-			queueid := len(queueNames) - i
-			q1.QueueId = ygot.Uint8(uint8(queueid))
+			b.AddQueue(queue, uint8(len(queueNames)-i))
 		}
 	}
-	t.Logf("Create qos forwarding groups config")
-	forwardingGroups := []struct {
-		desc        string
-		queueName   string
-		targetGroup string
-	}{{
-		desc:        "forwarding-group-BE1",
-		queueName:   queues.BE1,
-		targetGroup: "target-group-BE1",
-	}, {
-		desc:        "forwarding-group-BE0",
-		queueName:   queues.BE0,
-		targetGroup: "target-group-BE0",
-	}, {
-		desc:        "forwarding-group-AF1",
-		queueName:   queues.AF1,
-		targetGroup: "target-group-AF1",
-	}, {
-		desc:        "forwarding-group-AF2",
-		queueName:   queues.AF2,
-		targetGroup: "target-group-AF2",
-	}, {
-		desc:        "forwarding-group-AF3",
-		queueName:   queues.AF3,
-		targetGroup: "target-group-AF3",
-	}, {
-		desc:        "forwarding-group-AF4",
-		queueName:   queues.AF4,
-		targetGroup: "target-group-AF4",
-	}, {
-		desc:        "forwarding-group-NC1",
-		queueName:   queues.NC1,
-		targetGroup: "target-group-NC1",
-	}}
-
-	t.Logf("qos forwarding groups config: %v", forwardingGroups)
-	for _, tc := range forwardingGroups {
-		qoscfg.SetForwardingGroup(t, dut, q, tc.targetGroup, tc.queueName)
-	}
 
-	t.Logf("Create qos Classifiers config")
-	classifiers := []struct {
-		desc        string
-		name        string
-		classType   oc.E_Qos_Classifier_Type
-		termID      string
-		targetGroup string
-		dscpSet     []uint8
-	}{{
-		desc:        "classifier_ipv4_be1",
-		name:        "dscp_based_classifier_ipv4",
-		classType:   oc.Qos_Classifier_Type_IPV4,
-		termID:      "0",
-		targetGroup: "target-group-BE1",
-		dscpSet:     []uint8{0, 1, 2, 3},
-	}, {
-		desc:        "classifier_ipv4_be0",
-		name:        "dscp_based_classifier_ipv4",
-		classType:   oc.Qos_Classifier_Type_IPV4,
-		termID:      "1",
-		targetGroup: "target-group-BE0",
-		dscpSet:     []uint8{4, 5, 6, 7},
-	}, {
-		desc:        "classifier_ipv4_af1",
-		name:        "dscp_based_classifier_ipv4",
-		classType:   oc.Qos_Classifier_Type_IPV4,
-		termID:      "2",
-		targetGroup: "target-group-AF1",
-		dscpSet:     []uint8{8, 9, 10, 11},
-	}, {
-		desc:        "classifier_ipv4_af2",
-		name:        "dscp_based_classifier_ipv4",
-		classType:   oc.Qos_Classifier_Type_IPV4,
-		termID:      "3",
-		targetGroup: "target-group-AF2",
-		dscpSet:     []uint8{16, 17, 18, 19},
-	}, {
-		desc:        "classifier_ipv4_af3",
-		name:        "dscp_based_classifier_ipv4",
-		classType:   oc.Qos_Classifier_Type_IPV4,
-		termID:      "4",
-		targetGroup: "target-group-AF3",
-		dscpSet:     []uint8{24, 25, 26, 27},
-	}, {
-		desc:        "classifier_ipv4_af4",
-		name:        "dscp_based_classifier_ipv4",
-		classType:   oc.Qos_Classifier_Type_IPV4,
-		termID:      "5",
-		targetGroup: "target-group-AF4",
-		dscpSet:     []uint8{32, 33, 34, 35},
-	}, {
-		desc:        "classifier_ipv4_nc1",
-		name:        "dscp_based_classifier_ipv4",
-		classType:   oc.Qos_Classifier_Type_IPV4,
-		termID:      "6",
-		targetGroup: "target-group-NC1",
-		dscpSet:     []uint8{48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59},
-	}, {
-		desc:        "classifier_ipv6_be1",
-		name:        "dscp_based_classifier_ipv6",
-		classType:   oc.Qos_Classifier_Type_IPV6,
-		termID:      "0",
-		targetGroup: "target-group-BE1",
-		dscpSet:     []uint8{0, 1, 2, 3},
-	}, {
-		desc:        "classifier_ipv6_be0",
-		name:        "dscp_based_classifier_ipv6",
-		classType:   oc.Qos_Classifier_Type_IPV6,
-		termID:      "1",
-		targetGroup: "target-group-BE0",
-		dscpSet:     []uint8{4, 5, 6, 7},
-	}, {
-		desc:        "classifier_ipv6_af1",
-		name:        "dscp_based_classifier_ipv6",
-		classType:   oc.Qos_Classifier_Type_IPV6,
-		termID:      "2",
-		targetGroup: "target-group-AF1",
-		dscpSet:     []uint8{8, 9, 10, 11},
-	}, {
-		desc:        "classifier_ipv6_af2",
-		name:        "dscp_based_classifier_ipv6",
-		classType:   oc.Qos_Classifier_Type_IPV6,
-		termID:      "3",
-		targetGroup: "target-group-AF2",
-		dscpSet:     []uint8{16, 17, 18, 19},
-	}, {
-		desc:        "classifier_ipv6_af3",
-		name:        "dscp_based_classifier_ipv6",
-		classType:   oc.Qos_Classifier_Type_IPV6,
-		termID:      "4",
-		targetGroup: "target-group-AF3",
-		dscpSet:     []uint8{24, 25, 26, 27},
-	}, {
-		desc:        "classifier_ipv6_af4",
-		name:        "dscp_based_classifier_ipv6",
-		classType:   oc.Qos_Classifier_Type_IPV6,
-		termID:      "5",
-		targetGroup: "target-group-AF4",
-		dscpSet:     []uint8{32, 33, 34, 35},
-	}, {
-		desc:        "classifier_ipv6_nc1",
-		name:        "dscp_based_classifier_ipv6",
-		classType:   oc.Qos_Classifier_Type_IPV6,
-		termID:      "6",
-		targetGroup: "target-group-NC1",
-		dscpSet:     []uint8{48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59},
-	}}
-
-	t.Logf("qos Classifiers config: %v", classifiers)
-	for _, tc := range classifiers {
-		classifier := q.GetOrCreateClassifier(tc.name)
-		classifier.SetName(tc.name)
-		classifier.SetType(tc.classType)
-		term, err := classifier.NewTerm(tc.termID)
-		if err != nil {
-			t.Fatalf("Failed to create classifier.NewTerm(): %v", err)
-		}
-
-		term.SetId(tc.termID)
-		action := term.GetOrCreateActions()
-		action.SetTargetGroup(tc.targetGroup)
-		condition := term.GetOrCreateConditions()
-		if tc.name == "dscp_based_classifier_ipv4" {
-			condition.GetOrCreateIpv4().SetDscpSet(tc.dscpSet)
-		} else if tc.name == "dscp_based_classifier_ipv6" {
-			condition.GetOrCreateIpv6().SetDscpSet(tc.dscpSet)
-		}
-		gnmi.Replace(t, dut, gnmi.OC().Qos().Config(), q)
-	}
-
-	t.Logf("Create qos input classifier config")
-	classifierIntfs := []struct {
-		desc                string
-		intf                string
-		inputClassifierType oc.E_Input_Classifier_Type
-		classifier          string
-	}{{
-		desc:                "Input Classifier Type IPV4",
-		intf:                dp1.Name(),
-		inputClassifierType: oc.Input_Classifier_Type_IPV4,
-		classifier:          "dscp_based_classifier_ipv4",
-	}, {
-		desc:                "Input Classifier Type IPV6",
-		intf:                dp1.Name(),
-		inputClassifierType: oc.Input_Classifier_Type_IPV6,
-		classifier:          "dscp_based_classifier_ipv6",
-	}, {
-		desc:                "Input Classifier Type IPV4",
-		intf:                dp2.Name(),
-		inputClassifierType: oc.Input_Classifier_Type_IPV4,
-		classifier:          "dscp_based_classifier_ipv4",
-	}, {
-		desc:                "Input Classifier Type IPV6",
-		intf:                dp2.Name(),
-		inputClassifierType: oc.Input_Classifier_Type_IPV6,
-		classifier:          "dscp_based_classifier_ipv6",
-	}}
-
-	t.Logf("qos input classifier config: %v", classifierIntfs)
-	for _, tc := range classifierIntfs {
-		qoscfg.SetInputClassifier(t, dut, q, tc.intf, tc.inputClassifierType, tc.classifier)
-	}
-
-	t.Logf("Create qos scheduler policies config")
-	schedulerPolicies := []struct {
-		desc        string
-		sequence    uint32
-		priority    oc.E_Scheduler_Priority
-		inputID     string
-		inputType   oc.E_Input_InputType
-		weight      uint64
-		queueName   string
-		targetGroup string
-	}{{
-		desc:        "scheduler-policy-BE1",
-		sequence:    uint32(1),
-		priority:    oc.Scheduler_Priority_UNSET,
-		inputID:     "BE1",
-		inputType:   oc.Input_InputType_QUEUE,
-		weight:      uint64(1),
-		queueName:   queues.BE1,
-		targetGroup: "target-group-BE1",
-	}, {
-		desc:        "scheduler-policy-BE0",
-		sequence:    uint32(1),
-		priority:    oc.Scheduler_Priority_UNSET,
-		inputID:     "BE0",
-		inputType:   oc.Input_InputType_QUEUE,
-		weight:      uint64(1),
-		queueName:   queues.BE0,
-		targetGroup: "target-group-BE0",
-	}, {
-		desc:        "scheduler-policy-AF1",
-		sequence:    uint32(1),
-		priority:    oc.Scheduler_Priority_UNSET,
-		inputID:     "AF1",
-		inputType:   oc.Input_InputType_QUEUE,
-		weight:      uint64(4),
-		queueName:   queues.AF1,
-		targetGroup: "target-group-AF1",
-	}, {
-		desc:        "scheduler-policy-AF2",
-		sequence:    uint32(1),
-		priority:    oc.Scheduler_Priority_UNSET,
-		inputID:     "AF2",
-		inputType:   oc.Input_InputType_QUEUE,
-		weight:      uint64(8),
-		queueName:   queues.AF2,
-		targetGroup: "target-group-AF2",
-	}, {
-		desc:        "scheduler-policy-AF3",
-		sequence:    uint32(1),
-		priority:    oc.Scheduler_Priority_UNSET,
-		inputID:     "AF3",
-		inputType:   oc.Input_InputType_QUEUE,
-		weight:      uint64(12),
-		queueName:   queues.AF3,
-		targetGroup: "target-group-AF3",
-	}, {
-		desc:        "scheduler-policy-AF4",
-		sequence:    uint32(1),
-		priority:    oc.Scheduler_Priority_UNSET,
-		inputID:     "AF4",
-		inputType:   oc.Input_InputType_QUEUE,
-		weight:      uint64(48),
-		queueName:   queues.AF4,
-		targetGroup: "target-group-AF4",
-	}, {
-		desc:        "scheduler-policy-NC1",
-		sequence:    uint32(0),
-		priority:    oc.Scheduler_Priority_STRICT,
-		inputID:     "NC1",
-		inputType:   oc.Input_InputType_QUEUE,
-		weight:      uint64(7),
-		queueName:   queues.NC1,
-		targetGroup: "target-group-NC1",
-	}}
-
-	schedulerPolicy := q.GetOrCreateSchedulerPolicy("scheduler")
-	schedulerPolicy.SetName("scheduler")
-	t.Logf("qos scheduler policies config: %v", schedulerPolicies)
-	for _, tc := range schedulerPolicies {
-		s := schedulerPolicy.GetOrCreateScheduler(tc.sequence)
-		s.SetSequence(tc.sequence)
-		s.SetPriority(tc.priority)
-		input := s.GetOrCreateInput(tc.inputID)
-		input.SetId(tc.inputID)
-		input.SetInputType(tc.inputType)
-		input.SetQueue(tc.queueName)
-		input.SetWeight(tc.weight)
-		gnmi.Replace(t, dut, gnmi.OC().Qos().Config(), q)
-	}
-
-	t.Logf("Create qos output interface config")
-	schedulerIntfs := []struct {
-		desc      string
+	// Each traffic class has a forwarding group, a term of the IPv4 and IPv6
+	// classifiers, and a scheduler input of the output interface.
+	classes := []struct {
+		name      string
 		queueName string
-		scheduler string
+		termID    string
+		dscpSet   []uint8
+		sequence  uint32
+		priority  oc.E_Scheduler_Priority
+		weight    uint64
 	}{{
-		desc:      "output-interface-BE1",
+		name:      "BE1",
 		queueName: queues.BE1,
-		scheduler: "scheduler",
+		termID:    "0",
+		dscpSet:   []uint8{0, 1, 2, 3},
+		sequence:  1,
+		priority:  oc.Scheduler_Priority_UNSET,
+		weight:    1,
 	}, {
-		desc:      "output-interface-BE0",
+		name:      "BE0",
 		queueName: queues.BE0,
-		scheduler: "scheduler",
+		termID:    "1",
+		dscpSet:   []uint8{4, 5, 6, 7},
+		sequence:  1,
+		priority:  oc.Scheduler_Priority_UNSET,
+		weight:    1,
 	}, {
-		desc:      "output-interface-AF1",
+		name:      "AF1",
 		queueName: queues.AF1,
-		scheduler: "scheduler",
+		termID:    "2",
+		dscpSet:   []uint8{8, 9, 10, 11},
+		sequence:  1,
+		priority:  oc.Scheduler_Priority_UNSET,
+		weight:    4,
 	}, {
-		desc:      "output-interface-AF2",
+		name:      "AF2",
 		queueName: queues.AF2,
-		scheduler: "scheduler",
+		termID:    "3",
+		dscpSet:   []uint8{16, 17, 18, 19},
+		sequence:  1,
+		priority:  oc.Scheduler_Priority_UNSET,
+		weight:    8,
 	}, {
-		desc:      "output-interface-AF3",
+		name:      "AF3",
 		queueName: queues.AF3,
-		scheduler: "scheduler",
+		termID:    "4",
+		dscpSet:   []uint8{24, 25, 26, 27},
+		sequence:  1,
+		priority:  oc.Scheduler_Priority_UNSET,
+		weight:    12,
 	}, {
-		desc:      "output-interface-AF4",
+		name:      "AF4",
 		queueName: queues.AF4,
-		scheduler: "scheduler",
+		termID:    "5",
+		dscpSet:   []uint8{32, 33, 34, 35},
+		sequence:  1,
+		priority:  oc.Scheduler_Priority_UNSET,
+		weight:    48,
 	}, {
-		desc:      "output-interface-NC1",
+		name:      "NC1",
 		queueName: queues.NC1,
-		scheduler: "scheduler",
+		termID:    "6",
+		dscpSet:   []uint8{48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59},
+		sequence:  0,
+		priority:  oc.Scheduler_Priority_STRICT,
+		weight:    7,
 	}}
 
-	t.Logf("qos output interface config: %v", schedulerIntfs)
-	for _, tc := range schedulerIntfs {
-		i := q.GetOrCreateInterface(dp3.Name())
-		i.SetInterfaceId(dp3.Name())
-		i.GetOrCreateInterfaceRef().Interface = ygot.String(dp3.Name())
-		if deviations.InterfaceRefConfigUnsupported(dut) {
-			i.InterfaceRef = nil
-		}
-		output := i.GetOrCreateOutput()
-		schedulerPolicy := output.GetOrCreateSchedulerPolicy()
-		schedulerPolicy.SetName(tc.scheduler)
-		queue := output.GetOrCreateQueue(tc.queueName)
-		queue.SetName(tc.queueName)
-		gnmi.Replace(t, dut, gnmi.OC().Qos().Config(), q)
+	t.Logf("qos traffic classes config: %v", classes)
+	for _, tc := range classes {
+		targetGroup := "target-group-" + tc.name
+		b.AddForwardingGroup(targetGroup, tc.queueName)
+		b.AddClassifier("dscp_based_classifier_ipv4", oc.Qos_Classifier_Type_IPV4, qoscfg.ClassifierTerm{ID: tc.termID, TargetGroup: targetGroup, DSCP: tc.dscpSet})
+		b.AddClassifier("dscp_based_classifier_ipv6", oc.Qos_Classifier_Type_IPV6, qoscfg.ClassifierTerm{ID: tc.termID, TargetGroup: targetGroup, DSCP: tc.dscpSet})
+		b.AddScheduler("scheduler", tc.sequence, tc.priority, qoscfg.SchedulerInput{ID: tc.name, Queue: tc.queueName, Weight: tc.weight})
+		b.AddOutputSchedulerPolicy(dp3.Name(), "scheduler", tc.queueName)
 	}
+	for _, dp := range []*ondatra.Port{dp1, dp2} {
+		b.AddInputClassifier(dp.Name(), oc.Input_Classifier_Type_IPV4, "dscp_based_classifier_ipv4")
+		b.AddInputClassifier(dp.Name(), oc.Input_Classifier_Type_IPV6, "dscp_based_classifier_ipv6")
+	}
+	b.Push(t, dut)
 }
+
 func ConfigureCiscoQos(t *testing.T, dut *ondatra.DUTDevice) {
 	dp1 := dut.Port(t, "port1")
 	dp2 := dut.Port(t, "port2")
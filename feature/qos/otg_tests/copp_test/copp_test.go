@@ -0,0 +1,274 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package copp_test
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/cfgplugins"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+)
+
+var (
+	floodPPS      = flag.Uint64("flood_pps", 10000, "rate of the packets punted to the DUT CPU by each flood, in packets per second")
+	floodDuration = flag.Duration("flood_duration", 20*time.Second, "duration of each flood")
+	tolerance     = flag.Float64("tolerance", 10, "tolerance of the rate of the conforming packets above the CIR, in percent")
+)
+
+// The testbed consists of ate:port1 -> dut:port1, which carries the floods,
+// and ate:port2 -> dut:port2, which carries the eBGP session which must stay
+// up during the floods. The ATE ports and their addresses are those of
+// cfgplugins.NewBGPSession.
+const (
+	classifierName = "copp"
+	policyName     = "copp"
+	frameSize      = 128
+	burst          = 16000
+	udpPort        = 33333
+	bgpPort        = 179
+	srcPort        = 40000
+
+	// dutPort1IPv4 and atePort1IPv4 are the addresses of port1 in
+	// cfgplugins.NewBGPSession.
+	dutPort1IPv4 = "192.0.2.1"
+	atePort1IPv4 = "192.0.2.2"
+	atePort1MAC  = "02:00:01:01:01:01"
+)
+
+// class is a class of packets punted to the DUT CPU, policed with cir bits
+// per second by the scheduler with the sequence number seq of the CoPP
+// scheduler policy, if seq is not 0.
+type class struct {
+	name string
+	seq  uint32
+	cir  uint64
+}
+
+var (
+	arpClass     = class{name: "arp"}
+	bgpClass     = class{name: "bgp", seq: 1, cir: 1000000}
+	icmpClass    = class{name: "icmp", seq: 2, cir: 1000000}
+	defaultClass = class{name: "default", seq: 3, cir: 500000}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// coppQos returns the QoS configuration of the classifier and the scheduler
+// policy of the CoPP, which classify the packets of each class of the IPv4
+// classes into its own queue and police them.
+func coppQos() *oc.Qos {
+	q := &oc.Qos{}
+	c := q.GetOrCreateClassifier(classifierName)
+	c.SetType(oc.Qos_Classifier_Type_IPV4)
+	sp := q.GetOrCreateSchedulerPolicy(policyName)
+	for _, cl := range []class{bgpClass, icmpClass, defaultClass} {
+		queue := "copp-" + cl.name
+		q.GetOrCreateQueue(queue)
+		q.GetOrCreateForwardingGroup(queue).SetOutputQueue(queue)
+
+		term := c.GetOrCreateTerm(cl.name)
+		term.GetOrCreateActions().SetTargetGroup(queue)
+		cond := term.GetOrCreateConditions()
+		switch cl {
+		case bgpClass:
+			cond.GetOrCreateIpv4().SetProtocol(oc.PacketMatchTypes_IP_PROTOCOL_IP_TCP)
+			cond.GetOrCreateTransport().SetDestinationPort(oc.UnionUint16(bgpPort))
+		case icmpClass:
+			cond.GetOrCreateIpv4().SetProtocol(oc.PacketMatchTypes_IP_PROTOCOL_IP_ICMP)
+		default:
+			cond.GetOrCreateIpv4().SetDestinationAddress("0.0.0.0/0")
+		}
+
+		s := sp.GetOrCreateScheduler(cl.seq)
+		s.SetType(oc.QosTypes_QOS_SCHEDULER_TYPE_ONE_RATE_TWO_COLOR)
+		in := s.GetOrCreateInput(cl.name)
+		in.SetInputType(oc.Input_InputType_QUEUE)
+		in.SetQueue(queue)
+		policer := s.GetOrCreateOneRateTwoColor()
+		policer.SetCir(cl.cir)
+		policer.SetBc(burst)
+		policer.SetQueuingBehavior(oc.Qos_QueueBehavior_POLICE)
+		policer.GetOrCreateExceedAction().SetDrop(true)
+	}
+	return q
+}
+
+// configureCoPP configures the CoPP classifier and scheduler policy, and
+// applies them to the control plane traffic.
+func configureCoPP(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	cp := &oc.System_ControlPlaneTraffic{}
+	cp.GetOrCreateIngress().GetOrCreateQos().GetOrCreateClassifier().SetName(classifierName)
+	cp.GetOrCreateIngress().GetOrCreateQos().GetOrCreateSchedulerPolicy().SetName(policyName)
+
+	b := &gnmi.SetBatch{}
+	gnmi.BatchUpdate(b, gnmi.OC().Qos().Config(), coppQos())
+	gnmi.BatchReplace(b, gnmi.OC().System().ControlPlaneTraffic().Config(), cp)
+	b.Set(t, dut)
+}
+
+// schedulerCounters returns the conforming octets and the exceeding packets
+// of the scheduler with the sequence number seq of the CoPP scheduler
+// policy.
+func schedulerCounters(t *testing.T, dut *ondatra.DUTDevice, seq uint32) (conformingOctets, exceedingPkts uint64) {
+	t.Helper()
+	s := gnmi.Get(t, dut, gnmi.OC().System().ControlPlaneTraffic().Ingress().Qos().SchedulerPolicy().Scheduler(seq).State())
+	return s.GetConformingOctets(), s.GetExceedingPkts()
+}
+
+// termMatchedPkts returns the number of packets matched by the term id of
+// the CoPP classifier.
+func termMatchedPkts(t *testing.T, dut *ondatra.DUTDevice, id string) uint64 {
+	t.Helper()
+	q := gnmi.OC().System().ControlPlaneTraffic().Ingress().Qos().Classifier().Term(id).MatchedPackets().State()
+	// The counter is 0 if the device has not matched any packet yet.
+	v, _ := gnmi.Lookup(t, dut, q).Val()
+	return v
+}
+
+// addFlood adds the flood of class cl from ate:port1 to the DUT with the MAC
+// address dutMAC.
+func addFlood(t *testing.T, top gosnappi.Config, ate *ondatra.ATEDevice, cl class, dutMAC string) {
+	t.Helper()
+	flow := top.Flows().Add().SetName(cl.name)
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Port().SetTxName(ate.Port(t, "port1").ID())
+	eth := flow.Packet().Add().Ethernet()
+	eth.Src().SetValue(atePort1MAC)
+	if cl == arpClass {
+		eth.Dst().SetValue("ff:ff:ff:ff:ff:ff")
+		arp := flow.Packet().Add().Arp()
+		arp.SenderHardwareAddr().SetValue(atePort1MAC)
+		arp.SenderProtocolAddr().SetValue(atePort1IPv4)
+		arp.TargetProtocolAddr().SetValue(dutPort1IPv4)
+	} else {
+		eth.Dst().SetValue(dutMAC)
+		ip := flow.Packet().Add().Ipv4()
+		ip.Src().SetValue(atePort1IPv4)
+		ip.Dst().SetValue(dutPort1IPv4)
+		switch cl {
+		case bgpClass:
+			tcp := flow.Packet().Add().Tcp()
+			tcp.SrcPort().Increment().SetStart(srcPort).SetCount(1000)
+			tcp.DstPort().SetValue(bgpPort)
+			tcp.CtlSyn().SetValue(1)
+		case icmpClass:
+			flow.Packet().Add().Icmp().Echo()
+		default:
+			udp := flow.Packet().Add().Udp()
+			udp.SrcPort().SetValue(srcPort)
+			udp.DstPort().SetValue(udpPort)
+		}
+	}
+	flow.Size().SetFixed(frameSize)
+	flow.Rate().SetPps(*floodPPS)
+	flow.Duration().FixedPackets().SetPackets(uint32(*floodPPS * uint64(floodDuration.Seconds())))
+}
+
+// establishedTransitions returns the number of transitions to ESTABLISHED of
+// the eBGP session with neighbor.
+func establishedTransitions(t *testing.T, dut *ondatra.DUTDevice, neighbor string) uint64 {
+	t.Helper()
+	q := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(cfgplugins.PTBGP, "BGP").Bgp().Neighbor(neighbor).EstablishedTransitions().State()
+	return gnmi.Get(t, dut, q)
+}
+
+func TestCoPP(t *testing.T) {
+	bs := cfgplugins.NewBGPSession(t, cfgplugins.PortCount2, nil)
+	bs.WithEBGP(t, []oc.E_BgpTypes_AFI_SAFI_TYPE{oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST}, []string{"port2"}, true, false)
+	if err := bs.PushAndStart(t); err != nil {
+		t.Fatalf("Failed to configure the eBGP session: %v", err)
+	}
+	dut, ate := bs.DUT, bs.ATE
+	cfgplugins.VerifyDUTBGPEstablished(t, dut)
+	neighbor := bs.ATEPorts[1].IPv4
+
+	configureCoPP(t, dut)
+	dutMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port1").Name()).Ethernet().MacAddress().State())
+
+	for _, cl := range []class{arpClass, bgpClass, icmpClass, defaultClass} {
+		t.Run(cl.name, func(t *testing.T) {
+			bs.ATETop.Flows().Clear()
+			addFlood(t, bs.ATETop, ate, cl, dutMAC)
+			bs.PushAndStartATE(t)
+			cfgplugins.VerifyDUTBGPEstablished(t, dut)
+
+			transitions := establishedTransitions(t, dut, neighbor)
+			var conformingBefore, exceedingBefore, matchedBefore uint64
+			if cl.seq != 0 {
+				conformingBefore, exceedingBefore = schedulerCounters(t, dut, cl.seq)
+				matchedBefore = termMatchedPkts(t, dut, cl.name)
+			}
+			rx := gnmi.OTG().Port(ate.Port(t, "port1").ID()).Counters().InFrames().State()
+			rxBefore := gnmi.Get(t, ate.OTG(), rx)
+
+			start := time.Now()
+			ate.OTG().StartTraffic(t)
+			time.Sleep(*floodDuration + 5*time.Second)
+			ate.OTG().StopTraffic(t)
+			elapsed := time.Since(start)
+			time.Sleep(10 * time.Second)
+
+			sent := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(cl.name).Counters().OutPkts().State())
+			replies := gnmi.Get(t, ate.OTG(), rx) - rxBefore
+			t.Logf("Flood %s: sent %d packets, received %d frames on ate:port1", cl.name, sent, replies)
+			if sent == 0 {
+				t.Fatalf("Flood %s sent no packets", cl.name)
+			}
+			if replies >= sent {
+				t.Errorf("Flood %s: got %d frames received on ate:port1 for %d packets sent, want the punted packets limited", cl.name, replies, sent)
+			}
+
+			if cl.seq != 0 {
+				conformingAfter, exceedingAfter := schedulerCounters(t, dut, cl.seq)
+				conforming, exceeding := conformingAfter-conformingBefore, exceedingAfter-exceedingBefore
+				matched := termMatchedPkts(t, dut, cl.name) - matchedBefore
+				t.Logf("Class %s: %d packets matched, %d octets conforming, %d packets exceeding", cl.name, matched, conforming, exceeding)
+				if matched < sent {
+					t.Errorf("Term %s: got %d matched packets, want at least %d", cl.name, matched, sent)
+				}
+				if exceeding == 0 {
+					t.Errorf("Class %s: got no exceeding packets, want the flood policed", cl.name)
+				}
+				maxConforming := uint64(float64(cl.cir)/8*elapsed.Seconds()*(1+*tolerance/100)) + burst
+				if conforming > maxConforming {
+					t.Errorf("Class %s: got %d conforming octets, want at most %d for the CIR %d bps", cl.name, conforming, maxConforming, cl.cir)
+				}
+			}
+
+			cfgplugins.VerifyDUTBGPEstablished(t, dut)
+			if got := establishedTransitions(t, dut, neighbor); got != transitions {
+				t.Errorf("eBGP session with %s: got %d established transitions, want %d", neighbor, got, transitions)
+			}
+		})
+	}
+
+	gnmi.Delete(t, dut, gnmi.OC().System().ControlPlaneTraffic().Config())
+	gnmi.Delete(t, dut, gnmi.OC().Qos().SchedulerPolicy(policyName).Config())
+	gnmi.Delete(t, dut, gnmi.OC().Qos().Classifier(classifierName).Config())
+	for _, cl := range []class{bgpClass, icmpClass, defaultClass} {
+		gnmi.Delete(t, dut, gnmi.OC().Qos().ForwardingGroup("copp-"+cl.name).Config())
+		gnmi.Delete(t, dut, gnmi.OC().Qos().Queue("copp-"+cl.name).Config())
+	}
+}
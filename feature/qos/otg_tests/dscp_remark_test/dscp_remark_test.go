@@ -0,0 +1,348 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dscp_remark_test
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/featureprofiles/internal/qoscfg"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygot/ygot"
+)
+
+var packets = flag.Uint("packets", 1000, "number of packets of each flow")
+
+// The testbed consists of ate:port1 -> dut:port1 and dut:port2 -> ate:port2.
+const (
+	ipv4PrefixLen = 31
+	ipv6PrefixLen = 127
+	frameSize     = 512
+	// baseUDPPort is the UDP destination port of the flow of the first class,
+	// which identifies the flows in the capture after their DSCP is rewritten.
+	baseUDPPort = 50000
+	// inLabel is the label of the MPLS flows, which the static LSP swaps to
+	// outLabel towards ate:port2.
+	inLabel     = 100001
+	outLabel    = 100002
+	captureName = "port2-capture"
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "198.51.100.1",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::1",
+		IPv6Len: ipv6PrefixLen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "198.51.100.3",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::3",
+		IPv6Len: ipv6PrefixLen,
+	}
+	dutPort1 = attrs.Attributes{
+		Desc:    "Input interface port1",
+		IPv4:    "198.51.100.0",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::",
+		IPv6Len: ipv6PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "Output interface port2",
+		IPv4:    "198.51.100.2",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::2",
+		IPv6Len: ipv6PrefixLen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// class is a traffic class, which is classified by its DSCP or MPLS traffic
+// class exp on port1, and remarked to remarkDSCP or remarkEXP on port2.
+type class struct {
+	name       string
+	queue      string
+	dscp       uint8
+	remarkDSCP uint8
+	exp        uint8
+	remarkEXP  uint8
+}
+
+// configureDUT configures the DUT interfaces, the classifiers of the classes
+// on port1 and the remarking of the classes on port2.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice, classes []*class) {
+	t.Helper()
+	for _, p := range []struct {
+		port  *ondatra.Port
+		attrs attrs.Attributes
+	}{
+		{dut.Port(t, "port1"), dutPort1},
+		{dut.Port(t, "port2"), dutPort2},
+	} {
+		gnmi.Replace(t, dut, gnmi.OC().Interface(p.port.Name()).Config(), p.attrs.NewOCInterface(p.port.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, p.port.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, p.port)
+		}
+	}
+
+	dp1 := dut.Port(t, "port1")
+	dp2 := dut.Port(t, "port2")
+	b := qoscfg.New(dut)
+	for i, c := range classes {
+		if deviations.QOSQueueRequiresID(dut) {
+			b.AddQueue(c.queue, uint8(len(classes)-i))
+		}
+		targetGroup := "target-group-" + c.name
+		b.AddForwardingGroup(targetGroup, c.queue)
+		b.AddClassifier("dscp_based_classifier_ipv4", oc.Qos_Classifier_Type_IPV4, qoscfg.ClassifierTerm{ID: c.name, TargetGroup: targetGroup, DSCP: []uint8{c.dscp}})
+		b.AddClassifier("dscp_based_classifier_ipv6", oc.Qos_Classifier_Type_IPV6, qoscfg.ClassifierTerm{ID: c.name, TargetGroup: targetGroup, DSCP: []uint8{c.dscp}})
+		b.AddClassifier("exp_based_classifier", oc.Qos_Classifier_Type_MPLS, qoscfg.ClassifierTerm{ID: c.name, TargetGroup: targetGroup, TrafficClass: c.exp})
+		b.AddClassifier("dscp_remark_ipv4", oc.Qos_Classifier_Type_IPV4, qoscfg.ClassifierTerm{ID: c.name, DSCP: []uint8{c.dscp}, SetDSCP: ygot.Uint8(c.remarkDSCP)})
+		b.AddClassifier("dscp_remark_ipv6", oc.Qos_Classifier_Type_IPV6, qoscfg.ClassifierTerm{ID: c.name, DSCP: []uint8{c.dscp}, SetDSCP: ygot.Uint8(c.remarkDSCP)})
+		b.AddClassifier("exp_remark", oc.Qos_Classifier_Type_MPLS, qoscfg.ClassifierTerm{ID: c.name, TrafficClass: c.exp, SetMPLSTC: ygot.Uint8(c.remarkEXP)})
+	}
+	b.AddInputClassifier(dp1.Name(), oc.Input_Classifier_Type_IPV4, "dscp_based_classifier_ipv4")
+	b.AddInputClassifier(dp1.Name(), oc.Input_Classifier_Type_IPV6, "dscp_based_classifier_ipv6")
+	b.AddInputClassifier(dp1.Name(), oc.Input_Classifier_Type_MPLS, "exp_based_classifier")
+	b.AddOutputClassifier(dp2.Name(), oc.Input_Classifier_Type_IPV4, "dscp_remark_ipv4")
+	b.AddOutputClassifier(dp2.Name(), oc.Input_Classifier_Type_IPV6, "dscp_remark_ipv6")
+	b.AddOutputClassifier(dp2.Name(), oc.Input_Classifier_Type_MPLS, "exp_remark")
+	b.Push(t, dut)
+
+	configureStaticLSP(t, dut, dp1, dp2)
+}
+
+// configureStaticLSP enables MPLS on ports and configures a static LSP which
+// swaps inLabel to outLabel towards ate:port2.
+func configureStaticLSP(t *testing.T, dut *ondatra.DUTDevice, ports ...*ondatra.Port) {
+	t.Helper()
+	ni := deviations.DefaultNetworkInstance(dut)
+	mpls := &oc.NetworkInstance_Mpls{}
+	for _, p := range ports {
+		intf := mpls.GetOrCreateGlobal().GetOrCreateInterface(p.Name())
+		intf.SetMplsEnabled(true)
+		intf.GetOrCreateInterfaceRef().SetInterface(p.Name())
+	}
+	transit := mpls.GetOrCreateLsps().GetOrCreateStaticLsp("dscp-remark-lsp").GetOrCreateTransit()
+	transit.SetIncomingLabel(oc.UnionUint32(inLabel))
+	transit.SetPushLabel(oc.UnionUint32(outLabel))
+	transit.SetNextHop(ateDst.IPv4)
+	gnmi.Update(t, dut, gnmi.OC().NetworkInstance(ni).Mpls().Config(), mpls)
+}
+
+// flowType is the type of the packets of a flow.
+type flowType int
+
+const (
+	ipv4Flow flowType = iota
+	ipv6Flow
+	mplsFlow
+)
+
+// flowName returns the name of the flow of class c of type typ.
+func flowName(c *class, typ flowType) string {
+	return [...]string{"IPv4", "IPv6", "MPLS"}[typ] + "-" + c.name
+}
+
+// addFlows replaces the flows of top with a flow of type typ of each class.
+// The MPLS flows are sent with inLabel to dstMAC, the MAC address of
+// dut:port1.
+func addFlows(t *testing.T, ate *ondatra.ATEDevice, top gosnappi.Config, classes []*class, typ flowType, dstMAC string) {
+	t.Helper()
+	top.Flows().Clear()
+	for i, c := range classes {
+		flow := top.Flows().Add().SetName(flowName(c, typ))
+		flow.Metrics().SetEnable(true)
+		eth := flow.Packet().Add().Ethernet()
+		eth.Src().SetValue(ateSrc.MAC)
+		switch typ {
+		case ipv4Flow:
+			flow.TxRx().Device().SetTxNames([]string{ateSrc.Name + ".IPv4"}).SetRxNames([]string{ateDst.Name + ".IPv4"})
+			ip := flow.Packet().Add().Ipv4()
+			ip.Src().SetValue(ateSrc.IPv4)
+			ip.Dst().SetValue(ateDst.IPv4)
+			ip.Priority().Dscp().Phb().SetValue(uint32(c.dscp))
+		case ipv6Flow:
+			flow.TxRx().Device().SetTxNames([]string{ateSrc.Name + ".IPv6"}).SetRxNames([]string{ateDst.Name + ".IPv6"})
+			ip := flow.Packet().Add().Ipv6()
+			ip.Src().SetValue(ateSrc.IPv6)
+			ip.Dst().SetValue(ateDst.IPv6)
+			ip.TrafficClass().SetValue(uint32(c.dscp) << 2)
+		case mplsFlow:
+			flow.TxRx().Port().SetTxName(ate.Port(t, "port1").ID()).SetRxNames([]string{ate.Port(t, "port2").ID()})
+			eth.Dst().SetValue(dstMAC)
+			label := flow.Packet().Add().Mpls()
+			label.Label().SetValue(inLabel)
+			label.TrafficClass().SetValue(uint32(c.exp))
+			label.BottomOfStack().SetValue(1)
+			ip := flow.Packet().Add().Ipv4()
+			ip.Src().SetValue(ateSrc.IPv4)
+			ip.Dst().SetValue(ateDst.IPv4)
+		}
+		flow.Packet().Add().Udp().DstPort().SetValue(uint32(baseUDPPort + i))
+		flow.Size().SetFixed(frameSize)
+		flow.Rate().SetPps(1000)
+		flow.Duration().FixedPackets().SetPackets(uint32(*packets))
+	}
+}
+
+// readCapture returns the counts of the packets captured on port2 of each
+// UDP destination port by their DSCP, or by their MPLS traffic class for
+// MPLS packets.
+func readCapture(t *testing.T, ate *ondatra.ATEDevice) map[uint16]map[uint8]int {
+	t.Helper()
+	counts := map[uint16]map[uint8]int{}
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port2").ID()) {
+		udp, ok := p.Layer(layers.LayerTypeUDP).(*layers.UDP)
+		if !ok {
+			continue
+		}
+		var value uint8
+		switch {
+		case p.Layer(layers.LayerTypeMPLS) != nil:
+			value = p.Layer(layers.LayerTypeMPLS).(*layers.MPLS).TrafficClass
+		case p.Layer(layers.LayerTypeIPv4) != nil:
+			value = p.Layer(layers.LayerTypeIPv4).(*layers.IPv4).TOS >> 2
+		case p.Layer(layers.LayerTypeIPv6) != nil:
+			value = p.Layer(layers.LayerTypeIPv6).(*layers.IPv6).TrafficClass >> 2
+		default:
+			continue
+		}
+		port := uint16(udp.DstPort)
+		if counts[port] == nil {
+			counts[port] = map[uint8]int{}
+		}
+		counts[port][value]++
+	}
+	return counts
+}
+
+// transmitPkts returns the transmitted packets of the output queues of
+// port2.
+func transmitPkts(t *testing.T, dut *ondatra.DUTDevice, classes []*class) map[string]uint64 {
+	t.Helper()
+	pkts := map[string]uint64{}
+	for _, c := range classes {
+		pkts[c.queue] = gnmi.Get(t, dut, gnmi.OC().Qos().Interface(dut.Port(t, "port2").Name()).Output().Queue(c.queue).TransmitPkts().State())
+	}
+	return pkts
+}
+
+func TestDSCPRemark(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	queues := netutil.CommonTrafficQueues(t, dut)
+	// The AF classes are remarked to a higher drop precedence, and the MPLS
+	// traffic classes of AF1 and AF2, and of AF3 and AF4, are swapped.
+	classes := []*class{
+		{name: "BE1", queue: queues.BE1, dscp: 0, remarkDSCP: 0, exp: 0, remarkEXP: 0},
+		{name: "AF1", queue: queues.AF1, dscp: 10, remarkDSCP: 14, exp: 1, remarkEXP: 2},
+		{name: "AF2", queue: queues.AF2, dscp: 18, remarkDSCP: 22, exp: 2, remarkEXP: 1},
+		{name: "AF3", queue: queues.AF3, dscp: 26, remarkDSCP: 30, exp: 3, remarkEXP: 4},
+		{name: "AF4", queue: queues.AF4, dscp: 34, remarkDSCP: 38, exp: 4, remarkEXP: 3},
+		{name: "NC1", queue: queues.NC1, dscp: 48, remarkDSCP: 48, exp: 6, remarkEXP: 6},
+	}
+	configureDUT(t, dut, classes)
+	dstMAC := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port1").Name()).Ethernet().MacAddress().State())
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	ateDst.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{ate.Port(t, "port2").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+
+	cases := []struct {
+		desc string
+		typ  flowType
+		// want returns the value of class c expected in the capture.
+		want func(c *class) uint8
+	}{{
+		desc: "IPv4 DSCP",
+		typ:  ipv4Flow,
+		want: func(c *class) uint8 { return c.remarkDSCP },
+	}, {
+		desc: "IPv6 DSCP",
+		typ:  ipv6Flow,
+		want: func(c *class) uint8 { return c.remarkDSCP },
+	}, {
+		desc: "MPLS EXP",
+		typ:  mplsFlow,
+		want: func(c *class) uint8 { return c.remarkEXP },
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			addFlows(t, ate, top, classes, tc.typ, dstMAC)
+			ate.OTG().PushConfig(t, top)
+			ate.OTG().StartProtocols(t)
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv6")
+
+			before := transmitPkts(t, dut, classes)
+			otgutils.StartCapture(t, ate.OTG())
+			ate.OTG().StartTraffic(t)
+			time.Sleep(time.Duration(*packets)*time.Millisecond + 10*time.Second)
+			ate.OTG().StopTraffic(t)
+			otgutils.StopCapture(t, ate.OTG())
+			time.Sleep(30 * time.Second)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+			after := transmitPkts(t, dut, classes)
+
+			counts := readCapture(t, ate)
+			for i, c := range classes {
+				name := flowName(c, tc.typ)
+				counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(name).Counters().State())
+				if counters.GetOutPkts() == 0 || counters.GetInPkts() != counters.GetOutPkts() {
+					t.Errorf("Flow %s: got %d packets received of %d sent, want no loss", name, counters.GetInPkts(), counters.GetOutPkts())
+				}
+				if got := after[c.queue] - before[c.queue]; got < counters.GetInPkts() {
+					t.Errorf("Flow %s: got %d packets transmitted by queue %s, want at least %d", name, got, c.queue, counters.GetInPkts())
+				}
+
+				got := counts[uint16(baseUDPPort+i)]
+				want := tc.want(c)
+				t.Logf("Flow %s: captured packets by value: %v", name, got)
+				if got[want] == 0 {
+					t.Errorf("Flow %s: no packets captured with value %d", name, want)
+				}
+				for value, n := range got {
+					if value != want {
+						t.Errorf("Flow %s: got %d packets captured with value %d, want %d", name, n, value, want)
+					}
+				}
+			}
+		})
+	}
+}
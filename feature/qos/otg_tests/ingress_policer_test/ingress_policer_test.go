@@ -0,0 +1,269 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingress_policer_test
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/featureprofiles/internal/qoscfg"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+)
+
+var (
+	trafficDuration = flag.Duration("traffic_duration", 30*time.Second, "duration of the traffic of each test case")
+	tolerance       = flag.Float64("tolerance", 2, "tolerance of the percentages of the received and the exceeding packets")
+)
+
+// The testbed consists of ate:port1 -> dut:port1 and dut:port2 -> ate:port2.
+// The policer is on the VLAN subinterface of dut:port1.
+const (
+	plen      = 31
+	vlanID    = 100
+	subIntf   = 1
+	frameSize = 1000
+	dscp      = 26
+	// exceedDSCP is the DSCP of the packets exceeding the rate of the
+	// policer which remarks them.
+	exceedDSCP = 8
+	// cirMbps is the rate of the policer in Mbps, and burst its burst in
+	// bytes.
+	cirMbps     = 1000
+	burst       = 100000
+	policerSeq  = 1
+	captureName = "port2-capture"
+)
+
+var (
+	ateSrc = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "198.51.100.1",
+		IPv4Len: plen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "198.51.100.3",
+		IPv4Len: plen,
+	}
+	dutPort1 = attrs.Attributes{
+		Desc:    "Input interface port1",
+		IPv4:    "198.51.100.0",
+		IPv4Len: plen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "Output interface port2",
+		IPv4:    "198.51.100.2",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// vlanInterface returns port1 of the DUT with the address of dutPort1 on
+// subinterface subIntf, which matches the packets with VLAN vlanID.
+func vlanInterface(t *testing.T, dut *ondatra.DUTDevice) *oc.Interface {
+	t.Helper()
+	dp1 := dut.Port(t, "port1")
+	i := &oc.Interface{Name: ygot.String(dp1.Name())}
+	i.SetDescription(dutPort1.Desc)
+	i.SetType(oc.IETFInterfaces_InterfaceType_ethernetCsmacd)
+	if deviations.InterfaceEnabled(dut) {
+		i.SetEnabled(true)
+	}
+	if deviations.RequireRoutedSubinterface0(dut) {
+		i.GetOrCreateSubinterface(0).GetOrCreateIpv4().SetEnabled(true)
+	}
+	s := i.GetOrCreateSubinterface(subIntf)
+	if deviations.DeprecatedVlanID(dut) {
+		s.GetOrCreateVlan().VlanId = oc.UnionUint16(vlanID)
+	} else {
+		s.GetOrCreateVlan().GetOrCreateMatch().GetOrCreateSingleTagged().SetVlanId(vlanID)
+	}
+	s4 := s.GetOrCreateIpv4()
+	if deviations.InterfaceEnabled(dut) && !deviations.IPv4MissingEnabled(dut) {
+		s4.SetEnabled(true)
+	}
+	s4.GetOrCreateAddress(dutPort1.IPv4).SetPrefixLength(dutPort1.IPv4Len)
+	return i
+}
+
+// configureDUT configures the VLAN subinterface of port1 and port2.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	dp1 := dut.Port(t, "port1")
+	dp2 := dut.Port(t, "port2")
+	gnmi.Replace(t, dut, gnmi.OC().Interface(dp1.Name()).Config(), vlanInterface(t, dut))
+	gnmi.Replace(t, dut, gnmi.OC().Interface(dp2.Name()).Config(), dutPort2.NewOCInterface(dp2.Name(), dut))
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, dp1.Name(), deviations.DefaultNetworkInstance(dut), subIntf)
+		fptest.AssignToNetworkInstance(t, dut, dp2.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, dp1)
+		fptest.SetPortSpeed(t, dp2)
+	}
+}
+
+// configurePolicer replaces the QoS configuration of the DUT with the
+// policer p on the input of the VLAN subinterface of port1.
+func configurePolicer(t *testing.T, dut *ondatra.DUTDevice, p qoscfg.Policer) {
+	t.Helper()
+	b := qoscfg.New(dut)
+	b.AddPolicer("policer", policerSeq, p)
+	b.AddInputSchedulerPolicy(dut.Port(t, "port1").Name(), subIntf, "policer")
+	b.Push(t, dut)
+}
+
+// policerCounters returns the conforming and exceeding packets of the
+// policer.
+func policerCounters(t *testing.T, dut *ondatra.DUTDevice) (conforming, exceeding uint64) {
+	t.Helper()
+	id := qoscfg.SubinterfaceID(dut.Port(t, "port1").Name(), subIntf)
+	s := gnmi.Get(t, dut, gnmi.OC().Qos().Interface(id).Input().SchedulerPolicy().Scheduler(policerSeq).State())
+	return s.GetConformingPkts(), s.GetExceedingPkts()
+}
+
+// readCapture returns the counts of the IPv4 packets of the flow captured on
+// port2 by DSCP.
+func readCapture(t *testing.T, ate *ondatra.ATEDevice) map[uint8]int {
+	t.Helper()
+	counts := map[uint8]int{}
+	for _, p := range otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, "port2").ID()) {
+		ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok || ip.DstIP.String() != ateDst.IPv4 {
+			continue
+		}
+		counts[ip.TOS>>2]++
+	}
+	return counts
+}
+
+// checkPct checks that got is within the tolerance of want, both in percent.
+func checkPct(t *testing.T, desc string, got, want float64) {
+	t.Helper()
+	t.Logf("%s: got %.2f%%, want %.2f%%", desc, got, want)
+	if got < want-*tolerance || got > want+*tolerance {
+		t.Errorf("%s: got %.2f%%, want %.2f%% ± %.2f%%", desc, got, want, *tolerance)
+	}
+}
+
+func TestIngressPolicer(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configureDUT(t, dut)
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	src := ateSrc.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	src.Ethernets().Items()[0].Vlans().Add().SetName(ateSrc.Name + ".VLAN").SetId(vlanID)
+	ateDst.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+	top.Captures().Add().SetName(captureName).SetPortNames([]string{ate.Port(t, "port2").ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+
+	flow := top.Flows().Add().SetName("policed")
+	flow.Metrics().SetEnable(true)
+	flow.TxRx().Device().SetTxNames([]string{ateSrc.Name + ".IPv4"}).SetRxNames([]string{ateDst.Name + ".IPv4"})
+	flow.Packet().Add().Ethernet().Src().SetValue(ateSrc.MAC)
+	flow.Packet().Add().Vlan().Id().SetValue(vlanID)
+	ip := flow.Packet().Add().Ipv4()
+	ip.Src().SetValue(ateSrc.IPv4)
+	ip.Dst().SetValue(ateDst.IPv4)
+	ip.Priority().Dscp().Phb().SetValue(dscp)
+	flow.Size().SetFixed(frameSize)
+
+	cases := []struct {
+		desc     string
+		policer  qoscfg.Policer
+		rateMbps uint64
+		// wantRxPct and wantExceedPct are the percentages of the sent packets
+		// which are received and which exceed the rate of the policer.
+		wantRxPct     float64
+		wantExceedPct float64
+	}{{
+		desc:          "Drop below CIR",
+		policer:       qoscfg.Policer{CIR: cirMbps * 1e6, BC: burst},
+		rateMbps:      cirMbps / 2,
+		wantRxPct:     100,
+		wantExceedPct: 0,
+	}, {
+		desc:          "Drop above CIR",
+		policer:       qoscfg.Policer{CIR: cirMbps * 1e6, BC: burst},
+		rateMbps:      cirMbps * 2,
+		wantRxPct:     50,
+		wantExceedPct: 50,
+	}, {
+		desc:          "Remark above CIR",
+		policer:       qoscfg.Policer{CIR: cirMbps * 1e6, BC: burst, ExceedDSCP: ygot.Uint8(exceedDSCP)},
+		rateMbps:      cirMbps * 2,
+		wantRxPct:     100,
+		wantExceedPct: 50,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			configurePolicer(t, dut, tc.policer)
+			flow.Rate().SetMbps(tc.rateMbps)
+			ate.OTG().PushConfig(t, top)
+			ate.OTG().StartProtocols(t)
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+			conformingBefore, exceedingBefore := policerCounters(t, dut)
+			otgutils.StartCapture(t, ate.OTG())
+			ate.OTG().StartTraffic(t)
+			time.Sleep(*trafficDuration)
+			ate.OTG().StopTraffic(t)
+			otgutils.StopCapture(t, ate.OTG())
+			time.Sleep(30 * time.Second)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+			conformingAfter, exceedingAfter := policerCounters(t, dut)
+
+			counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(flow.Name()).Counters().State())
+			tx, rx := counters.GetOutPkts(), counters.GetInPkts()
+			if tx == 0 {
+				t.Fatalf("Flow %s sent no packets", flow.Name())
+			}
+			conforming := conformingAfter - conformingBefore
+			exceeding := exceedingAfter - exceedingBefore
+			t.Logf("Sent %d packets, received %d, %d conforming and %d exceeding", tx, rx, conforming, exceeding)
+			checkPct(t, "Received packets", float64(rx)*100/float64(tx), tc.wantRxPct)
+			checkPct(t, "Conforming packets", float64(conforming)*100/float64(tx), 100-tc.wantExceedPct)
+			checkPct(t, "Exceeding packets", float64(exceeding)*100/float64(tx), tc.wantExceedPct)
+
+			counts := readCapture(t, ate)
+			t.Logf("Captured packets by DSCP: %v", counts)
+			if counts[dscp] == 0 {
+				t.Errorf("No packets captured with DSCP %d", dscp)
+			}
+			switch {
+			case tc.policer.ExceedDSCP != nil && counts[exceedDSCP] == 0:
+				t.Errorf("No packets captured with the exceed DSCP %d", exceedDSCP)
+			case tc.policer.ExceedDSCP == nil && counts[exceedDSCP] != 0:
+				t.Errorf("Got %d packets captured with DSCP %d, want none", counts[exceedDSCP], exceedDSCP)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue_counters_test
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/featureprofiles/internal/qoscfg"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+)
+
+var (
+	packets   = flag.Uint("packets", 10000, "number of packets of each flow of the known counts test case")
+	tolerance = flag.Float64("tolerance", 1, "percentage of the packets of a queue by which its counters may differ from the ATE statistics, to allow for control plane packets")
+)
+
+// The testbed consists of ate:port1 -> dut:port1, ate:port2 -> dut:port2 and
+// dut:port3 -> ate:port3.
+const (
+	plen = 31
+	// statsTimeout is the time allowed for the flows to stop and their
+	// statistics to settle.
+	statsTimeout = 30 * time.Second
+)
+
+var (
+	ateSrc1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "198.51.100.1",
+		IPv4Len: plen,
+	}
+	ateSrc2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:01:01:01:02",
+		IPv4:    "198.51.100.3",
+		IPv4Len: plen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:01:01:01:03",
+		IPv4:    "198.51.100.5",
+		IPv4Len: plen,
+	}
+	dutPort1 = attrs.Attributes{
+		Desc:    "Input interface port1",
+		IPv4:    "198.51.100.0",
+		IPv4Len: plen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "Input interface port2",
+		IPv4:    "198.51.100.2",
+		IPv4Len: plen,
+	}
+	dutPort3 = attrs.Attributes{
+		Desc:    "Output interface port3",
+		IPv4:    "198.51.100.4",
+		IPv4Len: plen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// class is a traffic class with the DSCP values classified into its queue.
+type class struct {
+	name      string
+	queue     string
+	dscp      []uint8
+	frameSize uint32
+}
+
+// flowData is a flow of frameSize byte packets with DSCP dscp from src, into
+// queue.
+type flowData struct {
+	name      string
+	src       attrs.Attributes
+	dscp      uint8
+	frameSize uint32
+	queue     string
+	ratePct   float32
+	packets   uint32
+}
+
+// classes returns the traffic classes, each with a different frame size.
+func classes(t *testing.T, dut *ondatra.DUTDevice) []*class {
+	queues := netutil.CommonTrafficQueues(t, dut)
+	return []*class{
+		{name: "NC1", queue: queues.NC1, dscp: []uint8{48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59}, frameSize: 700},
+		{name: "AF4", queue: queues.AF4, dscp: []uint8{32, 33, 34, 35}, frameSize: 400},
+		{name: "AF3", queue: queues.AF3, dscp: []uint8{24, 25, 26, 27}, frameSize: 1300},
+		{name: "AF2", queue: queues.AF2, dscp: []uint8{16, 17, 18, 19}, frameSize: 1200},
+		{name: "AF1", queue: queues.AF1, dscp: []uint8{8, 9, 10, 11}, frameSize: 1000},
+		{name: "BE0", queue: queues.BE0, dscp: []uint8{4, 5, 6, 7}, frameSize: 1110},
+		{name: "BE1", queue: queues.BE1, dscp: []uint8{0, 1, 2, 3}, frameSize: 1111},
+	}
+}
+
+// configureDUT configures the DUT interfaces, and a QoS policy which
+// classifies the DSCP values of each class into its queue, with NC1 strict
+// priority and the other classes WRR on port3.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice, classes []*class) {
+	t.Helper()
+	for _, p := range []struct {
+		port  *ondatra.Port
+		attrs attrs.Attributes
+	}{
+		{dut.Port(t, "port1"), dutPort1},
+		{dut.Port(t, "port2"), dutPort2},
+		{dut.Port(t, "port3"), dutPort3},
+	} {
+		gnmi.Replace(t, dut, gnmi.OC().Interface(p.port.Name()).Config(), p.attrs.NewOCInterface(p.port.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, p.port.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, p.port)
+		}
+	}
+
+	dp3 := dut.Port(t, "port3").Name()
+	b := qoscfg.New(dut)
+	for i, c := range classes {
+		if deviations.QOSQueueRequiresID(dut) {
+			b.AddQueue(c.queue, uint8(len(classes)-i))
+		}
+		targetGroup := "target-group-" + c.name
+		b.AddForwardingGroup(targetGroup, c.queue)
+		b.AddClassifier("dscp_based_classifier_ipv4", oc.Qos_Classifier_Type_IPV4, qoscfg.ClassifierTerm{ID: c.name, TargetGroup: targetGroup, DSCP: c.dscp})
+		if c.name == "NC1" {
+			b.AddScheduler("scheduler", 0, oc.Scheduler_Priority_STRICT, qoscfg.SchedulerInput{ID: c.name, Queue: c.queue, Weight: 1})
+		} else {
+			b.AddScheduler("scheduler", 1, oc.Scheduler_Priority_UNSET, qoscfg.SchedulerInput{ID: c.name, Queue: c.queue, Weight: 1})
+		}
+		b.AddOutputSchedulerPolicy(dp3, "scheduler", c.queue)
+	}
+	for _, port := range []string{"port1", "port2"} {
+		b.AddInputClassifier(dut.Port(t, port).Name(), oc.Input_Classifier_Type_IPV4, "dscp_based_classifier_ipv4")
+	}
+	b.Push(t, dut)
+}
+
+// addFlows replaces the flows of top with flows.
+func addFlows(top gosnappi.Config, flows []*flowData) {
+	top.Flows().Clear()
+	for _, f := range flows {
+		flow := top.Flows().Add().SetName(f.name)
+		flow.Metrics().SetEnable(true)
+		flow.TxRx().Device().SetTxNames([]string{f.src.Name + ".IPv4"}).SetRxNames([]string{ateDst.Name + ".IPv4"})
+		flow.Packet().Add().Ethernet().Src().SetValue(f.src.MAC)
+		ip := flow.Packet().Add().Ipv4()
+		ip.Src().SetValue(f.src.IPv4)
+		ip.Dst().SetValue(ateDst.IPv4)
+		ip.Priority().Dscp().Phb().SetValue(uint32(f.dscp))
+		flow.Size().SetFixed(f.frameSize)
+		flow.Rate().SetPercentage(f.ratePct)
+		flow.Duration().FixedPackets().SetPackets(f.packets)
+	}
+}
+
+// counters are the counters of an output queue.
+type counters struct {
+	transmitPkts, transmitOctets, droppedPkts uint64
+}
+
+// queueCounters returns the counters of the output queues of port3.
+func queueCounters(t *testing.T, dut *ondatra.DUTDevice, queues []string) map[string]*counters {
+	t.Helper()
+	output := gnmi.OC().Qos().Interface(dut.Port(t, "port3").Name()).Output()
+	c := map[string]*counters{}
+	for _, queue := range queues {
+		q := gnmi.Get(t, dut, output.Queue(queue).State())
+		c[queue] = &counters{transmitPkts: q.GetTransmitPkts(), transmitOctets: q.GetTransmitOctets(), droppedPkts: q.GetDroppedPkts()}
+	}
+	return c
+}
+
+// checkCounter checks that the counter name of queue increased by got, which
+// is want or up to tolerance percent more.
+func checkCounter(t *testing.T, queue, name string, got, want uint64) {
+	t.Helper()
+	t.Logf("Queue %s: %s increased by %d, want %d", queue, name, got, want)
+	if got < want || float64(got-want)*100 > *tolerance*float64(want) {
+		t.Errorf("Queue %s: got %s increased by %d, want %d (+%.2f%%)", queue, name, got, want, *tolerance)
+	}
+}
+
+func TestQueueCounters(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	cs := classes(t, dut)
+	configureDUT(t, dut, cs)
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	ateSrc2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+	ateDst.AddToOTG(top, ate.Port(t, "port3"), &dutPort3)
+
+	// Known counts sends a flow of each DSCP value of each class without
+	// congestion. Congestion sends BE1 at 120% of the rate of port3.
+	var known []*flowData
+	for _, c := range cs {
+		for _, dscp := range c.dscp {
+			known = append(known, &flowData{
+				name:      fmt.Sprintf("%s-dscp%d", c.name, dscp),
+				src:       ateSrc1,
+				dscp:      dscp,
+				frameSize: c.frameSize,
+				queue:     c.queue,
+				ratePct:   1,
+				packets:   uint32(*packets),
+			})
+		}
+	}
+	be1 := cs[len(cs)-1]
+	var congestion []*flowData
+	for _, src := range []attrs.Attributes{ateSrc1, ateSrc2} {
+		congestion = append(congestion, &flowData{
+			name:      src.Name + "-BE1",
+			src:       src,
+			dscp:      be1.dscp[0],
+			frameSize: be1.frameSize,
+			queue:     be1.queue,
+			ratePct:   60,
+			packets:   uint32(*packets) * 100,
+		})
+	}
+
+	queues := make([]string, 0, len(cs))
+	for _, c := range cs {
+		queues = append(queues, c.queue)
+	}
+	cases := []struct {
+		desc  string
+		flows []*flowData
+		drops bool
+	}{{
+		desc:  "Known counts",
+		flows: known,
+	}, {
+		desc:  "Congestion",
+		flows: congestion,
+		drops: true,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			addFlows(top, tc.flows)
+			ate.OTG().PushConfig(t, top)
+			ate.OTG().StartProtocols(t)
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+			before := queueCounters(t, dut, queues)
+			ate.OTG().StartTraffic(t)
+			tx := map[string]uint64{}
+			rx := map[string]uint64{}
+			rxOctets := map[string]uint64{}
+			for _, f := range tc.flows {
+				ftx, frx := otgutils.GetFlowStats(t, ate.OTG(), f.name, statsTimeout)
+				if ftx == 0 {
+					t.Fatalf("Flow %s sent no packets", f.name)
+				}
+				tx[f.queue] += ftx
+				rx[f.queue] += frx
+				rxOctets[f.queue] += frx * uint64(f.frameSize)
+			}
+			ate.OTG().StopTraffic(t)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+			after := queueCounters(t, dut, queues)
+
+			for _, queue := range queues {
+				if tx[queue] == 0 {
+					// The queue may have control plane packets only.
+					continue
+				}
+				transmitPkts := after[queue].transmitPkts - before[queue].transmitPkts
+				transmitOctets := after[queue].transmitOctets - before[queue].transmitOctets
+				droppedPkts := after[queue].droppedPkts - before[queue].droppedPkts
+				if !tc.drops && rx[queue] != tx[queue] {
+					t.Errorf("Queue %s: got %d of %d packets received by the ATE, want all", queue, rx[queue], tx[queue])
+				}
+				checkCounter(t, queue, "transmit-pkts", transmitPkts, rx[queue])
+				if !deviations.QOSOctets(dut) {
+					checkCounter(t, queue, "transmit-octets", transmitOctets, rxOctets[queue])
+				}
+				checkCounter(t, queue, "dropped-pkts", droppedPkts, tx[queue]-rx[queue])
+			}
+		})
+	}
+}
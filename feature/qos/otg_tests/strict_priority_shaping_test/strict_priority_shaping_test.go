@@ -0,0 +1,269 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package strict_priority_shaping_test
+
+import (
+	"flag"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/featureprofiles/internal/qoscfg"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+)
+
+var (
+	trafficDuration = flag.Duration("traffic_duration", 30*time.Second, "duration of the traffic of each test case")
+	tolerance       = flag.Float64("tolerance", 2, "tolerance of the received percentage of the traffic of each class")
+)
+
+// The testbed consists of ate:port1 -> dut:port1, ate:port2 -> dut:port2 and
+// dut:port3 -> ate:port3.
+const (
+	plen      = 31
+	frameSize = 1000
+	// burst is the burst size of the shapers in bytes.
+	burst = 100000
+)
+
+var (
+	ateSrc1 = attrs.Attributes{
+		Name:    "ate1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "198.51.100.1",
+		IPv4Len: plen,
+	}
+	ateSrc2 = attrs.Attributes{
+		Name:    "ate2",
+		MAC:     "02:00:01:01:01:02",
+		IPv4:    "198.51.100.3",
+		IPv4Len: plen,
+	}
+	ateDst = attrs.Attributes{
+		Name:    "ate3",
+		MAC:     "02:00:01:01:01:03",
+		IPv4:    "198.51.100.5",
+		IPv4Len: plen,
+	}
+	dutPort1 = attrs.Attributes{
+		Desc:    "Input interface port1",
+		IPv4:    "198.51.100.0",
+		IPv4Len: plen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "Input interface port2",
+		IPv4:    "198.51.100.2",
+		IPv4Len: plen,
+	}
+	dutPort3 = attrs.Attributes{
+		Desc:    "Output interface port3",
+		IPv4:    "198.51.100.4",
+		IPv4Len: plen,
+	}
+
+	// speedGbps maps the port speeds to Gbps.
+	speedGbps = map[oc.E_IfEthernet_ETHERNET_SPEED]uint64{
+		oc.IfEthernet_ETHERNET_SPEED_SPEED_10GB:  10,
+		oc.IfEthernet_ETHERNET_SPEED_SPEED_25GB:  25,
+		oc.IfEthernet_ETHERNET_SPEED_SPEED_40GB:  40,
+		oc.IfEthernet_ETHERNET_SPEED_SPEED_50GB:  50,
+		oc.IfEthernet_ETHERNET_SPEED_SPEED_100GB: 100,
+		oc.IfEthernet_ETHERNET_SPEED_SPEED_200GB: 200,
+		oc.IfEthernet_ETHERNET_SPEED_SPEED_400GB: 400,
+		oc.IfEthernet_ETHERNET_SPEED_SPEED_800GB: 800,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// class is a traffic class, with a scheduler of its own on port3.
+type class struct {
+	name     string
+	queue    string
+	dscp     uint8
+	sequence uint32
+	priority oc.E_Scheduler_Priority
+	// shapePct is the shaping rate in percent of the rate of port3, or 0 if
+	// the class is not shaped.
+	shapePct uint64
+}
+
+// portSpeed returns the speed of port p in bits per second.
+func portSpeed(t *testing.T, dut *ondatra.DUTDevice, p *ondatra.Port) uint64 {
+	t.Helper()
+	if s := uint64(p.Speed()); s != 0 {
+		return s * 1e9
+	}
+	speed := gnmi.Get(t, dut, gnmi.OC().Interface(p.Name()).Ethernet().PortSpeed().State())
+	gbps, ok := speedGbps[speed]
+	if !ok {
+		t.Fatalf("Unknown speed %v of port %s", speed, p.Name())
+	}
+	return gbps * 1e9
+}
+
+// configureDUT configures the DUT interfaces, and a QoS policy which
+// classifies the traffic classes and schedules them on port3.
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice, classes []*class) {
+	t.Helper()
+	for _, p := range []struct {
+		port  *ondatra.Port
+		attrs attrs.Attributes
+	}{
+		{dut.Port(t, "port1"), dutPort1},
+		{dut.Port(t, "port2"), dutPort2},
+		{dut.Port(t, "port3"), dutPort3},
+	} {
+		gnmi.Replace(t, dut, gnmi.OC().Interface(p.port.Name()).Config(), p.attrs.NewOCInterface(p.port.Name(), dut))
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, p.port.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		}
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, p.port)
+		}
+	}
+
+	dp3 := dut.Port(t, "port3")
+	speed := portSpeed(t, dut, dp3)
+	b := qoscfg.New(dut)
+	for i, c := range classes {
+		if deviations.QOSQueueRequiresID(dut) {
+			b.AddQueue(c.queue, uint8(len(classes)-i))
+		}
+		targetGroup := "target-group-" + c.name
+		b.AddForwardingGroup(targetGroup, c.queue)
+		b.AddClassifier("dscp_based_classifier_ipv4", oc.Qos_Classifier_Type_IPV4, qoscfg.ClassifierTerm{ID: c.name, TargetGroup: targetGroup, DSCP: []uint8{c.dscp}})
+		b.AddScheduler("scheduler", c.sequence, c.priority, qoscfg.SchedulerInput{ID: c.name, Queue: c.queue, Weight: 1})
+		if c.shapePct != 0 {
+			b.AddShaper("scheduler", c.sequence, speed*c.shapePct/100, burst)
+		}
+		b.AddOutputSchedulerPolicy(dp3.Name(), "scheduler", c.queue)
+	}
+	for _, port := range []string{"port1", "port2"} {
+		b.AddInputClassifier(dut.Port(t, port).Name(), oc.Input_Classifier_Type_IPV4, "dscp_based_classifier_ipv4")
+	}
+	b.Push(t, dut)
+}
+
+// addFlows replaces the flows of top with a flow of each class from each of
+// ATE port1 and port2, each with half of the rate of the class in rates, in
+// percent of the line rate.
+func addFlows(top gosnappi.Config, classes []*class, rates map[string]float32) {
+	top.Flows().Clear()
+	for _, c := range classes {
+		for _, src := range []attrs.Attributes{ateSrc1, ateSrc2} {
+			flow := top.Flows().Add().SetName(src.Name + "-" + c.name)
+			flow.Metrics().SetEnable(true)
+			flow.TxRx().Device().SetTxNames([]string{src.Name + ".IPv4"}).SetRxNames([]string{ateDst.Name + ".IPv4"})
+			flow.Packet().Add().Ethernet().Src().SetValue(src.MAC)
+			ip := flow.Packet().Add().Ipv4()
+			ip.Src().SetValue(src.IPv4)
+			ip.Dst().SetValue(ateDst.IPv4)
+			ip.Priority().Dscp().Phb().SetValue(uint32(c.dscp))
+			flow.Size().SetFixed(frameSize)
+			flow.Rate().SetPercentage(rates[c.name] / 2)
+		}
+	}
+}
+
+func TestStrictPriorityShaping(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	queues := netutil.CommonTrafficQueues(t, dut)
+	classes := []*class{
+		{name: "NC1", queue: queues.NC1, dscp: 48, sequence: 0, priority: oc.Scheduler_Priority_STRICT},
+		{name: "AF3", queue: queues.AF3, dscp: 24, sequence: 1, priority: oc.Scheduler_Priority_UNSET, shapePct: 20},
+		{name: "BE1", queue: queues.BE1, dscp: 0, sequence: 2, priority: oc.Scheduler_Priority_UNSET, shapePct: 30},
+	}
+	configureDUT(t, dut, classes)
+
+	ate := ondatra.ATE(t, "ate")
+	top := gosnappi.NewConfig()
+	ateSrc1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	ateSrc2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+	ateDst.AddToOTG(top, ate.Port(t, "port3"), &dutPort3)
+
+	// The rates are in percent of the rate of port3, which is the rate of the
+	// ATE ports.
+	cases := []struct {
+		desc      string
+		rates     map[string]float32
+		wantRxPct map[string]float32
+	}{{
+		desc:      "Below the shaping rates",
+		rates:     map[string]float32{"NC1": 10, "AF3": 15, "BE1": 25},
+		wantRxPct: map[string]float32{"NC1": 100, "AF3": 100, "BE1": 100},
+	}, {
+		desc:      "Above the shaping rates",
+		rates:     map[string]float32{"NC1": 20, "AF3": 40, "BE1": 40},
+		wantRxPct: map[string]float32{"NC1": 100, "AF3": 50, "BE1": 75},
+	}, {
+		// The strict priority class leaves 20% to the shaped classes, which
+		// have the same weight.
+		desc:      "Strict priority above the remaining rate",
+		rates:     map[string]float32{"NC1": 80, "AF3": 20, "BE1": 20},
+		wantRxPct: map[string]float32{"NC1": 100, "AF3": 50, "BE1": 50},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			addFlows(top, classes, tc.rates)
+			ate.OTG().PushConfig(t, top)
+			ate.OTG().StartProtocols(t)
+			otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+			ate.OTG().StartTraffic(t)
+			time.Sleep(*trafficDuration)
+			ate.OTG().StopTraffic(t)
+			time.Sleep(30 * time.Second)
+			otgutils.LogFlowMetrics(t, ate.OTG(), top)
+
+			tx := map[string]uint64{}
+			rx := map[string]uint64{}
+			for _, c := range classes {
+				for _, src := range []attrs.Attributes{ateSrc1, ateSrc2} {
+					counters := gnmi.Get(t, ate.OTG(), gnmi.OTG().Flow(src.Name+"-"+c.name).Counters().State())
+					tx[c.name] += counters.GetOutPkts()
+					rx[c.name] += counters.GetInPkts()
+				}
+			}
+			names := make([]string, 0, len(tc.wantRxPct))
+			for name := range tc.wantRxPct {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if tx[name] == 0 {
+					t.Fatalf("Class %s sent no packets", name)
+				}
+				got := float64(rx[name]) * 100 / float64(tx[name])
+				want := float64(tc.wantRxPct[name])
+				t.Logf("Class %s: %d sent, %d received (%.2f%%)", name, tx[name], rx[name], got)
+				if got < want-*tolerance || got > want+*tolerance {
+					t.Errorf("Class %s: got %.2f%% of the packets received, want %.2f%% ± %.2f%%", name, got, want, *tolerance)
+				}
+			}
+		})
+	}
+}
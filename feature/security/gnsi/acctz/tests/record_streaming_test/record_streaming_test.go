@@ -0,0 +1,253 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package record_streaming_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"golang.org/x/crypto/ssh"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	acctzpb "github.com/openconfig/gnsi/acctz"
+)
+
+var (
+	gnmiUser = flag.String("gnmi_user", "",
+		"the user of the testbed binding; if set, the identity of gRPC records must match it")
+	cliCommand = flag.String("cli_command", "show version",
+		"a read-only CLI command which is run to generate a CLI accounting record")
+	sshAddr = flag.String("ssh_addr", "",
+		"host:port of the SSH server of the DUT; if empty the DUT name and port 22 are used")
+	sshUser = flag.String("ssh_user", "",
+		"user for the SSH login; the SSH login record is not verified if empty")
+	sshPassword = flag.String("ssh_password", "", "password of -ssh_user")
+)
+
+const (
+	// recordTimeout is the time allowed for all expected records to arrive.
+	recordTimeout = 2 * time.Minute
+	sshTimeout    = 30 * time.Second
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// expectedRecord describes an accounting record the test waits for.
+type expectedRecord struct {
+	desc  string
+	match func(*acctzpb.RecordResponse) bool
+	check func(*testing.T, *acctzpb.RecordResponse)
+}
+
+// generateGNMISet replaces the MOTD banner with a unique marker and returns
+// the expected gNMI Set record.
+func generateGNMISet(t *testing.T, dut *ondatra.DUTDevice) expectedRecord {
+	marker := fmt.Sprintf("acctz-record-%d", time.Now().UnixNano())
+	gnmi.Replace(t, dut, gnmi.OC().System().MotdBanner().Config(), marker)
+	t.Cleanup(func() { gnmi.Delete(t, dut, gnmi.OC().System().MotdBanner().Config()) })
+
+	return expectedRecord{
+		desc: "gNMI Set",
+		match: func(r *acctzpb.RecordResponse) bool {
+			s := r.GetGrpcService()
+			if s.GetServiceType() != acctzpb.GrpcService_GRPC_SERVICE_TYPE_GNMI || s.GetRpcName() != "/gnmi.gNMI/Set" {
+				return false
+			}
+			for _, p := range s.GetPayloads() {
+				if bytes.Contains(p.GetValue(), []byte(marker)) {
+					return true
+				}
+			}
+			return s.GetPayloadIstruncated()
+		},
+		check: func(t *testing.T, r *acctzpb.RecordResponse) {
+			if got := r.GetGrpcService().GetAuthz().GetStatus(); got != acctzpb.AuthzDetail_AUTHZ_STATUS_PERMIT {
+				t.Errorf("authz status: got %v, want %v", got, acctzpb.AuthzDetail_AUTHZ_STATUS_PERMIT)
+			}
+			checkIdentity(t, r, *gnmiUser)
+		},
+	}
+}
+
+// generateCLI runs the CLI command and returns the expected CLI record.
+func generateCLI(t *testing.T, dut *ondatra.DUTDevice) (expectedRecord, bool) {
+	ctx := context.Background()
+	cli, err := dut.RawAPIs().BindingDUT().DialCLI(ctx)
+	if err != nil {
+		t.Logf("CLI of %s not available, CLI record not verified: %v", dut.Name(), err)
+		return expectedRecord{}, false
+	}
+	if _, err := cli.RunCommand(ctx, *cliCommand); err != nil {
+		t.Fatalf("RunCommand(%q): %v", *cliCommand, err)
+	}
+
+	return expectedRecord{
+		desc: "CLI command",
+		match: func(r *acctzpb.RecordResponse) bool {
+			s := r.GetCmdService()
+			if s.GetServiceType() != acctzpb.CommandService_CMD_SERVICE_TYPE_CLI {
+				return false
+			}
+			cmd := strings.Join(append([]string{s.GetCmd()}, s.GetCmdArgs()...), " ")
+			return strings.Contains(cmd, *cliCommand) || s.GetCmdIstruncated() || s.GetCmdArgsIstruncated()
+		},
+		check: func(t *testing.T, r *acctzpb.RecordResponse) {
+			if got := r.GetCmdService().GetAuthz().GetStatus(); got != acctzpb.AuthzDetail_AUTHZ_STATUS_PERMIT {
+				t.Errorf("authz status: got %v, want %v", got, acctzpb.AuthzDetail_AUTHZ_STATUS_PERMIT)
+			}
+			checkIdentity(t, r, "")
+		},
+	}, true
+}
+
+// generateSSHLogin logs into the DUT over SSH and returns the expected login
+// record.
+func generateSSHLogin(t *testing.T, dut *ondatra.DUTDevice) (expectedRecord, bool) {
+	if *sshUser == "" {
+		t.Logf("-ssh_user not set, SSH login record not verified")
+		return expectedRecord{}, false
+	}
+	addr := *sshAddr
+	if addr == "" {
+		addr = net.JoinHostPort(dut.Name(), "22")
+	}
+	c, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            *sshUser,
+		Auth:            []ssh.AuthMethod{ssh.Password(*sshPassword)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         sshTimeout,
+	})
+	if err != nil {
+		t.Fatalf("SSH login of %s to %s: %v", *sshUser, addr, err)
+	}
+	local := c.LocalAddr().(*net.TCPAddr)
+	c.Close()
+
+	return expectedRecord{
+		desc: "SSH login",
+		match: func(r *acctzpb.RecordResponse) bool {
+			si := r.GetSessionInfo()
+			return si.GetStatus() == acctzpb.SessionInfo_SESSION_STATUS_LOGIN && si.GetRemotePort() == uint32(local.Port)
+		},
+		check: func(t *testing.T, r *acctzpb.RecordResponse) {
+			si := r.GetSessionInfo()
+			if got := si.GetRemoteAddress(); net.ParseIP(got) == nil {
+				t.Errorf("remote_address: got %q, want an IP address", got)
+			}
+			if got, want := si.GetIpProto(), uint32(6); got != want {
+				t.Errorf("ip_proto: got %d, want %d", got, want)
+			}
+			if got := si.GetAuthn().GetType(); got != acctzpb.AuthnDetail_AUTHN_TYPE_PASSWORD {
+				t.Errorf("authn type: got %v, want %v", got, acctzpb.AuthnDetail_AUTHN_TYPE_PASSWORD)
+			}
+			if got := si.GetAuthn().GetStatus(); got != acctzpb.AuthnDetail_AUTHN_STATUS_SUCCESS {
+				t.Errorf("authn status: got %v, want %v", got, acctzpb.AuthnDetail_AUTHN_STATUS_SUCCESS)
+			}
+			checkIdentity(t, r, *sshUser)
+		},
+	}, true
+}
+
+// checkIdentity verifies that the record has a user identity, equal to want
+// if want is set.
+func checkIdentity(t *testing.T, r *acctzpb.RecordResponse, want string) {
+	t.Helper()
+	got := r.GetSessionInfo().GetUser().GetIdentity()
+	switch {
+	case got == "":
+		t.Errorf("user identity: got none, want %q", want)
+	case want != "" && got != want:
+		t.Errorf("user identity: got %q, want %q", got, want)
+	}
+}
+
+// collectRecords subscribes to the records generated since start and returns
+// the first record matching each expected record.
+func collectRecords(t *testing.T, dut *ondatra.DUTDevice, start time.Time, expected []expectedRecord) map[string]*acctzpb.RecordResponse {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+	stream, err := dut.RawAPIs().GNSI(t).Acctz().RecordSubscribe(ctx)
+	if err != nil {
+		t.Fatalf("Acctz.RecordSubscribe: %v", err)
+	}
+	if err := stream.Send(&acctzpb.RecordRequest{Timestamp: timestamppb.New(start)}); err != nil {
+		t.Fatalf("Acctz.RecordSubscribe send: %v", err)
+	}
+
+	found := map[string]*acctzpb.RecordResponse{}
+	for len(found) < len(expected) {
+		r, err := stream.Recv()
+		if err != nil {
+			t.Logf("Acctz.RecordSubscribe ended: %v", err)
+			break
+		}
+		if ts := r.GetTimestamp().AsTime(); ts.Before(start) {
+			t.Errorf("Record timestamp %v is before the requested timestamp %v: %s", ts, start, prototext.Format(r))
+		}
+		if r.GetHistoryIstruncated() {
+			t.Errorf("Record has history_istruncated set: %s", prototext.Format(r))
+		}
+		for _, e := range expected {
+			if _, ok := found[e.desc]; !ok && e.match(r) {
+				t.Logf("%s record: %s", e.desc, prototext.Format(r))
+				found[e.desc] = r
+			}
+		}
+	}
+	return found
+}
+
+func TestRecordStreaming(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	// The DUT and the test host are both NTP synchronized, so allow for a small
+	// skew between their clocks.
+	start := time.Now().Add(-time.Second)
+
+	expected := []expectedRecord{generateGNMISet(t, dut)}
+	if e, ok := generateCLI(t, dut); ok {
+		expected = append(expected, e)
+	}
+	if e, ok := generateSSHLogin(t, dut); ok {
+		expected = append(expected, e)
+	}
+	end := time.Now().Add(time.Second)
+
+	found := collectRecords(t, dut, start, expected)
+	for _, e := range expected {
+		t.Run(e.desc, func(t *testing.T) {
+			r, ok := found[e.desc]
+			if !ok {
+				t.Fatalf("No %s record received within %v", e.desc, recordTimeout)
+			}
+			if ts := r.GetTimestamp().AsTime(); ts.After(end) {
+				t.Errorf("timestamp: got %v, want between %v and %v", ts, start, end)
+			}
+			e.check(t, r)
+		})
+	}
+}
@@ -28,14 +28,13 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/gnoihelper"
 	"github.com/openconfig/featureprofiles/internal/security/authz"
 	"github.com/openconfig/featureprofiles/internal/security/gnxi"
 	"github.com/openconfig/featureprofiles/internal/security/svid"
 	gnps "github.com/openconfig/gnoi/system"
 	authzpb "github.com/openconfig/gnsi/authz"
 	"github.com/openconfig/ondatra"
-	"github.com/openconfig/ondatra/gnmi"
-	"github.com/openconfig/testt"
 )
 
 const (
@@ -189,6 +188,19 @@ func verifyAuthTable(t *testing.T, dut *ondatra.DUTDevice, authTable authorizati
 	}
 }
 
+// probeAuthTable takes an authorization Table and verifies the expected access
+// using Authz.Probe only, without executing the rpcs.
+func probeAuthTable(t *testing.T, dut *ondatra.DUTDevice, authTable authorizationTable) {
+	for certName, access := range authTable {
+		for _, allowedRPC := range access.allowed {
+			authz.Verify(t, dut, getSpiffe(t, dut, certName), allowedRPC)
+		}
+		for _, deniedRPC := range access.denied {
+			authz.Verify(t, dut, getSpiffe(t, dut, certName), deniedRPC, &authz.ExceptDeny{})
+		}
+	}
+}
+
 func getSpiffe(t *testing.T, dut *ondatra.DUTDevice, certName string) *authz.Spiffe {
 	spiffe, ok := usersMap[certName]
 	if !ok {
@@ -215,7 +227,11 @@ func TestAuthz1(t *testing.T) {
 		}
 		newpolicy.AddAllowRules("base", []string{*testInfraID}, []*gnxi.RPC{gnxi.RPCs.AllRPC})
 		// Rotate the policy.
-		newpolicy.Rotate(t, dut, uint64(100), "policy-everyone-can-gnmi-not-gribi_v1", false)
+		newpolicy.Rotate(t, dut, uint64(100), "policy-everyone-can-gnmi-not-gribi_v1", false, &authz.ProbeBeforeFinalize{Verify: func(t *testing.T) {
+			authz.Verify(t, dut, certAdminSpiffe, gnxi.RPCs.GribiGet, &authz.ExceptDeny{})
+			authz.Verify(t, dut, certAdminSpiffe, gnxi.RPCs.GnmiGet)
+		}})
+		authz.VerifyPolicyInfo(t, dut, "policy-everyone-can-gnmi-not-gribi_v1", 100)
 
 		// Verification of Policy for cert_user_admin is allowed gNMI Get and denied gRIBI Get
 		t.Run("Verification of Policy for cert_user_admin is allowed gNMI Get and denied gRIBI Get", func(t *testing.T) {
@@ -238,7 +254,11 @@ func TestAuthz1(t *testing.T) {
 		}
 		newpolicy.AddAllowRules("base", []string{*testInfraID}, []*gnxi.RPC{gnxi.RPCs.AllRPC})
 		// Rotate the policy.
-		newpolicy.Rotate(t, dut, uint64(100), "policy-everyone-can-gribi-not-gnmi_v1", false)
+		newpolicy.Rotate(t, dut, uint64(100), "policy-everyone-can-gribi-not-gnmi_v1", false, &authz.ProbeBeforeFinalize{Verify: func(t *testing.T) {
+			authz.Verify(t, dut, getSpiffe(t, dut, "cert_deny_all"), gnxi.RPCs.GnmiGet, &authz.ExceptDeny{})
+			authz.Verify(t, dut, certAdminSpiffe, gnxi.RPCs.GribiGet)
+		}})
+		authz.VerifyPolicyInfo(t, dut, "policy-everyone-can-gribi-not-gnmi_v1", 100)
 
 		t.Run("Verification of cert_deny_all is denied to issue gRIBI.Get and cert_user_admin is allowed to issue `gRIBI.Get`", func(t *testing.T) {
 			authz.Verify(t, dut, getSpiffe(t, dut, "cert_deny_all"), gnxi.RPCs.GnmiGet, &authz.ExceptDeny{}, &authz.HardVerify{})
@@ -261,7 +281,11 @@ func TestAuthz1(t *testing.T) {
 		}
 		newpolicy.AddAllowRules("base", []string{*testInfraID}, []*gnxi.RPC{gnxi.RPCs.AllRPC})
 		// Rotate the policy.
-		newpolicy.Rotate(t, dut, uint64(100), "policy-gribi-get_v1", false)
+		newpolicy.Rotate(t, dut, uint64(100), "policy-gribi-get_v1", false, &authz.ProbeBeforeFinalize{Verify: func(t *testing.T) {
+			authz.Verify(t, dut, readOnlySpiffe, gnxi.RPCs.GribiGet)
+			authz.Verify(t, dut, readOnlySpiffe, gnxi.RPCs.GnmiGet, &authz.ExceptDeny{})
+		}})
+		authz.VerifyPolicyInfo(t, dut, "policy-gribi-get_v1", 100)
 
 		// Verification of Policy for read_only to allow gRIBI Get and to deny gNMI Get
 		authz.Verify(t, dut, readOnlySpiffe, gnxi.RPCs.GribiGet, &authz.HardVerify{})
@@ -296,7 +320,10 @@ func TestAuthz1(t *testing.T) {
 		}
 		newpolicy.AddAllowRules("base", []string{*testInfraID}, []*gnxi.RPC{gnxi.RPCs.AllRPC})
 		// Rotate the policy.
-		newpolicy.Rotate(t, dut, uint64(100), "policy-normal-1_v1", false)
+		newpolicy.Rotate(t, dut, uint64(100), "policy-normal-1_v1", false, &authz.ProbeBeforeFinalize{Verify: func(t *testing.T) {
+			probeAuthTable(t, dut, authTable)
+		}})
+		authz.VerifyPolicyInfo(t, dut, "policy-normal-1_v1", 100)
 
 		// Verify all results match per the above table for policy policy-normal-1
 		verifyAuthTable(t, dut, authTable)
@@ -651,50 +678,11 @@ func TestAuthz4(t *testing.T) {
 	newpolicy.Rotate(t, dut, expCreatedOn, expVersion, false)
 
 	// Trigger Section - Reboot
-	gnoiClient, err := dut.RawAPIs().BindingDUT().DialGNOI(context.Background())
-	if err != nil {
-		t.Fatalf("Failed to connect to gnoi server, err: %v", err)
-	}
 	rebootRequest := &gnps.RebootRequest{
 		Method: gnps.RebootMethod_COLD,
 		Force:  true,
 	}
-	bootTimeBeforeReboot := gnmi.Get(t, dut, gnmi.OC().System().BootTime().State())
-	t.Logf("DUT boot time before reboot: %v", bootTimeBeforeReboot)
-	var currentTime string
-	currentTime = gnmi.Get(t, dut, gnmi.OC().System().CurrentDatetime().State())
-	t.Logf("Time Before Reboot : %v", currentTime)
-	rebootResponse, err := gnoiClient.System().Reboot(context.Background(), rebootRequest)
-	t.Logf("Got Reboot response: %v, err: %v", rebootResponse, err)
-	if err != nil {
-		t.Fatalf("Failed to reboot chassis with unexpected err: %v", err)
-	}
-	for {
-		if errMsg := testt.CaptureFatal(t, func(t testing.TB) {
-			currentTime = gnmi.Get(t, dut, gnmi.OC().System().CurrentDatetime().State())
-		}); errMsg != nil {
-			t.Log("Reboot is started")
-			break
-		}
-		t.Log("Wait for reboot to be started")
-		time.Sleep(30 * time.Second)
-	}
-	startReboot := time.Now()
-	t.Logf("Wait for DUT to boot up by polling the telemetry output.")
-	for {
-		t.Logf("Time elapsed %.2f seconds since reboot started.", time.Since(startReboot).Seconds())
-		if errMsg := testt.CaptureFatal(t, func(t testing.TB) {
-			currentTime = gnmi.Get(t, dut, gnmi.OC().System().CurrentDatetime().State())
-		}); errMsg != nil {
-			t.Logf("Got testt.CaptureFatal errMsg: %s, keep polling ...", *errMsg)
-		} else {
-			t.Logf("Device rebooted successfully with received time: %v", currentTime)
-			break
-		}
-		if uint64(time.Since(startReboot).Seconds()) > maxRebootTime {
-			t.Fatalf("Check boot time: got %v, want < %v", time.Since(startReboot), maxRebootTime)
-		}
-	}
+	gnoihelper.RebootAndWait(t, dut, rebootRequest, maxRebootTime*time.Second)
 	// Verification Section
 	// Version and Created On Field Verification
 	t.Logf("Performing Authz.Get request on device %s", dut.Name())
@@ -0,0 +1,201 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mtls_enforcement_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/security/gnxi"
+	"github.com/openconfig/featureprofiles/internal/security/pki"
+	"github.com/openconfig/featureprofiles/internal/security/svid"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	acctzpb "github.com/openconfig/gnsi/acctz"
+)
+
+var (
+	caCertPem = flag.String("ca_cert_pem", "../../../authz/tests/authz/testdata/ca.cert.pem",
+		"a pem file for a ca cert trusted by the DUT for client certificates, used to issue the trusted client certificate")
+	caKeyPem = flag.String("ca_key_pem", "../../../authz/tests/authz/testdata/ca.key.pem",
+		"a pem file for the key of -ca_cert_pem")
+	spiffeID = flag.String("spiffe_id", "spiffe://test-abc.foo.bar/xyz/admin",
+		"SPIFFE ID of the client certificates, which must be authorized for the RPCs of every service")
+)
+
+const (
+	rpcTimeout = 30 * time.Second
+	// accountingTimeout is the time allowed for reject records to arrive.
+	accountingTimeout = time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// identity is a set of client credentials presented to the DUT.
+type identity struct {
+	desc    string
+	cert    *tls.Certificate
+	trusted bool
+}
+
+// service is a gRPC service of the DUT and a cheap RPC to exercise it.
+type service struct {
+	name string
+	rpc  *gnxi.RPC
+}
+
+var services = []service{
+	{"gNMI", gnxi.RPCs.GnmiCapabilities},
+	{"gNOI", gnxi.RPCs.GnoiSystemTime},
+	{"gRIBI", gnxi.RPCs.GribiGet},
+	{"P4RT", gnxi.RPCs.P4P4runtimeCapabilities},
+}
+
+// identities returns the client credentials of the matrix: none, a
+// certificate of an untrusted CA, and a certificate of the trusted CA. Both
+// certificates carry the same SPIFFE ID, so only the issuer differs.
+func identities(t *testing.T) []identity {
+	t.Helper()
+	caKey, caCert, err := svid.LoadKeyPair(*caKeyPem, *caCertPem)
+	if err != nil {
+		t.Fatalf("Could not load ca key/cert: %v", err)
+	}
+	trusted, err := svid.GenSVID("trusted", *spiffeID, 1, caCert, caKey, x509.RSA)
+	if err != nil {
+		t.Fatalf("Could not generate trusted svid: %v", err)
+	}
+	untrusted := pki.NewCA(t, "untrusted", x509.RSA).Issue(t, pki.Spec{CommonName: "untrusted", SPIFFEID: *spiffeID})
+	return []identity{
+		{desc: "no client certificate"},
+		{desc: "untrusted client certificate", cert: untrusted},
+		{desc: "trusted client certificate", cert: trusted, trusted: true},
+	}
+}
+
+// dialOpts returns TLS dial options presenting the certificate of id, if
+// any. The server certificate is not verified as it is not under test.
+func (id identity) dialOpts() []grpc.DialOption {
+	tlsConf := &tls.Config{InsecureSkipVerify: true}
+	if id.cert != nil {
+		tlsConf.Certificates = []tls.Certificate{*id.cert}
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConf))}
+}
+
+// connectionCounters returns the sum of the connection accepts and rejects
+// of all gRPC servers of the DUT.
+func connectionCounters(t *testing.T, dut *ondatra.DUTDevice) (accepts, rejects uint64) {
+	t.Helper()
+	counters := gnmi.OC().System().GrpcServerAny().Counters()
+	for _, v := range gnmi.GetAll(t, dut, counters.ConnectionAccepts().State()) {
+		accepts += v
+	}
+	for _, v := range gnmi.GetAll(t, dut, counters.ConnectionRejects().State()) {
+		rejects += v
+	}
+	return accepts, rejects
+}
+
+// tlsRejectRecords returns the number of accounting records since start of
+// failed TLS certificate authentications.
+func tlsRejectRecords(t *testing.T, dut *ondatra.DUTDevice, start time.Time, want int) int {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), accountingTimeout)
+	defer cancel()
+	stream, err := dut.RawAPIs().GNSI(t).Acctz().RecordSubscribe(ctx)
+	if err != nil {
+		t.Fatalf("Acctz.RecordSubscribe: %v", err)
+	}
+	if err := stream.Send(&acctzpb.RecordRequest{Timestamp: timestamppb.New(start)}); err != nil {
+		t.Fatalf("Acctz.RecordSubscribe send: %v", err)
+	}
+	got := 0
+	for got < want {
+		r, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		authn := r.GetSessionInfo().GetAuthn()
+		if authn.GetType() != acctzpb.AuthnDetail_AUTHN_TYPE_TLSCERT {
+			continue
+		}
+		switch authn.GetStatus() {
+		case acctzpb.AuthnDetail_AUTHN_STATUS_FAIL, acctzpb.AuthnDetail_AUTHN_STATUS_ERROR:
+			got++
+		}
+	}
+	return got
+}
+
+func TestMTLSEnforcement(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ids := identities(t)
+	start := time.Now().Add(-time.Second)
+	acceptsBefore, rejectsBefore := connectionCounters(t, dut)
+
+	var wantAccepts, wantRejects, wantRejectRecords uint64
+	for _, s := range services {
+		for _, id := range ids {
+			t.Run(s.name+" with "+id.desc, func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+				defer cancel()
+				err := s.rpc.Exec(ctx, dut, id.dialOpts())
+				switch {
+				case id.trusted && err != nil:
+					t.Errorf("%s %s: got error %v, want success", s.name, s.rpc.Path, err)
+				case !id.trusted && err == nil:
+					t.Errorf("%s %s: got success, want rejected", s.name, s.rpc.Path)
+				case err != nil:
+					t.Logf("%s %s rejected as expected: %v", s.name, s.rpc.Path, err)
+				}
+			})
+			if id.trusted {
+				wantAccepts++
+				continue
+			}
+			wantRejects++
+			if id.cert != nil {
+				wantRejectRecords++
+			}
+		}
+	}
+
+	t.Run("Connection counters", func(t *testing.T) {
+		acceptsAfter, rejectsAfter := connectionCounters(t, dut)
+		if got := acceptsAfter - acceptsBefore; got < wantAccepts {
+			t.Errorf("connection-accepts increment: got %d, want >= %d", got, wantAccepts)
+		}
+		if got := rejectsAfter - rejectsBefore; got < wantRejects {
+			t.Errorf("connection-rejects increment: got %d, want >= %d", got, wantRejects)
+		}
+	})
+
+	t.Run("Accounting", func(t *testing.T) {
+		if got := tlsRejectRecords(t, dut, start, int(wantRejectRecords)); uint64(got) < wantRejectRecords {
+			t.Errorf("Accounting records of failed TLSCERT authentication: got %d, want >= %d", got, wantRejectRecords)
+		}
+	})
+}
@@ -0,0 +1,457 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server_certificate_rotation_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/security/pki"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/binding/introspect"
+	"github.com/openconfig/ondatra/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	certzpb "github.com/openconfig/gnsi/certz"
+)
+
+var (
+	clientCABundle = flag.String("client_ca_bundle", "",
+		"optional PEM file of CAs appended to every uploaded trust bundle, so that the credentials of the testbed binding stay trusted")
+	sslProfiles = flag.String("ssl_profile_ids", "",
+		"comma separated SSL profile ids to rotate; if empty all profiles used by /system/grpc-servers are rotated")
+	// The private key of the server certificate cannot be read from the DUT,
+	// so it must be provided for the test to put the profiles back.
+	originalCert = flag.String("original_cert", "",
+		"PEM file of the server certificate of the rotated SSL profiles, which is restored when the test completes; the test is skipped unless -original_cert, -original_key and -original_trust_bundle are set")
+	originalKey         = flag.String("original_key", "", "PEM file of the private key of -original_cert")
+	originalTrustBundle = flag.String("original_trust_bundle", "", "PEM file of the CAs of the trust bundle of the rotated SSL profiles")
+)
+
+const (
+	rpcTimeout = time.Minute
+	// rollbackTimeout is the time allowed for the DUT to restore the previous
+	// certificate once a Rotate stream is closed without finalize.
+	rollbackTimeout = 2 * time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// chainEntity returns the Certz entity installing cert as server certificate.
+func chainEntity(t *testing.T, cert *tls.Certificate) *certzpb.Entity {
+	t.Helper()
+	return &certzpb.Entity{
+		Version:   cert.Leaf.Subject.CommonName,
+		CreatedOn: uint64(time.Now().Unix()),
+		Entity: &certzpb.Entity_CertificateChain{CertificateChain: &certzpb.CertificateChain{
+			Certificate: &certzpb.Certificate{
+				Type:        certzpb.CertificateType_CERTIFICATE_TYPE_X509,
+				Encoding:    certzpb.CertificateEncoding_CERTIFICATE_ENCODING_PEM,
+				Certificate: pki.CertPEM(cert.Leaf),
+				PrivateKey:  pki.KeyPEM(t, cert.PrivateKey),
+			},
+		}},
+	}
+}
+
+// readCerts returns the PEM certificates of file.
+func readCerts(file string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate in %q: %w", file, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificate in %q", file)
+	}
+	return certs, nil
+}
+
+// bundleEntity returns the Certz entity installing the given CAs, and those
+// of -client_ca_bundle, as trust bundle.
+func bundleEntity(t *testing.T, cas ...*pki.CA) *certzpb.Entity {
+	t.Helper()
+	var certs []*x509.Certificate
+	for _, c := range cas {
+		certs = append(certs, c.Cert)
+	}
+	if *clientCABundle != "" {
+		clientCAs, err := readCerts(*clientCABundle)
+		if err != nil {
+			t.Fatalf("Could not read -client_ca_bundle: %v", err)
+		}
+		certs = append(certs, clientCAs...)
+	}
+	return trustBundleEntity(certs)
+}
+
+// trustBundleEntity returns the Certz entity installing certs as trust bundle.
+func trustBundleEntity(certs []*x509.Certificate) *certzpb.Entity {
+	var chain *certzpb.CertificateChain
+	for i := len(certs) - 1; i >= 0; i-- {
+		chain = &certzpb.CertificateChain{
+			Certificate: &certzpb.Certificate{
+				Type:        certzpb.CertificateType_CERTIFICATE_TYPE_X509,
+				Encoding:    certzpb.CertificateEncoding_CERTIFICATE_ENCODING_PEM,
+				Certificate: pki.CertPEM(certs[i]),
+			},
+			Parent: chain,
+		}
+	}
+	return &certzpb.Entity{
+		Version:   fmt.Sprintf("bundle-%d", time.Now().UnixNano()),
+		CreatedOn: uint64(time.Now().Unix()),
+		Entity:    &certzpb.Entity_TrustBundle{TrustBundle: chain},
+	}
+}
+
+// originalEntities returns the Certz entities restoring the server
+// certificate of -original_cert and the trust bundle of
+// -original_trust_bundle.
+func originalEntities(t *testing.T) ([]*certzpb.Entity, error) {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(*originalCert, *originalKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key pair %q and %q: %w", *originalCert, *originalKey, err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, fmt.Errorf("invalid certificate %q: %w", *originalCert, err)
+	}
+	cas, err := readCerts(*originalTrustBundle)
+	if err != nil {
+		return nil, err
+	}
+	return []*certzpb.Entity{chainEntity(t, &cert), trustBundleEntity(cas)}, nil
+}
+
+// dialOpts returns dial options presenting client and verifying that the
+// server certificate is issued by root, without checking its name. The served
+// certificate is stored in served.
+func dialOpts(client *tls.Certificate, root *pki.CA, served **x509.Certificate) []grpc.DialOption {
+	roots := root.Pool()
+	tlsConf := &tls.Config{
+		Certificates:       []tls.Certificate{*client},
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			if len(raw) == 0 {
+				return errors.New("no server certificate")
+			}
+			leaf, err := x509.ParseCertificate(raw[0])
+			if err != nil {
+				return err
+			}
+			*served = leaf
+			_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+			return err
+		},
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConf)), grpc.WithBlock()}
+}
+
+// dial opens a gNMI connection to the DUT presenting client and trusting root.
+// The served certificate is stored in served.
+func dial(ctx context.Context, t *testing.T, dut *ondatra.DUTDevice, client *tls.Certificate, root *pki.CA, served **x509.Certificate) (*grpc.ClientConn, error) {
+	t.Helper()
+	return introspect.DUTDialer(t, dut, introspect.GNMI).Dial(ctx, dialOpts(client, root, served)...)
+}
+
+// probe opens a new gNMI connection presenting client and trusting root, and
+// returns the certificate served by the DUT.
+func probe(ctx context.Context, t *testing.T, dut *ondatra.DUTDevice, client *tls.Certificate, root *pki.CA) (*x509.Certificate, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	var served *x509.Certificate
+	conn, err := dial(ctx, t, dut, client, root, &served)
+	if err != nil {
+		return served, err
+	}
+	defer conn.Close()
+	_, err = gpb.NewGNMIClient(conn).Capabilities(ctx, &gpb.CapabilityRequest{})
+	return served, err
+}
+
+// verifyServed checks that a new connection succeeds and is served want.
+func verifyServed(t *testing.T, dut *ondatra.DUTDevice, client *tls.Certificate, root *pki.CA, want *tls.Certificate) {
+	t.Helper()
+	got, err := probe(context.Background(), t, dut, client, root)
+	if err != nil {
+		t.Fatalf("New gNMI connection trusting %q failed: %v", root.Cert.Subject.CommonName, err)
+	}
+	if got.SerialNumber.Cmp(want.Leaf.SerialNumber) != 0 {
+		t.Errorf("Served certificate: got %q (serial %v), want %q (serial %v)", got.Subject.CommonName, got.SerialNumber, want.Leaf.Subject.CommonName, want.Leaf.SerialNumber)
+	}
+}
+
+// awaitServed waits for new connections to be served want, as the DUT may
+// take some time to restore a certificate after an abandoned rotation.
+func awaitServed(t *testing.T, dut *ondatra.DUTDevice, client *tls.Certificate, root *pki.CA, want *tls.Certificate) {
+	t.Helper()
+	deadline := time.Now().Add(rollbackTimeout)
+	for {
+		got, err := probe(context.Background(), t, dut, client, root)
+		if err == nil && got.SerialNumber.Cmp(want.Leaf.SerialNumber) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Served certificate after %v: got %v (err %v), want %q", rollbackTimeout, got, err, want.Leaf.Subject.CommonName)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// rotation is an in-progress Certz.Rotate stream.
+type rotation struct {
+	stream certzpb.Certz_RotateClient
+	cancel context.CancelFunc
+}
+
+// startRotation uploads entities to profile and returns the open stream, or
+// the error returned by the DUT for the upload.
+func startRotation(t *testing.T, dut *ondatra.DUTDevice, profile string, entities ...*certzpb.Entity) (*rotation, error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := dut.RawAPIs().GNSI(t).Certz().Rotate(ctx)
+	if err != nil {
+		cancel()
+		t.Fatalf("Certz.Rotate: %v", err)
+	}
+	r := &rotation{stream: stream, cancel: cancel}
+	if err := r.upload(profile, entities...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// upload uploads entities to profile, and aborts the rotation if the DUT
+// rejects them.
+func (r *rotation) upload(profile string, entities ...*certzpb.Entity) error {
+	if err := r.stream.Send(&certzpb.RotateCertificateRequest{
+		ForceOverwrite: true,
+		SslProfileId:   profile,
+		RotateRequest:  &certzpb.RotateCertificateRequest_Certificates{Certificates: &certzpb.UploadRequest{Entities: entities}},
+	}); err != nil {
+		r.abort()
+		return err
+	}
+	if _, err := r.stream.Recv(); err != nil {
+		r.abort()
+		return err
+	}
+	return nil
+}
+
+// finalize accepts the uploaded entities.
+func (r *rotation) finalize(t *testing.T) {
+	t.Helper()
+	if err := r.commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commit accepts the uploaded entities and closes the stream.
+func (r *rotation) commit() error {
+	defer r.cancel()
+	if err := r.stream.Send(&certzpb.RotateCertificateRequest{
+		RotateRequest: &certzpb.RotateCertificateRequest_FinalizeRotation{FinalizeRotation: &certzpb.FinalizeRequest{}},
+	}); err != nil {
+		return fmt.Errorf("Certz.Rotate finalize: %w", err)
+	}
+	if err := r.stream.CloseSend(); err != nil {
+		return fmt.Errorf("Certz.Rotate CloseSend: %w", err)
+	}
+	if _, err := r.stream.Recv(); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("Certz.Rotate finalize: %w", err)
+	}
+	return nil
+}
+
+// abort closes the stream without finalize, which rolls the rotation back.
+func (r *rotation) abort() {
+	r.cancel()
+}
+
+// rotate uploads entities to profile and finalizes the rotation.
+func rotate(t *testing.T, dut *ondatra.DUTDevice, profile string, entities ...*certzpb.Entity) {
+	t.Helper()
+	r, err := startRotation(t, dut, profile, entities...)
+	if err != nil {
+		t.Fatalf("Certz.Rotate upload to profile %q: %v", profile, err)
+	}
+	r.finalize(t)
+}
+
+// restoreProfile uploads entities to profile with c and finalizes the
+// rotation.
+func restoreProfile(c certzpb.CertzClient, profile string, entities ...*certzpb.Entity) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := c.Rotate(ctx)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("Certz.Rotate: %w", err)
+	}
+	r := &rotation{stream: stream, cancel: cancel}
+	if err := r.upload(profile, entities...); err != nil {
+		return fmt.Errorf("Certz.Rotate upload: %w", err)
+	}
+	return r.commit()
+}
+
+// verifyBindingConnection checks that a new gNMI connection dialed with the
+// options of the binding succeeds.
+func verifyBindingConnection(t *testing.T, dut *ondatra.DUTDevice) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	c, err := dut.RawAPIs().BindingDUT().DialGNMI(ctx)
+	if err != nil {
+		return fmt.Errorf("could not dial gNMI with the binding: %w", err)
+	}
+	if _, err := c.Capabilities(ctx, &gpb.CapabilityRequest{}); err != nil {
+		return fmt.Errorf("gNMI Capabilities with the binding failed: %w", err)
+	}
+	return nil
+}
+
+// profileIDs returns the SSL profiles used by the gRPC servers of the DUT.
+func profileIDs(t *testing.T, dut *ondatra.DUTDevice) []string {
+	t.Helper()
+	if *sslProfiles != "" {
+		return strings.Split(*sslProfiles, ",")
+	}
+	ids := map[string]bool{}
+	for _, s := range gnmi.GetAll(t, dut, gnmi.OC().System().GrpcServerAny().State()) {
+		if id := s.GetSslProfileId(); id != "" {
+			ids[id] = true
+		}
+	}
+	if len(ids) == 0 {
+		t.Fatal("No gRPC server reports an ssl-profile-id, set -ssl_profile_ids")
+	}
+	var sorted []string
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// TestServerCertificateRotation implements Certz-3.1 and Certz-3.2 for every
+// SSL profile of the DUT and both RSA and ECDSA keys. The certificate and
+// trust bundle of -original_cert and -original_trust_bundle are rotated back
+// into every profile at the end.
+func TestServerCertificateRotation(t *testing.T) {
+	if *originalCert == "" || *originalKey == "" || *originalTrustBundle == "" {
+		t.Skip("Rotating the SSL profiles requires -original_cert, -original_key and -original_trust_bundle to restore them")
+	}
+	original, err := originalEntities(t)
+	if err != nil {
+		t.Fatalf("Could not load the original SSL profile: %v", err)
+	}
+	dut := ondatra.DUT(t, "dut")
+	c := dut.RawAPIs().GNSI(t).Certz()
+	for _, profile := range profileIDs(t, dut) {
+		profile := profile
+		t.Cleanup(func() {
+			if err := restoreProfile(c, profile, original...); err != nil {
+				t.Errorf("Could not restore SSL profile %q: %v", profile, err)
+				return
+			}
+			if err := verifyBindingConnection(t, dut); err != nil {
+				t.Errorf("After restoring SSL profile %q: %v", profile, err)
+			}
+		})
+		for _, algo := range []x509.PublicKeyAlgorithm{x509.RSA, x509.ECDSA} {
+			t.Run(fmt.Sprintf("%s/%v", profile, algo), func(t *testing.T) {
+				ca1 := pki.NewCA(t, "ca-01", algo)
+				ca2 := pki.NewCA(t, "ca-02", algo)
+				client := ca1.Issue(t, pki.Spec{CommonName: "client"})
+				serverA := ca1.Issue(t, pki.Spec{CommonName: "server-a"})
+				serverB := ca1.Issue(t, pki.Spec{CommonName: "server-b"})
+				serverC := ca1.Issue(t, pki.Spec{CommonName: "server-c"})
+				untrusted := ca2.Issue(t, pki.Spec{CommonName: "server-untrusted"})
+
+				rotate(t, dut, profile, chainEntity(t, serverA), bundleEntity(t, ca1))
+				verifyServed(t, dut, client, ca1, serverA)
+
+				t.Run("Certz-3.1", func(t *testing.T) {
+					var served *x509.Certificate
+					ctx := context.Background()
+					conn, err := dial(ctx, t, dut, client, ca1, &served)
+					if err != nil {
+						t.Fatalf("Could not open gNMI connection before rotation: %v", err)
+					}
+					defer conn.Close()
+					inflight := gpb.NewGNMIClient(conn)
+					r, err := startRotation(t, dut, profile, chainEntity(t, serverB))
+					if err != nil {
+						t.Fatalf("Certz.Rotate upload of %q: %v", serverB.Leaf.Subject.CommonName, err)
+					}
+					verifyServed(t, dut, client, ca1, serverB)
+					if _, err := inflight.Capabilities(ctx, &gpb.CapabilityRequest{}); err != nil {
+						t.Errorf("gNMI connection opened before rotation failed before finalize: %v", err)
+					}
+					r.finalize(t)
+					verifyServed(t, dut, client, ca1, serverB)
+					if _, err := inflight.Capabilities(ctx, &gpb.CapabilityRequest{}); err != nil {
+						t.Errorf("gNMI connection opened before rotation failed after finalize: %v", err)
+					}
+				})
+
+				t.Run("Certz-3.2", func(t *testing.T) {
+					r, err := startRotation(t, dut, profile, chainEntity(t, untrusted))
+					if err == nil {
+						r.abort()
+						t.Errorf("Certz.Rotate upload of certificate signed by untrusted %q: got success, want error", ca2.Cert.Subject.CommonName)
+					}
+					awaitServed(t, dut, client, ca1, serverB)
+				})
+
+				t.Run("Rollback", func(t *testing.T) {
+					r, err := startRotation(t, dut, profile, chainEntity(t, serverC))
+					if err != nil {
+						t.Fatalf("Certz.Rotate upload of %q: %v", serverC.Leaf.Subject.CommonName, err)
+					}
+					verifyServed(t, dut, client, ca1, serverC)
+					r.abort()
+					awaitServed(t, dut, client, ca1, serverB)
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust_bundle_rotation_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/security/pki"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	certzpb "github.com/openconfig/gnsi/certz"
+)
+
+var (
+	clientCABundle = flag.String("client_ca_bundle", "",
+		"optional PEM file of CAs appended to every uploaded trust bundle, so that the credentials of the testbed binding stay trusted")
+	sslProfiles = flag.String("ssl_profile_ids", "",
+		"comma separated SSL profile ids to rotate; if empty all profiles used by /system/grpc-servers are rotated")
+)
+
+const (
+	rpcTimeout = time.Minute
+	// rollbackTimeout is the time allowed for the DUT to restore the previous
+	// trust bundle once a Rotate stream is closed without finalize.
+	rollbackTimeout = 2 * time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// chainEntity returns the Certz entity installing cert as server certificate.
+func chainEntity(t *testing.T, cert *tls.Certificate) *certzpb.Entity {
+	t.Helper()
+	return &certzpb.Entity{
+		Version:   cert.Leaf.Subject.CommonName,
+		CreatedOn: uint64(time.Now().Unix()),
+		Entity: &certzpb.Entity_CertificateChain{CertificateChain: &certzpb.CertificateChain{
+			Certificate: &certzpb.Certificate{
+				Type:        certzpb.CertificateType_CERTIFICATE_TYPE_X509,
+				Encoding:    certzpb.CertificateEncoding_CERTIFICATE_ENCODING_PEM,
+				Certificate: pki.CertPEM(cert.Leaf),
+				PrivateKey:  pki.KeyPEM(t, cert.PrivateKey),
+			},
+		}},
+	}
+}
+
+// bundleEntity returns the Certz entity installing the given CAs, and those
+// of -client_ca_bundle, as trust bundle.
+func bundleEntity(t *testing.T, cas ...*pki.CA) *certzpb.Entity {
+	t.Helper()
+	var certs []*x509.Certificate
+	for _, c := range cas {
+		certs = append(certs, c.Cert)
+	}
+	if *clientCABundle != "" {
+		b, err := os.ReadFile(*clientCABundle)
+		if err != nil {
+			t.Fatalf("Could not read -client_ca_bundle: %v", err)
+		}
+		for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatalf("Could not parse -client_ca_bundle: %v", err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	var chain *certzpb.CertificateChain
+	for i := len(certs) - 1; i >= 0; i-- {
+		chain = &certzpb.CertificateChain{
+			Certificate: &certzpb.Certificate{
+				Type:        certzpb.CertificateType_CERTIFICATE_TYPE_X509,
+				Encoding:    certzpb.CertificateEncoding_CERTIFICATE_ENCODING_PEM,
+				Certificate: pki.CertPEM(certs[i]),
+			},
+			Parent: chain,
+		}
+	}
+	return &certzpb.Entity{
+		Version:   fmt.Sprintf("bundle-%d", time.Now().UnixNano()),
+		CreatedOn: uint64(time.Now().Unix()),
+		Entity:    &certzpb.Entity_TrustBundle{TrustBundle: chain},
+	}
+}
+
+// dialOpts returns dial options presenting client and verifying that the
+// server certificate is issued by root, without checking its name. The served
+// certificate is stored in served.
+func dialOpts(client *tls.Certificate, root *pki.CA, served **x509.Certificate) []grpc.DialOption {
+	roots := root.Pool()
+	tlsConf := &tls.Config{
+		Certificates:       []tls.Certificate{*client},
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			if len(raw) == 0 {
+				return errors.New("no server certificate")
+			}
+			leaf, err := x509.ParseCertificate(raw[0])
+			if err != nil {
+				return err
+			}
+			*served = leaf
+			_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+			return err
+		},
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConf)), grpc.WithBlock()}
+}
+
+// probe opens a new gNMI connection presenting client and trusting root, and
+// returns the certificate served by the DUT.
+func probe(ctx context.Context, dut *ondatra.DUTDevice, client *tls.Certificate, root *pki.CA) (*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	var served *x509.Certificate
+	c, err := dut.RawAPIs().BindingDUT().DialGNMI(ctx, dialOpts(client, root, &served)...)
+	if err != nil {
+		return served, err
+	}
+	_, err = c.Capabilities(ctx, &gpb.CapabilityRequest{})
+	return served, err
+}
+
+// verifyServed checks that a new connection succeeds and is served want.
+func verifyServed(t *testing.T, dut *ondatra.DUTDevice, client *tls.Certificate, root *pki.CA, want *tls.Certificate) {
+	t.Helper()
+	got, err := probe(context.Background(), dut, client, root)
+	if err != nil {
+		t.Fatalf("New gNMI connection trusting %q failed: %v", root.Cert.Subject.CommonName, err)
+	}
+	if got.SerialNumber.Cmp(want.Leaf.SerialNumber) != 0 {
+		t.Errorf("Served certificate: got %q (serial %v), want %q (serial %v)", got.Subject.CommonName, got.SerialNumber, want.Leaf.Subject.CommonName, want.Leaf.SerialNumber)
+	}
+}
+
+// awaitRejected waits for new connections presenting client to be rejected,
+// as the DUT may take some time to restore a trust bundle after an abandoned
+// rotation.
+func awaitRejected(t *testing.T, dut *ondatra.DUTDevice, client *tls.Certificate, root *pki.CA) {
+	t.Helper()
+	deadline := time.Now().Add(rollbackTimeout)
+	for {
+		if _, err := probe(context.Background(), dut, client, root); err != nil {
+			t.Logf("New gNMI connection presenting %q rejected: %v", client.Leaf.Subject.CommonName, err)
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("New gNMI connection presenting %q: got success after %v, want rejected", client.Leaf.Subject.CommonName, rollbackTimeout)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// rotation is an in-progress Certz.Rotate stream.
+type rotation struct {
+	stream certzpb.Certz_RotateClient
+	cancel context.CancelFunc
+}
+
+// startRotation uploads entities to profile and returns the open stream, or
+// the error returned by the DUT for the upload.
+func startRotation(t *testing.T, dut *ondatra.DUTDevice, profile string, entities ...*certzpb.Entity) (*rotation, error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := dut.RawAPIs().GNSI(t).Certz().Rotate(ctx)
+	if err != nil {
+		cancel()
+		t.Fatalf("Certz.Rotate: %v", err)
+	}
+	r := &rotation{stream: stream, cancel: cancel}
+	if err := stream.Send(&certzpb.RotateCertificateRequest{
+		ForceOverwrite: true,
+		SslProfileId:   profile,
+		RotateRequest:  &certzpb.RotateCertificateRequest_Certificates{Certificates: &certzpb.UploadRequest{Entities: entities}},
+	}); err != nil {
+		r.abort()
+		return nil, err
+	}
+	if _, err := stream.Recv(); err != nil {
+		r.abort()
+		return nil, err
+	}
+	return r, nil
+}
+
+// finalize accepts the uploaded entities.
+func (r *rotation) finalize(t *testing.T) {
+	t.Helper()
+	defer r.cancel()
+	if err := r.stream.Send(&certzpb.RotateCertificateRequest{
+		RotateRequest: &certzpb.RotateCertificateRequest_FinalizeRotation{FinalizeRotation: &certzpb.FinalizeRequest{}},
+	}); err != nil {
+		t.Fatalf("Certz.Rotate finalize: %v", err)
+	}
+	if err := r.stream.CloseSend(); err != nil {
+		t.Fatalf("Certz.Rotate CloseSend: %v", err)
+	}
+	if _, err := r.stream.Recv(); err != nil && !errors.Is(err, io.EOF) {
+		t.Fatalf("Certz.Rotate finalize: %v", err)
+	}
+}
+
+// abort closes the stream without finalize, which rolls the rotation back.
+func (r *rotation) abort() {
+	r.cancel()
+}
+
+// rotate uploads entities to profile and finalizes the rotation.
+func rotate(t *testing.T, dut *ondatra.DUTDevice, profile string, entities ...*certzpb.Entity) {
+	t.Helper()
+	r, err := startRotation(t, dut, profile, entities...)
+	if err != nil {
+		t.Fatalf("Certz.Rotate upload to profile %q: %v", profile, err)
+	}
+	r.finalize(t)
+}
+
+// profileIDs returns the SSL profiles used by the gRPC servers of the DUT.
+func profileIDs(t *testing.T, dut *ondatra.DUTDevice) []string {
+	t.Helper()
+	if *sslProfiles != "" {
+		return strings.Split(*sslProfiles, ",")
+	}
+	ids := map[string]bool{}
+	for _, s := range gnmi.GetAll(t, dut, gnmi.OC().System().GrpcServerAny().State()) {
+		if id := s.GetSslProfileId(); id != "" {
+			ids[id] = true
+		}
+	}
+	if len(ids) == 0 {
+		t.Fatal("No gRPC server reports an ssl-profile-id, set -ssl_profile_ids")
+	}
+	var sorted []string
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// TestTrustBundleRotation implements Certz-5.1 and Certz-5.2 for every SSL
+// profile of the DUT and both RSA and ECDSA keys.
+func TestTrustBundleRotation(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	for _, profile := range profileIDs(t, dut) {
+		for _, algo := range []x509.PublicKeyAlgorithm{x509.RSA, x509.ECDSA} {
+			t.Run(fmt.Sprintf("%s/%v", profile, algo), func(t *testing.T) {
+				ca1 := pki.NewCA(t, "ca-01", algo)
+				ca2 := pki.NewCA(t, "ca-02", algo)
+				ca3 := pki.NewCA(t, "ca-03", algo)
+				client1 := ca1.Issue(t, pki.Spec{CommonName: "client-ca-01"})
+				client2 := ca2.Issue(t, pki.Spec{CommonName: "client-ca-02"})
+				client3 := ca3.Issue(t, pki.Spec{CommonName: "client-ca-03"})
+				server := ca1.Issue(t, pki.Spec{CommonName: "server-a"})
+
+				rotate(t, dut, profile, chainEntity(t, server), bundleEntity(t, ca1))
+				verifyServed(t, dut, client1, ca1, server)
+
+				t.Run("Certz-5.1", func(t *testing.T) {
+					var served *x509.Certificate
+					ctx := context.Background()
+					inflight, err := dut.RawAPIs().BindingDUT().DialGNMI(ctx, dialOpts(client1, ca1, &served)...)
+					if err != nil {
+						t.Fatalf("Could not open gNMI connection before rotation: %v", err)
+					}
+					r, err := startRotation(t, dut, profile, bundleEntity(t, ca1, ca2))
+					if err != nil {
+						t.Fatalf("Certz.Rotate upload of trust bundle [ca-01 ca-02]: %v", err)
+					}
+					verifyServed(t, dut, client2, ca1, server)
+					if _, err := inflight.Capabilities(ctx, &gpb.CapabilityRequest{}); err != nil {
+						t.Errorf("gNMI connection opened before rotation failed before finalize: %v", err)
+					}
+					r.finalize(t)
+					verifyServed(t, dut, client1, ca1, server)
+					verifyServed(t, dut, client2, ca1, server)
+					if _, err := inflight.Capabilities(ctx, &gpb.CapabilityRequest{}); err != nil {
+						t.Errorf("gNMI connection opened before rotation failed after finalize: %v", err)
+					}
+				})
+
+				t.Run("Certz-5.2", func(t *testing.T) {
+					r, err := startRotation(t, dut, profile, bundleEntity(t, ca2))
+					if err == nil {
+						r.abort()
+						t.Errorf("Certz.Rotate upload of trust bundle [ca-02] not trusting the server certificate: got success, want error")
+					}
+					verifyServed(t, dut, client1, ca1, server)
+				})
+
+				t.Run("Rollback", func(t *testing.T) {
+					r, err := startRotation(t, dut, profile, bundleEntity(t, ca1, ca2, ca3))
+					if err != nil {
+						t.Fatalf("Certz.Rotate upload of trust bundle [ca-01 ca-02 ca-03]: %v", err)
+					}
+					verifyServed(t, dut, client3, ca1, server)
+					r.abort()
+					awaitRejected(t, dut, client3, ca1)
+					verifyServed(t, dut, client1, ca1, server)
+				})
+			})
+		}
+	}
+}
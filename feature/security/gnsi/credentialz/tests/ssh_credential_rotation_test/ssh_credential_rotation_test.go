@@ -0,0 +1,498 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh_credential_rotation_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"golang.org/x/crypto/ssh"
+
+	cpb "github.com/openconfig/gnsi/credentialz"
+)
+
+var (
+	sshAddr = flag.String("ssh_addr", "",
+		"host:port of the SSH server of the DUT; if empty the DUT name and port 22 are used")
+	account = flag.String("account", "credz-rotation",
+		"the local account which is created for the test and whose credentials are rotated")
+)
+
+const (
+	rpcTimeout     = time.Minute
+	sshTimeout     = 30 * time.Second
+	consoleTimeout = 2 * time.Minute
+)
+
+var (
+	// loginPrompt, passwordPrompt and shellPrompt match the console output
+	// after an empty line, a user name and a password are sent respectively.
+	loginPrompt    = regexp.MustCompile(`(?i)(login|username):\s*$`)
+	passwordPrompt = regexp.MustCompile(`(?i)password:\s*$`)
+	shellPrompt    = regexp.MustCompile(`[>#$]\s*$`)
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// version returns a unique version string for a credential rotation.
+func version(kind string) (string, uint64) {
+	now := time.Now()
+	return fmt.Sprintf("%s-%d", kind, now.UnixNano()), uint64(now.UnixNano())
+}
+
+// rotateHost sends req on a RotateHostParameters stream and finalizes it.
+func rotateHost(t *testing.T, dut *ondatra.DUTDevice, req *cpb.RotateHostParametersRequest) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	stream, err := dut.RawAPIs().GNSI(t).Credentialz().RotateHostParameters(ctx)
+	if err != nil {
+		t.Fatalf("Credentialz.RotateHostParameters: %v", err)
+	}
+	if err := stream.Send(req); err != nil {
+		t.Fatalf("Credentialz.RotateHostParameters send: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Credentialz.RotateHostParameters: %v", err)
+	}
+	if err := stream.Send(&cpb.RotateHostParametersRequest{
+		Request: &cpb.RotateHostParametersRequest_Finalize{Finalize: &cpb.FinalizeRequest{}},
+	}); err != nil {
+		t.Fatalf("Credentialz.RotateHostParameters finalize: %v", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("Credentialz.RotateHostParameters CloseSend: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil && !errors.Is(err, io.EOF) {
+		t.Fatalf("Credentialz.RotateHostParameters finalize: %v", err)
+	}
+}
+
+// rotateAccount sends req on a RotateAccountCredentials stream and finalizes
+// it.
+func rotateAccount(t *testing.T, dut *ondatra.DUTDevice, req *cpb.RotateAccountCredentialsRequest) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	stream, err := dut.RawAPIs().GNSI(t).Credentialz().RotateAccountCredentials(ctx)
+	if err != nil {
+		t.Fatalf("Credentialz.RotateAccountCredentials: %v", err)
+	}
+	if err := stream.Send(req); err != nil {
+		t.Fatalf("Credentialz.RotateAccountCredentials send: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Credentialz.RotateAccountCredentials: %v", err)
+	}
+	if err := stream.Send(&cpb.RotateAccountCredentialsRequest{
+		Request: &cpb.RotateAccountCredentialsRequest_Finalize{Finalize: &cpb.FinalizeRequest{}},
+	}); err != nil {
+		t.Fatalf("Credentialz.RotateAccountCredentials finalize: %v", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("Credentialz.RotateAccountCredentials CloseSend: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil && !errors.Is(err, io.EOF) {
+		t.Fatalf("Credentialz.RotateAccountCredentials finalize: %v", err)
+	}
+}
+
+// allowAuthentication sets the SSH authentication types allowed by the DUT.
+func allowAuthentication(t *testing.T, dut *ondatra.DUTDevice, types ...cpb.AuthenticationType) {
+	t.Helper()
+	rotateHost(t, dut, &cpb.RotateHostParametersRequest{
+		Request: &cpb.RotateHostParametersRequest_AuthenticationAllowed{AuthenticationAllowed: &cpb.AllowedAuthenticationRequest{
+			AuthenticationTypes: types,
+		}},
+	})
+}
+
+// rotatePassword sets the password of the test account.
+func rotatePassword(t *testing.T, dut *ondatra.DUTDevice, password string) {
+	t.Helper()
+	v, createdOn := version("password")
+	rotateAccount(t, dut, &cpb.RotateAccountCredentialsRequest{
+		Request: &cpb.RotateAccountCredentialsRequest_Password{Password: &cpb.PasswordRequest{
+			Accounts: []*cpb.PasswordRequest_Account{{
+				Account:   *account,
+				Password:  &cpb.PasswordRequest_Password{Value: &cpb.PasswordRequest_Password_Plaintext{Plaintext: password}},
+				Version:   v,
+				CreatedOn: createdOn,
+			}},
+		}},
+	})
+	user := gnmi.OC().System().Aaa().Authentication().User(*account)
+	if got := gnmi.Get(t, dut, user.PasswordVersion().State()); got != v {
+		t.Errorf("password-version: got %q, want %q", got, v)
+	}
+	if got := gnmi.Get(t, dut, user.PasswordCreatedOn().State()); got != createdOn {
+		t.Errorf("password-created-on: got %d, want %d", got, createdOn)
+	}
+}
+
+// rotatePrincipals sets the authorized principals of the test account.
+func rotatePrincipals(t *testing.T, dut *ondatra.DUTDevice, principals ...string) {
+	t.Helper()
+	v, createdOn := version("principals")
+	var authorized []*cpb.UserPolicy_SshAuthorizedPrincipal
+	for _, p := range principals {
+		authorized = append(authorized, &cpb.UserPolicy_SshAuthorizedPrincipal{AuthorizedUser: p})
+	}
+	rotateAccount(t, dut, &cpb.RotateAccountCredentialsRequest{
+		Request: &cpb.RotateAccountCredentialsRequest_User{User: &cpb.AuthorizedUsersRequest{
+			Policies: []*cpb.UserPolicy{{
+				Account:              *account,
+				AuthorizedPrincipals: &cpb.UserPolicy_SshAuthorizedPrincipals{AuthorizedPrincipals: authorized},
+				Version:              v,
+				CreatedOn:            createdOn,
+			}},
+		}},
+	})
+	user := gnmi.OC().System().Aaa().Authentication().User(*account)
+	if got := gnmi.Get(t, dut, user.AuthorizedPrincipalsListVersion().State()); got != v {
+		t.Errorf("authorized-principals-list-version: got %q, want %q", got, v)
+	}
+}
+
+// rotateHostKey installs a new ED25519 host key on the DUT and returns its
+// public key.
+func rotateHostKey(t *testing.T, dut *ondatra.DUTDevice) ssh.PublicKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate host key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("Could not marshal host key: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Could not convert host key: %v", err)
+	}
+	v, createdOn := version("hostkey")
+	rotateHost(t, dut, &cpb.RotateHostParametersRequest{
+		Request: &cpb.RotateHostParametersRequest_ServerKeys{ServerKeys: &cpb.ServerKeysRequest{
+			AuthArtifacts: []*cpb.ServerKeysRequest_AuthenticationArtifacts{{PrivateKey: pem.EncodeToMemory(block)}},
+			Version:       v,
+			CreatedOn:     createdOn,
+		}},
+	})
+	if got := gnmi.Get(t, dut, gnmi.OC().System().SshServer().ActiveHostKeyVersion().State()); got != v {
+		t.Errorf("active-host-key-version: got %q, want %q", got, v)
+	}
+	if got := gnmi.Get(t, dut, gnmi.OC().System().SshServer().ActiveHostKeyCreatedOn().State()); got != createdOn {
+		t.Errorf("active-host-key-created-on: got %d, want %d", got, createdOn)
+	}
+	return sshPub
+}
+
+// userCA is an SSH certificate authority for user certificates.
+type userCA struct {
+	signer ssh.Signer
+}
+
+func newUserCA(t *testing.T) *userCA {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate CA key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Could not create CA signer: %v", err)
+	}
+	return &userCA{signer: signer}
+}
+
+// issue returns a signer presenting a fresh user key certified for principal.
+func (ca *userCA) issue(t *testing.T, principal string) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate user key: %v", err)
+	}
+	key, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Could not create user signer: %v", err)
+	}
+	cert := &ssh.Certificate{
+		Key:             key.PublicKey(),
+		CertType:        ssh.UserCert,
+		KeyId:           principal,
+		ValidPrincipals: []string{principal},
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(time.Now().Add(24 * time.Hour).Unix()),
+		Permissions:     ssh.Permissions{Extensions: map[string]string{"permit-pty": ""}},
+	}
+	if err := cert.SignCert(rand.Reader, ca.signer); err != nil {
+		t.Fatalf("Could not sign user certificate: %v", err)
+	}
+	certSigner, err := ssh.NewCertSigner(cert, key)
+	if err != nil {
+		t.Fatalf("Could not create certificate signer: %v", err)
+	}
+	return certSigner
+}
+
+// trust installs the CA as the only trusted user CA of the DUT.
+func (ca *userCA) trust(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	v, createdOn := version("userca")
+	rotateHost(t, dut, &cpb.RotateHostParametersRequest{
+		Request: &cpb.RotateHostParametersRequest_SshCaPublicKey{SshCaPublicKey: &cpb.CaPublicKeyRequest{
+			SshCaPublicKeys: []*cpb.PublicKey{{
+				PublicKey: ssh.MarshalAuthorizedKey(ca.signer.PublicKey()),
+				KeyType:   cpb.KeyType_KEY_TYPE_ED25519,
+			}},
+			Version:   v,
+			CreatedOn: createdOn,
+		}},
+	})
+	if got := gnmi.Get(t, dut, gnmi.OC().System().SshServer().ActiveTrustedUserCaKeysVersion().State()); got != v {
+		t.Errorf("active-trusted-user-ca-keys-version: got %q, want %q", got, v)
+	}
+}
+
+// sshDial connects to the DUT with auth and returns the host key presented
+// by the DUT.
+func sshDial(dut *ondatra.DUTDevice, auth ssh.AuthMethod) (ssh.PublicKey, error) {
+	addr := *sshAddr
+	if addr == "" {
+		addr = net.JoinHostPort(dut.Name(), "22")
+	}
+	var hostKey ssh.PublicKey
+	c, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User: *account,
+		Auth: []ssh.AuthMethod{auth},
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return nil
+		},
+		Timeout: sshTimeout,
+	})
+	if err != nil {
+		return hostKey, err
+	}
+	return hostKey, c.Close()
+}
+
+// passwordAuth returns an auth method answering both password and keyboard
+// interactive challenges with password.
+func passwordAuth(password string) []ssh.AuthMethod {
+	return []ssh.AuthMethod{
+		ssh.Password(password),
+		ssh.KeyboardInteractive(func(_, _ string, questions []string, _ []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = password
+			}
+			return answers, nil
+		}),
+	}
+}
+
+// verifySSHPassword checks whether SSH login with password succeeds.
+func verifySSHPassword(t *testing.T, dut *ondatra.DUTDevice, password string, wantOK bool) {
+	t.Helper()
+	var errs []error
+	ok := false
+	for _, auth := range passwordAuth(password) {
+		if _, err := sshDial(dut, auth); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ok = true
+		break
+	}
+	switch {
+	case ok && !wantOK:
+		t.Errorf("SSH password login of %s succeeded, want failure", *account)
+	case !ok && wantOK:
+		t.Errorf("SSH password login of %s failed: %v", *account, errors.Join(errs...))
+	}
+}
+
+// verifySSHKey checks whether SSH login with signer succeeds.
+func verifySSHKey(t *testing.T, dut *ondatra.DUTDevice, desc string, signer ssh.Signer, wantOK bool) {
+	t.Helper()
+	_, err := sshDial(dut, ssh.PublicKeys(signer))
+	switch {
+	case err == nil && !wantOK:
+		t.Errorf("SSH login of %s with %s succeeded, want failure", *account, desc)
+	case err != nil && wantOK:
+		t.Errorf("SSH login of %s with %s failed: %v", *account, desc, err)
+	}
+}
+
+// consoleLogin logs into the console of the DUT with password and returns an
+// error if no shell prompt is presented.
+func consoleLogin(t *testing.T, dut *ondatra.DUTDevice, password string) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), consoleTimeout)
+	defer cancel()
+	console, err := dut.RawAPIs().BindingDUT().DialConsole(ctx)
+	if err != nil {
+		t.Skipf("Console of %s not available: %v", dut.Name(), err)
+	}
+	defer console.Close()
+
+	output := make(chan []byte)
+	go func() {
+		defer close(output)
+		buf := make([]byte, 4096)
+		for {
+			n, err := console.Stdout().Read(buf)
+			if n > 0 {
+				output <- append([]byte{}, buf[:n]...)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	var seen []byte
+	expect := func(re *regexp.Regexp) error {
+		seen = seen[:0]
+		for {
+			select {
+			case b, ok := <-output:
+				if !ok {
+					return fmt.Errorf("console closed while waiting for %q", re)
+				}
+				seen = append(seen, b...)
+				if re.Match(seen) {
+					return nil
+				}
+			case <-ctx.Done():
+				return fmt.Errorf("timed out waiting for %q, got %q", re, seen)
+			}
+		}
+	}
+	send := func(line string) error {
+		_, err := io.WriteString(console.Stdin(), line+"\n")
+		return err
+	}
+
+	steps := []struct {
+		line string
+		want *regexp.Regexp
+	}{
+		{"", loginPrompt},
+		{*account, passwordPrompt},
+		{password, shellPrompt},
+	}
+	for _, s := range steps {
+		if err := send(s.line); err != nil {
+			return err
+		}
+		if err := expect(s.want); err != nil {
+			return err
+		}
+	}
+	return send("exit")
+}
+
+func TestSSHCredentialRotation(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+
+	user := gnmi.OC().System().Aaa().Authentication().User(*account)
+	gnmi.Replace(t, dut, user.Config(), &oc.System_Aaa_Authentication_User{
+		Username: account,
+		Role:     oc.AaaTypes_SYSTEM_DEFINED_ROLES_SYSTEM_ROLE_ADMIN,
+	})
+	defer gnmi.Delete(t, dut, user.Config())
+
+	allowAuthentication(t, dut,
+		cpb.AuthenticationType_AUTHENTICATION_TYPE_PASSWORD,
+		cpb.AuthenticationType_AUTHENTICATION_TYPE_PUBKEY,
+		cpb.AuthenticationType_AUTHENTICATION_TYPE_KBDINTERACTIVE,
+	)
+
+	t.Run("Credentialz-6.1: Host key rotation", func(t *testing.T) {
+		var previous ssh.PublicKey
+		for i := 0; i < 2; i++ {
+			want := rotateHostKey(t, dut)
+			got, _ := sshDial(dut, ssh.Password(""))
+			if got == nil {
+				t.Fatalf("SSH handshake with %s presented no host key", dut.Name())
+			}
+			if ssh.FingerprintSHA256(got) != ssh.FingerprintSHA256(want) {
+				t.Errorf("Host key after rotation %d: got %s, want %s", i+1, ssh.FingerprintSHA256(got), ssh.FingerprintSHA256(want))
+			}
+			if previous != nil && ssh.FingerprintSHA256(got) == ssh.FingerprintSHA256(previous) {
+				t.Errorf("Host key after rotation %d: got previous key %s", i+1, ssh.FingerprintSHA256(got))
+			}
+			previous = want
+		}
+	})
+
+	oldPassword, newPassword := "Fp-OldPassword-1!", "Fp-NewPassword-2!"
+	t.Run("Credentialz-6.2: Password rotation", func(t *testing.T) {
+		rotatePassword(t, dut, oldPassword)
+		verifySSHPassword(t, dut, oldPassword, true)
+
+		rotatePassword(t, dut, newPassword)
+		verifySSHPassword(t, dut, oldPassword, false)
+		verifySSHPassword(t, dut, newPassword, true)
+	})
+
+	t.Run("Credentialz-6.3: Authorized principals rotation", func(t *testing.T) {
+		ca := newUserCA(t)
+		ca.trust(t, dut)
+		certA := ca.issue(t, "principal-a")
+		certB := ca.issue(t, "principal-b")
+
+		rotatePrincipals(t, dut, "principal-a")
+		verifySSHKey(t, dut, "principal-a certificate", certA, true)
+		verifySSHKey(t, dut, "principal-b certificate", certB, false)
+
+		rotatePrincipals(t, dut, "principal-b")
+		verifySSHKey(t, dut, "principal-a certificate", certA, false)
+		verifySSHKey(t, dut, "principal-b certificate", certB, true)
+
+		untrusted := newUserCA(t).issue(t, "principal-b")
+		verifySSHKey(t, dut, "certificate of an untrusted CA", untrusted, false)
+	})
+
+	t.Run("Credentialz-6.4: Console fallback", func(t *testing.T) {
+		allowAuthentication(t, dut, cpb.AuthenticationType_AUTHENTICATION_TYPE_PUBKEY)
+		defer allowAuthentication(t, dut,
+			cpb.AuthenticationType_AUTHENTICATION_TYPE_PASSWORD,
+			cpb.AuthenticationType_AUTHENTICATION_TYPE_PUBKEY,
+			cpb.AuthenticationType_AUTHENTICATION_TYPE_KBDINTERACTIVE,
+		)
+		verifySSHPassword(t, dut, newPassword, false)
+		if err := consoleLogin(t, dut, newPassword); err != nil {
+			t.Errorf("Console password login of %s failed: %v", *account, err)
+		}
+	})
+}
@@ -0,0 +1,410 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathz_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/security/svid"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	pathzpb "github.com/openconfig/gnsi/pathz"
+)
+
+var (
+	caCertPem = flag.String("ca_cert_pem", "../../../authz/tests/authz/testdata/ca.cert.pem",
+		"a pem file for the ca cert that will be used to generate the svid of the test users")
+	caKeyPem = flag.String("ca_key_pem", "../../../authz/tests/authz/testdata/ca.key.pem",
+		"a pem file for the ca key that will be used to generate the svid of the test users")
+	infraUser = flag.String("infra_user", "admin",
+		"the user of the testbed binding, which is granted full access so that the test keeps control of the DUT")
+)
+
+const (
+	rpcTimeout = time.Minute
+	// The SPIFFE IDs of the test users, which the DUT is expected to map to the
+	// user names used in the pathz policy.
+	readerUser = "spiffe://test-abc.foo.bar/xyz/pathz-reader"
+	writerUser = "spiffe://test-abc.foo.bar/xyz/pathz-writer"
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// ocPath returns the openconfig origin gNMI path for a string path.
+func ocPath(t *testing.T, p string) *gpb.Path {
+	t.Helper()
+	path, err := ygot.StringToStructuredPath(p)
+	if err != nil {
+		t.Fatalf("StringToStructuredPath(%q): %v", p, err)
+	}
+	path.Origin = "openconfig"
+	return path
+}
+
+// rule returns a pathz rule for user.
+func rule(t *testing.T, id, user, path string, mode pathzpb.Mode, action pathzpb.Action) *pathzpb.AuthorizationRule {
+	return &pathzpb.AuthorizationRule{
+		Id:        id,
+		Principal: &pathzpb.AuthorizationRule_User{User: user},
+		Path:      ocPath(t, path),
+		Mode:      mode,
+		Action:    action,
+	}
+}
+
+// testPolicy returns the policy under test:
+//   - the reader may read /system except the /system/aaa subtree,
+//   - the writer may read /system/config and write only the login banner,
+//   - the infra user keeps full access.
+func testPolicy(t *testing.T) *pathzpb.AuthorizationPolicy {
+	return &pathzpb.AuthorizationPolicy{
+		Rules: []*pathzpb.AuthorizationRule{
+			rule(t, "infra-read", *infraUser, "/", pathzpb.Mode_MODE_READ, pathzpb.Action_ACTION_PERMIT),
+			rule(t, "infra-write", *infraUser, "/", pathzpb.Mode_MODE_WRITE, pathzpb.Action_ACTION_PERMIT),
+			rule(t, "reader-system", readerUser, "/system", pathzpb.Mode_MODE_READ, pathzpb.Action_ACTION_PERMIT),
+			rule(t, "reader-aaa", readerUser, "/system/aaa", pathzpb.Mode_MODE_READ, pathzpb.Action_ACTION_DENY),
+			rule(t, "writer-config", writerUser, "/system/config", pathzpb.Mode_MODE_READ, pathzpb.Action_ACTION_PERMIT),
+			rule(t, "writer-banner", writerUser, "/system/config/login-banner", pathzpb.Mode_MODE_WRITE, pathzpb.Action_ACTION_PERMIT),
+		},
+	}
+}
+
+// userCreds returns the TLS dial option of the SVID of each test user.
+func userCreds(t *testing.T) map[string]grpc.DialOption {
+	t.Helper()
+	caKey, caCert, err := svid.LoadKeyPair(*caKeyPem, *caCertPem)
+	if err != nil {
+		t.Fatalf("Could not load ca key/cert: %v", err)
+	}
+	caPEM, err := os.ReadFile(*caCertPem)
+	if err != nil {
+		t.Fatalf("Could not load the ca cert: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatalf("Could not create the trust bundle from %s", *caCertPem)
+	}
+	creds := map[string]grpc.DialOption{}
+	for _, user := range []string{readerUser, writerUser} {
+		cert, err := svid.GenSVID("", user, 300, caCert, caKey, x509.RSA)
+		if err != nil {
+			t.Fatalf("Could not generate svid for user %s: %v", user, err)
+		}
+		creds[user] = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{*cert},
+			RootCAs:      roots,
+		}))
+	}
+	return creds
+}
+
+type rotation struct {
+	stream pathzpb.Pathz_RotateClient
+	cancel context.CancelFunc
+}
+
+// startRotation uploads policy to the sandbox of the DUT and returns the open
+// stream.
+func startRotation(t *testing.T, dut *ondatra.DUTDevice, version string, policy *pathzpb.AuthorizationPolicy) *rotation {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := dut.RawAPIs().GNSI(t).Pathz().Rotate(ctx)
+	if err != nil {
+		cancel()
+		t.Fatalf("Pathz.Rotate: %v", err)
+	}
+	r := &rotation{stream: stream, cancel: cancel}
+	if err := stream.Send(&pathzpb.RotateRequest{
+		ForceOverwrite: true,
+		RotateRequest: &pathzpb.RotateRequest_UploadRequest{UploadRequest: &pathzpb.UploadRequest{
+			Version:   version,
+			CreatedOn: uint64(time.Now().UnixNano()),
+			Policy:    policy,
+		}},
+	}); err != nil {
+		cancel()
+		t.Fatalf("Pathz.Rotate upload: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		cancel()
+		t.Fatalf("Pathz.Rotate upload: %v", err)
+	}
+	return r
+}
+
+// finalize makes the uploaded policy the active one.
+func (r *rotation) finalize(t *testing.T) {
+	t.Helper()
+	defer r.cancel()
+	if err := r.stream.Send(&pathzpb.RotateRequest{
+		RotateRequest: &pathzpb.RotateRequest_FinalizeRotation{FinalizeRotation: &pathzpb.FinalizeRequest{}},
+	}); err != nil {
+		t.Fatalf("Pathz.Rotate finalize: %v", err)
+	}
+	if err := r.stream.CloseSend(); err != nil {
+		t.Fatalf("Pathz.Rotate CloseSend: %v", err)
+	}
+	if _, err := r.stream.Recv(); err != nil && !errors.Is(err, io.EOF) {
+		t.Fatalf("Pathz.Rotate finalize: %v", err)
+	}
+}
+
+// restorePolicy reinstalls the policy which was active before the test, if
+// there was one.
+func restorePolicy(t *testing.T, dut *ondatra.DUTDevice) func() {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	resp, err := dut.RawAPIs().GNSI(t).Pathz().Get(ctx, &pathzpb.GetRequest{PolicyInstance: pathzpb.PolicyInstance_POLICY_INSTANCE_ACTIVE})
+	if err != nil && status.Code(err) != codes.NotFound {
+		t.Fatalf("Pathz.Get: %v", err)
+	}
+	if resp.GetPolicy() == nil {
+		t.Logf("DUT has no active pathz policy, it is left with the test policy")
+		return func() {}
+	}
+	return func() {
+		t.Logf("Restoring pathz policy version %q", resp.GetVersion())
+		startRotation(t, dut, resp.GetVersion(), resp.GetPolicy()).finalize(t)
+	}
+}
+
+type probeCase struct {
+	user   string
+	path   string
+	mode   pathzpb.Mode
+	action pathzpb.Action
+}
+
+var probeCases = []probeCase{
+	{readerUser, "/system/config/hostname", pathzpb.Mode_MODE_READ, pathzpb.Action_ACTION_PERMIT},
+	{readerUser, "/system/aaa/authentication/config", pathzpb.Mode_MODE_READ, pathzpb.Action_ACTION_DENY},
+	{readerUser, "/interfaces", pathzpb.Mode_MODE_READ, pathzpb.Action_ACTION_DENY},
+	{readerUser, "/system/config/login-banner", pathzpb.Mode_MODE_WRITE, pathzpb.Action_ACTION_DENY},
+	{writerUser, "/system/config/login-banner", pathzpb.Mode_MODE_WRITE, pathzpb.Action_ACTION_PERMIT},
+	{writerUser, "/system/config/hostname", pathzpb.Mode_MODE_WRITE, pathzpb.Action_ACTION_DENY},
+	{writerUser, "/system/state", pathzpb.Mode_MODE_READ, pathzpb.Action_ACTION_DENY},
+}
+
+// verifyProbe checks that the decisions of the policy instance match
+// probeCases.
+func verifyProbe(t *testing.T, dut *ondatra.DUTDevice, instance pathzpb.PolicyInstance, version string) {
+	t.Helper()
+	for _, c := range probeCases {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		resp, err := dut.RawAPIs().GNSI(t).Pathz().Probe(ctx, &pathzpb.ProbeRequest{
+			User:           c.user,
+			Path:           ocPath(t, c.path),
+			Mode:           c.mode,
+			PolicyInstance: instance,
+		})
+		cancel()
+		if err != nil {
+			t.Errorf("Pathz.Probe(%v, %s, %s, %v): %v", instance, c.user, c.path, c.mode, err)
+			continue
+		}
+		if resp.GetAction() != c.action {
+			t.Errorf("Pathz.Probe(%v, %s, %s, %v) action: got %v, want %v", instance, c.user, c.path, c.mode, resp.GetAction(), c.action)
+		}
+		if resp.GetVersion() != version {
+			t.Errorf("Pathz.Probe(%v, %s, %s, %v) version: got %q, want %q", instance, c.user, c.path, c.mode, resp.GetVersion(), version)
+		}
+	}
+}
+
+// dialGNMI returns a gNMI client authenticated with creds.
+func dialGNMI(t *testing.T, dut *ondatra.DUTDevice, creds grpc.DialOption) gpb.GNMIClient {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	c, err := dut.RawAPIs().BindingDUT().DialGNMI(ctx, creds)
+	if err != nil {
+		t.Fatalf("DialGNMI: %v", err)
+	}
+	return c
+}
+
+// get issues a gNMI Get of path and returns the status code of the RPC.
+func get(t *testing.T, c gpb.GNMIClient, path string) codes.Code {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	_, err := c.Get(ctx, &gpb.GetRequest{
+		Path:     []*gpb.Path{ocPath(t, path)},
+		Encoding: gpb.Encoding_JSON_IETF,
+	})
+	return status.Code(err)
+}
+
+// replace issues a gNMI Set replacing the string leaf at path and returns the
+// status code of the RPC.
+func replace(t *testing.T, c gpb.GNMIClient, path, value string) codes.Code {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	_, err := c.Set(ctx, &gpb.SetRequest{
+		Replace: []*gpb.Update{{
+			Path: ocPath(t, path),
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(fmt.Sprintf("%q", value))}},
+		}},
+	})
+	return status.Code(err)
+}
+
+// subscribeOnce issues a ONCE subscription to path and returns the paths of
+// all updates received, or the error of the RPC.
+func subscribeOnce(t *testing.T, c gpb.GNMIClient, path string) ([]string, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	sub, err := c.Subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := sub.Send(&gpb.SubscribeRequest{
+		Request: &gpb.SubscribeRequest_Subscribe{Subscribe: &gpb.SubscriptionList{
+			Mode:         gpb.SubscriptionList_ONCE,
+			Encoding:     gpb.Encoding_PROTO,
+			Subscription: []*gpb.Subscription{{Path: ocPath(t, path)}},
+		}},
+	}); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for {
+		resp, err := sub.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if resp.GetSyncResponse() {
+			return paths, nil
+		}
+		n := resp.GetUpdate()
+		for _, u := range n.GetUpdate() {
+			elems := append(append([]*gpb.PathElem{}, n.GetPrefix().GetElem()...), u.GetPath().GetElem()...)
+			p, err := ygot.PathToString(&gpb.Path{Elem: elems})
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, p)
+		}
+	}
+}
+
+func TestPathz(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	creds := userCreds(t)
+	defer restorePolicy(t, dut)()
+
+	version := fmt.Sprintf("pathz-1-%d", time.Now().Unix())
+	t.Run("Pathz-1.1: Probe sandbox and active policy", func(t *testing.T) {
+		r := startRotation(t, dut, version, testPolicy(t))
+		verifyProbe(t, dut, pathzpb.PolicyInstance_POLICY_INSTANCE_SANDBOX, version)
+		r.finalize(t)
+		verifyProbe(t, dut, pathzpb.PolicyInstance_POLICY_INSTANCE_ACTIVE, version)
+
+		for _, got := range gnmi.GetAll(t, dut, gnmi.OC().System().GrpcServerAny().GnmiPathzPolicyVersion().State()) {
+			if got != version {
+				t.Errorf("gnmi-pathz-policy-version: got %q, want %q", got, version)
+			}
+		}
+	})
+
+	reader := dialGNMI(t, dut, creds[readerUser])
+	writer := dialGNMI(t, dut, creds[writerUser])
+
+	t.Run("Pathz-1.2: Get enforcement", func(t *testing.T) {
+		cases := []struct {
+			desc   string
+			client gpb.GNMIClient
+			path   string
+			want   codes.Code
+		}{
+			{"reader permitted leaf", reader, "/system/config/hostname", codes.OK},
+			{"reader denied subtree", reader, "/system/aaa", codes.PermissionDenied},
+			{"reader denied leaf below denied subtree", reader, "/system/aaa/authentication/config/authentication-method", codes.PermissionDenied},
+			{"reader path outside policy", reader, "/interfaces", codes.PermissionDenied},
+			{"writer permitted container", writer, "/system/config", codes.OK},
+			{"writer path outside policy", writer, "/system/state", codes.PermissionDenied},
+		}
+		for _, c := range cases {
+			if got := get(t, c.client, c.path); got != c.want {
+				t.Errorf("%s: Get(%s): got %v, want %v", c.desc, c.path, got, c.want)
+			}
+		}
+	})
+
+	t.Run("Pathz-1.3: Set enforcement", func(t *testing.T) {
+		banner := fmt.Sprintf("pathz test %s", version)
+		if got := replace(t, writer, "/system/config/login-banner", banner); got != codes.OK {
+			t.Fatalf("writer Set(login-banner): got %v, want %v", got, codes.OK)
+		}
+		if got := gnmi.Get(t, dut, gnmi.OC().System().LoginBanner().State()); got != banner {
+			t.Errorf("login-banner after writer Set: got %q, want %q", got, banner)
+		}
+		if got := replace(t, writer, "/system/config/hostname", "pathz-denied"); got != codes.PermissionDenied {
+			t.Errorf("writer Set(hostname): got %v, want %v", got, codes.PermissionDenied)
+		}
+		if got := replace(t, reader, "/system/config/login-banner", "pathz-denied"); got != codes.PermissionDenied {
+			t.Errorf("reader Set(login-banner): got %v, want %v", got, codes.PermissionDenied)
+		}
+		if got := gnmi.Get(t, dut, gnmi.OC().System().LoginBanner().State()); got != banner {
+			t.Errorf("login-banner after denied Set: got %q, want %q", got, banner)
+		}
+		gnmi.Delete(t, dut, gnmi.OC().System().LoginBanner().Config())
+	})
+
+	t.Run("Pathz-1.4: Subscribe enforcement", func(t *testing.T) {
+		paths, err := subscribeOnce(t, reader, "/system")
+		if err != nil {
+			t.Fatalf("reader Subscribe(/system): %v", err)
+		}
+		if len(paths) == 0 {
+			t.Errorf("reader Subscribe(/system): got no updates, want updates of permitted paths")
+		}
+		for _, p := range paths {
+			if strings.HasPrefix(p, "/system/aaa") {
+				t.Errorf("reader Subscribe(/system): got update for denied path %s", p)
+			}
+		}
+
+		if _, err := subscribeOnce(t, reader, "/system/aaa"); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("reader Subscribe(/system/aaa): got %v, want %v", err, codes.PermissionDenied)
+		}
+		if _, err := subscribeOnce(t, writer, "/system/config"); err != nil {
+			t.Errorf("writer Subscribe(/system/config): %v", err)
+		}
+	})
+}
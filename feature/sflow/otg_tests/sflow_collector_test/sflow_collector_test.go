@@ -0,0 +1,264 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sflow_collector_test
+
+import (
+	"context"
+	"flag"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/featureprofiles/internal/sflowcollector"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+)
+
+// The sFlow collector runs on the test host, or in a container, which the DUT
+// reaches through the network instance given by -sflow_vrf.
+var (
+	sflowListen = flag.String("sflow_listen", ":6343",
+		"UDP address on which the sFlow collector listens")
+	sflowCollector = flag.String("sflow_collector", "",
+		"address of the sFlow collector reachable by the DUT; the test is skipped when empty")
+	sflowVRF = flag.String("sflow_vrf", "",
+		"network instance through which the DUT reaches the sFlow collector; if empty the default network instance is used")
+	sflowSource = flag.String("sflow_source", "",
+		"source address of the sFlow datagrams of the DUT; if empty it is not configured")
+)
+
+const (
+	ipv4PrefixLen = 30
+	ipv6PrefixLen = 126
+
+	samplingRate    = 1000
+	sampleSize      = 256
+	pollingInterval = 10 // seconds
+	frameSize       = 512
+	packetsToSend   = 2000000
+	ppsRate         = 100000
+	flowName        = "IPv4Flow"
+	// sampleTolerance is the relative deviation from packetsToSend /
+	// samplingRate tolerated for the number of flow samples.
+	sampleTolerance = 0.2
+	// exportDelay is the time left to the DUT to export the last samples.
+	exportDelay = 30 * time.Second
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::1",
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::2",
+		IPv6Len: ipv6PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::5",
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::6",
+		IPv6Len: ipv6PrefixLen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	d := gnmi.OC()
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+	gnmi.Replace(t, dut, d.Interface(p1.Name()).Config(), dutPort1.NewOCInterface(p1.Name(), dut))
+	gnmi.Replace(t, dut, d.Interface(p2.Name()).Config(), dutPort2.NewOCInterface(p2.Name(), dut))
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		fptest.AssignToNetworkInstance(t, dut, p2.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+}
+
+// configureSFlow configures the DUT to sample the packets received on port1
+// and to export them to the collector on port, and deletes the sFlow
+// configuration at the end of the test.
+func configureSFlow(t *testing.T, dut *ondatra.DUTDevice, port uint16) {
+	t.Helper()
+	sf := &oc.Sampling_Sflow{
+		Enabled:             ygot.Bool(true),
+		AgentIdIpv4:         ygot.String(dutPort1.IPv4),
+		SampleSize:          ygot.Uint16(sampleSize),
+		IngressSamplingRate: ygot.Uint32(samplingRate),
+		PollingInterval:     ygot.Uint16(pollingInterval),
+	}
+	c := sf.GetOrCreateCollector(*sflowCollector, port)
+	vrf := *sflowVRF
+	if vrf == "" {
+		vrf = deviations.DefaultNetworkInstance(dut)
+	}
+	c.NetworkInstance = ygot.String(vrf)
+	if *sflowSource != "" {
+		c.SourceAddress = ygot.String(*sflowSource)
+	}
+	for _, p := range []string{"port1", "port2"} {
+		i := sf.GetOrCreateInterface(dut.Port(t, p).Name())
+		i.Enabled = ygot.Bool(true)
+		i.PollingInterval = ygot.Uint16(pollingInterval)
+	}
+	gnmi.Replace(t, dut, gnmi.OC().Sampling().Sflow().Config(), sf)
+	t.Cleanup(func() { gnmi.Delete(t, dut, gnmi.OC().Sampling().Sflow().Config()) })
+
+	got := gnmi.Get(t, dut, gnmi.OC().Sampling().Sflow().State())
+	if got.GetIngressSamplingRate() != samplingRate || got.GetAgentIdIpv4() != dutPort1.IPv4 || !got.GetEnabled() {
+		t.Errorf("sFlow state: got enabled %t, ingress-sampling-rate %d and agent-id-ipv4 %q, want true, %d and %q",
+			got.GetEnabled(), got.GetIngressSamplingRate(), got.GetAgentIdIpv4(), samplingRate, dutPort1.IPv4)
+	}
+}
+
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	atePort1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	atePort2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+
+	f := top.Flows().Add().SetName(flowName)
+	f.Metrics().SetEnable(true)
+	f.TxRx().Device().SetTxNames([]string{atePort1.Name + ".IPv4"}).SetRxNames([]string{atePort2.Name + ".IPv4"})
+	f.Size().SetFixed(frameSize)
+	f.Rate().SetPps(ppsRate)
+	f.Duration().FixedPackets().SetPackets(packetsToSend)
+	f.Packet().Add().Ethernet().Src().SetValue(atePort1.MAC)
+	ip := f.Packet().Add().Ipv4()
+	ip.Src().SetValue(atePort1.IPv4)
+	ip.Dst().SetValue(atePort2.IPv4)
+	return top
+}
+
+// sampledFlow returns whether the header of s is a packet of the flow.
+func sampledFlow(s *sflowcollector.FlowSample) bool {
+	if s.Header == nil || s.Header.Protocol != sflowcollector.Ethernet {
+		return false
+	}
+	p := gopacket.NewPacket(s.Header.Header, layers.LayerTypeEthernet, gopacket.Lazy)
+	ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	return ok && ip.SrcIP.Equal(net.ParseIP(atePort1.IPv4)) && ip.DstIP.Equal(net.ParseIP(atePort2.IPv4))
+}
+
+func TestSFlowCollector(t *testing.T) {
+	if *sflowCollector == "" {
+		t.Skip("No sFlow collector address given by -sflow_collector")
+	}
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	c, err := sflowcollector.Listen(*sflowListen)
+	if err != nil {
+		t.Fatalf("Cannot start sFlow collector: %v", err)
+	}
+	defer c.Close()
+
+	configureDUT(t, dut)
+	configureSFlow(t, dut, c.Port())
+	in := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port1").Name()).Ifindex().State())
+	out := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, "port2").Name()).Ifindex().State())
+	t.Logf("Interface indices: port1 %d, port2 %d", in, out)
+
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	defer ate.OTG().StopProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+
+	c.Reset()
+	ate.OTG().StartTraffic(t)
+	time.Sleep(time.Duration(packetsToSend/ppsRate) * time.Second)
+	ate.OTG().StopTraffic(t)
+	time.Sleep(exportDelay)
+	otgutils.LogFlowMetrics(t, ate.OTG(), top)
+	for _, err := range c.Errors() {
+		t.Errorf("sFlow collector could not parse a datagram: %v", err)
+	}
+
+	t.Run("FlowSamples", func(t *testing.T) {
+		samples := c.FlowSamples(sampledFlow)
+		want := float64(packetsToSend) / samplingRate
+		t.Logf("sFlow collector received %d flow samples of %s, want about %.0f", len(samples), flowName, want)
+		if math.Abs(float64(len(samples))-want) > want*sampleTolerance {
+			t.Errorf("Flow samples of %s: got %d, want %.0f ± %.0f%%", flowName, len(samples), want, sampleTolerance*100)
+		}
+		for _, s := range samples {
+			if s.SamplingRate != samplingRate || s.Input != in || s.Output != out || !s.Agent.Equal(net.ParseIP(dutPort1.IPv4)) {
+				t.Errorf("Flow sample: got %v of agent %v, want sampling rate %d, input %d and output %d of agent %s",
+					s, s.Agent, samplingRate, in, out, dutPort1.IPv4)
+				break
+			}
+			if s.Header.FrameLength < frameSize || len(s.Header.Header) > sampleSize {
+				t.Errorf("Flow sample: got header of %d bytes of a frame of %d bytes, want at most %d bytes of a frame of %d bytes",
+					len(s.Header.Header), s.Header.FrameLength, sampleSize, frameSize)
+				break
+			}
+		}
+	})
+
+	t.Run("CounterSamples", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*pollingInterval*time.Second)
+		defer cancel()
+		for _, index := range []uint32{in, out} {
+			d, err := c.Await(ctx, func(d *sflowcollector.Datagram) bool {
+				for _, s := range d.CounterSamples {
+					if s.Interface != nil && s.Interface.Index == index {
+						return true
+					}
+				}
+				return false
+			})
+			if err != nil {
+				t.Errorf("No counter sample of interface %d within %v: %v", index, 3*pollingInterval*time.Second, err)
+				continue
+			}
+			t.Logf("sFlow collector received counter samples of interface %d in %v", index, d)
+		}
+	})
+}
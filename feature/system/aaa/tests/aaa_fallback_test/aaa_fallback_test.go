@@ -0,0 +1,260 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aaa_fallback_test
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	gnmiAddr = flag.String("gnmi_addr", "",
+		"host:port of the gNMI server of the DUT accepting username and password metadata; if empty the DUT name and port 9339 are used")
+	tacacsAddr = flag.String("tacacs_addr", "192.0.2.1",
+		"address of the TACACS+ server; the default is unreachable so that authentication falls back to local")
+	tacacsKey    = flag.String("tacacs_key", "fp-tacacs-key", "TACACS+ secret key")
+	readOnlyRole = flag.String("read_only_role", "",
+		"name of a role of the DUT which permits gNMI Get but not Set; role mapping of a read-only user is not verified if empty")
+	lockoutAttempts = flag.Int("lockout_attempts", 0,
+		"number of consecutive failed logins after which the DUT locks out a local user; lockout is not verified if 0")
+	lockoutCLI = flag.String("lockout_cli", "",
+		"optional CLI configuration applied with gNMI Set to enable the lockout of local users after -lockout_attempts failures")
+)
+
+const (
+	serverGroup   = "fp-tacacs"
+	adminUser     = "fp-admin"
+	readOnlyUser  = "fp-read-only"
+	lockoutUser   = "fp-lockout"
+	password      = "fp-Passw0rd!"
+	wrongPassword = "fp-Wr0ng!"
+	// tacacsTimeout is the timeout of the TACACS+ server, kept short so that
+	// fallback to local authentication happens well within rpcTimeout.
+	tacacsTimeout = 5
+	rpcTimeout    = time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureAAA configures a TACACS+ server group followed by local as the
+// authentication and authorization methods, and returns a function restoring
+// the previous methods.
+func configureAAA(t *testing.T, dut *ondatra.DUTDevice) func() {
+	t.Helper()
+	aaa := gnmi.OC().System().Aaa()
+	prevAuthn := gnmi.Lookup(t, dut, aaa.Authentication().AuthenticationMethod().Config())
+	prevAuthz := gnmi.Lookup(t, dut, aaa.Authorization().AuthorizationMethod().Config())
+
+	sg := &oc.System_Aaa_ServerGroup{
+		Name: ygot.String(serverGroup),
+		Type: oc.AaaTypes_AAA_SERVER_TYPE_TACACS,
+	}
+	s := sg.GetOrCreateServer(*tacacsAddr)
+	s.Timeout = ygot.Uint16(tacacsTimeout)
+	s.GetOrCreateTacacs().SecretKey = ygot.String(*tacacsKey)
+	gnmi.Replace(t, dut, aaa.ServerGroup(serverGroup).Config(), sg)
+
+	gnmi.Replace(t, dut, aaa.Authentication().AuthenticationMethod().Config(), []oc.System_Aaa_Authentication_AuthenticationMethod_Union{
+		oc.UnionString(serverGroup), oc.AaaTypes_AAA_METHOD_TYPE_LOCAL,
+	})
+	gnmi.Replace(t, dut, aaa.Authorization().AuthorizationMethod().Config(), []oc.System_Aaa_Authorization_AuthorizationMethod_Union{
+		oc.UnionString(serverGroup), oc.AaaTypes_AAA_METHOD_TYPE_LOCAL,
+	})
+
+	return func() {
+		if v, ok := prevAuthn.Val(); ok {
+			gnmi.Replace(t, dut, aaa.Authentication().AuthenticationMethod().Config(), v)
+		} else {
+			gnmi.Delete(t, dut, aaa.Authentication().AuthenticationMethod().Config())
+		}
+		if v, ok := prevAuthz.Val(); ok {
+			gnmi.Replace(t, dut, aaa.Authorization().AuthorizationMethod().Config(), v)
+		} else {
+			gnmi.Delete(t, dut, aaa.Authorization().AuthorizationMethod().Config())
+		}
+		gnmi.Delete(t, dut, aaa.ServerGroup(serverGroup).Config())
+	}
+}
+
+// createUser configures a local user and deletes it at the end of the test.
+func createUser(t *testing.T, dut *ondatra.DUTDevice, name string, role oc.System_Aaa_Authentication_User_Role_Union) {
+	t.Helper()
+	path := gnmi.OC().System().Aaa().Authentication().User(name)
+	gnmi.Replace(t, dut, path.Config(), &oc.System_Aaa_Authentication_User{
+		Username: ygot.String(name),
+		Password: ygot.String(password),
+		Role:     role,
+	})
+	t.Cleanup(func() { gnmi.Delete(t, dut, path.Config()) })
+}
+
+// userClient is a gNMI client which authenticates with username and password
+// metadata.
+type userClient struct {
+	gpb.GNMIClient
+	user, password string
+}
+
+func dialUser(t *testing.T, dut *ondatra.DUTDevice, user, password string) *userClient {
+	t.Helper()
+	addr := *gnmiAddr
+	if addr == "" {
+		addr = net.JoinHostPort(dut.Name(), "9339")
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		InsecureSkipVerify: true, // NOLINT
+	})))
+	if err != nil {
+		t.Fatalf("grpc.Dial(%q): %v", addr, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &userClient{GNMIClient: gpb.NewGNMIClient(conn), user: user, password: password}
+}
+
+func (c *userClient) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	return metadata.AppendToOutgoingContext(ctx, "username", c.user, "password", c.password), cancel
+}
+
+// get reads the hostname of the DUT.
+func (c *userClient) get() error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.Get(ctx, &gpb.GetRequest{
+		Path:     []*gpb.Path{{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "hostname"}}}},
+		Type:     gpb.GetRequest_STATE,
+		Encoding: gpb.Encoding_JSON_IETF,
+	})
+	return err
+}
+
+// set replaces the login banner of the DUT.
+func (c *userClient) set() error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.Set(ctx, &gpb.SetRequest{
+		Replace: []*gpb.Update{{
+			Path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "config"}, {Name: "login-banner"}}},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`"` + c.user + `"`)}},
+		}},
+	})
+	return err
+}
+
+// tacacsAttempts returns the sum of the connection failures and timeouts of
+// the TACACS+ server.
+func tacacsAttempts(t *testing.T, dut *ondatra.DUTDevice) uint64 {
+	t.Helper()
+	s := gnmi.Get(t, dut, gnmi.OC().System().Aaa().ServerGroup(serverGroup).Server(*tacacsAddr).State())
+	return s.GetConnectionFailures() + s.GetConnectionTimeouts() + s.GetConnectionAborts()
+}
+
+func wantCode(t *testing.T, op string, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("%s: got code %v, want %v (error: %v)", op, got, want, err)
+	}
+}
+
+func TestAuthenticationFallback(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	defer configureAAA(t, dut)()
+	createUser(t, dut, adminUser, oc.AaaTypes_SYSTEM_DEFINED_ROLES_SYSTEM_ROLE_ADMIN)
+
+	before := tacacsAttempts(t, dut)
+	if err := dialUser(t, dut, adminUser, password).get(); err != nil {
+		t.Errorf("gNMI Get of %s with the local password failed, want fallback to local: %v", adminUser, err)
+	}
+	wantCode(t, "gNMI Get with a wrong password", dialUser(t, dut, adminUser, wrongPassword).get(), codes.Unauthenticated)
+
+	if after := tacacsAttempts(t, dut); after <= before {
+		t.Errorf("TACACS+ connection failures and timeouts did not increase (before %d, after %d), want the server group tried before local", before, after)
+	}
+}
+
+func TestRoleMapping(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	defer configureAAA(t, dut)()
+	createUser(t, dut, adminUser, oc.AaaTypes_SYSTEM_DEFINED_ROLES_SYSTEM_ROLE_ADMIN)
+	defer gnmi.Delete(t, dut, gnmi.OC().System().LoginBanner().Config())
+
+	t.Run("admin", func(t *testing.T) {
+		c := dialUser(t, dut, adminUser, password)
+		if err := c.get(); err != nil {
+			t.Errorf("gNMI Get: %v", err)
+		}
+		if err := c.set(); err != nil {
+			t.Errorf("gNMI Set: %v", err)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		if *readOnlyRole == "" {
+			t.Skip("-read_only_role not set")
+		}
+		createUser(t, dut, readOnlyUser, oc.UnionString(*readOnlyRole))
+		c := dialUser(t, dut, readOnlyUser, password)
+		if err := c.get(); err != nil {
+			t.Errorf("gNMI Get: %v", err)
+		}
+		wantCode(t, "gNMI Set", c.set(), codes.PermissionDenied)
+	})
+}
+
+func TestLockout(t *testing.T) {
+	if *lockoutAttempts == 0 {
+		t.Skip("-lockout_attempts not set")
+	}
+	dut := ondatra.DUT(t, "dut")
+	if *lockoutCLI != "" {
+		clihelper.Push(t, dut, &clihelper.Config{
+			Reason: "lockout after failed login attempts",
+			CLI:    map[ondatra.Vendor]string{dut.Vendor(): *lockoutCLI},
+		})
+	}
+	defer configureAAA(t, dut)()
+	createUser(t, dut, lockoutUser, oc.AaaTypes_SYSTEM_DEFINED_ROLES_SYSTEM_ROLE_ADMIN)
+
+	if err := dialUser(t, dut, lockoutUser, password).get(); err != nil {
+		t.Fatalf("gNMI Get of %s before lockout: %v", lockoutUser, err)
+	}
+	wrong := dialUser(t, dut, lockoutUser, wrongPassword)
+	for i := 0; i < *lockoutAttempts; i++ {
+		wantCode(t, "gNMI Get with a wrong password", wrong.get(), codes.Unauthenticated)
+	}
+	if err := dialUser(t, dut, lockoutUser, password).get(); err == nil {
+		t.Errorf("gNMI Get of %s with the correct password succeeded after %d failures, want locked out", lockoutUser, *lockoutAttempts)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aaa_radius_test
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/radius"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	"golang.org/x/crypto/ssh"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// The RADIUS server runs on the test host, or in a container, which the DUT
+// reaches through its management network.
+var (
+	radiusListen = flag.String("radius_listen", ":1812",
+		"UDP address on which the RADIUS server listens for authentication and accounting")
+	radiusHost = flag.String("radius_host", "",
+		"address of the RADIUS server reachable by the DUT; the test is skipped when empty")
+	radiusSecret = flag.String("radius_secret", "fp-radius-secret", "RADIUS shared secret")
+	gnmiAddr     = flag.String("gnmi_addr", "",
+		"host:port of the gNMI server of the DUT accepting username and password metadata; if empty the DUT name and port 9339 are used")
+	sshAddr = flag.String("ssh_addr", "",
+		"host:port of the SSH server of the DUT; accounting is skipped when empty")
+)
+
+const (
+	serverGroup = "fp-radius"
+	// radiusUser is a user of the RADIUS server, and localUser a local user
+	// of the DUT.
+	radiusUser    = "fp-radius-user"
+	localUser     = "fp-local"
+	password      = "fp-Passw0rd!"
+	wrongPassword = "fp-Wr0ng!"
+	wrongSecret   = "fp-wrong-secret"
+	// radiusTimeout and retransmitAttempts are kept low so that fallback to
+	// local authentication happens well within rpcTimeout.
+	radiusTimeout      = 3
+	retransmitAttempts = 1
+	rpcTimeout         = time.Minute
+	requestTimeout     = 30 * time.Second
+)
+
+var users = map[string]radius.User{radiusUser: {Password: password}}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// startServer starts the RADIUS server, and stops it at the end of the test.
+func startServer(t *testing.T) *radius.Server {
+	t.Helper()
+	if *radiusHost == "" {
+		t.Skip("No RADIUS server address given by -radius_host")
+	}
+	s, err := radius.Listen(*radiusListen, *radiusSecret, users)
+	if err != nil {
+		t.Fatalf("Cannot start RADIUS server: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// configureAAA configures the RADIUS server on port, with secret, followed by
+// local as the authentication methods, and the RADIUS server as the
+// accounting method of logins. It returns a function restoring the previous
+// methods.
+func configureAAA(t *testing.T, dut *ondatra.DUTDevice, port uint16, secret string) func() {
+	t.Helper()
+	aaa := gnmi.OC().System().Aaa()
+	prevAuthn := gnmi.Lookup(t, dut, aaa.Authentication().AuthenticationMethod().Config())
+	prevAcct := gnmi.Lookup(t, dut, aaa.Accounting().Config())
+
+	sg := &oc.System_Aaa_ServerGroup{
+		Name: ygot.String(serverGroup),
+		Type: oc.AaaTypes_AAA_SERVER_TYPE_RADIUS,
+	}
+	s := sg.GetOrCreateServer(*radiusHost)
+	s.Timeout = ygot.Uint16(radiusTimeout)
+	r := s.GetOrCreateRadius()
+	r.AuthPort = ygot.Uint16(port)
+	r.AcctPort = ygot.Uint16(port)
+	r.SecretKey = ygot.String(secret)
+	r.RetransmitAttempts = ygot.Uint8(retransmitAttempts)
+	gnmi.Replace(t, dut, aaa.ServerGroup(serverGroup).Config(), sg)
+
+	gnmi.Replace(t, dut, aaa.Authentication().AuthenticationMethod().Config(), []oc.System_Aaa_Authentication_AuthenticationMethod_Union{
+		oc.UnionString(serverGroup), oc.AaaTypes_AAA_METHOD_TYPE_LOCAL,
+	})
+	acct := &oc.System_Aaa_Accounting{
+		AccountingMethod: []oc.System_Aaa_Accounting_AccountingMethod_Union{oc.UnionString(serverGroup)},
+	}
+	acct.GetOrCreateEvent(oc.AaaTypes_AAA_ACCOUNTING_EVENT_TYPE_AAA_ACCOUNTING_EVENT_LOGIN).Record = oc.Event_Record_START_STOP
+	gnmi.Replace(t, dut, aaa.Accounting().Config(), acct)
+
+	return func() {
+		if v, ok := prevAuthn.Val(); ok {
+			gnmi.Replace(t, dut, aaa.Authentication().AuthenticationMethod().Config(), v)
+		} else {
+			gnmi.Delete(t, dut, aaa.Authentication().AuthenticationMethod().Config())
+		}
+		if v, ok := prevAcct.Val(); ok {
+			gnmi.Replace(t, dut, aaa.Accounting().Config(), v)
+		} else {
+			gnmi.Delete(t, dut, aaa.Accounting().Config())
+		}
+		gnmi.Delete(t, dut, aaa.ServerGroup(serverGroup).Config())
+	}
+}
+
+// createLocalUser configures the local user of the DUT, and deletes it at the
+// end of the test.
+func createLocalUser(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	path := gnmi.OC().System().Aaa().Authentication().User(localUser)
+	gnmi.Replace(t, dut, path.Config(), &oc.System_Aaa_Authentication_User{
+		Username: ygot.String(localUser),
+		Password: ygot.String(password),
+		Role:     oc.AaaTypes_SYSTEM_DEFINED_ROLES_SYSTEM_ROLE_ADMIN,
+	})
+	t.Cleanup(func() { gnmi.Delete(t, dut, path.Config()) })
+}
+
+// gnmiGet reads the hostname of the DUT with gNMI as user.
+func gnmiGet(t *testing.T, dut *ondatra.DUTDevice, user, password string) error {
+	t.Helper()
+	addr := *gnmiAddr
+	if addr == "" {
+		addr = net.JoinHostPort(dut.Name(), "9339")
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		InsecureSkipVerify: true, // NOLINT
+	})))
+	if err != nil {
+		t.Fatalf("grpc.Dial(%q): %v", addr, err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "username", user, "password", password)
+	_, err = gpb.NewGNMIClient(conn).Get(ctx, &gpb.GetRequest{
+		Path:     []*gpb.Path{{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "hostname"}}}},
+		Type:     gpb.GetRequest_STATE,
+		Encoding: gpb.Encoding_JSON_IETF,
+	})
+	return err
+}
+
+// counters returns the RADIUS counters of the server of the DUT.
+func counters(t *testing.T, dut *ondatra.DUTDevice) *oc.System_Aaa_ServerGroup_Server_Radius_Counters {
+	t.Helper()
+	return gnmi.Get(t, dut, gnmi.OC().System().Aaa().ServerGroup(serverGroup).Server(*radiusHost).Radius().Counters().State())
+}
+
+// await waits for the RADIUS server s to record a request which matches.
+func await(t *testing.T, s *radius.Server, desc string, match func(*radius.Record) bool) *radius.Record {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	r, err := s.Await(ctx, match)
+	if err != nil {
+		t.Fatalf("RADIUS server did not receive %s within %v: %v\nReceived requests: %v", desc, requestTimeout, err, s.Records(nil))
+	}
+	t.Logf("RADIUS server received %v", r)
+	return r
+}
+
+func wantCode(t *testing.T, op string, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("%s: got code %v, want %v (error: %v)", op, got, want, err)
+	}
+}
+
+// TestAuthentication verifies that the DUT authenticates the users of the
+// RADIUS server with it, and counts the accepted and rejected requests.
+func TestAuthentication(t *testing.T) {
+	s := startServer(t)
+	dut := ondatra.DUT(t, "dut")
+	defer configureAAA(t, dut, s.Port(), *radiusSecret)()
+	before := counters(t, dut)
+
+	if err := gnmiGet(t, dut, radiusUser, password); err != nil {
+		t.Errorf("gNMI Get of %s failed: %v", radiusUser, err)
+	}
+	await(t, s, "the accepted Access-Request of "+radiusUser, func(r *radius.Record) bool {
+		return r.Code == radius.AccessRequest && r.User == radiusUser && r.Pass && r.Answered
+	})
+
+	wantCode(t, "gNMI Get with a wrong password", gnmiGet(t, dut, radiusUser, wrongPassword), codes.Unauthenticated)
+	await(t, s, "the rejected Access-Request of "+radiusUser, func(r *radius.Record) bool {
+		return r.Code == radius.AccessRequest && r.User == radiusUser && !r.Pass && r.Answered
+	})
+
+	after := counters(t, dut)
+	if after.GetAccessAccepts() <= before.GetAccessAccepts() {
+		t.Errorf("RADIUS access-accepts: got %d, want > %d", after.GetAccessAccepts(), before.GetAccessAccepts())
+	}
+	if after.GetAccessRejects() <= before.GetAccessRejects() {
+		t.Errorf("RADIUS access-rejects: got %d, want > %d", after.GetAccessRejects(), before.GetAccessRejects())
+	}
+}
+
+// TestAccounting verifies that the DUT accounts the start and the stop of the
+// SSH logins of the users of the RADIUS server.
+func TestAccounting(t *testing.T) {
+	if *sshAddr == "" {
+		t.Skip("No SSH server of the DUT given by -ssh_addr")
+	}
+	s := startServer(t)
+	dut := ondatra.DUT(t, "dut")
+	defer configureAAA(t, dut, s.Port(), *radiusSecret)()
+
+	client, err := ssh.Dial("tcp", *sshAddr, &ssh.ClientConfig{
+		User:            radiusUser,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         rpcTimeout,
+	})
+	if err != nil {
+		t.Fatalf("SSH login of %s to %s failed: %v", radiusUser, *sshAddr, err)
+	}
+	start := await(t, s, "the accounting start of "+radiusUser, func(r *radius.Record) bool {
+		return r.Code == radius.AccountingRequest && r.User == radiusUser && r.StatusType == radius.Start && r.Authentic
+	})
+	client.Close()
+	await(t, s, "the accounting stop of "+radiusUser, func(r *radius.Record) bool {
+		return r.Code == radius.AccountingRequest && r.User == radiusUser && r.StatusType == radius.Stop && r.SessionID == start.SessionID && r.Authentic
+	})
+}
+
+// TestSecretMismatch verifies that the users of the RADIUS server are not
+// authenticated when the DUT does not share its secret.
+func TestSecretMismatch(t *testing.T) {
+	s := startServer(t)
+	dut := ondatra.DUT(t, "dut")
+	defer configureAAA(t, dut, s.Port(), wrongSecret)()
+
+	wantCode(t, "gNMI Get with a mismatched secret", gnmiGet(t, dut, radiusUser, password), codes.Unauthenticated)
+	// The server discards the requests whose Message-Authenticator does not
+	// verify, and rejects the others, whose password does not decode.
+	await(t, s, "the Access-Request of "+radiusUser, func(r *radius.Record) bool {
+		return r.Code == radius.AccessRequest && r.User == radiusUser
+	})
+	if recs := s.Records(func(r *radius.Record) bool { return r.Pass }); len(recs) > 0 {
+		t.Errorf("RADIUS server passed requests with a mismatched secret: %v", recs)
+	}
+}
+
+// TestServerTimeout verifies that the DUT retransmits its requests to a RADIUS
+// server which does not respond, counts their timeouts, and falls back to
+// local users.
+func TestServerTimeout(t *testing.T) {
+	s := startServer(t)
+	dut := ondatra.DUT(t, "dut")
+	defer configureAAA(t, dut, s.Port(), *radiusSecret)()
+	createLocalUser(t, dut)
+	before := counters(t, dut)
+
+	s.SetSilent(true)
+	if err := gnmiGet(t, dut, localUser, password); err != nil {
+		t.Errorf("gNMI Get of %s with the server timing out failed, want fallback to local: %v", localUser, err)
+	}
+	if got, want := len(s.Records(func(r *radius.Record) bool { return r.User == localUser })), 1+retransmitAttempts; got < want {
+		t.Errorf("RADIUS server received %d Access-Requests of %s, want >= %d with retransmissions", got, localUser, want)
+	}
+	wantCode(t, "gNMI Get of a user of the server timing out", gnmiGet(t, dut, radiusUser, password), codes.Unauthenticated)
+
+	after := counters(t, dut)
+	if after.GetTimeoutAccessRequests() <= before.GetTimeoutAccessRequests() {
+		t.Errorf("RADIUS timeout-access-requests: got %d, want > %d", after.GetTimeoutAccessRequests(), before.GetTimeoutAccessRequests())
+	}
+	if after.GetRetriedAccessRequests() <= before.GetRetriedAccessRequests() {
+		t.Errorf("RADIUS retried-access-requests: got %d, want > %d", after.GetRetriedAccessRequests(), before.GetRetriedAccessRequests())
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aaa_tacacs_test
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/tacacs"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	"golang.org/x/crypto/ssh"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// The TACACS+ server runs on the test host, or in a container, which the DUT
+// reaches through its management network.
+var (
+	tacacsListen = flag.String("tacacs_listen", ":4949",
+		"TCP address on which the TACACS+ server listens")
+	tacacsHost = flag.String("tacacs_host", "",
+		"address of the TACACS+ server reachable by the DUT; the test is skipped when empty")
+	tacacsKey = flag.String("tacacs_key", "fp-tacacs-key", "TACACS+ secret key")
+	gnmiAddr  = flag.String("gnmi_addr", "",
+		"host:port of the gNMI server of the DUT accepting username and password metadata; if empty the DUT name and port 9339 are used")
+	sshAddr = flag.String("ssh_addr", "",
+		"host:port of the SSH server of the DUT; command authorization and accounting are skipped when empty")
+)
+
+const (
+	serverGroup = "fp-tacacs-e2e"
+	// adminUser may run any command, and operatorUser only showCommand.
+	// Both are users of the TACACS+ server, and localUser a local user of
+	// the DUT.
+	adminUser      = "fp-tacacs-admin"
+	operatorUser   = "fp-tacacs-operator"
+	localUser      = "fp-local"
+	password       = "fp-Passw0rd!"
+	wrongPassword  = "fp-Wr0ng!"
+	showCommand    = "show version"
+	deniedCommand  = "show running-config"
+	tacacsTimeout  = 5
+	rpcTimeout     = time.Minute
+	requestTimeout = 30 * time.Second
+)
+
+var users = map[string]tacacs.User{
+	adminUser:    {Password: password, PrivLvl: 15},
+	operatorUser: {Password: password, PrivLvl: 1, Commands: []string{showCommand}},
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// startServer starts the TACACS+ server, and stops it at the end of the test.
+func startServer(t *testing.T) *tacacs.Server {
+	t.Helper()
+	if *tacacsHost == "" {
+		t.Skip("No TACACS+ server address given by -tacacs_host")
+	}
+	s, err := tacacs.Listen(*tacacsListen, *tacacsKey, users)
+	if err != nil {
+		t.Fatalf("Cannot start TACACS+ server: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// configureAAA configures the TACACS+ server on port followed by local as the
+// authentication and command authorization methods, and the TACACS+ server
+// as the accounting method of logins and commands. It returns a function
+// restoring the previous methods.
+func configureAAA(t *testing.T, dut *ondatra.DUTDevice, port uint16) func() {
+	t.Helper()
+	aaa := gnmi.OC().System().Aaa()
+	prevAuthn := gnmi.Lookup(t, dut, aaa.Authentication().AuthenticationMethod().Config())
+	prevAuthz := gnmi.Lookup(t, dut, aaa.Authorization().Config())
+	prevAcct := gnmi.Lookup(t, dut, aaa.Accounting().Config())
+
+	sg := &oc.System_Aaa_ServerGroup{
+		Name: ygot.String(serverGroup),
+		Type: oc.AaaTypes_AAA_SERVER_TYPE_TACACS,
+	}
+	s := sg.GetOrCreateServer(*tacacsHost)
+	s.Timeout = ygot.Uint16(tacacsTimeout)
+	s.GetOrCreateTacacs().Port = ygot.Uint16(port)
+	s.GetOrCreateTacacs().SecretKey = ygot.String(*tacacsKey)
+	gnmi.Replace(t, dut, aaa.ServerGroup(serverGroup).Config(), sg)
+
+	gnmi.Replace(t, dut, aaa.Authentication().AuthenticationMethod().Config(), []oc.System_Aaa_Authentication_AuthenticationMethod_Union{
+		oc.UnionString(serverGroup), oc.AaaTypes_AAA_METHOD_TYPE_LOCAL,
+	})
+	authz := &oc.System_Aaa_Authorization{
+		AuthorizationMethod: []oc.System_Aaa_Authorization_AuthorizationMethod_Union{
+			oc.UnionString(serverGroup), oc.AaaTypes_AAA_METHOD_TYPE_LOCAL,
+		},
+	}
+	authz.GetOrCreateEvent(oc.AaaTypes_AAA_AUTHORIZATION_EVENT_TYPE_AAA_AUTHORIZATION_EVENT_COMMAND)
+	gnmi.Replace(t, dut, aaa.Authorization().Config(), authz)
+	acct := &oc.System_Aaa_Accounting{
+		AccountingMethod: []oc.System_Aaa_Accounting_AccountingMethod_Union{oc.UnionString(serverGroup)},
+	}
+	acct.GetOrCreateEvent(oc.AaaTypes_AAA_ACCOUNTING_EVENT_TYPE_AAA_ACCOUNTING_EVENT_LOGIN).Record = oc.Event_Record_START_STOP
+	acct.GetOrCreateEvent(oc.AaaTypes_AAA_ACCOUNTING_EVENT_TYPE_AAA_ACCOUNTING_EVENT_COMMAND).Record = oc.Event_Record_STOP
+	gnmi.Replace(t, dut, aaa.Accounting().Config(), acct)
+
+	return func() {
+		if v, ok := prevAuthn.Val(); ok {
+			gnmi.Replace(t, dut, aaa.Authentication().AuthenticationMethod().Config(), v)
+		} else {
+			gnmi.Delete(t, dut, aaa.Authentication().AuthenticationMethod().Config())
+		}
+		if v, ok := prevAuthz.Val(); ok {
+			gnmi.Replace(t, dut, aaa.Authorization().Config(), v)
+		} else {
+			gnmi.Delete(t, dut, aaa.Authorization().Config())
+		}
+		if v, ok := prevAcct.Val(); ok {
+			gnmi.Replace(t, dut, aaa.Accounting().Config(), v)
+		} else {
+			gnmi.Delete(t, dut, aaa.Accounting().Config())
+		}
+		gnmi.Delete(t, dut, aaa.ServerGroup(serverGroup).Config())
+	}
+}
+
+// createLocalUser configures the local user of the DUT, and deletes it at the
+// end of the test.
+func createLocalUser(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	path := gnmi.OC().System().Aaa().Authentication().User(localUser)
+	gnmi.Replace(t, dut, path.Config(), &oc.System_Aaa_Authentication_User{
+		Username: ygot.String(localUser),
+		Password: ygot.String(password),
+		Role:     oc.AaaTypes_SYSTEM_DEFINED_ROLES_SYSTEM_ROLE_ADMIN,
+	})
+	t.Cleanup(func() { gnmi.Delete(t, dut, path.Config()) })
+}
+
+// gnmiGet reads the hostname of the DUT with gNMI as user.
+func gnmiGet(t *testing.T, dut *ondatra.DUTDevice, user, password string) error {
+	t.Helper()
+	addr := *gnmiAddr
+	if addr == "" {
+		addr = net.JoinHostPort(dut.Name(), "9339")
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		InsecureSkipVerify: true, // NOLINT
+	})))
+	if err != nil {
+		t.Fatalf("grpc.Dial(%q): %v", addr, err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "username", user, "password", password)
+	_, err = gpb.NewGNMIClient(conn).Get(ctx, &gpb.GetRequest{
+		Path:     []*gpb.Path{{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "hostname"}}}},
+		Type:     gpb.GetRequest_STATE,
+		Encoding: gpb.Encoding_JSON_IETF,
+	})
+	return err
+}
+
+// sshRun runs cmd in an SSH session of user on the DUT, and returns its
+// output.
+func sshRun(t *testing.T, user, cmd string) (string, error) {
+	t.Helper()
+	if *sshAddr == "" {
+		t.Skip("No SSH server of the DUT given by -ssh_addr")
+	}
+	client, err := ssh.Dial("tcp", *sshAddr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         rpcTimeout,
+	})
+	if err != nil {
+		t.Fatalf("SSH login of %s to %s failed: %v", user, *sshAddr, err)
+	}
+	defer client.Close()
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("SSH session of %s failed: %v", user, err)
+	}
+	defer sess.Close()
+	out, err := sess.CombinedOutput(cmd)
+	return string(out), err
+}
+
+// await waits for the TACACS+ server s to record a request which matches.
+func await(t *testing.T, s *tacacs.Server, desc string, match func(*tacacs.Record) bool) *tacacs.Record {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	r, err := s.Await(ctx, match)
+	if err != nil {
+		t.Fatalf("TACACS+ server did not receive %s within %v: %v\nReceived requests: %v", desc, requestTimeout, err, s.Records(nil))
+	}
+	t.Logf("TACACS+ server received %v", r)
+	return r
+}
+
+func wantCode(t *testing.T, op string, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("%s: got code %v, want %v (error: %v)", op, got, want, err)
+	}
+}
+
+// TestAuthentication verifies that the DUT authenticates the users of the
+// TACACS+ server with it, and does not fall back to local users while the
+// server is alive.
+func TestAuthentication(t *testing.T) {
+	s := startServer(t)
+	dut := ondatra.DUT(t, "dut")
+	defer configureAAA(t, dut, s.Port())()
+	createLocalUser(t, dut)
+
+	if err := gnmiGet(t, dut, adminUser, password); err != nil {
+		t.Errorf("gNMI Get of %s failed: %v", adminUser, err)
+	}
+	await(t, s, "the authentication of "+adminUser, func(r *tacacs.Record) bool {
+		return r.Type == tacacs.Authentication && r.User == adminUser && r.Pass
+	})
+
+	wantCode(t, "gNMI Get with a wrong password", gnmiGet(t, dut, adminUser, wrongPassword), codes.Unauthenticated)
+	await(t, s, "the failed authentication of "+adminUser, func(r *tacacs.Record) bool {
+		return r.Type == tacacs.Authentication && r.User == adminUser && !r.Pass
+	})
+
+	// The server rejects the local user, so the DUT must not try the local
+	// method.
+	wantCode(t, "gNMI Get of the local user with the server alive", gnmiGet(t, dut, localUser, password), codes.Unauthenticated)
+}
+
+// TestCommandAuthorization verifies that the DUT authorizes the commands of
+// SSH sessions with the TACACS+ server.
+func TestCommandAuthorization(t *testing.T) {
+	s := startServer(t)
+	dut := ondatra.DUT(t, "dut")
+	defer configureAAA(t, dut, s.Port())()
+
+	out, err := sshRun(t, operatorUser, showCommand)
+	if err != nil || out == "" {
+		t.Errorf("%q of %s: got output %q and error %v, want output", showCommand, operatorUser, out, err)
+	}
+	await(t, s, "the authorization of "+showCommand, func(r *tacacs.Record) bool {
+		return r.Type == tacacs.Authorization && r.User == operatorUser && r.Command() == showCommand && r.Pass
+	})
+
+	out, err = sshRun(t, operatorUser, deniedCommand)
+	t.Logf("%q of %s: output %q, error %v", deniedCommand, operatorUser, out, err)
+	await(t, s, "the denied authorization of "+deniedCommand, func(r *tacacs.Record) bool {
+		return r.Type == tacacs.Authorization && r.User == operatorUser && r.Command() == deniedCommand && !r.Pass
+	})
+}
+
+// TestAccounting verifies that the DUT accounts the logins and commands of SSH
+// sessions to the TACACS+ server.
+func TestAccounting(t *testing.T) {
+	s := startServer(t)
+	dut := ondatra.DUT(t, "dut")
+	defer configureAAA(t, dut, s.Port())()
+
+	if _, err := sshRun(t, adminUser, showCommand); err != nil {
+		t.Errorf("%q of %s failed: %v", showCommand, adminUser, err)
+	}
+	await(t, s, "the accounting of the login of "+adminUser, func(r *tacacs.Record) bool {
+		return r.Type == tacacs.Accounting && r.User == adminUser && r.Flags&tacacs.Start != 0
+	})
+	await(t, s, "the accounting of "+showCommand, func(r *tacacs.Record) bool {
+		return r.Type == tacacs.Accounting && r.User == adminUser && r.Command() == showCommand && r.Flags&tacacs.Stop != 0
+	})
+	await(t, s, "the accounting of the logout of "+adminUser, func(r *tacacs.Record) bool {
+		return r.Type == tacacs.Accounting && r.User == adminUser && r.Command() == "" && r.Flags&tacacs.Stop != 0
+	})
+}
+
+// TestServerDeadFallback verifies that the DUT falls back to local users when
+// the TACACS+ server is dead.
+func TestServerDeadFallback(t *testing.T) {
+	s := startServer(t)
+	dut := ondatra.DUT(t, "dut")
+	defer configureAAA(t, dut, s.Port())()
+	createLocalUser(t, dut)
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Cannot stop TACACS+ server: %v", err)
+	}
+	if err := gnmiGet(t, dut, localUser, password); err != nil {
+		t.Errorf("gNMI Get of %s with the server dead failed, want fallback to local: %v", localUser, err)
+	}
+	wantCode(t, "gNMI Get of a user of the dead server", gnmiGet(t, dut, adminUser, password), codes.Unauthenticated)
+}
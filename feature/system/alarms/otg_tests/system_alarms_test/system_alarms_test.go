@@ -0,0 +1,293 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system_alarms_test
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+)
+
+// A threshold breach is induced by vendor CLI lowering a threshold, such as
+// a temperature threshold, below the current value of its sensor.
+var (
+	thresholdCLI = flag.String("threshold_cli", "",
+		"CLI configuration applied with gNMI Set to breach a threshold of the DUT; the threshold breach is not verified if empty")
+	thresholdRestoreCLI = flag.String("threshold_restore_cli", "",
+		"CLI configuration applied with gNMI Set to restore the threshold breached by -threshold_cli")
+	thresholdResource = flag.String("threshold_resource", "",
+		"substring of the resource of the alarm raised by -threshold_cli, such as the name of the sensor component")
+	thresholdSeverity = flag.String("threshold_severity", "MINOR",
+		"severity of the alarm raised by -threshold_cli: WARNING, MINOR, MAJOR or CRITICAL")
+)
+
+const (
+	ipv4PrefixLen = 30
+	ipv6PrefixLen = 126
+	// alarmTimeout is the time allowed for an alarm to be raised or cleared.
+	alarmTimeout = 2 * time.Minute
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::1",
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::2",
+		IPv6Len: ipv6PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::5",
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::6",
+		IPv6Len: ipv6PrefixLen,
+	}
+)
+
+// serviceAffecting are the severities of the alarm of a condition which takes
+// a port out of service.
+var serviceAffecting = []oc.E_AlarmTypes_OPENCONFIG_ALARM_SEVERITY{
+	oc.AlarmTypes_OPENCONFIG_ALARM_SEVERITY_MAJOR,
+	oc.AlarmTypes_OPENCONFIG_ALARM_SEVERITY_CRITICAL,
+}
+
+// severities are the severities of alarms by name.
+var severities = map[string]oc.E_AlarmTypes_OPENCONFIG_ALARM_SEVERITY{
+	"WARNING":  oc.AlarmTypes_OPENCONFIG_ALARM_SEVERITY_WARNING,
+	"MINOR":    oc.AlarmTypes_OPENCONFIG_ALARM_SEVERITY_MINOR,
+	"MAJOR":    oc.AlarmTypes_OPENCONFIG_ALARM_SEVERITY_MAJOR,
+	"CRITICAL": oc.AlarmTypes_OPENCONFIG_ALARM_SEVERITY_CRITICAL,
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	d := gnmi.OC()
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+	gnmi.Replace(t, dut, d.Interface(p1.Name()).Config(), dutPort1.NewOCInterface(p1.Name(), dut))
+	gnmi.Replace(t, dut, d.Interface(p2.Name()).Config(), dutPort2.NewOCInterface(p2.Name(), dut))
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, p1)
+		fptest.SetPortSpeed(t, p2)
+	}
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+		fptest.AssignToNetworkInstance(t, dut, p2.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+}
+
+// dutTime returns the current time of dut, so that the time-created of alarms
+// is compared with the clock of the DUT.
+func dutTime(t *testing.T, dut *ondatra.DUTDevice) time.Time {
+	t.Helper()
+	now := gnmi.Get(t, dut, gnmi.OC().System().CurrentDatetime().State())
+	got, err := time.Parse(time.RFC3339Nano, now)
+	if err != nil {
+		t.Fatalf("Cannot parse current-datetime %q: %v", now, err)
+	}
+	return got
+}
+
+// alarmIDs returns the IDs of the alarms present on dut.
+func alarmIDs(t *testing.T, dut *ondatra.DUTDevice) map[string]bool {
+	t.Helper()
+	ids := map[string]bool{}
+	for _, a := range gnmi.GetAll(t, dut, gnmi.OC().System().AlarmAny().State()) {
+		ids[a.GetId()] = true
+	}
+	return ids
+}
+
+// portResource returns a function matching the alarms whose resource is the
+// interface of port of dut, or its transceiver.
+func portResource(t *testing.T, dut *ondatra.DUTDevice, port string) func(*oc.System_Alarm) bool {
+	t.Helper()
+	name := dut.Port(t, port).Name()
+	transceiver, _ := gnmi.Lookup(t, dut, gnmi.OC().Interface(name).Transceiver().State()).Val()
+	return func(a *oc.System_Alarm) bool {
+		r := a.GetResource()
+		return strings.Contains(r, name) || (transceiver != "" && r == transceiver)
+	}
+}
+
+// verifyAlarm induces a condition by calling induce, and verifies that an
+// alarm matched by match is raised with one of the severities of want, then
+// that it is cleared after calling resolve.
+func verifyAlarm(t *testing.T, dut *ondatra.DUTDevice, match func(*oc.System_Alarm) bool, want []oc.E_AlarmTypes_OPENCONFIG_ALARM_SEVERITY, induce, resolve func()) {
+	t.Helper()
+	existing := alarmIDs(t, dut)
+	start := dutTime(t, dut)
+	induce()
+	resolved := false
+	defer func() {
+		if !resolved {
+			resolve()
+		}
+	}()
+
+	var alarm *oc.System_Alarm
+	_, ok := gnmi.WatchAll(t, dut, gnmi.OC().System().AlarmAny().State(), alarmTimeout, func(v *ygnmi.Value[*oc.System_Alarm]) bool {
+		a, present := v.Val()
+		if present && !existing[a.GetId()] && match(a) {
+			alarm = a
+			return true
+		}
+		return false
+	}).Await(t)
+	if !ok {
+		t.Fatalf("No alarm raised within %v; alarms: %v", alarmTimeout, gnmi.GetAll(t, dut, gnmi.OC().System().AlarmAny().State()))
+	}
+	raised := dutTime(t, dut)
+	t.Logf("Alarm %q raised on %q with severity %v: %s", alarm.GetId(), alarm.GetResource(), alarm.GetSeverity(), alarm.GetText())
+
+	validSeverity := false
+	for _, s := range want {
+		validSeverity = validSeverity || alarm.GetSeverity() == s
+	}
+	if !validSeverity {
+		t.Errorf("Alarm %q severity: got %v, want one of %v", alarm.GetId(), alarm.GetSeverity(), want)
+	}
+	// The time-created is in nanoseconds, and the current-datetime in
+	// seconds.
+	created := time.Unix(0, int64(alarm.GetTimeCreated()))
+	if created.Before(start.Truncate(time.Second)) || created.After(raised.Add(time.Second)) {
+		t.Errorf("Alarm %q time-created: got %v, want between %v and %v", alarm.GetId(), created, start, raised)
+	}
+	if alarm.GetText() == "" {
+		t.Errorf("Alarm %q has no text", alarm.GetId())
+	}
+	if alarm.GetTypeId() == nil {
+		t.Errorf("Alarm %q has no type-id", alarm.GetId())
+	}
+
+	resolve()
+	resolved = true
+	_, ok = gnmi.Watch(t, dut, gnmi.OC().System().Alarm(alarm.GetId()).State(), alarmTimeout, func(v *ygnmi.Value[*oc.System_Alarm]) bool {
+		return !v.IsPresent()
+	}).Await(t)
+	if !ok {
+		t.Errorf("Alarm %q not cleared within %v of the resolution of its condition", alarm.GetId(), alarmTimeout)
+	}
+}
+
+// setATELink sets the link state of port of ate.
+func setATELink(t *testing.T, ate *ondatra.ATEDevice, port string, state gosnappi.StatePortLinkStateEnum) {
+	t.Helper()
+	cs := gosnappi.NewControlState()
+	cs.Port().Link().SetPortNames([]string{ate.Port(t, port).ID()}).SetState(state)
+	ate.OTG().SetControlState(t, cs)
+}
+
+// TestAlarms induces alarm conditions on the DUT, and verifies that alarms
+// are raised and cleared for them.
+//
+// telemetry_path:/system/alarms/alarm/state/id
+// telemetry_path:/system/alarms/alarm/state/resource
+// telemetry_path:/system/alarms/alarm/state/severity
+// telemetry_path:/system/alarms/alarm/state/text
+// telemetry_path:/system/alarms/alarm/state/time-created
+// telemetry_path:/system/alarms/alarm/state/type-id
+func TestAlarms(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	configureDUT(t, dut)
+
+	top := gosnappi.NewConfig()
+	atePort1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	atePort2.AddToOTG(top, ate.Port(t, "port2"), &dutPort2)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	defer ate.OTG().StopProtocols(t)
+	for _, p := range []string{"port1", "port2"} {
+		gnmi.Await(t, dut, gnmi.OC().Interface(dut.Port(t, p).Name()).OperStatus().State(), time.Minute, oc.Interface_OperStatus_UP)
+	}
+
+	t.Run("LossOfSignal", func(t *testing.T) {
+		if deviations.ATEPortLinkStateOperationsUnsupported(ate) {
+			t.Skip("Link state of the ATE ports cannot be set")
+		}
+		verifyAlarm(t, dut, portResource(t, dut, "port1"), serviceAffecting,
+			func() { setATELink(t, ate, "port1", gosnappi.StatePortLinkState.DOWN) },
+			func() { setATELink(t, ate, "port1", gosnappi.StatePortLinkState.UP) })
+	})
+
+	t.Run("TransceiverDisabled", func(t *testing.T) {
+		name := dut.Port(t, "port2").Name()
+		transceiver, ok := gnmi.Lookup(t, dut, gnmi.OC().Interface(name).Transceiver().State()).Val()
+		if !ok {
+			t.Skipf("Interface %s has no transceiver", name)
+		}
+		enabled := gnmi.OC().Component(transceiver).Transceiver().Enabled().Config()
+		verifyAlarm(t, dut, portResource(t, dut, "port2"), serviceAffecting,
+			func() { gnmi.Update(t, dut, enabled, false) },
+			func() { gnmi.Update(t, dut, enabled, true) })
+	})
+
+	t.Run("ThresholdBreach", func(t *testing.T) {
+		if *thresholdCLI == "" {
+			t.Skip("No threshold breach given by -threshold_cli")
+		}
+		severity, ok := severities[*thresholdSeverity]
+		if !ok {
+			t.Fatalf("Invalid -threshold_severity %q", *thresholdSeverity)
+		}
+		push := func(cli string) {
+			clihelper.Push(t, dut, &clihelper.Config{
+				Reason: "threshold of the DUT",
+				CLI:    map[ondatra.Vendor]string{dut.Vendor(): cli},
+			})
+		}
+		verifyAlarm(t, dut, func(a *oc.System_Alarm) bool { return strings.Contains(a.GetResource(), *thresholdResource) },
+			[]oc.E_AlarmTypes_OPENCONFIG_ALARM_SEVERITY{severity},
+			func() { push(*thresholdCLI) },
+			func() {
+				if *thresholdRestoreCLI != "" {
+					push(*thresholdRestoreCLI)
+				}
+			})
+	})
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootz_secure_ztp_test
+
+import (
+	"context"
+	"flag"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+
+	frpb "github.com/openconfig/gnoi/factory_reset"
+	certzpb "github.com/openconfig/gnsi/certz"
+)
+
+var (
+	bootzServerBinary = flag.String("bootz_server_binary", "", "path to the bootz server emulator binary")
+	bootzConfig       = flag.String("bootz_config", "", "path to the bootz server config textproto holding the DUT inventory")
+	bootzDHCPConfig   = flag.String("bootz_dhcp_config", "", "optional path to the DHCP config textproto served by the bootz server")
+	bootzServerAddr   = flag.String("bootz_server_addr", "", "host:port the bootz server listens on, as set in --bootz_config")
+	bootzHostname     = flag.String("bootz_hostname", "", "hostname set by the bootz initial configuration, not checked if empty")
+	bootzTimeout      = flag.Duration("bootz_timeout", 45*time.Minute, "time allowed for the DUT to complete bootz after a factory reset")
+)
+
+const (
+	serverStartTimeout = time.Minute
+	bannerMarker       = "featureprofiles bootz marker"
+)
+
+// failedStatus are the bootz statuses from which the DUT does not recover
+// without a new bootstrap.
+var failedStatus = map[oc.E_Bootz_Status]bool{
+	oc.Bootz_Status_BOOTZ_OV_INVALID:            true,
+	oc.Bootz_Status_BOOTZ_OS_INVALID_IMAGE:      true,
+	oc.Bootz_Status_BOOTZ_CONFIGURATION_INVALID: true,
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// startBootzServer runs the bootz server emulator for the duration of the
+// test and waits for it to accept connections.
+func startBootzServer(t *testing.T) {
+	t.Helper()
+	if *bootzServerBinary == "" || *bootzConfig == "" || *bootzServerAddr == "" {
+		t.Skip("--bootz_server_binary, --bootz_config and --bootz_server_addr are required")
+	}
+	args := []string{"--config_file", *bootzConfig, "--alsologtostderr"}
+	if *bootzDHCPConfig != "" {
+		args = append(args, "--dhcp_file", *bootzDHCPConfig)
+	}
+	logFile, err := os.Create(filepath.Join(t.TempDir(), "bootz_server.log"))
+	if err != nil {
+		t.Fatalf("Failed to create bootz server log: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, *bootzServerBinary, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		cancel()
+		t.Fatalf("Failed to start bootz server %s: %v", *bootzServerBinary, err)
+	}
+	t.Logf("Started bootz server %s %v, logging to %s", *bootzServerBinary, args, logFile.Name())
+	t.Cleanup(func() {
+		cancel()
+		cmd.Wait()
+		logFile.Close()
+		if t.Failed() {
+			if log, err := os.ReadFile(logFile.Name()); err == nil {
+				t.Logf("bootz server log:\n%s", log)
+			}
+		}
+	})
+
+	deadline := time.Now().Add(serverStartTimeout)
+	for {
+		conn, err := net.DialTimeout("tcp", *bootzServerAddr, time.Second)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bootz server not listening on %s after %v: %v", *bootzServerAddr, serverStartTimeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// factoryReset starts a factory reset of the DUT, which then boots into
+// bootz mode.
+func factoryReset(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	resp, err := dut.RawAPIs().GNOI(t).FactoryReset().Start(context.Background(), &frpb.StartRequest{})
+	if err != nil {
+		// The DUT may drop the connection before replying once the reset starts.
+		t.Logf("FactoryReset.Start returned error, assuming the reset is in progress: %v", err)
+		return
+	}
+	if resetErr := resp.GetResetError(); resetErr != nil {
+		t.Fatalf("FactoryReset.Start failed: %v", resetErr)
+	}
+}
+
+// awaitBootzOK waits for the DUT to report a successful bootz attempted after
+// since, and fails the test as soon as it reports a failed one. The status of
+// an attempt made before since, which the DUT may still report while the
+// factory reset is starting, is ignored.
+func awaitBootzOK(t *testing.T, dut *ondatra.DUTDevice, since time.Time, timeout time.Duration) {
+	t.Helper()
+	var last oc.E_Bootz_Status
+	watch := gnmi.Watch(t, dut, gnmi.OC().System().Bootz().State(), timeout, func(val *ygnmi.Value[*oc.System_Bootz]) bool {
+		bootz, present := val.Val()
+		if !present || time.Unix(0, int64(bootz.GetLastBootAttempt())).Before(since) {
+			return false
+		}
+		if status := bootz.GetStatus(); status != last {
+			t.Logf("bootz status: %v", status)
+			last = status
+		}
+		return last == oc.Bootz_Status_BOOTZ_OK || failedStatus[last]
+	})
+	if _, ok := watch.Await(t); !ok {
+		t.Fatalf("bootz status: got %v after %v, want %v attempted after %v", last, timeout, oc.Bootz_Status_BOOTZ_OK, since)
+	}
+	if last != oc.Bootz_Status_BOOTZ_OK {
+		t.Fatalf("bootz status: got %v, want %v", last, oc.Bootz_Status_BOOTZ_OK)
+	}
+}
+
+func TestSecureBootstrap(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	startBootzServer(t)
+
+	version := gnmi.Get(t, dut, gnmi.OC().System().SoftwareVersion().State())
+	var errorCount uint64
+	if v, ok := gnmi.Lookup(t, dut, gnmi.OC().System().Bootz().ErrorCount().State()).Val(); ok {
+		errorCount = v
+	}
+	t.Logf("DUT %s software version %q, bootz error-count %d", dut.Name(), version, errorCount)
+
+	resetTime := time.Now()
+	factoryReset(t, dut)
+	fptest.WaitForGNMIReachable(t, dut, *bootzTimeout)
+	awaitBootzOK(t, dut, resetTime, *bootzTimeout-time.Since(resetTime))
+	t.Logf("DUT %s completed bootz after %v", dut.Name(), time.Since(resetTime))
+
+	t.Run("Telemetry", func(t *testing.T) {
+		bootz := gnmi.Get(t, dut, gnmi.OC().System().Bootz().State())
+		if got := time.Unix(0, int64(bootz.GetLastBootAttempt())); got.Before(resetTime) {
+			t.Errorf("bootz last-boot-attempt: got %v, want after %v", got, resetTime)
+		}
+		if got := bootz.GetErrorCount(); got > errorCount {
+			t.Errorf("bootz error-count: got %d, want %d", got, errorCount)
+		}
+		if bootz.GetChecksum() == "" {
+			t.Errorf("bootz checksum: got empty, want the checksum of the bootstrap data")
+		}
+	})
+
+	t.Run("DeviceState", func(t *testing.T) {
+		if got := gnmi.Get(t, dut, gnmi.OC().System().SoftwareVersion().State()); got != version {
+			t.Errorf("Software version: got %q, want %q", got, version)
+		}
+		if *bootzHostname != "" {
+			if got := gnmi.Get(t, dut, gnmi.OC().System().Hostname().State()); got != *bootzHostname {
+				t.Errorf("Hostname: got %q, want %q", got, *bootzHostname)
+			}
+		}
+	})
+
+	t.Run("Certificates", func(t *testing.T) {
+		resp, err := dut.RawAPIs().GNSI(t).Certz().GetProfileList(context.Background(), &certzpb.GetProfileListRequest{})
+		if err != nil {
+			t.Fatalf("Certz.GetProfileList: %v", err)
+		}
+		if len(resp.GetSslProfileIds()) == 0 {
+			t.Errorf("Certz.GetProfileList: got no SSL profiles, want the profiles installed by bootz")
+		}
+	})
+
+	t.Run("Manageable", func(t *testing.T) {
+		banner := gnmi.OC().System().LoginBanner()
+		gnmi.Replace(t, dut, banner.Config(), bannerMarker)
+		if got := gnmi.Get(t, dut, banner.State()); got != bannerMarker {
+			t.Errorf("Login banner: got %q, want %q", got, bannerMarker)
+		}
+		gnmi.Delete(t, dut, banner.Config())
+	})
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns_resolver_test
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	spb "github.com/openconfig/gnoi/system"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+)
+
+// The ATE does not emulate DNS servers, so resolution is verified against
+// the DNS servers of the testbed.
+var (
+	dnsServers = flag.String("dns_servers", "",
+		"comma separated addresses of the DNS servers of the testbed; resolution is skipped when empty")
+	dnsSearch = flag.String("dns_search", "",
+		"comma separated search domains of the testbed, in one of which -dns_hostname is resolved")
+	dnsHostname = flag.String("dns_hostname", "",
+		"unqualified hostname, resolved in one of -dns_search and answering ping, which the DUT pings")
+)
+
+const (
+	// pingCount is the number of echo requests sent to a hostname.
+	pingCount = 3
+
+	// unresolvable is a hostname which no DNS server resolves, by RFC 6761.
+	unresolvable = "featureprofiles.invalid"
+)
+
+// dnsServer is a DNS server of the DUT.
+type dnsServer struct {
+	address string
+	port    uint16
+}
+
+// defaultServers and defaultSearch are configured when the DNS servers and
+// search domains of the testbed are not given. They include a server on a
+// port other than 53.
+var (
+	defaultServers = []dnsServer{
+		{address: "192.0.2.53", port: 53},
+		{address: "2001:db8::53", port: 53},
+		{address: "192.0.2.54", port: 5353},
+	}
+	defaultSearch = []string{"example.com", "example.net"}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// splitList splits the comma separated list s.
+func splitList(s string) []string {
+	var l []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
+// testbedDNS returns the DNS servers and search domains given by the flags,
+// or the default ones.
+func testbedDNS() ([]dnsServer, []string) {
+	servers, search := defaultServers, defaultSearch
+	if addrs := splitList(*dnsServers); len(addrs) > 0 {
+		servers = nil
+		for _, a := range addrs {
+			servers = append(servers, dnsServer{address: a, port: 53})
+		}
+	}
+	if s := splitList(*dnsSearch); len(s) > 0 {
+		search = s
+	}
+	return servers, search
+}
+
+// configureDNS replaces the DNS configuration of dut with servers, in order
+// of preference, and search.
+func configureDNS(t *testing.T, dut *ondatra.DUTDevice, servers []dnsServer, search []string) {
+	t.Helper()
+	d := &oc.Root{}
+	dns := d.GetOrCreateSystem().GetOrCreateDns()
+	dns.SetSearch(search)
+	for _, s := range servers {
+		srv, err := dns.AppendNewServer(s.address)
+		if err != nil {
+			t.Fatalf("Cannot append DNS server %s: %v", s.address, err)
+		}
+		srv.SetPort(s.port)
+	}
+	gnmi.Replace(t, dut, gnmi.OC().System().Dns().Config(), dns)
+}
+
+// ping pings host from dut, and returns the responses, or the error of the
+// Ping RPC.
+func ping(t *testing.T, dut *ondatra.DUTDevice, host string) ([]*spb.PingResponse, error) {
+	t.Helper()
+	client, err := dut.RawAPIs().GNOI(t).System().Ping(context.Background(), &spb.PingRequest{
+		Destination: host,
+		Count:       pingCount,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var resps []*spb.PingResponse
+	for {
+		resp, err := client.Recv()
+		switch {
+		case err == io.EOF:
+			return resps, nil
+		case err != nil:
+			return resps, err
+		default:
+			resps = append(resps, resp)
+		}
+	}
+}
+
+// TestDNSConfig verifies that the DNS servers, in order of preference, and
+// the search domains reported by the DUT match its configuration.
+func TestDNSConfig(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	servers, search := testbedDNS()
+	configureDNS(t, dut, servers, search)
+
+	dns := gnmi.Get(t, dut, gnmi.OC().System().Dns().State())
+	if diff := cmp.Diff(search, dns.GetSearch()); diff != "" {
+		t.Errorf("DNS search domains (-want +got):\n%s", diff)
+	}
+	var want, got []string
+	for _, s := range servers {
+		want = append(want, s.address)
+	}
+	if dns.Server != nil {
+		got = dns.Server.Keys()
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DNS servers (-want +got):\n%s", diff)
+	}
+	for _, s := range servers {
+		srv := dns.GetServer(s.address)
+		if srv == nil {
+			continue
+		}
+		if got := srv.GetPort(); got != s.port {
+			t.Errorf("DNS server %s port: got %d, want %d", s.address, got, s.port)
+		}
+	}
+}
+
+// TestPingHostname verifies that the DUT resolves -dns_hostname in its search
+// domains for gNOI Ping, and that it fails to ping a hostname which does not
+// resolve.
+func TestPingHostname(t *testing.T) {
+	if *dnsServers == "" || *dnsHostname == "" {
+		t.Skip("No DNS servers given by -dns_servers, or no hostname given by -dns_hostname")
+	}
+	dut := ondatra.DUT(t, "dut")
+	servers, search := testbedDNS()
+	configureDNS(t, dut, servers, search)
+
+	t.Run("Resolvable", func(t *testing.T) {
+		resps, err := ping(t, dut, *dnsHostname)
+		if err != nil {
+			t.Fatalf("Ping of %s failed: %v", *dnsHostname, err)
+		}
+		var replies int
+		for _, r := range resps {
+			if r.GetSequence() == 0 {
+				// The summary of the ping.
+				if got := r.GetReceived(); got == 0 {
+					t.Errorf("Ping of %s received replies: got 0, want > 0", *dnsHostname)
+				}
+				continue
+			}
+			replies++
+			// The source of the replies is the resolved address of the hostname.
+			if _, err := netip.ParseAddr(r.GetSource()); err != nil {
+				t.Errorf("Ping of %s reply source: got %q, want the resolved IP address", *dnsHostname, r.GetSource())
+			}
+		}
+		if replies == 0 {
+			t.Errorf("Ping of %s replies: got 0, want > 0", *dnsHostname)
+		}
+	})
+
+	t.Run("Unresolvable", func(t *testing.T) {
+		resps, err := ping(t, dut, unresolvable)
+		if err != nil {
+			t.Logf("Ping of %s failed as expected: %v", unresolvable, err)
+			return
+		}
+		for _, r := range resps {
+			if r.GetSequence() == 0 && r.GetReceived() > 0 {
+				t.Errorf("Ping of %s received replies: got %d, want 0", unresolvable, r.GetReceived())
+			}
+		}
+	})
+}
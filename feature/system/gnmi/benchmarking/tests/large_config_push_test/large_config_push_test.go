@@ -0,0 +1,252 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package large_config_push_test
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+var (
+	sizes = flag.String("sizes", "10/10/100,100/100/1000,500/250/5000",
+		"comma separated sizes of the pushed configurations, each as interfaces/neighbors/acl_entries")
+	convergeTimeout = flag.Duration("converge_timeout", 10*time.Minute,
+		"time allowed for the state to converge after a configuration is pushed")
+)
+
+const (
+	// firstLoopback is the index of the first generated loopback interface.
+	firstLoopback = 100
+	dutAS         = 64500
+	peerAS        = 64501
+	bgpName       = "BGP"
+	aclName       = "fp-benchmark"
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// size is the size of a pushed configuration.
+type size struct {
+	Interfaces int `json:"interfaces"`
+	Neighbors  int `json:"neighbors"`
+	ACLEntries int `json:"acl_entries"`
+}
+
+func (s size) String() string {
+	return fmt.Sprintf("%d/%d/%d", s.Interfaces, s.Neighbors, s.ACLEntries)
+}
+
+// result is the measurement of a configuration push.
+type result struct {
+	size
+	SetMillis      int64 `json:"set_ms"`
+	ConvergeMillis int64 `json:"converge_ms"`
+	DeleteMillis   int64 `json:"delete_ms"`
+}
+
+// parseSizes parses the sizes of the -sizes flag.
+func parseSizes(s string) ([]size, error) {
+	var ss []size
+	for _, f := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(f), "/")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("size %q is not interfaces/neighbors/acl_entries", f)
+		}
+		var n [3]int
+		for i, p := range parts {
+			v, err := strconv.Atoi(p)
+			if err != nil || v < 1 {
+				return nil, fmt.Errorf("size %q: %q is not a positive number", f, p)
+			}
+			n[i] = v
+		}
+		ss = append(ss, size{Interfaces: n[0], Neighbors: n[1], ACLEntries: n[2]})
+	}
+	return ss, nil
+}
+
+// addr returns the i-th address of the /16 network with the first two octets
+// prefix, e.g. "198.18".
+func addr(prefix string, i int) string {
+	return fmt.Sprintf("%s.%d.%d", prefix, i/254, i%254+1)
+}
+
+// config is a generated configuration.
+type config struct {
+	interfaces []*oc.Interface
+	bgp        *oc.NetworkInstance_Protocol
+	acl        *oc.Acl_AclSet
+}
+
+// generate generates a configuration of size s.
+func generate(t *testing.T, dut *ondatra.DUTDevice, s size) *config {
+	c := &config{}
+	for i := 0; i < s.Interfaces; i++ {
+		name := netutil.LoopbackInterface(t, dut, firstLoopback+i)
+		intf := &oc.Interface{
+			Name:        ygot.String(name),
+			Type:        oc.IETFInterfaces_InterfaceType_softwareLoopback,
+			Description: ygot.String(fmt.Sprintf("benchmark %d", i)),
+		}
+		intf.GetOrCreateSubinterface(0).GetOrCreateIpv4().GetOrCreateAddress(addr("198.18", i)).PrefixLength = ygot.Uint8(32)
+		c.interfaces = append(c.interfaces, intf)
+	}
+
+	c.bgp = &oc.NetworkInstance_Protocol{
+		Identifier: oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP,
+		Name:       ygot.String(bgpName),
+	}
+	bgp := c.bgp.GetOrCreateBgp()
+	bgp.GetOrCreateGlobal().As = ygot.Uint32(dutAS)
+	bgp.GetOrCreateGlobal().RouterId = ygot.String(addr("198.18", 0))
+	for i := 0; i < s.Neighbors; i++ {
+		nbr := bgp.GetOrCreateNeighbor(addr("198.19", i))
+		nbr.PeerAs = ygot.Uint32(peerAS)
+		nbr.Enabled = ygot.Bool(true)
+		nbr.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST).Enabled = ygot.Bool(true)
+	}
+
+	c.acl = &oc.Acl_AclSet{Name: ygot.String(aclName), Type: oc.Acl_ACL_TYPE_ACL_IPV4}
+	for i := 0; i < s.ACLEntries; i++ {
+		seq := uint32(10 * (i + 1))
+		e := c.acl.GetOrCreateAclEntry(seq)
+		e.GetOrCreateIpv4().SourceAddress = ygot.String(addr("198.19", i) + "/32")
+		e.GetOrCreateActions().ForwardingAction = oc.Acl_FORWARDING_ACTION_ACCEPT
+	}
+	return c
+}
+
+// push pushes the configuration c with one SetRequest.
+func (c *config) push(t *testing.T, dut *ondatra.DUTDevice) {
+	ni := deviations.DefaultNetworkInstance(dut)
+	b := &gnmi.SetBatch{}
+	for _, intf := range c.interfaces {
+		gnmi.BatchReplace(b, gnmi.OC().Interface(intf.GetName()).Config(), intf)
+	}
+	gnmi.BatchReplace(b, gnmi.OC().NetworkInstance(ni).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).Config(), c.bgp)
+	gnmi.BatchReplace(b, gnmi.OC().Acl().AclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4).Config(), c.acl)
+	b.Set(t, dut)
+}
+
+// delete deletes the configuration c with one SetRequest.
+func (c *config) delete(t *testing.T, dut *ondatra.DUTDevice) {
+	ni := deviations.DefaultNetworkInstance(dut)
+	b := &gnmi.SetBatch{}
+	for _, intf := range c.interfaces {
+		gnmi.BatchDelete(b, gnmi.OC().Interface(intf.GetName()).Config())
+	}
+	gnmi.BatchDelete(b, gnmi.OC().NetworkInstance(ni).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).Config())
+	gnmi.BatchDelete(b, gnmi.OC().Acl().AclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4).Config())
+	b.Set(t, dut)
+}
+
+// awaitState waits until the state of the last interface and of the neighbor
+// with the highest address of c are present, and the state of the ACL set has
+// all the entries.
+func (c *config) awaitState(t *testing.T, dut *ondatra.DUTDevice, deadline time.Time) {
+	t.Helper()
+	ni := deviations.DefaultNetworkInstance(dut)
+	last := c.interfaces[len(c.interfaces)-1]
+	gnmi.Await(t, dut, gnmi.OC().Interface(last.GetName()).Description().State(), time.Until(deadline), last.GetDescription())
+
+	var lastNbr string // The highest address, as a string.
+	for a := range c.bgp.GetBgp().Neighbor {
+		if lastNbr == "" || a > lastNbr {
+			lastNbr = a
+		}
+	}
+	nbrPath := gnmi.OC().NetworkInstance(ni).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).Bgp().Neighbor(lastNbr)
+	gnmi.Await(t, dut, nbrPath.NeighborAddress().State(), time.Until(deadline), lastNbr)
+
+	want := len(c.acl.AclEntry)
+	_, ok := gnmi.Watch(t, dut, gnmi.OC().Acl().AclSet(aclName, oc.Acl_ACL_TYPE_ACL_IPV4).State(), time.Until(deadline), func(v *ygnmi.Value[*oc.Acl_AclSet]) bool {
+		s, ok := v.Val()
+		return ok && len(s.AclEntry) == want
+	}).Await(t)
+	if !ok {
+		t.Fatalf("State of ACL set %s does not have %d entries by the deadline", aclName, want)
+	}
+}
+
+// writeResults writes the results as CSV and JSON test outputs.
+func writeResults(t *testing.T, results []*result) {
+	csv := []string{"interfaces,neighbors,acl_entries,set_ms,converge_ms,delete_ms"}
+	for _, r := range results {
+		csv = append(csv, fmt.Sprintf("%d,%d,%d,%d,%d,%d", r.Interfaces, r.Neighbors, r.ACLEntries, r.SetMillis, r.ConvergeMillis, r.DeleteMillis))
+	}
+	if _, err := fptest.WriteOutput("config_push_benchmark", ".csv", strings.Join(csv, "\n")+"\n"); err != nil {
+		t.Errorf("Cannot write the CSV results: %v", err)
+	}
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		t.Fatalf("Cannot encode the results: %v", err)
+	}
+	if _, err := fptest.WriteOutput("config_push_benchmark", ".json", string(b)); err != nil {
+		t.Errorf("Cannot write the JSON results: %v", err)
+	}
+}
+
+func TestLargeConfigPush(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ss, err := parseSizes(*sizes)
+	if err != nil {
+		t.Fatalf("Invalid -sizes: %v", err)
+	}
+
+	var results []*result
+	defer func() { writeResults(t, results) }()
+	for _, s := range ss {
+		t.Run(s.String(), func(t *testing.T) {
+			c := generate(t, dut, s)
+			r := &result{size: s}
+
+			start := time.Now()
+			c.push(t, dut)
+			deleted := false
+			defer func() {
+				if !deleted {
+					c.delete(t, dut)
+				}
+			}()
+			r.SetMillis = time.Since(start).Milliseconds()
+			c.awaitState(t, dut, start.Add(*convergeTimeout))
+			r.ConvergeMillis = time.Since(start).Milliseconds()
+
+			start = time.Now()
+			c.delete(t, dut)
+			deleted = true
+			r.DeleteMillis = time.Since(start).Milliseconds()
+
+			t.Logf("Size %v: Set %dms, convergence %dms, delete %dms", s, r.SetMillis, r.ConvergeMillis, r.DeleteMillis)
+			results = append(results, r)
+		})
+	}
+}
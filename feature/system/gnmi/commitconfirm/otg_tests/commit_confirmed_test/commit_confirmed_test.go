@@ -0,0 +1,157 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commit_confirmed_test
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/commitconfirm"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	rollbackDuration = flag.Duration("rollback_duration", time.Minute, "rollback duration of the commits")
+	rollbackMargin   = flag.Duration("rollback_margin", 30*time.Second, "time allowed after the rollback duration for the rollback to complete")
+)
+
+// The testbed consists of ate:port1 -> dut:port1.
+const (
+	ipv4PrefixLen = 30
+	timeout       = time.Minute
+	// cancelDuration is the rollback duration of the cancelled commit, which
+	// is long enough to tell a cancel from an expired commit.
+	cancelDuration = 10 * time.Minute
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// leafUpdate returns a SetRequest which updates the config leaf of q to val.
+func leafUpdate(t *testing.T, q ygnmi.PathStruct, val *gpb.TypedValue) *gpb.SetRequest {
+	t.Helper()
+	p, _, err := ygnmi.ResolvePath(q)
+	if err != nil {
+		t.Fatalf("Cannot resolve path: %v", err)
+	}
+	return &gpb.SetRequest{Update: []*gpb.Update{{Path: p, Val: val}}}
+}
+
+// commit sends req with the Commit extension of s, and skips the test if the
+// DUT does not support the extension.
+func commit(t *testing.T, dut *ondatra.DUTDevice, req *gpb.SetRequest, s *commitconfirm.Spec) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err := commitconfirm.Set(ctx, dut.RawAPIs().GNMI(t), req, s)
+	if status.Code(err) == codes.Unimplemented {
+		t.Skipf("Commit action %v is not supported: %v", s.Action, err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Commit %s with action %v succeeded", s.ID, s.Action)
+}
+
+// verifyConnectivity verifies that DUT port1 is up and that the ATE resolves
+// the DUT with ARP.
+func verifyConnectivity(t *testing.T, dut *ondatra.DUTDevice, ate *ondatra.ATEDevice, top gosnappi.Config, wait time.Duration) {
+	t.Helper()
+	p1 := dut.Port(t, "port1")
+	gnmi.Await(t, dut, gnmi.OC().Interface(p1.Name()).OperStatus().State(), wait, oc.Interface_OperStatus_UP)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+}
+
+func TestCommitConfirmed(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+	p1 := dut.Port(t, "port1")
+	intfPath := gnmi.OC().Interface(p1.Name())
+
+	gnmi.Replace(t, dut, intfPath.Config(), dutPort1.NewOCInterface(p1.Name(), dut))
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, p1.Name(), deviations.DefaultNetworkInstance(dut), 0)
+	}
+	top := gosnappi.NewConfig()
+	atePort1.AddToOTG(top, ate.Port(t, "port1"), &dutPort1)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	verifyConnectivity(t, dut, ate, top, timeout)
+
+	t.Run("AutoRollback", func(t *testing.T) {
+		req := leafUpdate(t, intfPath.Enabled().Config().PathStruct(), &gpb.TypedValue{Value: &gpb.TypedValue_BoolVal{BoolVal: false}})
+		commit(t, dut, req, &commitconfirm.Spec{ID: "fp-auto-rollback", Action: commitconfirm.Commit, RollbackDuration: *rollbackDuration})
+		start := time.Now()
+		gnmi.Await(t, dut, intfPath.OperStatus().State(), timeout, oc.Interface_OperStatus_DOWN)
+
+		wait := *rollbackDuration + *rollbackMargin - time.Since(start)
+		gnmi.Await(t, dut, intfPath.Enabled().State(), wait, true)
+		t.Logf("DUT port1 enabled again %v after the commit", time.Since(start))
+		verifyConnectivity(t, dut, ate, top, *rollbackMargin)
+	})
+
+	t.Run("Confirm", func(t *testing.T) {
+		const desc = "commit confirmed"
+		req := leafUpdate(t, intfPath.Description().Config().PathStruct(), &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: desc}})
+		commit(t, dut, req, &commitconfirm.Spec{ID: "fp-confirm", Action: commitconfirm.Commit, RollbackDuration: *rollbackDuration})
+		gnmi.Await(t, dut, intfPath.Description().State(), timeout, desc)
+		commit(t, dut, nil, &commitconfirm.Spec{ID: "fp-confirm", Action: commitconfirm.Confirm})
+
+		time.Sleep(*rollbackDuration + *rollbackMargin)
+		if got := gnmi.Get(t, dut, intfPath.Description().State()); got != desc {
+			t.Errorf("Description after the rollback duration of the confirmed commit: got %q, want %q", got, desc)
+		}
+		verifyConnectivity(t, dut, ate, top, timeout)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		before := gnmi.Get(t, dut, intfPath.Description().State())
+		const desc = "commit cancelled"
+		req := leafUpdate(t, intfPath.Description().Config().PathStruct(), &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: desc}})
+		commit(t, dut, req, &commitconfirm.Spec{ID: "fp-cancel", Action: commitconfirm.Commit, RollbackDuration: cancelDuration})
+		gnmi.Await(t, dut, intfPath.Description().State(), timeout, desc)
+		commit(t, dut, nil, &commitconfirm.Spec{ID: "fp-cancel", Action: commitconfirm.Cancel})
+		gnmi.Await(t, dut, intfPath.Description().State(), timeout, before)
+	})
+}
@@ -0,0 +1,282 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replace_root_baseline_test
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+)
+
+var (
+	pruneComponents = flag.Bool("prune_components", true,
+		"prune components that are not ports from the baseline. Use this to preserve the breakout-mode config.")
+	pruneQoS    = flag.Bool("prune_qos", true, "prune QoS config from the baseline")
+	ignorePaths = flag.String("ignore_paths", "",
+		"comma separated list of path prefixes whose differences from the pushed intent are documented deviations of the DUT")
+	convergeTimeout = flag.Duration("converge_timeout", 3*time.Minute,
+		"time allowed for the ports to come up and the BGP sessions to be established after the replace")
+)
+
+// The testbed consists of ate:port1 -> dut:port1 and dut:port2 -> ate:port2.
+// The DUT has an eBGP session with each ATE port.
+const (
+	ipv4PrefixLen = 30
+	dutAS         = 64500
+	ateAS1        = 64501
+	ateAS2        = 64502
+	bgpName       = "BGP"
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// getBaseline gets the full config of the DUT and prunes it enough so that it
+// can be pushed again with a replace at the root.
+func getBaseline(t *testing.T, dut *ondatra.DUTDevice) *oc.Root {
+	t.Helper()
+	config := gnmi.Get[*oc.Root](t, dut, gnmi.OC().Config())
+	fptest.WriteQuery(t, "Baseline", gnmi.OC().Config(), config)
+
+	if *pruneComponents {
+		for cname, component := range config.Component {
+			if component.GetPort() == nil {
+				delete(config.Component, cname)
+				continue
+			}
+			component.Subcomponent = nil
+		}
+	}
+	if *pruneQoS {
+		config.Qos = nil
+	}
+	for _, ni := range config.NetworkInstance {
+		ni.Fdb = nil
+	}
+	return config
+}
+
+// buildIntent returns a copy of baseline with port1 and port2 and eBGP to the
+// ATE ports configured.
+func buildIntent(t *testing.T, dut *ondatra.DUTDevice, baseline *oc.Root) *oc.Root {
+	t.Helper()
+	c, err := ygot.DeepCopy(baseline)
+	if err != nil {
+		t.Fatalf("Cannot copy the baseline: %v", err)
+	}
+	intent := c.(*oc.Root)
+
+	p1 := dut.Port(t, "port1")
+	p2 := dut.Port(t, "port2")
+	for _, p := range []struct {
+		port  *ondatra.Port
+		attrs attrs.Attributes
+	}{{p1, dutPort1}, {p2, dutPort2}} {
+		intent.DeleteInterface(p.port.Name())
+		if err := intent.AppendInterface(p.attrs.NewOCInterface(p.port.Name(), dut)); err != nil {
+			t.Fatalf("Cannot add %s to the intent: %v", p.port.Name(), err)
+		}
+	}
+
+	ni := intent.GetOrCreateNetworkInstance(deviations.DefaultNetworkInstance(dut))
+	ni.Type = oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_DEFAULT_INSTANCE
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		for _, p := range []*ondatra.Port{p1, p2} {
+			id := p.Name() + ".0"
+			niIntf := ni.GetOrCreateInterface(id)
+			niIntf.Interface = ygot.String(p.Name())
+			niIntf.Subinterface = ygot.Uint32(0)
+		}
+	}
+	ni.DeleteProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName)
+	bgp := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).GetOrCreateBgp()
+	global := bgp.GetOrCreateGlobal()
+	global.As = ygot.Uint32(dutAS)
+	global.RouterId = ygot.String(dutPort1.IPv4)
+	global.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST).Enabled = ygot.Bool(true)
+	for _, n := range []struct {
+		addr string
+		as   uint32
+	}{{atePort1.IPv4, ateAS1}, {atePort2.IPv4, ateAS2}} {
+		nbr := bgp.GetOrCreateNeighbor(n.addr)
+		nbr.PeerAs = ygot.Uint32(n.as)
+		nbr.Enabled = ygot.Bool(true)
+		nbr.GetOrCreateAfiSafi(oc.BgpTypes_AFI_SAFI_TYPE_IPV4_UNICAST).Enabled = ygot.Bool(true)
+	}
+	return intent
+}
+
+// configureATE configures port1 and port2 on the ATE with an eBGP session to
+// the DUT each.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	for _, p := range []struct {
+		id       string
+		ate, dut *attrs.Attributes
+		as       uint32
+	}{{"port1", &atePort1, &dutPort1, ateAS1}, {"port2", &atePort2, &dutPort2, ateAS2}} {
+		dev := p.ate.AddToOTG(top, ate.Port(t, p.id), p.dut)
+		ipv4 := dev.Ethernets().Items()[0].Ipv4Addresses().Items()[0]
+		peer := dev.Bgp().SetRouterId(p.ate.IPv4).Ipv4Interfaces().Add().SetIpv4Name(ipv4.Name()).Peers().Add().SetName(p.ate.Name + ".BGP4.peer")
+		peer.SetPeerAddress(p.dut.IPv4).SetAsNumber(p.as).SetAsType(gosnappi.BgpV4PeerAsType.EBGP)
+	}
+	return top
+}
+
+// awaitConvergence waits for the ports to be up and the BGP sessions to be
+// established, and returns the time it took.
+func awaitConvergence(t *testing.T, dut *ondatra.DUTDevice, start time.Time) time.Duration {
+	t.Helper()
+	for _, p := range []string{"port1", "port2"} {
+		name := dut.Port(t, p).Name()
+		gnmi.Await(t, dut, gnmi.OC().Interface(name).OperStatus().State(), *convergeTimeout, oc.Interface_OperStatus_UP)
+	}
+	bgp := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_BGP, bgpName).Bgp()
+	for _, nbr := range []string{atePort1.IPv4, atePort2.IPv4} {
+		_, ok := gnmi.Watch(t, dut, bgp.Neighbor(nbr).SessionState().State(), *convergeTimeout, func(val *ygnmi.Value[oc.E_Bgp_Neighbor_SessionState]) bool {
+			state, ok := val.Val()
+			return ok && state == oc.Bgp_Neighbor_SessionState_ESTABLISHED
+		}).Await(t)
+		if !ok {
+			t.Fatalf("BGP session with %s not established within %v of the replace", nbr, *convergeTimeout)
+		}
+	}
+	return time.Since(start)
+}
+
+// ignored reports whether p is below one of the ignored path prefixes.
+func ignored(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyIntent checks that every leaf of intent is present in got with the
+// same value, except the documented deviations. Leaves present only in got
+// are defaults or config added by the DUT, and are not reported.
+func verifyIntent(t *testing.T, intent, got *oc.Root) {
+	t.Helper()
+	var prefixes []string
+	if *ignorePaths != "" {
+		prefixes = strings.Split(*ignorePaths, ",")
+	}
+	diff, err := ygot.Diff(intent, got, &ygot.IgnoreAdditions{})
+	if err != nil {
+		t.Fatalf("Cannot diff the intent and the config of the DUT: %v", err)
+	}
+	for _, d := range diff.GetDelete() {
+		p, err := ygot.PathToString(d)
+		if err != nil {
+			t.Errorf("Cannot convert path %v to string: %v", d, err)
+			continue
+		}
+		if ignored(p, prefixes) {
+			t.Logf("Ignoring missing leaf %s", p)
+			continue
+		}
+		t.Errorf("Leaf %s of the intent is missing from the config of the DUT", p)
+	}
+	for _, u := range diff.GetUpdate() {
+		p, err := ygot.PathToString(u.GetPath())
+		if err != nil {
+			t.Errorf("Cannot convert path %v to string: %v", u.GetPath(), err)
+			continue
+		}
+		if ignored(p, prefixes) {
+			t.Logf("Ignoring changed leaf %s = %v", p, u.GetVal())
+			continue
+		}
+		t.Errorf("Leaf %s of the config of the DUT is %v, which differs from the intent", p, u.GetVal())
+	}
+}
+
+func TestReplaceRootBaseline(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	baseline := getBaseline(t, dut)
+	defer func() {
+		t.Log("Restoring the baseline")
+		gnmi.Replace(t, dut, gnmi.OC().Config(), baseline)
+	}()
+
+	top := configureATE(t, ate)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	defer ate.OTG().StopProtocols(t)
+
+	intent := buildIntent(t, dut, baseline)
+	fptest.WriteQuery(t, "Intent", gnmi.OC().Config(), intent)
+
+	t.Run("Replace", func(t *testing.T) {
+		start := time.Now()
+		gnmi.Replace(t, dut, gnmi.OC().Config(), intent)
+		t.Logf("Replace at the root took %v", time.Since(start))
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dut.Port(t, "port1"))
+			fptest.SetPortSpeed(t, dut.Port(t, "port2"))
+		}
+		t.Logf("DUT converged %v after the replace", awaitConvergence(t, dut, start))
+		otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		got := gnmi.Get[*oc.Root](t, dut, gnmi.OC().Config())
+		fptest.WriteQuery(t, "AfterReplace", gnmi.OC().Config(), got)
+		verifyIntent(t, intent, got)
+	})
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnmi_delete_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+const (
+	addrA   = "198.51.100.1"
+	prefixA = "198.51.100.0/24"
+	addrB   = "203.0.113.1"
+	prefixB = "203.0.113.0/24"
+	plen    = 24
+
+	timeout = time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// getPresent reports whether a gNMI Get of data type typ returns a non-empty
+// value at the path of q.
+func getPresent(t *testing.T, dut *ondatra.DUTDevice, q ygnmi.PathStruct, typ gpb.GetRequest_DataType) bool {
+	t.Helper()
+	p, _, err := ygnmi.ResolvePath(q)
+	if err != nil {
+		t.Fatalf("Cannot resolve path: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	resp, err := dut.RawAPIs().GNMI(t).Get(ctx, &gpb.GetRequest{Path: []*gpb.Path{p}, Type: typ, Encoding: gpb.Encoding_JSON_IETF})
+	if status.Code(err) == codes.NotFound {
+		return false
+	}
+	if err != nil {
+		t.Fatalf("gNMI Get of %v: %v", p, err)
+	}
+	for _, n := range resp.GetNotification() {
+		for _, u := range n.GetUpdate() {
+			switch string(u.GetVal().GetJsonIetfVal()) {
+			case "", "{}", "null", "[]":
+			default:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// awaitAbsent waits until the state of q is absent from the subscription, and
+// then verifies that it is absent from a gNMI Get of the state.
+func awaitAbsent[T any](t *testing.T, dut *ondatra.DUTDevice, q ygnmi.SingletonQuery[T]) {
+	t.Helper()
+	_, ok := gnmi.Watch(t, dut, q, timeout, func(v *ygnmi.Value[T]) bool { return !v.IsPresent() }).Await(t)
+	if !ok {
+		t.Errorf("State %v is still present after %v", q.PathStruct(), timeout)
+	}
+	if getPresent(t, dut, q.PathStruct(), gpb.GetRequest_STATE) {
+		t.Errorf("gNMI Get of the state of %v: got present, want absent", q.PathStruct())
+	}
+}
+
+// verifyConfigAbsent verifies that the config of q is absent from a
+// subscription and a gNMI Get.
+func verifyConfigAbsent[T any](t *testing.T, dut *ondatra.DUTDevice, q ygnmi.ConfigQuery[T]) {
+	t.Helper()
+	if v := gnmi.LookupConfig(t, dut, q); v.IsPresent() {
+		t.Errorf("Subscription to the config of %v: got present, want absent", q.PathStruct())
+	}
+	if getPresent(t, dut, q.PathStruct(), gpb.GetRequest_CONFIG) {
+		t.Errorf("gNMI Get of the config of %v: got present, want absent", q.PathStruct())
+	}
+}
+
+func TestDelete(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ni := deviations.DefaultNetworkInstance(dut)
+	lb := netutil.LoopbackInterface(t, dut, 13)
+	intfPath := gnmi.OC().Interface(lb)
+	ipv4Path := intfPath.Subinterface(0).Ipv4()
+	afts := gnmi.OC().NetworkInstance(ni).Afts()
+
+	intf := &oc.Interface{
+		Name:        ygot.String(lb),
+		Type:        oc.IETFInterfaces_InterfaceType_softwareLoopback,
+		Description: ygot.String("delete test"),
+		Enabled:     ygot.Bool(false),
+	}
+	ipv4 := intf.GetOrCreateSubinterface(0).GetOrCreateIpv4()
+	for _, a := range []string{addrA, addrB} {
+		ipv4.GetOrCreateAddress(a).PrefixLength = ygot.Uint8(plen)
+	}
+	gnmi.Replace(t, dut, intfPath.Config(), intf)
+	defer gnmi.Delete(t, dut, intfPath.Config())
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, lb, ni, 0)
+		defer gnmi.Delete(t, dut, gnmi.OC().NetworkInstance(ni).Interface(lb+".0").Config())
+	}
+	gnmi.Await(t, dut, intfPath.Description().State(), timeout, "delete test")
+	for _, prefix := range []string{prefixA, prefixB} {
+		_, ok := gnmi.Watch(t, dut, afts.Ipv4Entry(prefix).State(), timeout, func(v *ygnmi.Value[*oc.NetworkInstance_Afts_Ipv4Entry]) bool { return v.IsPresent() }).Await(t)
+		if !ok {
+			t.Fatalf("Connected route %s is not in the AFT of %s after %v", prefix, ni, timeout)
+		}
+	}
+
+	t.Run("Leaf", func(t *testing.T) {
+		gnmi.Delete(t, dut, intfPath.Description().Config())
+		verifyConfigAbsent(t, dut, intfPath.Description().Config())
+		awaitAbsent(t, dut, intfPath.Description().State())
+	})
+
+	t.Run("LeafWithDefault", func(t *testing.T) {
+		gnmi.Delete(t, dut, intfPath.Enabled().Config())
+		verifyConfigAbsent(t, dut, intfPath.Enabled().Config())
+		gnmi.Await(t, dut, intfPath.Enabled().State(), timeout, true)
+	})
+
+	t.Run("ListEntry", func(t *testing.T) {
+		gnmi.Delete(t, dut, ipv4Path.Address(addrA).Config())
+		verifyConfigAbsent(t, dut, ipv4Path.Address(addrA).Config())
+		awaitAbsent(t, dut, ipv4Path.Address(addrA).Ip().State())
+		awaitAbsent(t, dut, afts.Ipv4Entry(prefixA).State())
+
+		if got := gnmi.LookupConfig(t, dut, ipv4Path.Address(addrB).Ip().Config()); !got.IsPresent() {
+			t.Errorf("Address %s was removed from the config with %s", addrB, addrA)
+		}
+		if got := gnmi.Lookup(t, dut, afts.Ipv4Entry(prefixB).State()); !got.IsPresent() {
+			t.Errorf("Connected route %s was removed from the AFT with %s", prefixB, prefixA)
+		}
+	})
+
+	t.Run("Container", func(t *testing.T) {
+		gnmi.Delete(t, dut, ipv4Path.Config())
+		verifyConfigAbsent(t, dut, ipv4Path.Address(addrB).Config())
+		awaitAbsent(t, dut, ipv4Path.Address(addrB).Ip().State())
+		if got := gnmi.LookupAll(t, dut, ipv4Path.AddressAny().Ip().State()); len(got) > 0 {
+			t.Errorf("Addresses remain in the state after deleting the ipv4 container: %v", got)
+		}
+		awaitAbsent(t, dut, afts.Ipv4Entry(prefixB).State())
+	})
+
+	t.Run("Interface", func(t *testing.T) {
+		if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			gnmi.Delete(t, dut, gnmi.OC().NetworkInstance(ni).Interface(lb+".0").Config())
+		}
+		gnmi.Delete(t, dut, intfPath.Config())
+		verifyConfigAbsent(t, dut, intfPath.Config())
+	})
+}
@@ -0,0 +1,221 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnmi_set_atomic_test
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+const (
+	descBefore = "atomic before"
+	descAfter  = "atomic after"
+	addrBefore = "198.51.100.1"
+	addrNew    = "203.0.113.1"
+	addrExtra  = "192.0.2.1"
+	plen       = 24
+
+	timeout = time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// resolve returns the gNMI path of the path struct p.
+func resolve(t *testing.T, p ygnmi.PathStruct) *gpb.Path {
+	t.Helper()
+	gp, _, err := ygnmi.ResolvePath(p)
+	if err != nil {
+		t.Fatalf("Cannot resolve path: %v", err)
+	}
+	return gp
+}
+
+// jsonUpdate returns an update of path p with the JSON_IETF encoding of v,
+// which is a GoStruct or a scalar value.
+func jsonUpdate(t *testing.T, p *gpb.Path, v any) *gpb.Update {
+	t.Helper()
+	var b []byte
+	var err error
+	if gs, ok := v.(ygot.GoStruct); ok {
+		b, err = ygot.Marshal7951(gs, &ygot.RFC7951JSONConfig{AppendModuleName: true, PreferShadowPath: true})
+	} else {
+		b, err = json.Marshal(v)
+	}
+	if err != nil {
+		t.Fatalf("Cannot encode %v: %v", v, err)
+	}
+	return &gpb.Update{Path: p, Val: &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: b}}}
+}
+
+// subinterface returns subinterface 0 with the IPv4 addresses addrs.
+func subinterface(addrs ...string) *oc.Interface_Subinterface {
+	s := &oc.Interface_Subinterface{Index: ygot.Uint32(0)}
+	for _, a := range addrs {
+		s.GetOrCreateIpv4().GetOrCreateAddress(a).PrefixLength = ygot.Uint8(plen)
+	}
+	return s
+}
+
+// addresses returns the sorted IPv4 addresses of v.
+func addresses(v *ygnmi.Value[*oc.Interface_Subinterface_Ipv4]) []string {
+	ipv4, ok := v.Val()
+	if !ok {
+		return nil
+	}
+	var addrs []string
+	for a := range ipv4.Address {
+		addrs = append(addrs, a)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// verify verifies that the description and the IPv4 addresses of subinterface
+// 0 of interface name are desc and addrs, in the config and in the state.
+func verify(t *testing.T, dut *ondatra.DUTDevice, name, desc string, addrs ...string) {
+	t.Helper()
+	intfPath := gnmi.OC().Interface(name)
+	ipv4Path := intfPath.Subinterface(0).Ipv4()
+	sort.Strings(addrs)
+
+	if got := gnmi.Get(t, dut, intfPath.Description().Config()); got != desc {
+		t.Errorf("Config of description: got %q, want %q", got, desc)
+	}
+	if diff := cmp.Diff(addrs, addresses(gnmi.LookupConfig(t, dut, ipv4Path.Config()))); diff != "" {
+		t.Errorf("Config of the IPv4 addresses (-want +got):\n%s", diff)
+	}
+
+	gnmi.Await(t, dut, intfPath.Description().State(), timeout, desc)
+	_, ok := gnmi.Watch(t, dut, ipv4Path.State(), timeout, func(v *ygnmi.Value[*oc.Interface_Subinterface_Ipv4]) bool {
+		return cmp.Equal(addrs, addresses(v))
+	}).Await(t)
+	if !ok {
+		t.Errorf("State of the IPv4 addresses is not %v after %v", addrs, timeout)
+	}
+}
+
+func TestAtomicSet(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	lb := netutil.LoopbackInterface(t, dut, 14)
+	intfPath := gnmi.OC().Interface(lb)
+	subPath := intfPath.Subinterface(0)
+	defer gnmi.Delete(t, dut, intfPath.Config())
+
+	tests := []struct {
+		desc      string
+		req       func(t *testing.T) *gpb.SetRequest
+		wantErr   bool
+		wantDesc  string
+		wantAddrs []string
+	}{{
+		desc: "DeleteAndReAdd",
+		req: func(t *testing.T) *gpb.SetRequest {
+			return &gpb.SetRequest{
+				Delete:  []*gpb.Path{resolve(t, subPath.Config().PathStruct())},
+				Replace: []*gpb.Update{jsonUpdate(t, resolve(t, subPath.Config().PathStruct()), subinterface(addrNew))},
+			}
+		},
+		wantDesc:  descBefore,
+		wantAddrs: []string{addrNew},
+	}, {
+		desc: "OrderOfOperations",
+		req: func(t *testing.T) *gpb.SetRequest {
+			return &gpb.SetRequest{
+				Delete:  []*gpb.Path{resolve(t, intfPath.Description().Config().PathStruct())},
+				Replace: []*gpb.Update{jsonUpdate(t, resolve(t, subPath.Ipv4().Config().PathStruct()), subinterface(addrNew).GetIpv4())},
+				Update: []*gpb.Update{
+					jsonUpdate(t, resolve(t, intfPath.Description().Config().PathStruct()), descAfter),
+					jsonUpdate(t, resolve(t, subPath.Ipv4().Config().PathStruct()), subinterface(addrExtra).GetIpv4()),
+				},
+			}
+		},
+		wantDesc:  descAfter,
+		wantAddrs: []string{addrNew, addrExtra},
+	}, {
+		desc: "RollbackInvalidValue",
+		req: func(t *testing.T) *gpb.SetRequest {
+			return &gpb.SetRequest{
+				Replace: []*gpb.Update{jsonUpdate(t, resolve(t, subPath.Config().PathStruct()), subinterface(addrNew))},
+				Update: []*gpb.Update{
+					jsonUpdate(t, resolve(t, intfPath.Description().Config().PathStruct()), descAfter),
+					jsonUpdate(t, resolve(t, subPath.Ipv4().Address(addrNew).PrefixLength().Config().PathStruct()), 33),
+				},
+			}
+		},
+		wantErr:   true,
+		wantDesc:  descBefore,
+		wantAddrs: []string{addrBefore},
+	}, {
+		desc: "RollbackUnknownPath",
+		req: func(t *testing.T) *gpb.SetRequest {
+			unknown := resolve(t, intfPath.Config().PathStruct())
+			unknown.Elem = append(unknown.Elem, &gpb.PathElem{Name: "config"}, &gpb.PathElem{Name: "no-such-leaf"})
+			return &gpb.SetRequest{
+				Delete: []*gpb.Path{resolve(t, subPath.Ipv4().Address(addrBefore).Config().PathStruct())},
+				Update: []*gpb.Update{
+					jsonUpdate(t, resolve(t, intfPath.Description().Config().PathStruct()), descAfter),
+					jsonUpdate(t, unknown, "x"),
+				},
+			}
+		},
+		wantErr:   true,
+		wantDesc:  descBefore,
+		wantAddrs: []string{addrBefore},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			base := &oc.Interface{
+				Name:        ygot.String(lb),
+				Type:        oc.IETFInterfaces_InterfaceType_softwareLoopback,
+				Description: ygot.String(descBefore),
+			}
+			if err := base.AppendSubinterface(subinterface(addrBefore)); err != nil {
+				t.Fatalf("Cannot build the baseline config: %v", err)
+			}
+			gnmi.Replace(t, dut, intfPath.Config(), base)
+			verify(t, dut, lb, descBefore, addrBefore)
+
+			req := tt.req(t)
+			t.Logf("SetRequest:\n%s", req)
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			_, err := dut.RawAPIs().GNMI(t).Set(ctx, req)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("gNMI Set got error %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil {
+				t.Logf("gNMI Set failed as expected: %v", err)
+			}
+			verify(t, dut, lb, tt.wantDesc, tt.wantAddrs...)
+		})
+	}
+}
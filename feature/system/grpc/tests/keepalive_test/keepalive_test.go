@@ -0,0 +1,354 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keepalive_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/security/svid"
+	"github.com/openconfig/ondatra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	caCertPem = flag.String("ca_cert_pem", "../../../../security/gnsi/authz/tests/authz/testdata/ca.cert.pem",
+		"a pem file for a ca cert trusted by the DUT for client certificates, used to issue the client certificate")
+	caKeyPem = flag.String("ca_key_pem", "../../../../security/gnsi/authz/tests/authz/testdata/ca.key.pem",
+		"a pem file for the key of -ca_cert_pem")
+	spiffeID = flag.String("spiffe_id", "spiffe://test-abc.foo.bar/xyz/admin",
+		"SPIFFE ID of the client certificate")
+	gnmiAddr = flag.String("gnmi_addr", "",
+		"address of the gNMI server of the DUT reachable from the test host; if empty the DUT name is used")
+	gnmiPort = flag.Uint("gnmi_port", 9339,
+		"port of the gNMI server of the DUT")
+	keepaliveCLI = flag.String("grpc_keepalive_cli", "",
+		"optional CLI configuration applied with gNMI Set to configure the keepalive policy and the connection limit of the gRPC server; if empty they are expected to be preconfigured")
+	restoreCLI = flag.String("grpc_keepalive_restore_cli", "",
+		"optional CLI configuration applied with gNMI Set at the end of the test to restore the keepalive policy and the connection limit")
+	minPingInterval = flag.Duration("min_ping_interval", 5*time.Minute,
+		"minimum interval between the keepalive pings of a client permitted by the gRPC server; the default is the default of gRPC")
+	maxConnectionIdle = flag.Duration("max_connection_idle", 0,
+		"time after which the gRPC server closes a connection without RPCs; idle connection teardown is not verified if 0")
+	maxConnections = flag.Int("max_connections", 0,
+		"maximum number of concurrent connections accepted by the gRPC server, including the connections of ondatra; the connection limit is not verified if 0")
+	streamDuration = flag.Duration("stream_duration", 0,
+		"duration of the long-lived Subscribe stream; if 0 it lasts 4 keepalive intervals")
+)
+
+const (
+	dialTimeout = 20 * time.Second
+	// minClientPingInterval is the minimum keepalive interval of gRPC-Go
+	// clients.
+	minClientPingInterval = 10 * time.Second
+	// pingTimeout is the time the client waits for the ack of a ping.
+	pingTimeout = 20 * time.Second
+	// teardownMargin is the time allowed to the server beyond its timeouts
+	// to close a connection.
+	teardownMargin = time.Minute
+	// pingStrikes is the number of pings received too early after which a
+	// gRPC server closes the connection.
+	pingStrikes = 3
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// applyCLI applies CLI configuration of the keepalive policy and the
+// connection limit of the gRPC server.
+func applyCLI(t *testing.T, dut *ondatra.DUTDevice, config string) {
+	t.Helper()
+	clihelper.Push(t, dut, &clihelper.Config{
+		Reason: "keepalive policy and connection limit of the gRPC server",
+		CLI:    map[ondatra.Vendor]string{dut.Vendor(): config},
+	})
+}
+
+// configure applies -grpc_keepalive_cli if set, and -grpc_keepalive_restore_cli
+// at the end of the test if set.
+func configure(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	if *keepaliveCLI == "" {
+		return
+	}
+	applyCLI(t, dut, *keepaliveCLI)
+	if *restoreCLI != "" {
+		t.Cleanup(func() { applyCLI(t, dut, *restoreCLI) })
+	}
+}
+
+// clientCert returns a client certificate issued by the CA trusted by the DUT.
+func clientCert(t *testing.T) *tls.Certificate {
+	t.Helper()
+	caKey, caCert, err := svid.LoadKeyPair(*caKeyPem, *caCertPem)
+	if err != nil {
+		t.Fatalf("Could not load ca key/cert: %v", err)
+	}
+	client, err := svid.GenSVID("grpc-keepalive", *spiffeID, 1, caCert, caKey, x509.RSA)
+	if err != nil {
+		t.Fatalf("Could not generate client svid: %v", err)
+	}
+	return client
+}
+
+// dial returns a new connection to the gNMI server of dut, blocking until the
+// connection is established. If ping is not 0, the client sends keepalive
+// pings at this interval, even without RPCs.
+func dial(t *testing.T, dut *ondatra.DUTDevice, client *tls.Certificate, ping time.Duration) (*grpc.ClientConn, error) {
+	t.Helper()
+	addr := *gnmiAddr
+	if addr == "" {
+		addr = dut.Name()
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{*client}, InsecureSkipVerify: true})),
+		grpc.WithBlock(),
+	}
+	if ping != 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                ping,
+			Timeout:             pingTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, net.JoinHostPort(addr, strconv.Itoa(int(*gnmiPort))), opts...)
+	if err != nil {
+		return nil, err
+	}
+	// The server may accept the connection and close it at once, so issue an
+	// RPC to verify that the connection is usable.
+	if _, err := gpb.NewGNMIClient(conn).Capabilities(ctx, &gpb.CapabilityRequest{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// subscribe opens a Subscribe stream on conn for the updates of the hostname,
+// which rarely changes so that the stream is idle, and waits for its initial
+// sync.
+func subscribe(ctx context.Context, conn *grpc.ClientConn) (gpb.GNMI_SubscribeClient, error) {
+	stream, err := gpb.NewGNMIClient(conn).Subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&gpb.SubscribeRequest{
+		Request: &gpb.SubscribeRequest_Subscribe{
+			Subscribe: &gpb.SubscriptionList{
+				Prefix: &gpb.Path{Origin: "openconfig"},
+				Mode:   gpb.SubscriptionList_STREAM,
+				Subscription: []*gpb.Subscription{{
+					Path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "hostname"}}},
+					Mode: gpb.SubscriptionMode_ON_CHANGE,
+				}},
+			},
+		},
+	}); err != nil {
+		return nil, err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if resp.GetSyncResponse() {
+			return stream, nil
+		}
+	}
+}
+
+// recvUntilError receives from stream until it fails, and returns the
+// error. The error is codes.DeadlineExceeded if the context of the stream
+// expires first.
+func recvUntilError(stream gpb.GNMI_SubscribeClient) error {
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return err
+		}
+	}
+}
+
+// TestKeepaliveEnforcement verifies that the gRPC server closes the
+// connection of a client sending keepalive pings more often than permitted.
+func TestKeepaliveEnforcement(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configure(t, dut)
+	ping := *minPingInterval / 4
+	if ping < minClientPingInterval {
+		t.Skipf("-min_ping_interval %v is too short for pings at a quarter of it, which must be at least %v", *minPingInterval, minClientPingInterval)
+	}
+
+	conn, err := dial(t, dut, clientCert(t), ping)
+	if err != nil {
+		t.Fatalf("Cannot connect to the gNMI server: %v", err)
+	}
+	defer conn.Close()
+	// The server counts a strike for each early ping, and closes the
+	// connection when there are too many.
+	timeout := (pingStrikes+1)*ping + teardownMargin
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stream, err := subscribe(ctx, conn)
+	if err != nil {
+		t.Fatalf("Cannot subscribe: %v", err)
+	}
+
+	start := time.Now()
+	err = recvUntilError(stream)
+	if code := status.Code(err); code == codes.DeadlineExceeded {
+		t.Fatalf("Connection pinged every %v survived %v, want it closed by the server", ping, timeout)
+	}
+	t.Logf("Connection pinged every %v closed by the server after %v: %v", ping, time.Since(start), err)
+	if got := status.Code(err); got != codes.Unavailable {
+		t.Errorf("Subscribe error: got code %v, want %v", got, codes.Unavailable)
+	}
+}
+
+// TestLongLivedSubscribe verifies that a Subscribe stream, on a connection
+// pinged at the permitted keepalive interval, survives several intervals.
+func TestLongLivedSubscribe(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	configure(t, dut)
+	// Pings are sent a little later than permitted, as timers of the client
+	// and the server are not aligned.
+	ping := *minPingInterval + *minPingInterval/4
+	if ping < minClientPingInterval {
+		ping = minClientPingInterval
+	}
+	duration := *streamDuration
+	if duration == 0 {
+		duration = 4 * ping
+	}
+
+	conn, err := dial(t, dut, clientCert(t), ping)
+	if err != nil {
+		t.Fatalf("Cannot connect to the gNMI server: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	stream, err := subscribe(ctx, conn)
+	if err != nil {
+		t.Fatalf("Cannot subscribe: %v", err)
+	}
+
+	start := time.Now()
+	if err := recvUntilError(stream); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Subscribe stream pinged every %v failed after %v, want it to last %v: %v", ping, time.Since(start), duration, err)
+	}
+	if got := conn.GetState(); got != connectivity.Ready {
+		t.Errorf("Connection state after %v: got %v, want %v", duration, got, connectivity.Ready)
+	}
+}
+
+// TestIdleTeardown verifies that the gRPC server closes a connection without
+// RPCs once it has been idle for -max_connection_idle.
+func TestIdleTeardown(t *testing.T) {
+	if *maxConnectionIdle == 0 {
+		t.Skip("No idle timeout of the gRPC server given by -max_connection_idle")
+	}
+	dut := ondatra.DUT(t, "dut")
+	configure(t, dut)
+
+	// The connection is not pinged, so that it is idle after the RPC of
+	// dial.
+	conn, err := dial(t, dut, clientCert(t), 0)
+	if err != nil {
+		t.Fatalf("Cannot connect to the gNMI server: %v", err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	timeout := *maxConnectionIdle + teardownMargin
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if !conn.WaitForStateChange(ctx, connectivity.Ready) {
+		t.Fatalf("Idle connection still open after %v, want it closed after %v", timeout, *maxConnectionIdle)
+	}
+	elapsed := time.Since(start)
+	t.Logf("Idle connection closed by the server after %v, now %v", elapsed, conn.GetState())
+	if elapsed < *maxConnectionIdle {
+		t.Errorf("Idle connection closed after %v, want after %v", elapsed, *maxConnectionIdle)
+	}
+}
+
+// TestConnectionLimit verifies that the gRPC server accepts up to
+// -max_connections concurrent connections, and refuses more.
+func TestConnectionLimit(t *testing.T) {
+	if *maxConnections == 0 {
+		t.Skip("No connection limit of the gRPC server given by -max_connections")
+	}
+	dut := ondatra.DUT(t, "dut")
+	configure(t, dut)
+	client := clientCert(t)
+
+	// One connection is held by ondatra.
+	var conns []*grpc.ClientConn
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+	for i := 1; i < *maxConnections; i++ {
+		conn, err := dial(t, dut, client, 0)
+		if err != nil {
+			t.Fatalf("Connection %d of %d refused: %v", i+1, *maxConnections, err)
+		}
+		conns = append(conns, conn)
+	}
+
+	if conn, err := dial(t, dut, client, 0); err == nil {
+		conn.Close()
+		t.Fatalf("Connection %d accepted, want refused beyond the limit of %d", *maxConnections+1, *maxConnections)
+	} else {
+		t.Logf("Connection %d refused as expected: %v", *maxConnections+1, err)
+	}
+
+	// Closing a connection frees a slot for a new one.
+	if len(conns) > 0 {
+		conns[0].Close()
+		conns = conns[1:]
+		// The server may take some time to notice the closed connection.
+		deadline := time.Now().Add(teardownMargin)
+		for {
+			conn, err := dial(t, dut, client, 0)
+			if err == nil {
+				conns = append(conns, conn)
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Connection refused %v after closing one: %v", teardownMargin, err)
+			}
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multi_server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/security/svid"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	p4pb "github.com/p4lang/p4runtime/go/p4/v1"
+)
+
+var (
+	caCertPem = flag.String("ca_cert_pem", "../../../../security/gnsi/authz/tests/authz/testdata/ca.cert.pem",
+		"a pem file for a ca cert trusted by the DUT for client certificates, used to issue the client certificate")
+	caKeyPem = flag.String("ca_key_pem", "../../../../security/gnsi/authz/tests/authz/testdata/ca.key.pem",
+		"a pem file for the key of -ca_cert_pem")
+	spiffeID = flag.String("spiffe_id", "spiffe://test-abc.foo.bar/xyz/admin",
+		"SPIFFE ID of the client certificate")
+	mgmtVRF = flag.String("mgmt_vrf", "mgmt",
+		"name of the management network instance of the DUT")
+	mgmtAddr = flag.String("mgmt_addr", "",
+		"address of the DUT in the management network instance reachable from the test host; if empty the DUT name is used")
+	defaultAddr = flag.String("default_addr", "",
+		"address of the DUT in the default network instance reachable from the test host; reachability through the default network instance is not verified if empty")
+	mgmtPort    = flag.Uint("mgmt_port", 9391, "port of the gRPC server added in the management network instance")
+	defaultPort = flag.Uint("default_port", 9392, "port of the gRPC server added in the default network instance")
+)
+
+const (
+	mgmtServer    = "fp-mgmt"
+	defaultServer = "fp-default"
+	dialTimeout   = 20 * time.Second
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// server is a gRPC server instance added by the test.
+type server struct {
+	name     string
+	ni       string
+	port     uint16
+	services []oc.E_SystemGrpc_GRPC_SERVICE
+	// addr is the address of the DUT reachable through ni, or empty if none.
+	addr string
+}
+
+func (s *server) config() *oc.System_GrpcServer {
+	return &oc.System_GrpcServer{
+		Name:            ygot.String(s.name),
+		Enable:          ygot.Bool(true),
+		Port:            ygot.Uint16(s.port),
+		Services:        s.services,
+		NetworkInstance: ygot.String(s.ni),
+	}
+}
+
+func (s *server) serves(svc oc.E_SystemGrpc_GRPC_SERVICE) bool {
+	for _, v := range s.services {
+		if v == svc {
+			return true
+		}
+	}
+	return false
+}
+
+// dial returns a connection to port at addr, blocking until the connection is
+// established.
+func dial(t *testing.T, addr string, port uint16, client *tls.Certificate) (*grpc.ClientConn, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	tlsConf := &tls.Config{Certificates: []tls.Certificate{*client}, InsecureSkipVerify: true}
+	return grpc.DialContext(ctx, net.JoinHostPort(addr, strconv.Itoa(int(port))),
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConf)), grpc.WithBlock())
+}
+
+// callService calls a cheap RPC of svc on conn.
+func callService(conn *grpc.ClientConn, svc oc.E_SystemGrpc_GRPC_SERVICE) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	var err error
+	switch svc {
+	case oc.SystemGrpc_GRPC_SERVICE_GNMI:
+		_, err = gpb.NewGNMIClient(conn).Capabilities(ctx, &gpb.CapabilityRequest{})
+	case oc.SystemGrpc_GRPC_SERVICE_P4RT:
+		_, err = p4pb.NewP4RuntimeClient(conn).Capabilities(ctx, &p4pb.CapabilitiesRequest{})
+	}
+	return err
+}
+
+func TestMultipleServers(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	caKey, caCert, err := svid.LoadKeyPair(*caKeyPem, *caCertPem)
+	if err != nil {
+		t.Fatalf("Could not load ca key/cert: %v", err)
+	}
+	client, err := svid.GenSVID("multi-server", *spiffeID, 1, caCert, caKey, x509.RSA)
+	if err != nil {
+		t.Fatalf("Could not generate client svid: %v", err)
+	}
+
+	maddr := *mgmtAddr
+	if maddr == "" {
+		maddr = dut.Name()
+	}
+	servers := []*server{{
+		name:     mgmtServer,
+		ni:       *mgmtVRF,
+		port:     uint16(*mgmtPort),
+		services: []oc.E_SystemGrpc_GRPC_SERVICE{oc.SystemGrpc_GRPC_SERVICE_GNMI},
+		addr:     maddr,
+	}, {
+		name:     defaultServer,
+		ni:       deviations.DefaultNetworkInstance(dut),
+		port:     uint16(*defaultPort),
+		services: []oc.E_SystemGrpc_GRPC_SERVICE{oc.SystemGrpc_GRPC_SERVICE_P4RT},
+		addr:     *defaultAddr,
+	}}
+	for _, s := range servers {
+		gnmi.Replace(t, dut, gnmi.OC().System().GrpcServer(s.name).Config(), s.config())
+		defer gnmi.Delete(t, dut, gnmi.OC().System().GrpcServer(s.name).Config())
+	}
+
+	t.Run("Telemetry", func(t *testing.T) {
+		for _, s := range servers {
+			got := gnmi.Await(t, dut, gnmi.OC().System().GrpcServer(s.name).Enable().State(), time.Minute, true)
+			if !got.IsPresent() {
+				t.Errorf("%s: enable did not become true", s.name)
+				continue
+			}
+			st := gnmi.Get(t, dut, gnmi.OC().System().GrpcServer(s.name).State())
+			if got := st.GetPort(); got != s.port {
+				t.Errorf("%s port: got %d, want %d", s.name, got, s.port)
+			}
+			if got := st.GetNetworkInstance(); got != s.ni {
+				t.Errorf("%s network-instance: got %q, want %q", s.name, got, s.ni)
+			}
+			if diff := cmp.Diff(s.services, st.GetServices(), cmpopts.SortSlices(func(a, b oc.E_SystemGrpc_GRPC_SERVICE) bool { return a < b })); diff != "" {
+				t.Errorf("%s services (-want +got):\n%s", s.name, diff)
+			}
+		}
+	})
+
+	// Connections through a network instance must only reach the server bound
+	// to it, and only its enabled services.
+	vrfs := []struct {
+		desc string
+		ni   string
+		addr string
+	}{
+		{"management network instance", *mgmtVRF, maddr},
+		{"default network instance", deviations.DefaultNetworkInstance(dut), *defaultAddr},
+	}
+	for _, vrf := range vrfs {
+		for _, s := range servers {
+			t.Run(s.name+" via "+vrf.desc, func(t *testing.T) {
+				if vrf.addr == "" {
+					t.Skipf("No address of the DUT in the %s", vrf.desc)
+				}
+				conn, err := dial(t, vrf.addr, s.port, client)
+				if s.ni != vrf.ni {
+					if err == nil {
+						conn.Close()
+						t.Fatalf("Connection to %s port %d succeeded, want unreachable", vrf.addr, s.port)
+					}
+					t.Logf("Connection to %s port %d failed as expected: %v", vrf.addr, s.port, err)
+					return
+				}
+				if err != nil {
+					t.Fatalf("Connection to %s port %d failed: %v", vrf.addr, s.port, err)
+				}
+				defer conn.Close()
+				for _, svc := range []oc.E_SystemGrpc_GRPC_SERVICE{oc.SystemGrpc_GRPC_SERVICE_GNMI, oc.SystemGrpc_GRPC_SERVICE_P4RT} {
+					err := callService(conn, svc)
+					switch {
+					case s.serves(svc) && err != nil:
+						t.Errorf("%v RPC failed, want success: %v", svc, err)
+					case !s.serves(svc) && err == nil:
+						t.Errorf("%v RPC succeeded on a server without %v enabled", svc, svc)
+					}
+				}
+			})
+		}
+	}
+
+	t.Run("Connection counters", func(t *testing.T) {
+		for _, s := range servers {
+			if s.addr == "" {
+				continue
+			}
+			if got := gnmi.Get(t, dut, gnmi.OC().System().GrpcServer(s.name).Counters().ConnectionAccepts().State()); got == 0 {
+				t.Errorf("%s connection-accepts: got 0, want > 0", s.name)
+			}
+		}
+	})
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tls_policy_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/security/svid"
+	"github.com/openconfig/ondatra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	caCertPem = flag.String("ca_cert_pem", "../../../../security/gnsi/authz/tests/authz/testdata/ca.cert.pem",
+		"a pem file for a ca cert trusted by the DUT for client certificates, used to issue the client certificate")
+	caKeyPem = flag.String("ca_key_pem", "../../../../security/gnsi/authz/tests/authz/testdata/ca.key.pem",
+		"a pem file for the key of -ca_cert_pem")
+	spiffeID = flag.String("spiffe_id", "spiffe://test-abc.foo.bar/xyz/admin",
+		"SPIFFE ID of the client certificate")
+	policyCLI = flag.String("tls_policy_cli", "",
+		"optional CLI configuration applied with gNMI Set to configure the TLS policy of the gRPC server; if empty the policy is expected to be preconfigured")
+	restoreCLI = flag.String("tls_policy_restore_cli", "",
+		"optional CLI configuration applied with gNMI Set at the end of the test to restore the TLS policy")
+	minVersion = flag.String("min_tls_version", "1.2",
+		"minimum TLS version accepted by the gRPC server under the configured policy: 1.0, 1.1, 1.2 or 1.3")
+	allowedCiphers = flag.String("allowed_ciphers", "",
+		"comma separated IANA names of the TLS 1.2 and earlier cipher suites accepted under the configured policy; if empty cipher suites are not verified")
+)
+
+const dialTimeout = 20 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// handshakeCreds wraps TLS transport credentials and records the outcome of
+// the client handshake, so that handshake failures can be told apart from
+// failures of the RPC.
+type handshakeCreds struct {
+	credentials.TransportCredentials
+	result *handshakeResult
+}
+
+type handshakeResult struct {
+	mu    sync.Mutex
+	done  bool
+	err   error
+	state tls.ConnectionState
+}
+
+func (c handshakeCreds) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	nc, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, conn)
+	c.result.mu.Lock()
+	defer c.result.mu.Unlock()
+	c.result.done, c.result.err = true, err
+	if ti, ok := info.(credentials.TLSInfo); ok {
+		c.result.state = ti.State
+	}
+	return nc, info, err
+}
+
+func (c handshakeCreds) Clone() credentials.TransportCredentials {
+	return handshakeCreds{TransportCredentials: c.TransportCredentials.Clone(), result: c.result}
+}
+
+// handshake connects to the gNMI server of the DUT with the given TLS version
+// and, for TLS 1.2 and earlier, cipher suite. It returns the negotiated
+// connection state, or the handshake error.
+func handshake(t *testing.T, dut *ondatra.DUTDevice, client *tls.Certificate, version, cipher uint16) (tls.ConnectionState, error) {
+	t.Helper()
+	tlsConf := &tls.Config{
+		Certificates:       []tls.Certificate{*client},
+		InsecureSkipVerify: true,
+		MinVersion:         version,
+		MaxVersion:         version,
+	}
+	if cipher != 0 {
+		tlsConf.CipherSuites = []uint16{cipher}
+	}
+	result := &handshakeResult{}
+	creds := handshakeCreds{TransportCredentials: credentials.NewTLS(tlsConf), result: result}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	c, err := dut.RawAPIs().BindingDUT().DialGNMI(ctx, grpc.WithTransportCredentials(creds))
+	if err == nil {
+		// The connection is established lazily, so issue an RPC to trigger the
+		// handshake. Its outcome is not relevant.
+		c.Capabilities(ctx, &gpb.CapabilityRequest{})
+	}
+
+	result.mu.Lock()
+	defer result.mu.Unlock()
+	switch {
+	case result.done:
+		return result.state, result.err
+	case err != nil:
+		return tls.ConnectionState{}, err
+	default:
+		return tls.ConnectionState{}, fmt.Errorf("no TLS handshake within %v", dialTimeout)
+	}
+}
+
+// cipherSuites returns all cipher suites which the Go client supports for
+// version, including insecure ones.
+func cipherSuites(version uint16) []*tls.CipherSuite {
+	var suites []*tls.CipherSuite
+	for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		for _, v := range s.SupportedVersions {
+			if v == version {
+				suites = append(suites, s)
+				break
+			}
+		}
+	}
+	return suites
+}
+
+// applyCLI applies CLI configuration of the TLS policy of the gRPC servers.
+func applyCLI(t *testing.T, dut *ondatra.DUTDevice, config string) {
+	t.Helper()
+	clihelper.Push(t, dut, &clihelper.Config{
+		Reason: "TLS policy of the gRPC servers",
+		CLI:    map[ondatra.Vendor]string{dut.Vendor(): config},
+	})
+}
+
+func TestTLSPolicy(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	min, ok := tlsVersions[*minVersion]
+	if !ok {
+		t.Fatalf("Invalid -min_tls_version %q", *minVersion)
+	}
+	allowed := map[string]bool{}
+	for _, name := range strings.Split(*allowedCiphers, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			allowed[name] = true
+		}
+	}
+
+	caKey, caCert, err := svid.LoadKeyPair(*caKeyPem, *caCertPem)
+	if err != nil {
+		t.Fatalf("Could not load ca key/cert: %v", err)
+	}
+	client, err := svid.GenSVID("tls-policy", *spiffeID, 1, caCert, caKey, x509.RSA)
+	if err != nil {
+		t.Fatalf("Could not generate client svid: %v", err)
+	}
+
+	if *policyCLI != "" {
+		applyCLI(t, dut, *policyCLI)
+		if *restoreCLI != "" {
+			defer applyCLI(t, dut, *restoreCLI)
+		}
+	}
+
+	for _, name := range []string{"1.0", "1.1", "1.2", "1.3"} {
+		version := tlsVersions[name]
+		t.Run("TLS "+name, func(t *testing.T) {
+			if version == tls.VersionTLS13 || len(allowed) == 0 {
+				state, err := handshake(t, dut, client, version, 0)
+				verifyHandshake(t, state, err, version >= min, version, 0)
+				return
+			}
+			for _, s := range cipherSuites(version) {
+				t.Run(s.Name, func(t *testing.T) {
+					state, err := handshake(t, dut, client, version, s.ID)
+					verifyHandshake(t, state, err, version >= min && allowed[s.Name], version, s.ID)
+				})
+			}
+		})
+	}
+}
+
+// verifyHandshake checks the outcome of a handshake against the policy.
+func verifyHandshake(t *testing.T, state tls.ConnectionState, err error, wantOK bool, version, cipher uint16) {
+	t.Helper()
+	switch {
+	case wantOK && err != nil:
+		t.Errorf("Handshake failed, want success: %v", err)
+	case !wantOK && err == nil:
+		t.Errorf("Handshake succeeded with %s %s, want failure", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	case err != nil:
+		t.Logf("Handshake rejected as expected: %v", err)
+	default:
+		if state.Version != version {
+			t.Errorf("Negotiated version: got %s, want %s", tls.VersionName(state.Version), tls.VersionName(version))
+		}
+		if cipher != 0 && state.CipherSuite != cipher {
+			t.Errorf("Negotiated cipher suite: got %s, want %s", tls.CipherSuiteName(state.CipherSuite), tls.CipherSuiteName(cipher))
+		}
+	}
+}
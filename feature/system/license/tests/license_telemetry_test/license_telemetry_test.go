@@ -0,0 +1,136 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package license_telemetry_test
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+)
+
+var (
+	wantLicenses = flag.String("licenses", "",
+		"comma separated IDs of the licenses installed on the DUT, which must be reported and in use; if empty any reported license is verified")
+)
+
+// expiryMargin is the time around the expiration date of a license within
+// which its expired state is not verified, as it may not be updated yet.
+const expiryMargin = time.Hour
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// verifyLicense verifies the consistency of the state of license l at time
+// now.
+func verifyLicense(t *testing.T, l *oc.System_License_License, now time.Time) {
+	t.Helper()
+	id := l.GetLicenseId()
+	if l.GetDescription() == "" {
+		t.Errorf("License %q has no description", id)
+	}
+	for name, v := range map[string]*bool{"active": l.Active, "in-use": l.InUse, "expired": l.Expired, "valid": l.Valid} {
+		if v == nil {
+			t.Errorf("License %q has no %s state", id, name)
+		}
+	}
+	if l.GetInUse() && !(l.GetActive() && l.GetValid()) {
+		t.Errorf("License %q is in use, but active %t and valid %t, want both true", id, l.GetActive(), l.GetValid())
+	}
+
+	// The dates are in seconds since the epoch, and an expiration date of 0
+	// means that the license does not expire.
+	issued, expires := l.GetIssueDate(), l.GetExpirationDate()
+	if issued > uint64(now.Unix()) {
+		t.Errorf("License %q issue-date: got %v, want before now %v", id, time.Unix(int64(issued), 0), now)
+	}
+	if expires == 0 {
+		if l.GetExpired() {
+			t.Errorf("License %q without expiration-date is expired", id)
+		}
+		return
+	}
+	expiry := time.Unix(int64(expires), 0)
+	if issued > expires {
+		t.Errorf("License %q expiration-date %v is before its issue-date %v", id, expiry, time.Unix(int64(issued), 0))
+	}
+	if d := now.Sub(expiry); d > expiryMargin || d < -expiryMargin {
+		if got, want := l.GetExpired(), now.After(expiry); got != want {
+			t.Errorf("License %q expiring on %v expired: got %t, want %t", id, expiry, got, want)
+		}
+	}
+	if l.GetExpired() && l.GetInUse() {
+		t.Errorf("License %q is expired and in use", id)
+	}
+}
+
+// TestLicenses verifies the telemetry of the licenses of the DUT.
+//
+// telemetry_path:/system/license/licenses/license/state/license-id
+// telemetry_path:/system/license/licenses/license/state/description
+// telemetry_path:/system/license/licenses/license/state/issue-date
+// telemetry_path:/system/license/licenses/license/state/expiration-date
+// telemetry_path:/system/license/licenses/license/state/active
+// telemetry_path:/system/license/licenses/license/state/in-use
+// telemetry_path:/system/license/licenses/license/state/expired
+// telemetry_path:/system/license/licenses/license/state/valid
+func TestLicenses(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	if !deviations.Supported(dut, "license_oc") {
+		t.Skip("Licenses are not exposed in OpenConfig")
+	}
+
+	now := time.Now()
+	licenses := map[string]*oc.System_License_License{}
+	for _, v := range gnmi.LookupAll(t, dut, gnmi.OC().System().License().LicenseAny().State()) {
+		if l, ok := v.Val(); ok {
+			licenses[l.GetLicenseId()] = l
+		}
+	}
+	var want []string
+	for _, id := range strings.Split(*wantLicenses, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			want = append(want, id)
+		}
+	}
+	if len(licenses) == 0 && len(want) == 0 {
+		t.Skip("No licenses reported by the DUT, and none given by -licenses")
+	}
+
+	for _, id := range want {
+		l, ok := licenses[id]
+		if !ok {
+			t.Errorf("License %q is not reported", id)
+			continue
+		}
+		if !l.GetInUse() {
+			t.Errorf("License %q in-use: got false, want true", id)
+		}
+	}
+	for id, l := range licenses {
+		t.Run(id, func(t *testing.T) {
+			t.Logf("License %q: %q, active %t, in-use %t, expired %t, valid %t, expiration-date %d",
+				id, l.GetDescription(), l.GetActive(), l.GetInUse(), l.GetExpired(), l.GetValid(), l.GetExpirationDate())
+			verifyLicense(t, l, now)
+		})
+	}
+}
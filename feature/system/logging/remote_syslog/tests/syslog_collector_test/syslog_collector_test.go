@@ -0,0 +1,224 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syslog_collector_test
+
+import (
+	"context"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/syslogcollector"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"golang.org/x/crypto/ssh"
+)
+
+// The syslog collector runs on the test host, or in a container, which the
+// DUT reaches through its management network.
+var (
+	listenAddr = flag.String("syslog_listen", ":5514",
+		"UDP address on which the syslog collector listens")
+	collectorHost = flag.String("syslog_host", "",
+		"address of the syslog collector reachable by the DUT; the test is skipped when empty")
+	collectorVRF = flag.String("syslog_vrf", "",
+		"network instance through which the DUT reaches -syslog_host, such as the management VRF; the default network instance when empty")
+	sshAddr = flag.String("ssh_addr", "",
+		"host:port of the SSH server of the DUT to log in to; the login event is skipped when empty")
+	sshUser = flag.String("ssh_user", "admin",
+		"username with which to log in to -ssh_addr")
+	sshPassword = flag.String("ssh_password", "",
+		"password with which to log in to -ssh_addr")
+)
+
+const (
+	// facility and severity are the selector of the messages sent to the
+	// collector: all facilities, at informational severity or above.
+	facility = oc.SystemLogging_SYSLOG_FACILITY_ALL
+	severity = oc.SystemLogging_SyslogSeverity_INFORMATIONAL
+
+	// eventTimeout is the time allowed for the message of an event to
+	// arrive at the collector.
+	eventTimeout = time.Minute
+
+	// maxTimestampSkew is the maximum difference between the timestamp of
+	// an RFC 5424 message and the time at which it is received.
+	maxTimestampSkew = 5 * time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// configureRemoteServer configures the collector as the remote syslog server
+// of dut, receiving on port.
+func configureRemoteServer(t *testing.T, dut *ondatra.DUTDevice, port uint16) {
+	t.Helper()
+	d := &oc.Root{}
+	rs := d.GetOrCreateSystem().GetOrCreateLogging().GetOrCreateRemoteServer(*collectorHost)
+	rs.SetRemotePort(port)
+	rs.SetNetworkInstance(collectorNetworkInstance(dut))
+	rs.GetOrCreateSelector(facility, severity)
+	gnmi.Replace(t, dut, gnmi.OC().System().Logging().RemoteServer(*collectorHost).Config(), rs)
+}
+
+// collectorNetworkInstance returns the network instance through which dut
+// reaches the collector.
+func collectorNetworkInstance(dut *ondatra.DUTDevice) string {
+	if *collectorVRF != "" {
+		return *collectorVRF
+	}
+	return deviations.DefaultNetworkInstance(dut)
+}
+
+// verifyRemoteServer verifies the telemetry of the remote syslog server of
+// dut.
+func verifyRemoteServer(t *testing.T, dut *ondatra.DUTDevice, port uint16) {
+	t.Helper()
+	rs := gnmi.Get(t, dut, gnmi.OC().System().Logging().RemoteServer(*collectorHost).State())
+	if got := rs.GetRemotePort(); got != port {
+		t.Errorf("Remote server %s port: got %d, want %d", *collectorHost, got, port)
+	}
+	if got, want := rs.GetNetworkInstance(), collectorNetworkInstance(dut); got != want {
+		t.Errorf("Remote server %s network instance: got %q, want %q", *collectorHost, got, want)
+	}
+	if rs.GetSelector(facility, severity) == nil {
+		t.Errorf("Remote server %s is missing selector %v %v", *collectorHost, facility, severity)
+	}
+}
+
+// await waits for the collector c to receive a message whose text contains
+// all of subs, case insensitively.
+func await(t *testing.T, c *syslogcollector.Collector, subs ...string) *syslogcollector.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	m, err := c.Await(ctx, func(m *syslogcollector.Message) bool {
+		text := strings.ToLower(m.Text)
+		for _, s := range subs {
+			if !strings.Contains(text, strings.ToLower(s)) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Message containing %q not received within %v: %v\nReceived messages: %v", subs, eventTimeout, err, c.Messages(nil))
+	}
+	t.Logf("Received message: %v", m)
+	return m
+}
+
+// verifyFields verifies the required fields of the message m of dut, whose
+// hostname is hostname.
+func verifyFields(t *testing.T, m *syslogcollector.Message, hostname string) {
+	t.Helper()
+	if m.Severity > syslogcollector.Informational {
+		t.Errorf("Message %v severity: got %d, want <= %d", m, m.Severity, syslogcollector.Informational)
+	}
+	if m.Timestamp.IsZero() {
+		t.Errorf("Message %v has no timestamp", m)
+	} else if m.Format == syslogcollector.RFC5424 {
+		// RFC 3164 timestamps are in the unknown time zone of the DUT.
+		if skew := m.Received.Sub(m.Timestamp).Abs(); skew > maxTimestampSkew {
+			t.Errorf("Message %v timestamp skew: got %v, want <= %v", m, skew, maxTimestampSkew)
+		}
+	}
+	// The hostname may be qualified by the domain of the DUT, or not.
+	short, _, _ := strings.Cut(hostname, ".")
+	if got, _, _ := strings.Cut(m.Hostname, "."); !strings.EqualFold(got, short) {
+		t.Errorf("Message %v hostname: got %q, want %q", m, m.Hostname, hostname)
+	}
+	if m.AppName == "" {
+		t.Errorf("Message %v has no application name", m)
+	}
+}
+
+// setEnabled sets the enabled state of the loopback interface name of dut.
+func setEnabled(t *testing.T, dut *ondatra.DUTDevice, name string, enabled bool) {
+	t.Helper()
+	i := &oc.Interface{Name: &name}
+	i.SetType(oc.IETFInterfaces_InterfaceType_softwareLoopback)
+	i.SetEnabled(enabled)
+	gnmi.Update(t, dut, gnmi.OC().Interface(name).Config(), i)
+}
+
+// TestRemoteSyslog verifies that the messages of the events of the DUT arrive
+// at the syslog collector with their required fields.
+func TestRemoteSyslog(t *testing.T) {
+	if *collectorHost == "" {
+		t.Skip("No syslog collector address given by -syslog_host")
+	}
+	dut := ondatra.DUT(t, "dut")
+
+	c, err := syslogcollector.Listen(*listenAddr)
+	if err != nil {
+		t.Fatalf("Cannot start syslog collector: %v", err)
+	}
+	defer c.Close()
+
+	configureRemoteServer(t, dut, c.Port())
+	defer gnmi.Delete(t, dut, gnmi.OC().System().Logging().RemoteServer(*collectorHost).Config())
+	verifyRemoteServer(t, dut, c.Port())
+
+	hostname := gnmi.Get(t, dut, gnmi.OC().System().Hostname().State())
+
+	t.Run("InterfaceFlap", func(t *testing.T) {
+		lb := netutil.LoopbackInterface(t, dut, 1)
+		setEnabled(t, dut, lb, true)
+		defer gnmi.Delete(t, dut, gnmi.OC().Interface(lb).Config())
+		gnmi.Await(t, dut, gnmi.OC().Interface(lb).OperStatus().State(), time.Minute, oc.Interface_OperStatus_UP)
+
+		c.Reset()
+		setEnabled(t, dut, lb, false)
+		verifyFields(t, await(t, c, lb, "down"), hostname)
+		setEnabled(t, dut, lb, true)
+		verifyFields(t, await(t, c, lb, "up"), hostname)
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		if *sshAddr == "" {
+			t.Skip("No SSH server of the DUT given by -ssh_addr")
+		}
+		c.Reset()
+		// The login is logged whether it succeeds or not.
+		client, err := ssh.Dial("tcp", *sshAddr, &ssh.ClientConfig{
+			User:            *sshUser,
+			Auth:            []ssh.AuthMethod{ssh.Password(*sshPassword)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         30 * time.Second,
+		})
+		if err != nil {
+			t.Logf("SSH login of %s to %s failed: %v", *sshUser, *sshAddr, err)
+		} else {
+			client.Close()
+		}
+		verifyFields(t, await(t, c, *sshUser), hostname)
+	})
+
+	for _, m := range c.Messages(nil) {
+		if m.Severity > syslogcollector.Informational {
+			t.Errorf("Message %v severity: got %d, want <= %d", m, m.Severity, syslogcollector.Informational)
+		}
+	}
+	if errs := c.Errors(); len(errs) > 0 {
+		t.Errorf("Syslog collector received invalid messages: %v", errs)
+	}
+}
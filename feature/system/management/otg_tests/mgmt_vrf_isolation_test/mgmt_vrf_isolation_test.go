@@ -0,0 +1,502 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mgmt_vrf_isolation_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/featureprofiles/internal/syslogcollector"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+	"golang.org/x/crypto/ssh"
+)
+
+// The test host reaches the DUT through its management interface, which is in
+// the management network instance given by -mgmt_vrf, as do the NTP server
+// and the syslog collector.
+var (
+	mgmtVRF = flag.String("mgmt_vrf", "mgmt",
+		"name of the management network instance of the DUT")
+	mgmtAddr = flag.String("mgmt_addr", "",
+		"address of the DUT in the management network instance reachable from the test host; if empty the DUT name is used")
+	grpcServer = flag.String("grpc_server", "",
+		"name of the gRPC server of the DUT serving gNMI to the test; if empty the first enabled gRPC server serving gNMI is used")
+	gnmiPort = flag.Uint("gnmi_port", 9339,
+		"port of the gRPC server given by -grpc_server")
+	ntpServer = flag.String("ntp_server", "",
+		"address of an NTP server reachable by the DUT in the management network instance; NTP is not verified if empty")
+	syslogListen = flag.String("syslog_listen", ":5514",
+		"UDP address on which the syslog collector listens")
+	syslogHost = flag.String("syslog_host", "",
+		"address of the syslog collector reachable by the DUT in the management network instance; syslog is not verified if empty")
+)
+
+const (
+	ipv4PrefixLen = 30
+	ipv6PrefixLen = 126
+
+	// dataVRF is the data plane network instance of port1 of the DUT, port2
+	// being in the default network instance.
+	dataVRF = "fp-data"
+
+	user     = "fp-mgmt-admin"
+	password = "fp-Passw0rd!"
+	sshPort  = 22
+
+	// probeSrcPort is the source port of the TCP SYN probes sent by the ATE.
+	probeSrcPort = 49152
+	probePackets = 100
+	probePPS     = 10
+
+	dialTimeout      = 30 * time.Second
+	migrationTimeout = 2 * time.Minute
+	// ntpSyncTimeout is the time allowed for the DUT to synchronize to
+	// -ntp_server through the management network instance.
+	ntpSyncTimeout = 10 * time.Minute
+	eventTimeout   = time.Minute
+	// unsynchronized is the stratum of an NTP server to which the DUT is not
+	// synchronized.
+	unsynchronized = 16
+)
+
+var (
+	dutPort1 = attrs.Attributes{
+		Desc:    "dutPort1",
+		IPv4:    "192.0.2.1",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::1",
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort1 = attrs.Attributes{
+		Name:    "atePort1",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::2",
+		IPv6Len: ipv6PrefixLen,
+	}
+	dutPort2 = attrs.Attributes{
+		Desc:    "dutPort2",
+		IPv4:    "192.0.2.5",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::5",
+		IPv6Len: ipv6PrefixLen,
+	}
+	atePort2 = attrs.Attributes{
+		Name:    "atePort2",
+		MAC:     "02:00:02:01:01:01",
+		IPv4:    "192.0.2.6",
+		IPv4Len: ipv4PrefixLen,
+		IPv6:    "2001:db8::6",
+		IPv6Len: ipv6PrefixLen,
+	}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// sshVRFCLI is the CLI of the network instance of the SSH server, which
+// OpenConfig does not model.
+type sshVRFCLI struct {
+	// migrate serves SSH only in the network instance %[1]s.
+	migrate string
+	// restore serves SSH in the default network instance only.
+	restore string
+}
+
+var sshVRFCLIs = map[ondatra.Vendor]sshVRFCLI{
+	ondatra.ARISTA: {
+		migrate: "management ssh\n   shutdown\n   vrf %[1]s\n      no shutdown\n",
+		restore: "management ssh\n   no shutdown\n   no vrf %[1]s\n",
+	},
+	ondatra.CISCO: {
+		migrate: "ssh server vrf %[1]s\nno ssh server vrf default\n",
+		restore: "ssh server vrf default\nno ssh server vrf %[1]s\n",
+	},
+}
+
+// port is a data plane port of the DUT and of the ATE, and the network
+// instance of the DUT port.
+type port struct {
+	name string
+	dut  *attrs.Attributes
+	ate  *attrs.Attributes
+	ni   string
+}
+
+// ports returns the data plane ports of dut.
+func ports(dut *ondatra.DUTDevice) []port {
+	return []port{
+		{"port1", &dutPort1, &atePort1, dataVRF},
+		{"port2", &dutPort2, &atePort2, deviations.DefaultNetworkInstance(dut)},
+	}
+}
+
+func configureDUT(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	ni := &oc.NetworkInstance{Name: ygot.String(dataVRF)}
+	ni.SetType(oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_L3VRF)
+	gnmi.Replace(t, dut, gnmi.OC().NetworkInstance(dataVRF).Config(), ni)
+	t.Cleanup(func() { gnmi.Delete(t, dut, gnmi.OC().NetworkInstance(dataVRF).Config()) })
+
+	for _, p := range ports(dut) {
+		dp := dut.Port(t, p.name)
+		gnmi.Replace(t, dut, gnmi.OC().Interface(dp.Name()).Config(), p.dut.NewOCInterface(dp.Name(), dut))
+		if deviations.ExplicitPortSpeed(dut) {
+			fptest.SetPortSpeed(t, dp)
+		}
+		if p.ni != deviations.DefaultNetworkInstance(dut) || deviations.ExplicitInterfaceInDefaultVRF(dut) {
+			fptest.AssignToNetworkInstance(t, dut, dp.Name(), p.ni, 0)
+		}
+	}
+}
+
+// configureATE configures the ATE ports with a capture each, and with flows
+// of TCP SYN probes to the SSH and gNMI ports of the DUT port connected to
+// them, sent to the MAC address of the DUT port.
+func configureATE(t *testing.T, ate *ondatra.ATEDevice, dut *ondatra.DUTDevice) gosnappi.Config {
+	t.Helper()
+	top := gosnappi.NewConfig()
+	for _, p := range ports(dut) {
+		ap := ate.Port(t, p.name)
+		p.ate.AddToOTG(top, ap, p.dut)
+		top.Captures().Add().SetName(p.name + "Capture").SetPortNames([]string{ap.ID()}).SetFormat(gosnappi.CaptureFormat.PCAP)
+		mac := gnmi.Get(t, dut, gnmi.OC().Interface(dut.Port(t, p.name).Name()).Ethernet().MacAddress().State())
+
+		for _, svc := range []struct {
+			name string
+			port uint32
+		}{{"SSH", sshPort}, {"gNMI", uint32(*gnmiPort)}} {
+			f := top.Flows().Add().SetName(fmt.Sprintf("%s to %s", svc.name, p.name))
+			f.TxRx().Port().SetTxName(ap.ID())
+			f.Rate().SetPps(probePPS)
+			f.Duration().FixedPackets().SetPackets(probePackets)
+			eth := f.Packet().Add().Ethernet()
+			eth.Src().SetValue(p.ate.MAC)
+			eth.Dst().SetValue(mac)
+			ip := f.Packet().Add().Ipv4()
+			ip.Src().SetValue(p.ate.IPv4)
+			ip.Dst().SetValue(p.dut.IPv4)
+			tcp := f.Packet().Add().Tcp()
+			tcp.SrcPort().SetValue(probeSrcPort)
+			tcp.DstPort().SetValue(svc.port)
+			tcp.CtlSyn().SetValue(1)
+		}
+	}
+	return top
+}
+
+// gnmiServer returns the name of the gRPC server of dut serving gNMI to the
+// test.
+func gnmiServer(t *testing.T, dut *ondatra.DUTDevice) string {
+	t.Helper()
+	if *grpcServer != "" {
+		return *grpcServer
+	}
+	for _, s := range gnmi.GetAll(t, dut, gnmi.OC().System().GrpcServerAny().State()) {
+		if !s.GetEnable() {
+			continue
+		}
+		for _, svc := range s.GetServices() {
+			if svc == oc.SystemGrpc_GRPC_SERVICE_GNMI {
+				return s.GetName()
+			}
+		}
+	}
+	t.Fatalf("No enabled gRPC server serving gNMI; give it by -grpc_server")
+	return ""
+}
+
+// migrateGRPC moves the gRPC server name of dut to the management network
+// instance, and restores its network instance at the end of the test.
+func migrateGRPC(t *testing.T, dut *ondatra.DUTDevice, name string) {
+	t.Helper()
+	path := gnmi.OC().System().GrpcServer(name).NetworkInstance()
+	prev := gnmi.Lookup(t, dut, path.Config())
+	gnmi.Update(t, dut, path.Config(), *mgmtVRF)
+	t.Cleanup(func() {
+		if v, ok := prev.Val(); ok {
+			gnmi.Update(t, dut, path.Config(), v)
+		} else {
+			gnmi.Delete(t, dut, path.Config())
+		}
+	})
+}
+
+// migrateSSH serves SSH on dut in the management network instance only, and
+// restores the default network instance at the end of the test. It returns
+// false if the SSH server of the vendor of dut cannot be migrated.
+func migrateSSH(t *testing.T, dut *ondatra.DUTDevice) bool {
+	t.Helper()
+	c, ok := sshVRFCLIs[dut.Vendor()]
+	if !ok {
+		t.Logf("SSH server network instance CLI is not supported for vendor %v", dut.Vendor())
+		return false
+	}
+	clihelper.Push(t, dut, &clihelper.Config{
+		Reason: "SSH server network instance",
+		CLI:    map[ondatra.Vendor]string{dut.Vendor(): fmt.Sprintf(c.migrate, *mgmtVRF)},
+	})
+	t.Cleanup(func() {
+		clihelper.Push(t, dut, &clihelper.Config{
+			Reason: "SSH server default network instance",
+			CLI:    map[ondatra.Vendor]string{dut.Vendor(): fmt.Sprintf(c.restore, *mgmtVRF)},
+		})
+	})
+	return true
+}
+
+// configureNTP replaces the NTP configuration of dut with -ntp_server in the
+// management network instance.
+func configureNTP(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	ntp := &oc.System_Ntp{}
+	ntp.SetEnabled(true)
+	srv := ntp.GetOrCreateServer(*ntpServer)
+	srv.SetIburst(true)
+	srv.SetNetworkInstance(*mgmtVRF)
+	gnmi.Replace(t, dut, gnmi.OC().System().Ntp().Config(), ntp)
+	t.Cleanup(func() { gnmi.Delete(t, dut, gnmi.OC().System().Ntp().Server(*ntpServer).Config()) })
+}
+
+// configureSyslog configures -syslog_host in the management network instance
+// as the remote syslog server of dut, receiving on port.
+func configureSyslog(t *testing.T, dut *ondatra.DUTDevice, port uint16) {
+	t.Helper()
+	rs := &oc.System_Logging_RemoteServer{Host: ygot.String(*syslogHost)}
+	rs.SetRemotePort(port)
+	rs.SetNetworkInstance(*mgmtVRF)
+	rs.GetOrCreateSelector(oc.SystemLogging_SYSLOG_FACILITY_ALL, oc.SystemLogging_SyslogSeverity_INFORMATIONAL)
+	path := gnmi.OC().System().Logging().RemoteServer(*syslogHost)
+	gnmi.Replace(t, dut, path.Config(), rs)
+	t.Cleanup(func() { gnmi.Delete(t, dut, path.Config()) })
+}
+
+// createUser configures the local user of the DUT, and deletes it at the end
+// of the test.
+func createUser(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	path := gnmi.OC().System().Aaa().Authentication().User(user)
+	gnmi.Replace(t, dut, path.Config(), &oc.System_Aaa_Authentication_User{
+		Username: ygot.String(user),
+		Password: ygot.String(password),
+		Role:     oc.AaaTypes_SYSTEM_DEFINED_ROLES_SYSTEM_ROLE_ADMIN,
+	})
+	t.Cleanup(func() { gnmi.Delete(t, dut, path.Config()) })
+}
+
+// dialSSH logs in to the SSH server of dut through the management network
+// instance.
+func dialSSH(dut *ondatra.DUTDevice) (*ssh.Client, error) {
+	addr := *mgmtAddr
+	if addr == "" {
+		addr = dut.Name()
+	}
+	return ssh.Dial("tcp", net.JoinHostPort(addr, fmt.Sprint(sshPort)), &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         dialTimeout,
+	})
+}
+
+// setEnabled sets the enabled state of the loopback interface name of dut.
+func setEnabled(t *testing.T, dut *ondatra.DUTDevice, name string, enabled bool) {
+	t.Helper()
+	i := &oc.Interface{Name: &name}
+	i.SetType(oc.IETFInterfaces_InterfaceType_softwareLoopback)
+	i.SetEnabled(enabled)
+	gnmi.Update(t, dut, gnmi.OC().Interface(name).Config(), i)
+}
+
+// verifyIsolation verifies that pkts captured on port p of the ATE hold no
+// TCP SYN-ACK of the SSH or gNMI port of the DUT, nor any packet to the NTP
+// server or the syslog collector.
+func verifyIsolation(t *testing.T, p port, pkts []gopacket.Packet) {
+	t.Helper()
+	var synAcks, mgmt int
+	for _, pkt := range pkts {
+		ip, ok := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok {
+			continue
+		}
+		if dst := ip.DstIP.String(); dst == *ntpServer || dst == *syslogHost {
+			mgmt++
+			continue
+		}
+		tcp, ok := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		if !ok || !ip.SrcIP.Equal(net.ParseIP(p.dut.IPv4)) || tcp.DstPort != probeSrcPort {
+			continue
+		}
+		if tcp.SYN && tcp.ACK {
+			synAcks++
+			t.Errorf("DUT %s accepted a connection to port %d in network instance %s", p.name, tcp.SrcPort, p.ni)
+		}
+	}
+	if mgmt > 0 {
+		t.Errorf("DUT %s sent %d NTP or syslog packets in network instance %s, want 0", p.name, mgmt, p.ni)
+	}
+	t.Logf("Captured %d packets on ATE %s, of which %d SYN-ACKs and %d NTP or syslog packets", len(pkts), p.name, synAcks, mgmt)
+}
+
+// TestManagementVRF moves the gNMI and SSH servers, NTP and syslog of the DUT
+// to the management network instance, and verifies that they are reachable
+// through the management interface only, and that the gNMI and SSH sessions
+// open during the migration survive it.
+func TestManagementVRF(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	ate := ondatra.ATE(t, "ate")
+
+	configureDUT(t, dut)
+	createUser(t, dut)
+	top := configureATE(t, ate, dut)
+	ate.OTG().PushConfig(t, top)
+	ate.OTG().StartProtocols(t)
+	defer ate.OTG().StopProtocols(t)
+	otgutils.WaitForARP(t, ate.OTG(), top, "IPv4")
+	otgutils.StartCapture(t, ate.OTG())
+
+	var collector *syslogcollector.Collector
+	if *syslogHost != "" {
+		c, err := syslogcollector.Listen(*syslogListen)
+		if err != nil {
+			t.Fatalf("Cannot start syslog collector: %v", err)
+		}
+		defer c.Close()
+		collector = c
+	}
+
+	// The sessions open during the migration: a gNMI subscription awaiting
+	// the migration of the gRPC server, and an SSH connection.
+	server := gnmiServer(t, dut)
+	t.Logf("gNMI is served by gRPC server %q", server)
+	watcher := gnmi.Watch(t, dut, gnmi.OC().System().GrpcServer(server).NetworkInstance().State(), migrationTimeout, func(v *ygnmi.Value[string]) bool {
+		ni, ok := v.Val()
+		return ok && ni == *mgmtVRF
+	})
+	sshClient, sshErr := dialSSH(dut)
+	if sshErr == nil {
+		defer sshClient.Close()
+	}
+
+	migrateGRPC(t, dut, server)
+	sshMigrated := migrateSSH(t, dut)
+	if *ntpServer != "" {
+		configureNTP(t, dut)
+	}
+	if collector != nil {
+		configureSyslog(t, dut, collector.Port())
+	}
+
+	t.Run("SessionsSurviveMigration", func(t *testing.T) {
+		if _, ok := watcher.Await(t); !ok {
+			t.Errorf("gNMI subscription open during the migration did not receive network instance %q of gRPC server %q", *mgmtVRF, server)
+		}
+		if sshErr != nil {
+			t.Fatalf("Cannot log in to the SSH server before the migration: %v", sshErr)
+		}
+		s, err := sshClient.NewSession()
+		if err != nil {
+			t.Fatalf("SSH connection open during the migration cannot open a session: %v", err)
+		}
+		s.Close()
+	})
+
+	t.Run("ManagementReachability", func(t *testing.T) {
+		t.Run("gNMI", func(t *testing.T) {
+			st := gnmi.Get(t, dut, gnmi.OC().System().GrpcServer(server).State())
+			if got := st.GetNetworkInstance(); got != *mgmtVRF {
+				t.Errorf("gRPC server %q network-instance: got %q, want %q", server, got, *mgmtVRF)
+			}
+		})
+		t.Run("SSH", func(t *testing.T) {
+			if !sshMigrated {
+				t.Skipf("SSH server of vendor %v was not migrated", dut.Vendor())
+			}
+			c, err := dialSSH(dut)
+			if err != nil {
+				t.Fatalf("Cannot log in to the SSH server through the management network instance: %v", err)
+			}
+			c.Close()
+		})
+		t.Run("NTP", func(t *testing.T) {
+			if *ntpServer == "" {
+				t.Skip("No NTP server given by -ntp_server")
+			}
+			path := gnmi.OC().System().Ntp().Server(*ntpServer)
+			if got := gnmi.Get(t, dut, path.NetworkInstance().State()); got != *mgmtVRF {
+				t.Errorf("NTP server %s network-instance: got %q, want %q", *ntpServer, got, *mgmtVRF)
+			}
+			_, ok := gnmi.Watch(t, dut, path.Stratum().State(), ntpSyncTimeout, func(v *ygnmi.Value[uint8]) bool {
+				s, ok := v.Val()
+				return ok && s > 0 && s < unsynchronized
+			}).Await(t)
+			if !ok {
+				t.Errorf("DUT did not synchronize to NTP server %s within %v", *ntpServer, ntpSyncTimeout)
+			}
+		})
+		t.Run("Syslog", func(t *testing.T) {
+			if collector == nil {
+				t.Skip("No syslog collector given by -syslog_host")
+			}
+			lb := netutil.LoopbackInterface(t, dut, 1)
+			setEnabled(t, dut, lb, true)
+			defer gnmi.Delete(t, dut, gnmi.OC().Interface(lb).Config())
+			gnmi.Await(t, dut, gnmi.OC().Interface(lb).OperStatus().State(), time.Minute, oc.Interface_OperStatus_UP)
+
+			collector.Reset()
+			setEnabled(t, dut, lb, false)
+			ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+			defer cancel()
+			m, err := collector.Await(ctx, func(m *syslogcollector.Message) bool {
+				return strings.Contains(strings.ToLower(m.Text), strings.ToLower(lb))
+			})
+			if err != nil {
+				t.Fatalf("Message of interface %s not received within %v: %v", lb, eventTimeout, err)
+			}
+			t.Logf("Received message: %v", m)
+		})
+	})
+
+	t.Run("DataPlaneIsolation", func(t *testing.T) {
+		ate.OTG().StartTraffic(t)
+		time.Sleep(time.Duration(probePackets/probePPS) * time.Second)
+		ate.OTG().StopTraffic(t)
+		otgutils.LogFlowMetrics(t, ate.OTG(), top)
+		otgutils.StopCapture(t, ate.OTG())
+		for _, p := range ports(dut) {
+			verifyIsolation(t, p, otgutils.ReadCapture(t, ate.OTG(), ate.Port(t, p.name).ID()))
+		}
+	})
+}
@@ -0,0 +1,351 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ntp_sync_test
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+)
+
+// The ATE does not emulate NTP servers, so synchronization is verified
+// against the NTP servers of the testbed, which the DUT reaches through its
+// default network instance and, optionally, through a non-default network
+// instance such as its management VRF.
+var (
+	ntpServers = flag.String("ntp_servers", "",
+		"comma separated addresses of the NTP servers reachable by the DUT in the default network instance; synchronization is skipped when empty")
+	ntpVRF = flag.String("ntp_vrf", "",
+		"non-default network instance, such as the management VRF, in which -ntp_vrf_servers are reachable")
+	ntpVRFServers = flag.String("ntp_vrf_servers", "",
+		"comma separated addresses of the NTP servers reachable by the DUT in -ntp_vrf")
+	ntpKeyID = flag.Uint("ntp_key_id", 1,
+		"ID of the MD5 key shared with the NTP servers")
+	ntpKey = flag.String("ntp_key", "",
+		"MD5 key shared with the NTP servers under -ntp_key_id; authentication is skipped when empty")
+	syncTimeout = flag.Duration("sync_timeout", 10*time.Minute,
+		"time allowed for the DUT to synchronize to an NTP server")
+	maxHostSkew = flag.Duration("max_host_skew", 2*time.Second,
+		"maximum allowed difference between the clock of the synchronized DUT and the clock of the test host")
+)
+
+const (
+	// vrfName is the non-default network instance of the configuration
+	// test when -ntp_vrf is not given.
+	vrfName = "VRF-1"
+
+	// unsynchronized is the stratum of a server which the DUT is not
+	// synchronized to.
+	unsynchronized = 16
+
+	// mismatchWindow is the time during which the DUT must not
+	// synchronize with an incorrect key. It covers the initial burst and
+	// more than one poll interval of 64 seconds.
+	mismatchWindow = 3 * time.Minute
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// server is an NTP server of the DUT.
+type server struct {
+	address string
+	vrf     string
+}
+
+// String returns the address of s and its network instance.
+func (s server) String() string {
+	if s.vrf == "" {
+		return s.address
+	}
+	return s.address + " in " + s.vrf
+}
+
+// flagServers returns the NTP servers given by the flags.
+func flagServers() []server {
+	var servers []server
+	for _, a := range splitAddresses(*ntpServers) {
+		servers = append(servers, server{address: a})
+	}
+	for _, a := range splitAddresses(*ntpVRFServers) {
+		servers = append(servers, server{address: a, vrf: *ntpVRF})
+	}
+	return servers
+}
+
+// splitAddresses splits the comma separated addresses of s.
+func splitAddresses(s string) []string {
+	var addrs []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// ntpKeyCLI is the CLI associating an NTP server with an authentication key,
+// which OpenConfig does not model.
+type ntpKeyCLI struct {
+	// server associates the server %[1]s of the default network instance
+	// with the key %[2]d.
+	server string
+	// vrfServer associates the server %[1]s of the network instance %[3]s
+	// with the key %[2]d.
+	vrfServer string
+}
+
+var ntpKeyCLIs = map[ondatra.Vendor]ntpKeyCLI{
+	ondatra.ARISTA: {
+		server:    "ntp server %[1]s key %[2]d\n",
+		vrfServer: "ntp server vrf %[3]s %[1]s key %[2]d\n",
+	},
+	ondatra.CISCO: {
+		server:    "ntp trusted-key %[2]d\nntp server %[1]s key %[2]d\n",
+		vrfServer: "ntp trusted-key %[2]d\nntp vrf %[3]s server %[1]s key %[2]d\n",
+	},
+}
+
+// ntpKeyCLIFor returns the NTP key CLI of the vendor of dut, skipping the
+// test if there is none.
+func ntpKeyCLIFor(t *testing.T, dut *ondatra.DUTDevice) ntpKeyCLI {
+	t.Helper()
+	c, ok := ntpKeyCLIs[dut.Vendor()]
+	if !ok {
+		t.Skipf("NTP server authentication keys are not supported for vendor %v", dut.Vendor())
+	}
+	return c
+}
+
+// configureNTP replaces the NTP configuration of dut with servers, the first
+// of which is preferred. If key is not empty, the servers are authenticated
+// with it under -ntp_key_id.
+func configureNTP(t *testing.T, dut *ondatra.DUTDevice, servers []server, key string) {
+	t.Helper()
+	d := &oc.Root{}
+	ntp := d.GetOrCreateSystem().GetOrCreateNtp()
+	ntp.SetEnabled(true)
+	for i, s := range servers {
+		srv := ntp.GetOrCreateServer(s.address)
+		srv.SetIburst(true)
+		srv.SetPrefer(i == 0)
+		if s.vrf != "" {
+			srv.SetNetworkInstance(s.vrf)
+		}
+	}
+	if key != "" {
+		ntp.SetEnableNtpAuth(true)
+		k := ntp.GetOrCreateNtpKey(uint16(*ntpKeyID))
+		k.SetKeyType(oc.System_NTP_AUTH_TYPE_NTP_AUTH_MD5)
+		k.SetKeyValue(key)
+	}
+	gnmi.Replace(t, dut, gnmi.OC().System().Ntp().Config(), ntp)
+
+	if key == "" {
+		return
+	}
+	c := ntpKeyCLIFor(t, dut)
+	var cli strings.Builder
+	for _, s := range servers {
+		if s.vrf == "" {
+			fmt.Fprintf(&cli, c.server, s.address, *ntpKeyID)
+		} else {
+			fmt.Fprintf(&cli, c.vrfServer, s.address, *ntpKeyID, s.vrf)
+		}
+	}
+	clihelper.Push(t, dut, &clihelper.Config{
+		Reason: "NTP server authentication keys",
+		CLI:    map[ondatra.Vendor]string{dut.Vendor(): cli.String()},
+	})
+}
+
+// createVRF creates an empty VRF with vrfName on dut.
+func createVRF(t *testing.T, dut *ondatra.DUTDevice, vrfName string) {
+	d := &oc.Root{}
+	ni := d.GetOrCreateNetworkInstance(vrfName)
+	ni.SetType(oc.NetworkInstanceTypes_NETWORK_INSTANCE_TYPE_L3VRF)
+
+	gnmi.Replace(t, dut, gnmi.OC().NetworkInstance(vrfName).Config(), ni)
+}
+
+// synchronized returns whether the stratum of s shows that the DUT is
+// synchronized to it.
+func synchronized(s *oc.System_Ntp_Server) bool {
+	return s.Stratum != nil && s.GetStratum() > 0 && s.GetStratum() < unsynchronized
+}
+
+// awaitSync waits for dut to synchronize to one of its NTP servers, and
+// returns the server.
+func awaitSync(t *testing.T, dut *ondatra.DUTDevice) *oc.System_Ntp_Server {
+	t.Helper()
+	var synced *oc.System_Ntp_Server
+	_, ok := gnmi.WatchAll(t, dut, gnmi.OC().System().Ntp().ServerAny().State(), *syncTimeout, func(v *ygnmi.Value[*oc.System_Ntp_Server]) bool {
+		s, present := v.Val()
+		if present && synchronized(s) {
+			synced = s
+			return true
+		}
+		return false
+	}).Await(t)
+	if !ok {
+		t.Fatalf("DUT did not synchronize to an NTP server within %v", *syncTimeout)
+	}
+	return synced
+}
+
+// dutClockSkew returns the difference between the clock of dut reported by
+// /system/state/current-datetime and the clock of the test host.
+func dutClockSkew(t *testing.T, dut *ondatra.DUTDevice) time.Duration {
+	t.Helper()
+	before := time.Now()
+	val := gnmi.Get(t, dut, gnmi.OC().System().CurrentDatetime().State())
+	// Compare against the midpoint of the Get to discount network latency.
+	host := before.Add(time.Since(before) / 2)
+	got, err := time.Parse(time.RFC3339Nano, val)
+	if err != nil {
+		t.Fatalf("Cannot parse current-datetime %q: %v", val, err)
+	}
+	if d := got.Sub(host); d >= 0 {
+		return d
+	}
+	return host.Sub(got)
+}
+
+// TestNTPConfig verifies the telemetry of NTP servers of the default and of
+// a non-default network instance, and of an authentication key.
+func TestNTPConfig(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+
+	servers := flagServers()
+	if len(servers) == 0 {
+		servers = []server{{address: "192.0.2.1"}, {address: "2001:db8::1"}}
+		if !deviations.NtpNonDefaultVrfUnsupported(dut) {
+			createVRF(t, dut, vrfName)
+			servers = append(servers, server{address: "192.0.2.2", vrf: vrfName}, server{address: "2001:db8::2", vrf: vrfName})
+		}
+	}
+	key := *ntpKey
+	if key == "" {
+		key = "featureprofiles"
+	}
+	configureNTP(t, dut, servers, key)
+
+	ntp := gnmi.Get(t, dut, gnmi.OC().System().Ntp().State())
+	if !ntp.GetEnabled() {
+		t.Errorf("NTP enabled: got false, want true")
+	}
+	if !ntp.GetEnableNtpAuth() {
+		t.Errorf("NTP authentication enabled: got false, want true")
+	}
+	if k := ntp.GetNtpKey(uint16(*ntpKeyID)); k == nil {
+		t.Errorf("Missing NTP key %d from NTP state", *ntpKeyID)
+	} else if got, want := k.GetKeyType(), oc.System_NTP_AUTH_TYPE_NTP_AUTH_MD5; got != want {
+		t.Errorf("NTP key %d type: got %v, want %v", *ntpKeyID, got, want)
+	}
+	for i, s := range servers {
+		srv := ntp.GetServer(s.address)
+		if srv == nil {
+			t.Errorf("Missing NTP server from NTP state: %v", s)
+			continue
+		}
+		if s.vrf != "" {
+			if got := srv.GetNetworkInstance(); got != s.vrf {
+				t.Errorf("NTP server %s network instance: got %q, want %q", s.address, got, s.vrf)
+			}
+		}
+		if !srv.GetIburst() {
+			t.Errorf("NTP server %v iburst: got false, want true", s)
+		}
+		if got, want := srv.GetPrefer(), i == 0; got != want {
+			t.Errorf("NTP server %v prefer: got %v, want %v", s, got, want)
+		}
+	}
+}
+
+// TestNTPSynchronization verifies that the DUT synchronizes to the NTP
+// servers of the testbed, authenticating them with -ntp_key if given, and
+// that its clock converges to the clock of the test host.
+func TestNTPSynchronization(t *testing.T) {
+	servers := flagServers()
+	if len(servers) == 0 {
+		t.Skip("No NTP servers given by -ntp_servers or -ntp_vrf_servers")
+	}
+	dut := ondatra.DUT(t, "dut")
+	configureNTP(t, dut, servers, *ntpKey)
+
+	synced := awaitSync(t, dut)
+	t.Logf("DUT synchronized to NTP server %s, stratum %d", synced.GetAddress(), synced.GetStratum())
+
+	for _, s := range servers {
+		srv := gnmi.Get(t, dut, gnmi.OC().System().Ntp().Server(s.address).State())
+		t.Logf("NTP server %v: stratum %d, offset %d, poll interval %d, root delay %d, root dispersion %d",
+			s, srv.GetStratum(), srv.GetOffset(), srv.GetPollInterval(), srv.GetRootDelay(), srv.GetRootDispersion())
+		if srv.Stratum == nil {
+			t.Errorf("NTP server %v: stratum is not reported", s)
+		}
+	}
+
+	// The clock of the DUT is slewed after synchronization, so it may take
+	// a while to converge.
+	var skew time.Duration
+	for start := time.Now(); time.Since(start) < *syncTimeout; time.Sleep(30 * time.Second) {
+		if skew = dutClockSkew(t, dut); skew <= *maxHostSkew {
+			t.Logf("DUT clock skew against host clock: %v", skew)
+			return
+		}
+	}
+	t.Errorf("DUT clock skew against host clock: got %v, want <= %v", skew, *maxHostSkew)
+}
+
+// TestNTPIncorrectKey verifies that the DUT does not synchronize to the NTP
+// servers of the testbed with an incorrect key, and counts the
+// authentication failures.
+func TestNTPIncorrectKey(t *testing.T) {
+	servers := flagServers()
+	if len(servers) == 0 || *ntpKey == "" {
+		t.Skip("No NTP servers given by -ntp_servers or -ntp_vrf_servers, or no key given by -ntp_key")
+	}
+	dut := ondatra.DUT(t, "dut")
+
+	before := gnmi.Get(t, dut, gnmi.OC().System().Ntp().State()).GetAuthMismatch()
+	configureNTP(t, dut, servers, *ntpKey+"-incorrect")
+	defer configureNTP(t, dut, servers, *ntpKey)
+
+	watcher := gnmi.WatchAll(t, dut, gnmi.OC().System().Ntp().ServerAny().State(), mismatchWindow, func(v *ygnmi.Value[*oc.System_Ntp_Server]) bool {
+		s, present := v.Val()
+		return present && synchronized(s)
+	})
+	if s, ok := watcher.Await(t); ok {
+		srv, _ := s.Val()
+		t.Errorf("DUT synchronized to NTP server %s with an incorrect key, stratum %d", srv.GetAddress(), srv.GetStratum())
+	}
+
+	after := gnmi.Get(t, dut, gnmi.OC().System().Ntp().State()).GetAuthMismatch()
+	t.Logf("NTP authentication mismatches: %d before, %d after the incorrect key", before, after)
+	if after <= before {
+		t.Errorf("NTP authentication mismatches: got %d, want > %d", after, before)
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh_hardening_test
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/clihelper"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	sshAddr = flag.String("ssh_addr", "",
+		"host:port of the SSH server of the DUT; if empty the DUT name and port 22 are used")
+)
+
+const (
+	user     = "fp-ssh-admin"
+	password = "fp-Passw0rd!"
+	// sessionLimit and rateLimit are the limits configured on the SSH
+	// server; rateLimit is in connections per minute.
+	sessionLimit = 2
+	rateLimit    = 4
+	dialTimeout  = 30 * time.Second
+)
+
+// The algorithms configured on the SSH server, and algorithms which the Go
+// client supports but the SSH server must refuse.
+var (
+	allowedCiphers    = []string{"aes256-gcm@openssh.com", "aes256-ctr"}
+	allowedMACs       = []string{"hmac-sha2-512", "hmac-sha2-256"}
+	allowedKEX        = []string{"curve25519-sha256", "diffie-hellman-group16-sha512"}
+	disallowedCiphers = []string{"aes128-ctr", "aes128-gcm@openssh.com", "chacha20-poly1305@openssh.com"}
+	disallowedMACs    = []string{"hmac-sha1", "hmac-sha1-96"}
+	disallowedKEX     = []string{"diffie-hellman-group14-sha1", "ecdh-sha2-nistp256"}
+)
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// sshCLI is the CLI of the SSH server configuration which OpenConfig does not
+// model, or which devices do not support.
+type sshCLI struct {
+	// algorithms restricts the ciphers %[1]s, MACs %[2]s and key exchange
+	// algorithms %[3]s, each separated by spaces.
+	algorithms string
+	// restoreAlgorithms restores the default algorithms.
+	restoreAlgorithms string
+	// limits sets the session limit %[1]d and the rate limit %[2]d.
+	limits string
+	// restoreLimits restores the default limits.
+	restoreLimits string
+}
+
+var sshCLIs = map[ondatra.Vendor]sshCLI{
+	ondatra.ARISTA: {
+		algorithms:        "management ssh\n   cipher %[1]s\n   mac %[2]s\n   key-exchange %[3]s\n",
+		restoreAlgorithms: "management ssh\n   no cipher\n   no mac\n   no key-exchange\n",
+	},
+	ondatra.CISCO: {
+		algorithms:        "ssh server algorithms cipher %[1]s\nssh server algorithms mac %[2]s\nssh server algorithms key-exchange %[3]s\n",
+		restoreAlgorithms: "no ssh server algorithms cipher\nno ssh server algorithms mac\nno ssh server algorithms key-exchange\n",
+		limits:            "ssh server session-limit %[1]d\nssh server rate-limit %[2]d\n",
+		restoreLimits:     "no ssh server session-limit\nno ssh server rate-limit\n",
+	},
+	ondatra.JUNIPER: {
+		algorithms:        "set system services ssh ciphers [ %[1]s ]\nset system services ssh macs [ %[2]s ]\nset system services ssh key-exchange [ %[3]s ]\n",
+		restoreAlgorithms: "delete system services ssh ciphers\ndelete system services ssh macs\ndelete system services ssh key-exchange\n",
+		limits:            "set system services ssh connection-limit %[1]d\nset system services ssh rate-limit %[2]d\n",
+		restoreLimits:     "delete system services ssh connection-limit\ndelete system services ssh rate-limit\n",
+	},
+}
+
+// sshCLIFor returns the SSH server CLI of the vendor of dut, skipping the test
+// if there is none.
+func sshCLIFor(t *testing.T, dut *ondatra.DUTDevice) sshCLI {
+	t.Helper()
+	c, ok := sshCLIs[dut.Vendor()]
+	if !ok {
+		t.Skipf("SSH server CLI is not supported for vendor %v", dut.Vendor())
+	}
+	return c
+}
+
+// createUser configures the local user of the DUT, and deletes it at the end
+// of the test.
+func createUser(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	path := gnmi.OC().System().Aaa().Authentication().User(user)
+	gnmi.Replace(t, dut, path.Config(), &oc.System_Aaa_Authentication_User{
+		Username: ygot.String(user),
+		Password: ygot.String(password),
+		Role:     oc.AaaTypes_SYSTEM_DEFINED_ROLES_SYSTEM_ROLE_ADMIN,
+	})
+	t.Cleanup(func() { gnmi.Delete(t, dut, path.Config()) })
+}
+
+// configureAlgorithms restricts the algorithms of the SSH server of dut to the
+// allowed ones, and restores the defaults at the end of the test. OpenConfig
+// does not model the algorithms, so they are configured with CLI.
+func configureAlgorithms(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	c := sshCLIFor(t, dut)
+	clihelper.Push(t, dut, &clihelper.Config{
+		Reason: "SSH server ciphers, MACs and key exchange algorithms",
+		CLI: map[ondatra.Vendor]string{dut.Vendor(): fmt.Sprintf(c.algorithms,
+			strings.Join(allowedCiphers, " "), strings.Join(allowedMACs, " "), strings.Join(allowedKEX, " "))},
+	})
+	t.Cleanup(func() {
+		clihelper.Push(t, dut, &clihelper.Config{
+			Reason: "SSH server default algorithms",
+			CLI:    map[ondatra.Vendor]string{dut.Vendor(): c.restoreAlgorithms},
+		})
+	})
+}
+
+// configureLimits sets the session limit and the rate limit of the SSH server
+// of dut, and restores the previous limits at the end of the test.
+func configureLimits(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	if !deviations.Supported(dut, "ssh_server_limits_oc") {
+		c := sshCLIFor(t, dut)
+		if c.limits == "" {
+			t.Skipf("SSH server limits are not supported for vendor %v", dut.Vendor())
+		}
+		clihelper.Push(t, dut, &clihelper.Config{
+			Reason: "SSH server session and rate limits",
+			CLI:    map[ondatra.Vendor]string{dut.Vendor(): fmt.Sprintf(c.limits, sessionLimit, rateLimit)},
+		})
+		t.Cleanup(func() {
+			clihelper.Push(t, dut, &clihelper.Config{
+				Reason: "SSH server default session and rate limits",
+				CLI:    map[ondatra.Vendor]string{dut.Vendor(): c.restoreLimits},
+			})
+		})
+		return
+	}
+
+	path := gnmi.OC().System().SshServer()
+	prevSession := gnmi.Lookup(t, dut, path.SessionLimit().Config())
+	prevRate := gnmi.Lookup(t, dut, path.RateLimit().Config())
+	gnmi.Update(t, dut, path.Config(), &oc.System_SshServer{
+		SessionLimit: ygot.Uint16(sessionLimit),
+		RateLimit:    ygot.Uint16(rateLimit),
+	})
+	t.Cleanup(func() {
+		if v, ok := prevSession.Val(); ok {
+			gnmi.Replace(t, dut, path.SessionLimit().Config(), v)
+		} else {
+			gnmi.Delete(t, dut, path.SessionLimit().Config())
+		}
+		if v, ok := prevRate.Val(); ok {
+			gnmi.Replace(t, dut, path.RateLimit().Config(), v)
+		} else {
+			gnmi.Delete(t, dut, path.RateLimit().Config())
+		}
+	})
+	if got := gnmi.Get(t, dut, path.SessionLimit().State()); got != sessionLimit {
+		t.Errorf("SSH server session-limit: got %d, want %d", got, sessionLimit)
+	}
+	if got := gnmi.Get(t, dut, path.RateLimit().State()); got != rateLimit {
+		t.Errorf("SSH server rate-limit: got %d, want %d", got, rateLimit)
+	}
+}
+
+// dial logs in to the SSH server of dut offering only the algorithms of
+// algos, or the defaults of the Go client for those which are empty, and opens
+// a session, which is closed with the client.
+func dial(dut *ondatra.DUTDevice, algos ssh.Config) (*ssh.Client, error) {
+	addr := *sshAddr
+	if addr == "" {
+		addr = net.JoinHostPort(dut.Name(), "22")
+	}
+	c, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		Config:          algos,
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         dialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.NewSession(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// allowed returns the allowed algorithms, in which the ciphers, MACs or key
+// exchange algorithms are replaced by those which are not nil.
+func allowed(ciphers, macs, kex []string) ssh.Config {
+	c := ssh.Config{Ciphers: allowedCiphers, MACs: allowedMACs, KeyExchanges: allowedKEX}
+	if ciphers != nil {
+		c.Ciphers = ciphers
+	}
+	if macs != nil {
+		c.MACs = macs
+	}
+	if kex != nil {
+		c.KeyExchanges = kex
+	}
+	return c
+}
+
+// TestAlgorithms verifies that the SSH server accepts clients offering only
+// one of the allowed algorithms, and refuses clients offering only one of the
+// disallowed algorithms.
+func TestAlgorithms(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	createUser(t, dut)
+	configureAlgorithms(t, dut)
+
+	// MACs are only negotiated with ciphers which are not AEAD.
+	const macCipher = "aes256-ctr"
+	tests := []struct {
+		desc   string
+		algos  []string
+		config func(string) ssh.Config
+	}{{
+		desc:   "Cipher",
+		algos:  append(append([]string{}, allowedCiphers...), disallowedCiphers...),
+		config: func(a string) ssh.Config { return allowed([]string{a}, nil, nil) },
+	}, {
+		desc:   "MAC",
+		algos:  append(append([]string{}, allowedMACs...), disallowedMACs...),
+		config: func(a string) ssh.Config { return allowed([]string{macCipher}, []string{a}, nil) },
+	}, {
+		desc:   "KEX",
+		algos:  append(append([]string{}, allowedKEX...), disallowedKEX...),
+		config: func(a string) ssh.Config { return allowed(nil, nil, []string{a}) },
+	}}
+	wantOK := map[string]bool{}
+	for _, a := range append(append(append([]string{}, allowedCiphers...), allowedMACs...), allowedKEX...) {
+		wantOK[a] = true
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			for _, a := range tt.algos {
+				t.Run(a, func(t *testing.T) {
+					c, err := dial(dut, tt.config(a))
+					if err == nil {
+						c.Close()
+					}
+					verifyLogin(t, err, wantOK[a])
+				})
+			}
+		})
+	}
+}
+
+// verifyLogin checks the outcome of a login against the algorithm policy.
+func verifyLogin(t *testing.T, err error, wantOK bool) {
+	t.Helper()
+	switch {
+	case wantOK && err != nil:
+		t.Errorf("SSH login failed, want success: %v", err)
+	case !wantOK && err == nil:
+		t.Errorf("SSH login succeeded, want the handshake refused")
+	case err != nil && strings.Contains(err.Error(), "unable to authenticate"):
+		t.Errorf("SSH login failed to authenticate, want the handshake refused: %v", err)
+	case err != nil:
+		t.Logf("SSH handshake refused as expected: %v", err)
+	}
+}
+
+// TestSessionLimit verifies that the SSH server refuses sessions beyond its
+// session limit, and accepts them again once a session is closed.
+func TestSessionLimit(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	createUser(t, dut)
+	configureLimits(t, dut)
+
+	var clients []*ssh.Client
+	for i := 0; i < sessionLimit; i++ {
+		c, err := dial(dut, ssh.Config{})
+		if err != nil {
+			t.Fatalf("SSH session %d of %d failed: %v", i+1, sessionLimit, err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+	}
+	if c, err := dial(dut, ssh.Config{}); err == nil {
+		c.Close()
+		t.Errorf("SSH session %d succeeded beyond the session limit %d, want refused", sessionLimit+1, sessionLimit)
+	} else {
+		t.Logf("SSH session beyond the session limit refused as expected: %v", err)
+	}
+
+	clients[0].Close()
+	// Leave the server the time to release the closed session.
+	time.Sleep(5 * time.Second)
+	c, err := dial(dut, ssh.Config{})
+	if err != nil {
+		t.Fatalf("SSH session after closing one failed: %v", err)
+	}
+	c.Close()
+}
+
+// TestRateLimit verifies that the SSH server refuses connections beyond its
+// rate limit, and accepts them again in the next minute.
+func TestRateLimit(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	createUser(t, dut)
+	configureLimits(t, dut)
+	// Start from a new minute of the rate limit.
+	time.Sleep(time.Minute)
+
+	start := time.Now()
+	refused := 0
+	// Connections are closed at once, so that the session limit is not
+	// reached.
+	for i := 0; i < 2*rateLimit; i++ {
+		c, err := dial(dut, ssh.Config{})
+		if err != nil {
+			t.Logf("SSH connection %d refused: %v", i+1, err)
+			refused++
+			continue
+		}
+		c.Close()
+	}
+	if elapsed := time.Since(start); elapsed >= time.Minute {
+		t.Fatalf("%d SSH connections took %v, want less than a minute", 2*rateLimit, elapsed)
+	}
+	if want := rateLimit; refused < want {
+		t.Errorf("SSH connections refused within a minute: got %d, want at least %d with rate limit %d", refused, want, rateLimit)
+	}
+
+	time.Sleep(time.Minute)
+	c, err := dial(dut, ssh.Config{})
+	if err != nil {
+		t.Fatalf("SSH connection after the rate limit minute failed: %v", err)
+	}
+	c.Close()
+}
@@ -0,0 +1,310 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system_identity_test
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	sshAddr = flag.String("ssh_addr", "",
+		"host:port of the SSH server of the DUT; if empty the DUT name and port 22 are used")
+)
+
+const (
+	user     = "fp-identity-admin"
+	password = "fp-Passw0rd!"
+	// telemetryTimeout is the time left to the DUT to reflect the
+	// configuration in telemetry.
+	telemetryTimeout = time.Minute
+	dialTimeout      = 30 * time.Second
+	// motdTimeout is the time left to the DUT to print the motd banner
+	// once the shell is started.
+	motdTimeout = 30 * time.Second
+)
+
+// banners are the login and motd banners tested.
+var banners = []struct {
+	desc   string
+	banner string
+}{
+	{"Single line", "Authorized access only"},
+	{"Multi-line", "Authorized access only\nAll activity is logged\n\nDisconnect now if you are not authorized"},
+	{"Unicode", "Accès autorisé uniquement — 許可されたアクセスのみ ✓"},
+	{"Unicode multi-line", "┌──────────────┐\n│  Bienvenue!  │\n│  ようこそ!   │\n└──────────────┘"},
+}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// preserve restores the configuration of q at the end of the test to its
+// value before the test, or deletes it if it was not configured.
+func preserve[T any](t *testing.T, dut *ondatra.DUTDevice, q ygnmi.ConfigQuery[T]) {
+	t.Helper()
+	prev := gnmi.Lookup(t, dut, q)
+	t.Cleanup(func() {
+		if v, ok := prev.Val(); ok {
+			gnmi.Replace(t, dut, q, v)
+		} else {
+			gnmi.Delete(t, dut, q)
+		}
+	})
+}
+
+// replaceAndVerify replaces the configuration of config with want, and
+// verifies that both config and state report it.
+func replaceAndVerify(t *testing.T, dut *ondatra.DUTDevice, config ygnmi.ConfigQuery[string], state ygnmi.SingletonQuery[string], want string) {
+	t.Helper()
+	gnmi.Replace(t, dut, config, want)
+	if got := gnmi.Get(t, dut, config); got != want {
+		t.Errorf("Config %v: got %q, want %q", config, got, want)
+	}
+	if deviations.CLITakesPrecedenceOverOC(dut) {
+		return
+	}
+	got, ok := gnmi.Watch(t, dut, state, telemetryTimeout, func(v *ygnmi.Value[string]) bool {
+		got, ok := v.Val()
+		return ok && got == want
+	}).Await(t)
+	if !ok {
+		v, _ := got.Val()
+		t.Errorf("State %v: got %q, want %q", state, v, want)
+	}
+}
+
+// createUser configures the local user of the DUT, and deletes it at the end
+// of the test.
+func createUser(t *testing.T, dut *ondatra.DUTDevice) {
+	t.Helper()
+	path := gnmi.OC().System().Aaa().Authentication().User(user)
+	gnmi.Replace(t, dut, path.Config(), &oc.System_Aaa_Authentication_User{
+		Username: ygot.String(user),
+		Password: ygot.String(password),
+		Role:     oc.AaaTypes_SYSTEM_DEFINED_ROLES_SYSTEM_ROLE_ADMIN,
+	})
+	t.Cleanup(func() { gnmi.Delete(t, dut, path.Config()) })
+}
+
+// dial logs in to the SSH server of dut, passing the banners which the server
+// sends before authentication to banner.
+func dial(dut *ondatra.DUTDevice, banner ssh.BannerCallback) (*ssh.Client, error) {
+	addr := *sshAddr
+	if addr == "" {
+		addr = net.JoinHostPort(dut.Name(), "22")
+	}
+	return ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		BannerCallback:  banner,
+		Timeout:         dialTimeout,
+	})
+}
+
+// normalize returns s with the line endings of a terminal, which SSH servers
+// may use for banners, replaced by newlines.
+func normalize(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "")
+}
+
+// awaitOutput reads r, the output of session s, until it contains want once
+// normalized, closing s if it does not within timeout.
+func awaitOutput(s *ssh.Session, r io.Reader, want string, timeout time.Duration) (string, error) {
+	timer := time.AfterFunc(timeout, func() { s.Close() })
+	defer timer.Stop()
+	var out strings.Builder
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		out.Write(buf[:n])
+		if strings.Contains(normalize(out.String()), want) {
+			return out.String(), nil
+		}
+		if err != nil {
+			return out.String(), fmt.Errorf("output does not contain %q: %w", want, err)
+		}
+	}
+}
+
+// TestHostname verifies that the hostname is reported by config and state.
+//
+// config_path:/system/config/hostname
+// telemetry_path:/system/state/hostname
+func TestHostname(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	config := gnmi.OC().System().Hostname().Config()
+	preserve(t, dut, config)
+
+	for _, tc := range []struct {
+		desc     string
+		hostname string
+	}{
+		{"Single character", "x"},
+		{"With hyphens", "fp-dut-1"},
+		// The maximum length of a label of a domain name.
+		{"63 characters", strings.Repeat("fp-hostname-", 5) + "end"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			replaceAndVerify(t, dut, config, gnmi.OC().System().Hostname().State(), tc.hostname)
+		})
+	}
+}
+
+// TestDomainName verifies that the domain name is reported by config and
+// state.
+//
+// config_path:/system/config/domain-name
+// telemetry_path:/system/state/domain-name
+func TestDomainName(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	config := gnmi.OC().System().DomainName().Config()
+	preserve(t, dut, config)
+
+	for _, tc := range []struct {
+		desc   string
+		domain string
+	}{
+		{"Single label", "lab"},
+		{"Multiple labels", "fp.lab.example.com"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			replaceAndVerify(t, dut, config, gnmi.OC().System().DomainName().State(), tc.domain)
+		})
+	}
+}
+
+// TestTimezone verifies that the timezone is reported by config and state,
+// and that the current date and time of the DUT are given with the offset of
+// the timezone.
+//
+// config_path:/system/clock/config/timezone-name
+// telemetry_path:/system/clock/state/timezone-name
+// telemetry_path:/system/state/current-datetime
+func TestTimezone(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	config := gnmi.OC().System().Clock().TimezoneName().Config()
+	preserve(t, dut, config)
+
+	for _, tz := range []string{"Etc/UTC", "America/Chicago", "Asia/Kolkata", "Australia/Adelaide"} {
+		t.Run(tz, func(t *testing.T) {
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				t.Fatalf("Cannot load timezone %s: %v", tz, err)
+			}
+			replaceAndVerify(t, dut, config, gnmi.OC().System().Clock().TimezoneName().State(), tz)
+
+			now := gnmi.Get(t, dut, gnmi.OC().System().CurrentDatetime().State())
+			got, err := time.Parse(time.RFC3339, now)
+			if err != nil {
+				t.Fatalf("Cannot parse current-datetime %q: %v", now, err)
+			}
+			_, gotOffset := got.Zone()
+			if _, wantOffset := got.In(loc).Zone(); gotOffset != wantOffset {
+				t.Errorf("current-datetime: got %s, want offset %v of %s", now, time.Duration(wantOffset)*time.Second, tz)
+			}
+		})
+	}
+}
+
+// TestLoginBanner verifies that the login banner is reported by config and
+// state, and is the banner which the SSH server sends before authentication.
+//
+// config_path:/system/config/login-banner
+// telemetry_path:/system/state/login-banner
+func TestLoginBanner(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	config := gnmi.OC().System().LoginBanner().Config()
+	preserve(t, dut, config)
+	createUser(t, dut)
+
+	for _, tc := range banners {
+		t.Run(tc.desc, func(t *testing.T) {
+			replaceAndVerify(t, dut, config, gnmi.OC().System().LoginBanner().State(), tc.banner)
+
+			var got []string
+			c, err := dial(dut, func(msg string) error {
+				got = append(got, msg)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Cannot log in to the SSH server: %v", err)
+			}
+			defer c.Close()
+			if !strings.Contains(normalize(strings.Join(got, "")), tc.banner) {
+				t.Errorf("SSH login banner: got %q, want %q", got, tc.banner)
+			}
+		})
+	}
+}
+
+// TestMotdBanner verifies that the motd banner is reported by config and
+// state, and is printed by the shell of an SSH session.
+//
+// config_path:/system/config/motd-banner
+// telemetry_path:/system/state/motd-banner
+func TestMotdBanner(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	config := gnmi.OC().System().MotdBanner().Config()
+	preserve(t, dut, config)
+	createUser(t, dut)
+
+	for _, tc := range banners {
+		t.Run(tc.desc, func(t *testing.T) {
+			replaceAndVerify(t, dut, config, gnmi.OC().System().MotdBanner().State(), tc.banner)
+
+			c, err := dial(dut, nil)
+			if err != nil {
+				t.Fatalf("Cannot log in to the SSH server: %v", err)
+			}
+			defer c.Close()
+			s, err := c.NewSession()
+			if err != nil {
+				t.Fatalf("Cannot open SSH session: %v", err)
+			}
+			defer s.Close()
+			// The terminal is wide enough for the lines of the banners not to
+			// be wrapped.
+			if err := s.RequestPty("vt100", 40, 500, ssh.TerminalModes{ssh.ECHO: 0}); err != nil {
+				t.Fatalf("Cannot request a terminal: %v", err)
+			}
+			out, err := s.StdoutPipe()
+			if err != nil {
+				t.Fatalf("Cannot read the output of the SSH session: %v", err)
+			}
+			if err := s.Shell(); err != nil {
+				t.Fatalf("Cannot start the shell: %v", err)
+			}
+			if got, err := awaitOutput(s, out, tc.banner, motdTimeout); err != nil {
+				t.Errorf("SSH session output: got %q, want motd banner: %v", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system_process_test
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ondatra/netutil"
+	"github.com/openconfig/ygot/ygot"
+)
+
+var (
+	churnIterations = flag.Int("churn_iterations", 100,
+		"number of iterations of the config churn loop over which memory growth is measured")
+	warmupIterations = flag.Int("warmup_iterations", 10,
+		"number of iterations of the config churn loop before the memory usage baseline is taken")
+	maxMemoryGrowth = flag.Float64("max_memory_growth", 10,
+		"maximum growth of the memory usage of a daemon over the config churn loop, in percent of the baseline")
+)
+
+const (
+	// churnLoopbacks and churnRoutes are the numbers of loopback interfaces
+	// and of static routes created and deleted by each iteration of the
+	// config churn loop.
+	churnLoopbacks = 10
+	churnRoutes    = 100
+	// churnLoopbackIndex is the index of the first loopback interface of the
+	// config churn loop.
+	churnLoopbackIndex = 100
+	churnNextHop       = "192.0.2.254"
+	// settleTime is the time left to the daemons to release memory after
+	// the config churn loop, and to update their telemetry.
+	settleTime = time.Minute
+)
+
+// daemon is a key process of the DUT.
+type daemon struct {
+	desc string
+	// names are the process names of the daemon per vendor.
+	names map[ondatra.Vendor]string
+}
+
+var daemons = []daemon{{
+	desc: "Routing",
+	names: map[ondatra.Vendor]string{
+		ondatra.ARISTA:  "Bgp-main",
+		ondatra.CISCO:   "bgp",
+		ondatra.JUNIPER: "rpd",
+		ondatra.NOKIA:   "sr_bgp_mgr",
+	},
+}, {
+	desc: "gRIBI",
+	names: map[ondatra.Vendor]string{
+		ondatra.ARISTA:  "Gribi",
+		ondatra.CISCO:   "emsd",
+		ondatra.JUNIPER: "rpd",
+		ondatra.NOKIA:   "sr_gribi_server",
+	},
+}, {
+	desc: "gNMI",
+	names: map[ondatra.Vendor]string{
+		ondatra.ARISTA:  "Octa",
+		ondatra.CISCO:   "emsd",
+		ondatra.JUNIPER: "na-grpcd",
+		ondatra.NOKIA:   "sr_grpc_server",
+	},
+}}
+
+func TestMain(m *testing.M) {
+	fptest.RunTests(m)
+}
+
+// findProcess returns the process of procs named name, or nil if there is
+// none.
+func findProcess(procs []*oc.System_Process, name string) *oc.System_Process {
+	for _, p := range procs {
+		if p.GetName() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// processName returns the process name of d on dut, skipping the test if the
+// vendor of dut has none.
+func processName(t *testing.T, dut *ondatra.DUTDevice, d daemon) string {
+	t.Helper()
+	name, ok := d.names[dut.Vendor()]
+	if !ok {
+		t.Skipf("%s process name is not known for vendor %v", d.desc, dut.Vendor())
+	}
+	return name
+}
+
+// TestProcesses verifies the telemetry of all the processes of the DUT, and
+// that the key daemons are running.
+//
+// telemetry_path:/system/processes/process/state/pid
+// telemetry_path:/system/processes/process/state/name
+// telemetry_path:/system/processes/process/state/start-time
+// telemetry_path:/system/processes/process/state/cpu-utilization
+// telemetry_path:/system/processes/process/state/memory-usage
+// telemetry_path:/system/processes/process/state/memory-utilization
+func TestProcesses(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	bootTime := gnmi.Get(t, dut, gnmi.OC().System().BootTime().State())
+	procs := gnmi.GetAll(t, dut, gnmi.OC().System().ProcessAny().State())
+	now := uint64(time.Now().UnixNano())
+	if len(procs) == 0 {
+		t.Fatalf("No processes in telemetry")
+	}
+	t.Logf("DUT reports %d processes", len(procs))
+
+	pids := map[uint64]string{}
+	for _, p := range procs {
+		if prev, ok := pids[p.GetPid()]; ok {
+			t.Errorf("PID %d is reported for processes %q and %q", p.GetPid(), prev, p.GetName())
+		}
+		pids[p.GetPid()] = p.GetName()
+		if p.GetName() == "" {
+			t.Errorf("Process %d has no name", p.GetPid())
+		}
+		if p.CpuUtilization != nil && p.GetCpuUtilization() > 100 {
+			t.Errorf("Process %d %q cpu-utilization: got %d, want <= 100", p.GetPid(), p.GetName(), p.GetCpuUtilization())
+		}
+		if p.MemoryUtilization != nil && p.GetMemoryUtilization() > 100 {
+			t.Errorf("Process %d %q memory-utilization: got %d, want <= 100", p.GetPid(), p.GetName(), p.GetMemoryUtilization())
+		}
+	}
+
+	for _, d := range daemons {
+		t.Run(d.desc, func(t *testing.T) {
+			name := processName(t, dut, d)
+			p := findProcess(procs, name)
+			if p == nil {
+				t.Fatalf("No process named %q", name)
+			}
+			t.Logf("Process %d %q: cpu-utilization %d%%, memory-usage %d bytes, memory-utilization %d%%",
+				p.GetPid(), name, p.GetCpuUtilization(), p.GetMemoryUsage(), p.GetMemoryUtilization())
+			if p.GetPid() == 0 {
+				t.Errorf("Process %q pid: got 0, want > 0", name)
+			}
+			if p.CpuUtilization == nil {
+				t.Errorf("Process %q has no cpu-utilization", name)
+			}
+			if p.GetMemoryUsage() == 0 {
+				t.Errorf("Process %q memory-usage: got 0, want > 0", name)
+			}
+			if p.MemoryUtilization == nil {
+				t.Errorf("Process %q has no memory-utilization", name)
+			}
+			if st := p.GetStartTime(); st < bootTime || st > now {
+				t.Errorf("Process %q start-time: got %d, want between boot-time %d and now %d", name, st, bootTime, now)
+			}
+		})
+	}
+}
+
+// churnConfig returns the configuration created and deleted by each iteration
+// of the config churn loop: loopback interfaces with addresses, and static
+// routes.
+func churnConfig(t *testing.T, dut *ondatra.DUTDevice) ([]*oc.Interface, *oc.NetworkInstance_Protocol) {
+	t.Helper()
+	var intfs []*oc.Interface
+	for i := 0; i < churnLoopbacks; i++ {
+		name := netutil.LoopbackInterface(t, dut, churnLoopbackIndex+i)
+		intf := &oc.Interface{Name: ygot.String(name)}
+		intf.SetType(oc.IETFInterfaces_InterfaceType_softwareLoopback)
+		intf.SetDescription(fmt.Sprintf("config churn %d", i))
+		s := intf.GetOrCreateSubinterface(0).GetOrCreateIpv4()
+		if deviations.InterfaceEnabled(dut) {
+			s.SetEnabled(true)
+		}
+		s.GetOrCreateAddress(fmt.Sprintf("198.18.%d.1", i)).SetPrefixLength(32)
+		intfs = append(intfs, intf)
+	}
+
+	ni := &oc.NetworkInstance{Name: ygot.String(deviations.DefaultNetworkInstance(dut))}
+	static := ni.GetOrCreateProtocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_STATIC, deviations.StaticProtocolName(dut))
+	for i := 0; i < churnRoutes; i++ {
+		sr := static.GetOrCreateStatic(fmt.Sprintf("198.51.100.%d/32", i))
+		sr.GetOrCreateNextHop("0").NextHop = oc.UnionString(churnNextHop)
+	}
+	return intfs, static
+}
+
+// churn creates and deletes intfs and the static routes of static on dut n
+// times.
+func churn(t *testing.T, dut *ondatra.DUTDevice, intfs []*oc.Interface, static *oc.NetworkInstance_Protocol, n int) {
+	t.Helper()
+	sp := gnmi.OC().NetworkInstance(deviations.DefaultNetworkInstance(dut)).Protocol(oc.PolicyTypes_INSTALL_PROTOCOL_TYPE_STATIC, deviations.StaticProtocolName(dut))
+	for i := 0; i < n; i++ {
+		create := &gnmi.SetBatch{}
+		for _, intf := range intfs {
+			gnmi.BatchReplace(create, gnmi.OC().Interface(intf.GetName()).Config(), intf)
+		}
+		for prefix, sr := range static.Static {
+			gnmi.BatchReplace(create, sp.Static(prefix).Config(), sr)
+		}
+		create.Set(t, dut)
+
+		del := &gnmi.SetBatch{}
+		for _, intf := range intfs {
+			gnmi.BatchDelete(del, gnmi.OC().Interface(intf.GetName()).Config())
+		}
+		for prefix := range static.Static {
+			gnmi.BatchDelete(del, sp.Static(prefix).Config())
+		}
+		del.Set(t, dut)
+	}
+}
+
+// TestMemoryGrowth verifies that the memory usage of the key daemons does not
+// grow by more than -max_memory_growth over a loop creating and deleting
+// configuration, and that they are not restarted.
+//
+// telemetry_path:/system/processes/process/state/memory-usage
+func TestMemoryGrowth(t *testing.T) {
+	dut := ondatra.DUT(t, "dut")
+	var names []string
+	for _, d := range daemons {
+		if name, ok := d.names[dut.Vendor()]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		t.Skipf("Process names are not known for vendor %v", dut.Vendor())
+	}
+
+	intfs, static := churnConfig(t, dut)
+	// The warm-up lets the daemons allocate the memory which they keep once
+	// the configuration has been seen.
+	churn(t, dut, intfs, static, *warmupIterations)
+	time.Sleep(settleTime)
+	before := gnmi.GetAll(t, dut, gnmi.OC().System().ProcessAny().State())
+
+	start := time.Now()
+	churn(t, dut, intfs, static, *churnIterations)
+	t.Logf("Config churn loop of %d iterations took %v", *churnIterations, time.Since(start))
+	time.Sleep(settleTime)
+	after := gnmi.GetAll(t, dut, gnmi.OC().System().ProcessAny().State())
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		t.Run(name, func(t *testing.T) {
+			b, a := findProcess(before, name), findProcess(after, name)
+			if b == nil || a == nil {
+				t.Fatalf("Process %q before the loop: %v, after the loop: %v, want both", name, b, a)
+			}
+			if b.GetPid() != a.GetPid() {
+				t.Errorf("Process %q restarted during the loop: pid %d, now %d", name, b.GetPid(), a.GetPid())
+				return
+			}
+			if b.GetMemoryUsage() == 0 {
+				t.Fatalf("Process %q has no memory-usage", name)
+			}
+			growth := (float64(a.GetMemoryUsage()) - float64(b.GetMemoryUsage())) / float64(b.GetMemoryUsage()) * 100
+			t.Logf("Process %q memory-usage: %d bytes before, %d bytes after, growth %.1f%%", name, b.GetMemoryUsage(), a.GetMemoryUsage(), growth)
+			if growth > *maxMemoryGrowth {
+				t.Errorf("Process %q memory-usage grew by %.1f%% over %d iterations, want <= %.1f%%", name, growth, *churnIterations, *maxMemoryGrowth)
+			}
+		})
+	}
+}
@@ -39,6 +39,7 @@ var (
 	FabricChipNamePattern         = flag.String("arg_fabricChip_name_pattern", "", "This name pattern is used to filter out FabricChip components.")
 	CheckInterfacesInBinding      = flag.Bool("arg_check_interfaces_in_binding", true, "GNOI tests perform interface status validation based on all interfaces. This can cause flakiness in testing environments where only connectivity of interfaces in binding is guaranteed.")
 	ConvergencePathChange         = flag.Uint64("arg_convergence_path_change", 250, "Traffic loss expected during path change set as 250 ms")
+	SwitchoverLossBudget          = flag.Duration("arg_switchover_loss_budget", 0, "Maximum duration of traffic loss allowed during a supervisor switchover. The default of 0 expects the switchover to be hitless.")
 	DefaultVRFIPv4Count           = flag.Int("arg_default_vrf_ipv4_count", 1064, "In gRIBI scaling tests, the number of IPv4 entries to install in default network instance for recursive lookup")
 	DefaultVRFIPv4NHSize          = flag.Int("arg_default_vrf_ipv4_nh_size", 8, "In gRIBI scaling tests, the number of next-hops in each next-hop-group installed in default network instance")
 	DefaultVRFIPv4NHGWeightSum    = flag.Int("arg_default_vrf_ipv4_nhg_weight_sum", 64, "In gRIBI scaling tests, the sum of weights to assign to next-hops within a next-hop-group in the default network instance")
@@ -13,7 +13,8 @@
 // limitations under the License.
 
 // Package attrs bundles some common interface attributes and provides
-// helpers to generate the appropriate OpenConfig and ATETopology.
+// helpers to generate the appropriate OpenConfig, ATETopology and OTG
+// configuration.
 //
 // The use of this package in new tests is discouraged.  Legacy tests using this package
 // will be migrated to use testbed topology helpers.
@@ -21,18 +22,57 @@ package attrs
 
 import (
 	"fmt"
+	"testing"
 
 	"github.com/open-traffic-generator/snappi/gosnappi"
 	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
 	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
 	"github.com/openconfig/ondatra/gnmi/oc"
 	"github.com/openconfig/ygot/ygot"
 )
 
+// Address is an IP address with its prefix length.
+type Address struct {
+	IP  string
+	Len uint8
+}
+
+// CIDR constructs the CIDR notation of the address, e.g. "192.0.2.1/30".
+func (a Address) CIDR() string {
+	return fmt.Sprintf("%s/%d", a.IP, a.Len)
+}
+
+// Secondary are the secondary addresses of an interface. The gateway of the
+// i-th address on the ATE is the i-th address of the peer, or its primary
+// address if the peer has fewer.
+type Secondary struct {
+	IPv4 []Address // Secondary IPv4 addresses.
+	IPv6 []Address // Additional IPv6 addresses.
+}
+
+func (s *Secondary) ipv4() []Address {
+	if s == nil {
+		return nil
+	}
+	return s.IPv4
+}
+
+func (s *Secondary) ipv6() []Address {
+	if s == nil {
+		return nil
+	}
+	return s.IPv6
+}
+
 // Attributes bundles some common attributes for devices and/or interfaces.
 // It provides helpers to generate appropriate configuration for OpenConfig
 // and for an ATETopology.  All fields are optional; only those that are
 // non-empty will be set when configuring an interface.
+//
+// Attributes are comparable, and tests use them as map keys, so the secondary
+// addresses are held behind a pointer.
 type Attributes struct {
 	IPv4    string
 	IPv6    string
@@ -43,6 +83,12 @@ type Attributes struct {
 	IPv6Len uint8  // Prefix length for IPv6.
 	MTU     uint16
 	ID      uint32 // /interfaces/interface/state/id p4rt interface id
+
+	Secondary *Secondary
+	// VLAN is the VLAN ID of the single tagged subinterface on the DUT, whose
+	// index is the VLAN ID, and of the Ethernet of the ATE device. Zero means
+	// untagged subinterface 0.
+	VLAN uint16
 }
 
 // IPv4CIDR constructs the IPv4 CIDR notation with the given prefix
@@ -74,8 +120,15 @@ func (a *Attributes) ConfigOCInterface(intf *oc.Interface, dut *ondatra.DUTDevic
 		e.MacAddress = ygot.String(a.MAC)
 	}
 
-	s := intf.GetOrCreateSubinterface(0)
-	if a.IPv4 != "" {
+	s := intf.GetOrCreateSubinterface(a.Subinterface())
+	if a.VLAN > 0 {
+		if deviations.DeprecatedVlanID(dut) {
+			s.GetOrCreateVlan().VlanId = oc.UnionUint16(a.VLAN)
+		} else {
+			s.GetOrCreateVlan().GetOrCreateMatch().GetOrCreateSingleTagged().VlanId = ygot.Uint16(a.VLAN)
+		}
+	}
+	if a.IPv4 != "" || len(a.Secondary.ipv4()) > 0 {
 		s4 := s.GetOrCreateIpv4()
 		if deviations.InterfaceEnabled(dut) && !deviations.IPv4MissingEnabled(dut) {
 			s4.Enabled = ygot.Bool(true)
@@ -83,13 +136,22 @@ func (a *Attributes) ConfigOCInterface(intf *oc.Interface, dut *ondatra.DUTDevic
 		if a.MTU > 0 {
 			s4.Mtu = ygot.Uint16(a.MTU)
 		}
-		a4 := s4.GetOrCreateAddress(a.IPv4)
-		if a.IPv4Len > 0 {
-			a4.PrefixLength = ygot.Uint8(a.IPv4Len)
+		if a.IPv4 != "" {
+			a4 := s4.GetOrCreateAddress(a.IPv4)
+			if a.IPv4Len > 0 {
+				a4.PrefixLength = ygot.Uint8(a.IPv4Len)
+			}
+		}
+		for _, sec := range a.Secondary.ipv4() {
+			a4 := s4.GetOrCreateAddress(sec.IP)
+			a4.Type = oc.IfIp_Ipv4AddressType_SECONDARY
+			if sec.Len > 0 {
+				a4.PrefixLength = ygot.Uint8(sec.Len)
+			}
 		}
 	}
 
-	if a.IPv6 != "" {
+	if a.IPv6 != "" || len(a.Secondary.ipv6()) > 0 {
 		s6 := s.GetOrCreateIpv6()
 		if a.MTU > 0 {
 			s6.Mtu = ygot.Uint32(uint32(a.MTU))
@@ -97,19 +159,51 @@ func (a *Attributes) ConfigOCInterface(intf *oc.Interface, dut *ondatra.DUTDevic
 		if deviations.InterfaceEnabled(dut) {
 			s6.Enabled = ygot.Bool(true)
 		}
-		a6 := s6.GetOrCreateAddress(a.IPv6)
-		if a.IPv6Len > 0 {
-			a6.PrefixLength = ygot.Uint8(a.IPv6Len)
+		if a.IPv6 != "" {
+			a6 := s6.GetOrCreateAddress(a.IPv6)
+			if a.IPv6Len > 0 {
+				a6.PrefixLength = ygot.Uint8(a.IPv6Len)
+			}
+		}
+		for _, sec := range a.Secondary.ipv6() {
+			a6 := s6.GetOrCreateAddress(sec.IP)
+			if sec.Len > 0 {
+				a6.PrefixLength = ygot.Uint8(sec.Len)
+			}
 		}
 	}
 	return intf
 }
 
+// Subinterface returns the index of the subinterface of these attributes,
+// which is the VLAN ID.
+func (a *Attributes) Subinterface() uint32 {
+	return uint32(a.VLAN)
+}
+
 // NewOCInterface returns a new *oc.Interface configured with these attributes.
 func (a *Attributes) NewOCInterface(name string, dut *ondatra.DUTDevice) *oc.Interface {
 	return a.ConfigOCInterface(&oc.Interface{Name: ygot.String(name)}, dut)
 }
 
+// AddToDUT configures the interface of dp on dut with these attributes, and
+// returns the configuration. It is the DUT counterpart of AddToOTG, so that
+// the attributes of both ends of a link are declared once. The configuration
+// is merged into the interface, so that the attributes of several VLANs may be
+// added to the same port.
+func (a *Attributes) AddToDUT(t testing.TB, dut *ondatra.DUTDevice, dp *ondatra.Port) *oc.Interface {
+	t.Helper()
+	intf := a.NewOCInterface(dp.Name(), dut)
+	gnmi.Update(t, dut, gnmi.OC().Interface(dp.Name()).Config(), intf)
+	if deviations.ExplicitPortSpeed(dut) {
+		fptest.SetPortSpeed(t, dp)
+	}
+	if deviations.ExplicitInterfaceInDefaultVRF(dut) {
+		fptest.AssignToNetworkInstance(t, dut, dp.Name(), deviations.DefaultNetworkInstance(dut), a.Subinterface())
+	}
+	return intf
+}
+
 // AddToATE adds a new interface to an ATETopology with these attributes.
 func (a *Attributes) AddToATE(top *ondatra.ATETopology, ap *ondatra.Port, peer *Attributes) *ondatra.Interface {
 	i := top.AddInterface(a.Name).WithPort(ap)
@@ -129,24 +223,61 @@ func (a *Attributes) AddToATE(top *ondatra.ATETopology, ap *ondatra.Port, peer *
 	return i
 }
 
-// AddToOTG adds basic elements to a gosnappi configuration
+// AddToOTG adds a device with these attributes on the port ap to a gosnappi
+// configuration. The port is added to the configuration if needed, so that
+// the attributes of several VLANs may be added to the same port.
 func (a *Attributes) AddToOTG(top gosnappi.Config, ap *ondatra.Port, peer *Attributes) gosnappi.Device {
-	top.Ports().Add().SetName(ap.ID())
+	return a.addToOTG(top, ap.ID(), peer)
+}
+
+func (a *Attributes) addToOTG(top gosnappi.Config, portName string, peer *Attributes) gosnappi.Device {
+	if !hasPort(top, portName) {
+		top.Ports().Add().SetName(portName)
+	}
 	dev := top.Devices().Add().SetName(a.Name)
 	eth := dev.Ethernets().Add().SetName(a.Name + ".Eth").SetMac(a.MAC)
-	eth.Connection().SetPortName(ap.ID())
+	eth.Connection().SetPortName(portName)
 
 	if a.MTU > 0 {
 		eth.SetMtu(uint32(a.MTU))
 	}
+	if a.VLAN > 0 {
+		eth.Vlans().Add().SetName(a.Name + ".VLAN").SetId(uint32(a.VLAN))
+	}
 	if a.IPv4 != "" {
 		ip := eth.Ipv4Addresses().Add().SetName(dev.Name() + ".IPv4")
 		ip.SetAddress(a.IPv4).SetGateway(peer.IPv4).SetPrefix(uint32(a.IPv4Len))
 	}
+	for i, sec := range a.Secondary.ipv4() {
+		gw := peer.IPv4
+		if peerSec := peer.Secondary.ipv4(); i < len(peerSec) {
+			gw = peerSec[i].IP
+		}
+		ip := eth.Ipv4Addresses().Add().SetName(fmt.Sprintf("%s.IPv4.%d", dev.Name(), i+1))
+		ip.SetAddress(sec.IP).SetGateway(gw).SetPrefix(uint32(sec.Len))
+	}
 	if a.IPv6 != "" {
 		ip := eth.Ipv6Addresses().Add().SetName(dev.Name() + ".IPv6")
 		ip.SetAddress(a.IPv6).SetGateway(peer.IPv6).SetPrefix(uint32(a.IPv6Len))
 	}
+	for i, sec := range a.Secondary.ipv6() {
+		gw := peer.IPv6
+		if peerSec := peer.Secondary.ipv6(); i < len(peerSec) {
+			gw = peerSec[i].IP
+		}
+		ip := eth.Ipv6Addresses().Add().SetName(fmt.Sprintf("%s.IPv6.%d", dev.Name(), i+1))
+		ip.SetAddress(sec.IP).SetGateway(gw).SetPrefix(uint32(sec.Len))
+	}
 
 	return dev
 }
+
+// hasPort returns whether top has a port named name.
+func hasPort(top gosnappi.Config, name string) bool {
+	for _, p := range top.Ports().Items() {
+		if p.Name() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attrs
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+)
+
+func TestAddToOTG(t *testing.T) {
+	dut := &Attributes{
+		IPv4:    "192.0.2.1",
+		IPv4Len: 30,
+		IPv6:    "2001:db8::1",
+		IPv6Len: 126,
+		Secondary: &Secondary{
+			IPv4: []Address{{IP: "198.51.100.1", Len: 30}},
+		},
+	}
+	ate10 := &Attributes{
+		Name:    "ate10",
+		MAC:     "02:00:01:01:01:01",
+		IPv4:    "192.0.2.2",
+		IPv4Len: 30,
+		IPv6:    "2001:db8::2",
+		IPv6Len: 126,
+		VLAN:    10,
+		Secondary: &Secondary{
+			IPv4: []Address{{IP: "198.51.100.2", Len: 30}, {IP: "203.0.113.2", Len: 30}},
+			IPv6: []Address{{IP: "2001:db8:1::2", Len: 64}},
+		},
+	}
+	ate20 := &Attributes{
+		Name:    "ate20",
+		MAC:     "02:00:01:01:01:02",
+		IPv4:    "192.0.2.6",
+		IPv4Len: 30,
+		VLAN:    20,
+	}
+
+	top := gosnappi.NewConfig()
+	ate10.addToOTG(top, "port1", dut)
+	ate20.addToOTG(top, "port1", dut)
+
+	if got := len(top.Ports().Items()); got != 1 {
+		t.Errorf("Number of ports: got %d, want 1", got)
+	}
+
+	type ip struct {
+		Name, Address, Gateway string
+		Prefix                 uint32
+	}
+	type device struct {
+		Port, VLAN string
+		VLANID     uint32
+		IPv4, IPv6 []ip
+	}
+	got := map[string]device{}
+	for _, d := range top.Devices().Items() {
+		eth := d.Ethernets().Items()[0]
+		dev := device{Port: eth.Connection().PortName()}
+		for _, v := range eth.Vlans().Items() {
+			dev.VLAN, dev.VLANID = v.Name(), v.Id()
+		}
+		for _, a := range eth.Ipv4Addresses().Items() {
+			dev.IPv4 = append(dev.IPv4, ip{a.Name(), a.Address(), a.Gateway(), a.Prefix()})
+		}
+		for _, a := range eth.Ipv6Addresses().Items() {
+			dev.IPv6 = append(dev.IPv6, ip{a.Name(), a.Address(), a.Gateway(), a.Prefix()})
+		}
+		got[d.Name()] = dev
+	}
+	want := map[string]device{
+		"ate10": {
+			Port:   "port1",
+			VLAN:   "ate10.VLAN",
+			VLANID: 10,
+			IPv4: []ip{
+				{"ate10.IPv4", "192.0.2.2", "192.0.2.1", 30},
+				{"ate10.IPv4.1", "198.51.100.2", "198.51.100.1", 30},
+				{"ate10.IPv4.2", "203.0.113.2", "192.0.2.1", 30},
+			},
+			IPv6: []ip{
+				{"ate10.IPv6", "2001:db8::2", "2001:db8::1", 126},
+				{"ate10.IPv6.1", "2001:db8:1::2", "2001:db8::1", 64},
+			},
+		},
+		"ate20": {
+			Port:   "port1",
+			VLAN:   "ate20.VLAN",
+			VLANID: 20,
+			IPv4:   []ip{{"ate20.IPv4", "192.0.2.6", "192.0.2.1", 30}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("addToOTG() got unexpected devices diff (-want +got): %s", diff)
+	}
+}
+
+func TestAttributesComparable(t *testing.T) {
+	// Tests use Attributes as map keys, which requires them to be comparable.
+	a := Attributes{Name: "ate", Secondary: &Secondary{IPv4: []Address{{IP: "198.51.100.2", Len: 30}}}}
+	gateways := map[Attributes]string{a: "192.0.2.1"}
+	if got := gateways[a]; got != "192.0.2.1" {
+		t.Errorf("gateways[a]: got %q, want %q", got, "192.0.2.1")
+	}
+}
+
+func TestAddressCIDR(t *testing.T) {
+	if got, want := (Address{IP: "2001:db8::1", Len: 126}).CIDR(), "2001:db8::1/126"; got != want {
+		t.Errorf("CIDR() got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clihelper pushes vendor CLI config for functionality that is not
+// yet modeled in OpenConfig, and tracks it per test.
+//
+// Like deviations, CLI config is a temporary workaround: every use must state
+// the functionality it configures, which is reported as a property of the test
+// named "cli.<n>", so that the use of CLI is visible in the test results next
+// to the deviations. Typical usage looks like:
+//
+//	clihelper.Push(t, dut, &clihelper.Config{
+//		Reason: "TLS cipher policy of the gRPC server",
+//		CLI: map[ondatra.Vendor]string{
+//			ondatra.ARISTA: aristaTLSPolicy,
+//			ondatra.CISCO:  ciscoTLSPolicy,
+//		},
+//	})
+//
+// The CLI is sent with gNMI Set using the "cli" origin, or with the CLI of the
+// binding, usually SSH, if Config.SSH is set.
+package clihelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/openconfig/ondatra"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// Method is the method used to push CLI config.
+type Method string
+
+const (
+	// GNMI sends the CLI with gNMI Set using the "cli" origin.
+	GNMI Method = "gnmi"
+	// SSH sends the CLI with the CLI of the binding.
+	SSH Method = "ssh"
+)
+
+// Config is CLI config for functionality not modeled in OpenConfig.
+type Config struct {
+	// Reason describes the functionality configured by the CLI. It is
+	// required.
+	Reason string
+	// CLI is the CLI config for each vendor.
+	CLI map[ondatra.Vendor]string
+	// SSH sends the CLI with the CLI of the binding instead of gNMI Set.
+	SSH bool
+}
+
+// Use is a recorded use of CLI config.
+type Use struct {
+	Reason string
+	Method Method
+	Vendor ondatra.Vendor
+	CLI    string
+}
+
+var (
+	mu   sync.Mutex
+	uses = map[string][]*Use{} // keyed by test name
+
+	// Stub out for unit tests.
+	addTestProperty = ondatra.Report().AddTestProperty
+)
+
+// SetRequest returns a SetRequest which updates the config with the CLI
+// config.
+func SetRequest(config string) *gpb.SetRequest {
+	return &gpb.SetRequest{
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{Origin: "cli", Elem: []*gpb.PathElem{}},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_AsciiVal{AsciiVal: config}},
+		}},
+	}
+}
+
+// cliFor returns the CLI config of c for vendor v.
+func (c *Config) cliFor(v ondatra.Vendor) (string, error) {
+	if c.Reason == "" {
+		return "", errors.New("CLI config without a reason")
+	}
+	cli, ok := c.CLI[v]
+	if !ok {
+		return "", fmt.Errorf("no CLI config for vendor %v to configure %s", v, c.Reason)
+	}
+	return cli, nil
+}
+
+// record records the use u by test t and reports it as a test property.
+func record(t testing.TB, u *Use) {
+	mu.Lock()
+	uses[t.Name()] = append(uses[t.Name()], u)
+	n := len(uses[t.Name()])
+	mu.Unlock()
+	addTestProperty(t, fmt.Sprintf("cli.%d", n), fmt.Sprintf("%s via %s", u.Reason, u.Method))
+}
+
+// Push pushes the CLI config of c for the vendor of dut, and records its use by
+// the test. It returns the output of the CLI if it is sent with SSH.
+func Push(t testing.TB, dut *ondatra.DUTDevice, c *Config) string {
+	t.Helper()
+	cli, err := c.cliFor(dut.Vendor())
+	if err != nil {
+		t.Fatalf("Cannot push CLI config to %s: %v", dut.Name(), err)
+	}
+	u := &Use{Reason: c.Reason, Method: GNMI, Vendor: dut.Vendor(), CLI: cli}
+	if c.SSH {
+		u.Method = SSH
+	}
+	record(t, u)
+	t.Logf("Pushing CLI config to %s via %s to configure %s:\n%s", dut.Name(), u.Method, c.Reason, cli)
+
+	if c.SSH {
+		res, err := dut.RawAPIs().CLI(t).RunCommand(context.Background(), cli)
+		if err != nil {
+			t.Fatalf("CLI config of %s: %v", dut.Name(), err)
+		}
+		if res.Error() != "" {
+			t.Fatalf("CLI config of %s: %s", dut.Name(), res.Error())
+		}
+		return res.Output()
+	}
+	if _, err := dut.RawAPIs().GNMI(t).Set(context.Background(), SetRequest(cli)); err != nil {
+		t.Fatalf("gNMI Set of CLI config of %s: %v", dut.Name(), err)
+	}
+	return ""
+}
+
+// Usage returns the uses of CLI config recorded by test t.
+func Usage(t testing.TB) []*Use {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]*Use(nil), uses[t.Name()]...)
+}
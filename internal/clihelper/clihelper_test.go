@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clihelper
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openconfig/ondatra"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func TestSetRequest(t *testing.T) {
+	want := &gpb.SetRequest{
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{Origin: "cli"},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_AsciiVal{AsciiVal: "hostname dut\n"}},
+		}},
+	}
+	if diff := cmp.Diff(want, SetRequest("hostname dut\n"), protocmp.Transform()); diff != "" {
+		t.Errorf("SetRequest() (-want +got):\n%s", diff)
+	}
+}
+
+func TestCLIFor(t *testing.T) {
+	tests := []struct {
+		desc    string
+		config  *Config
+		vendor  ondatra.Vendor
+		want    string
+		wantErr bool
+	}{{
+		desc:   "vendor found",
+		config: &Config{Reason: "foo", CLI: map[ondatra.Vendor]string{ondatra.ARISTA: "a", ondatra.CISCO: "c"}},
+		vendor: ondatra.CISCO,
+		want:   "c",
+	}, {
+		desc:    "vendor not found",
+		config:  &Config{Reason: "foo", CLI: map[ondatra.Vendor]string{ondatra.ARISTA: "a"}},
+		vendor:  ondatra.JUNIPER,
+		wantErr: true,
+	}, {
+		desc:    "no reason",
+		config:  &Config{CLI: map[ondatra.Vendor]string{ondatra.ARISTA: "a"}},
+		vendor:  ondatra.ARISTA,
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := tt.config.cliFor(tt.vendor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cliFor() got error %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("cliFor() got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	props := map[string]string{}
+	defer func(f func(testing.TB, string, string)) { addTestProperty = f }(addTestProperty)
+	addTestProperty = func(_ testing.TB, name, value string) { props[name] = value }
+
+	want := []*Use{
+		{Reason: "foo", Method: GNMI, Vendor: ondatra.ARISTA, CLI: "a"},
+		{Reason: "bar", Method: SSH, Vendor: ondatra.ARISTA, CLI: "b"},
+	}
+	for _, u := range want {
+		record(t, u)
+	}
+	if diff := cmp.Diff(want, Usage(t)); diff != "" {
+		t.Errorf("Usage() (-want +got):\n%s", diff)
+	}
+	wantProps := map[string]string{"cli.1": "foo via gnmi", "cli.2": "bar via ssh"}
+	if diff := cmp.Diff(wantProps, props); diff != "" {
+		t.Errorf("test properties (-want +got):\n%s", diff)
+	}
+	t.Run("subtest", func(t *testing.T) {
+		if got := Usage(t); len(got) != 0 {
+			t.Errorf("Usage() of a subtest got %v, want none", got)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package commitconfirm provides the gNMI Commit extension for the
+// commit-confirmed flow of gNMI Set: a SetRequest with a commit action is
+// rolled back by the target after its rollback duration unless it is
+// confirmed, and it can be cancelled, which rolls it back immediately.
+//
+// The version of the gnmi_ext proto used by featureprofiles predates the
+// Commit extension, so the extension is encoded here by hand into the
+// unknown fields of a gnmi_ext.Extension, following gnmi_ext.proto:
+//
+//	message Extension {
+//	  oneof ext {
+//	    ...
+//	    Commit commit = 4;
+//	  }
+//	}
+//	message Commit {
+//	  string id = 1;
+//	  oneof action {
+//	    CommitRequest commit = 2;
+//	    CommitConfirm confirm = 3;
+//	    CommitCancel cancel = 4;
+//	    CommitSetRollbackDuration set_rollback_duration = 5;
+//	  }
+//	}
+//	message CommitRequest { google.protobuf.Duration rollback_duration = 1; }
+//	message CommitSetRollbackDuration { google.protobuf.Duration rollback_duration = 1; }
+package commitconfirm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	extpb "github.com/openconfig/gnmi/proto/gnmi_ext"
+)
+
+// Field numbers of the Commit extension.
+const (
+	extensionCommitField = 4
+
+	commitIDField                  = 1
+	commitRequestField             = 2
+	commitConfirmField             = 3
+	commitCancelField              = 4
+	commitSetRollbackDurationField = 5
+
+	rollbackDurationField = 1
+)
+
+// Action is the action of a Commit extension.
+type Action int
+
+// Actions of the Commit extension.
+const (
+	// Commit commits the SetRequest, which is rolled back after the rollback
+	// duration unless it is confirmed.
+	Commit Action = iota
+	// Confirm confirms the commit with the ID, which is then not rolled back.
+	Confirm
+	// Cancel rolls back the commit with the ID immediately.
+	Cancel
+	// SetRollbackDuration changes the rollback duration of the commit with the
+	// ID.
+	SetRollbackDuration
+)
+
+func (a Action) String() string {
+	switch a {
+	case Commit:
+		return "commit"
+	case Confirm:
+		return "confirm"
+	case Cancel:
+		return "cancel"
+	case SetRollbackDuration:
+		return "set_rollback_duration"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+func (a Action) field() (protowire.Number, bool) {
+	switch a {
+	case Commit:
+		return commitRequestField, true
+	case Confirm:
+		return commitConfirmField, true
+	case Cancel:
+		return commitCancelField, true
+	case SetRollbackDuration:
+		return commitSetRollbackDurationField, true
+	}
+	return 0, false
+}
+
+// Spec is a Commit extension.
+type Spec struct {
+	// ID identifies the commit.
+	ID string
+	// Action is the action on the commit.
+	Action Action
+	// RollbackDuration is the rollback duration of the Commit and
+	// SetRollbackDuration actions. The target default is used if it is 0.
+	RollbackDuration time.Duration
+}
+
+// marshalDuration returns the encoding of d as a google.protobuf.Duration.
+func marshalDuration(d time.Duration) []byte {
+	var b []byte
+	if s := int64(d / time.Second); s != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(s))
+	}
+	if n := int32(d % time.Second); n != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(n))
+	}
+	return b
+}
+
+// marshalCommit returns the encoding of the Commit message of s.
+func (s *Spec) marshalCommit() ([]byte, error) {
+	field, ok := s.Action.field()
+	if !ok {
+		return nil, fmt.Errorf("invalid commit action %v", s.Action)
+	}
+	if s.ID == "" {
+		return nil, fmt.Errorf("commit action %v without an ID", s.Action)
+	}
+	var action []byte
+	if (s.Action == Commit || s.Action == SetRollbackDuration) && s.RollbackDuration != 0 {
+		action = protowire.AppendTag(action, rollbackDurationField, protowire.BytesType)
+		action = protowire.AppendBytes(action, marshalDuration(s.RollbackDuration))
+	}
+	var b []byte
+	b = protowire.AppendTag(b, commitIDField, protowire.BytesType)
+	b = protowire.AppendString(b, s.ID)
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	b = protowire.AppendBytes(b, action)
+	return b, nil
+}
+
+// Extension returns the gNMI extension of s.
+func (s *Spec) Extension() (*extpb.Extension, error) {
+	commit, err := s.marshalCommit()
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	b = protowire.AppendTag(b, extensionCommitField, protowire.BytesType)
+	b = protowire.AppendBytes(b, commit)
+	ext := &extpb.Extension{}
+	ext.ProtoReflect().SetUnknown(b)
+	return ext, nil
+}
+
+// Set sends req with the Commit extension of s with client c. The Confirm
+// and Cancel actions are sent without updates if req is nil.
+func Set(ctx context.Context, c gpb.GNMIClient, req *gpb.SetRequest, s *Spec) (*gpb.SetResponse, error) {
+	ext, err := s.Extension()
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		req = &gpb.SetRequest{}
+	}
+	req.Extension = append(req.Extension, ext)
+	resp, err := c.Set(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("gNMI Set with commit %s %s: %w", s.Action, s.ID, err)
+	}
+	return resp, nil
+}
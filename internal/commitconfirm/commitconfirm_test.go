@@ -0,0 +1,135 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commitconfirm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	extpb "github.com/openconfig/gnmi/proto/gnmi_ext"
+)
+
+// field is a decoded field of a message, with the decoded fields of
+// sub-messages in sub.
+type field struct {
+	num protowire.Number
+	val uint64
+	str string
+	sub []field
+}
+
+// decode decodes the message b at the field path of the Extension message.
+// Length-delimited fields are decoded as messages, except the ID of the
+// Commit message.
+func decode(t *testing.T, b []byte, path ...protowire.Number) []field {
+	t.Helper()
+	var fields []field
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("Invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		f := field{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.val, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			if len(path) == 1 && path[0] == extensionCommitField && num == commitIDField {
+				f.str = string(v)
+			} else if n >= 0 {
+				f.sub = decode(t, v, append(path, num)...)
+			}
+		default:
+			t.Fatalf("Unexpected wire type %v", typ)
+		}
+		if n < 0 {
+			t.Fatalf("Invalid field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func TestExtension(t *testing.T) {
+	tests := []struct {
+		desc string
+		spec *Spec
+		want []field
+	}{{
+		desc: "commit",
+		spec: &Spec{ID: "c1", Action: Commit, RollbackDuration: 90*time.Second + 5},
+		want: []field{{num: 4, sub: []field{
+			{num: 1, str: "c1"},
+			{num: 2, sub: []field{{num: 1, sub: []field{{num: 1, val: 90}, {num: 2, val: 5}}}}},
+		}}},
+	}, {
+		desc: "commit with default rollback duration",
+		spec: &Spec{ID: "c1", Action: Commit},
+		want: []field{{num: 4, sub: []field{{num: 1, str: "c1"}, {num: 2}}}},
+	}, {
+		desc: "confirm",
+		spec: &Spec{ID: "c2", Action: Confirm, RollbackDuration: time.Minute},
+		want: []field{{num: 4, sub: []field{{num: 1, str: "c2"}, {num: 3}}}},
+	}, {
+		desc: "cancel",
+		spec: &Spec{ID: "c3", Action: Cancel},
+		want: []field{{num: 4, sub: []field{{num: 1, str: "c3"}, {num: 4}}}},
+	}, {
+		desc: "set rollback duration",
+		spec: &Spec{ID: "c4", Action: SetRollbackDuration, RollbackDuration: 2 * time.Minute},
+		want: []field{{num: 4, sub: []field{
+			{num: 1, str: "c4"},
+			{num: 5, sub: []field{{num: 1, sub: []field{{num: 1, val: 120}}}}},
+		}}},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			ext, err := tt.spec.Extension()
+			if err != nil {
+				t.Fatalf("Extension() failed: %v", err)
+			}
+			b, err := proto.Marshal(ext)
+			if err != nil {
+				t.Fatalf("Cannot marshal the extension: %v", err)
+			}
+			// Decode the extension again to check that it is a valid message.
+			if err := proto.Unmarshal(b, &extpb.Extension{}); err != nil {
+				t.Fatalf("Cannot unmarshal the extension: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, decode(t, b), cmp.AllowUnexported(field{})); diff != "" {
+				t.Errorf("Extension() (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExtensionErrors(t *testing.T) {
+	for _, s := range []*Spec{
+		{Action: Commit},
+		{ID: "c1", Action: Action(42)},
+	} {
+		if _, err := s.Extension(); err == nil {
+			t.Errorf("Extension() of %+v got no error", s)
+		}
+	}
+}
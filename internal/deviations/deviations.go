@@ -13,7 +13,8 @@
 // limitations under the License.
 
 // Package deviations defines the arguments to enable temporary workarounds for the
-// featureprofiles test suite using command line flags.
+// featureprofiles test suite using the test metadata, platform profiles and
+// command line flags.
 //
 // If we consider device compliance level in tiers:
 //
@@ -53,21 +54,24 @@ import (
 	"github.com/openconfig/ondatra"
 )
 
-func lookupDeviations(dvc *ondatra.Device) (*mpb.Metadata_PlatformExceptions, error) {
+// matchPlatformExceptions returns the platform exceptions of pes matching the
+// vendor, hardware model and software version of a device, or nil if none
+// matches.
+func matchPlatformExceptions(pes []*mpb.Metadata_PlatformExceptions, vendor, model, version string) (*mpb.Metadata_PlatformExceptions, error) {
 	var matchedPlatformException *mpb.Metadata_PlatformExceptions
 
-	for _, platformExceptions := range metadata.Get().PlatformExceptions {
+	for _, platformExceptions := range pes {
 		if platformExceptions.GetPlatform().Vendor.String() == "" {
 			return nil, fmt.Errorf("vendor should be specified in textproto %v", platformExceptions)
 		}
 
-		if dvc.Vendor().String() != platformExceptions.GetPlatform().Vendor.String() {
+		if vendor != platformExceptions.GetPlatform().Vendor.String() {
 			continue
 		}
 
 		// If hardware_model_regex is set and does not match, continue
 		if hardwareModelRegex := platformExceptions.GetPlatform().GetHardwareModelRegex(); hardwareModelRegex != "" {
-			matchHw, errHw := regexp.MatchString(hardwareModelRegex, dvc.Model())
+			matchHw, errHw := regexp.MatchString(hardwareModelRegex, model)
 			if errHw != nil {
 				return nil, fmt.Errorf("error with regex match %v", errHw)
 			}
@@ -78,7 +82,7 @@ func lookupDeviations(dvc *ondatra.Device) (*mpb.Metadata_PlatformExceptions, er
 
 		// If software_version_regex is set and does not match, continue
 		if softwareVersionRegex := platformExceptions.GetPlatform().GetSoftwareVersionRegex(); softwareVersionRegex != "" {
-			matchSw, errSw := regexp.MatchString(softwareVersionRegex, dvc.Version())
+			matchSw, errSw := regexp.MatchString(softwareVersionRegex, version)
 			if errSw != nil {
 				return nil, fmt.Errorf("error with regex match %v", errSw)
 			}
@@ -95,16 +99,40 @@ func lookupDeviations(dvc *ondatra.Device) (*mpb.Metadata_PlatformExceptions, er
 	return matchedPlatformException, nil
 }
 
+// lookupDeviations returns the deviations of the platform profile of dvc,
+// overridden by the deviations of the platform exceptions of the test.
+func lookupDeviations(dvc *ondatra.Device) (*mpb.Metadata_Deviations, error) {
+	profiles, err := loadPlatformProfiles()
+	if err != nil {
+		return nil, err
+	}
+	vendor, model, version := dvc.Vendor().String(), dvc.Model(), dvc.Version()
+	profile, err := matchPlatformExceptions(profiles.GetPlatformExceptions(), vendor, model, version)
+	if err != nil {
+		return nil, fmt.Errorf("platform profiles %q: %w", *platformProfiles, err)
+	}
+	platformExceptions, err := matchPlatformExceptions(metadata.Get().GetPlatformExceptions(), vendor, model, version)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil && platformExceptions == nil {
+		return nil, nil
+	}
+	return mergeDeviations(profile.GetDeviations(), platformExceptions.GetDeviations()), nil
+}
+
+// mustLookupDeviations returns the deviations of dvc, overridden by the
+// -deviation_ flags which are set.
 func mustLookupDeviations(dvc *ondatra.Device) *mpb.Metadata_Deviations {
-	platformExceptions, err := lookupDeviations(dvc)
+	deviations, err := lookupDeviations(dvc)
 	if err != nil {
 		log.Exitf("Error looking up deviations: %v", err)
 	}
-	if platformExceptions == nil {
+	if deviations == nil {
 		log.Infof("Did not match any platform_exception %v, returning default values", metadata.Get().GetPlatformExceptions())
-		return &mpb.Metadata_Deviations{}
+		deviations = &mpb.Metadata_Deviations{}
 	}
-	return platformExceptions.GetDeviations()
+	return withFlags(deviations, deviationFlags)
 }
 
 func lookupDUTDeviations(dut *ondatra.DUTDevice) *mpb.Metadata_Deviations {
@@ -841,3 +869,55 @@ func SkipPrefixSetMode(dut *ondatra.DUTDevice) bool {
 func SetMetricAsPreference(dut *ondatra.DUTDevice) bool {
 	return lookupDUTDeviations(dut).GetSetMetricAsPreference()
 }
+
+// CPUMissingAncestor deviation set to true for devices where the CPU components
+// do not map to a FRU parent component in the OC tree.
+func CPUMissingAncestor(dut *ondatra.DUTDevice) bool {
+	return lookupDUTDeviations(dut).GetCpuMissingAncestor()
+}
+
+// InterfaceRefConfigUnsupported deviation set to true for devices that do not support
+// interface-ref configuration when applying features to interface.
+func InterfaceRefConfigUnsupported(dut *ondatra.DUTDevice) bool {
+	return lookupDUTDeviations(dut).GetInterfaceRefConfigUnsupported()
+}
+
+// RequireRoutedSubinterface0 returns true if device needs to configure subinterface 0
+// for non-zero sub-interfaces.
+func RequireRoutedSubinterface0(dut *ondatra.DUTDevice) bool {
+	return lookupDUTDeviations(dut).GetRequireRoutedSubinterface_0()
+}
+
+// GNOISwitchoverReasonMissingUserInitiated returns true for devices that don't
+// report last-switchover-reason as USER_INITIATED for gNOI.SwitchControlProcessor.
+func GNOISwitchoverReasonMissingUserInitiated(dut *ondatra.DUTDevice) bool {
+	return lookupDUTDeviations(dut).GetGnoiSwitchoverReasonMissingUserInitiated()
+}
+
+// P4rtUnsetElectionIDPrimaryAllowed returns whether the device does not support unset election ID.
+func P4rtUnsetElectionIDPrimaryAllowed(dut *ondatra.DUTDevice) bool {
+	return lookupDUTDeviations(dut).GetP4RtUnsetelectionidPrimaryAllowed()
+}
+
+// P4rtBackupArbitrationResponseCode returns whether the device does not support unset election ID.
+func P4rtBackupArbitrationResponseCode(dut *ondatra.DUTDevice) bool {
+	return lookupDUTDeviations(dut).GetBkupArbitrationRespCode()
+}
+
+// BackupNHGRequiresVrfWithDecap returns true for devices that require
+// IPOverIP Decapsulation for Backup NHG without interfaces.
+func BackupNHGRequiresVrfWithDecap(dut *ondatra.DUTDevice) bool {
+	return lookupDUTDeviations(dut).GetBackupNhgRequiresVrfWithDecap()
+}
+
+// ATEPortLinkStateOperationsUnsupported returns true for traffic generators that do not support
+// port link state control operations (such as port shutdown.)
+func ATEPortLinkStateOperationsUnsupported(ate *ondatra.ATEDevice) bool {
+	return lookupATEDeviations(ate).GetAtePortLinkStateOperationsUnsupported()
+}
+
+// ATEIPv6FlowLabelUnsupported returns true for traffic generators that do not support
+// IPv6 flow labels
+func ATEIPv6FlowLabelUnsupported(ate *ondatra.ATEDevice) bool {
+	return lookupATEDeviations(ate).GetAteIpv6FlowLabelUnsupported()
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deviations
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	mpb "github.com/openconfig/featureprofiles/proto/metadata_go_proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// flagPrefix is the prefix of the name of the flag of each deviation.
+const flagPrefix = "deviation_"
+
+// deviationFlag is the flag of a boolean deviation, which overrides the
+// platform profiles and the test metadata when it is set, including to false.
+type deviationFlag struct {
+	fd    protoreflect.FieldDescriptor
+	value bool
+	set   bool
+}
+
+// String returns the value of the flag.
+func (f *deviationFlag) String() string {
+	return strconv.FormatBool(f != nil && f.value)
+}
+
+// Set sets the value of the flag.
+func (f *deviationFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	f.value, f.set = v, true
+	return nil
+}
+
+// IsBoolFlag returns true, so that the flag may be set without a value.
+func (f *deviationFlag) IsBoolFlag() bool {
+	return true
+}
+
+// flagDeviations are the deviations which have a flag, named after the field
+// of the Deviations message with flagPrefix. They are kept for the existing CI
+// invocations only: new deviations are set in the platform profiles or in the
+// test metadata instead of with a flag.
+var flagDeviations = []protoreflect.Name{
+	"cpu_missing_ancestor",
+	"interface_ref_config_unsupported",
+	"require_routed_subinterface_0",
+	"gnoi_switchover_reason_missing_user_initiated",
+	"p4rt_unsetelectionid_primary_allowed",
+	"bkup_arbitration_resp_code",
+	"backup_nhg_requires_vrf_with_decap",
+	"ate_port_link_state_operations_unsupported",
+	"ate_ipv6_flow_label_unsupported",
+}
+
+// deviationFlags are the flags of flagDeviations.
+var deviationFlags = registerFlags(flag.CommandLine, flagDeviations)
+
+// registerFlags registers in fs a flag for each of the named boolean fields of
+// the Deviations message.
+func registerFlags(fs *flag.FlagSet, names []protoreflect.Name) []*deviationFlag {
+	var flags []*deviationFlag
+	fields := (&mpb.Metadata_Deviations{}).ProtoReflect().Descriptor().Fields()
+	for _, name := range names {
+		fd := fields.ByName(name)
+		if fd == nil || fd.Kind() != protoreflect.BoolKind {
+			panic(fmt.Sprintf("no boolean deviation %q for a flag", name))
+		}
+		f := &deviationFlag{fd: fd}
+		fs.Var(f, flagPrefix+string(name), fmt.Sprintf("Overrides the %s deviation of the platform profiles and the test metadata.", name))
+		flags = append(flags, f)
+	}
+	return flags
+}
+
+// withFlags returns deviations overridden by the flags which are set.
+func withFlags(deviations *mpb.Metadata_Deviations, flags []*deviationFlag) *mpb.Metadata_Deviations {
+	var overridden *mpb.Metadata_Deviations
+	for _, f := range flags {
+		if !f.set {
+			continue
+		}
+		if overridden == nil {
+			overridden = proto.Clone(deviations).(*mpb.Metadata_Deviations)
+		}
+		overridden.ProtoReflect().Set(f.fd, protoreflect.ValueOfBool(f.value))
+	}
+	if overridden == nil {
+		return deviations
+	}
+	return overridden
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deviations
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	mpb "github.com/openconfig/featureprofiles/proto/metadata_go_proto"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func newFlags(t *testing.T, args ...string) []*deviationFlag {
+	t.Helper()
+	fs := flag.NewFlagSet("deviations", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flags := registerFlags(fs, flagDeviations)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse(%v) failed: %v", args, err)
+	}
+	return flags
+}
+
+func TestRegisterFlags(t *testing.T) {
+	fs := flag.NewFlagSet("deviations", flag.ContinueOnError)
+	registerFlags(fs, flagDeviations)
+	var got []string
+	fs.VisitAll(func(f *flag.Flag) {
+		got = append(got, f.Name)
+		if f.DefValue != "false" {
+			t.Errorf("Flag %s default value got %q, want %q", f.Name, f.DefValue, "false")
+		}
+	})
+	// The flags which were previously hand-maintained keep their names, and no
+	// other deviation has a flag.
+	want := []string{
+		"deviation_ate_ipv6_flow_label_unsupported",
+		"deviation_ate_port_link_state_operations_unsupported",
+		"deviation_backup_nhg_requires_vrf_with_decap",
+		"deviation_bkup_arbitration_resp_code",
+		"deviation_cpu_missing_ancestor",
+		"deviation_gnoi_switchover_reason_missing_user_initiated",
+		"deviation_interface_ref_config_unsupported",
+		"deviation_p4rt_unsetelectionid_primary_allowed",
+		"deviation_require_routed_subinterface_0",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("registerFlags() got unexpected flags diff (-want +got): %s", diff)
+	}
+}
+
+func TestWithFlags(t *testing.T) {
+	profile := &mpb.Metadata_Deviations{
+		CpuMissingAncestor:            true,
+		InterfaceRefConfigUnsupported: true,
+		DefaultNetworkInstance:        "default",
+	}
+	tests := []struct {
+		desc string
+		args []string
+		want *mpb.Metadata_Deviations
+	}{{
+		desc: "unset",
+		want: profile,
+	}, {
+		desc: "override",
+		args: []string{
+			"-deviation_cpu_missing_ancestor=false",
+			"-deviation_require_routed_subinterface_0",
+		},
+		want: &mpb.Metadata_Deviations{
+			InterfaceRefConfigUnsupported: true,
+			RequireRoutedSubinterface_0:   true,
+			DefaultNetworkInstance:        "default",
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := withFlags(profile, newFlags(t, tt.args...))
+			if diff := cmp.Diff(tt.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("withFlags() got unexpected diff (-want +got): %s", diff)
+			}
+			if !profile.GetCpuMissingAncestor() {
+				t.Errorf("withFlags() modified the deviations")
+			}
+		})
+	}
+}
+
+func TestDeviationFlagInvalid(t *testing.T) {
+	fs := flag.NewFlagSet("deviations", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	registerFlags(fs, flagDeviations)
+	if err := fs.Parse([]string{"-deviation_cpu_missing_ancestor=maybe"}); err == nil {
+		t.Errorf("Parse() of an invalid bool got no error, want error")
+	}
+	if err := fs.Parse([]string{"-deviation_interface_enabled"}); err == nil {
+		t.Errorf("Parse() of a deviation without flag got no error, want error")
+	}
+}
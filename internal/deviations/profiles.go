@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deviations
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+
+	log "github.com/golang/glog"
+	mpb "github.com/openconfig/featureprofiles/proto/metadata_go_proto"
+	"github.com/openconfig/ondatra"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// platformProfiles is the path of a textproto file of the Metadata message, of
+// which only the platform_exceptions are used. They are the deviation profiles
+// of the platforms, keyed by vendor, hardware model and software version,
+// which apply to all the tests. The platform_exceptions in the metadata of a
+// test add to its profile.
+var platformProfiles = flag.String("platform_profiles", "", "Path of a textproto file of platform_exceptions with the deviations of the platforms for all the tests.")
+
+var (
+	profilesOnce sync.Once
+	profiles     *mpb.Metadata
+	profilesErr  error
+)
+
+// loadPlatformProfiles returns the platform profiles of the -platform_profiles
+// file, which is read once. It returns no profile if the flag is not set.
+func loadPlatformProfiles() (*mpb.Metadata, error) {
+	profilesOnce.Do(func() {
+		profiles, profilesErr = readPlatformProfiles(*platformProfiles)
+	})
+	return profiles, profilesErr
+}
+
+// readPlatformProfiles reads the platform profiles of file.
+func readPlatformProfiles(file string) (*mpb.Metadata, error) {
+	if file == "" {
+		return &mpb.Metadata{}, nil
+	}
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	md := new(mpb.Metadata)
+	if err := prototext.Unmarshal(bytes, md); err != nil {
+		return nil, fmt.Errorf("could not parse platform profiles %q: %w", file, err)
+	}
+	return md, nil
+}
+
+// mergeDeviations returns the deviations of profile overridden by the fields
+// set in overrides. Either may be nil. The merge is additive only: a field of
+// overrides set to its zero value, such as false, is indistinguishable from
+// an unset field in proto3, so it cannot reset a deviation of profile. The
+// -deviation_ flags can, as they are applied after the merge.
+func mergeDeviations(profile, overrides *mpb.Metadata_Deviations) *mpb.Metadata_Deviations {
+	merged := &mpb.Metadata_Deviations{}
+	proto.Merge(merged, profile)
+	proto.Merge(merged, overrides)
+	return merged
+}
+
+// unsupportedSuffix is the suffix of the names of the deviations reporting
+// that a device does not support a feature.
+const unsupportedSuffix = "_unsupported"
+
+// featureUnsupported returns the value of the deviation named feature followed
+// by unsupportedSuffix in deviations.
+func featureUnsupported(deviations *mpb.Metadata_Deviations, feature string) (bool, error) {
+	name := protoreflect.Name(feature + unsupportedSuffix)
+	fd := deviations.ProtoReflect().Descriptor().Fields().ByName(name)
+	if fd == nil || fd.Kind() != protoreflect.BoolKind {
+		return false, fmt.Errorf("no boolean deviation %q for feature %q", name, feature)
+	}
+	return deviations.ProtoReflect().Get(fd).Bool(), nil
+}
+
+// Supported returns whether dut supports feature, so that tests can query the
+// capabilities of the device instead of calling an accessor per deviation.
+// The feature is the name of a boolean deviation without its "_unsupported"
+// suffix, such as "isis_multi_topology" for isis_multi_topology_unsupported.
+// Only these deviations can be queried; the other deviations, which change
+// the way a test configures the device rather than report a missing feature,
+// have their own accessors.
+//
+// An unknown feature is a fatal error, so that a typo cannot silently enable
+// a subtest.
+func Supported(dut *ondatra.DUTDevice, feature string) bool {
+	unsupported, err := featureUnsupported(lookupDUTDeviations(dut), feature)
+	if err != nil {
+		log.Exitf("Error looking up feature support: %v", err)
+	}
+	return !unsupported
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deviations
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	mpb "github.com/openconfig/featureprofiles/proto/metadata_go_proto"
+	opb "github.com/openconfig/ondatra/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestPlatformProfiles(t *testing.T) {
+	profiles, err := readPlatformProfiles("testdata/platform_profiles.textproto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		desc                   string
+		vendor, model, version string
+		want                   *mpb.Metadata_Deviations
+	}{{
+		desc:   "vendor",
+		vendor: "ARISTA",
+		model:  "any",
+		want: &mpb.Metadata_Deviations{
+			DefaultNetworkInstance:       "default",
+			InterfaceEnabled:             true,
+			IsisMultiTopologyUnsupported: true,
+		},
+	}, {
+		desc:    "model and version",
+		vendor:  "CISCO",
+		model:   "8808",
+		version: "24.1.1",
+		want:    &mpb.Metadata_Deviations{Ipv4MissingEnabled: true},
+	}, {
+		desc:    "other version",
+		vendor:  "CISCO",
+		model:   "8808",
+		version: "7.11.1",
+	}, {
+		desc:   "other vendor",
+		vendor: "JUNIPER",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := matchPlatformExceptions(profiles.GetPlatformExceptions(), tt.vendor, tt.model, tt.version)
+			if err != nil {
+				t.Fatalf("matchPlatformExceptions() got error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got.GetDeviations(), protocmp.Transform()); diff != "" {
+				t.Errorf("matchPlatformExceptions() got unexpected deviations diff (-want +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestMatchPlatformExceptionsDuplicate(t *testing.T) {
+	pes := []*mpb.Metadata_PlatformExceptions{{
+		Platform: &mpb.Metadata_Platform{Vendor: opb.Device_CISCO},
+	}, {
+		Platform: &mpb.Metadata_Platform{Vendor: opb.Device_CISCO, HardwareModelRegex: "^8"},
+	}}
+	if _, err := matchPlatformExceptions(pes, "CISCO", "8808", ""); err == nil {
+		t.Errorf("matchPlatformExceptions() got no error for two matches")
+	}
+	if _, err := matchPlatformExceptions(pes, "CISCO", "5000", ""); err != nil {
+		t.Errorf("matchPlatformExceptions() got error for one match: %v", err)
+	}
+}
+
+func TestMergeDeviations(t *testing.T) {
+	profile := &mpb.Metadata_Deviations{
+		DefaultNetworkInstance: "default",
+		InterfaceEnabled:       true,
+	}
+	// InterfaceEnabled: false cannot be told apart from an unset field, so
+	// the merge keeps the InterfaceEnabled of the profile.
+	overrides := &mpb.Metadata_Deviations{
+		DefaultNetworkInstance: "DEFAULT",
+		Ipv4MissingEnabled:     true,
+		InterfaceEnabled:       false,
+	}
+	want := &mpb.Metadata_Deviations{
+		DefaultNetworkInstance: "DEFAULT",
+		InterfaceEnabled:       true,
+		Ipv4MissingEnabled:     true,
+	}
+	got := mergeDeviations(profile, overrides)
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("mergeDeviations() got unexpected diff (-want +got): %s", diff)
+	}
+	if profile.GetIpv4MissingEnabled() {
+		t.Errorf("mergeDeviations() modified the profile")
+	}
+	if got := mergeDeviations(nil, nil); got == nil {
+		t.Errorf("mergeDeviations(nil, nil) got nil, want empty deviations")
+	}
+}
+
+func TestFeatureUnsupported(t *testing.T) {
+	deviations := &mpb.Metadata_Deviations{IsisMultiTopologyUnsupported: true}
+	tests := []struct {
+		feature string
+		want    bool
+		wantErr bool
+	}{
+		{feature: "isis_multi_topology", want: true},
+		{feature: "switch_chip_id", want: false},
+		{feature: "no_such_feature", wantErr: true},
+		{feature: "default_network_instance", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := featureUnsupported(deviations, tt.feature)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("featureUnsupported(%q) got error %v, want error %t", tt.feature, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("featureUnsupported(%q) got %t, want %t", tt.feature, got, tt.want)
+		}
+	}
+}
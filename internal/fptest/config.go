@@ -0,0 +1,182 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi/oc"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// ConfigSnapshot is the OpenConfig configuration of a DUT at some point of a
+// test, which can be restored after the test has changed it.
+type ConfigSnapshot struct {
+	dut  *ondatra.DUTDevice
+	root []byte // JSON_IETF of the root
+}
+
+// SaveConfig returns a snapshot of the whole OpenConfig configuration of dut,
+// read with a gNMI Get of the root.
+func SaveConfig(t testing.TB, dut *ondatra.DUTDevice) *ConfigSnapshot {
+	t.Helper()
+	resp, err := dut.RawAPIs().GNMI(t).Get(context.Background(), &gpb.GetRequest{
+		Path:     []*gpb.Path{{Origin: "openconfig"}},
+		Type:     gpb.GetRequest_CONFIG,
+		Encoding: gpb.Encoding_JSON_IETF,
+	})
+	if err != nil {
+		t.Fatalf("Could not get the config of DUT %s: %v", dut.Name(), err)
+	}
+	root, err := rootJSON(resp.GetNotification())
+	if err != nil {
+		t.Fatalf("Could not save the config of DUT %s: %v", dut.Name(), err)
+	}
+	t.Logf("Saved %d bytes of config of DUT %s", len(root), dut.Name())
+	return &ConfigSnapshot{dut: dut, root: root}
+}
+
+// RestoreConfig replaces the whole OpenConfig configuration of the DUT of c
+// with c.
+func RestoreConfig(t testing.TB, c *ConfigSnapshot) {
+	t.Helper()
+	if err := restoreConfig(t, c); err != nil {
+		t.Fatalf("Could not restore the config of DUT %s: %v", c.dut.Name(), err)
+	}
+}
+
+func restoreConfig(t testing.TB, c *ConfigSnapshot) error {
+	t.Helper()
+	if _, err := c.dut.RawAPIs().GNMI(t).Set(context.Background(), &gpb.SetRequest{
+		Replace: []*gpb.Update{{
+			Path: &gpb.Path{Origin: "openconfig"},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: c.root}},
+		}},
+	}); err != nil {
+		return err
+	}
+	t.Logf("Restored the config of DUT %s", c.dut.Name())
+	return nil
+}
+
+// CheckpointConfig saves the configuration of dut, and restores it when the
+// test and all its subtests complete, so that a test which changes the
+// configuration destructively does not affect the following tests.
+func CheckpointConfig(t testing.TB, dut *ondatra.DUTDevice) *ConfigSnapshot {
+	t.Helper()
+	c := SaveConfig(t, dut)
+	// The test has completed, so a failed restore is reported as an error
+	// rather than aborting the remaining cleanups.
+	t.Cleanup(func() {
+		if err := restoreConfig(t, c); err != nil {
+			t.Errorf("Could not restore the config of DUT %s: %v", dut.Name(), err)
+		}
+	})
+	return c
+}
+
+// topLevelModules maps the names of the top level OpenConfig containers to
+// the names of their modules, from the schema of the generated root.
+var topLevelModules = func() map[string]string {
+	modules := map[string]string{}
+	rt := reflect.TypeOf(oc.Root{})
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("path"), "/")
+		module, _, _ := strings.Cut(f.Tag.Get("module"), "/")
+		if name != "" && module != "" {
+			modules[name] = module
+		}
+	}
+	return modules
+}()
+
+// qualifiedName returns the top level name qualified with its module, as
+// JSON_IETF requires at the root, since a DUT may omit the module in paths and
+// in JSON.
+func qualifiedName(name string) (string, error) {
+	if strings.Contains(name, ":") {
+		return name, nil
+	}
+	module, ok := topLevelModules[name]
+	if !ok {
+		return "", fmt.Errorf("unknown module of top level container %q", name)
+	}
+	return module + ":" + name, nil
+}
+
+// rootJSON merges the JSON values of the updates of notifs, which are either
+// the root or its top level containers, into the JSON_IETF of the root.
+func rootJSON(notifs []*gpb.Notification) ([]byte, error) {
+	root := map[string]any{}
+	var errs []error
+	for _, n := range notifs {
+		for _, u := range n.GetUpdate() {
+			elems := append(append([]*gpb.PathElem{}, n.GetPrefix().GetElem()...), u.GetPath().GetElem()...)
+			var b []byte
+			switch v := u.GetVal().GetValue().(type) {
+			case *gpb.TypedValue_JsonIetfVal:
+				b = v.JsonIetfVal
+			case *gpb.TypedValue_JsonVal:
+				b = v.JsonVal
+			default:
+				errs = append(errs, fmt.Errorf("update at %v is not JSON: %v", elems, u.GetVal()))
+				continue
+			}
+			var val any
+			if err := json.Unmarshal(b, &val); err != nil {
+				errs = append(errs, fmt.Errorf("update at %v: %w", elems, err))
+				continue
+			}
+			switch {
+			case len(elems) == 0:
+				obj, ok := val.(map[string]any)
+				if !ok {
+					errs = append(errs, fmt.Errorf("root update is not a JSON object: %s", b))
+					continue
+				}
+				for k, v := range obj {
+					name, err := qualifiedName(k)
+					if err != nil {
+						errs = append(errs, err)
+						continue
+					}
+					root[name] = v
+				}
+			case len(elems) == 1 && len(elems[0].GetKey()) == 0:
+				name, err := qualifiedName(elems[0].GetName())
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				root[name] = val
+			default:
+				errs = append(errs, fmt.Errorf("update at %v is not the root or a top level container", elems))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return json.Marshal(root)
+}
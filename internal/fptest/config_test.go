@@ -0,0 +1,136 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func jsonUpdate(path *gpb.Path, val string) *gpb.Update {
+	return &gpb.Update{
+		Path: path,
+		Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(val)}},
+	}
+}
+
+func TestRootJSON(t *testing.T) {
+	tests := []struct {
+		desc   string
+		notifs []*gpb.Notification
+		want   string
+	}{{
+		desc: "root",
+		notifs: []*gpb.Notification{{
+			Update: []*gpb.Update{jsonUpdate(&gpb.Path{}, `{"openconfig-system:system": {"config": {"hostname": "dut"}}}`)},
+		}},
+		want: `{"openconfig-system:system": {"config": {"hostname": "dut"}}}`,
+	}, {
+		desc: "top level containers",
+		notifs: []*gpb.Notification{{
+			Prefix: &gpb.Path{Origin: "openconfig"},
+			Update: []*gpb.Update{
+				jsonUpdate(&gpb.Path{Elem: []*gpb.PathElem{{Name: "openconfig-system:system"}}}, `{"config": {"hostname": "dut"}}`),
+			},
+		}, {
+			Update: []*gpb.Update{
+				jsonUpdate(&gpb.Path{Elem: []*gpb.PathElem{{Name: "openconfig-qos:qos"}}}, `{}`),
+			},
+		}},
+		want: `{"openconfig-system:system": {"config": {"hostname": "dut"}}, "openconfig-qos:qos": {}}`,
+	}, {
+		desc: "prefix",
+		notifs: []*gpb.Notification{{
+			Prefix: &gpb.Path{Elem: []*gpb.PathElem{{Name: "openconfig-system:system"}}},
+			Update: []*gpb.Update{jsonUpdate(&gpb.Path{}, `{"config": {"hostname": "dut"}}`)},
+		}},
+		want: `{"openconfig-system:system": {"config": {"hostname": "dut"}}}`,
+	}, {
+		desc: "unqualified names",
+		notifs: []*gpb.Notification{{
+			Update: []*gpb.Update{
+				jsonUpdate(&gpb.Path{}, `{"system": {"config": {"hostname": "dut"}}}`),
+				jsonUpdate(&gpb.Path{Elem: []*gpb.PathElem{{Name: "network-instances"}}}, `{}`),
+			},
+		}},
+		want: `{"openconfig-system:system": {"config": {"hostname": "dut"}}, "openconfig-network-instance:network-instances": {}}`,
+	}, {
+		desc: "empty",
+		want: `{}`,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			b, err := rootJSON(tt.notifs)
+			if err != nil {
+				t.Fatalf("rootJSON() got error: %v", err)
+			}
+			var got, want any
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("rootJSON() got invalid JSON %s: %v", b, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("rootJSON() got unexpected diff (-want +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRootJSONErrors(t *testing.T) {
+	tests := []struct {
+		desc   string
+		update *gpb.Update
+	}{{
+		desc:   "nested path",
+		update: jsonUpdate(&gpb.Path{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "config"}}}, `{}`),
+	}, {
+		desc: "list entry",
+		update: jsonUpdate(&gpb.Path{Elem: []*gpb.PathElem{{
+			Name: "interface",
+			Key:  map[string]string{"name": "eth0"},
+		}}}, `{}`),
+	}, {
+		desc:   "unknown top level container",
+		update: jsonUpdate(&gpb.Path{Elem: []*gpb.PathElem{{Name: "unknown"}}}, `{}`),
+	}, {
+		desc:   "unknown root member",
+		update: jsonUpdate(&gpb.Path{}, `{"unknown": {}}`),
+	}, {
+		desc:   "root not an object",
+		update: jsonUpdate(&gpb.Path{}, `[]`),
+	}, {
+		desc:   "invalid JSON",
+		update: jsonUpdate(&gpb.Path{}, `{`),
+	}, {
+		desc: "not JSON",
+		update: &gpb.Update{
+			Path: &gpb.Path{},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "config"}},
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if _, err := rootJSON([]*gpb.Notification{{Update: []*gpb.Update{tt.update}}}); err == nil {
+				t.Errorf("rootJSON() got no error")
+			}
+		})
+	}
+}
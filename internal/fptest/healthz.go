@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/components"
+	"github.com/openconfig/ondatra/binding"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"google.golang.org/protobuf/encoding/prototext"
+
+	hpb "github.com/openconfig/gnoi/healthz"
+)
+
+var (
+	healthzOnFailure = flag.Bool("healthz_on_failure", true,
+		"collect gNOI Healthz status and artifacts of the DUT chassis into -outputs_dir when a test fails")
+	healthzTimeout = flag.Duration("healthz_timeout", 5*time.Minute,
+		"time allowed for collecting gNOI Healthz artifacts from each DUT")
+)
+
+// writeHealthz collects the Healthz status and artifacts of the given DUTs and
+// writes each of them to the test outputs directory.
+func writeHealthz(duts []binding.DUT) error {
+	b := &supportBundle{}
+	var errs []error
+	for _, dut := range duts {
+		ctx, cancel := context.WithTimeout(context.Background(), *healthzTimeout)
+		if err := collectHealthz(ctx, b, dut); err != nil {
+			errs = append(errs, fmt.Errorf("DUT %s: %w", dut.Name(), err))
+		}
+		cancel()
+	}
+	if err := b.writeFiles(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// collectHealthz adds the Healthz status and all artifacts of every chassis
+// component of the DUT to the support bundle.
+func collectHealthz(ctx context.Context, b *supportBundle, dut binding.DUT) error {
+	gnmic, err := dut.DialGNMI(ctx)
+	if err != nil {
+		return fmt.Errorf("dialing gNMI: %w", err)
+	}
+	yc, err := ygnmi.NewClient(gnmic)
+	if err != nil {
+		return err
+	}
+	chassis, err := components.Y{Client: yc}.FindByType(ctx, oc.PlatformTypes_OPENCONFIG_HARDWARE_COMPONENT_CHASSIS)
+	if err != nil {
+		return fmt.Errorf("finding chassis component: %w", err)
+	}
+	gnoic, err := dut.DialGNOI(ctx)
+	if err != nil {
+		return fmt.Errorf("dialing gNOI: %w", err)
+	}
+	hc := gnoic.Healthz()
+
+	var errs []error
+	for _, name := range chassis {
+		resp, err := hc.Get(ctx, &hpb.GetRequest{Path: components.GetSubcomponentPath(name, false)})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Healthz.Get(%s): %w", name, err))
+			continue
+		}
+		prefix := path.Join(dut.Name(), "healthz", name)
+		b.add(prefix+".txt", []byte(prototext.Format(resp)))
+		for _, a := range healthzArtifacts(resp.GetComponent()) {
+			if err := collectArtifact(ctx, b, hc, prefix, a); err != nil {
+				errs = append(errs, fmt.Errorf("Healthz.Artifact(%s): %w", a.GetId(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// healthzArtifacts returns the artifact headers of a component status and all
+// of its subcomponents.
+func healthzArtifacts(s *hpb.ComponentStatus) []*hpb.ArtifactHeader {
+	artifacts := append([]*hpb.ArtifactHeader{}, s.GetArtifacts()...)
+	for _, sub := range s.GetSubcomponents() {
+		artifacts = append(artifacts, healthzArtifacts(sub)...)
+	}
+	return artifacts
+}
+
+// collectArtifact streams a single Healthz artifact and adds it to the support
+// bundle.
+func collectArtifact(ctx context.Context, b *supportBundle, hc hpb.HealthzClient, prefix string, header *hpb.ArtifactHeader) error {
+	stream, err := hc.Artifact(ctx, &hpb.ArtifactRequest{Id: header.GetId()})
+	if err != nil {
+		return err
+	}
+	var content []byte
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch c := resp.GetContents().(type) {
+		case *hpb.ArtifactResponse_Bytes:
+			content = append(content, c.Bytes...)
+		case *hpb.ArtifactResponse_Proto:
+			content = append(content, prototext.Format(c.Proto)...)
+		}
+		if resp.GetTrailer() != nil {
+			break
+		}
+	}
+
+	name, suffix := header.GetId(), ".bin"
+	switch {
+	case header.GetFile() != nil:
+		name = header.GetFile().GetName()
+		if ext := path.Ext(name); ext != "" {
+			suffix = ext
+		}
+	case header.GetProto() != nil:
+		suffix = ".txt"
+	}
+	b.add(prefix+"_"+sanitizeFilename(strings.TrimSuffix(path.Base(name), suffix))+suffix, content)
+	return nil
+}
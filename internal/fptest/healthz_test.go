@@ -0,0 +1,44 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	hpb "github.com/openconfig/gnoi/healthz"
+)
+
+func TestHealthzArtifacts(t *testing.T) {
+	status := &hpb.ComponentStatus{
+		Artifacts: []*hpb.ArtifactHeader{{Id: "chassis"}},
+		Subcomponents: []*hpb.ComponentStatus{{
+			Artifacts: []*hpb.ArtifactHeader{{Id: "lc0"}, {Id: "lc0-cores"}},
+		}, {
+			Subcomponents: []*hpb.ComponentStatus{{
+				Artifacts: []*hpb.ArtifactHeader{{Id: "fan0"}},
+			}},
+		}},
+	}
+	var got []string
+	for _, a := range healthzArtifacts(status) {
+		got = append(got, a.GetId())
+	}
+	want := []string{"chassis", "lc0", "lc0-cores", "fan0"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("healthzArtifacts() ids (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/featureprofiles/internal/metadata"
+	"github.com/openconfig/featureprofiles/internal/pathcov"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/binding"
+	"github.com/openconfig/ondatra/eventlis"
+	"google.golang.org/grpc"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var pathCoverage = flag.Bool("path_coverage", false,
+	"write a JSON report of the OC paths read and written over gNMI by the tests into -outputs_dir; reports of several tests are merged with tools/pathcov")
+
+// coverageDUT is a DUT whose gNMI clients record the accessed paths.
+type coverageDUT struct {
+	binding.DUT
+	r *pathcov.Recorder
+}
+
+func (d *coverageDUT) DialGNMI(ctx context.Context, opts ...grpc.DialOption) (gpb.GNMIClient, error) {
+	c, err := d.DUT.DialGNMI(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return d.r.Client(c), nil
+}
+
+// writePathCoverage writes the report of r with the identity of the test to
+// the test outputs directory.
+func writePathCoverage(r *pathcov.Recorder) (string, error) {
+	rep := r.Report()
+	if md := metadata.Get(); md != nil {
+		rep.PlanID = md.GetPlanId()
+		rep.UUID = md.GetUuid()
+	}
+	b, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return WriteOutput("path_coverage", ".json", string(b))
+}
+
+// registerPathCoverage registers the event listeners that record the paths
+// accessed over gNMI on every DUT of the reservation if -path_coverage is set.
+// The DUTs of the reservation are replaced by wrappers recording the paths, so
+// it must be registered after the listeners that dial the DUTs before the
+// tests, and listeners that dial them after the tests must keep their own copy
+// of the DUTs, so that their requests are not recorded.
+func registerPathCoverage() {
+	r := pathcov.NewRecorder()
+	ondatra.EventListener().AddBeforeTestsCallback(func(e *eventlis.BeforeTestsEvent) error {
+		if !*pathCoverage {
+			return nil
+		}
+		for name, dut := range e.Reservation.DUTs {
+			e.Reservation.DUTs[name] = &coverageDUT{DUT: dut, r: r}
+		}
+		return nil
+	})
+	ondatra.EventListener().AddAfterTestsCallback(func(*eventlis.AfterTestsEvent) error {
+		if !*pathCoverage {
+			return nil
+		}
+		// The report is best effort and must not change the test result.
+		if _, err := writePathCoverage(r); err != nil {
+			log.Warningf("Cannot write the path coverage report: %v", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/testt"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	spb "github.com/openconfig/gnoi/system"
+)
+
+const (
+	// rebootPollInterval is the time between two attempts to reach a rebooting DUT.
+	rebootPollInterval = 30 * time.Second
+	// rebootStatusPollInterval is the time between two RebootStatus requests.
+	rebootStatusPollInterval = 10 * time.Second
+)
+
+// WaitForGNMIReachable polls the DUT until it answers a gNMI Get of
+// /system/state/current-datetime, and fails the test if it does not do so
+// within timeout. The first attempt is made after one poll interval so that a
+// DUT which has not yet gone down is not mistaken for one which came back up.
+// It returns the time it took the DUT to become reachable.
+func WaitForGNMIReachable(t testing.TB, dut *ondatra.DUTDevice, timeout time.Duration) time.Duration {
+	t.Helper()
+	start := time.Now()
+	for {
+		time.Sleep(rebootPollInterval)
+		var currentTime string
+		errMsg := testt.CaptureFatal(t, func(t testing.TB) {
+			currentTime = gnmi.Get(t, dut, gnmi.OC().System().CurrentDatetime().State())
+		})
+		if errMsg == nil {
+			t.Logf("DUT %s is reachable after %.2f seconds with current-datetime %v", dut.Name(), time.Since(start).Seconds(), currentTime)
+			return time.Since(start)
+		}
+		t.Logf("DUT %s not reachable after %.2f seconds: %s, keep polling ...", dut.Name(), time.Since(start).Seconds(), *errMsg)
+		if time.Since(start) > timeout {
+			t.Fatalf("DUT %s not reachable: got %v elapsed, want < %v", dut.Name(), time.Since(start), timeout)
+		}
+	}
+}
+
+// WaitForPortsUp waits for the oper-status of every DUT port in the testbed
+// to be UP, and fails the test if any of them is not UP within timeout.
+func WaitForPortsUp(t testing.TB, dut *ondatra.DUTDevice, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	var down []string
+	for _, p := range dut.Ports() {
+		watch := gnmi.Watch(t, dut, gnmi.OC().Interface(p.Name()).OperStatus().State(), time.Until(deadline), func(val *ygnmi.Value[oc.E_Interface_OperStatus]) bool {
+			status, present := val.Val()
+			return present && status == oc.Interface_OperStatus_UP
+		})
+		if _, ok := watch.Await(t); !ok {
+			down = append(down, p.Name())
+		}
+	}
+	if len(down) > 0 {
+		sort.Strings(down)
+		t.Fatalf("DUT %s ports not UP within %v: %v", dut.Name(), timeout, down)
+	}
+}
+
+// WaitForRebootInactive polls the gNOI RebootStatus of req until the reboot
+// is no longer active, and fails the test if it still is after timeout, or if
+// RebootStatus is not implemented. Other errors, such as those of a rebooting
+// subcomponent, are retried. It returns the last status.
+func WaitForRebootInactive(t testing.TB, dut *ondatra.DUTDevice, req *spb.RebootStatusRequest, timeout time.Duration) *spb.RebootStatusResponse {
+	t.Helper()
+	c := dut.RawAPIs().GNOI(t).System()
+	start := time.Now()
+	for {
+		resp, err := c.RebootStatus(context.Background(), req)
+		switch {
+		case status.Code(err) == codes.Unimplemented:
+			t.Fatalf("Unimplemented RebootStatus() of DUT %s is not fully compliant with the Reboot spec: %v", dut.Name(), err)
+		case err == nil && !resp.GetActive():
+			t.Logf("Reboot of DUT %s is not active after %.2f seconds", dut.Name(), time.Since(start).Seconds())
+			return resp
+		}
+		if time.Since(start) > timeout {
+			t.Fatalf("Reboot of DUT %s still active: got %v elapsed, want < %v, last status %v, err %v", dut.Name(), time.Since(start), timeout, resp, err)
+		}
+		t.Logf("Reboot of DUT %s active after %.2f seconds: status %v, err %v, keep polling ...", dut.Name(), time.Since(start).Seconds(), resp, err)
+		time.Sleep(rebootStatusPollInterval)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/eventlis"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	recordPaths = flag.String("record_paths", "",
+		"comma separated gNMI paths that are subscribed on every DUT for the duration of the tests, writing every notification into -outputs_dir; recording is disabled if empty")
+	recordFormat = flag.String("record_format", "json",
+		`format of the recorded notifications: "json" writes one JSON object per line with the receive time and the SubscribeResponse, "proto" writes size-delimited SubscribeResponse protos`)
+)
+
+// Recording formats.
+const (
+	recordJSON  = "json"
+	recordProto = "proto"
+)
+
+// recorder records the notifications of a gNMI subscription.
+type recorder struct {
+	name   string
+	format string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+	n   int
+	err error
+}
+
+// parseRecordPaths parses the gNMI paths ps, skipping empty ones.
+func parseRecordPaths(ps []string) ([]*gpb.Path, error) {
+	var paths []*gpb.Path
+	for _, p := range ps {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		gp, err := ygot.StringToStructuredPath(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q: %w", p, err)
+		}
+		paths = append(paths, gp)
+	}
+	return paths, nil
+}
+
+// startRecorder subscribes to paths with client c and records the received
+// notifications until it is stopped.
+func startRecorder(ctx context.Context, name, format string, c gpb.GNMIClient, paths []*gpb.Path) (*recorder, error) {
+	if format != recordJSON && format != recordProto {
+		return nil, fmt.Errorf("invalid recording format %q", format)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.Subscribe(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("gNMI Subscribe: %w", err)
+	}
+	sl := &gpb.SubscriptionList{Mode: gpb.SubscriptionList_STREAM, Encoding: gpb.Encoding_PROTO}
+	for _, p := range paths {
+		sl.Subscription = append(sl.Subscription, &gpb.Subscription{Path: p, Mode: gpb.SubscriptionMode_TARGET_DEFINED})
+	}
+	if err := stream.Send(&gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: sl}}); err != nil {
+		cancel()
+		return nil, fmt.Errorf("gNMI Subscribe send: %w", err)
+	}
+	r := &recorder{name: name, format: format, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil && status.Code(err) != codes.Canceled {
+					r.mu.Lock()
+					r.err = err
+					r.mu.Unlock()
+				}
+				return
+			}
+			if err := r.add(time.Now(), resp); err != nil {
+				r.mu.Lock()
+				r.err = err
+				r.mu.Unlock()
+				return
+			}
+		}
+	}()
+	return r, nil
+}
+
+// add records a response received at time ts.
+func (r *recorder) add(ts time.Time, resp *gpb.SubscribeResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.n++
+	if r.format == recordProto {
+		_, err := protodelim.MarshalTo(&r.buf, resp)
+		return err
+	}
+	b, err := protojson.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(&r.buf, `{"received":%q,"response":%s}`+"\n", ts.Format(time.RFC3339Nano), b)
+	return nil
+}
+
+// stop stops the recording and writes it to the test outputs directory. It
+// returns the filename of the recording.
+func (r *recorder) stop() (string, error) {
+	r.cancel()
+	<-r.done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	suffix := ".jsonl"
+	if r.format == recordProto {
+		suffix = ".binpb"
+	}
+	name, err := WriteOutput("gnmi_recording_"+r.name, suffix, r.buf.String())
+	return name, errors.Join(r.err, err)
+}
+
+// registerRecorder registers the event listeners that record the paths of
+// -record_paths on every DUT of the reservation for the duration of the tests.
+func registerRecorder() {
+	var recorders []*recorder
+	ondatra.EventListener().AddBeforeTestsCallback(func(e *eventlis.BeforeTestsEvent) error {
+		if *recordPaths == "" {
+			return nil
+		}
+		paths, err := parseRecordPaths(strings.Split(*recordPaths, ","))
+		if err != nil {
+			return fmt.Errorf("-record_paths: %w", err)
+		}
+		for name, dut := range e.Reservation.DUTs {
+			c, err := dut.DialGNMI(context.Background())
+			if err != nil {
+				return fmt.Errorf("dialing gNMI of %s for recording: %w", name, err)
+			}
+			r, err := startRecorder(context.Background(), name, *recordFormat, c, paths)
+			if err != nil {
+				return fmt.Errorf("recording %s: %w", name, err)
+			}
+			recorders = append(recorders, r)
+		}
+		return nil
+	})
+	ondatra.EventListener().AddAfterTestsCallback(func(*eventlis.AfterTestsEvent) error {
+		for _, r := range recorders {
+			// Recording is best effort and must not change the test result.
+			if _, err := r.stop(); err != nil {
+				log.Warningf("gNMI recording of %s is incomplete: %v", r.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// RecordGNMI subscribes to the given gNMI paths on dut until the end of the
+// test, and then writes every received notification into the test outputs
+// directory in the format of -record_format. Paths are in the string form,
+// e.g. "/interfaces/interface[name=Ethernet1]/state/counters".
+func RecordGNMI(t testing.TB, dut *ondatra.DUTDevice, paths ...string) {
+	t.Helper()
+	gps, err := parseRecordPaths(paths)
+	if err != nil {
+		t.Fatalf("RecordGNMI: %v", err)
+	}
+	r, err := startRecorder(context.Background(), dut.Name(), *recordFormat, dut.RawAPIs().GNMI(t), gps)
+	if err != nil {
+		t.Fatalf("RecordGNMI of %s: %v", dut.Name(), err)
+	}
+	t.Cleanup(func() {
+		name, err := r.stop()
+		if err != nil {
+			t.Logf("gNMI recording of %s is incomplete: %v", dut.Name(), err)
+		}
+		if name != "" {
+			t.Logf("gNMI recording of %s with %d responses written to %s", dut.Name(), r.n, name)
+		}
+	})
+}
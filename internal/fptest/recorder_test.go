@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// fakeRecordStream is a Subscribe stream which returns its responses and
+// then blocks until its context is done.
+type fakeRecordStream struct {
+	grpc.ClientStream
+	ctx   context.Context
+	resps []*gpb.SubscribeResponse
+	sent  chan struct{}
+	req   *gpb.SubscribeRequest
+}
+
+func (s *fakeRecordStream) Send(req *gpb.SubscribeRequest) error {
+	s.req = req
+	return nil
+}
+
+func (s *fakeRecordStream) Recv() (*gpb.SubscribeResponse, error) {
+	if len(s.resps) > 0 {
+		r := s.resps[0]
+		s.resps = s.resps[1:]
+		return r, nil
+	}
+	close(s.sent)
+	<-s.ctx.Done()
+	return nil, s.ctx.Err()
+}
+
+type fakeRecordClient struct {
+	gpb.GNMIClient
+	stream *fakeRecordStream
+}
+
+func (c *fakeRecordClient) Subscribe(ctx context.Context, _ ...grpc.CallOption) (gpb.GNMI_SubscribeClient, error) {
+	c.stream.ctx = ctx
+	return c.stream, nil
+}
+
+func TestParseRecordPaths(t *testing.T) {
+	got, err := parseRecordPaths([]string{"/interfaces/interface[name=eth0]/state", " ", "/system/state"})
+	if err != nil {
+		t.Fatalf("parseRecordPaths() failed: %v", err)
+	}
+	want := []*gpb.Path{
+		{Elem: []*gpb.PathElem{{Name: "interfaces"}, {Name: "interface", Key: map[string]string{"name": "eth0"}}, {Name: "state"}}},
+		{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}}},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("parseRecordPaths() (-want +got):\n%s", diff)
+	}
+	if _, err := parseRecordPaths([]string{"/interfaces/interface[=eth0]"}); err == nil {
+		t.Errorf("parseRecordPaths() of an invalid path got no error")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	resps := []*gpb.SubscribeResponse{{
+		Response: &gpb.SubscribeResponse_Update{Update: &gpb.Notification{
+			Timestamp: 1,
+			Update: []*gpb.Update{{
+				Path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "system"}, {Name: "state"}, {Name: "hostname"}}},
+				Val:  &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "dut"}},
+			}},
+		}},
+	}, {
+		Response: &gpb.SubscribeResponse_SyncResponse{SyncResponse: true},
+	}}
+	paths := []*gpb.Path{{Elem: []*gpb.PathElem{{Name: "system"}}}}
+
+	for _, format := range []string{recordJSON, recordProto} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			defer func(d string) { *outputsDir = d }(*outputsDir)
+			*outputsDir = dir
+
+			stream := &fakeRecordStream{resps: append([]*gpb.SubscribeResponse{}, resps...), sent: make(chan struct{})}
+			r, err := startRecorder(context.Background(), "dut", format, &fakeRecordClient{stream: stream}, paths)
+			if err != nil {
+				t.Fatalf("startRecorder() failed: %v", err)
+			}
+			select {
+			case <-stream.sent:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Responses not received")
+			}
+			name, err := r.stop()
+			if err != nil {
+				t.Fatalf("stop() failed: %v", err)
+			}
+			if got := stream.req.GetSubscribe().GetSubscription(); len(got) != len(paths) {
+				t.Errorf("Subscribed to %d paths, want %d", len(got), len(paths))
+			}
+
+			b, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatalf("Cannot read the recording: %v", err)
+			}
+			var got []*gpb.SubscribeResponse
+			switch format {
+			case recordJSON:
+				sc := bufio.NewScanner(bytes.NewReader(b))
+				for sc.Scan() {
+					var line struct {
+						Received time.Time       `json:"received"`
+						Response json.RawMessage `json:"response"`
+					}
+					if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+						t.Fatalf("Cannot parse line %q: %v", sc.Text(), err)
+					}
+					if line.Received.IsZero() {
+						t.Errorf("Line %q has no receive time", sc.Text())
+					}
+					resp := &gpb.SubscribeResponse{}
+					if err := protojson.Unmarshal(line.Response, resp); err != nil {
+						t.Fatalf("Cannot parse response %s: %v", line.Response, err)
+					}
+					got = append(got, resp)
+				}
+			case recordProto:
+				rd := bufio.NewReader(bytes.NewReader(b))
+				for {
+					resp := &gpb.SubscribeResponse{}
+					if err := protodelim.UnmarshalFrom(rd, resp); err != nil {
+						break
+					}
+					got = append(got, resp)
+				}
+			}
+			if diff := cmp.Diff(resps, got, protocmp.Transform()); diff != "" {
+				t.Errorf("Recorded responses (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/featureprofiles/internal/metadata"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/eventlis"
+)
+
+var writeResults = flag.Bool("write_results", false,
+	"write the results of the tests, with the validations and values recorded with fptest.Validate and fptest.RecordValue, into -outputs_dir as JSON and as JUnit XML; implies -test.v")
+
+// Statuses of a TestResult.
+const (
+	StatusPass    = "PASS"
+	StatusFail    = "FAIL"
+	StatusSkip    = "SKIP"
+	StatusRunning = "RUN" // The test has not completed.
+)
+
+// Validation is the outcome of a check made by a test.
+type Validation struct {
+	Message string `json:"message"`
+	Passed  bool   `json:"passed"`
+}
+
+// Measurement is a value measured by a test.
+type Measurement struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+}
+
+// TestResult is the result of a test or subtest.
+type TestResult struct {
+	Name            string         `json:"name"`
+	Status          string         `json:"status"`
+	Start           time.Time      `json:"start"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	Validations     []*Validation  `json:"validations,omitempty"`
+	Measurements    []*Measurement `json:"measurements,omitempty"`
+}
+
+// Results are the results of the tests of a test binary, in the order in which
+// they started.
+type Results struct {
+	PlanID      string        `json:"plan_id,omitempty"`
+	UUID        string        `json:"uuid,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Tests       []*TestResult `json:"tests"`
+}
+
+// resultsRecorder records the results of the tests.
+type resultsRecorder struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	tests  []*TestResult
+	byName map[string]*TestResult
+}
+
+func newResultsRecorder(now func() time.Time) *resultsRecorder {
+	return &resultsRecorder{now: now, byName: map[string]*TestResult{}}
+}
+
+// results records the results of the tests of the test binary.
+var results = newResultsRecorder(time.Now)
+
+// result returns the result of the test named name, which is created when the
+// test is first seen. r.mu must be held.
+func (r *resultsRecorder) result(name string) (tr *TestResult, created bool) {
+	if tr, ok := r.byName[name]; ok {
+		return tr, false
+	}
+	tr = &TestResult{Name: name, Status: StatusRunning, Start: r.now()}
+	r.tests = append(r.tests, tr)
+	r.byName[name] = tr
+	return tr, true
+}
+
+// run records that the test named name started.
+func (r *resultsRecorder) run(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result(name)
+}
+
+// end records that the test named name completed with status in d.
+func (r *resultsRecorder) end(name, status string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tr, _ := r.result(name)
+	tr.Status = status
+	tr.DurationSeconds = d.Seconds()
+}
+
+var (
+	runLine = regexp.MustCompile(`^\x16?=== RUN\s+(\S+)`)
+	endLine = regexp.MustCompile(`^[\s\x16]*--- (PASS|FAIL|SKIP): (\S+) \(([0-9.]+)s\)`)
+)
+
+// parseLog records the start and the end of the tests from their verbose log,
+// in which the statuses are the same as those of a TestResult.
+func (r *resultsRecorder) parseLog(rd io.Reader) error {
+	br := bufio.NewReader(rd)
+	for {
+		line, err := br.ReadString('\n')
+		if m := runLine.FindStringSubmatch(line); m != nil {
+			r.run(m[1])
+		} else if m := endLine.FindStringSubmatch(line); m != nil {
+			secs, _ := strconv.ParseFloat(m[3], 64)
+			r.end(m[2], m[1], time.Duration(secs*float64(time.Second)))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// track returns the result of t, whose status and duration are also set when
+// t completes, in case its end is missing from the log.
+func (r *resultsRecorder) track(t testing.TB) *TestResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tr, created := r.result(t.Name())
+	if !created {
+		return tr
+	}
+	t.Cleanup(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		tr.DurationSeconds = r.now().Sub(tr.Start).Seconds()
+		switch {
+		case t.Failed():
+			tr.Status = StatusFail
+		case t.Skipped():
+			tr.Status = StatusSkip
+		default:
+			tr.Status = StatusPass
+		}
+	})
+	return tr
+}
+
+func (r *resultsRecorder) validate(t testing.TB, ok bool, msg string) {
+	tr := r.track(t)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tr.Validations = append(tr.Validations, &Validation{Message: msg, Passed: ok})
+}
+
+func (r *resultsRecorder) record(t testing.TB, name string, value float64, unit string) {
+	tr := r.track(t)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tr.Measurements = append(tr.Measurements, &Measurement{Name: name, Value: value, Unit: unit})
+}
+
+// report returns a copy of the results recorded so far.
+func (r *resultsRecorder) report() *Results {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := &Results{}
+	if md := metadata.Get(); md != nil {
+		res.PlanID = md.GetPlanId()
+		res.UUID = md.GetUuid()
+		res.Description = md.GetDescription()
+	}
+	for _, tr := range r.tests {
+		c := *tr
+		c.Validations = append([]*Validation(nil), tr.Validations...)
+		c.Measurements = append([]*Measurement(nil), tr.Measurements...)
+		res.Tests = append(res.Tests, &c)
+	}
+	return res
+}
+
+// Validate records a validation of t with the formatted message, which passed
+// if ok, and reports the message as an error of t if not. It returns ok.
+func Validate(t testing.TB, ok bool, format string, args ...any) bool {
+	t.Helper()
+	msg := fmt.Sprintf(format, args...)
+	results.validate(t, ok, msg)
+	if !ok {
+		t.Error(msg)
+	}
+	return ok
+}
+
+// RecordValue records the value measured by t for name, in unit which may be
+// empty, and logs it.
+func RecordValue(t testing.TB, name string, value float64, unit string) {
+	t.Helper()
+	results.record(t, name, value, unit)
+	t.Logf("%s: %s", name, formatValue(value, unit))
+}
+
+// formatValue returns value followed by unit if any.
+func formatValue(value float64, unit string) string {
+	s := strconv.FormatFloat(value, 'g', -1, 64)
+	if unit != "" {
+		s += " " + unit
+	}
+	return s
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName  string           `xml:"classname,attr"`
+	Name       string           `xml:"name,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Skipped    *junitMessage    `xml:"skipped,omitempty"`
+	SystemOut  string           `xml:"system-out,omitempty"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// junitTime formats seconds as a JUnit time attribute.
+func junitTime(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// junit returns res in the JUnit XML format, with one test suite of the test
+// binary and one test case per test. The measurements are properties
+// of the test cases, and the validations their output.
+func junit(res *Results) ([]byte, error) {
+	suite := junitTestSuite{Name: res.PlanID}
+	if suite.Name == "" {
+		suite.Name = "featureprofiles"
+	}
+	var start, end time.Time
+	for _, tr := range res.Tests {
+		tc := junitTestCase{ClassName: suite.Name, Name: tr.Name, Time: junitTime(tr.DurationSeconds)}
+		if len(tr.Measurements) > 0 {
+			tc.Properties = &junitProperties{}
+			for _, m := range tr.Measurements {
+				tc.Properties.Properties = append(tc.Properties.Properties, junitProperty{Name: m.Name, Value: formatValue(m.Value, m.Unit)})
+			}
+		}
+		var out, failed []string
+		for _, v := range tr.Validations {
+			status := StatusPass
+			if !v.Passed {
+				status = StatusFail
+				failed = append(failed, v.Message)
+			}
+			out = append(out, status+": "+v.Message)
+		}
+		tc.SystemOut = strings.Join(out, "\n")
+		switch tr.Status {
+		case StatusFail:
+			suite.Failures++
+			tc.Failure = &junitMessage{Message: "test failed", Text: strings.Join(failed, "\n")}
+		case StatusSkip:
+			suite.Skipped++
+			tc.Skipped = &junitMessage{}
+		case StatusRunning:
+			suite.Failures++
+			tc.Failure = &junitMessage{Message: "test did not complete"}
+		}
+		suite.Cases = append(suite.Cases, tc)
+		if start.IsZero() || tr.Start.Before(start) {
+			start = tr.Start
+		}
+		if e := tr.Start.Add(time.Duration(tr.DurationSeconds * float64(time.Second))); e.After(end) {
+			end = e
+		}
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = junitTime(end.Sub(start).Seconds())
+	b, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+// writeResultFiles writes res into the test outputs directory as JSON and as
+// JUnit XML. It returns the filenames.
+func writeResultFiles(res *Results) ([]string, error) {
+	b, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	jsonName, err := WriteOutput("results", ".json", string(b))
+	if err != nil {
+		return nil, err
+	}
+	x, err := junit(res)
+	if err != nil {
+		return []string{jsonName}, err
+	}
+	xmlName, err := WriteOutput("results", ".xml", string(x))
+	return []string{jsonName, xmlName}, err
+}
+
+// testLog passes the test log written to stdout through a pipe, from which
+// the results of all the tests are parsed.
+type testLog struct {
+	stdout *os.File
+	w      *os.File
+	done   chan struct{}
+}
+
+// startTestLog replaces stdout with a pipe whose log is parsed into r. It must
+// be started before the tests, and before Ondatra's JUnit XML converter, which
+// then writes into the pipe, so that the pipe is closed last.
+func startTestLog(r *resultsRecorder) (*testLog, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	l := &testLog{stdout: os.Stdout, w: pw, done: make(chan struct{})}
+	go func() {
+		defer close(l.done)
+		if err := r.parseLog(io.TeeReader(pr, l.stdout)); err != nil {
+			log.Warningf("Cannot parse the test log: %v", err)
+		}
+		// Keep reading so that the tests never block writing their log.
+		io.Copy(io.Discard, pr)
+	}()
+	os.Stdout = pw
+	return l, nil
+}
+
+// stop restores stdout and waits until the log is parsed.
+func (l *testLog) stop() {
+	os.Stdout = l.stdout
+	l.w.Close()
+	<-l.done
+}
+
+// registerResults registers the event listener that writes the results of the
+// tests if -write_results is set. The pass, fail or skip status and the
+// duration of every test and subtest are parsed from the verbose test log, as
+// Ondatra does for -xml, and Validate and RecordValue add to them.
+func registerResults() {
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+	if !*writeResults {
+		return
+	}
+	if f := flag.Lookup("test.v"); f != nil && f.Value.String() == "false" {
+		if err := f.Value.Set("true"); err != nil {
+			log.Warningf("Cannot set -test.v for the test results: %v", err)
+		}
+	}
+	tl, err := startTestLog(results)
+	if err != nil {
+		log.Warningf("Cannot read the test log for the test results: %v", err)
+	}
+	ondatra.EventListener().AddAfterTestsCallback(func(*eventlis.AfterTestsEvent) error {
+		if tl != nil {
+			tl.stop()
+		}
+		// The results are best effort and must not change the test result.
+		if _, err := writeResultFiles(results.report()); err != nil {
+			log.Warningf("Cannot write the test results: %v", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,288 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeTB is a test whose completion is simulated by calling done.
+type fakeTB struct {
+	testing.TB
+	name     string
+	failed   bool
+	skipped  bool
+	cleanups []func()
+}
+
+func (f *fakeTB) Name() string        { return f.name }
+func (f *fakeTB) Failed() bool        { return f.failed }
+func (f *fakeTB) Skipped() bool       { return f.skipped }
+func (f *fakeTB) Cleanup(fn func())   { f.cleanups = append(f.cleanups, fn) }
+func (f *fakeTB) Error(...any)        { f.failed = true }
+func (f *fakeTB) Logf(string, ...any) {}
+func (f *fakeTB) Helper()             {}
+
+// done runs the cleanup functions of f.
+func (f *fakeTB) done() {
+	for _, fn := range f.cleanups {
+		fn()
+	}
+}
+
+// fakeClock is a clock which advances by one second at every reading.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time {
+	c.t = c.t.Add(time.Second)
+	return c.t
+}
+
+func TestResultsRecorder(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{t: start}
+	r := newResultsRecorder(clock.now)
+
+	pass := &fakeTB{name: "TestA/pass"}
+	fail := &fakeTB{name: "TestA/fail"}
+	skip := &fakeTB{name: "TestA/skip", skipped: true}
+	running := &fakeTB{name: "TestA/running"}
+
+	r.track(pass)                                     // start 1s
+	r.validate(pass, true, "got 100 packets")         // no new reading
+	r.record(pass, "throughput", 1500.5, "entries/s") // no new reading
+	r.validate(fail, false, "got 0 packets")          // start 2s
+	r.track(skip)                                     // start 3s
+	r.track(running)                                  // start 4s
+	fail.failed = true
+	pass.done() // end 5s
+	fail.done() // end 6s
+	skip.done() // end 7s
+
+	got := r.report()
+	want := &Results{Tests: []*TestResult{{
+		Name:            "TestA/pass",
+		Status:          StatusPass,
+		Start:           start.Add(1 * time.Second),
+		DurationSeconds: 4,
+		Validations:     []*Validation{{Message: "got 100 packets", Passed: true}},
+		Measurements:    []*Measurement{{Name: "throughput", Value: 1500.5, Unit: "entries/s"}},
+	}, {
+		Name:            "TestA/fail",
+		Status:          StatusFail,
+		Start:           start.Add(2 * time.Second),
+		DurationSeconds: 4,
+		Validations:     []*Validation{{Message: "got 0 packets", Passed: false}},
+	}, {
+		Name:            "TestA/skip",
+		Status:          StatusSkip,
+		Start:           start.Add(3 * time.Second),
+		DurationSeconds: 4,
+	}, {
+		Name:   "TestA/running",
+		Status: StatusRunning,
+		Start:  start.Add(4 * time.Second),
+	}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("report() got unexpected diff (-want +got): %s", diff)
+	}
+}
+
+const testLogText = `=== RUN   TestA
+=== RUN   TestA/pass
+    results_test.go:10: got 100 packets
+=== RUN   TestA/fail
+    results_test.go:20: got 0 packets
+=== RUN   TestA/skip
+=== RUN   TestA/running
+--- FAIL: TestA (3.50s)
+    --- PASS: TestA/pass (1.25s)
+    --- FAIL: TestA/fail (2.00s)
+    --- SKIP: TestA/skip (0.00s)
+` + "\x16=== RUN   TestB\n\x16--- PASS: TestB (0.10s)\nFAIL\n" // -test.v=test2json
+
+func TestParseLog(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{t: start}
+	r := newResultsRecorder(clock.now)
+
+	pass := &fakeTB{name: "TestA/pass"}
+	r.record(pass, "throughput", 1500.5, "entries/s") // start 1s, before its log
+	if err := r.parseLog(strings.NewReader(testLogText)); err != nil {
+		t.Fatalf("parseLog() failed: %v", err)
+	}
+
+	got := r.report()
+	want := &Results{Tests: []*TestResult{{
+		Name:            "TestA/pass",
+		Status:          StatusPass,
+		Start:           start.Add(1 * time.Second),
+		DurationSeconds: 1.25,
+		Measurements:    []*Measurement{{Name: "throughput", Value: 1500.5, Unit: "entries/s"}},
+	}, {
+		Name:            "TestA",
+		Status:          StatusFail,
+		Start:           start.Add(2 * time.Second),
+		DurationSeconds: 3.5,
+	}, {
+		Name:            "TestA/fail",
+		Status:          StatusFail,
+		Start:           start.Add(3 * time.Second),
+		DurationSeconds: 2,
+	}, {
+		Name:   "TestA/skip",
+		Status: StatusSkip,
+		Start:  start.Add(4 * time.Second),
+	}, {
+		Name:   "TestA/running",
+		Status: StatusRunning,
+		Start:  start.Add(5 * time.Second),
+	}, {
+		Name:            "TestB",
+		Status:          StatusPass,
+		Start:           start.Add(6 * time.Second),
+		DurationSeconds: 0.1,
+	}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseLog() got unexpected diff (-want +got): %s", diff)
+	}
+}
+
+func TestTestLog(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "stdout")
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	saved := os.Stdout
+	defer func() { os.Stdout = saved }()
+	os.Stdout = f
+
+	r := newResultsRecorder(time.Now)
+	l, err := startTestLog(r)
+	if err != nil {
+		t.Fatalf("startTestLog() failed: %v", err)
+	}
+	fmt.Fprint(os.Stdout, testLogText)
+	l.stop()
+
+	if os.Stdout != f {
+		t.Errorf("stop() did not restore stdout")
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != testLogText {
+		t.Errorf("startTestLog() passed through %q, want %q", b, testLogText)
+	}
+	if got, want := len(r.report().Tests), 6; got != want {
+		t.Errorf("startTestLog() recorded %d tests, want %d", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	saved := results
+	defer func() { results = saved }()
+	results = newResultsRecorder(time.Now)
+
+	f := &fakeTB{name: "TestValidate"}
+	if !Validate(f, true, "got %d, want %d", 1, 1) {
+		t.Errorf("Validate(true) got false")
+	}
+	if f.failed {
+		t.Errorf("Validate(true) failed the test")
+	}
+	if Validate(f, false, "got %d, want %d", 2, 1) {
+		t.Errorf("Validate(false) got true")
+	}
+	if !f.failed {
+		t.Errorf("Validate(false) did not fail the test")
+	}
+	want := []*Validation{{Message: "got 1, want 1", Passed: true}, {Message: "got 2, want 1", Passed: false}}
+	if diff := cmp.Diff(want, results.report().Tests[0].Validations); diff != "" {
+		t.Errorf("Validate() recorded unexpected validations diff (-want +got): %s", diff)
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := &Results{PlanID: "TEST-1.1", Tests: []*TestResult{{
+		Name:            "TestA/pass",
+		Status:          StatusPass,
+		Start:           start,
+		DurationSeconds: 1.5,
+		Validations:     []*Validation{{Message: "got 100 packets", Passed: true}},
+		Measurements:    []*Measurement{{Name: "throughput", Value: 1500.5, Unit: "entries/s"}},
+	}, {
+		Name:            "TestA/fail",
+		Status:          StatusFail,
+		Start:           start.Add(2 * time.Second),
+		DurationSeconds: 1,
+		Validations:     []*Validation{{Message: "got 100 packets", Passed: true}, {Message: "got 0 packets", Passed: false}},
+	}, {
+		Name:   "TestA/skip",
+		Status: StatusSkip,
+		Start:  start.Add(3 * time.Second),
+	}}}
+	b, err := junit(res)
+	if err != nil {
+		t.Fatalf("junit() failed: %v", err)
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal(b, &got); err != nil {
+		t.Fatalf("junit() got invalid XML %s: %v", b, err)
+	}
+	want := junitTestSuites{
+		XMLName: xml.Name{Local: "testsuites"},
+		Suites: []junitTestSuite{{
+			Name:     "TEST-1.1",
+			Tests:    3,
+			Failures: 1,
+			Skipped:  1,
+			Time:     "3.000",
+			Cases: []junitTestCase{{
+				ClassName:  "TEST-1.1",
+				Name:       "TestA/pass",
+				Time:       "1.500",
+				Properties: &junitProperties{Properties: []junitProperty{{Name: "throughput", Value: "1500.5 entries/s"}}},
+				SystemOut:  "PASS: got 100 packets",
+			}, {
+				ClassName: "TEST-1.1",
+				Name:      "TestA/fail",
+				Time:      "1.000",
+				Failure:   &junitMessage{Message: "test failed", Text: "got 0 packets"},
+				SystemOut: "PASS: got 100 packets\nFAIL: got 0 packets",
+			}, {
+				ClassName: "TEST-1.1",
+				Name:      "TestA/skip",
+				Time:      "0.000",
+				Skipped:   &junitMessage{},
+			}},
+		}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("junit() got unexpected diff (-want +got): %s", diff)
+	}
+}
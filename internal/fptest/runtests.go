@@ -42,6 +42,10 @@ func RunTests(m *testing.M) {
 	if err := initMetadata(); err != nil {
 		log.Errorf("Unable to initialize test metadata: %v", err)
 	}
+	registerSupportBundle()
+	registerRecorder()
+	registerPathCoverage()
+	registerResults()
 	ondatra.RunTests(m, binding.New)
 }
 
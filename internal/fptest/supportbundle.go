@@ -0,0 +1,266 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/binding"
+	"github.com/openconfig/ondatra/eventlis"
+	"google.golang.org/protobuf/encoding/prototext"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	opb "github.com/openconfig/ondatra/proto"
+)
+
+var (
+	supportBundleOnFailure = flag.Bool("support_bundle_on_failure", false,
+		"collect a support bundle of every DUT into -outputs_dir when a test fails, instead of only the Healthz artifacts of -healthz_on_failure")
+	supportBundleTimeout = flag.Duration("support_bundle_timeout", 10*time.Minute,
+		"time allowed for collecting the support bundle of each DUT")
+	techSupportCommands = flag.String("tech_support_commands", "",
+		"comma separated CLI commands collected into the support bundle; defaults to the tech-support command of the DUT vendor")
+)
+
+// techSupportCLI is the tech-support CLI command of each vendor.
+var techSupportCLI = map[opb.Device_Vendor]string{
+	opb.Device_ARISTA:  "show tech-support",
+	opb.Device_CISCO:   "show tech-support",
+	opb.Device_JUNIPER: "request support information",
+	opb.Device_NOKIA:   "admin show tech-support",
+}
+
+// bundleDUTs holds the DUTs of the reservation, recorded before the tests
+// start so that a support bundle can be collected after a failure. It is a
+// copy of the DUTs of the reservation, so that the collection is not recorded
+// by the wrappers of -path_coverage.
+var bundleDUTs []binding.DUT
+
+// registerSupportBundle registers the event listeners that collect a support
+// bundle, or only the Healthz artifacts, from every DUT in the reservation
+// when the tests fail.
+func registerSupportBundle() {
+	ondatra.EventListener().AddBeforeTestsCallback(func(e *eventlis.BeforeTestsEvent) error {
+		bundleDUTs = nil
+		for _, dut := range e.Reservation.DUTs {
+			bundleDUTs = append(bundleDUTs, dut)
+		}
+		return nil
+	})
+	ondatra.EventListener().AddAfterTestsCallback(func(e *eventlis.AfterTestsEvent) error {
+		if e.ExitCode == nil || *e.ExitCode == 0 {
+			return nil
+		}
+		switch {
+		case *supportBundleOnFailure:
+			if _, err := writeSupportBundle(bundleDUTs); err != nil {
+				log.Warningf("Failed to collect support bundle: %v", err)
+			}
+		case *healthzOnFailure:
+			if err := writeHealthz(bundleDUTs); err != nil {
+				log.Warningf("Failed to collect Healthz artifacts: %v", err)
+			}
+		}
+		// Collection is best effort and must not change the test result.
+		return nil
+	})
+}
+
+// CollectSupportBundle collects the Healthz artifacts, the tech-support CLI
+// output and a gNMI state snapshot of the given DUTs into a single archive in
+// the test outputs directory, and returns the path of the archive. Failing to
+// collect parts of the bundle is logged but does not fail the test.
+func CollectSupportBundle(t testing.TB, duts ...*ondatra.DUTDevice) string {
+	t.Helper()
+	var bds []binding.DUT
+	for _, dut := range duts {
+		bds = append(bds, dut.RawAPIs().BindingDUT())
+	}
+	name, err := writeSupportBundle(bds)
+	if err != nil {
+		t.Logf("Support bundle is incomplete: %v", err)
+	}
+	if name != "" {
+		t.Logf("Support bundle written to %s", name)
+	}
+	return name
+}
+
+// writeSupportBundle collects the support bundle of the given DUTs and
+// writes it to the test outputs directory.
+func writeSupportBundle(duts []binding.DUT) (string, error) {
+	b := &supportBundle{}
+	var errs []error
+	for _, dut := range duts {
+		ctx, cancel := context.WithTimeout(context.Background(), *supportBundleTimeout)
+		if err := collectDUT(ctx, b, dut); err != nil {
+			errs = append(errs, fmt.Errorf("DUT %s: %w", dut.Name(), err))
+		}
+		cancel()
+	}
+	archive, err := b.archive()
+	if err != nil {
+		return "", errors.Join(append(errs, err)...)
+	}
+	name, err := WriteOutput("support_bundle", ".tar.gz", string(archive))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return name, errors.Join(errs...)
+}
+
+// collectDUT adds the Healthz artifacts, tech-support CLI output and gNMI
+// state snapshot of the DUT to the support bundle.
+func collectDUT(ctx context.Context, b *supportBundle, dut binding.DUT) error {
+	var errs []error
+	if err := collectHealthz(ctx, b, dut); err != nil {
+		errs = append(errs, fmt.Errorf("healthz: %w", err))
+	}
+	if err := collectTechSupport(ctx, b, dut); err != nil {
+		errs = append(errs, fmt.Errorf("tech-support: %w", err))
+	}
+	if err := collectStateSnapshot(ctx, b, dut); err != nil {
+		errs = append(errs, fmt.Errorf("gNMI state snapshot: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// collectTechSupport runs the tech-support CLI commands on the DUT and adds
+// their output to the support bundle.
+func collectTechSupport(ctx context.Context, b *supportBundle, dut binding.DUT) error {
+	var cmds []string
+	switch {
+	case *techSupportCommands != "":
+		cmds = strings.Split(*techSupportCommands, ",")
+	case techSupportCLI[dut.Vendor()] != "":
+		cmds = []string{techSupportCLI[dut.Vendor()]}
+	default:
+		return fmt.Errorf("no tech-support command known for vendor %v", dut.Vendor())
+	}
+	cli, err := dut.DialCLI(ctx)
+	if err != nil {
+		return fmt.Errorf("dialing CLI: %w", err)
+	}
+	var errs []error
+	for _, cmd := range cmds {
+		cmd = strings.TrimSpace(cmd)
+		res, err := cli.RunCommand(ctx, cmd)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", cmd, err))
+			continue
+		}
+		if msg := res.Error(); msg != "" {
+			errs = append(errs, fmt.Errorf("%q: %s", cmd, msg))
+		}
+		b.add(path.Join(dut.Name(), "cli", sanitizeFilename(cmd)+".txt"), []byte(res.Output()))
+	}
+	return errors.Join(errs...)
+}
+
+// collectStateSnapshot adds the gNMI state of the DUT to the support bundle.
+func collectStateSnapshot(ctx context.Context, b *supportBundle, dut binding.DUT) error {
+	gnmic, err := dut.DialGNMI(ctx)
+	if err != nil {
+		return fmt.Errorf("dialing gNMI: %w", err)
+	}
+	resp, err := gnmic.Get(ctx, &gpb.GetRequest{
+		Path:     []*gpb.Path{{Origin: "openconfig"}},
+		Type:     gpb.GetRequest_STATE,
+		Encoding: gpb.Encoding_JSON_IETF,
+	})
+	if err != nil {
+		return err
+	}
+	b.add(path.Join(dut.Name(), "gnmi_state.txt"), []byte(prototext.Format(resp)))
+	return nil
+}
+
+// supportBundle accumulates the files of a support bundle.
+type supportBundle struct {
+	files map[string][]byte
+}
+
+// add adds a file to the bundle, replacing any file with the same name.
+func (b *supportBundle) add(name string, content []byte) {
+	if b.files == nil {
+		b.files = map[string][]byte{}
+	}
+	b.files[name] = content
+}
+
+// names returns the sorted names of the files of the bundle.
+func (b *supportBundle) names() []string {
+	var names []string
+	for name := range b.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeFiles writes each file of the bundle separately to the test outputs
+// directory, with the directories of its name flattened into the filename.
+func (b *supportBundle) writeFiles() error {
+	var errs []error
+	for _, name := range b.names() {
+		ext := path.Ext(name)
+		if _, err := WriteOutput(strings.TrimSuffix(name, ext), ext, string(b.files[name])); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// archive returns the files of the bundle as a gzipped tarball.
+func (b *supportBundle) archive() ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range b.names() {
+		content := b.files[name]
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fptest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSupportBundleArchive(t *testing.T) {
+	b := &supportBundle{}
+	b.add("dut/gnmi_state.txt", []byte("state"))
+	b.add("dut/cli/show_tech-support.txt", []byte("old"))
+	b.add("dut/cli/show_tech-support.txt", []byte("tech"))
+
+	archive, err := b.archive()
+	if err != nil {
+		t.Fatalf("archive() failed: %v", err)
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("Cannot read gzip: %v", err)
+	}
+	tr := tar.NewReader(gr)
+	got := map[string]string{}
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Cannot read tar: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Cannot read %s: %v", hdr.Name, err)
+		}
+		names = append(names, hdr.Name)
+		got[hdr.Name] = string(content)
+	}
+
+	want := map[string]string{
+		"dut/cli/show_tech-support.txt": "tech",
+		"dut/gnmi_state.txt":            "state",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("archive() contents (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"dut/cli/show_tech-support.txt", "dut/gnmi_state.txt"}, names); diff != "" {
+		t.Errorf("archive() file order (-want +got):\n%s", diff)
+	}
+}
+
+func TestSupportBundleWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	defer func(d string) { *outputsDir = d }(*outputsDir)
+	*outputsDir = dir
+
+	b := &supportBundle{}
+	b.add("dut/healthz/chassis.txt", []byte("status"))
+	b.add("dut/healthz/chassis_core.bin", []byte("core"))
+	if err := b.writeFiles(); err != nil {
+		t.Fatalf("writeFiles() failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Cannot read %s: %v", dir, err)
+	}
+	got := map[string]string{}
+	for _, e := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatalf("Cannot read %s: %v", e.Name(), err)
+		}
+		// Drop the time and random parts that WriteOutput adds to the filename.
+		prefix, _, _ := strings.Cut(e.Name(), ".")
+		got[prefix+filepath.Ext(e.Name())] = string(content)
+	}
+	want := map[string]string{
+		"dut_healthz_chassis.txt":      "status",
+		"dut_healthz_chassis_core.bin": "core",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("writeFiles() outputs (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gnoihelper provides helpers for gNOI operations which disrupt the
+// DUT, such as reboots, switchovers and process restarts, and wait for the DUT
+// to recover from them.
+package gnoihelper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openconfig/featureprofiles/internal/components"
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/testt"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	spb "github.com/openconfig/gnoi/system"
+)
+
+const (
+	// rpcTimeout bounds each gNOI RPC sent by the helpers.
+	rpcTimeout = 2 * time.Minute
+	// pollInterval is the time between two polls of a DUT status.
+	pollInterval = 5 * time.Second
+)
+
+// RebootAndWait sends the reboot request to the DUT and waits for it to
+// recover, which is, for a reboot of the chassis, that the DUT is reachable
+// over gNMI with a new boot-time, and for all reboots that RebootStatus
+// reports that no reboot is active. It fails the test if the DUT does not
+// recover within timeout after the delay of the request, and returns the time
+// it took to recover.
+func RebootAndWait(t *testing.T, dut *ondatra.DUTDevice, req *spb.RebootRequest, timeout time.Duration) time.Duration {
+	t.Helper()
+	chassis := len(req.GetSubcomponents()) == 0
+	var bootTime uint64
+	if chassis {
+		bootTime = gnmi.Get(t, dut, gnmi.OC().System().BootTime().State())
+	}
+	start := time.Now()
+	deadline := rebootDeadline(start, req, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	_, err := dut.RawAPIs().GNOI(t).System().Reboot(ctx, req)
+	if !rebootAcked(err) {
+		t.Fatalf("Reboot(%v) failed: %v", req, err)
+	}
+	t.Logf("Reboot(%v) sent to DUT %s", req, dut.Name())
+
+	if chassis {
+		awaitNewBootTime(t, dut, bootTime, deadline)
+	}
+	awaitRebootInactive(t, dut, deadline)
+	t.Logf("DUT %s recovered from reboot after %v", dut.Name(), time.Since(start))
+	return time.Since(start)
+}
+
+// rebootDeadline returns the time by which a reboot requested at start with
+// req must be complete, which is timeout after the delay of req.
+func rebootDeadline(start time.Time, req *spb.RebootRequest, timeout time.Duration) time.Time {
+	return start.Add(time.Duration(req.GetDelay()) + timeout)
+}
+
+// rebootAcked returns whether the error err of a Reboot RPC acknowledges the
+// reboot. The DUT may close the connection without a response as it goes
+// down.
+func rebootAcked(err error) bool {
+	return err == nil || status.Code(err) == codes.Unavailable
+}
+
+// rebootDone returns whether the response resp or error err of RebootStatus
+// show that no reboot is active. DUTs that do not implement RebootStatus are
+// considered done, while other errors are those of a DUT still recovering.
+func rebootDone(resp *spb.RebootStatusResponse, err error) bool {
+	if err != nil {
+		return status.Code(err) == codes.Unimplemented
+	}
+	return !resp.GetActive()
+}
+
+// awaitNewBootTime polls the boot-time of the DUT until it differs from
+// bootTime, so that a DUT which has not yet gone down is not mistaken for one
+// which came back up, or deadline is reached.
+func awaitNewBootTime(t *testing.T, dut *ondatra.DUTDevice, bootTime uint64, deadline time.Time) {
+	t.Helper()
+	for {
+		var got uint64
+		errMsg := testt.CaptureFatal(t, func(t testing.TB) {
+			got = gnmi.Get(t, dut, gnmi.OC().System().BootTime().State())
+		})
+		switch {
+		case errMsg != nil:
+			t.Logf("DUT %s not reachable: %s, keep polling ...", dut.Name(), *errMsg)
+		case got != bootTime:
+			t.Logf("DUT %s is reachable with boot-time %d, was %d", dut.Name(), got, bootTime)
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("DUT %s not rebooted at %v: boot-time is still %d", dut.Name(), deadline, bootTime)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// awaitRebootInactive polls RebootStatus until no reboot is active on the DUT
+// or deadline is reached.
+func awaitRebootInactive(t *testing.T, dut *ondatra.DUTDevice, deadline time.Time) {
+	t.Helper()
+	for {
+		var resp *spb.RebootStatusResponse
+		var rpcErr error
+		errMsg := testt.CaptureFatal(t, func(t testing.TB) {
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			defer cancel()
+			resp, rpcErr = dut.RawAPIs().GNOI(t).System().RebootStatus(ctx, &spb.RebootStatusRequest{})
+		})
+		switch {
+		case errMsg != nil:
+			t.Logf("Could not reach gNOI on DUT %s: %s", dut.Name(), *errMsg)
+		case rebootDone(resp, rpcErr):
+			return
+		case rpcErr != nil:
+			t.Logf("RebootStatus on DUT %s failed: %v", dut.Name(), rpcErr)
+		default:
+			t.Logf("Reboot still active on DUT %s: %v", dut.Name(), resp)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Reboot of DUT %s still active at %v", dut.Name(), deadline)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// SwitchoverAndWait switches the active control processor of the DUT to the
+// given standby controller card, waits for the DUT to be reachable over gNMI
+// again and for the card to report the PRIMARY redundant role. It fails the
+// test if this does not happen within timeout and returns the response of
+// SwitchControlProcessor.
+func SwitchoverAndWait(t *testing.T, dut *ondatra.DUTDevice, standby string, timeout time.Duration) *spb.SwitchControlProcessorResponse {
+	t.Helper()
+	start := time.Now()
+	req := switchoverRequest(standby, deviations.GNOISubcomponentPath(dut))
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	resp, err := dut.RawAPIs().GNOI(t).System().SwitchControlProcessor(ctx, req)
+	if err != nil {
+		t.Fatalf("SwitchControlProcessor(%v) failed: %v", req, err)
+	}
+	t.Logf("SwitchControlProcessor(%v) response: %v", req, resp)
+
+	fptest.WaitForGNMIReachable(t, dut, timeout)
+	role := gnmi.OC().Component(standby).RedundantRole().State()
+	_, ok := gnmi.Watch(t, dut, role, time.Until(start.Add(timeout)), func(val *ygnmi.Value[oc.E_Platform_ComponentRedundantRole]) bool {
+		r, present := val.Val()
+		return present && r == oc.Platform_ComponentRedundantRole_PRIMARY
+	}).Await(t)
+	if !ok {
+		t.Fatalf("Controller card %s did not become PRIMARY within %v", standby, timeout)
+	}
+	t.Logf("DUT %s recovered from switchover after %v", dut.Name(), time.Since(start))
+	return resp
+}
+
+// switchoverRequest returns the request switching the active control
+// processor to standby, whose path is its name only if useNameOnly.
+func switchoverRequest(standby string, useNameOnly bool) *spb.SwitchControlProcessorRequest {
+	return &spb.SwitchControlProcessorRequest{
+		ControlProcessor: components.GetSubcomponentPath(standby, useNameOnly),
+	}
+}
+
+// FindProcess returns the PID of the process of the DUT with the given name,
+// or 0 if no such process is running.
+func FindProcess(t testing.TB, dut *ondatra.DUTDevice, name string) uint64 {
+	t.Helper()
+	for _, proc := range gnmi.GetAll(t, dut, gnmi.OC().System().ProcessAny().State()) {
+		if proc.GetName() == name {
+			return proc.GetPid()
+		}
+	}
+	return 0
+}
+
+// KillAndWait kills the process of the DUT with the given name using the given
+// signal and asks for it to be restarted. It then waits for a process with
+// that name and a new PID to be running, failing the test if this does not
+// happen within timeout, and returns the new PID.
+func KillAndWait(t *testing.T, dut *ondatra.DUTDevice, name string, signal spb.KillProcessRequest_Signal, timeout time.Duration) uint64 {
+	t.Helper()
+	pid := FindProcess(t, dut, name)
+	if pid == 0 {
+		t.Fatalf("Could not find PID of process %q", name)
+	}
+	start := time.Now()
+	req := killRequest(name, pid, signal)
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	if _, err := dut.RawAPIs().GNOI(t).System().KillProcess(ctx, req); err != nil {
+		t.Fatalf("KillProcess(%v) failed: %v", req, err)
+	}
+
+	deadline := start.Add(timeout)
+	for {
+		var newPID uint64
+		testt.CaptureFatal(t, func(t testing.TB) {
+			newPID = FindProcess(t, dut, name)
+		})
+		if newPID != 0 && newPID != pid {
+			t.Logf("Process %q restarted with PID %d after %v", name, newPID, time.Since(start))
+			return newPID
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Process %q not restarted within %v", name, timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// killRequest returns the request killing the process name with pid using
+// signal, and restarting it.
+func killRequest(name string, pid uint64, signal spb.KillProcessRequest_Signal) *spb.KillProcessRequest {
+	// TODO: pid type is uint64 in oc-system model, but uint32 in gNOI
+	// KillProcessRequest.
+	return &spb.KillProcessRequest{Name: name, Pid: uint32(pid), Signal: signal, Restart: true}
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnoihelper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	spb "github.com/openconfig/gnoi/system"
+	tpb "github.com/openconfig/gnoi/types"
+)
+
+func TestRebootDeadline(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		desc string
+		req  *spb.RebootRequest
+		want time.Time
+	}{{
+		desc: "no delay",
+		req:  &spb.RebootRequest{Method: spb.RebootMethod_COLD},
+		want: start.Add(10 * time.Minute),
+	}, {
+		desc: "delay",
+		req:  &spb.RebootRequest{Method: spb.RebootMethod_COLD, Delay: uint64(2 * time.Minute)},
+		want: start.Add(12 * time.Minute),
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := rebootDeadline(start, tt.req, 10*time.Minute); !got.Equal(tt.want) {
+				t.Errorf("rebootDeadline() got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebootAcked(t *testing.T) {
+	tests := []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{desc: "response", err: nil, want: true},
+		{desc: "connection closed", err: status.Error(codes.Unavailable, "transport is closing"), want: true},
+		{desc: "rejected", err: status.Error(codes.InvalidArgument, "bad method"), want: false},
+		{desc: "not a status", err: errors.New("dial failed"), want: false},
+	}
+	for _, tt := range tests {
+		if got := rebootAcked(tt.err); got != tt.want {
+			t.Errorf("rebootAcked(%s) got %t, want %t", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestRebootDone(t *testing.T) {
+	tests := []struct {
+		desc string
+		resp *spb.RebootStatusResponse
+		err  error
+		want bool
+	}{
+		{desc: "active", resp: &spb.RebootStatusResponse{Active: true}, want: false},
+		{desc: "inactive", resp: &spb.RebootStatusResponse{}, want: true},
+		{desc: "unimplemented", err: status.Error(codes.Unimplemented, "RebootStatus"), want: true},
+		{desc: "unavailable", err: status.Error(codes.Unavailable, "starting"), want: false},
+	}
+	for _, tt := range tests {
+		if got := rebootDone(tt.resp, tt.err); got != tt.want {
+			t.Errorf("rebootDone(%s) got %t, want %t", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestSwitchoverRequest(t *testing.T) {
+	tests := []struct {
+		desc        string
+		useNameOnly bool
+		want        *spb.SwitchControlProcessorRequest
+	}{{
+		desc: "component path",
+		want: &spb.SwitchControlProcessorRequest{ControlProcessor: &tpb.Path{
+			Origin: "openconfig",
+			Elem: []*tpb.PathElem{
+				{Name: "components"},
+				{Name: "component", Key: map[string]string{"name": "RP1"}},
+			},
+		}},
+	}, {
+		desc:        "name only",
+		useNameOnly: true,
+		want: &spb.SwitchControlProcessorRequest{ControlProcessor: &tpb.Path{
+			Elem: []*tpb.PathElem{{Name: "RP1"}},
+		}},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := switchoverRequest("RP1", tt.useNameOnly)
+			if diff := cmp.Diff(tt.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("switchoverRequest() got unexpected diff (-want +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestKillRequest(t *testing.T) {
+	want := &spb.KillProcessRequest{
+		Name:    "bgpd",
+		Pid:     1234,
+		Signal:  spb.KillProcessRequest_SIGNAL_TERM,
+		Restart: true,
+	}
+	got := killRequest("bgpd", 1234, spb.KillProcessRequest_SIGNAL_TERM)
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("killRequest() got unexpected diff (-want +got): %s", diff)
+	}
+}
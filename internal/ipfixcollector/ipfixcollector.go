@@ -0,0 +1,587 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ipfixcollector provides an IPFIX collector, which runs on the test
+// host, or in a container reachable by the DUT, and receives the flow export
+// messages of the DUT over UDP.
+//
+// Both IPFIX (RFC 7011) and NetFlow version 9 (RFC 3954) messages are decoded.
+// Templates are kept per exporter and observation domain, and data records
+// are decoded with them, so that tests can assert the templates as well as
+// the fields of the flow records. Typical usage looks like:
+//
+//	c, err := ipfixcollector.Listen(":4739")
+//	if err != nil {
+//	  t.Fatal(err)
+//	}
+//	defer c.Close()
+//	... configure the DUT to export flows to the port of c, and send traffic ...
+//	recs := c.Records(func(r *ipfixcollector.Record) bool {
+//	  return r.IP(ipfixcollector.DestinationIPv4Address).Equal(dst)
+//	})
+package ipfixcollector
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	versionNetFlow9 = 9
+	versionIPFIX    = 10
+	maxMessageSize  = 65535
+
+	// Set IDs of templates and options templates.
+	setNetFlow9Template        = 0
+	setNetFlow9OptionsTemplate = 1
+	setIPFIXTemplate           = 2
+	setIPFIXOptionsTemplate    = 3
+	minDataSetID               = 256
+
+	// variableLength is the length of fields of variable length.
+	variableLength = 65535
+)
+
+// IE is the ID of an information element of the IANA IPFIX registry.
+type IE uint16
+
+// Information elements of flow records asserted by tests.
+const (
+	OctetDeltaCount          IE = 1
+	PacketDeltaCount         IE = 2
+	ProtocolIdentifier       IE = 4
+	SourceTransportPort      IE = 7
+	SourceIPv4Address        IE = 8
+	IngressInterface         IE = 10
+	DestinationTransportPort IE = 11
+	DestinationIPv4Address   IE = 12
+	EgressInterface          IE = 14
+	FlowEndSysUpTime         IE = 21
+	FlowStartSysUpTime       IE = 22
+	SourceIPv6Address        IE = 27
+	DestinationIPv6Address   IE = 28
+	FlowEndReason            IE = 136
+	FlowStartMilliseconds    IE = 152
+	FlowEndMilliseconds      IE = 153
+)
+
+// Flow end reasons of the FlowEndReason information element.
+const (
+	IdleTimeout   = 1
+	ActiveTimeout = 2
+	EndOfFlow     = 3
+	ForcedEnd     = 4
+	LackResources = 5
+)
+
+// Field identifies an information element, of the IANA registry if
+// Enterprise is 0.
+type Field struct {
+	Enterprise uint32
+	ID         IE
+}
+
+// FieldSpec is a field of a template.
+type FieldSpec struct {
+	Field
+	// Length is the length of the field, or 65535 if it is variable.
+	Length uint16
+}
+
+// Template is a template, or an options template, of an exporter.
+type Template struct {
+	Source            net.Addr // The source of the message of the template.
+	Received          time.Time
+	Version           uint16
+	ObservationDomain uint32
+	ID                uint16
+	// ScopeFieldCount is the number of scope fields at the start of Fields
+	// of an options template, and 0 for a template.
+	ScopeFieldCount int
+	Fields          []FieldSpec
+}
+
+// Has returns whether the template has all the information elements ies of
+// the IANA registry.
+func (t *Template) Has(ies ...IE) bool {
+	for _, ie := range ies {
+		found := false
+		for _, f := range t.Fields {
+			if f.Enterprise == 0 && f.ID == ie {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Template) String() string {
+	return fmt.Sprintf("template %d of observation domain %d with %d fields", t.ID, t.ObservationDomain, len(t.Fields))
+}
+
+// Record is a data record decoded with a template.
+type Record struct {
+	Source            net.Addr // The source of the message of the record.
+	Received          time.Time
+	Version           uint16
+	ObservationDomain uint32
+	Sequence          uint32
+	ExportTime        time.Time
+	// SysUpTime is the uptime of the exporter of a NetFlow version 9
+	// message, and 0 for IPFIX.
+	SysUpTime  time.Duration
+	TemplateID uint16
+	Fields     map[Field][]byte
+}
+
+// Uint returns the value of the unsigned information element ie of the IANA
+// registry, which may be of reduced size, and whether the record has it.
+func (r *Record) Uint(ie IE) (uint64, bool) {
+	b, ok := r.Fields[Field{ID: ie}]
+	if !ok || len(b) > 8 {
+		return 0, false
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, true
+}
+
+// IP returns the value of the address information element ie of the IANA
+// registry, or nil if the record does not have it.
+func (r *Record) IP(ie IE) net.IP {
+	b, ok := r.Fields[Field{ID: ie}]
+	if !ok || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil
+	}
+	return net.IP(b)
+}
+
+func (r *Record) String() string {
+	src, dst := r.IP(SourceIPv4Address), r.IP(DestinationIPv4Address)
+	if src == nil {
+		src, dst = r.IP(SourceIPv6Address), r.IP(DestinationIPv6Address)
+	}
+	proto, _ := r.Uint(ProtocolIdentifier)
+	sport, _ := r.Uint(SourceTransportPort)
+	dport, _ := r.Uint(DestinationTransportPort)
+	pkts, _ := r.Uint(PacketDeltaCount)
+	octets, _ := r.Uint(OctetDeltaCount)
+	return fmt.Sprintf("record of template %d: %v:%d -> %v:%d protocol %d, %d packets, %d octets",
+		r.TemplateID, src, sport, dst, dport, proto, pkts, octets)
+}
+
+type templateKey struct {
+	source            string
+	version           uint16
+	observationDomain uint32
+	id                uint16
+}
+
+// Decoder decodes the messages of exporters, keeping their templates.
+type Decoder struct {
+	templates map[templateKey]*Template
+}
+
+// NewDecoder returns a decoder without templates.
+func NewDecoder() *Decoder {
+	return &Decoder{templates: map[templateKey]*Template{}}
+}
+
+var errTruncated = errors.New("truncated message")
+
+// header is the header of a message, in the IPFIX or NetFlow version 9
+// format.
+type header struct {
+	version           uint16
+	exportTime        time.Time
+	sysUpTime         time.Duration
+	sequence          uint32
+	observationDomain uint32
+}
+
+// Decode decodes the message b of the exporter src, received at received. It
+// returns the templates and the data records of the message. Data records of
+// templates which are not known yet are skipped.
+func (d *Decoder) Decode(b []byte, src net.Addr, received time.Time) ([]*Template, []*Record, error) {
+	if len(b) < 4 {
+		return nil, nil, errTruncated
+	}
+	var h header
+	h.version = binary.BigEndian.Uint16(b)
+	var sets []byte
+	switch h.version {
+	case versionIPFIX:
+		if len(b) < 16 {
+			return nil, nil, errTruncated
+		}
+		n := int(binary.BigEndian.Uint16(b[2:]))
+		if n < 16 || n > len(b) {
+			return nil, nil, fmt.Errorf("invalid IPFIX message length %d of %d bytes", n, len(b))
+		}
+		h.exportTime = time.Unix(int64(binary.BigEndian.Uint32(b[4:])), 0)
+		h.sequence = binary.BigEndian.Uint32(b[8:])
+		h.observationDomain = binary.BigEndian.Uint32(b[12:])
+		sets = b[16:n]
+	case versionNetFlow9:
+		if len(b) < 20 {
+			return nil, nil, errTruncated
+		}
+		h.sysUpTime = time.Duration(binary.BigEndian.Uint32(b[4:])) * time.Millisecond
+		h.exportTime = time.Unix(int64(binary.BigEndian.Uint32(b[8:])), 0)
+		h.sequence = binary.BigEndian.Uint32(b[12:])
+		h.observationDomain = binary.BigEndian.Uint32(b[16:])
+		sets = b[20:]
+	default:
+		return nil, nil, fmt.Errorf("unsupported version %d", h.version)
+	}
+
+	var templates []*Template
+	var records []*Record
+	for len(sets) > 0 {
+		if len(sets) < 4 {
+			return nil, nil, errTruncated
+		}
+		id := binary.BigEndian.Uint16(sets)
+		n := int(binary.BigEndian.Uint16(sets[2:]))
+		if n < 4 || n > len(sets) {
+			return nil, nil, fmt.Errorf("invalid length %d of set %d", n, id)
+		}
+		body := sets[4:n]
+		sets = sets[n:]
+		switch {
+		case id >= minDataSetID:
+			t, ok := d.templates[templateKey{fmt.Sprint(src), h.version, h.observationDomain, id}]
+			if !ok {
+				continue
+			}
+			recs, err := decodeData(body, t, &h)
+			if err != nil {
+				return nil, nil, fmt.Errorf("data set %d: %w", id, err)
+			}
+			for _, r := range recs {
+				r.Source, r.Received = src, received
+			}
+			records = append(records, recs...)
+		case h.version == versionIPFIX && (id == setIPFIXTemplate || id == setIPFIXOptionsTemplate),
+			h.version == versionNetFlow9 && (id == setNetFlow9Template || id == setNetFlow9OptionsTemplate):
+			ts, withdrawn, err := decodeTemplates(body, h.version, id == setIPFIXOptionsTemplate || id == setNetFlow9OptionsTemplate)
+			if err != nil {
+				return nil, nil, fmt.Errorf("template set %d: %w", id, err)
+			}
+			for _, tid := range withdrawn {
+				delete(d.templates, templateKey{fmt.Sprint(src), h.version, h.observationDomain, tid})
+			}
+			for _, t := range ts {
+				t.Source, t.Received, t.Version, t.ObservationDomain = src, received, h.version, h.observationDomain
+				d.templates[templateKey{fmt.Sprint(src), h.version, h.observationDomain, t.ID}] = t
+			}
+			templates = append(templates, ts...)
+		}
+	}
+	return templates, records, nil
+}
+
+// decodeTemplates decodes the template records of a template set, and returns
+// the templates and the IDs of the withdrawn templates.
+func decodeTemplates(b []byte, version uint16, options bool) ([]*Template, []uint16, error) {
+	var templates []*Template
+	var withdrawn []uint16
+	// Sets may be padded with less than a template record header.
+	for len(b) >= 4 && binary.BigEndian.Uint16(b) != 0 {
+		t := &Template{ID: binary.BigEndian.Uint16(b)}
+		var count int
+		switch {
+		case version == versionIPFIX || !options:
+			count = int(binary.BigEndian.Uint16(b[2:]))
+			b = b[4:]
+			if count == 0 {
+				withdrawn = append(withdrawn, t.ID)
+				continue
+			}
+			if options {
+				if len(b) < 2 {
+					return nil, nil, errTruncated
+				}
+				t.ScopeFieldCount = int(binary.BigEndian.Uint16(b))
+				b = b[2:]
+			}
+		default:
+			// The scope and option lengths of NetFlow version 9 are in
+			// bytes, of 4 bytes per field.
+			if len(b) < 6 {
+				return nil, nil, errTruncated
+			}
+			t.ScopeFieldCount = int(binary.BigEndian.Uint16(b[2:])) / 4
+			count = t.ScopeFieldCount + int(binary.BigEndian.Uint16(b[4:]))/4
+			b = b[6:]
+		}
+		for i := 0; i < count; i++ {
+			if len(b) < 4 {
+				return nil, nil, errTruncated
+			}
+			f := FieldSpec{Field: Field{ID: IE(binary.BigEndian.Uint16(b))}, Length: binary.BigEndian.Uint16(b[2:])}
+			b = b[4:]
+			if version == versionIPFIX && f.ID&0x8000 != 0 {
+				if len(b) < 4 {
+					return nil, nil, errTruncated
+				}
+				f.ID &^= 0x8000
+				f.Enterprise = binary.BigEndian.Uint32(b)
+				b = b[4:]
+			}
+			t.Fields = append(t.Fields, f)
+		}
+		templates = append(templates, t)
+	}
+	return templates, withdrawn, nil
+}
+
+// decodeData decodes the data records of a data set with template t.
+func decodeData(b []byte, t *Template, h *header) ([]*Record, error) {
+	minLen := 0
+	for _, f := range t.Fields {
+		if f.Length == variableLength {
+			minLen++
+		} else {
+			minLen += int(f.Length)
+		}
+	}
+	if minLen == 0 {
+		return nil, errors.New("template of empty records")
+	}
+	var records []*Record
+	// Sets may be padded with less than a record.
+	for len(b) >= minLen {
+		r := &Record{
+			Version:           h.version,
+			ObservationDomain: h.observationDomain,
+			Sequence:          h.sequence,
+			ExportTime:        h.exportTime,
+			SysUpTime:         h.sysUpTime,
+			TemplateID:        t.ID,
+			Fields:            map[Field][]byte{},
+		}
+		for _, f := range t.Fields {
+			n := int(f.Length)
+			if f.Length == variableLength {
+				if len(b) < 1 {
+					return nil, errTruncated
+				}
+				n, b = int(b[0]), b[1:]
+				if n == 255 {
+					if len(b) < 2 {
+						return nil, errTruncated
+					}
+					n, b = int(binary.BigEndian.Uint16(b)), b[2:]
+				}
+			}
+			if len(b) < n {
+				return nil, errTruncated
+			}
+			r.Fields[f.Field] = b[:n]
+			b = b[n:]
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// Collector collects the templates and the data records of the messages
+// received on a UDP socket.
+type Collector struct {
+	conn net.PacketConn
+	done chan struct{}
+
+	mu        sync.Mutex
+	decoder   *Decoder
+	templates []*Template
+	records   []*Record
+	errs      []error
+	received  chan struct{} // Closed and replaced when a message is received.
+	resets    int           // Number of calls to Reset.
+}
+
+// Listen starts a collector of the messages received on the UDP address addr,
+// such as ":4739". The port of addr may be 0 to pick any available port.
+func Listen(addr string) (*Collector, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for IPFIX messages on %s: %w", addr, err)
+	}
+	c := &Collector{
+		conn:     conn,
+		done:     make(chan struct{}),
+		decoder:  NewDecoder(),
+		received: make(chan struct{}),
+	}
+	go c.receive()
+	return c, nil
+}
+
+// receive receives messages until the collector is closed.
+func (c *Collector) receive() {
+	defer close(c.done)
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, src, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		// The decoded records refer to the bytes of the message, so they are
+		// not reused.
+		b := append([]byte(nil), buf[:n]...)
+		c.mu.Lock()
+		templates, records, err := c.decoder.Decode(b, src, time.Now())
+		if err != nil {
+			c.errs = append(c.errs, fmt.Errorf("from %v: %w", src, err))
+		} else {
+			c.templates = append(c.templates, templates...)
+			c.records = append(c.records, records...)
+			close(c.received)
+			c.received = make(chan struct{})
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Addr returns the address on which the collector listens.
+func (c *Collector) Addr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Port returns the UDP port on which the collector listens.
+func (c *Collector) Port() uint16 {
+	return uint16(c.conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+// Close stops the collector.
+func (c *Collector) Close() error {
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// Templates returns the templates collected so far, in order of reception,
+// which match, or all of them if match is nil.
+func (c *Collector) Templates(match func(*Template) bool) []*Template {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ts []*Template
+	for _, t := range c.templates {
+		if match == nil || match(t) {
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+// Records returns the data records collected so far, in order of reception,
+// which match, or all of them if match is nil.
+func (c *Collector) Records(match func(*Record) bool) []*Record {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var rs []*Record
+	for _, r := range c.records {
+		if match == nil || match(r) {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// Errors returns the errors decoding the messages received so far, which were
+// not collected.
+func (c *Collector) Errors() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]error(nil), c.errs...)
+}
+
+// Reset discards the templates, records and errors collected so far. The
+// templates are still used to decode the records of the next messages.
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.templates, c.records, c.errs = nil, nil, nil
+	c.resets++
+}
+
+// AwaitTemplate waits for a collected template which matches, and returns the
+// first. It returns the error of ctx if it is done before.
+func (c *Collector) AwaitTemplate(ctx context.Context, match func(*Template) bool) (*Template, error) {
+	var next, resets int
+	for {
+		c.mu.Lock()
+		ts, received := c.templates, c.received
+		if c.resets != resets {
+			next, resets = 0, c.resets
+		}
+		c.mu.Unlock()
+		for _, t := range ts[next:] {
+			if match(t) {
+				return t, nil
+			}
+		}
+		next = len(ts)
+		if err := c.wait(ctx, received); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Await waits for a collected data record which matches, and returns the
+// first. It returns the error of ctx if it is done before.
+func (c *Collector) Await(ctx context.Context, match func(*Record) bool) (*Record, error) {
+	var next, resets int
+	for {
+		c.mu.Lock()
+		rs, received := c.records, c.received
+		if c.resets != resets {
+			next, resets = 0, c.resets
+		}
+		c.mu.Unlock()
+		for _, r := range rs[next:] {
+			if match(r) {
+				return r, nil
+			}
+		}
+		next = len(rs)
+		if err := c.wait(ctx, received); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait waits for received to be closed.
+func (c *Collector) wait(ctx context.Context, received chan struct{}) error {
+	select {
+	case <-received:
+		return nil
+	case <-c.done:
+		return errors.New("IPFIX collector is closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
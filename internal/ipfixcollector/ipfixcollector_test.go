@@ -0,0 +1,271 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfixcollector
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+var (
+	received = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	exporter = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000}
+	src      = net.IPv4(192, 0, 2, 2).To4()
+	dst      = net.IPv4(192, 0, 2, 6).To4()
+)
+
+// encoder encodes the fields of a test message.
+type encoder []byte
+
+func (e encoder) u16(vs ...uint16) encoder {
+	for _, v := range vs {
+		e = binary.BigEndian.AppendUint16(e, v)
+	}
+	return e
+}
+
+func (e encoder) u32(vs ...uint32) encoder {
+	for _, v := range vs {
+		e = binary.BigEndian.AppendUint32(e, v)
+	}
+	return e
+}
+
+// set encodes the set id with body.
+func (e encoder) set(id uint16, body encoder) encoder {
+	return append(e.u16(id, uint16(4+len(body))), body...)
+}
+
+// ipfix returns an IPFIX message of observation domain 7 with sets.
+func ipfix(sets ...encoder) []byte {
+	var body encoder
+	for _, s := range sets {
+		body = append(body, s...)
+	}
+	e := encoder{}.u16(versionIPFIX, uint16(16+len(body))).u32(uint32(received.Unix()), 1, 7)
+	return append(e, body...)
+}
+
+// netflow9 returns a NetFlow version 9 message of source ID 7 with sets.
+func netflow9(sets ...encoder) []byte {
+	e := encoder{}.u16(versionNetFlow9, uint16(len(sets))).u32(60000, uint32(received.Unix()), 1, 7)
+	for _, s := range sets {
+		e = append(e, s...)
+	}
+	return e
+}
+
+// The template 256 of a flow: source and destination addresses, protocol,
+// ports, a reduced size packet count of 4 bytes, an octet count, and an
+// enterprise specific field of variable length.
+var (
+	template256 = encoder{}.u16(256, 8,
+		uint16(SourceIPv4Address), 4,
+		uint16(DestinationIPv4Address), 4,
+		uint16(ProtocolIdentifier), 1,
+		uint16(SourceTransportPort), 2,
+		uint16(DestinationTransportPort), 2,
+		uint16(PacketDeltaCount), 4,
+		uint16(OctetDeltaCount), 8,
+		0x8000|1, variableLength).u32(30065)
+	// record256 is a record of template256 followed by padding.
+	record256 = func() encoder {
+		e := append(append(append(encoder{}, src...), dst...), 17)
+		e = e.u16(49152, 4789).u32(1000, 0, 494000)
+		return append(e, 3, 'f', 'o', 'o', 0, 0)
+	}()
+)
+
+var wantTemplate256 = &Template{
+	Source:            exporter,
+	Received:          received,
+	Version:           versionIPFIX,
+	ObservationDomain: 7,
+	ID:                256,
+	Fields: []FieldSpec{
+		{Field{ID: SourceIPv4Address}, 4},
+		{Field{ID: DestinationIPv4Address}, 4},
+		{Field{ID: ProtocolIdentifier}, 1},
+		{Field{ID: SourceTransportPort}, 2},
+		{Field{ID: DestinationTransportPort}, 2},
+		{Field{ID: PacketDeltaCount}, 4},
+		{Field{ID: OctetDeltaCount}, 8},
+		{Field{Enterprise: 30065, ID: 1}, variableLength},
+	},
+}
+
+func TestDecodeIPFIX(t *testing.T) {
+	d := NewDecoder()
+	// Records of unknown templates are skipped.
+	if _, recs, err := d.Decode(ipfix(encoder{}.set(256, record256)), exporter, received); err != nil || len(recs) != 0 {
+		t.Errorf("Decode() of unknown template got %v, %v, want no records", recs, err)
+	}
+
+	ts, recs, err := d.Decode(ipfix(encoder{}.set(setIPFIXTemplate, template256), encoder{}.set(256, record256)), exporter, received)
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if diff := cmp.Diff([]*Template{wantTemplate256}, ts); diff != "" {
+		t.Errorf("Decode() returned unexpected templates diff (-want +got):\n%s", diff)
+	}
+	if !ts[0].Has(SourceIPv4Address, OctetDeltaCount) || ts[0].Has(SourceIPv6Address) {
+		t.Errorf("Has() does not match the fields of %v", ts[0])
+	}
+	if len(recs) != 1 {
+		t.Fatalf("Decode() got %d records, want 1", len(recs))
+	}
+	r := recs[0]
+	if !r.IP(SourceIPv4Address).Equal(src) || !r.IP(DestinationIPv4Address).Equal(dst) || r.IP(SourceIPv6Address) != nil {
+		t.Errorf("IP() of %v does not match the addresses of the record", r)
+	}
+	for ie, want := range map[IE]uint64{ProtocolIdentifier: 17, SourceTransportPort: 49152, DestinationTransportPort: 4789, PacketDeltaCount: 1000, OctetDeltaCount: 494000} {
+		if got, ok := r.Uint(ie); !ok || got != want {
+			t.Errorf("Uint(%d) got %d, %t, want %d", ie, got, ok, want)
+		}
+	}
+	if got := string(r.Fields[Field{Enterprise: 30065, ID: 1}]); got != "foo" {
+		t.Errorf("Enterprise field got %q, want %q", got, "foo")
+	}
+	if r.ObservationDomain != 7 || r.TemplateID != 256 || !r.ExportTime.Equal(received) || r.Source != exporter {
+		t.Errorf("Decode() got record %+v, want template 256 of observation domain 7 exported at %v by %v", r, received, exporter)
+	}
+
+	// Records of withdrawn templates are skipped.
+	if _, recs, err := d.Decode(ipfix(encoder{}.set(setIPFIXTemplate, encoder{}.u16(256, 0)), encoder{}.set(256, record256)), exporter, received); err != nil || len(recs) != 0 {
+		t.Errorf("Decode() of withdrawn template got %v, %v, want no records", recs, err)
+	}
+}
+
+func TestDecodeNetFlow9(t *testing.T) {
+	d := NewDecoder()
+	template := encoder{}.u16(300, 3, uint16(SourceIPv4Address), 4, uint16(DestinationIPv4Address), 4, uint16(PacketDeltaCount), 4)
+	options := encoder{}.u16(301, 4, 4, 1, 4, uint16(FlowEndReason), 1)
+	record := append(append(append(encoder{}, src...), dst...), encoder{}.u32(42)...)
+	ts, recs, err := d.Decode(netflow9(
+		encoder{}.set(setNetFlow9Template, template),
+		encoder{}.set(setNetFlow9OptionsTemplate, append(options, 0, 0)),
+		encoder{}.set(300, append(record, record...)),
+		encoder{}.set(301, encoder{}.u32(3).u16(0x0200))), exporter, received)
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	want := []*Template{{
+		ID:     300,
+		Fields: []FieldSpec{{Field{ID: SourceIPv4Address}, 4}, {Field{ID: DestinationIPv4Address}, 4}, {Field{ID: PacketDeltaCount}, 4}},
+	}, {
+		ID:              301,
+		ScopeFieldCount: 1,
+		Fields:          []FieldSpec{{Field{ID: 1}, 4}, {Field{ID: FlowEndReason}, 1}},
+	}}
+	if diff := cmp.Diff(want, ts, cmpopts.IgnoreFields(Template{}, "Source", "Received", "Version", "ObservationDomain")); diff != "" {
+		t.Errorf("Decode() returned unexpected templates diff (-want +got):\n%s", diff)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("Decode() got %d records, want 2 of template 300 and 1 of template 301", len(recs))
+	}
+	if got, _ := recs[1].Uint(PacketDeltaCount); got != 42 || recs[1].SysUpTime != time.Minute || recs[1].ObservationDomain != 7 {
+		t.Errorf("Decode() got record %+v, want 42 packets at uptime 1m of source ID 7", recs[1])
+	}
+	if got, _ := recs[2].Uint(FlowEndReason); got != ActiveTimeout {
+		t.Errorf("Decode() got options record %v, want flow end reason %d", recs[2], ActiveTimeout)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		desc string
+		msg  []byte
+	}{{
+		desc: "empty",
+	}, {
+		desc: "version 5",
+		msg:  append(encoder{}.u16(5, 0), make([]byte, 20)...),
+	}, {
+		desc: "message length",
+		msg:  encoder{}.u16(versionIPFIX, 100).u32(0, 0, 0),
+	}, {
+		desc: "set length",
+		msg:  ipfix(encoder{}.u16(setIPFIXTemplate, 100)),
+	}, {
+		desc: "truncated template",
+		msg:  ipfix(encoder{}.set(setIPFIXTemplate, template256[:len(template256)-2])),
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if _, _, err := NewDecoder().Decode(tt.msg, exporter, received); err == nil {
+				t.Errorf("Decode() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	defer c.Close()
+
+	conn, err := net.Dial("udp", c.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer conn.Close()
+	send := func(b []byte) {
+		t.Helper()
+		if _, err := conn.Write(b); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	send([]byte("not IPFIX"))
+	// The template awaited is received after AwaitTemplate starts waiting.
+	go conn.Write(ipfix(encoder{}.set(setIPFIXTemplate, template256)))
+	if _, err := c.AwaitTemplate(ctx, func(t *Template) bool { return t.ID == 256 }); err != nil {
+		t.Fatalf("AwaitTemplate() failed: %v", err)
+	}
+	send(ipfix(encoder{}.set(256, record256)))
+	r, err := c.Await(ctx, func(r *Record) bool { return r.IP(DestinationIPv4Address).Equal(dst) })
+	if err != nil {
+		t.Fatalf("Await() failed: %v", err)
+	}
+	if got, _ := r.Uint(PacketDeltaCount); got != 1000 {
+		t.Errorf("Await() got %v, want 1000 packets", r)
+	}
+	if got := len(c.Errors()); got != 1 {
+		t.Errorf("Errors() got %d errors, want 1", got)
+	}
+
+	// Templates are kept after Reset.
+	c.Reset()
+	if got := c.Templates(nil); len(got) != 0 {
+		t.Errorf("Templates() after Reset() got %v, want none", got)
+	}
+	send(ipfix(encoder{}.set(256, record256)))
+	if _, err := c.Await(ctx, func(*Record) bool { return true }); err != nil {
+		t.Errorf("Await() after Reset() failed: %v", err)
+	}
+	if got := len(c.Records(nil)); got != 1 {
+		t.Errorf("Records() after Reset() got %d records, want 1", got)
+	}
+}
@@ -0,0 +1,550 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mcast provides helpers for multicast tests, which join multicast
+// groups on ATE receiver ports and verify the replication of the multicast
+// streams of the DUT to the receivers.
+//
+// The OTG does not emulate IGMP and MLD hosts, so the receivers send their
+// reports and leaves as raw flows, added to the ATE config with
+// AddMembershipFlows and sent with Join and Leave. Typical usage looks like:
+//
+//	r := &mcast.Receiver{Port: ate.Port(t, "port2"), Host: ate2}
+//	mcast.AddMembershipFlows(top, mcast.IGMPv2, r, g)
+//	s := &mcast.Stream{Name: "source", Port: ate.Port(t, "port1"), Source: ate1, Group: g.Address, ...}
+//	s.AddFlow(top, receivers)
+//	ate.OTG().PushConfig(t, top)
+//	...
+//	mcast.Join(t, ate, r, g)
+//	mcast.Verify(t, ate, []*mcast.Stream{s}, receivers, mcast.Joined{s.Name: {r.Host.Name}})
+//
+// Verify sends each stream in turn and checks that it is received once by
+// each joined receiver and by no other receiver, logging the replication
+// matrix and writing it as a CSV test output.
+package mcast
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/featureprofiles/internal/attrs"
+	"github.com/openconfig/featureprofiles/internal/fptest"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+)
+
+// Version is the IGMP or MLD version of the membership messages of a
+// receiver.
+type Version int
+
+const (
+	// IGMPv2 is IGMP version 2, RFC 2236.
+	IGMPv2 Version = iota + 1
+	// IGMPv3 is IGMP version 3, RFC 3376.
+	IGMPv3
+	// MLDv1 is MLD version 1, RFC 2710.
+	MLDv1
+	// MLDv2 is MLD version 2, RFC 3810.
+	MLDv2
+)
+
+func (v Version) String() string {
+	switch v {
+	case IGMPv2:
+		return "IGMPv2"
+	case IGMPv3:
+		return "IGMPv3"
+	case MLDv1:
+		return "MLDv1"
+	case MLDv2:
+		return "MLDv2"
+	}
+	return fmt.Sprintf("Version(%d)", int(v))
+}
+
+// ipv6 returns whether v is an MLD version.
+func (v Version) ipv6() bool {
+	return v == MLDv1 || v == MLDv2
+}
+
+const (
+	// Robustness is the number of copies of each report and leave sent by
+	// a receiver.
+	Robustness = 2
+
+	// NoisePct is the percentage of the frames of a stream tolerated in
+	// excess on the port of a receiver, as the port counters also count the
+	// control packets of the DUT, such as its queries.
+	NoisePct = 1
+
+	// settleTime is the time waited after a stream is sent for the
+	// counters of the ATE to be updated.
+	settleTime = 5 * time.Second
+)
+
+// The IGMPv3 and MLDv2 multicast address record types.
+const (
+	changeToInclude = 3
+	changeToExclude = 4
+	allowNewSources = 5
+	blockOldSources = 6
+)
+
+// Group is a multicast group joined by a receiver.
+type Group struct {
+	// Address is the IPv4 or IPv6 address of the group.
+	Address string
+	// Source is the source of the group joined with IGMPv3 or MLDv2, or
+	// empty to join the group from any source. It is ignored by IGMPv2 and
+	// MLDv1.
+	Source string
+}
+
+// Receiver is a host on an ATE port joining multicast groups.
+type Receiver struct {
+	// Port is the ATE port of the receiver.
+	Port *ondatra.Port
+	// Host is the host of the receiver, configured on Port, of which the
+	// name, the MAC address and the IPv4 address are used. The source of its
+	// MLD messages is the link local address derived from its MAC address.
+	Host attrs.Attributes
+}
+
+// JoinFlow returns the name of the flow of the reports of r joining g.
+func JoinFlow(r *Receiver, g Group) string {
+	return fmt.Sprintf("%s-join-%s", r.Host.Name, g.Address)
+}
+
+// LeaveFlow returns the name of the flow of the leaves of r leaving g.
+func LeaveFlow(r *Receiver, g Group) string {
+	return fmt.Sprintf("%s-leave-%s", r.Host.Name, g.Address)
+}
+
+// AddMembershipFlows adds to top the flows of the reports and leaves of r
+// for each of groups with version v, named JoinFlow and LeaveFlow. Each flow
+// sends Robustness copies of its message, one second apart.
+func AddMembershipFlows(top gosnappi.Config, v Version, r *Receiver, groups ...Group) {
+	for _, g := range groups {
+		join, leave := messages(v, r.Host.MAC, g)
+		addMessageFlow(top, JoinFlow(r, g), v, r, join)
+		addMessageFlow(top, LeaveFlow(r, g), v, r, leave)
+	}
+}
+
+// Join sends the reports of r joining groups.
+func Join(t testing.TB, ate *ondatra.ATEDevice, r *Receiver, groups ...Group) {
+	t.Helper()
+	var flows []string
+	for _, g := range groups {
+		flows = append(flows, JoinFlow(r, g))
+	}
+	startFlows(t, ate, flows...)
+}
+
+// Leave sends the leaves of r leaving groups.
+func Leave(t testing.TB, ate *ondatra.ATEDevice, r *Receiver, groups ...Group) {
+	t.Helper()
+	var flows []string
+	for _, g := range groups {
+		flows = append(flows, LeaveFlow(r, g))
+	}
+	startFlows(t, ate, flows...)
+}
+
+// startFlows starts the flows of the ATE, leaving its other flows as they
+// are.
+func startFlows(t testing.TB, ate *ondatra.ATEDevice, flows ...string) {
+	t.Helper()
+	cs := gosnappi.NewControlState()
+	cs.Traffic().FlowTransmit().SetState(gosnappi.StateTrafficFlowTransmitState.START).SetFlowNames(flows)
+	ate.OTG().SetControlState(t, cs)
+}
+
+// message is an IGMP or MLD message with its IP destination.
+type message struct {
+	dst string
+	b   []byte
+}
+
+// messages returns the report and the leave of group g with version v, sent
+// from the host with MAC address mac.
+func messages(v Version, mac string, g Group) (join, leave message) {
+	switch v {
+	case IGMPv2:
+		return message{g.Address, igmpv2Message(0x16, g.Address)},
+			message{"224.0.0.2", igmpv2Message(0x17, g.Address)}
+	case IGMPv3:
+		joinType, leaveType := recordTypes(g)
+		return message{"224.0.0.22", igmpv3Report(joinType, g)},
+			message{"224.0.0.22", igmpv3Report(leaveType, g)}
+	case MLDv1:
+		src := LinkLocal(mac)
+		return message{g.Address, mldv1Message(131, g.Address, src, g.Address)},
+			message{"ff02::2", mldv1Message(132, g.Address, src, "ff02::2")}
+	}
+	src := LinkLocal(mac)
+	joinType, leaveType := recordTypes(g)
+	return message{"ff02::16", mldv2Report(joinType, g, src)},
+		message{"ff02::16", mldv2Report(leaveType, g, src)}
+}
+
+// recordTypes returns the IGMPv3 and MLDv2 record types joining and leaving
+// g: allowing and blocking its source, or changing to the exclude mode and
+// back to the include mode without sources if it has none.
+func recordTypes(g Group) (join, leave byte) {
+	if g.Source == "" {
+		return changeToExclude, changeToInclude
+	}
+	return allowNewSources, blockOldSources
+}
+
+// sources returns the addresses of the source of g, in the form of IPv4
+// addresses if ipv4.
+func sources(g Group, ipv4 bool) []byte {
+	if g.Source == "" {
+		return nil
+	}
+	if ipv4 {
+		return net.ParseIP(g.Source).To4()
+	}
+	return net.ParseIP(g.Source).To16()
+}
+
+// igmpv2Message returns the IGMPv2 message typ for group.
+func igmpv2Message(typ byte, group string) []byte {
+	b := append([]byte{typ, 0, 0, 0}, net.ParseIP(group).To4()...)
+	binary.BigEndian.PutUint16(b[2:], otgutils.Checksum(b))
+	return b
+}
+
+// igmpv3Report returns the IGMPv3 report with a record of type recType for g.
+func igmpv3Report(recType byte, g Group) []byte {
+	src := sources(g, true)
+	b := []byte{0x22, 0, 0, 0, 0, 0, 0, 1, recType, 0, 0, byte(len(src) / 4)}
+	b = append(b, net.ParseIP(g.Address).To4()...)
+	b = append(b, src...)
+	binary.BigEndian.PutUint16(b[2:], otgutils.Checksum(b))
+	return b
+}
+
+// mldv1Message returns the MLDv1 message typ for group sent from src to dst.
+func mldv1Message(typ byte, group, src, dst string) []byte {
+	b := append([]byte{typ, 0, 0, 0, 0, 0, 0, 0}, net.ParseIP(group).To16()...)
+	return withICMPv6Checksum(b, src, dst)
+}
+
+// mldv2Report returns the MLDv2 report with a record of type recType for g
+// sent from src.
+func mldv2Report(recType byte, g Group, src string) []byte {
+	srcs := sources(g, false)
+	b := []byte{143, 0, 0, 0, 0, 0, 0, 1, recType, 0, 0, byte(len(srcs) / 16)}
+	b = append(b, net.ParseIP(g.Address).To16()...)
+	b = append(b, srcs...)
+	return withICMPv6Checksum(b, src, "ff02::16")
+}
+
+// withICMPv6Checksum returns the ICMPv6 message b sent from src to dst with
+// its checksum, which covers the pseudo header of RFC 8200.
+func withICMPv6Checksum(b []byte, src, dst string) []byte {
+	pseudo := append(net.ParseIP(src).To16(), net.ParseIP(dst).To16()...)
+	pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(b)))
+	pseudo = append(pseudo, 0, 0, 0, 58)
+	binary.BigEndian.PutUint16(b[2:], otgutils.Checksum(append(pseudo, b...)))
+	return b
+}
+
+// LinkLocal returns the link local address derived from the MAC address mac
+// with the modified EUI-64 format.
+func LinkLocal(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 {
+		return ""
+	}
+	ip := net.IP{0xfe, 0x80, 0, 0, 0, 0, 0, 0, hw[0] ^ 0x02, hw[1], hw[2], 0xff, 0xfe, hw[3], hw[4], hw[5]}
+	return ip.String()
+}
+
+// MAC returns the MAC address of the multicast address group.
+func MAC(group string) string {
+	ip := net.ParseIP(group)
+	if ip4 := ip.To4(); ip4 != nil {
+		return net.HardwareAddr{0x01, 0x00, 0x5e, ip4[1] & 0x7f, ip4[2], ip4[3]}.String()
+	}
+	return net.HardwareAddr{0x33, 0x33, ip[12], ip[13], ip[14], ip[15]}.String()
+}
+
+// addMessageFlow adds to top the flow name of r sending Robustness copies of
+// the message m with version v.
+func addMessageFlow(top gosnappi.Config, name string, v Version, r *Receiver, m message) {
+	f := top.Flows().Add().SetName(name)
+	f.TxRx().Port().SetTxName(r.Port.ID())
+	f.Duration().FixedPackets().SetPackets(Robustness)
+	f.Rate().SetPps(1)
+	eth := f.Packet().Add().Ethernet()
+	eth.Src().SetValue(r.Host.MAC)
+	eth.Dst().SetValue(MAC(m.dst))
+	// size is the size of the frame with its FCS.
+	size := 14 + len(m.b) + 4
+	if v.ipv6() {
+		ip := f.Packet().Add().Ipv6()
+		ip.Src().SetValue(LinkLocal(r.Host.MAC))
+		ip.Dst().SetValue(m.dst)
+		ip.HopLimit().SetValue(1)
+		ip.NextHeader().SetValue(0)
+		// The MLD messages follow a hop-by-hop options header with the
+		// router alert option, padded to 8 octets.
+		hbh := append([]byte{58, 0, 5, 2, 0, 0, 1, 0}, m.b...)
+		f.Packet().Add().Custom().SetBytes(hex.EncodeToString(hbh))
+		size += 40 + 8
+	} else {
+		ip := f.Packet().Add().Ipv4()
+		ip.Src().SetValue(r.Host.IPv4)
+		ip.Dst().SetValue(m.dst)
+		ip.TimeToLive().SetValue(1)
+		ip.Protocol().SetValue(2)
+		ip.Options().Add().RouterAlert()
+		f.Packet().Add().Custom().SetBytes(hex.EncodeToString(m.b))
+		size += 24
+	}
+	f.Size().SetFixed(uint32(max(size, 64)))
+}
+
+// Stream is the multicast traffic of a source to a group.
+type Stream struct {
+	// Name is the name of the flow of the stream.
+	Name string
+	// Port is the ATE port of the source, and Source its host, of which the
+	// MAC address and the IPv4 or IPv6 address of the family of Group are
+	// used.
+	Port   *ondatra.Port
+	Source attrs.Attributes
+	// Group is the IPv4 or IPv6 address of the group.
+	Group string
+	// Packets is the number of packets of the stream, sent at PPS packets
+	// per second, of FrameSize bytes.
+	Packets   uint32
+	PPS       uint64
+	FrameSize uint32
+}
+
+// ipv6 returns whether s is an IPv6 stream.
+func (s *Stream) ipv6() bool {
+	return net.ParseIP(s.Group).To4() == nil
+}
+
+// duration returns the time it takes to send s.
+func (s *Stream) duration() time.Duration {
+	return time.Duration(s.Packets) * time.Second / time.Duration(s.PPS)
+}
+
+// AddFlow adds to top the flow of s, received by receivers.
+func (s *Stream) AddFlow(top gosnappi.Config, receivers []*Receiver) gosnappi.Flow {
+	var rx []string
+	for _, r := range receivers {
+		rx = append(rx, r.Port.ID())
+	}
+	f := top.Flows().Add().SetName(s.Name)
+	f.Metrics().SetEnable(true)
+	f.TxRx().Port().SetTxName(s.Port.ID()).SetRxNames(rx)
+	f.Duration().FixedPackets().SetPackets(s.Packets)
+	f.Rate().SetPps(s.PPS)
+	f.Size().SetFixed(s.FrameSize)
+	eth := f.Packet().Add().Ethernet()
+	eth.Src().SetValue(s.Source.MAC)
+	eth.Dst().SetValue(MAC(s.Group))
+	if s.ipv6() {
+		ip := f.Packet().Add().Ipv6()
+		ip.Src().SetValue(s.Source.IPv6)
+		ip.Dst().SetValue(s.Group)
+	} else {
+		ip := f.Packet().Add().Ipv4()
+		ip.Src().SetValue(s.Source.IPv4)
+		ip.Dst().SetValue(s.Group)
+	}
+	return f
+}
+
+// Joined are the names of the receivers joined to each stream, keyed by the
+// name of the stream.
+type Joined map[string][]string
+
+// joined returns whether receiver is joined to stream.
+func (j Joined) joined(stream, receiver string) bool {
+	for _, r := range j[stream] {
+		if r == receiver {
+			return true
+		}
+	}
+	return false
+}
+
+// Row is the replication of a stream to the receivers.
+type Row struct {
+	// Stream is the name of the stream, and Duration the time it took to
+	// send it.
+	Stream   string
+	Duration time.Duration
+	// Sent is the number of frames of the stream sent, and FlowReceived
+	// the number of its frames received on all the receivers, as counted
+	// by the flow metrics of the ATE.
+	Sent         uint64
+	FlowReceived uint64
+	// Received is the number of frames received by each receiver while the
+	// stream was sent, and Joined whether the receiver is joined to the
+	// stream, keyed by the name of the receiver.
+	Received map[string]uint64
+	Joined   map[string]bool
+}
+
+// Rate returns the rate in packets per second at which receiver received the
+// stream of r.
+func (r *Row) Rate(receiver string) float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Received[receiver]) / r.Duration.Seconds()
+}
+
+// Matrix is the replication of streams to receivers.
+type Matrix struct {
+	// Receivers are the names of the receivers, the columns of the matrix.
+	Receivers []string
+	// Rows are the replications of each stream.
+	Rows []*Row
+}
+
+// Errors returns the replication errors of m: the streams received more or
+// less than once by their joined receivers, and the streams received by
+// receivers not joined to them.
+func (m *Matrix) Errors() []error {
+	var errs []error
+	for _, row := range m.Rows {
+		noise := row.Sent * NoisePct / 100
+		var joined uint64
+		for _, name := range m.Receivers {
+			got := row.Received[name]
+			switch {
+			case !row.Joined[name] && got > noise:
+				errs = append(errs, fmt.Errorf("stream %s: receiver %s not joined got %d frames, want none", row.Stream, name, got))
+			case !row.Joined[name]:
+			case got < row.Sent:
+				errs = append(errs, fmt.Errorf("stream %s: receiver %s got %d frames, want %d: %d frames lost", row.Stream, name, got, row.Sent, row.Sent-got))
+			case got > row.Sent+noise:
+				errs = append(errs, fmt.Errorf("stream %s: receiver %s got %d frames, want %d: frames duplicated", row.Stream, name, got, row.Sent))
+			}
+			if row.Joined[name] {
+				joined++
+			}
+		}
+		if want := row.Sent * joined; row.FlowReceived != want {
+			errs = append(errs, fmt.Errorf("stream %s: got %d frames received by %d joined receivers, want %d", row.Stream, row.FlowReceived, joined, want))
+		}
+	}
+	return errs
+}
+
+// String returns m as a table with a row per stream and a column per
+// receiver, with the frames received by each receiver and whether it is
+// joined.
+func (m *Matrix) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%-25s%-12s", "Stream", "Frames Tx")
+	for _, name := range m.Receivers {
+		fmt.Fprintf(&out, "%-20s", name)
+	}
+	out.WriteString("\n")
+	for _, row := range m.Rows {
+		fmt.Fprintf(&out, "%-25s%-12d", row.Stream, row.Sent)
+		for _, name := range m.Receivers {
+			mark := " "
+			if row.Joined[name] {
+				mark = "*"
+			}
+			fmt.Fprintf(&out, "%-20s", fmt.Sprintf("%d%s", row.Received[name], mark))
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("* joined receiver\n")
+	return out.String()
+}
+
+// CSV returns m in CSV form, with a line per stream and receiver.
+func (m *Matrix) CSV() string {
+	var out strings.Builder
+	out.WriteString("stream,receiver,joined,sent,received,rate_pps\n")
+	for _, row := range m.Rows {
+		for _, name := range m.Receivers {
+			fmt.Fprintf(&out, "%s,%s,%t,%d,%d,%.1f\n", row.Stream, name, row.Joined[name], row.Sent, row.Received[name], row.Rate(name))
+		}
+	}
+	return out.String()
+}
+
+// Verify sends each of streams in turn, with their flows added to the ATE
+// config by Stream.AddFlow, and verifies that it is received exactly once by
+// each of the receivers joined to it and by no other receiver. It logs the
+// replication matrix, writes it to the test outputs and returns it.
+func Verify(t testing.TB, ate *ondatra.ATEDevice, streams []*Stream, receivers []*Receiver, joined Joined) *Matrix {
+	t.Helper()
+	m := &Matrix{}
+	for _, r := range receivers {
+		m.Receivers = append(m.Receivers, r.Host.Name)
+	}
+	inFrames := func() map[string]uint64 {
+		frames := map[string]uint64{}
+		for _, r := range receivers {
+			frames[r.Host.Name] = gnmi.Get(t, ate.OTG(), gnmi.OTG().Port(r.Port.ID()).Counters().InFrames().State())
+		}
+		return frames
+	}
+	for _, s := range streams {
+		counters := gnmi.OTG().Flow(s.Name).Counters()
+		sentBefore := gnmi.Get(t, ate.OTG(), counters.OutPkts().State())
+		flowBefore := gnmi.Get(t, ate.OTG(), counters.InPkts().State())
+		before := inFrames()
+		startFlows(t, ate, s.Name)
+		time.Sleep(s.duration() + settleTime)
+		after := inFrames()
+
+		row := &Row{
+			Stream:       s.Name,
+			Duration:     s.duration(),
+			Sent:         gnmi.Get(t, ate.OTG(), counters.OutPkts().State()) - sentBefore,
+			FlowReceived: gnmi.Get(t, ate.OTG(), counters.InPkts().State()) - flowBefore,
+			Received:     map[string]uint64{},
+			Joined:       map[string]bool{},
+		}
+		for _, name := range m.Receivers {
+			row.Received[name] = after[name] - before[name]
+			row.Joined[name] = joined.joined(s.Name, name)
+		}
+		m.Rows = append(m.Rows, row)
+	}
+
+	t.Logf("Multicast replication matrix:\n%s", m)
+	if _, err := fptest.WriteOutput(t.Name()+"_replication_matrix", ".csv", m.CSV()); err != nil {
+		t.Errorf("Cannot write the replication matrix: %v", err)
+	}
+	for _, err := range m.Errors() {
+		t.Error(err)
+	}
+	return m
+}
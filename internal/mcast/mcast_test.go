@@ -0,0 +1,217 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcast
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openconfig/featureprofiles/internal/otgutils"
+)
+
+const mac = "02:00:01:01:01:01"
+
+func TestMessages(t *testing.T) {
+	tests := []struct {
+		desc      string
+		v         Version
+		g         Group
+		wantJoin  []byte
+		wantLeave []byte
+		joinDst   string
+		leaveDst  string
+	}{{
+		desc:      "IGMPv2",
+		v:         IGMPv2,
+		g:         Group{Address: "239.1.1.1"},
+		wantJoin:  []byte{0x16, 0, 0xf9, 0xfc, 239, 1, 1, 1},
+		wantLeave: []byte{0x17, 0, 0xf8, 0xfc, 239, 1, 1, 1},
+		joinDst:   "239.1.1.1",
+		leaveDst:  "224.0.0.2",
+	}, {
+		desc:      "IGMPv3 with source",
+		v:         IGMPv3,
+		g:         Group{Address: "232.1.1.1", Source: "198.51.100.1"},
+		wantJoin:  []byte{0x22, 0, 0, 0, 0, 0, 0, 1, allowNewSources, 0, 0, 1, 232, 1, 1, 1, 198, 51, 100, 1},
+		wantLeave: []byte{0x22, 0, 0, 0, 0, 0, 0, 1, blockOldSources, 0, 0, 1, 232, 1, 1, 1, 198, 51, 100, 1},
+		joinDst:   "224.0.0.22",
+		leaveDst:  "224.0.0.22",
+	}, {
+		desc:      "IGMPv3 without source",
+		v:         IGMPv3,
+		g:         Group{Address: "239.1.1.1"},
+		wantJoin:  []byte{0x22, 0, 0, 0, 0, 0, 0, 1, changeToExclude, 0, 0, 0, 239, 1, 1, 1},
+		wantLeave: []byte{0x22, 0, 0, 0, 0, 0, 0, 1, changeToInclude, 0, 0, 0, 239, 1, 1, 1},
+		joinDst:   "224.0.0.22",
+		leaveDst:  "224.0.0.22",
+	}, {
+		desc:     "MLDv1",
+		v:        MLDv1,
+		g:        Group{Address: "ff05::db8:1"},
+		joinDst:  "ff05::db8:1",
+		leaveDst: "ff02::2",
+	}, {
+		desc:     "MLDv2 with source",
+		v:        MLDv2,
+		g:        Group{Address: "ff35::db8:1", Source: "2001:db8:100::1"},
+		joinDst:  "ff02::16",
+		leaveDst: "ff02::16",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			join, leave := messages(tt.v, mac, tt.g)
+			if join.dst != tt.joinDst || leave.dst != tt.leaveDst {
+				t.Errorf("messages() destinations: got %s and %s, want %s and %s", join.dst, leave.dst, tt.joinDst, tt.leaveDst)
+			}
+			for _, m := range []struct {
+				got  message
+				want []byte
+			}{{join, tt.wantJoin}, {leave, tt.wantLeave}} {
+				if m.want != nil {
+					// The checksum is verified below.
+					got := append([]byte(nil), m.got.b...)
+					copy(got[2:4], m.want[2:4])
+					if diff := cmp.Diff(m.want, got); diff != "" {
+						t.Errorf("messages() to %s (-want +got):\n%s", m.got.dst, diff)
+					}
+				}
+				sum := m.got.b
+				if tt.v.ipv6() {
+					pseudo := append(net.ParseIP(LinkLocal(mac)).To16(), net.ParseIP(m.got.dst).To16()...)
+					pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(m.got.b)))
+					sum = append(append(pseudo, 0, 0, 0, 58), m.got.b...)
+				}
+				if got := otgutils.Checksum(sum); got != 0 {
+					t.Errorf("messages() to %s: got checksum residue %#x, want 0", m.got.dst, got)
+				}
+			}
+		})
+	}
+}
+
+func TestIGMPv2Checksum(t *testing.T) {
+	b := igmpv2Message(0x16, "239.1.1.1")
+	if got, want := binary.BigEndian.Uint16(b[2:]), uint16(0xf9fc); got != want {
+		t.Errorf("igmpv2Message() checksum: got %#x, want %#x", got, want)
+	}
+}
+
+func TestLinkLocal(t *testing.T) {
+	if got, want := LinkLocal(mac), "fe80::1ff:fe01:101"; got != want {
+		t.Errorf("LinkLocal(%s): got %s, want %s", mac, got, want)
+	}
+	if got := LinkLocal("invalid"); got != "" {
+		t.Errorf("LinkLocal(invalid): got %s, want empty", got)
+	}
+}
+
+func TestMAC(t *testing.T) {
+	for group, want := range map[string]string{
+		"239.129.1.2": "01:00:5e:01:01:02",
+		"224.0.0.22":  "01:00:5e:00:00:16",
+		"ff02::16":    "33:33:00:00:00:16",
+		"ff35::db8:1": "33:33:0d:b8:00:01",
+	} {
+		if got := MAC(group); got != want {
+			t.Errorf("MAC(%s): got %s, want %s", group, got, want)
+		}
+	}
+}
+
+func TestMatrixErrors(t *testing.T) {
+	receivers := []string{"ate2", "ate3"}
+	tests := []struct {
+		desc string
+		row  *Row
+		want []string
+	}{{
+		desc: "replicated",
+		row: &Row{
+			Stream:       "s1",
+			Sent:         1000,
+			FlowReceived: 1000,
+			Received:     map[string]uint64{"ate2": 1002, "ate3": 3},
+			Joined:       map[string]bool{"ate2": true},
+		},
+	}, {
+		desc: "lost",
+		row: &Row{
+			Stream:       "s1",
+			Sent:         1000,
+			FlowReceived: 1990,
+			Received:     map[string]uint64{"ate2": 1000, "ate3": 990},
+			Joined:       map[string]bool{"ate2": true, "ate3": true},
+		},
+		want: []string{"receiver ate3 got 990 frames, want 1000", "got 1990 frames received by 2 joined receivers, want 2000"},
+	}, {
+		desc: "duplicated",
+		row: &Row{
+			Stream:       "s1",
+			Sent:         1000,
+			FlowReceived: 2000,
+			Received:     map[string]uint64{"ate2": 2000},
+			Joined:       map[string]bool{"ate2": true},
+		},
+		want: []string{"receiver ate2 got 2000 frames, want 1000: frames duplicated", "want 1000"},
+	}, {
+		desc: "leaked",
+		row: &Row{
+			Stream:       "s1",
+			Sent:         1000,
+			FlowReceived: 2000,
+			Received:     map[string]uint64{"ate2": 1000, "ate3": 1000},
+			Joined:       map[string]bool{"ate2": true},
+		},
+		want: []string{"receiver ate3 not joined got 1000 frames", "want 1000"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			m := &Matrix{Receivers: receivers, Rows: []*Row{tt.row}}
+			errs := m.Errors()
+			if len(errs) != len(tt.want) {
+				t.Fatalf("Errors(): got %v, want %d errors", errs, len(tt.want))
+			}
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), tt.want[i]) {
+					t.Errorf("Errors()[%d]: got %v, want it to contain %q", i, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMatrixCSV(t *testing.T) {
+	m := &Matrix{
+		Receivers: []string{"ate2", "ate3"},
+		Rows: []*Row{{
+			Stream:       "s1",
+			Duration:     10 * time.Second,
+			Sent:         1000,
+			FlowReceived: 1000,
+			Received:     map[string]uint64{"ate2": 1000, "ate3": 0},
+			Joined:       map[string]bool{"ate2": true},
+		}},
+	}
+	want := "stream,receiver,joined,sent,received,rate_pps\n" +
+		"s1,ate2,true,1000,1000,100.0\n" +
+		"s1,ate3,false,1000,0,0.0\n"
+	if diff := cmp.Diff(want, m.CSV()); diff != "" {
+		t.Errorf("CSV() (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package modelcheck cross-checks the OpenConfig models supported by a DUT, as
+// reported by gNMI Capabilities, against the versions of the models that the
+// generated telemetry bindings were built from.
+//
+// The generated bindings do not record the versions of their models, so the
+// expected versions are read from the YANG files of the
+// github.com/openconfig/public release the bindings were generated from, e.g.
+// as checked out by tools/clone_oc_public.sh:
+//
+//	want, err := modelcheck.FromYANG(publicDir, "openconfig-interfaces", "openconfig-platform")
+//	...
+//	modelcheck.Check(t, dut, want)
+//
+// A model supported by the DUT is compatible if its major version matches the
+// expected version and its minor and patch versions are not older.
+package modelcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/openconfig/models-ci/yangutil"
+	"github.com/openconfig/ondatra"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	moduleRE  = regexp.MustCompile(`(?m)^\s*module\s+([\w.-]+)\s*\{`)
+	versionRE = regexp.MustCompile(`oc-ext:openconfig-version\s+"([^"]+)"\s*;`)
+)
+
+// FromYANG returns the models and their OpenConfig versions defined by the
+// YANG modules below dir. If names are given, only these modules are returned,
+// and it is an error if one of them is not found. Modules without an
+// openconfig-version are skipped.
+func FromYANG(dir string, names ...string) ([]*gpb.ModelData, error) {
+	files, err := yangutil.GetAllYANGFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing YANG files of %s: %w", dir, err)
+	}
+	want := map[string]bool{}
+	for _, n := range names {
+		want[n] = true
+	}
+	found := map[string]*gpb.ModelData{}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		m := moduleRE.FindSubmatch(b)
+		v := versionRE.FindSubmatch(b)
+		if m == nil || v == nil {
+			continue
+		}
+		name := string(m[1])
+		if len(want) > 0 && !want[name] {
+			continue
+		}
+		found[name] = &gpb.ModelData{Name: name, Version: string(v[1])}
+	}
+	var missing []string
+	for n := range want {
+		if found[n] == nil {
+			missing = append(missing, n)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("modules %v not found in %s", missing, dir)
+	}
+	models := make([]*gpb.ModelData, 0, len(found))
+	for _, md := range found {
+		models = append(models, md)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].GetName() < models[j].GetName() })
+	return models, nil
+}
+
+// semver is a parsed semantic version.
+type semver [3]int
+
+func parseSemver(s string) (semver, error) {
+	var v semver
+	parts := strings.SplitN(strings.TrimPrefix(s, "v"), ".", 3)
+	if len(parts) != 3 {
+		return v, fmt.Errorf("version %q is not of the form x.y.z", s)
+	}
+	for i, p := range parts {
+		// Drop pre-release and build suffixes.
+		if j := strings.IndexAny(p, "-+"); j >= 0 {
+			p = p[:j]
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, fmt.Errorf("version %q is not of the form x.y.z: %w", s, err)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func (v semver) less(o semver) bool {
+	for i := range v {
+		if v[i] != o[i] {
+			return v[i] < o[i]
+		}
+	}
+	return false
+}
+
+// Mismatch is a model whose version supported by the DUT is not compatible
+// with the expected version.
+type Mismatch struct {
+	Name   string
+	Want   string
+	Got    string
+	Reason string
+}
+
+// Report is the outcome of the comparison of the expected models with the
+// models supported by a DUT.
+type Report struct {
+	// Missing are the expected models the DUT does not support.
+	Missing []string
+	// Mismatched are the models with incompatible versions.
+	Mismatched []*Mismatch
+	// Compatible are the models with compatible versions.
+	Compatible []string
+}
+
+// Compare compares the expected models want with the models got supported by a
+// DUT.
+func Compare(want, got []*gpb.ModelData) *Report {
+	supported := map[string]string{}
+	for _, md := range got {
+		supported[md.GetName()] = md.GetVersion()
+	}
+	r := &Report{}
+	for _, w := range want {
+		name := w.GetName()
+		gv, ok := supported[name]
+		if !ok {
+			r.Missing = append(r.Missing, name)
+			continue
+		}
+		if reason := incompatible(w.GetVersion(), gv); reason != "" {
+			r.Mismatched = append(r.Mismatched, &Mismatch{Name: name, Want: w.GetVersion(), Got: gv, Reason: reason})
+			continue
+		}
+		r.Compatible = append(r.Compatible, name)
+	}
+	sort.Strings(r.Missing)
+	sort.Strings(r.Compatible)
+	sort.Slice(r.Mismatched, func(i, j int) bool { return r.Mismatched[i].Name < r.Mismatched[j].Name })
+	return r
+}
+
+// incompatible returns why version got is not compatible with version want, or
+// an empty string if it is.
+func incompatible(want, got string) string {
+	if want == got {
+		return ""
+	}
+	wv, err := parseSemver(want)
+	if err != nil {
+		return err.Error()
+	}
+	gv, err := parseSemver(got)
+	if err != nil {
+		return err.Error()
+	}
+	switch {
+	case wv[0] != gv[0]:
+		return "major version differs"
+	case gv.less(wv):
+		return "older than the bindings"
+	}
+	return ""
+}
+
+// Err returns an error describing the missing and mismatched models of r, or
+// nil if there are none.
+func (r *Report) Err() error {
+	if len(r.Missing) == 0 && len(r.Mismatched) == 0 {
+		return nil
+	}
+	return errors.New(r.String())
+}
+
+// String returns a table of the missing and mismatched models of r.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d compatible, %d missing, %d mismatched models\n", len(r.Compatible), len(r.Missing), len(r.Mismatched))
+	for _, n := range r.Missing {
+		fmt.Fprintf(&b, "  %-50s not supported by the DUT\n", n)
+	}
+	for _, m := range r.Mismatched {
+		fmt.Fprintf(&b, "  %-50s bindings %-10s DUT %-10s %s\n", m.Name, m.Want, m.Got, m.Reason)
+	}
+	return b.String()
+}
+
+// Capabilities returns the models supported by dut.
+func Capabilities(t testing.TB, dut *ondatra.DUTDevice) []*gpb.ModelData {
+	t.Helper()
+	resp, err := dut.RawAPIs().GNMI(t).Capabilities(context.Background(), &gpb.CapabilityRequest{})
+	if err != nil {
+		t.Fatalf("gNMI Capabilities of %s: %v", dut.Name(), err)
+	}
+	return resp.GetSupportedModels()
+}
+
+// Check compares the models want with the models supported by dut, and fails
+// the test with a report of the missing and mismatched models.
+func Check(t testing.TB, dut *ondatra.DUTDevice, want []*gpb.ModelData) *Report {
+	t.Helper()
+	r := Compare(want, Capabilities(t, dut))
+	if err := r.Err(); err != nil {
+		t.Fatalf("Models of %s are not compatible with the generated bindings: %v", dut.Name(), err)
+	}
+	return r
+}
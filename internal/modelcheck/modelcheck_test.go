@@ -0,0 +1,99 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modelcheck
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func TestFromYANG(t *testing.T) {
+	tests := []struct {
+		desc    string
+		names   []string
+		want    []*gpb.ModelData
+		wantErr bool
+	}{{
+		desc: "all modules",
+		want: []*gpb.ModelData{
+			{Name: "openconfig-bar", Version: "0.4.0"},
+			{Name: "openconfig-foo", Version: "1.2.3"},
+		},
+	}, {
+		desc:  "selected module",
+		names: []string{"openconfig-foo"},
+		want:  []*gpb.ModelData{{Name: "openconfig-foo", Version: "1.2.3"}},
+	}, {
+		desc:    "module not found",
+		names:   []string{"openconfig-foo", "openconfig-qux"},
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := FromYANG("testdata", tt.names...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromYANG() got error %v, want error %t", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("FromYANG() (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	want := []*gpb.ModelData{
+		{Name: "openconfig-a", Version: "1.2.3"},
+		{Name: "openconfig-b", Version: "1.2.3"},
+		{Name: "openconfig-c", Version: "1.2.3"},
+		{Name: "openconfig-d", Version: "1.2.3"},
+		{Name: "openconfig-e", Version: "1.2.3"},
+		{Name: "openconfig-f", Version: "1.2.3"},
+	}
+	got := []*gpb.ModelData{
+		{Name: "openconfig-a", Version: "1.2.3"},
+		{Name: "openconfig-b", Version: "1.3.0"},
+		{Name: "openconfig-c", Version: "2.0.0"},
+		{Name: "openconfig-d", Version: "1.2.2"},
+		{Name: "openconfig-e", Version: "unknown"},
+		{Name: "openconfig-x", Version: "1.0.0"},
+	}
+	r := Compare(want, got)
+
+	if diff := cmp.Diff([]string{"openconfig-a", "openconfig-b"}, r.Compatible); diff != "" {
+		t.Errorf("Compare() compatible models (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"openconfig-f"}, r.Missing); diff != "" {
+		t.Errorf("Compare() missing models (-want +got):\n%s", diff)
+	}
+	var mismatched []string
+	for _, m := range r.Mismatched {
+		mismatched = append(mismatched, m.Name)
+	}
+	if diff := cmp.Diff([]string{"openconfig-c", "openconfig-d", "openconfig-e"}, mismatched); diff != "" {
+		t.Errorf("Compare() mismatched models (-want +got):\n%s", diff)
+	}
+	if r.Err() == nil {
+		t.Errorf("Report.Err() got nil, want error")
+	}
+	if r := Compare(want[:2], got); r.Err() != nil {
+		t.Errorf("Report.Err() of compatible models got %v, want nil", r.Err())
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otgutils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/openconfig/ondatra/otg"
+)
+
+// StartCapture starts capturing packets on the ports of the OTG configured
+// with a capture.
+func StartCapture(t testing.TB, otg *otg.OTG) {
+	t.Helper()
+	setCaptureState(t, otg, gosnappi.StatePortCaptureState.START)
+}
+
+// StopCapture stops capturing packets on the ports of the OTG.
+func StopCapture(t testing.TB, otg *otg.OTG) {
+	t.Helper()
+	setCaptureState(t, otg, gosnappi.StatePortCaptureState.STOP)
+}
+
+func setCaptureState(t testing.TB, otg *otg.OTG, state gosnappi.StatePortCaptureStateEnum) {
+	t.Helper()
+	cs := gosnappi.NewControlState()
+	cs.Port().Capture().SetState(state)
+	otg.SetControlState(t, cs)
+}
+
+// ReadCapture returns the packets captured on the OTG port named port, which
+// is the ID of the ATE port.
+func ReadCapture(t testing.TB, otg *otg.OTG, port string) []gopacket.Packet {
+	t.Helper()
+	pkts, err := ParseCapture(otg.GetCapture(t, gosnappi.NewCaptureRequest().SetPortName(port)))
+	if err != nil {
+		t.Fatalf("Cannot read the capture of port %s: %v", port, err)
+	}
+	return pkts
+}
+
+// ParseCapture returns the packets of the pcap file b, with their capture
+// information in their metadata.
+func ParseCapture(b []byte) ([]gopacket.Packet, error) {
+	r, err := pcapgo.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	var pkts []gopacket.Packet
+	for {
+		data, ci, err := r.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			return pkts, nil
+		}
+		if err != nil {
+			return pkts, fmt.Errorf("packet %d: %w", len(pkts), err)
+		}
+		p := gopacket.NewPacket(data, r.LinkType(), gopacket.Default)
+		p.Metadata().CaptureInfo = ci
+		pkts = append(pkts, p)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otgutils
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func TestParseCapture(t *testing.T) {
+	var pcap bytes.Buffer
+	w := pcapgo.NewWriter(&pcap)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatalf("WriteFileHeader failed: %v", err)
+	}
+	for i, ttl := range []uint8{64, 63} {
+		buf := gopacket.NewSerializeBuffer()
+		if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true},
+			&layers.Ethernet{SrcMAC: net.HardwareAddr{2, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{2, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4},
+			&layers.IPv4{Version: 4, IHL: 5, TTL: ttl, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{192, 0, 2, 1}, DstIP: net.IP{192, 0, 2, 2}},
+			gopacket.Payload("payload"),
+		); err != nil {
+			t.Fatalf("SerializeLayers failed: %v", err)
+		}
+		data := buf.Bytes()
+		ci := gopacket.CaptureInfo{Timestamp: time.Unix(int64(i), 0), CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatalf("WritePacket failed: %v", err)
+		}
+	}
+
+	pkts, err := ParseCapture(pcap.Bytes())
+	if err != nil {
+		t.Fatalf("ParseCapture() failed: %v", err)
+	}
+	var got []uint8
+	for i, p := range pkts {
+		ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok {
+			t.Fatalf("ParseCapture() packet has no IPv4 layer: %v", p)
+		}
+		got = append(got, ip.TTL)
+		if ts := p.Metadata().Timestamp; !ts.Equal(time.Unix(int64(i), 0)) {
+			t.Errorf("ParseCapture() packet %d timestamp: got %v, want %v", i, ts, time.Unix(int64(i), 0))
+		}
+	}
+	if len(got) != 2 || got[0] != 64 || got[1] != 63 {
+		t.Errorf("ParseCapture() TTLs: got %v, want [64 63]", got)
+	}
+
+	if _, err := ParseCapture([]byte("not a pcap")); err == nil {
+		t.Errorf("ParseCapture() of invalid data: got no error, want error")
+	}
+}
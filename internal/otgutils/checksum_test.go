@@ -0,0 +1,43 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otgutils
+
+import "testing"
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		desc string
+		b    []byte
+		want uint16
+	}{{
+		desc: "RFC 1071 example",
+		b:    []byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7},
+		want: 0x220d,
+	}, {
+		desc: "odd length",
+		b:    []byte{0x00, 0x01, 0xf2},
+		want: 0x0dfe,
+	}, {
+		desc: "empty",
+		want: 0xffff,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := Checksum(tt.b); got != tt.want {
+				t.Errorf("Checksum(%x): got %#x, want %#x", tt.b, got, tt.want)
+			}
+		})
+	}
+}
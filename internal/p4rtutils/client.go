@@ -0,0 +1,291 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p4rtutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cisco-open/go-p4/p4rt_client"
+	"github.com/cisco-open/go-p4/utils"
+	"github.com/openconfig/ondatra"
+	p4_config "github.com/p4lang/p4runtime/go/p4/config/v1"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+	"google.golang.org/grpc/codes"
+)
+
+// DefaultStreamName is the name of the stream channel of a Client.
+const DefaultStreamName = "p4rt"
+
+// Client is a P4Runtime client of a device of a DUT, bound to an election ID.
+// It embeds the underlying client, so that the raw RPCs remain available.
+type Client struct {
+	*p4rt_client.P4RTClient
+	// DeviceID is the P4Runtime device ID, which is the node-id of the
+	// integrated circuit component.
+	DeviceID uint64
+	// ElectionID is the election ID of the client in arbitration and in all
+	// the write requests.
+	ElectionID *p4_v1.Uint128
+	// StreamName is the name of the stream channel of the client.
+	StreamName string
+
+	// packetSeq is the number of packets received on the stream channel when
+	// PacketsIn last returned.
+	packetSeq uint64
+}
+
+// NewClient returns a Client connected to the P4Runtime server of dut, for
+// the device deviceID with the election ID electionID. The stream channel is
+// created by Arbitrate.
+func NewClient(t testing.TB, dut *ondatra.DUTDevice, deviceID, electionID uint64) *Client {
+	t.Helper()
+	c := p4rt_client.NewP4RTClient(&p4rt_client.P4RTClientParameters{})
+	if err := c.P4rtClientSet(dut.RawAPIs().P4RT(t)); err != nil {
+		t.Fatalf("Could not initialize p4rt client: %v", err)
+	}
+	return &Client{
+		P4RTClient: c,
+		DeviceID:   deviceID,
+		ElectionID: &p4_v1.Uint128{Low: electionID},
+		StreamName: DefaultStreamName,
+	}
+}
+
+// NewPrimaryBackup returns two clients of dut for the device deviceID, which
+// have arbitrated so that the first one is the primary with electionID and
+// the second one a backup with electionID-1.
+func NewPrimaryBackup(t testing.TB, dut *ondatra.DUTDevice, deviceID, electionID uint64) (*Client, *Client) {
+	t.Helper()
+	primary := NewClient(t, dut, deviceID, electionID)
+	backup := NewClient(t, dut, deviceID, electionID-1)
+	for _, c := range []*Client{primary, backup} {
+		isPrimary, err := c.Arbitrate()
+		if err != nil {
+			t.Fatalf("Client with election ID %d: %v", c.ElectionID.GetLow(), err)
+		}
+		if want := c == primary; isPrimary != want {
+			t.Fatalf("Client with election ID %d is primary: got %t, want %t", c.ElectionID.GetLow(), isPrimary, want)
+		}
+	}
+	return primary, backup
+}
+
+// Arbitrate creates the stream channel of c if needed, and sends a
+// MasterArbitrationUpdate with the device ID and the election ID of c. It
+// returns whether c is the primary according to the arbitration response.
+// The arbitration updates received before the request are discarded.
+func (c *Client) Arbitrate() (bool, error) {
+	if c.StreamChannelGet(&c.StreamName) == nil {
+		if err := c.StreamChannelCreate(&p4rt_client.P4RTStreamParameters{
+			Name:        c.StreamName,
+			DeviceId:    c.DeviceID,
+			ElectionIdH: c.ElectionID.GetHigh(),
+			ElectionIdL: c.ElectionID.GetLow(),
+		}); err != nil {
+			return false, fmt.Errorf("could not create stream channel: %w", err)
+		}
+	}
+	seq := c.StreamChannelGet(&c.StreamName).GetArbCounters().RxArbCntr
+	if err := c.StreamChannelSendMsg(&c.StreamName, &p4_v1.StreamMessageRequest{
+		Update: &p4_v1.StreamMessageRequest_Arbitration{
+			Arbitration: &p4_v1.MasterArbitrationUpdate{
+				DeviceId:   c.DeviceID,
+				ElectionId: c.ElectionID,
+			},
+		},
+	}); err != nil {
+		return false, fmt.Errorf("could not send ClientArbitration message: %w", err)
+	}
+	for {
+		_, arb, err := c.StreamChannelGetArbitrationResp(&c.StreamName, seq+1)
+		if err != nil {
+			if err := StreamTermErr(c.StreamTermErr); err != nil {
+				return false, err
+			}
+			return false, fmt.Errorf("errors seen in ClientArbitration response: %w", err)
+		}
+		if arb == nil {
+			return false, errors.New("no ClientArbitration response")
+		}
+		if arb.SeqNum > seq {
+			return isPrimary(arb.Arb)
+		}
+	}
+}
+
+// NextArbitration returns the next arbitration update received on the stream
+// channel of c, such as the notification of a change of primary, waiting up to
+// timeout for it.
+func (c *Client) NextArbitration(timeout time.Duration) (*p4_v1.MasterArbitrationUpdate, error) {
+	stream := c.StreamChannelGet(&c.StreamName)
+	if stream == nil {
+		return nil, fmt.Errorf("no stream channel %q", c.StreamName)
+	}
+	for deadline := time.Now().Add(timeout); ; time.Sleep(100 * time.Millisecond) {
+		// With a minimum sequence number of 0, GetArbitration does not wait.
+		_, arb, err := stream.GetArbitration(0)
+		if err != nil {
+			return nil, err
+		}
+		if arb != nil {
+			return arb.Arb, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no arbitration update within %v", timeout)
+		}
+	}
+}
+
+// isPrimary returns whether the arbitration response arb designates the
+// client as the primary. Backups are told the election ID of the primary with
+// ALREADY_EXISTS, or NOT_FOUND if there is no primary.
+func isPrimary(arb *p4_v1.MasterArbitrationUpdate) (bool, error) {
+	switch code := codes.Code(arb.GetStatus().GetCode()); code {
+	case codes.OK:
+		return true, nil
+	case codes.AlreadyExists, codes.NotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected ClientArbitration response status %v: %s", code, arb.GetStatus().GetMessage())
+	}
+}
+
+// Close destroys the stream channel of c, which releases its role.
+func (c *Client) Close() error {
+	return c.StreamChannelDestroy(&c.StreamName)
+}
+
+// SetPipeline pushes p4Info with cookie as the forwarding pipeline config of
+// the device, with the VERIFY_AND_COMMIT action.
+func (c *Client) SetPipeline(p4Info *p4_config.P4Info, cookie uint64) error {
+	return c.SetForwardingPipelineConfig(&p4_v1.SetForwardingPipelineConfigRequest{
+		DeviceId:   c.DeviceID,
+		ElectionId: c.ElectionID,
+		Action:     p4_v1.SetForwardingPipelineConfigRequest_VERIFY_AND_COMMIT,
+		Config: &p4_v1.ForwardingPipelineConfig{
+			P4Info: p4Info,
+			Cookie: &p4_v1.ForwardingPipelineConfig_Cookie{
+				Cookie: cookie,
+			},
+		},
+	})
+}
+
+// LoadPipeline loads the p4info text file p4InfoFile and pushes it with
+// cookie as the forwarding pipeline config of the device.
+func (c *Client) LoadPipeline(p4InfoFile string, cookie uint64) error {
+	p4Info, err := utils.P4InfoLoad(&p4InfoFile)
+	if err != nil {
+		return fmt.Errorf("could not load p4info file %q: %w", p4InfoFile, err)
+	}
+	return c.SetPipeline(p4Info, cookie)
+}
+
+// Updates returns the updates of type typ of entities.
+func Updates(typ p4_v1.Update_Type, entities ...*p4_v1.Entity) []*p4_v1.Update {
+	var updates []*p4_v1.Update
+	for _, e := range entities {
+		updates = append(updates, &p4_v1.Update{Type: typ, Entity: e})
+	}
+	return updates
+}
+
+// TableEntries returns the entities of the table entries entries.
+func TableEntries(entries ...*p4_v1.TableEntry) []*p4_v1.Entity {
+	var entities []*p4_v1.Entity
+	for _, e := range entries {
+		entities = append(entities, &p4_v1.Entity{Entity: &p4_v1.Entity_TableEntry{TableEntry: e}})
+	}
+	return entities
+}
+
+// WriteUpdates writes updates to the device, continuing on errors.
+func (c *Client) WriteUpdates(updates []*p4_v1.Update) error {
+	return c.Write(&p4_v1.WriteRequest{
+		DeviceId:   c.DeviceID,
+		ElectionId: c.ElectionID,
+		Updates:    updates,
+		Atomicity:  p4_v1.WriteRequest_CONTINUE_ON_ERROR,
+	})
+}
+
+// Insert inserts entities on the device.
+func (c *Client) Insert(entities ...*p4_v1.Entity) error {
+	return c.WriteUpdates(Updates(p4_v1.Update_INSERT, entities...))
+}
+
+// Modify modifies entities on the device.
+func (c *Client) Modify(entities ...*p4_v1.Entity) error {
+	return c.WriteUpdates(Updates(p4_v1.Update_MODIFY, entities...))
+}
+
+// Delete deletes entities from the device.
+func (c *Client) Delete(entities ...*p4_v1.Entity) error {
+	return c.WriteUpdates(Updates(p4_v1.Update_DELETE, entities...))
+}
+
+// ReadEntities returns the entities of the device matching entities, which
+// are typically wildcards such as a table entry with only a table ID.
+func (c *Client) ReadEntities(entities ...*p4_v1.Entity) ([]*p4_v1.Entity, error) {
+	stream, err := c.Read(&p4_v1.ReadRequest{
+		DeviceId: c.DeviceID,
+		Entities: entities,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var got []*p4_v1.Entity
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return got, nil
+		}
+		if err != nil {
+			return got, err
+		}
+		got = append(got, resp.GetEntities()...)
+	}
+}
+
+// SendPacketOut sends a PacketOut with payload and metadata on the stream
+// channel of c.
+func (c *Client) SendPacketOut(payload []byte, metadata ...*p4_v1.PacketMetadata) error {
+	return c.StreamChannelSendMsg(&c.StreamName, &p4_v1.StreamMessageRequest{
+		Update: &p4_v1.StreamMessageRequest_Packet{
+			Packet: &p4_v1.PacketOut{
+				Payload:  payload,
+				Metadata: metadata,
+			},
+		},
+	})
+}
+
+// PacketsIn returns the PacketIn messages received on the stream channel of
+// c since the previous call, waiting up to timeout for at least n of them.
+func (c *Client) PacketsIn(n uint64, timeout time.Duration) ([]*p4_v1.PacketIn, error) {
+	seq, infos, err := c.StreamChannelGetPackets(&c.StreamName, c.packetSeq+n, timeout)
+	c.packetSeq = seq
+	var packets []*p4_v1.PacketIn
+	for _, info := range infos {
+		if info != nil && info.Pkt != nil {
+			packets = append(packets, info.Pkt)
+		}
+	}
+	return packets, err
+}
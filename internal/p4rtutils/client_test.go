@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p4rtutils
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestIsPrimary(t *testing.T) {
+	tests := []struct {
+		desc    string
+		status  *status.Status
+		want    bool
+		wantErr bool
+	}{{
+		desc: "no status",
+		want: true,
+	}, {
+		desc:   "ok",
+		status: &status.Status{Code: int32(codes.OK)},
+		want:   true,
+	}, {
+		desc:   "backup with primary",
+		status: &status.Status{Code: int32(codes.AlreadyExists)},
+	}, {
+		desc:   "backup without primary",
+		status: &status.Status{Code: int32(codes.NotFound)},
+	}, {
+		desc:    "error",
+		status:  &status.Status{Code: int32(codes.PermissionDenied), Message: "denied"},
+		wantErr: true,
+	}}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := isPrimary(&p4_v1.MasterArbitrationUpdate{Status: tc.status})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("isPrimary() got error %v, want error %t", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("isPrimary() got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdates(t *testing.T) {
+	entries := []*p4_v1.TableEntry{{TableId: 1}, {TableId: 2}}
+	got := Updates(p4_v1.Update_DELETE, TableEntries(entries...)...)
+	want := []*p4_v1.Update{{
+		Type:   p4_v1.Update_DELETE,
+		Entity: &p4_v1.Entity{Entity: &p4_v1.Entity_TableEntry{TableEntry: &p4_v1.TableEntry{TableId: 1}}},
+	}, {
+		Type:   p4_v1.Update_DELETE,
+		Entity: &p4_v1.Entity{Entity: &p4_v1.Entity_TableEntry{TableEntry: &p4_v1.TableEntry{TableId: 2}}},
+	}}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("Updates() unexpected diff (-want +got):\n%s", diff)
+	}
+}
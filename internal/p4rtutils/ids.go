@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p4rtutils
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+)
+
+// PortIDs are the P4RT IDs of a port of a DUT.
+type PortIDs struct {
+	// Node is the name of the integrated circuit component of the port.
+	Node string
+	// NodeID is the node-id of Node, which is the P4RT device ID.
+	NodeID uint64
+	// PortID is the P4RT port ID of the interface of the port.
+	PortID uint32
+}
+
+// sortPortIDs sorts the testbed port IDs ids in their natural order, so that
+// "port2" is before "port10".
+func sortPortIDs(ids []string) {
+	sort.Slice(ids, func(i, j int) bool {
+		if len(ids[i]) != len(ids[j]) {
+			return len(ids[i]) < len(ids[j])
+		}
+		return ids[i] < ids[j]
+	})
+}
+
+// assignIDs returns the P4RT IDs of the ports of nodes, a map of
+// <portID>:<P4RTNodeName>. In the natural order of the ports, they get port
+// IDs from firstPortID, and their nodes get node IDs from firstNodeID.
+func assignIDs(nodes map[string]string, firstNodeID uint64, firstPortID uint32) map[string]PortIDs {
+	var ports []string
+	for p := range nodes {
+		ports = append(ports, p)
+	}
+	sortPortIDs(ports)
+
+	nodeIDs := map[string]uint64{}
+	ids := map[string]PortIDs{}
+	for i, p := range ports {
+		node := nodes[p]
+		if _, ok := nodeIDs[node]; !ok {
+			nodeIDs[node] = firstNodeID + uint64(len(nodeIDs))
+		}
+		ids[p] = PortIDs{Node: node, NodeID: nodeIDs[node], PortID: firstPortID + uint32(i)}
+	}
+	return ids
+}
+
+// ConfigureIDs configures the P4RT IDs of the reserved ports of dut which are
+// on a P4RT node: the node-id of their integrated circuit components from
+// firstNodeID, and the id of their interfaces from firstPortID. It returns
+// the IDs by testbed port ID. Only the id leaves are updated, so the
+// interfaces are expected to be configured already.
+func ConfigureIDs(t testing.TB, dut *ondatra.DUTDevice, firstNodeID uint64, firstPortID uint32) map[string]PortIDs {
+	t.Helper()
+	ids := assignIDs(P4RTNodesByPort(t, dut), firstNodeID, firstPortID)
+	if len(ids) == 0 {
+		t.Fatalf("No P4RT node found for the ports of %s", dut.Name())
+	}
+	b := &gnmi.SetBatch{}
+	nodes := map[string]bool{}
+	for p, id := range ids {
+		t.Logf("Configuring %s: P4RT node %s with node-id %d, port-id %d", p, id.Node, id.NodeID, id.PortID)
+		gnmi.BatchUpdate(b, gnmi.OC().Interface(dut.Port(t, p).Name()).Id().Config(), id.PortID)
+		if !nodes[id.Node] {
+			nodes[id.Node] = true
+			gnmi.BatchUpdate(b, gnmi.OC().Component(id.Node).IntegratedCircuit().NodeId().Config(), id.NodeID)
+		}
+	}
+	b.Set(t, dut)
+	return ids
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p4rtutils
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAssignIDs(t *testing.T) {
+	nodes := map[string]string{
+		"port10": "FPC0:NPU1",
+		"port2":  "FPC0:NPU1",
+		"port1":  "FPC0:NPU0",
+		"port3":  "FPC0:NPU0",
+	}
+	want := map[string]PortIDs{
+		"port1":  {Node: "FPC0:NPU0", NodeID: 5, PortID: 10},
+		"port2":  {Node: "FPC0:NPU1", NodeID: 6, PortID: 11},
+		"port3":  {Node: "FPC0:NPU0", NodeID: 5, PortID: 12},
+		"port10": {Node: "FPC0:NPU1", NodeID: 6, PortID: 13},
+	}
+	if diff := cmp.Diff(want, assignIDs(nodes, 5, 10)); diff != "" {
+		t.Errorf("assignIDs() unexpected diff (-want +got):\n%s", diff)
+	}
+}
@@ -17,7 +17,8 @@
  *
  */
 
-// Package p4rtutils implements helper functions for acl_wbb_ingress_table in p4info file.
+// Package p4rtutils implements a P4Runtime client for tests, and helper
+// functions for acl_wbb_ingress_table in p4info file.
 package p4rtutils
 
 import (
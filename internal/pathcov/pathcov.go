@@ -0,0 +1,289 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pathcov records the OpenConfig paths that tests read and write over
+// gNMI, and reports them as machine-readable path coverage.
+//
+// A Recorder wraps the gNMI client of a DUT. Paths are recorded as schema
+// paths, without list keys, e.g. /interfaces/interface/state/oper-status.
+// Paths which are read are recorded as requested; the Ondatra gnmi package
+// reads with subscriptions, so its Get, Lookup, Watch and Await calls are all
+// recorded as Subscribe. Paths which are written with a JSON value are
+// expanded into the leaves of the value.
+package pathcov
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// Op is the gNMI operation by which a path is accessed.
+type Op string
+
+// Operations by which paths are accessed.
+const (
+	Get          Op = "get"
+	Subscribe    Op = "subscribe"
+	Update       Op = "update"
+	Replace      Op = "replace"
+	UnionReplace Op = "union_replace"
+	Delete       Op = "delete"
+)
+
+// PathUse is the number of times a path is accessed by an operation.
+type PathUse struct {
+	Path  string `json:"path"`
+	Op    Op     `json:"op"`
+	Count int    `json:"count"`
+	// Tests are the plan IDs of the tests which access the path, in a merged
+	// report.
+	Tests []string `json:"tests,omitempty"`
+}
+
+// Report is the path coverage of a test.
+type Report struct {
+	// PlanID and UUID identify the test, from its metadata.
+	PlanID string `json:"plan_id,omitempty"`
+	UUID   string `json:"uuid,omitempty"`
+	// Paths are the accessed paths, sorted by path and operation.
+	Paths []*PathUse `json:"paths"`
+}
+
+type use struct {
+	path string
+	op   Op
+}
+
+// Recorder records the paths accessed through the gNMI clients it wraps. It
+// is safe for concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	counts map[use]int
+}
+
+// NewRecorder returns a new, empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{counts: map[use]int{}}
+}
+
+// Client returns a gNMI client which records the paths of the requests sent
+// through c.
+func (r *Recorder) Client(c gpb.GNMIClient) gpb.GNMIClient {
+	return &client{GNMIClient: c, r: r}
+}
+
+// Report returns the paths recorded so far.
+func (r *Recorder) Report() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := &Report{Paths: []*PathUse{}}
+	for u, n := range r.counts {
+		rep.Paths = append(rep.Paths, &PathUse{Path: u.path, Op: u.op, Count: n})
+	}
+	sortPaths(rep.Paths)
+	return rep
+}
+
+func sortPaths(ps []*PathUse) {
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i].Path != ps[j].Path {
+			return ps[i].Path < ps[j].Path
+		}
+		return ps[i].Op < ps[j].Op
+	})
+}
+
+func (r *Recorder) add(op Op, p string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[use{path: p, op: op}]++
+}
+
+// record records the path p below prefix.
+func (r *Recorder) record(op Op, prefix, p *gpb.Path) {
+	r.add(op, SchemaPath(prefix, p))
+}
+
+// recordUpdate records the path of u below prefix, expanded into the leaves of
+// its value if the value is JSON.
+func (r *Recorder) recordUpdate(op Op, prefix *gpb.Path, u *gpb.Update) {
+	p := SchemaPath(prefix, u.GetPath())
+	var b []byte
+	switch v := u.GetVal().GetValue().(type) {
+	case *gpb.TypedValue_JsonIetfVal:
+		b = v.JsonIetfVal
+	case *gpb.TypedValue_JsonVal:
+		b = v.JsonVal
+	}
+	if b == nil {
+		r.add(op, p)
+		return
+	}
+	var tree any
+	if err := json.Unmarshal(b, &tree); err != nil {
+		r.add(op, p)
+		return
+	}
+	leaves := map[string]bool{}
+	jsonLeaves(strings.TrimSuffix(p, "/"), tree, leaves)
+	if len(leaves) == 0 {
+		r.add(op, p)
+		return
+	}
+	for l := range leaves {
+		r.add(op, l)
+	}
+}
+
+// jsonLeaves adds the schema paths of the leaves of the JSON tree at path p to
+// leaves. Module prefixes of the member names are removed.
+func jsonLeaves(p string, tree any, leaves map[string]bool) {
+	switch v := tree.(type) {
+	case map[string]any:
+		for k, c := range v {
+			if i := strings.Index(k, ":"); i >= 0 {
+				k = k[i+1:]
+			}
+			jsonLeaves(p+"/"+k, c, leaves)
+		}
+	case []any:
+		// A list, whose entries are objects, or a leaf-list.
+		isList := false
+		for _, e := range v {
+			if _, ok := e.(map[string]any); ok {
+				isList = true
+				jsonLeaves(p, e, leaves)
+			}
+		}
+		if !isList {
+			leaves[p] = true
+		}
+	default:
+		leaves[p] = true
+	}
+}
+
+// SchemaPath returns the schema path of p below prefix, which is the path
+// without list keys. The origin is prepended for origins other than
+// openconfig, e.g. "cli:/".
+func SchemaPath(prefix, p *gpb.Path) string {
+	var b strings.Builder
+	origin := p.GetOrigin()
+	if origin == "" {
+		origin = prefix.GetOrigin()
+	}
+	if origin != "" && origin != "openconfig" {
+		b.WriteString(origin + ":")
+	}
+	elems := append(append([]*gpb.PathElem{}, prefix.GetElem()...), p.GetElem()...)
+	for _, e := range elems {
+		name := e.GetName()
+		if i := strings.Index(name, ":"); i >= 0 {
+			name = name[i+1:]
+		}
+		b.WriteString("/" + name)
+	}
+	if len(elems) == 0 {
+		b.WriteString("/")
+	}
+	return b.String()
+}
+
+// client is a gNMI client which records the paths of its requests.
+type client struct {
+	gpb.GNMIClient
+	r *Recorder
+}
+
+func (c *client) Get(ctx context.Context, req *gpb.GetRequest, opts ...grpc.CallOption) (*gpb.GetResponse, error) {
+	for _, p := range req.GetPath() {
+		c.r.record(Get, req.GetPrefix(), p)
+	}
+	return c.GNMIClient.Get(ctx, req, opts...)
+}
+
+func (c *client) Set(ctx context.Context, req *gpb.SetRequest, opts ...grpc.CallOption) (*gpb.SetResponse, error) {
+	for _, p := range req.GetDelete() {
+		c.r.record(Delete, req.GetPrefix(), p)
+	}
+	for _, u := range req.GetReplace() {
+		c.r.recordUpdate(Replace, req.GetPrefix(), u)
+	}
+	for _, u := range req.GetUpdate() {
+		c.r.recordUpdate(Update, req.GetPrefix(), u)
+	}
+	for _, u := range req.GetUnionReplace() {
+		c.r.recordUpdate(UnionReplace, req.GetPrefix(), u)
+	}
+	return c.GNMIClient.Set(ctx, req, opts...)
+}
+
+func (c *client) Subscribe(ctx context.Context, opts ...grpc.CallOption) (gpb.GNMI_SubscribeClient, error) {
+	stream, err := c.GNMIClient.Subscribe(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &subscribeClient{GNMI_SubscribeClient: stream, r: c.r}, nil
+}
+
+// subscribeClient is a Subscribe stream which records the paths of its
+// subscriptions.
+type subscribeClient struct {
+	gpb.GNMI_SubscribeClient
+	r *Recorder
+}
+
+func (s *subscribeClient) Send(req *gpb.SubscribeRequest) error {
+	sl := req.GetSubscribe()
+	for _, sub := range sl.GetSubscription() {
+		s.r.record(Subscribe, sl.GetPrefix(), sub.GetPath())
+	}
+	return s.GNMI_SubscribeClient.Send(req)
+}
+
+// Merge merges the reports of tests into the path coverage of a run, which
+// counts the accesses of each path by each operation over all reports, and
+// lists the tests which access it.
+func Merge(reports ...*Report) *Report {
+	merged := map[use]*PathUse{}
+	for _, rep := range reports {
+		for _, pu := range rep.Paths {
+			u := use{path: pu.Path, op: pu.Op}
+			m, ok := merged[u]
+			if !ok {
+				m = &PathUse{Path: pu.Path, Op: pu.Op}
+				merged[u] = m
+			}
+			m.Count += pu.Count
+			if rep.PlanID != "" && !slices.Contains(m.Tests, rep.PlanID) {
+				m.Tests = append(m.Tests, rep.PlanID)
+			}
+		}
+	}
+	run := &Report{Paths: []*PathUse{}}
+	for _, m := range merged {
+		sort.Strings(m.Tests)
+		run.Paths = append(run.Paths, m)
+	}
+	sortPaths(run.Paths)
+	return run
+}
@@ -0,0 +1,166 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathcov
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/grpc"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+type fakeStream struct {
+	gpb.GNMI_SubscribeClient
+}
+
+func (*fakeStream) Send(*gpb.SubscribeRequest) error { return nil }
+
+type fakeClient struct {
+	gpb.GNMIClient
+}
+
+func (*fakeClient) Get(context.Context, *gpb.GetRequest, ...grpc.CallOption) (*gpb.GetResponse, error) {
+	return &gpb.GetResponse{}, nil
+}
+
+func (*fakeClient) Set(context.Context, *gpb.SetRequest, ...grpc.CallOption) (*gpb.SetResponse, error) {
+	return &gpb.SetResponse{}, nil
+}
+
+func (*fakeClient) Subscribe(context.Context, ...grpc.CallOption) (gpb.GNMI_SubscribeClient, error) {
+	return &fakeStream{}, nil
+}
+
+func mustPath(t *testing.T, s string) *gpb.Path {
+	t.Helper()
+	p, err := ygot.StringToStructuredPath(s)
+	if err != nil {
+		t.Fatalf("Invalid path %q: %v", s, err)
+	}
+	return p
+}
+
+func TestSchemaPath(t *testing.T) {
+	tests := []struct {
+		desc   string
+		prefix *gpb.Path
+		path   *gpb.Path
+		want   string
+	}{{
+		desc: "keys removed",
+		path: mustPath(t, "/interfaces/interface[name=eth0]/state/oper-status"),
+		want: "/interfaces/interface/state/oper-status",
+	}, {
+		desc:   "prefix",
+		prefix: mustPath(t, "/network-instances/network-instance[name=DEFAULT]"),
+		path:   mustPath(t, "/protocols/protocol[identifier=BGP][name=BGP]/bgp"),
+		want:   "/network-instances/network-instance/protocols/protocol/bgp",
+	}, {
+		desc: "module prefix removed",
+		path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "openconfig-system:system"}, {Name: "config"}}},
+		want: "/system/config",
+	}, {
+		desc: "openconfig origin",
+		path: &gpb.Path{Origin: "openconfig", Elem: []*gpb.PathElem{{Name: "system"}}},
+		want: "/system",
+	}, {
+		desc: "cli origin",
+		path: &gpb.Path{Origin: "cli"},
+		want: "cli:/",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := SchemaPath(tt.prefix, tt.path); got != tt.want {
+				t.Errorf("SchemaPath() got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder()
+	c := r.Client(&fakeClient{})
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, &gpb.GetRequest{Path: []*gpb.Path{mustPath(t, "/system/state/hostname")}}); err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	stream, err := c.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		sl := &gpb.SubscriptionList{Subscription: []*gpb.Subscription{{Path: mustPath(t, "/interfaces/interface[name=eth0]/state/oper-status")}}}
+		if err := stream.Send(&gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: sl}}); err != nil {
+			t.Fatalf("Send() failed: %v", err)
+		}
+	}
+	val := `{"openconfig-interfaces:config": {"name": "eth0", "description": "d"}, "subinterfaces": {"subinterface": [{"index": 0, "config": {"index": 0}}]}}`
+	if _, err := c.Set(ctx, &gpb.SetRequest{
+		Delete: []*gpb.Path{mustPath(t, "/system/config/motd-banner")},
+		Replace: []*gpb.Update{{
+			Path: mustPath(t, "/interfaces/interface[name=eth0]"),
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(val)}},
+		}},
+		Update: []*gpb.Update{{
+			Path: mustPath(t, "/system/config/hostname"),
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "dut"}},
+		}},
+	}); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+
+	want := &Report{Paths: []*PathUse{
+		{Path: "/interfaces/interface/config/description", Op: Replace, Count: 1},
+		{Path: "/interfaces/interface/config/name", Op: Replace, Count: 1},
+		{Path: "/interfaces/interface/state/oper-status", Op: Subscribe, Count: 2},
+		{Path: "/interfaces/interface/subinterfaces/subinterface/config/index", Op: Replace, Count: 1},
+		{Path: "/interfaces/interface/subinterfaces/subinterface/index", Op: Replace, Count: 1},
+		{Path: "/system/config/hostname", Op: Update, Count: 1},
+		{Path: "/system/config/motd-banner", Op: Delete, Count: 1},
+		{Path: "/system/state/hostname", Op: Get, Count: 1},
+	}}
+	if diff := cmp.Diff(want, r.Report()); diff != "" {
+		t.Errorf("Report() (-want +got):\n%s", diff)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	got := Merge(&Report{
+		PlanID: "B-1",
+		Paths: []*PathUse{
+			{Path: "/a", Op: Get, Count: 1},
+			{Path: "/b", Op: Update, Count: 2},
+		},
+	}, &Report{
+		PlanID: "A-1",
+		Paths: []*PathUse{
+			{Path: "/a", Op: Get, Count: 3},
+			{Path: "/a", Op: Subscribe, Count: 1},
+		},
+	})
+	want := &Report{Paths: []*PathUse{
+		{Path: "/a", Op: Get, Count: 4, Tests: []string{"A-1", "B-1"}},
+		{Path: "/a", Op: Subscribe, Count: 1, Tests: []string{"A-1"}},
+		{Path: "/b", Op: Update, Count: 2, Tests: []string{"B-1"}},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Merge() (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,533 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qoscfg
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/openconfig/featureprofiles/internal/deviations"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+)
+
+const (
+	// maxDSCP is the highest DSCP value.
+	maxDSCP = 63
+	// maxTrafficClass is the highest MPLS traffic class.
+	maxTrafficClass = 7
+	// maxPercent is the highest drop probability percent.
+	maxPercent = 100
+)
+
+// Builder assembles the queues, forwarding groups, classifiers, scheduler
+// policies and interface bindings of a QoS configuration into one oc.Qos, and
+// validates that they refer to each other consistently.
+//
+// The Add methods record the errors of the parts they add, which are returned
+// by Build together with the errors of the references between the parts.
+type Builder struct {
+	qos  *oc.Qos
+	errs []error
+
+	// interfaceRef is whether the interface-ref of the interfaces is set.
+	interfaceRef bool
+	// subinterfaceRef is whether the interface-ref of the input interfaces
+	// includes subinterface 0.
+	subinterfaceRef bool
+	// wredWeight is whether the weight of the WRED profiles is set.
+	wredWeight bool
+}
+
+// New returns a Builder of the QoS configuration of dut.
+func New(dut *ondatra.DUTDevice) *Builder {
+	return &Builder{
+		qos:             &oc.Qos{},
+		interfaceRef:    !deviations.InterfaceRefConfigUnsupported(dut),
+		subinterfaceRef: dut.Vendor() != ondatra.CISCO,
+		wredWeight:      !deviations.QosSetWeightConfigUnsupported(dut),
+	}
+}
+
+// ClassifierTerm is a term of a classifier, which classifies packets with
+// one of the DSCP values, or with the traffic class TrafficClass for MPLS
+// classifiers, into the forwarding group TargetGroup. The packets are
+// remarked with the DSCP SetDSCP and the MPLS traffic class SetMPLSTC if they
+// are set, and TargetGroup may be empty for terms which only remark packets.
+type ClassifierTerm struct {
+	ID           string
+	TargetGroup  string
+	DSCP         []uint8
+	TrafficClass uint8
+	SetDSCP      *uint8
+	SetMPLSTC    *uint8
+}
+
+// SchedulerInput is a queue input of a scheduler.
+type SchedulerInput struct {
+	ID     string
+	Queue  string
+	Weight uint64
+}
+
+// WREDProfile is a queue management profile with uniform WRED, which drops
+// or, if ECN is set, ECN marks packets with a probability rising from 0 at
+// the queue length MinThreshold to MaxDropProbabilityPercent at MaxThreshold,
+// in bytes.
+type WREDProfile struct {
+	MinThreshold              uint64
+	MaxThreshold              uint64
+	MaxDropProbabilityPercent uint8
+	ECN                       bool
+	// Weight is the weight of the average queue length, which is not set if
+	// it is 0.
+	Weight uint32
+}
+
+// Policer is a one rate two color policer of CIR bits per second with the
+// burst BC in bytes, which drops the packets exceeding the rate, or remarks
+// them with the DSCP ExceedDSCP if it is set.
+type Policer struct {
+	CIR        uint64
+	BC         uint32
+	ExceedDSCP *uint8
+}
+
+// AddQueue adds the queue name with the queue ID id.
+func (b *Builder) AddQueue(name string, id uint8) {
+	q := b.qos.GetOrCreateQueue(name)
+	if q.QueueId != nil && q.GetQueueId() != id {
+		b.errs = append(b.errs, fmt.Errorf("queue %s: queue ID %d conflicts with %d", name, id, q.GetQueueId()))
+		return
+	}
+	q.SetQueueId(id)
+}
+
+// AddForwardingGroup adds the forwarding group group with the output queue
+// queue, and adds the queue if it does not exist.
+func (b *Builder) AddForwardingGroup(group, queue string) {
+	b.qos.GetOrCreateForwardingGroup(group).SetOutputQueue(queue)
+	b.qos.GetOrCreateQueue(queue)
+}
+
+// AddClassifier adds the terms to the classifier name of type typ, which is
+// IPV4, IPV6 or MPLS, and adds the classifier if it does not exist.
+func (b *Builder) AddClassifier(name string, typ oc.E_Qos_Classifier_Type, terms ...ClassifierTerm) {
+	if typ != oc.Qos_Classifier_Type_IPV4 && typ != oc.Qos_Classifier_Type_IPV6 && typ != oc.Qos_Classifier_Type_MPLS {
+		b.errs = append(b.errs, fmt.Errorf("classifier %s: unsupported type %v", name, typ))
+		return
+	}
+	c := b.qos.GetOrCreateClassifier(name)
+	if c.Type != oc.Qos_Classifier_Type_UNSET && c.Type != typ {
+		b.errs = append(b.errs, fmt.Errorf("classifier %s: type %v conflicts with %v", name, typ, c.Type))
+		return
+	}
+	c.SetType(typ)
+	for _, tc := range terms {
+		term, err := c.NewTerm(tc.ID)
+		if err != nil {
+			b.errs = append(b.errs, fmt.Errorf("classifier %s: %v", name, err))
+			continue
+		}
+		actions := term.GetOrCreateActions()
+		if tc.TargetGroup != "" {
+			actions.SetTargetGroup(tc.TargetGroup)
+		}
+		if tc.SetDSCP != nil {
+			actions.GetOrCreateRemark().SetSetDscp(*tc.SetDSCP)
+		}
+		if tc.SetMPLSTC != nil {
+			actions.GetOrCreateRemark().SetSetMplsTc(*tc.SetMPLSTC)
+		}
+		dscp := append([]uint8(nil), tc.DSCP...)
+		switch typ {
+		case oc.Qos_Classifier_Type_IPV4:
+			term.GetOrCreateConditions().GetOrCreateIpv4().SetDscpSet(dscp)
+		case oc.Qos_Classifier_Type_IPV6:
+			term.GetOrCreateConditions().GetOrCreateIpv6().SetDscpSet(dscp)
+		case oc.Qos_Classifier_Type_MPLS:
+			term.GetOrCreateConditions().GetOrCreateMpls().SetTrafficClass(tc.TrafficClass)
+		}
+	}
+}
+
+// AddScheduler adds the inputs to the scheduler with the sequence number seq
+// of the scheduler policy policy, and adds the scheduler and the scheduler
+// policy if they do not exist.
+func (b *Builder) AddScheduler(policy string, seq uint32, priority oc.E_Scheduler_Priority, inputs ...SchedulerInput) {
+	p := b.qos.GetOrCreateSchedulerPolicy(policy)
+	if s := p.GetScheduler(seq); s != nil && s.GetPriority() != priority {
+		b.errs = append(b.errs, fmt.Errorf("scheduler policy %s sequence %d: priority %s conflicts with %s", policy, seq, priorityString(priority), priorityString(s.GetPriority())))
+		return
+	}
+	s := p.GetOrCreateScheduler(seq)
+	s.SetPriority(priority)
+	for _, in := range inputs {
+		input, err := s.NewInput(in.ID)
+		if err != nil {
+			b.errs = append(b.errs, fmt.Errorf("scheduler policy %s sequence %d: %v", policy, seq, err))
+			continue
+		}
+		input.SetInputType(oc.Input_InputType_QUEUE)
+		input.SetQueue(in.Queue)
+		input.SetWeight(in.Weight)
+	}
+}
+
+// AddWREDProfile adds the queue management profile name with WRED p.
+func (b *Builder) AddWREDProfile(name string, p WREDProfile) {
+	if b.qos.GetQueueManagementProfile(name) != nil {
+		b.errs = append(b.errs, fmt.Errorf("queue management profile %s already exists", name))
+		return
+	}
+	u := b.qos.GetOrCreateQueueManagementProfile(name).GetOrCreateWred().GetOrCreateUniform()
+	u.SetMinThreshold(p.MinThreshold)
+	u.SetMaxThreshold(p.MaxThreshold)
+	u.SetMaxDropProbabilityPercent(p.MaxDropProbabilityPercent)
+	u.SetEnableEcn(p.ECN)
+	if p.Weight != 0 && b.wredWeight {
+		u.SetWeight(p.Weight)
+	}
+}
+
+// AddShaper shapes the scheduler with the sequence number seq of the
+// scheduler policy policy to cir bits per second with the burst bc in bytes.
+// The scheduler must have been added by AddScheduler.
+func (b *Builder) AddShaper(policy string, seq uint32, cir uint64, bc uint32) {
+	s := b.qos.GetSchedulerPolicy(policy).GetScheduler(seq)
+	if s == nil {
+		b.errs = append(b.errs, fmt.Errorf("scheduler policy %s sequence %d: shaper of a scheduler which does not exist", policy, seq))
+		return
+	}
+	if cir == 0 {
+		b.errs = append(b.errs, fmt.Errorf("scheduler policy %s sequence %d: shaper without a rate", policy, seq))
+		return
+	}
+	s.SetType(oc.QosTypes_QOS_SCHEDULER_TYPE_ONE_RATE_TWO_COLOR)
+	shaper := s.GetOrCreateOneRateTwoColor()
+	shaper.SetCir(cir)
+	shaper.SetBc(bc)
+	shaper.SetQueuingBehavior(oc.Qos_QueueBehavior_SHAPE)
+}
+
+// AddPolicer adds the scheduler with the sequence number seq of the scheduler
+// policy policy as policer p, and adds the scheduler policy if it does not
+// exist.
+func (b *Builder) AddPolicer(policy string, seq uint32, p Policer) {
+	sp := b.qos.GetOrCreateSchedulerPolicy(policy)
+	if sp.GetScheduler(seq) != nil {
+		b.errs = append(b.errs, fmt.Errorf("scheduler policy %s sequence %d: scheduler already exists", policy, seq))
+		return
+	}
+	if p.CIR == 0 {
+		b.errs = append(b.errs, fmt.Errorf("scheduler policy %s sequence %d: policer without a rate", policy, seq))
+		return
+	}
+	if p.ExceedDSCP != nil && *p.ExceedDSCP > maxDSCP {
+		b.errs = append(b.errs, fmt.Errorf("scheduler policy %s sequence %d: invalid exceed DSCP %d", policy, seq, *p.ExceedDSCP))
+		return
+	}
+	s := sp.GetOrCreateScheduler(seq)
+	s.SetType(oc.QosTypes_QOS_SCHEDULER_TYPE_ONE_RATE_TWO_COLOR)
+	policer := s.GetOrCreateOneRateTwoColor()
+	policer.SetCir(p.CIR)
+	policer.SetBc(p.BC)
+	policer.SetQueuingBehavior(oc.Qos_QueueBehavior_POLICE)
+	if p.ExceedDSCP != nil {
+		policer.GetOrCreateExceedAction().SetSetDscp(*p.ExceedDSCP)
+	} else {
+		policer.GetOrCreateExceedAction().SetDrop(true)
+	}
+}
+
+// priorityString returns the name of the scheduler priority p.
+func priorityString(p oc.E_Scheduler_Priority) string {
+	if p == oc.Scheduler_Priority_UNSET {
+		return "UNSET"
+	}
+	return p.String()
+}
+
+// qosInterface returns the QoS interface intf, with the interface-ref set to
+// the interface and, if sub, to subinterface 0.
+func (b *Builder) qosInterface(intf string, sub bool) *oc.Qos_Interface {
+	i := b.qos.GetOrCreateInterface(intf)
+	if !b.interfaceRef {
+		return i
+	}
+	ref := i.GetOrCreateInterfaceRef()
+	ref.SetInterface(intf)
+	if sub && b.subinterfaceRef {
+		ref.SetSubinterface(0)
+	}
+	return i
+}
+
+// AddInputClassifier binds the classifier classifier as the input classifier
+// of type typ of interface intf.
+func (b *Builder) AddInputClassifier(intf string, typ oc.E_Input_Classifier_Type, classifier string) {
+	b.qosInterface(intf, true).GetOrCreateInput().GetOrCreateClassifier(typ).SetName(classifier)
+}
+
+// SubinterfaceID returns the ID of the QoS interface of subinterface sub of
+// interface intf, which is intf for subinterface 0.
+func SubinterfaceID(intf string, sub uint32) string {
+	if sub == 0 {
+		return intf
+	}
+	return fmt.Sprintf("%s.%d", intf, sub)
+}
+
+// AddInputSchedulerPolicy binds the scheduler policy policy as the input of
+// subinterface sub of interface intf.
+func (b *Builder) AddInputSchedulerPolicy(intf string, sub uint32, policy string) {
+	var i *oc.Qos_Interface
+	if sub == 0 {
+		i = b.qosInterface(intf, true)
+	} else {
+		i = b.qos.GetOrCreateInterface(SubinterfaceID(intf, sub))
+		if b.interfaceRef {
+			ref := i.GetOrCreateInterfaceRef()
+			ref.SetInterface(intf)
+			ref.SetSubinterface(sub)
+		}
+	}
+	i.GetOrCreateInput().GetOrCreateSchedulerPolicy().SetName(policy)
+}
+
+// AddOutputClassifier binds the classifier classifier as the output
+// classifier of type typ of interface intf, which remarks the packets sent by
+// the interface.
+func (b *Builder) AddOutputClassifier(intf string, typ oc.E_Input_Classifier_Type, classifier string) {
+	b.qosInterface(intf, false).GetOrCreateOutput().GetOrCreateClassifier(typ).SetName(classifier)
+}
+
+// AddOutputSchedulerPolicy binds the scheduler policy policy and the queues
+// as the output of interface intf.
+func (b *Builder) AddOutputSchedulerPolicy(intf, policy string, queues ...string) {
+	output := b.qosInterface(intf, false).GetOrCreateOutput()
+	output.GetOrCreateSchedulerPolicy().SetName(policy)
+	for _, q := range queues {
+		output.GetOrCreateQueue(q)
+	}
+}
+
+// AddOutputQueueManagementProfile sets the queue management profile profile
+// of the output queue queue of interface intf.
+func (b *Builder) AddOutputQueueManagementProfile(intf, queue, profile string) {
+	b.qosInterface(intf, false).GetOrCreateOutput().GetOrCreateQueue(queue).SetQueueManagementProfile(profile)
+}
+
+// sortedKeys returns the sorted keys of m.
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// inputClassifierType maps the input classifier types to the classifier types.
+var inputClassifierType = map[oc.E_Input_Classifier_Type]oc.E_Qos_Classifier_Type{
+	oc.Input_Classifier_Type_IPV4: oc.Qos_Classifier_Type_IPV4,
+	oc.Input_Classifier_Type_IPV6: oc.Qos_Classifier_Type_IPV6,
+	oc.Input_Classifier_Type_MPLS: oc.Qos_Classifier_Type_MPLS,
+}
+
+// validateBinding returns the errors of the classifiers bound to interface
+// intf in direction dir, which maps the bound types to the classifier names.
+func (b *Builder) validateBinding(intf, dir string, names map[oc.E_Input_Classifier_Type]string) []error {
+	var errs []error
+	types := make([]oc.E_Input_Classifier_Type, 0, len(names))
+	for typ := range names {
+		types = append(types, typ)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	for _, typ := range types {
+		name := names[typ]
+		classifier := b.qos.Classifier[name]
+		switch {
+		case classifier == nil:
+			errs = append(errs, fmt.Errorf("interface %s: %s classifier %q does not exist", intf, dir, name))
+		case classifier.GetType() != inputClassifierType[typ]:
+			errs = append(errs, fmt.Errorf("interface %s: %s classifier %s of type %v is bound as type %v", intf, dir, name, classifier.GetType(), typ))
+		}
+	}
+	return errs
+}
+
+// validate returns the errors of the references between the parts of the
+// configuration.
+func (b *Builder) validate() []error {
+	var errs []error
+	q := b.qos
+
+	ids := map[uint8]string{}
+	for _, name := range sortedKeys(q.Queue) {
+		id := q.Queue[name].QueueId
+		if id == nil {
+			continue
+		}
+		if other, ok := ids[*id]; ok {
+			errs = append(errs, fmt.Errorf("queues %s and %s have the same queue ID %d", other, name, *id))
+		}
+		ids[*id] = name
+	}
+
+	for _, name := range sortedKeys(q.QueueManagementProfile) {
+		u := q.QueueManagementProfile[name].GetWred().GetUniform()
+		if u == nil {
+			continue
+		}
+		if u.GetMinThreshold() > u.GetMaxThreshold() {
+			errs = append(errs, fmt.Errorf("queue management profile %s: min threshold %d is above max threshold %d", name, u.GetMinThreshold(), u.GetMaxThreshold()))
+		}
+		if u.GetMaxDropProbabilityPercent() > maxPercent {
+			errs = append(errs, fmt.Errorf("queue management profile %s: invalid max drop probability %d%%", name, u.GetMaxDropProbabilityPercent()))
+		}
+	}
+
+	for _, name := range sortedKeys(q.ForwardingGroup) {
+		if queue := q.ForwardingGroup[name].GetOutputQueue(); q.Queue[queue] == nil {
+			errs = append(errs, fmt.Errorf("forwarding group %s: output queue %s does not exist", name, queue))
+		}
+	}
+
+	for _, name := range sortedKeys(q.Classifier) {
+		c := q.Classifier[name]
+		seen := map[uint8]string{}
+		for _, id := range sortedKeys(c.Term) {
+			term := c.Term[id]
+			actions := term.GetActions()
+			remark := actions.GetRemark()
+			switch group := actions.TargetGroup; {
+			case group == nil && remark == nil:
+				errs = append(errs, fmt.Errorf("classifier %s term %s: neither a target group nor a remark", name, id))
+			case group != nil && q.ForwardingGroup[*group] == nil:
+				errs = append(errs, fmt.Errorf("classifier %s term %s: target group %q does not exist", name, id, *group))
+			}
+			if d := remark.GetSetDscp(); d > maxDSCP {
+				errs = append(errs, fmt.Errorf("classifier %s term %s: invalid remark DSCP %d", name, id, d))
+			}
+			if tc := remark.GetSetMplsTc(); tc > maxTrafficClass {
+				errs = append(errs, fmt.Errorf("classifier %s term %s: invalid remark traffic class %d", name, id, tc))
+			}
+			if c.GetType() == oc.Qos_Classifier_Type_MPLS {
+				tc := term.GetConditions().GetMpls().GetTrafficClass()
+				if tc > maxTrafficClass {
+					errs = append(errs, fmt.Errorf("classifier %s term %s: invalid traffic class %d", name, id, tc))
+					continue
+				}
+				if other, ok := seen[tc]; ok {
+					errs = append(errs, fmt.Errorf("classifier %s: traffic class %d is in terms %s and %s", name, tc, other, id))
+				}
+				seen[tc] = id
+				continue
+			}
+			dscps := term.GetConditions().GetIpv4().GetDscpSet()
+			if c.GetType() == oc.Qos_Classifier_Type_IPV6 {
+				dscps = term.GetConditions().GetIpv6().GetDscpSet()
+			}
+			for _, d := range dscps {
+				if d > maxDSCP {
+					errs = append(errs, fmt.Errorf("classifier %s term %s: invalid DSCP %d", name, id, d))
+					continue
+				}
+				if other, ok := seen[d]; ok {
+					errs = append(errs, fmt.Errorf("classifier %s: DSCP %d is in terms %s and %s", name, d, other, id))
+				}
+				seen[d] = id
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(q.SchedulerPolicy) {
+		p := q.SchedulerPolicy[name]
+		seqs := make([]uint32, 0, len(p.Scheduler))
+		for seq := range p.Scheduler {
+			seqs = append(seqs, seq)
+		}
+		sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+		for _, seq := range seqs {
+			s := p.Scheduler[seq]
+			for _, id := range sortedKeys(s.Input) {
+				if queue := s.Input[id].GetQueue(); q.Queue[queue] == nil {
+					errs = append(errs, fmt.Errorf("scheduler policy %s sequence %d input %s: queue %q does not exist", name, seq, id, queue))
+				}
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(q.Interface) {
+		intf := q.Interface[name]
+		if input := intf.GetInput(); input != nil {
+			names := map[oc.E_Input_Classifier_Type]string{}
+			for typ, c := range input.Classifier {
+				names[typ] = c.GetName()
+			}
+			errs = append(errs, b.validateBinding(name, "input", names)...)
+			if policy := input.SchedulerPolicy; policy != nil && q.SchedulerPolicy[policy.GetName()] == nil {
+				errs = append(errs, fmt.Errorf("interface %s: input scheduler policy %q does not exist", name, policy.GetName()))
+			}
+		}
+		output := intf.GetOutput()
+		if output == nil {
+			continue
+		}
+		names := map[oc.E_Input_Classifier_Type]string{}
+		for typ, c := range output.Classifier {
+			names[typ] = c.GetName()
+		}
+		errs = append(errs, b.validateBinding(name, "output", names)...)
+		if policy := output.SchedulerPolicy; policy != nil && q.SchedulerPolicy[policy.GetName()] == nil {
+			errs = append(errs, fmt.Errorf("interface %s: output scheduler policy %q does not exist", name, policy.GetName()))
+		}
+		for _, queue := range sortedKeys(output.Queue) {
+			if q.Queue[queue] == nil {
+				errs = append(errs, fmt.Errorf("interface %s: output queue %s does not exist", name, queue))
+			}
+			if profile := output.Queue[queue].QueueManagementProfile; profile != nil && q.QueueManagementProfile[*profile] == nil {
+				errs = append(errs, fmt.Errorf("interface %s output queue %s: queue management profile %q does not exist", name, queue, *profile))
+			}
+		}
+	}
+	return errs
+}
+
+// Build returns the QoS configuration, or the errors of the parts and of the
+// references between them.
+func (b *Builder) Build() (*oc.Qos, error) {
+	errs := append(append([]error(nil), b.errs...), b.validate()...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return b.qos, nil
+}
+
+// Push builds the QoS configuration and replaces the QoS configuration of dut
+// with it.
+func (b *Builder) Push(t testing.TB, dut *ondatra.DUTDevice) *oc.Qos {
+	t.Helper()
+	q, err := b.Build()
+	if err != nil {
+		t.Fatalf("Invalid QoS configuration: %v", err)
+	}
+	gnmi.Replace(t, dut, gnmi.OC().Qos().Config(), q)
+	return q
+}
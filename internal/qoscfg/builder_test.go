@@ -0,0 +1,391 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qoscfg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+)
+
+func newTestBuilder() *Builder {
+	return &Builder{qos: &oc.Qos{}, interfaceRef: true, subinterfaceRef: true, wredWeight: true}
+}
+
+// addValid adds a valid configuration with two queues to b.
+func addValid(b *Builder) {
+	b.AddQueue("BE1", 1)
+	b.AddQueue("NC1", 2)
+	b.AddForwardingGroup("target-group-BE1", "BE1")
+	b.AddForwardingGroup("target-group-NC1", "NC1")
+	b.AddClassifier("dscp_ipv4", oc.Qos_Classifier_Type_IPV4,
+		ClassifierTerm{ID: "0", TargetGroup: "target-group-BE1", DSCP: []uint8{0, 1}},
+		ClassifierTerm{ID: "1", TargetGroup: "target-group-NC1", DSCP: []uint8{48}},
+	)
+	b.AddScheduler("scheduler", 0, oc.Scheduler_Priority_STRICT, SchedulerInput{ID: "NC1", Queue: "NC1", Weight: 100})
+	b.AddScheduler("scheduler", 1, oc.Scheduler_Priority_UNSET, SchedulerInput{ID: "BE1", Queue: "BE1", Weight: 1})
+	b.AddShaper("scheduler", 1, 1000000000, 100000)
+	b.AddInputClassifier("port1", oc.Input_Classifier_Type_IPV4, "dscp_ipv4")
+	b.AddOutputSchedulerPolicy("port2", "scheduler", "BE1", "NC1")
+	b.AddWREDProfile("ecn", WREDProfile{MinThreshold: 80000, MaxThreshold: 160000, MaxDropProbabilityPercent: 50, ECN: true, Weight: 2})
+	b.AddOutputQueueManagementProfile("port2", "BE1", "ecn")
+}
+
+func TestBuild(t *testing.T) {
+	b := newTestBuilder()
+	addValid(b)
+	q, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	if err := q.Validate(); err != nil {
+		t.Errorf("Build() returned an invalid oc.Qos: %v", err)
+	}
+	if got := q.GetQueue("NC1").GetQueueId(); got != 2 {
+		t.Errorf("Queue ID of NC1: got %d, want 2", got)
+	}
+	if got := q.GetClassifier("dscp_ipv4").GetTerm("1").GetConditions().GetIpv4().GetDscpSet(); len(got) != 1 || got[0] != 48 {
+		t.Errorf("DSCP set of term 1: got %v, want [48]", got)
+	}
+	ref := q.GetInterface("port1").GetInterfaceRef()
+	if ref.GetInterface() != "port1" || ref.Subinterface == nil {
+		t.Errorf("Interface ref of the input interface: got %v, want port1 subinterface 0", ref)
+	}
+	if ref := q.GetInterface("port2").GetInterfaceRef(); ref.Subinterface != nil {
+		t.Errorf("Interface ref of the output interface: got subinterface %d, want none", ref.GetSubinterface())
+	}
+	if got := q.GetSchedulerPolicy("scheduler").GetScheduler(0).GetInput("NC1").GetInputType(); got != oc.Input_InputType_QUEUE {
+		t.Errorf("Input type of scheduler input NC1: got %v, want QUEUE", got)
+	}
+	shaper := q.GetSchedulerPolicy("scheduler").GetScheduler(1).GetOneRateTwoColor()
+	if shaper.GetCir() != 1000000000 || shaper.GetBc() != 100000 || shaper.GetQueuingBehavior() != oc.Qos_QueueBehavior_SHAPE {
+		t.Errorf("Shaper of scheduler 1: got %+v, want a 1Gbps shaper with a 100000 byte burst", shaper)
+	}
+	u := q.GetQueueManagementProfile("ecn").GetWred().GetUniform()
+	if !u.GetEnableEcn() || u.GetMaxThreshold() != 160000 || u.GetWeight() != 2 {
+		t.Errorf("WRED of profile ecn: got %+v, want ECN enabled, max threshold 160000 and weight 2", u)
+	}
+	if got := q.GetInterface("port2").GetOutput().GetQueue("BE1").GetQueueManagementProfile(); got != "ecn" {
+		t.Errorf("Queue management profile of output queue BE1: got %q, want \"ecn\"", got)
+	}
+}
+
+func TestBuildWREDWeight(t *testing.T) {
+	b := newTestBuilder()
+	b.wredWeight = false
+	addValid(b)
+	q, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	if w := q.GetQueueManagementProfile("ecn").GetWred().GetUniform().Weight; w != nil {
+		t.Errorf("WRED weight: got %d, want none", *w)
+	}
+}
+
+func TestBuildInterfaceRef(t *testing.T) {
+	b := newTestBuilder()
+	b.interfaceRef = false
+	addValid(b)
+	q, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	for _, name := range []string{"port1", "port2"} {
+		if ref := q.GetInterface(name).InterfaceRef; ref != nil {
+			t.Errorf("Interface ref of %s: got %v, want none", name, ref)
+		}
+	}
+}
+
+func TestBuildRemark(t *testing.T) {
+	b := newTestBuilder()
+	addValid(b)
+	b.AddClassifier("remark_ipv4", oc.Qos_Classifier_Type_IPV4, ClassifierTerm{ID: "0", DSCP: []uint8{0}, SetDSCP: ygot.Uint8(8)})
+	b.AddClassifier("exp", oc.Qos_Classifier_Type_MPLS,
+		ClassifierTerm{ID: "0", TargetGroup: "target-group-BE1", TrafficClass: 0},
+		ClassifierTerm{ID: "6", TargetGroup: "target-group-NC1", TrafficClass: 6, SetMPLSTC: ygot.Uint8(7)},
+	)
+	b.AddInputClassifier("port1", oc.Input_Classifier_Type_MPLS, "exp")
+	b.AddOutputClassifier("port3", oc.Input_Classifier_Type_IPV4, "remark_ipv4")
+	q, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	if err := q.Validate(); err != nil {
+		t.Errorf("Build() returned an invalid oc.Qos: %v", err)
+	}
+	term := q.GetClassifier("remark_ipv4").GetTerm("0")
+	if got := term.GetActions().GetRemark().GetSetDscp(); got != 8 {
+		t.Errorf("Remark DSCP of term 0: got %d, want 8", got)
+	}
+	if group := term.GetActions().TargetGroup; group != nil {
+		t.Errorf("Target group of term 0: got %q, want none", *group)
+	}
+	term = q.GetClassifier("exp").GetTerm("6")
+	if got := term.GetConditions().GetMpls().GetTrafficClass(); got != 6 {
+		t.Errorf("Traffic class of term 6: got %d, want 6", got)
+	}
+	if got := term.GetActions().GetRemark().GetSetMplsTc(); got != 7 {
+		t.Errorf("Remark traffic class of term 6: got %d, want 7", got)
+	}
+	if got := q.GetInterface("port3").GetOutput().GetClassifier(oc.Input_Classifier_Type_IPV4).GetName(); got != "remark_ipv4" {
+		t.Errorf("Output classifier of port3: got %q, want \"remark_ipv4\"", got)
+	}
+}
+
+func TestBuildPolicer(t *testing.T) {
+	b := newTestBuilder()
+	addValid(b)
+	b.AddPolicer("drop", 1, Policer{CIR: 1000000000, BC: 100000})
+	b.AddPolicer("remark", 1, Policer{CIR: 1000000000, BC: 100000, ExceedDSCP: ygot.Uint8(8)})
+	b.AddInputSchedulerPolicy("port1", 100, "drop")
+	b.AddInputSchedulerPolicy("port3", 0, "remark")
+	q, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	if err := q.Validate(); err != nil {
+		t.Errorf("Build() returned an invalid oc.Qos: %v", err)
+	}
+	policer := q.GetSchedulerPolicy("drop").GetScheduler(1).GetOneRateTwoColor()
+	if policer.GetCir() != 1000000000 || policer.GetQueuingBehavior() != oc.Qos_QueueBehavior_POLICE || !policer.GetExceedAction().GetDrop() {
+		t.Errorf("Policer of scheduler policy drop: got %+v, want a 1Gbps policer dropping the exceeding packets", policer)
+	}
+	exceed := q.GetSchedulerPolicy("remark").GetScheduler(1).GetOneRateTwoColor().GetExceedAction()
+	if exceed.GetDrop() || exceed.GetSetDscp() != 8 {
+		t.Errorf("Exceed action of scheduler policy remark: got %+v, want DSCP 8", exceed)
+	}
+	i := q.GetInterface("port1.100")
+	if ref := i.GetInterfaceRef(); ref.GetInterface() != "port1" || ref.GetSubinterface() != 100 {
+		t.Errorf("Interface ref of port1.100: got %v, want port1 subinterface 100", ref)
+	}
+	if got := i.GetInput().GetSchedulerPolicy().GetName(); got != "drop" {
+		t.Errorf("Input scheduler policy of port1.100: got %q, want \"drop\"", got)
+	}
+	if got := q.GetInterface("port3").GetInput().GetSchedulerPolicy().GetName(); got != "remark" {
+		t.Errorf("Input scheduler policy of port3: got %q, want \"remark\"", got)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		add     func(b *Builder)
+		wantErr string
+	}{{
+		desc: "duplicate queue ID",
+		add: func(b *Builder) {
+			b.AddQueue("AF1", 2)
+		},
+		wantErr: "same queue ID 2",
+	}, {
+		desc: "conflicting queue ID",
+		add: func(b *Builder) {
+			b.AddQueue("BE1", 3)
+		},
+		wantErr: "queue ID 3 conflicts",
+	}, {
+		desc: "missing target group",
+		add: func(b *Builder) {
+			b.AddClassifier("dscp_ipv4", oc.Qos_Classifier_Type_IPV4, ClassifierTerm{ID: "2", TargetGroup: "target-group-AF1", DSCP: []uint8{8}})
+		},
+		wantErr: `target group "target-group-AF1" does not exist`,
+	}, {
+		desc: "duplicate DSCP",
+		add: func(b *Builder) {
+			b.AddClassifier("dscp_ipv4", oc.Qos_Classifier_Type_IPV4, ClassifierTerm{ID: "2", TargetGroup: "target-group-BE1", DSCP: []uint8{1}})
+		},
+		wantErr: "DSCP 1 is in terms 0 and 2",
+	}, {
+		desc: "invalid DSCP",
+		add: func(b *Builder) {
+			b.AddClassifier("dscp_ipv4", oc.Qos_Classifier_Type_IPV4, ClassifierTerm{ID: "2", TargetGroup: "target-group-BE1", DSCP: []uint8{64}})
+		},
+		wantErr: "invalid DSCP 64",
+	}, {
+		desc: "duplicate term",
+		add: func(b *Builder) {
+			b.AddClassifier("dscp_ipv4", oc.Qos_Classifier_Type_IPV4, ClassifierTerm{ID: "1", TargetGroup: "target-group-BE1"})
+		},
+		wantErr: "classifier dscp_ipv4",
+	}, {
+		desc: "term without action",
+		add: func(b *Builder) {
+			b.AddClassifier("dscp_ipv4", oc.Qos_Classifier_Type_IPV4, ClassifierTerm{ID: "2", DSCP: []uint8{8}})
+		},
+		wantErr: "neither a target group nor a remark",
+	}, {
+		desc: "invalid remark DSCP",
+		add: func(b *Builder) {
+			b.AddClassifier("dscp_ipv4", oc.Qos_Classifier_Type_IPV4, ClassifierTerm{ID: "2", DSCP: []uint8{8}, SetDSCP: ygot.Uint8(64)})
+		},
+		wantErr: "invalid remark DSCP 64",
+	}, {
+		desc: "invalid remark traffic class",
+		add: func(b *Builder) {
+			b.AddClassifier("dscp_ipv4", oc.Qos_Classifier_Type_IPV4, ClassifierTerm{ID: "2", DSCP: []uint8{8}, SetMPLSTC: ygot.Uint8(8)})
+		},
+		wantErr: "invalid remark traffic class 8",
+	}, {
+		desc: "duplicate traffic class",
+		add: func(b *Builder) {
+			b.AddClassifier("exp", oc.Qos_Classifier_Type_MPLS,
+				ClassifierTerm{ID: "0", TargetGroup: "target-group-BE1", TrafficClass: 1},
+				ClassifierTerm{ID: "1", TargetGroup: "target-group-NC1", TrafficClass: 1},
+			)
+		},
+		wantErr: "traffic class 1 is in terms 0 and 1",
+	}, {
+		desc: "invalid traffic class",
+		add: func(b *Builder) {
+			b.AddClassifier("exp", oc.Qos_Classifier_Type_MPLS, ClassifierTerm{ID: "0", TargetGroup: "target-group-BE1", TrafficClass: 8})
+		},
+		wantErr: "invalid traffic class 8",
+	}, {
+		desc: "conflicting classifier type",
+		add: func(b *Builder) {
+			b.AddClassifier("dscp_ipv4", oc.Qos_Classifier_Type_IPV6)
+		},
+		wantErr: "conflicts with IPV4",
+	}, {
+		desc: "unsupported classifier type",
+		add: func(b *Builder) {
+			b.AddClassifier("ethernet", oc.Qos_Classifier_Type_ETHERNET)
+		},
+		wantErr: "unsupported type ETHERNET",
+	}, {
+		desc: "missing scheduler queue",
+		add: func(b *Builder) {
+			b.AddScheduler("scheduler", 1, oc.Scheduler_Priority_UNSET, SchedulerInput{ID: "AF1", Queue: "AF1", Weight: 4})
+		},
+		wantErr: `queue "AF1" does not exist`,
+	}, {
+		desc: "conflicting scheduler priority",
+		add: func(b *Builder) {
+			b.AddScheduler("scheduler", 1, oc.Scheduler_Priority_STRICT)
+		},
+		wantErr: "priority STRICT conflicts with UNSET",
+	}, {
+		desc: "shaper without scheduler",
+		add: func(b *Builder) {
+			b.AddShaper("scheduler", 2, 1000, 1000)
+		},
+		wantErr: "shaper of a scheduler which does not exist",
+	}, {
+		desc: "shaper without rate",
+		add: func(b *Builder) {
+			b.AddShaper("scheduler", 1, 0, 1000)
+		},
+		wantErr: "shaper without a rate",
+	}, {
+		desc: "policer of an existing scheduler",
+		add: func(b *Builder) {
+			b.AddPolicer("scheduler", 1, Policer{CIR: 1000})
+		},
+		wantErr: "scheduler already exists",
+	}, {
+		desc: "policer without rate",
+		add: func(b *Builder) {
+			b.AddPolicer("policer", 1, Policer{})
+		},
+		wantErr: "policer without a rate",
+	}, {
+		desc: "invalid exceed DSCP",
+		add: func(b *Builder) {
+			b.AddPolicer("policer", 1, Policer{CIR: 1000, ExceedDSCP: ygot.Uint8(64)})
+		},
+		wantErr: "invalid exceed DSCP 64",
+	}, {
+		desc: "missing input scheduler policy",
+		add: func(b *Builder) {
+			b.AddInputSchedulerPolicy("port1", 100, "policer")
+		},
+		wantErr: `interface port1.100: input scheduler policy "policer" does not exist`,
+	}, {
+		desc: "missing input classifier",
+		add: func(b *Builder) {
+			b.AddInputClassifier("port1", oc.Input_Classifier_Type_IPV6, "dscp_ipv6")
+		},
+		wantErr: `input classifier "dscp_ipv6" does not exist`,
+	}, {
+		desc: "input classifier type mismatch",
+		add: func(b *Builder) {
+			b.AddInputClassifier("port3", oc.Input_Classifier_Type_IPV6, "dscp_ipv4")
+		},
+		wantErr: "is bound as type IPV6",
+	}, {
+		desc: "missing output classifier",
+		add: func(b *Builder) {
+			b.AddOutputClassifier("port2", oc.Input_Classifier_Type_IPV4, "remark_ipv4")
+		},
+		wantErr: `output classifier "remark_ipv4" does not exist`,
+	}, {
+		desc: "output classifier type mismatch",
+		add: func(b *Builder) {
+			b.AddOutputClassifier("port2", oc.Input_Classifier_Type_MPLS, "dscp_ipv4")
+		},
+		wantErr: "output classifier dscp_ipv4 of type IPV4 is bound as type MPLS",
+	}, {
+		desc: "missing output scheduler policy",
+		add: func(b *Builder) {
+			b.AddOutputSchedulerPolicy("port3", "other")
+		},
+		wantErr: `output scheduler policy "other" does not exist`,
+	}, {
+		desc: "duplicate WRED profile",
+		add: func(b *Builder) {
+			b.AddWREDProfile("ecn", WREDProfile{})
+		},
+		wantErr: "profile ecn already exists",
+	}, {
+		desc: "WRED thresholds",
+		add: func(b *Builder) {
+			b.AddWREDProfile("drop", WREDProfile{MinThreshold: 2, MaxThreshold: 1})
+		},
+		wantErr: "min threshold 2 is above max threshold 1",
+	}, {
+		desc: "WRED drop probability",
+		add: func(b *Builder) {
+			b.AddWREDProfile("drop", WREDProfile{MaxDropProbabilityPercent: 101})
+		},
+		wantErr: "invalid max drop probability 101%",
+	}, {
+		desc: "missing queue management profile",
+		add: func(b *Builder) {
+			b.AddOutputQueueManagementProfile("port2", "NC1", "drop")
+		},
+		wantErr: `queue management profile "drop" does not exist`,
+	}, {
+		desc: "missing output queue",
+		add: func(b *Builder) {
+			b.qos.GetInterface("port2").GetOutput().GetOrCreateQueue("AF2")
+		},
+		wantErr: "output queue AF2 does not exist",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			b := newTestBuilder()
+			addValid(b)
+			tt.add(b)
+			_, err := b.Build()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Build() got error %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
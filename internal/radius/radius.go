@@ -0,0 +1,439 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package radius provides a RADIUS server, RFC 2865 and RFC 2866, which runs
+// on the test host, or in a container reachable by the DUT, and serves the
+// authentication and accounting requests of the DUT for a set of users.
+//
+// The server supports PAP authentication and accounting, on a single UDP
+// port, which it records so that tests can assert the requests of the DUT.
+// It may be made silent, to emulate a server which times out. Typical usage
+// looks like:
+//
+//	s, err := radius.Listen(":1812", secret, map[string]radius.User{"fp-user": {Password: "..."}})
+//	if err != nil {
+//	  t.Fatal(err)
+//	}
+//	defer s.Close()
+//	... configure the DUT with the RADIUS server on the port of s, and log in ...
+//	r, err := s.Await(ctx, func(r *radius.Record) bool {
+//	  return r.Code == radius.AccessRequest && r.User == "fp-user"
+//	})
+package radius
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Code is the code of a RADIUS packet.
+type Code uint8
+
+const (
+	// AccessRequest is the code of authentication requests.
+	AccessRequest Code = 1
+	// AccessAccept is the code of authentication acceptances.
+	AccessAccept Code = 2
+	// AccessReject is the code of authentication rejections.
+	AccessReject Code = 3
+	// AccountingRequest is the code of accounting requests.
+	AccountingRequest Code = 4
+	// AccountingResponse is the code of accounting responses.
+	AccountingResponse Code = 5
+)
+
+// String returns the name of c.
+func (c Code) String() string {
+	switch c {
+	case AccessRequest:
+		return "Access-Request"
+	case AccessAccept:
+		return "Access-Accept"
+	case AccessReject:
+		return "Access-Reject"
+	case AccountingRequest:
+		return "Accounting-Request"
+	case AccountingResponse:
+		return "Accounting-Response"
+	default:
+		return fmt.Sprintf("Code(%d)", uint8(c))
+	}
+}
+
+// AcctStatusType is the Acct-Status-Type of an accounting request, RFC 2866
+// section 5.1.
+type AcctStatusType uint32
+
+const (
+	// Start marks the start of a session.
+	Start AcctStatusType = 1
+	// Stop marks the end of a session.
+	Stop AcctStatusType = 2
+	// InterimUpdate marks an update of a session.
+	InterimUpdate AcctStatusType = 3
+)
+
+// Attribute types, RFC 2865 section 5, RFC 2866 section 5 and RFC 3579
+// section 3.2.
+const (
+	attrUserName             = 1
+	attrUserPassword         = 2
+	attrNASIPAddress         = 4
+	attrAcctStatusType       = 40
+	attrAcctSessionID        = 44
+	attrMessageAuthenticator = 80
+)
+
+// Packet constants, RFC 2865 section 3.
+const (
+	headerLen        = 20
+	authenticatorLen = 16
+	maxPacketLen     = 4096
+)
+
+// User is a user of the server.
+type User struct {
+	Password string
+}
+
+// Record is a request received by the server.
+type Record struct {
+	Code Code
+	// Client is the address of the RADIUS client, the DUT, and NASIPAddress
+	// the NAS-IP-Address it reports.
+	Client       net.Addr
+	NASIPAddress net.IP
+	User         string
+	// StatusType and SessionID are the Acct-Status-Type and
+	// Acct-Session-Id of accounting requests.
+	StatusType AcctStatusType
+	SessionID  string
+	// Authentic is whether the authenticators of the request verify with
+	// the shared secret of the server. Requests which are not authentic
+	// are silently discarded.
+	Authentic bool
+	// Pass is whether the user is authenticated. Accounting requests pass
+	// if they are authentic.
+	Pass bool
+	// Answered is whether the server responded to the request.
+	Answered bool
+}
+
+// String returns a summary of r.
+func (r *Record) String() string {
+	s := fmt.Sprintf("%v of %q from %v", r.Code, r.User, r.Client)
+	if r.Code == AccountingRequest {
+		s += fmt.Sprintf(" status type %d session %q", r.StatusType, r.SessionID)
+	}
+	return s + fmt.Sprintf(" authentic %t pass %t answered %t", r.Authentic, r.Pass, r.Answered)
+}
+
+// Server is a RADIUS server.
+type Server struct {
+	secret string
+	users  map[string]User
+	conn   net.PacketConn
+	done   chan struct{}
+
+	mu       sync.Mutex
+	silent   bool
+	records  []*Record
+	received chan struct{} // Closed and replaced when a request is recorded.
+	resets   int           // Number of calls to Reset.
+}
+
+// Listen starts a RADIUS server on the UDP address addr, such as ":1812",
+// which shares secret with its clients and serves users by name. The port of
+// addr may be 0 to pick any available port. The server serves both
+// authentication and accounting on the port.
+func Listen(addr, secret string, users map[string]User) (*Server, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for RADIUS on %s: %w", addr, err)
+	}
+	s := &Server{
+		secret:   secret,
+		users:    users,
+		conn:     conn,
+		done:     make(chan struct{}),
+		received: make(chan struct{}),
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Port returns the UDP port on which s listens.
+func (s *Server) Port() uint16 {
+	return uint16(s.conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+// Close stops s.
+func (s *Server) Close() error {
+	err := s.conn.Close()
+	<-s.done
+	return err
+}
+
+// SetSilent sets whether s is silent, recording requests without responding
+// to them, so that they time out.
+func (s *Server) SetSilent(silent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silent = silent
+}
+
+// serve serves the requests of s until it is closed.
+func (s *Server) serve() {
+	defer close(s.done)
+	buf := make([]byte, maxPacketLen)
+	for {
+		n, src, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := append([]byte(nil), buf[:n]...)
+		rec, resp := s.handle(req)
+		if rec == nil {
+			continue
+		}
+		rec.Client = src
+		s.mu.Lock()
+		rec.Answered = resp != nil && !s.silent
+		s.mu.Unlock()
+		if rec.Answered {
+			s.conn.WriteTo(resp, src)
+		}
+		s.record(rec)
+	}
+}
+
+// attributes parses the attributes of packet p.
+func attributes(p []byte) (map[uint8][]byte, error) {
+	attrs := make(map[uint8][]byte)
+	for b := p[headerLen:]; len(b) > 0; {
+		if len(b) < 2 || int(b[1]) < 2 || int(b[1]) > len(b) {
+			return nil, errors.New("RADIUS attribute is truncated")
+		}
+		// Only the first instance of an attribute is kept.
+		if _, ok := attrs[b[0]]; !ok {
+			attrs[b[0]] = b[2:b[1]]
+		}
+		b = b[b[1]:]
+	}
+	return attrs, nil
+}
+
+// handle handles the request p, and returns its record and the response, or
+// nil if it is discarded.
+func (s *Server) handle(p []byte) (*Record, []byte) {
+	if len(p) < headerLen {
+		return nil, nil
+	}
+	n := int(binary.BigEndian.Uint16(p[2:4]))
+	if n < headerLen || n > len(p) {
+		return nil, nil
+	}
+	p = p[:n]
+	attrs, err := attributes(p)
+	if err != nil {
+		return nil, nil
+	}
+	rec := &Record{Code: Code(p[0]), User: string(attrs[attrUserName])}
+	if ip := attrs[attrNASIPAddress]; len(ip) == net.IPv4len {
+		rec.NASIPAddress = net.IP(ip)
+	}
+	switch rec.Code {
+	case AccessRequest:
+		return rec, s.access(p, attrs, rec)
+	case AccountingRequest:
+		return rec, s.accounting(p, attrs, rec)
+	default:
+		return nil, nil
+	}
+}
+
+// messageAuthenticator returns the Message-Authenticator of packet p, RFC 3579
+// section 3.2, whose Message-Authenticator attribute must be zeroed, with its
+// authenticator replaced by auth.
+func (s *Server) messageAuthenticator(p, auth []byte) []byte {
+	q := append([]byte(nil), p...)
+	copy(q[4:headerLen], auth)
+	m := hmac.New(md5.New, []byte(s.secret))
+	m.Write(q)
+	return m.Sum(nil)
+}
+
+// verifyMessageAuthenticator returns whether the Message-Authenticator of the
+// request p, if any, verifies with the authenticator auth.
+func (s *Server) verifyMessageAuthenticator(p []byte, attrs map[uint8][]byte, auth []byte) bool {
+	ma, ok := attrs[attrMessageAuthenticator]
+	if !ok {
+		return true
+	}
+	q := append([]byte(nil), p...)
+	off := bytes.Index(q[headerLen:], append([]byte{attrMessageAuthenticator, 18}, ma...))
+	if off < 0 || len(ma) != md5.Size {
+		return false
+	}
+	copy(q[headerLen+off+2:], make([]byte, md5.Size))
+	return hmac.Equal(ma, s.messageAuthenticator(q, auth))
+}
+
+// access handles the Access-Request p with attrs, and returns its response.
+func (s *Server) access(p []byte, attrs map[uint8][]byte, rec *Record) []byte {
+	rec.Authentic = s.verifyMessageAuthenticator(p, attrs, p[4:headerLen])
+	if !rec.Authentic {
+		return nil
+	}
+	u, ok := s.users[rec.User]
+	rec.Pass = ok && s.password(attrs[attrUserPassword], p[4:headerLen]) == u.Password
+	code := AccessReject
+	if rec.Pass {
+		code = AccessAccept
+	}
+	return s.response(code, p, true)
+}
+
+// password returns the password hidden in the User-Password attribute hidden
+// with the request authenticator auth, RFC 2865 section 5.2.
+func (s *Server) password(hidden, auth []byte) string {
+	if len(hidden) == 0 || len(hidden)%md5.Size != 0 {
+		return ""
+	}
+	pw := make([]byte, len(hidden))
+	prev := auth
+	for i := 0; i < len(hidden); i += md5.Size {
+		m := md5.New()
+		m.Write([]byte(s.secret))
+		m.Write(prev)
+		b := m.Sum(nil)
+		for j := 0; j < md5.Size; j++ {
+			pw[i+j] = hidden[i+j] ^ b[j]
+		}
+		prev = hidden[i : i+md5.Size]
+	}
+	return string(bytes.TrimRight(pw, "\x00"))
+}
+
+// accounting handles the Accounting-Request p with attrs, and returns its
+// response.
+func (s *Server) accounting(p []byte, attrs map[uint8][]byte, rec *Record) []byte {
+	if st := attrs[attrAcctStatusType]; len(st) == 4 {
+		rec.StatusType = AcctStatusType(binary.BigEndian.Uint32(st))
+	}
+	rec.SessionID = string(attrs[attrAcctSessionID])
+	// The request authenticator is the MD5 of the request with a zero
+	// authenticator, and the secret, RFC 2866 section 3. So is the
+	// authenticator of its Message-Authenticator, RFC 5080 section 2.2.2.
+	zero := make([]byte, authenticatorLen)
+	q := append([]byte(nil), p...)
+	copy(q[4:headerLen], zero)
+	m := md5.New()
+	m.Write(q)
+	m.Write([]byte(s.secret))
+	rec.Authentic = hmac.Equal(m.Sum(nil), p[4:headerLen]) && s.verifyMessageAuthenticator(p, attrs, zero)
+	if !rec.Authentic {
+		return nil
+	}
+	rec.Pass = true
+	return s.response(AccountingResponse, p, false)
+}
+
+// response returns the response of code to the request p, with a
+// Message-Authenticator if withMA.
+func (s *Server) response(code Code, p []byte, withMA bool) []byte {
+	r := make([]byte, headerLen)
+	r[0], r[1] = uint8(code), p[1]
+	if withMA {
+		r = append(r, attrMessageAuthenticator, 18)
+		r = append(r, make([]byte, md5.Size)...)
+	}
+	binary.BigEndian.PutUint16(r[2:4], uint16(len(r)))
+	if withMA {
+		copy(r[headerLen+2:], s.messageAuthenticator(r, p[4:headerLen]))
+	}
+	// The response authenticator is the MD5 of the response with the
+	// request authenticator, and the secret.
+	copy(r[4:headerLen], p[4:headerLen])
+	m := md5.New()
+	m.Write(r)
+	m.Write([]byte(s.secret))
+	copy(r[4:headerLen], m.Sum(nil))
+	return r
+}
+
+// record records rec.
+func (s *Server) record(rec *Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+	close(s.received)
+	s.received = make(chan struct{})
+}
+
+// Records returns the requests received so far, in order, which match, or all
+// of them if match is nil.
+func (s *Server) Records(match func(*Record) bool) []*Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var recs []*Record
+	for _, r := range s.records {
+		if match == nil || match(r) {
+			recs = append(recs, r)
+		}
+	}
+	return recs
+}
+
+// Reset discards the requests recorded so far.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = nil
+	s.resets++
+}
+
+// Await waits for a recorded request which matches, and returns the first. It
+// returns the error of ctx if it is done before.
+func (s *Server) Await(ctx context.Context, match func(*Record) bool) (*Record, error) {
+	var next, resets int
+	for {
+		s.mu.Lock()
+		recs, received := s.records, s.received
+		if s.resets != resets {
+			next, resets = 0, s.resets
+		}
+		s.mu.Unlock()
+		for _, r := range recs[next:] {
+			if match(r) {
+				return r, nil
+			}
+		}
+		next = len(recs)
+		select {
+		case <-received:
+		case <-s.done:
+			return nil, errors.New("RADIUS server is closed")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
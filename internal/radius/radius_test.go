@@ -0,0 +1,255 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package radius
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	secret   = "fp-radius-secret"
+	user     = "fp-user"
+	password = "fp-Passw0rd!"
+)
+
+var users = map[string]User{user: {Password: password}}
+
+// client is a RADIUS client of a test server.
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	secret string
+	id     uint8
+}
+
+func dial(t *testing.T, s *Server, secret string) *client {
+	t.Helper()
+	conn, err := net.Dial("udp", s.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, secret: secret}
+}
+
+func attr(typ uint8, v []byte) []byte {
+	return append([]byte{typ, uint8(2 + len(v))}, v...)
+}
+
+// hide hides password with the request authenticator auth.
+func (c *client) hide(password string, auth []byte) []byte {
+	pw := []byte(password)
+	pw = append(pw, make([]byte, (md5.Size-len(pw)%md5.Size)%md5.Size)...)
+	prev := auth
+	for i := 0; i < len(pw); i += md5.Size {
+		m := md5.New()
+		m.Write([]byte(c.secret))
+		m.Write(prev)
+		b := m.Sum(nil)
+		for j := 0; j < md5.Size; j++ {
+			pw[i+j] ^= b[j]
+		}
+		prev = pw[i : i+md5.Size]
+	}
+	return pw
+}
+
+// exchange sends the request p, and returns the response, or nil if there is
+// none within a second.
+func (c *client) exchange(p []byte) []byte {
+	c.t.Helper()
+	if _, err := c.conn.Write(p); err != nil {
+		c.t.Fatalf("Write() failed: %v", err)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, maxPacketLen)
+	n, err := c.conn.Read(buf)
+	if err != nil {
+		return nil
+	}
+	return buf[:n]
+}
+
+// packet returns the packet of code with the authenticator auth and attrs.
+func (c *client) packet(code Code, auth []byte, attrs ...[]byte) []byte {
+	c.id++
+	p := append([]byte{uint8(code), c.id, 0, 0}, auth...)
+	for _, a := range attrs {
+		p = append(p, a...)
+	}
+	binary.BigEndian.PutUint16(p[2:4], uint16(len(p)))
+	return p
+}
+
+// access sends an Access-Request of user with password and a
+// Message-Authenticator, and returns the code of the response, or 0 if there
+// is none.
+func (c *client) access(user, password string) Code {
+	c.t.Helper()
+	auth := bytes.Repeat([]byte{0x5a}, authenticatorLen)
+	p := c.packet(AccessRequest, auth,
+		attr(attrUserName, []byte(user)),
+		attr(attrUserPassword, c.hide(password, auth)),
+		attr(attrNASIPAddress, net.IPv4(192, 0, 2, 1).To4()),
+		attr(attrMessageAuthenticator, make([]byte, md5.Size)))
+	m := hmac.New(md5.New, []byte(c.secret))
+	m.Write(p)
+	copy(p[len(p)-md5.Size:], m.Sum(nil))
+	r := c.exchange(p)
+	if r == nil {
+		return 0
+	}
+	// Verify the response authenticator.
+	q := append([]byte(nil), r...)
+	copy(q[4:headerLen], auth)
+	h := md5.New()
+	h.Write(q)
+	h.Write([]byte(c.secret))
+	if !bytes.Equal(h.Sum(nil), r[4:headerLen]) || r[1] != p[1] {
+		c.t.Errorf("Response %x does not match request %x", r, p)
+	}
+	return Code(r[0])
+}
+
+// accounting sends an Accounting-Request of user with status type st, and
+// returns the code of the response, or 0 if there is none.
+func (c *client) accounting(user string, st AcctStatusType) Code {
+	c.t.Helper()
+	stb := make([]byte, 4)
+	binary.BigEndian.PutUint32(stb, uint32(st))
+	p := c.packet(AccountingRequest, make([]byte, authenticatorLen),
+		attr(attrUserName, []byte(user)),
+		attr(attrAcctStatusType, stb),
+		attr(attrAcctSessionID, []byte("session-1")))
+	h := md5.New()
+	h.Write(p)
+	h.Write([]byte(c.secret))
+	copy(p[4:headerLen], h.Sum(nil))
+	r := c.exchange(p)
+	if r == nil {
+		return 0
+	}
+	return Code(r[0])
+}
+
+func listen(t *testing.T) *Server {
+	t.Helper()
+	s, err := Listen("127.0.0.1:0", secret, users)
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestAccess(t *testing.T) {
+	tests := []struct {
+		desc          string
+		user          string
+		password      string
+		secret        string
+		want          Code
+		wantAuthentic bool
+	}{{
+		desc:          "accept",
+		user:          user,
+		password:      password,
+		secret:        secret,
+		want:          AccessAccept,
+		wantAuthentic: true,
+	}, {
+		desc:          "wrong password",
+		user:          user,
+		password:      "wrong",
+		secret:        secret,
+		want:          AccessReject,
+		wantAuthentic: true,
+	}, {
+		desc:          "unknown user",
+		user:          "fp-unknown",
+		password:      password,
+		secret:        secret,
+		want:          AccessReject,
+		wantAuthentic: true,
+	}, {
+		desc:     "secret mismatch",
+		user:     user,
+		password: password,
+		secret:   "fp-wrong-secret",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			s := listen(t)
+			if got := dial(t, s, tt.secret).access(tt.user, tt.password); got != tt.want {
+				t.Errorf("access() got %v, want %v", got, tt.want)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			r, err := s.Await(ctx, func(r *Record) bool { return r.Code == AccessRequest })
+			if err != nil {
+				t.Fatalf("Await() failed: %v", err)
+			}
+			if r.User != tt.user || r.Authentic != tt.wantAuthentic || r.Pass != (tt.want == AccessAccept) || r.Answered != (tt.want != 0) {
+				t.Errorf("Await() got %v, want user %q, authentic %t, response %v", r, tt.user, tt.wantAuthentic, tt.want)
+			}
+			if !r.NASIPAddress.Equal(net.IPv4(192, 0, 2, 1)) {
+				t.Errorf("Await() got NAS-IP-Address %v, want 192.0.2.1", r.NASIPAddress)
+			}
+		})
+	}
+}
+
+func TestAccounting(t *testing.T) {
+	s := listen(t)
+	if got := dial(t, s, secret).accounting(user, Start); got != AccountingResponse {
+		t.Errorf("accounting() got %v, want %v", got, AccountingResponse)
+	}
+	if got := dial(t, s, "fp-wrong-secret").accounting(user, Stop); got != 0 {
+		t.Errorf("accounting() with a wrong secret got %v, want no response", got)
+	}
+	recs := s.Records(func(r *Record) bool { return r.Code == AccountingRequest })
+	if len(recs) != 2 {
+		t.Fatalf("Records() got %v, want 2 accounting requests", recs)
+	}
+	if r := recs[0]; r.StatusType != Start || r.SessionID != "session-1" || !r.Authentic || !r.Answered {
+		t.Errorf("Records() got %v, want the authentic start of session-1", r)
+	}
+	if r := recs[1]; r.StatusType != Stop || r.Authentic || r.Answered {
+		t.Errorf("Records() got %v, want the unanswered, not authentic stop", r)
+	}
+}
+
+func TestSilent(t *testing.T) {
+	s := listen(t)
+	s.SetSilent(true)
+	c := dial(t, s, secret)
+	if got := c.access(user, password); got != 0 {
+		t.Errorf("access() of silent server got %v, want no response", got)
+	}
+	if recs := s.Records(nil); len(recs) != 1 || recs[0].Answered || !recs[0].Pass {
+		t.Errorf("Records() of silent server got %v, want one unanswered request", recs)
+	}
+	s.SetSilent(false)
+	if got := c.access(user, password); got != AccessAccept {
+		t.Errorf("access() got %v, want %v", got, AccessAccept)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/openconfig/featureprofiles/internal/security/gnxi"
 	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
@@ -100,8 +101,20 @@ func (p *AuthorizationPolicy) Marshal() ([]byte, error) {
 	return json.Marshal(p)
 }
 
+type rotateOpt interface {
+	isRotateOpt()
+}
+
+// ProbeBeforeFinalize is passed to Rotate to run Verify after the policy is
+// uploaded but before the rotation is finalized.
+type ProbeBeforeFinalize struct {
+	Verify func(t *testing.T)
+}
+
+func (o *ProbeBeforeFinalize) isRotateOpt() {}
+
 // Rotate apply policy p on device dut, this is test api for positive testing and it fails the test on failure.
-func (p *AuthorizationPolicy) Rotate(t *testing.T, dut *ondatra.DUTDevice, createdOn uint64, version string, forcOverwrite bool) {
+func (p *AuthorizationPolicy) Rotate(t *testing.T, dut *ondatra.DUTDevice, createdOn uint64, version string, forcOverwrite bool, opts ...rotateOpt) {
 	t.Logf("Performing Authz.Rotate request on device %s", dut.Name())
 	gnsiC, err := dut.RawAPIs().BindingDUT().DialGNSI(context.Background())
 	if err != nil {
@@ -138,6 +151,15 @@ func (p *AuthorizationPolicy) Rotate(t *testing.T, dut *ondatra.DUTDevice, creat
 	if !cmp.Equal(p, tempPolicy) {
 		t.Fatalf("Policy after upload (temporary) is not the same as the one upload, diff is: %v", cmp.Diff(p, tempPolicy))
 	}
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *ProbeBeforeFinalize:
+			t.Logf("Verifying policy %s before finalizing the rotation", p.Name)
+			o.Verify(t)
+		default:
+			t.Errorf("Invalid option is passed to Rotate function: %T", opt)
+		}
+	}
 	finalizeRotateReq := &authzpb.RotateAuthzRequest_FinalizeRotation{FinalizeRotation: &authzpb.FinalizeRequest{}}
 	err = rotateStream.Send(&authzpb.RotateAuthzRequest{RotateRequest: finalizeRotateReq})
 	t.Logf("Sending Authz.Rotate FinalizeRotation request: \n%s", prettyPrint(finalizeRotateReq))
@@ -151,6 +173,19 @@ func (p *AuthorizationPolicy) Rotate(t *testing.T, dut *ondatra.DUTDevice, creat
 
 }
 
+// VerifyPolicyInfo checks that device dut reports the version and creation
+// time of the authz policy in use.
+func VerifyPolicyInfo(t testing.TB, dut *ondatra.DUTDevice, version string, createdOn uint64) {
+	t.Helper()
+	authorization := gnmi.OC().System().Aaa().Authorization()
+	if got := gnmi.Get(t, dut, authorization.GrpcAuthzPolicyVersion().State()); got != version {
+		t.Errorf("grpc-authz-policy-version on device %s: got %q, want %q", dut.Name(), got, version)
+	}
+	if got := gnmi.Get(t, dut, authorization.GrpcAuthzPolicyCreatedOn().State()); got != createdOn {
+		t.Errorf("grpc-authz-policy-created-on on device %s: got %d, want %d", dut.Name(), got, createdOn)
+	}
+}
+
 // NewAuthorizationPolicy creates an empty policy.
 func NewAuthorizationPolicy(name string) *AuthorizationPolicy {
 	return &AuthorizationPolicy{
@@ -17,6 +17,7 @@ import (
 	spb "github.com/openconfig/gnoi/system"
 	authzpb "github.com/openconfig/gnsi/authz"
 	grpb "github.com/openconfig/gribi/v1/proto/service"
+	p4pb "github.com/p4lang/p4runtime/go/p4/v1"
 )
 
 // AllRPC implements a sample request for service * to validate if authz works as expected.
@@ -651,8 +652,13 @@ func P4P4runtimeAllRPC(_ context.Context, _ *ondatra.DUTDevice, _ []grpc.DialOpt
 }
 
 // P4P4runtimeCapabilities implements a sample request for service /p4.v1.P4Runtime/Capabilities to validate if authz works as expected.
-func P4P4runtimeCapabilities(_ context.Context, _ *ondatra.DUTDevice, _ []grpc.DialOption, _ ...any) error {
-	return status.Errorf(codes.Unimplemented, "exec function for RPC /p4.v1.P4Runtime/Capabilities is not implemented")
+func P4P4runtimeCapabilities(ctx context.Context, dut *ondatra.DUTDevice, opts []grpc.DialOption, _ ...any) error {
+	p4rtC, err := dut.RawAPIs().BindingDUT().DialP4RT(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = p4rtC.Capabilities(ctx, &p4pb.CapabilitiesRequest{})
+	return err
 }
 
 // P4P4runtimeGetForwardingPipelineConfig implements a sample request for service /p4.v1.P4Runtime/GetForwardingPipelineConfig to validate if authz works as expected.
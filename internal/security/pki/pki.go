@@ -0,0 +1,296 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pki generates ephemeral certificate authorities, certificates and
+// CRLs for tests, so that tests do not depend on checked-in certificates which
+// eventually expire.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	// organization is the subject organization of all generated certificates.
+	organization = "OpenconfigFeatureProfiles"
+	// defaultValidity is the validity of generated certificates unless
+	// specified otherwise.
+	defaultValidity = 24 * time.Hour
+	// backdate is subtracted from the NotBefore time of generated certificates
+	// to allow for clock skew between the test host and the DUT.
+	backdate = time.Hour
+)
+
+// CA is a certificate authority generated for a test.
+type CA struct {
+	// Cert is the certificate of the CA.
+	Cert *x509.Certificate
+	// Key is the private key of the CA.
+	Key crypto.Signer
+	// Parent is the CA which issued Cert, or nil for a root CA.
+	Parent *CA
+
+	algo x509.PublicKeyAlgorithm
+}
+
+// Spec specifies a certificate issued by a CA.
+type Spec struct {
+	// CommonName is the subject common name.
+	CommonName string
+	// SPIFFEID is added as URI SAN if set.
+	SPIFFEID string
+	// DNSNames and IPAddresses are added as SANs.
+	DNSNames    []string
+	IPAddresses []net.IP
+	// ExtKeyUsage defaults to both server and client authentication.
+	ExtKeyUsage []x509.ExtKeyUsage
+	// KeyAlgorithm defaults to the key algorithm of the issuing CA.
+	KeyAlgorithm x509.PublicKeyAlgorithm
+	// NotBefore defaults to one hour ago and NotAfter to one day after
+	// NotBefore plus one hour.
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// generateKey returns a new RSA 2048 or ECDSA P-256 key.
+func generateKey(t testing.TB, algo x509.PublicKeyAlgorithm) crypto.Signer {
+	t.Helper()
+	var key crypto.Signer
+	var err error
+	switch algo {
+	case x509.RSA:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case x509.ECDSA:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		t.Fatalf("Key algorithm %v is not supported", algo)
+	}
+	if err != nil {
+		t.Fatalf("Could not generate %v key: %v", algo, err)
+	}
+	return key
+}
+
+func serialNumber(t testing.TB) *big.Int {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		t.Fatalf("Could not generate serial number: %v", err)
+	}
+	return serial
+}
+
+// create signs tmpl for pub with the key of issuer, or self-signs it with key
+// if issuer is nil.
+func create(t testing.TB, tmpl *x509.Certificate, pub crypto.PublicKey, issuer *CA, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+	parent, signer := tmpl, key
+	if issuer != nil {
+		parent, signer = issuer.Cert, issuer.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		t.Fatalf("Could not create certificate %q: %v", tmpl.Subject.CommonName, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Could not parse certificate %q: %v", tmpl.Subject.CommonName, err)
+	}
+	return cert
+}
+
+func newCA(t testing.TB, commonName string, algo x509.PublicKeyAlgorithm, parent *CA) *CA {
+	t.Helper()
+	key := generateKey(t, algo)
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serialNumber(t),
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{organization}},
+		NotBefore:             now.Add(-backdate),
+		NotAfter:              now.Add(defaultValidity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	return &CA{Cert: create(t, tmpl, key.Public(), parent, key), Key: key, Parent: parent, algo: algo}
+}
+
+// NewCA returns a self-signed root CA with an RSA 2048 or ECDSA P-256 key.
+func NewCA(t testing.TB, commonName string, algo x509.PublicKeyAlgorithm) *CA {
+	t.Helper()
+	return newCA(t, commonName, algo, nil)
+}
+
+// NewIntermediate returns a CA signed by c, with the key algorithm of c.
+func (c *CA) NewIntermediate(t testing.TB, commonName string) *CA {
+	t.Helper()
+	return newCA(t, commonName, c.algo, c)
+}
+
+// Root returns the root CA of c.
+func (c *CA) Root() *CA {
+	for c.Parent != nil {
+		c = c.Parent
+	}
+	return c
+}
+
+// Pool returns a cert pool containing the root CA of c.
+func (c *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.Root().Cert)
+	return pool
+}
+
+// Issue returns a certificate issued by c according to spec. The chain of the
+// returned certificate includes the intermediate CAs up to, but excluding,
+// the root CA.
+func (c *CA) Issue(t testing.TB, spec Spec) *tls.Certificate {
+	t.Helper()
+	algo := spec.KeyAlgorithm
+	if algo == x509.UnknownPublicKeyAlgorithm {
+		algo = c.algo
+	}
+	key := generateKey(t, algo)
+	notBefore := spec.NotBefore
+	if notBefore.IsZero() {
+		notBefore = time.Now().Add(-backdate)
+	}
+	notAfter := spec.NotAfter
+	if notAfter.IsZero() {
+		notAfter = notBefore.Add(backdate + defaultValidity)
+	}
+	extKeyUsage := spec.ExtKeyUsage
+	if len(extKeyUsage) == 0 {
+		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serialNumber(t),
+		Subject:      pkix.Name{CommonName: spec.CommonName, Organization: []string{organization}},
+		DNSNames:     spec.DNSNames,
+		IPAddresses:  spec.IPAddresses,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  extKeyUsage,
+	}
+	if spec.SPIFFEID != "" {
+		uri, err := url.Parse(spec.SPIFFEID)
+		if err != nil {
+			t.Fatalf("Could not parse SPIFFE ID %q: %v", spec.SPIFFEID, err)
+		}
+		tmpl.URIs = []*url.URL{uri}
+	}
+	leaf := create(t, tmpl, key.Public(), c, nil)
+
+	chain := [][]byte{leaf.Raw}
+	for ca := c; ca.Parent != nil; ca = ca.Parent {
+		chain = append(chain, ca.Cert.Raw)
+	}
+	return &tls.Certificate{Certificate: chain, PrivateKey: key, Leaf: leaf}
+}
+
+// CRL returns a PEM encoded CRL signed by c which revokes the given
+// certificates.
+func (c *CA) CRL(t testing.TB, revoked ...*x509.Certificate) []byte {
+	t.Helper()
+	now := time.Now()
+	var entries []x509.RevocationListEntry
+	for _, cert := range revoked {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: cert.SerialNumber, RevocationTime: now})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(now.UnixNano()),
+		ThisUpdate:                now.Add(-backdate),
+		NextUpdate:                now.Add(defaultValidity),
+		RevokedCertificateEntries: entries,
+	}, c.Cert, c.Key)
+	if err != nil {
+		t.Fatalf("Could not create CRL of %q: %v", c.Cert.Subject.CommonName, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+// CertPEM returns the PEM encoding of cert.
+func CertPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// ChainPEM returns the PEM encoding of the chain of cert, leaf first.
+func ChainPEM(cert *tls.Certificate) []byte {
+	var b []byte
+	for _, der := range cert.Certificate {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return b
+}
+
+// KeyPEM returns the PKCS #8 PEM encoding of key.
+func KeyPEM(t testing.TB, key crypto.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Could not marshal private key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// PublicKeyPEM returns the PKIX PEM encoding of the public key of key.
+func PublicKeyPEM(t testing.TB, key crypto.Signer) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("Could not marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// WriteFiles writes the PEM encoded chain and private key of cert to
+// name.cert.pem and name.key.pem in a temporary directory of the test, for
+// APIs which load credentials from files. It returns the file paths.
+func WriteFiles(t testing.TB, name string, cert *tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, name+".cert.pem")
+	keyFile = filepath.Join(dir, name+".key.pem")
+	if err := os.WriteFile(certFile, ChainPEM(cert), 0600); err != nil {
+		t.Fatalf("Could not write %s: %v", certFile, err)
+	}
+	if err := os.WriteFile(keyFile, KeyPEM(t, cert.PrivateKey), 0600); err != nil {
+		t.Fatalf("Could not write %s: %v", keyFile, err)
+	}
+	return certFile, keyFile
+}
+
+// WriteFiles writes the PEM encoded certificate and private key of c to
+// files as WriteFiles does.
+func (c *CA) WriteFiles(t testing.TB, name string) (certFile, keyFile string) {
+	t.Helper()
+	return WriteFiles(t, name, &tls.Certificate{Certificate: [][]byte{c.Cert.Raw}, PrivateKey: c.Key, Leaf: c.Cert})
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	for _, algo := range []x509.PublicKeyAlgorithm{x509.RSA, x509.ECDSA} {
+		t.Run(algo.String(), func(t *testing.T) {
+			root := NewCA(t, "root", algo)
+			inter := root.NewIntermediate(t, "intermediate")
+			cert := inter.Issue(t, Spec{
+				CommonName:  "dut",
+				SPIFFEID:    "spiffe://test.example/dut",
+				DNSNames:    []string{"dut.example"},
+				IPAddresses: []net.IP{net.ParseIP("192.0.2.1")},
+			})
+
+			if got := cert.Leaf.PublicKeyAlgorithm; got != algo {
+				t.Errorf("PublicKeyAlgorithm: got %v, want %v", got, algo)
+			}
+			if got, want := len(cert.Certificate), 2; got != want {
+				t.Errorf("Chain length: got %d, want %d", got, want)
+			}
+			if got := len(cert.Leaf.URIs); got != 1 || cert.Leaf.URIs[0].String() != "spiffe://test.example/dut" {
+				t.Errorf("URIs: got %v, want [spiffe://test.example/dut]", cert.Leaf.URIs)
+			}
+			if !time.Now().After(cert.Leaf.NotBefore) || !time.Now().Before(cert.Leaf.NotAfter) {
+				t.Errorf("Certificate not valid now: NotBefore %v, NotAfter %v", cert.Leaf.NotBefore, cert.Leaf.NotAfter)
+			}
+
+			intermediates := x509.NewCertPool()
+			intermediates.AddCert(inter.Cert)
+			for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+				if _, err := cert.Leaf.Verify(x509.VerifyOptions{
+					DNSName:       "dut.example",
+					Roots:         inter.Pool(),
+					Intermediates: intermediates,
+					KeyUsages:     []x509.ExtKeyUsage{usage},
+				}); err != nil {
+					t.Errorf("Verify(%v): %v", usage, err)
+				}
+			}
+			if _, err := cert.Leaf.Verify(x509.VerifyOptions{Roots: NewCA(t, "other", algo).Pool(), Intermediates: intermediates}); err == nil {
+				t.Errorf("Verify with unrelated root: got success, want error")
+			}
+		})
+	}
+}
+
+func TestIssueExpired(t *testing.T) {
+	ca := NewCA(t, "root", x509.ECDSA)
+	cert := ca.Issue(t, Spec{
+		CommonName: "expired",
+		NotBefore:  time.Now().Add(-48 * time.Hour),
+		NotAfter:   time.Now().Add(-24 * time.Hour),
+	})
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{Roots: ca.Pool()}); err == nil {
+		t.Errorf("Verify of expired certificate: got success, want error")
+	}
+}
+
+func TestCRL(t *testing.T) {
+	ca := NewCA(t, "root", x509.ECDSA)
+	revoked := ca.Issue(t, Spec{CommonName: "revoked"})
+	valid := ca.Issue(t, Spec{CommonName: "valid"})
+
+	block, _ := pem.Decode(ca.CRL(t, revoked.Leaf))
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatalf("CRL is not a PEM encoded X509 CRL: %v", block)
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseRevocationList: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Errorf("CRL signature: %v", err)
+	}
+	serials := map[string]bool{}
+	for _, e := range crl.RevokedCertificateEntries {
+		serials[e.SerialNumber.String()] = true
+	}
+	if !serials[revoked.Leaf.SerialNumber.String()] {
+		t.Errorf("CRL does not revoke %q", revoked.Leaf.Subject.CommonName)
+	}
+	if serials[valid.Leaf.SerialNumber.String()] {
+		t.Errorf("CRL revokes %q", valid.Leaf.Subject.CommonName)
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	ca := NewCA(t, "root", x509.RSA)
+	cert := ca.NewIntermediate(t, "intermediate").Issue(t, Spec{CommonName: "client"})
+
+	certFile, keyFile := WriteFiles(t, "client", cert)
+	loaded, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadX509KeyPair: %v", err)
+	}
+	if got, want := len(loaded.Certificate), len(cert.Certificate); got != want {
+		t.Errorf("Loaded chain length: got %d, want %d", got, want)
+	}
+
+	caCertFile, caKeyFile := ca.WriteFiles(t, "ca")
+	if _, err := tls.LoadX509KeyPair(caCertFile, caKeyFile); err != nil {
+		t.Errorf("LoadX509KeyPair of CA: %v", err)
+	}
+}
@@ -8,14 +8,13 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/openconfig/featureprofiles/internal/security/pki"
 	"github.com/openconfig/gnmi/errdiff"
 )
 
 func TestGenRSASVID(t *testing.T) {
 	tests := []struct {
 		name         string
-		caCert       string
-		caKey        string
 		commonName   string
 		spiffeID     string
 		errStr       string
@@ -28,8 +27,6 @@ func TestGenRSASVID(t *testing.T) {
 			spiffeID:     "spiffe://test-abc.foo.bar/xyz/admin",
 			errStr:       "",
 			keyAlgorithm: x509.RSA,
-			caKey:        "testdata/rsa/ca-rsa-key.pem",
-			caCert:       "testdata/rsa/ca-rsa-cert.pem",
 			uris: []*url.URL{
 				{
 					Scheme: "spiffe",
@@ -44,8 +41,6 @@ func TestGenRSASVID(t *testing.T) {
 			spiffeID:     "spiffe://test-abc.foo.bar/xyz/admin",
 			errStr:       "",
 			keyAlgorithm: x509.ECDSA,
-			caKey:        "testdata/ecdsa/ca-ecdsa-key.pem",
-			caCert:       "testdata/ecdsa/ca-ecdsa-cert.pem",
 			uris: []*url.URL{
 				{
 					Scheme: "spiffe",
@@ -58,7 +53,8 @@ func TestGenRSASVID(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			caPrivateKey, CACert, err := LoadKeyPair(test.caKey, test.caCert)
+			caCertFile, caKeyFile := pki.NewCA(t, "ca", test.keyAlgorithm).WriteFiles(t, "ca")
+			caPrivateKey, CACert, err := LoadKeyPair(caKeyFile, caCertFile)
 			if err != nil {
 				t.Fatalf("Unexpected Error, %v", err)
 			}
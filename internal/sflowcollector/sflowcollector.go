@@ -0,0 +1,528 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sflowcollector provides an sFlow collector, which runs on the test
+// host, or in a container reachable by the DUT, and receives the sFlow
+// version 5 datagrams of the DUT over UDP.
+//
+// The flow samples and the counter samples of the datagrams are decoded, so
+// that tests can assert their sampling rate and interfaces. Typical usage
+// looks like:
+//
+//	c, err := sflowcollector.Listen(":6343")
+//	if err != nil {
+//	  t.Fatal(err)
+//	}
+//	defer c.Close()
+//	... configure the DUT to export sFlow to the port of c, and send traffic ...
+//	samples := c.FlowSamples(func(s *sflowcollector.FlowSample) bool {
+//	  return s.Input == inIndex
+//	})
+package sflowcollector
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	version         = 5
+	maxDatagramSize = 65535
+
+	// Address types of the agent and of the next hop.
+	addressIPv4 = 1
+	addressIPv6 = 2
+
+	// Standard formats of the samples.
+	formatFlowSample            = 1
+	formatCounterSample         = 2
+	formatExpandedFlowSample    = 3
+	formatExpandedCounterSample = 4
+
+	// Standard formats of the flow records.
+	formatRawPacketHeader = 1
+	formatExtendedSwitch  = 1001
+	formatExtendedRouter  = 1002
+
+	// Standard format of the counter records.
+	formatGenericInterfaceCounters = 1
+)
+
+// HeaderProtocol is the protocol of a sampled packet header.
+type HeaderProtocol uint32
+
+// Header protocols, as defined by sFlow version 5.
+const (
+	Ethernet HeaderProtocol = 1
+	IPv4     HeaderProtocol = 11
+	IPv6     HeaderProtocol = 12
+)
+
+// Datagram is an sFlow datagram received by a Collector.
+type Datagram struct {
+	Source         net.Addr // The source of the datagram.
+	Received       time.Time
+	Agent          net.IP
+	SubAgentID     uint32
+	Sequence       uint32
+	Uptime         time.Duration
+	FlowSamples    []*FlowSample
+	CounterSamples []*CounterSample
+}
+
+func (d *Datagram) String() string {
+	return fmt.Sprintf("sFlow datagram %d of agent %v with %d flow samples and %d counter samples",
+		d.Sequence, d.Agent, len(d.FlowSamples), len(d.CounterSamples))
+}
+
+// FlowSample is a flow sample of a Datagram, in its compact or expanded form.
+// Input and Output are the interface indices of the sampled packet, which are
+// 0 if unknown.
+type FlowSample struct {
+	Agent         net.IP
+	Sequence      uint32
+	SourceIDType  uint32
+	SourceIDIndex uint32
+	SamplingRate  uint32
+	SamplePool    uint32
+	Drops         uint32
+	Input         uint32
+	Output        uint32
+	// Header is the raw packet header record, or nil if there is none.
+	Header *PacketHeader
+	// Router is the extended router record, or nil if there is none.
+	Router *ExtendedRouter
+	// Switch is the extended switch record, or nil if there is none.
+	Switch *ExtendedSwitch
+}
+
+func (s *FlowSample) String() string {
+	return fmt.Sprintf("flow sample %d of source %d:%d at 1/%d from interface %d to interface %d",
+		s.Sequence, s.SourceIDType, s.SourceIDIndex, s.SamplingRate, s.Input, s.Output)
+}
+
+// PacketHeader is the sampled header of a packet.
+type PacketHeader struct {
+	Protocol    HeaderProtocol
+	FrameLength uint32
+	Stripped    uint32
+	Header      []byte
+}
+
+// ExtendedRouter is the IP forwarding information of a sampled packet.
+type ExtendedRouter struct {
+	NextHop    net.IP
+	SrcMaskLen uint32
+	DstMaskLen uint32
+}
+
+// ExtendedSwitch is the layer 2 switching information of a sampled packet.
+type ExtendedSwitch struct {
+	SrcVLAN     uint32
+	SrcPriority uint32
+	DstVLAN     uint32
+	DstPriority uint32
+}
+
+// CounterSample is a counter sample of a Datagram, in its compact or
+// expanded form.
+type CounterSample struct {
+	Agent         net.IP
+	Sequence      uint32
+	SourceIDType  uint32
+	SourceIDIndex uint32
+	// Interface is the generic interface counters record, or nil if there is
+	// none.
+	Interface *InterfaceCounters
+}
+
+func (s *CounterSample) String() string {
+	return fmt.Sprintf("counter sample %d of source %d:%d", s.Sequence, s.SourceIDType, s.SourceIDIndex)
+}
+
+// InterfaceCounters are the generic interface counters of a CounterSample.
+type InterfaceCounters struct {
+	Index            uint32
+	Type             uint32
+	Speed            uint64
+	Direction        uint32
+	Status           uint32
+	InOctets         uint64
+	InUcastPkts      uint32
+	InMulticastPkts  uint32
+	InBroadcastPkts  uint32
+	InDiscards       uint32
+	InErrors         uint32
+	InUnknownProtos  uint32
+	OutOctets        uint64
+	OutUcastPkts     uint32
+	OutMulticastPkts uint32
+	OutBroadcastPkts uint32
+	OutDiscards      uint32
+	OutErrors        uint32
+	PromiscuousMode  uint32
+}
+
+// reader reads the XDR encoded fields of a datagram. Reading beyond the end
+// of the datagram sets err and returns zero values.
+type reader struct {
+	b   []byte
+	err error
+}
+
+var errTruncated = errors.New("truncated sFlow datagram")
+
+func (r *reader) bytes(n uint32) []byte {
+	if r.err != nil || uint64(n) > uint64(len(r.b)) {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *reader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) u64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// opaque reads a variable length opaque field, padded to 4 bytes.
+func (r *reader) opaque() []byte {
+	n := r.u32()
+	b := r.bytes(n)
+	r.bytes((4 - n%4) % 4)
+	return b
+}
+
+func (r *reader) address() net.IP {
+	switch t := r.u32(); t {
+	case addressIPv4:
+		return net.IP(r.bytes(net.IPv4len))
+	case addressIPv6:
+		return net.IP(r.bytes(net.IPv6len))
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("unsupported sFlow address type %d", t)
+		}
+		return nil
+	}
+}
+
+// records reads the records of a sample, calling f with the reader of the
+// data of each record of the standard enterprise.
+func (r *reader) records(f func(format uint32, rr *reader)) {
+	n := r.u32()
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		dataFormat := r.u32()
+		data := r.opaque()
+		if r.err != nil || dataFormat>>12 != 0 {
+			continue
+		}
+		rr := &reader{b: data}
+		f(dataFormat&0xfff, rr)
+		if rr.err != nil {
+			r.err = fmt.Errorf("record of format %d: %w", dataFormat&0xfff, rr.err)
+		}
+	}
+}
+
+// Parse parses an sFlow version 5 datagram received at received. Samples and
+// records of formats other than the standard ones above are skipped.
+func Parse(b []byte, received time.Time) (*Datagram, error) {
+	r := &reader{b: b}
+	if v := r.u32(); r.err == nil && v != version {
+		return nil, fmt.Errorf("unsupported sFlow version %d", v)
+	}
+	d := &Datagram{Received: received}
+	d.Agent = r.address()
+	d.SubAgentID = r.u32()
+	d.Sequence = r.u32()
+	d.Uptime = time.Duration(r.u32()) * time.Millisecond
+	n := r.u32()
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		dataFormat := r.u32()
+		data := r.opaque()
+		if r.err != nil || dataFormat>>12 != 0 {
+			continue
+		}
+		sr := &reader{b: data}
+		switch format := dataFormat & 0xfff; format {
+		case formatFlowSample, formatExpandedFlowSample:
+			d.FlowSamples = append(d.FlowSamples, parseFlowSample(sr, d.Agent, format == formatExpandedFlowSample))
+		case formatCounterSample, formatExpandedCounterSample:
+			d.CounterSamples = append(d.CounterSamples, parseCounterSample(sr, d.Agent, format == formatExpandedCounterSample))
+		}
+		if sr.err != nil {
+			r.err = fmt.Errorf("sample %d: %w", i, sr.err)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return d, nil
+}
+
+// sourceID reads the source ID of a sample in its compact or expanded form.
+func (r *reader) sourceID(expanded bool) (uint32, uint32) {
+	if expanded {
+		return r.u32(), r.u32()
+	}
+	id := r.u32()
+	return id >> 24, id & 0xffffff
+}
+
+// ifIndex reads the input or output interface of a flow sample in its compact
+// or expanded form. Values which are not a single interface index are
+// returned as 0.
+func (r *reader) ifIndex(expanded bool) uint32 {
+	if expanded {
+		format, value := r.u32(), r.u32()
+		if format != 0 {
+			return 0
+		}
+		return value
+	}
+	v := r.u32()
+	if v>>30 != 0 {
+		return 0
+	}
+	return v
+}
+
+func parseFlowSample(r *reader, agent net.IP, expanded bool) *FlowSample {
+	s := &FlowSample{Agent: agent, Sequence: r.u32()}
+	s.SourceIDType, s.SourceIDIndex = r.sourceID(expanded)
+	s.SamplingRate = r.u32()
+	s.SamplePool = r.u32()
+	s.Drops = r.u32()
+	s.Input = r.ifIndex(expanded)
+	s.Output = r.ifIndex(expanded)
+	r.records(func(format uint32, rr *reader) {
+		switch format {
+		case formatRawPacketHeader:
+			s.Header = &PacketHeader{
+				Protocol:    HeaderProtocol(rr.u32()),
+				FrameLength: rr.u32(),
+				Stripped:    rr.u32(),
+			}
+			s.Header.Header = rr.opaque()
+		case formatExtendedSwitch:
+			s.Switch = &ExtendedSwitch{SrcVLAN: rr.u32(), SrcPriority: rr.u32(), DstVLAN: rr.u32(), DstPriority: rr.u32()}
+		case formatExtendedRouter:
+			s.Router = &ExtendedRouter{NextHop: rr.address(), SrcMaskLen: rr.u32(), DstMaskLen: rr.u32()}
+		}
+	})
+	return s
+}
+
+func parseCounterSample(r *reader, agent net.IP, expanded bool) *CounterSample {
+	s := &CounterSample{Agent: agent, Sequence: r.u32()}
+	s.SourceIDType, s.SourceIDIndex = r.sourceID(expanded)
+	r.records(func(format uint32, rr *reader) {
+		if format != formatGenericInterfaceCounters {
+			return
+		}
+		s.Interface = &InterfaceCounters{
+			Index:            rr.u32(),
+			Type:             rr.u32(),
+			Speed:            rr.u64(),
+			Direction:        rr.u32(),
+			Status:           rr.u32(),
+			InOctets:         rr.u64(),
+			InUcastPkts:      rr.u32(),
+			InMulticastPkts:  rr.u32(),
+			InBroadcastPkts:  rr.u32(),
+			InDiscards:       rr.u32(),
+			InErrors:         rr.u32(),
+			InUnknownProtos:  rr.u32(),
+			OutOctets:        rr.u64(),
+			OutUcastPkts:     rr.u32(),
+			OutMulticastPkts: rr.u32(),
+			OutBroadcastPkts: rr.u32(),
+			OutDiscards:      rr.u32(),
+			OutErrors:        rr.u32(),
+			PromiscuousMode:  rr.u32(),
+		}
+	})
+	return s
+}
+
+// Collector collects the sFlow datagrams received on a UDP socket.
+type Collector struct {
+	conn net.PacketConn
+	done chan struct{}
+
+	mu        sync.Mutex
+	datagrams []*Datagram
+	errs      []error
+	received  chan struct{} // Closed and replaced when a datagram is received.
+	resets    int           // Number of calls to Reset.
+}
+
+// Listen starts a collector of the sFlow datagrams received on the UDP address
+// addr, such as ":6343". The port of addr may be 0 to pick any available port.
+func Listen(addr string) (*Collector, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for sFlow datagrams on %s: %w", addr, err)
+	}
+	c := &Collector{
+		conn:     conn,
+		done:     make(chan struct{}),
+		received: make(chan struct{}),
+	}
+	go c.receive()
+	return c, nil
+}
+
+// receive receives datagrams until the collector is closed.
+func (c *Collector) receive() {
+	defer close(c.done)
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, src, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		// The decoded datagram refers to its bytes, so they are not reused.
+		d, err := Parse(append([]byte(nil), buf[:n]...), time.Now())
+		c.mu.Lock()
+		if err != nil {
+			c.errs = append(c.errs, fmt.Errorf("from %v: %w", src, err))
+		} else {
+			d.Source = src
+			c.datagrams = append(c.datagrams, d)
+			close(c.received)
+			c.received = make(chan struct{})
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Addr returns the address on which the collector listens.
+func (c *Collector) Addr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Port returns the UDP port on which the collector listens.
+func (c *Collector) Port() uint16 {
+	return uint16(c.conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+// Close stops the collector.
+func (c *Collector) Close() error {
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// Datagrams returns the datagrams collected so far, in order of reception,
+// which match, or all of them if match is nil.
+func (c *Collector) Datagrams(match func(*Datagram) bool) []*Datagram {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ds []*Datagram
+	for _, d := range c.datagrams {
+		if match == nil || match(d) {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+// FlowSamples returns the flow samples of the datagrams collected so far
+// which match, or all of them if match is nil.
+func (c *Collector) FlowSamples(match func(*FlowSample) bool) []*FlowSample {
+	var samples []*FlowSample
+	for _, d := range c.Datagrams(nil) {
+		for _, s := range d.FlowSamples {
+			if match == nil || match(s) {
+				samples = append(samples, s)
+			}
+		}
+	}
+	return samples
+}
+
+// CounterSamples returns the counter samples of the datagrams collected so far
+// which match, or all of them if match is nil.
+func (c *Collector) CounterSamples(match func(*CounterSample) bool) []*CounterSample {
+	var samples []*CounterSample
+	for _, d := range c.Datagrams(nil) {
+		for _, s := range d.CounterSamples {
+			if match == nil || match(s) {
+				samples = append(samples, s)
+			}
+		}
+	}
+	return samples
+}
+
+// Errors returns the errors parsing the datagrams received so far, which were
+// not collected.
+func (c *Collector) Errors() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]error(nil), c.errs...)
+}
+
+// Reset discards the datagrams and errors collected so far.
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.datagrams, c.errs = nil, nil
+	c.resets++
+}
+
+// Await waits for a collected datagram which matches, and returns the first.
+// It returns the error of ctx if it is done before.
+func (c *Collector) Await(ctx context.Context, match func(*Datagram) bool) (*Datagram, error) {
+	var next, resets int
+	for {
+		c.mu.Lock()
+		ds, received := c.datagrams, c.received
+		if c.resets != resets {
+			next, resets = 0, c.resets
+		}
+		c.mu.Unlock()
+		for _, d := range ds[next:] {
+			if match(d) {
+				return d, nil
+			}
+		}
+		next = len(ds)
+		select {
+		case <-received:
+		case <-c.done:
+			return nil, errors.New("sFlow collector is closed")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sflowcollector
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+var received = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// encoder encodes the XDR fields of a test datagram.
+type encoder []byte
+
+func (e encoder) u32(vs ...uint32) encoder {
+	for _, v := range vs {
+		e = binary.BigEndian.AppendUint32(e, v)
+	}
+	return e
+}
+
+func (e encoder) u64(v uint64) encoder {
+	return binary.BigEndian.AppendUint64(e, v)
+}
+
+func (e encoder) opaque(b []byte) encoder {
+	e = e.u32(uint32(len(b)))
+	e = append(e, b...)
+	return append(e, make([]byte, (4-len(b)%4)%4)...)
+}
+
+// record encodes a record or a sample of format with data.
+func (e encoder) record(format uint32, data encoder) encoder {
+	return e.u32(format).opaque(data)
+}
+
+var (
+	agent  = net.IPv4(192, 0, 2, 1).To4()
+	header = []byte{0x45, 0, 0, 0x14, 0, 0, 0, 0, 0x40, 0x06}
+)
+
+// datagram returns a datagram of agent with samples.
+func datagram(seq uint32, samples ...encoder) []byte {
+	e := encoder{}.u32(version, addressIPv4)
+	e = append(e, agent...)
+	e = e.u32(0, seq, 60000, uint32(len(samples)))
+	for _, s := range samples {
+		e = append(e, s...)
+	}
+	return e
+}
+
+func flowSample() encoder {
+	records := encoder{}.u32(3).
+		record(formatRawPacketHeader, encoder{}.u32(uint32(IPv4), 512, 4).opaque(header)).
+		record(formatExtendedRouter, append(encoder{}.u32(addressIPv4), 192, 0, 2, 6).u32(30, 24)).
+		// A record of another enterprise, which is skipped.
+		record(1<<12|1, encoder{}.u32(1))
+	return encoder{}.record(formatFlowSample, append(encoder{}.u32(7, 0<<24|3, 1000, 123000, 0, 3, 4), records...))
+}
+
+func expandedFlowSample() encoder {
+	records := encoder{}.u32(1).
+		record(formatExtendedSwitch, encoder{}.u32(10, 0, 20, 0))
+	// The output is a multiple interfaces format.
+	return encoder{}.record(formatExpandedFlowSample, append(encoder{}.u32(8, 0, 3, 1000, 124000, 2, 0, 3, 2, 7), records...))
+}
+
+func counterSample() encoder {
+	counters := encoder{}.u32(3, 6).u64(100000000000).u32(1, 3).u64(5000).u32(10, 0, 0, 0, 0, 0).u64(6000).u32(11, 0, 0, 0, 0, 0)
+	records := encoder{}.u32(1).record(formatGenericInterfaceCounters, counters)
+	return encoder{}.record(formatCounterSample, append(encoder{}.u32(9, 0<<24|3), records...))
+}
+
+func TestParse(t *testing.T) {
+	want := &Datagram{
+		Received: received,
+		Agent:    agent,
+		Sequence: 42,
+		Uptime:   time.Minute,
+		FlowSamples: []*FlowSample{{
+			Agent:         agent,
+			Sequence:      7,
+			SourceIDIndex: 3,
+			SamplingRate:  1000,
+			SamplePool:    123000,
+			Input:         3,
+			Output:        4,
+			Header:        &PacketHeader{Protocol: IPv4, FrameLength: 512, Stripped: 4, Header: header},
+			Router:        &ExtendedRouter{NextHop: net.IPv4(192, 0, 2, 6).To4(), SrcMaskLen: 30, DstMaskLen: 24},
+		}, {
+			Agent:         agent,
+			Sequence:      8,
+			SourceIDIndex: 3,
+			SamplingRate:  1000,
+			SamplePool:    124000,
+			Drops:         2,
+			Input:         3,
+			Switch:        &ExtendedSwitch{SrcVLAN: 10, DstVLAN: 20},
+		}},
+		CounterSamples: []*CounterSample{{
+			Agent:         agent,
+			Sequence:      9,
+			SourceIDIndex: 3,
+			Interface: &InterfaceCounters{
+				Index:        3,
+				Type:         6,
+				Speed:        100000000000,
+				Direction:    1,
+				Status:       3,
+				InOctets:     5000,
+				InUcastPkts:  10,
+				OutOctets:    6000,
+				OutUcastPkts: 11,
+			},
+		}},
+	}
+	got, err := Parse(datagram(42, flowSample(), expandedFlowSample(), counterSample()), received)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("Parse() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	d := datagram(1, flowSample())
+	tests := []struct {
+		desc     string
+		datagram []byte
+	}{{
+		desc:     "empty",
+		datagram: nil,
+	}, {
+		desc:     "version 4",
+		datagram: append(encoder{}.u32(4), d[4:]...),
+	}, {
+		desc:     "truncated",
+		datagram: d[:len(d)-4],
+	}, {
+		desc:     "agent address type",
+		datagram: append(encoder{}.u32(version, 3), d[8:]...),
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got, err := Parse(tt.datagram, received); err == nil {
+				t.Errorf("Parse() got %v, want error", got)
+			}
+		})
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	defer c.Close()
+
+	conn, err := net.Dial("udp", c.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer conn.Close()
+	send := func(b []byte) {
+		t.Helper()
+		if _, err := conn.Write(b); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	hasCounters := func(d *Datagram) bool { return len(d.CounterSamples) > 0 }
+
+	send([]byte("not sFlow"))
+	send(datagram(1, flowSample()))
+	// The datagram awaited is received after Await starts waiting.
+	go conn.Write(datagram(2, counterSample(), expandedFlowSample()))
+	d, err := c.Await(ctx, hasCounters)
+	if err != nil {
+		t.Fatalf("Await() failed: %v", err)
+	}
+	if d.Sequence != 2 || d.Source == nil {
+		t.Errorf("Await() got %v from %v, want datagram 2 with its source", d, d.Source)
+	}
+	if got := len(c.FlowSamples(func(s *FlowSample) bool { return s.Input == 3 })); got != 2 {
+		t.Errorf("FlowSamples() got %d samples, want 2", got)
+	}
+	if got := len(c.CounterSamples(nil)); got != 1 {
+		t.Errorf("CounterSamples() got %d samples, want 1", got)
+	}
+	if got := len(c.Errors()); got != 1 {
+		t.Errorf("Errors() got %d errors, want 1", got)
+	}
+
+	c.Reset()
+	if got := c.Datagrams(nil); len(got) != 0 {
+		t.Errorf("Datagrams() after Reset() got %v, want none", got)
+	}
+	send(datagram(3, counterSample()))
+	if d, err := c.Await(ctx, hasCounters); err != nil || d.Sequence != 3 {
+		t.Errorf("Await() after Reset() got %v, %v, want datagram 3", d, err)
+	}
+}
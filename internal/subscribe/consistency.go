@@ -0,0 +1,359 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscribe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	"github.com/openconfig/ygot/ytypes"
+	"google.golang.org/protobuf/proto"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// DefaultConsistencyTimeout is the time allowed for the Get and the ONCE
+// subscription of a consistency check.
+const DefaultConsistencyTimeout = 2 * time.Minute
+
+// volatile are substrings of the paths of leaves which may change between
+// the Get and the ONCE subscription.
+var volatile = []string{
+	"/counters/",
+	"/last-change",
+	"/last-clear",
+	"/cpu/",
+	"/memory/",
+	"/temperature/",
+	"/utilization/",
+	"/uptime",
+	"/current-datetime",
+}
+
+// IgnoreVolatile reports whether the leaf p may change between the Get and the
+// ONCE subscription of a consistency check, such as counters and utilization.
+func IgnoreVolatile(p string) bool {
+	for _, v := range volatile {
+		if strings.Contains(p, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mismatch is a leaf whose value differs between Get and Subscribe.
+type Mismatch struct {
+	Path      string
+	Get       *gpb.TypedValue // nil if missing from the Get response
+	Subscribe *gpb.TypedValue // nil if missing from the subscription
+}
+
+func (m *Mismatch) String() string {
+	switch {
+	case m.Get == nil:
+		return fmt.Sprintf("%s: only in Subscribe = %v", m.Path, m.Subscribe)
+	case m.Subscribe == nil:
+		return fmt.Sprintf("%s: only in Get = %v", m.Path, m.Get)
+	}
+	return fmt.Sprintf("%s: Get = %v, Subscribe = %v", m.Path, m.Get, m.Subscribe)
+}
+
+// ConsistencyResult is the outcome of a consistency check.
+type ConsistencyResult struct {
+	// GetLeaves and SubscribeLeaves are the number of leaves received with
+	// Get and Subscribe.
+	GetLeaves       int
+	SubscribeLeaves int
+	// Ignored is the number of differing leaves which were ignored.
+	Ignored int
+	// Mismatches are the leaves whose values differ, sorted by path.
+	Mismatches []*Mismatch
+}
+
+// Err returns an error describing the mismatches of r, or nil if there are
+// none.
+func (r *ConsistencyResult) Err() error {
+	if len(r.Mismatches) == 0 {
+		return nil
+	}
+	msgs := []string{fmt.Sprintf("%d of %d leaves of Get and %d leaves of Subscribe differ", len(r.Mismatches), r.GetLeaves, r.SubscribeLeaves)}
+	for _, m := range r.Mismatches {
+		msgs = append(msgs, m.String())
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// ConsistencySpec specifies a consistency check of Get and Subscribe.
+type ConsistencySpec struct {
+	// Path is the root of the compared subtree, e.g. /interfaces.
+	Path *gpb.Path
+	// Config compares the config instead of the state of the subtree.
+	Config bool
+	// Ignore reports whether a differing leaf is ignored, e.g.
+	// IgnoreVolatile. No leaf is ignored if it is nil.
+	Ignore func(path string) bool
+	// NewSchema returns a new schema of the generated bindings, e.g.
+	// oc.Schema.
+	NewSchema func() (*ytypes.Schema, error)
+	// StrictEncoding fails the fetch of a subtree if a value is not encoded
+	// in the requested encoding, e.g. a scalar value in JSON_IETF encoding.
+	StrictEncoding bool
+}
+
+// datastore accumulates the values of a subtree into a GoStruct root.
+type datastore struct {
+	schema *ytypes.Schema
+	shadow bool
+}
+
+// set sets the value of path p below prefix. JSON values are nested in
+// containers and lists down from the root, so that they can be unmarshalled
+// into the root regardless of the compression of the schema.
+func (d *datastore) set(prefix, p *gpb.Path, val *gpb.TypedValue) error {
+	p = joinPath(prefix, p)
+	var b []byte
+	switch v := val.GetValue().(type) {
+	case *gpb.TypedValue_JsonIetfVal:
+		b = v.JsonIetfVal
+	case *gpb.TypedValue_JsonVal:
+		b = v.JsonVal
+	default:
+		opts := []ytypes.SetNodeOpt{&ytypes.InitMissingElements{}, &ytypes.IgnoreExtraFields{}}
+		if d.shadow {
+			opts = append(opts, &ytypes.PreferShadowPath{})
+		}
+		if err := ytypes.SetNode(d.schema.RootSchema(), d.schema.Root, p, val, opts...); err != nil {
+			return fmt.Errorf("%s: %w", pathString(p), err)
+		}
+		return nil
+	}
+	var tree any
+	if err := json.Unmarshal(b, &tree); err != nil {
+		return fmt.Errorf("%s: %w", pathString(p), err)
+	}
+	elems := p.GetElem()
+	for i := len(elems) - 1; i >= 0; i-- {
+		e := elems[i]
+		if len(e.GetKey()) == 0 {
+			tree = map[string]any{e.GetName(): tree}
+			continue
+		}
+		entry, ok := tree.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: value of list entry is not an object", pathString(p))
+		}
+		for k, v := range e.GetKey() {
+			if _, ok := entry[k]; !ok {
+				entry[k] = v
+			}
+		}
+		tree = map[string]any{e.GetName(): []any{entry}}
+	}
+	nested, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	opts := []ytypes.UnmarshalOpt{&ytypes.IgnoreExtraFields{}}
+	if d.shadow {
+		opts = append(opts, &ytypes.PreferShadowPath{})
+	}
+	if err := d.schema.Unmarshal(nested, d.schema.Root, opts...); err != nil {
+		return fmt.Errorf("%s: %w", pathString(p), err)
+	}
+	return nil
+}
+
+// leaves returns the values of the leaves of the datastore keyed by path.
+func (d *datastore) leaves() (map[string]*gpb.TypedValue, error) {
+	empty := reflect.New(reflect.TypeOf(d.schema.Root).Elem()).Interface().(ygot.GoStruct)
+	n, err := ygot.Diff(empty, d.schema.Root, &ygot.DiffPathOpt{PreferShadowPath: d.shadow})
+	if err != nil {
+		return nil, err
+	}
+	leaves := map[string]*gpb.TypedValue{}
+	for _, u := range n.GetUpdate() {
+		leaves[pathString(u.GetPath())] = u.GetVal()
+	}
+	return leaves, nil
+}
+
+// checkEncoding returns an error if val is not a value of encoding enc.
+func checkEncoding(enc gpb.Encoding, val *gpb.TypedValue) error {
+	switch val.GetValue().(type) {
+	case *gpb.TypedValue_JsonIetfVal:
+		if enc != gpb.Encoding_JSON_IETF {
+			return fmt.Errorf("JSON_IETF value in %v encoding", enc)
+		}
+	case *gpb.TypedValue_JsonVal:
+		if enc != gpb.Encoding_JSON {
+			return fmt.Errorf("JSON value in %v encoding", enc)
+		}
+	default:
+		if enc == gpb.Encoding_JSON || enc == gpb.Encoding_JSON_IETF {
+			return fmt.Errorf("scalar value %v in %v encoding", val, enc)
+		}
+	}
+	return nil
+}
+
+func (spec *ConsistencySpec) newDatastore() (*datastore, error) {
+	s, err := spec.NewSchema()
+	if err != nil {
+		return nil, err
+	}
+	return &datastore{schema: s, shadow: spec.Config}, nil
+}
+
+// addNotification adds the updates of n in encoding enc to the datastore.
+func (d *datastore) addNotification(n *gpb.Notification, enc gpb.Encoding, strict bool) error {
+	for _, u := range n.GetUpdate() {
+		if strict {
+			if err := checkEncoding(enc, u.GetVal()); err != nil {
+				return fmt.Errorf("%s: %w", pathString(joinPath(n.GetPrefix(), u.GetPath())), err)
+			}
+		}
+		if err := d.set(n.GetPrefix(), u.GetPath(), u.GetVal()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLeaves fetches the subtree of spec with client c with a Get in encoding
+// enc, and returns the values of its leaves keyed by path. The values are
+// decoded with the schema of spec, so the values of the same leaf are equal
+// regardless of the encoding.
+func GetLeaves(ctx context.Context, c gpb.GNMIClient, spec *ConsistencySpec, enc gpb.Encoding) (map[string]*gpb.TypedValue, error) {
+	ds, err := spec.newDatastore()
+	if err != nil {
+		return nil, err
+	}
+	typ := gpb.GetRequest_STATE
+	if spec.Config {
+		typ = gpb.GetRequest_CONFIG
+	}
+	resp, err := c.Get(ctx, &gpb.GetRequest{Path: []*gpb.Path{spec.Path}, Type: typ, Encoding: enc})
+	if err != nil {
+		return nil, fmt.Errorf("gNMI Get: %w", err)
+	}
+	for _, n := range resp.GetNotification() {
+		if err := ds.addNotification(n, enc, spec.StrictEncoding); err != nil {
+			return nil, fmt.Errorf("gNMI Get response: %w", err)
+		}
+	}
+	return ds.leaves()
+}
+
+// SubscribeLeaves fetches the subtree of spec with client c with a ONCE
+// subscription in encoding enc, and returns the values of its leaves keyed by
+// path, decoded like GetLeaves.
+func SubscribeLeaves(ctx context.Context, c gpb.GNMIClient, spec *ConsistencySpec, enc gpb.Encoding) (map[string]*gpb.TypedValue, error) {
+	ds, err := spec.newDatastore()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := c.Subscribe(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gNMI Subscribe: %w", err)
+	}
+	sl := &gpb.SubscriptionList{
+		Mode:         gpb.SubscriptionList_ONCE,
+		Encoding:     enc,
+		Subscription: []*gpb.Subscription{{Path: spec.Path}},
+	}
+	if err := stream.Send(&gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: sl}}); err != nil {
+		return nil, fmt.Errorf("gNMI Subscribe send: %w", err)
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("gNMI Subscribe before sync: %w", err)
+		}
+		if resp.GetSyncResponse() {
+			break
+		}
+		if err := ds.addNotification(resp.GetUpdate(), enc, spec.StrictEncoding); err != nil {
+			return nil, fmt.Errorf("gNMI Subscribe response: %w", err)
+		}
+	}
+	return ds.leaves()
+}
+
+// Consistency fetches the subtree of spec with client c once with Get, in
+// JSON_IETF encoding, and once with a ONCE subscription, in PROTO encoding,
+// and compares the leaves of both.
+func Consistency(ctx context.Context, c gpb.GNMIClient, spec *ConsistencySpec) (*ConsistencyResult, error) {
+	getLeaves, err := GetLeaves(ctx, c, spec, gpb.Encoding_JSON_IETF)
+	if err != nil {
+		return nil, err
+	}
+	subLeaves, err := SubscribeLeaves(ctx, c, spec, gpb.Encoding_PROTO)
+	if err != nil {
+		return nil, err
+	}
+	res := &ConsistencyResult{GetLeaves: len(getLeaves), SubscribeLeaves: len(subLeaves)}
+	add := func(p string, g, s *gpb.TypedValue) {
+		if spec.Ignore != nil && spec.Ignore(p) {
+			res.Ignored++
+			return
+		}
+		res.Mismatches = append(res.Mismatches, &Mismatch{Path: p, Get: g, Subscribe: s})
+	}
+	for p, g := range getLeaves {
+		if s, ok := subLeaves[p]; !ok || !proto.Equal(g, s) {
+			add(p, g, s)
+		}
+	}
+	for p, s := range subLeaves {
+		if _, ok := getLeaves[p]; !ok {
+			add(p, nil, s)
+		}
+	}
+	sort.Slice(res.Mismatches, func(i, j int) bool { return res.Mismatches[i].Path < res.Mismatches[j].Path })
+	return res, nil
+}
+
+// GetSubscribeConsistency checks that the state of the subtree at path p of
+// dut is the same when fetched with Get and with a ONCE subscription, ignoring
+// volatile leaves, and reports the differing leaves as test errors. The path is
+// in the string form, e.g. "/interfaces".
+func GetSubscribeConsistency(t testing.TB, dut *ondatra.DUTDevice, p string) *ConsistencyResult {
+	t.Helper()
+	gp, err := ygot.StringToStructuredPath(p)
+	if err != nil {
+		t.Fatalf("Invalid path %q: %v", p, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConsistencyTimeout)
+	defer cancel()
+	res, err := Consistency(ctx, dut.RawAPIs().GNMI(t), &ConsistencySpec{Path: gp, Ignore: IgnoreVolatile, NewSchema: oc.Schema})
+	if err != nil {
+		t.Fatalf("Get and Subscribe consistency check of %s on %s: %v", p, dut.Name(), err)
+	}
+	t.Logf("Compared %d leaves of Get with %d leaves of Subscribe of %s, ignored %d volatile leaves", res.GetLeaves, res.SubscribeLeaves, p, res.Ignored)
+	if err := res.Err(); err != nil {
+		t.Errorf("Get and Subscribe consistency check of %s on %s: %v", p, dut.Name(), err)
+	}
+	return res
+}
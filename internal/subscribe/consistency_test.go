@@ -0,0 +1,166 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscribe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openconfig/ygnmi/exampleoc"
+	"google.golang.org/grpc"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// consistencyClient is a fake client which returns get for Get, and the
+// responses of its stream for Subscribe.
+type consistencyClient struct {
+	fakeClient
+	get *gpb.GetResponse
+}
+
+func (c *consistencyClient) Get(context.Context, *gpb.GetRequest, ...grpc.CallOption) (*gpb.GetResponse, error) {
+	return c.get, nil
+}
+
+// jsonGet returns a Get response with the JSON value v at /parent/child.
+func jsonGet(v string) *gpb.GetResponse {
+	return &gpb.GetResponse{Notification: []*gpb.Notification{{
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "parent"}, {Name: "child"}}},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(v)}},
+		}},
+	}}}
+}
+
+func TestConsistency(t *testing.T) {
+	tests := []struct {
+		desc        string
+		get         *gpb.GetResponse
+		subscribe   []*gpb.SubscribeResponse
+		ignore      func(string) bool
+		wantPaths   []string
+		wantIgnored int
+	}{{
+		desc: "consistent",
+		get:  jsonGet(`{"openconfig-simple:state": {"one": "a", "two": "x"}}`),
+		subscribe: []*gpb.SubscribeResponse{
+			notification(map[string]string{"one": "a", "two": "x"}),
+		},
+	}, {
+		desc: "value differs",
+		get:  jsonGet(`{"state": {"one": "a", "two": "x"}}`),
+		subscribe: []*gpb.SubscribeResponse{
+			notification(map[string]string{"one": "b", "two": "x"}),
+		},
+		wantPaths: []string{"/parent/child/state/one"},
+	}, {
+		desc: "leaf only in Get",
+		get:  jsonGet(`{"state": {"one": "a", "two": "x"}}`),
+		subscribe: []*gpb.SubscribeResponse{
+			notification(map[string]string{"one": "a"}),
+		},
+		wantPaths: []string{"/parent/child/state/two"},
+	}, {
+		desc: "leaf only in Subscribe",
+		get:  jsonGet(`{"state": {"one": "a"}}`),
+		subscribe: []*gpb.SubscribeResponse{
+			notification(map[string]string{"one": "a", "two": "x"}),
+		},
+		wantPaths: []string{"/parent/child/state/two"},
+	}, {
+		desc: "difference ignored",
+		get:  jsonGet(`{"state": {"one": "a", "two": "x"}}`),
+		subscribe: []*gpb.SubscribeResponse{
+			notification(map[string]string{"one": "a", "two": "y"}),
+		},
+		ignore:      func(p string) bool { return p == "/parent/child/state/two" },
+		wantIgnored: 1,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			stream := &fakeStream{respc: make(chan *gpb.SubscribeResponse, len(tt.subscribe)+1)}
+			for _, r := range tt.subscribe {
+				stream.respc <- r
+			}
+			stream.respc <- syncResponse
+			c := &consistencyClient{fakeClient: fakeClient{stream: stream}, get: tt.get}
+			res, err := Consistency(context.Background(), c, &ConsistencySpec{
+				Path:      &gpb.Path{Elem: []*gpb.PathElem{{Name: "parent"}, {Name: "child"}}},
+				Ignore:    tt.ignore,
+				NewSchema: exampleoc.Schema,
+			})
+			if err != nil {
+				t.Fatalf("Consistency() failed: %v", err)
+			}
+			if got := stream.req.GetSubscribe().GetMode(); got != gpb.SubscriptionList_ONCE {
+				t.Errorf("Consistency() subscription mode: got %v, want ONCE", got)
+			}
+			var gotPaths []string
+			for _, m := range res.Mismatches {
+				gotPaths = append(gotPaths, m.Path)
+			}
+			if diff := cmp.Diff(tt.wantPaths, gotPaths); diff != "" {
+				t.Errorf("Consistency() mismatches (-want +got):\n%s", diff)
+			}
+			if res.Ignored != tt.wantIgnored {
+				t.Errorf("Consistency() ignored %d leaves, want %d", res.Ignored, tt.wantIgnored)
+			}
+			if gotErr := res.Err() != nil; gotErr != (len(tt.wantPaths) > 0) {
+				t.Errorf("ConsistencyResult.Err() got %v, want error %t", res.Err(), len(tt.wantPaths) > 0)
+			}
+		})
+	}
+}
+
+func TestIgnoreVolatile(t *testing.T) {
+	for p, want := range map[string]bool{
+		"/interfaces/interface[name=eth0]/state/counters/in-octets":              true,
+		"/components/component[name=cpu0]/cpu/utilization/state/instant":         true,
+		"/interfaces/interface[name=eth0]/state/oper-status":                     false,
+		"/network-instances/network-instance[name=DEFAULT]/state/router-id":      false,
+		"/components/component[name=chassis]/state/temperature/instant":          true,
+		"/interfaces/interface[name=eth0]/subinterfaces/subinterface[index=0]/x": false,
+	} {
+		if got := IgnoreVolatile(p); got != want {
+			t.Errorf("IgnoreVolatile(%q) got %t, want %t", p, got, want)
+		}
+	}
+}
+
+func TestCheckEncoding(t *testing.T) {
+	jsonIETF := &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`"UP"`)}}
+	str := &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: "UP"}}
+	tests := []struct {
+		desc    string
+		enc     gpb.Encoding
+		val     *gpb.TypedValue
+		wantErr bool
+	}{
+		{desc: "JSON_IETF value", enc: gpb.Encoding_JSON_IETF, val: jsonIETF},
+		{desc: "scalar in JSON_IETF", enc: gpb.Encoding_JSON_IETF, val: str, wantErr: true},
+		{desc: "PROTO value", enc: gpb.Encoding_PROTO, val: str},
+		{desc: "JSON_IETF in PROTO", enc: gpb.Encoding_PROTO, val: jsonIETF, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if err := checkEncoding(tt.enc, tt.val); (err != nil) != tt.wantErr {
+				t.Errorf("checkEncoding(%v, %v) got error %v, want error %t", tt.enc, tt.val, err, tt.wantErr)
+			}
+		})
+	}
+}
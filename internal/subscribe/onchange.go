@@ -0,0 +1,357 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package subscribe provides helpers to verify the compliance of gNMI
+// subscriptions of a DUT.
+//
+// OnChange verifies ON_CHANGE subscriptions: it subscribes ON_CHANGE to a set
+// of paths, waits for the initial sync, applies a stimulus, and then checks
+// that every path expected to change is updated, and that no spurious updates
+// are sent. An update is spurious if it is for a path not expected to change,
+// or if it repeats the previous value of a leaf. Typical usage looks like:
+//
+//	subscribe.OnChange(t, dut, &subscribe.Spec{
+//		Changing: []ygnmi.UntypedQuery{
+//			gnmi.OC().Interface(p).OperStatus().State(),
+//		},
+//		Stable: []ygnmi.UntypedQuery{
+//			gnmi.OC().Interface(p).Mtu().State(),
+//		},
+//		Stimulus: func() error {
+//			gnmi.Replace(t, dut, gnmi.OC().Interface(p).Enabled().Config(), false)
+//			return nil
+//		},
+//	})
+//
+// GetSubscribeConsistency verifies that a DUT serves the same data with Get
+// and with a ONCE subscription: it fetches a subtree with both, and reports
+// the leaves which differ, ignoring volatile leaves such as counters.
+package subscribe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/protobuf/proto"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+const (
+	// DefaultSyncTimeout is the time allowed for the initial sync.
+	DefaultSyncTimeout = time.Minute
+	// DefaultTimeout is the time allowed for the updates of all changing
+	// paths after the stimulus.
+	DefaultTimeout = time.Minute
+	// DefaultSettle is the time updates are still collected after all
+	// changing paths were updated.
+	DefaultSettle = 10 * time.Second
+)
+
+// Spec specifies an ON_CHANGE compliance check. The paths of queries of
+// containers include all leaves below them.
+type Spec struct {
+	// Changing are the paths which must be updated after Stimulus.
+	Changing []ygnmi.UntypedQuery
+	// Stable are the paths which must not be updated after Stimulus.
+	Stable []ygnmi.UntypedQuery
+	// Stimulus changes the state of the DUT. It is called after the initial
+	// sync of the subscription.
+	Stimulus func() error
+	// SyncTimeout, Timeout and Settle default to DefaultSyncTimeout,
+	// DefaultTimeout and DefaultSettle respectively.
+	SyncTimeout time.Duration
+	Timeout     time.Duration
+	Settle      time.Duration
+}
+
+// Update is a leaf update or delete received after the stimulus.
+type Update struct {
+	Path      string
+	Val       *gpb.TypedValue // nil for a delete
+	Timestamp time.Time
+}
+
+// Result is the outcome of an ON_CHANGE compliance check.
+type Result struct {
+	// Updates are the updates received after the stimulus, keyed by the
+	// subscribed path they belong to.
+	Updates map[string][]*Update
+	// Missing are the changing paths which were not updated.
+	Missing []string
+	// Spurious describes the spurious updates received.
+	Spurious []string
+}
+
+// Err returns an error describing the missing and spurious updates of r, or
+// nil if there are none.
+func (r *Result) Err() error {
+	var msgs []string
+	for _, p := range r.Missing {
+		msgs = append(msgs, fmt.Sprintf("no update of %s", p))
+	}
+	msgs = append(msgs, r.Spurious...)
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// subscription is a subscribed path.
+type subscription struct {
+	path     *gpb.Path
+	str      string
+	changing bool
+}
+
+func newSubscriptions(spec *Spec) ([]*subscription, error) {
+	var subs []*subscription
+	add := func(qs []ygnmi.UntypedQuery, changing bool) error {
+		for _, q := range qs {
+			p, _, err := ygnmi.ResolvePath(q.PathStruct())
+			if err != nil {
+				return fmt.Errorf("resolving path: %w", err)
+			}
+			s, err := ygot.PathToString(p)
+			if err != nil {
+				return err
+			}
+			subs = append(subs, &subscription{path: p, str: s, changing: changing})
+		}
+		return nil
+	}
+	if err := add(spec.Changing, true); err != nil {
+		return nil, err
+	}
+	if err := add(spec.Stable, false); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// matches reports whether p is s or a descendant of s. Missing or wildcard
+// keys of s match any key.
+func (s *subscription) matches(p *gpb.Path) bool {
+	if len(p.GetElem()) < len(s.path.GetElem()) {
+		return false
+	}
+	for i, se := range s.path.GetElem() {
+		pe := p.GetElem()[i]
+		if se.GetName() != pe.GetName() {
+			return false
+		}
+		for k, v := range se.GetKey() {
+			if v != "*" && pe.GetKey()[k] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// joinPath returns prefix joined with p.
+func joinPath(prefix, p *gpb.Path) *gpb.Path {
+	return &gpb.Path{Elem: append(append([]*gpb.PathElem{}, prefix.GetElem()...), p.GetElem()...)}
+}
+
+type received struct {
+	resp *gpb.SubscribeResponse
+	err  error
+}
+
+// Run performs the ON_CHANGE compliance check of spec with client c. It
+// returns an error if the check could not be performed; the outcome of the
+// check is reported by the returned Result.
+func Run(ctx context.Context, c gpb.GNMIClient, spec *Spec) (*Result, error) {
+	subs, err := newSubscriptions(spec)
+	if err != nil {
+		return nil, err
+	}
+	syncTimeout, timeout, settle := spec.SyncTimeout, spec.Timeout, spec.Settle
+	if syncTimeout == 0 {
+		syncTimeout = DefaultSyncTimeout
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if settle == 0 {
+		settle = DefaultSettle
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.Subscribe(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gNMI Subscribe: %w", err)
+	}
+	sl := &gpb.SubscriptionList{Mode: gpb.SubscriptionList_STREAM, Encoding: gpb.Encoding_PROTO}
+	for _, s := range subs {
+		sl.Subscription = append(sl.Subscription, &gpb.Subscription{Path: s.path, Mode: gpb.SubscriptionMode_ON_CHANGE})
+	}
+	if err := stream.Send(&gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: sl}}); err != nil {
+		return nil, fmt.Errorf("gNMI Subscribe send: %w", err)
+	}
+
+	recvCh := make(chan received)
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			select {
+			case recvCh <- received{resp, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// last holds the last value of every leaf, or nil if it is deleted.
+	last := map[string]*gpb.TypedValue{}
+	res := &Result{Updates: map[string][]*Update{}}
+	synced := false
+	apply := func(n *gpb.Notification) {
+		ts := time.Unix(0, n.GetTimestamp())
+		var paths []*gpb.Path
+		var updates []*Update
+		for _, u := range n.GetUpdate() {
+			paths = append(paths, joinPath(n.GetPrefix(), u.GetPath()))
+			updates = append(updates, &Update{Val: u.GetVal(), Timestamp: ts})
+		}
+		for _, d := range n.GetDelete() {
+			paths = append(paths, joinPath(n.GetPrefix(), d))
+			updates = append(updates, &Update{Timestamp: ts})
+		}
+		for i, u := range updates {
+			u.Path = pathString(paths[i])
+			prev, seen := last[u.Path]
+			last[u.Path] = u.Val
+			if !synced {
+				continue
+			}
+			if seen && proto.Equal(prev, u.Val) {
+				res.Spurious = append(res.Spurious, fmt.Sprintf("redundant update of %s with unchanged value %v", u.Path, u.Val))
+			}
+			for _, s := range subs {
+				if !s.matches(paths[i]) {
+					continue
+				}
+				res.Updates[s.str] = append(res.Updates[s.str], u)
+				if !s.changing {
+					res.Spurious = append(res.Spurious, fmt.Sprintf("update of stable path %s: %s = %v", s.str, u.Path, u.Val))
+				}
+			}
+		}
+	}
+
+	syncTimer := time.NewTimer(syncTimeout)
+	defer syncTimer.Stop()
+	for !synced {
+		select {
+		case r := <-recvCh:
+			if r.err != nil {
+				return nil, fmt.Errorf("gNMI Subscribe before sync: %w", r.err)
+			}
+			if r.resp.GetSyncResponse() {
+				synced = true
+				continue
+			}
+			apply(r.resp.GetUpdate())
+		case <-syncTimer.C:
+			return nil, fmt.Errorf("no sync response within %v", syncTimeout)
+		}
+	}
+
+	if spec.Stimulus != nil {
+		if err := spec.Stimulus(); err != nil {
+			return nil, fmt.Errorf("stimulus: %w", err)
+		}
+	}
+
+	allUpdated := func() bool {
+		for _, s := range subs {
+			if s.changing && len(res.Updates[s.str]) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	var settleC <-chan time.Time
+	if allUpdated() {
+		settleC = time.After(settle)
+	}
+collect:
+	for {
+		select {
+		case r := <-recvCh:
+			if r.err != nil {
+				return nil, fmt.Errorf("gNMI Subscribe after sync: %w", r.err)
+			}
+			apply(r.resp.GetUpdate())
+			if settleC == nil && allUpdated() {
+				settleC = time.After(settle)
+			}
+		case <-settleC:
+			break collect
+		case <-deadline.C:
+			if settleC == nil {
+				break collect
+			}
+		}
+	}
+
+	for _, s := range subs {
+		if s.changing && len(res.Updates[s.str]) == 0 {
+			res.Missing = append(res.Missing, s.str)
+		}
+	}
+	sort.Strings(res.Missing)
+	return res, nil
+}
+
+func pathString(p *gpb.Path) string {
+	s, err := ygot.PathToString(p)
+	if err != nil {
+		return p.String()
+	}
+	return s
+}
+
+// OnChange performs the ON_CHANGE compliance check of spec against dut and
+// reports missing and spurious updates as test errors.
+func OnChange(t testing.TB, dut *ondatra.DUTDevice, spec *Spec) *Result {
+	t.Helper()
+	res, err := Run(context.Background(), dut.RawAPIs().GNMI(t), spec)
+	if err != nil {
+		t.Fatalf("ON_CHANGE check on %s: %v", dut.Name(), err)
+	}
+	for p, us := range res.Updates {
+		t.Logf("%d updates of %s after stimulus", len(us), p)
+	}
+	if err := res.Err(); err != nil {
+		t.Errorf("ON_CHANGE check on %s:\n%v", dut.Name(), err)
+	}
+	return res
+}
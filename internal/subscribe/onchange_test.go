@@ -0,0 +1,190 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscribe
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openconfig/ygnmi/exampleoc/exampleocpath"
+	"github.com/openconfig/ygnmi/ygnmi"
+	"google.golang.org/grpc"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// fakeStream is a Subscribe stream which returns the responses sent to its
+// channel.
+type fakeStream struct {
+	grpc.ClientStream
+	ctx   context.Context
+	respc chan *gpb.SubscribeResponse
+	req   *gpb.SubscribeRequest
+}
+
+func (s *fakeStream) Send(req *gpb.SubscribeRequest) error {
+	s.req = req
+	return nil
+}
+
+func (s *fakeStream) Recv() (*gpb.SubscribeResponse, error) {
+	select {
+	case r := <-s.respc:
+		return r, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+type fakeClient struct {
+	gpb.GNMIClient
+	stream *fakeStream
+}
+
+func (c *fakeClient) Subscribe(ctx context.Context, _ ...grpc.CallOption) (gpb.GNMI_SubscribeClient, error) {
+	c.stream.ctx = ctx
+	return c.stream, nil
+}
+
+// notification returns a response updating the given leaves of
+// /parent/child/state, or deleting them if the value is empty.
+func notification(leaves map[string]string) *gpb.SubscribeResponse {
+	n := &gpb.Notification{
+		Timestamp: time.Now().UnixNano(),
+		Prefix:    &gpb.Path{Elem: []*gpb.PathElem{{Name: "parent"}, {Name: "child"}, {Name: "state"}}},
+	}
+	for leaf, v := range leaves {
+		p := &gpb.Path{Elem: []*gpb.PathElem{{Name: leaf}}}
+		if v == "" {
+			n.Delete = append(n.Delete, p)
+			continue
+		}
+		n.Update = append(n.Update, &gpb.Update{Path: p, Val: &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: v}}})
+	}
+	return &gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_Update{Update: n}}
+}
+
+var syncResponse = &gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_SyncResponse{SyncResponse: true}}
+
+func TestRun(t *testing.T) {
+	child := exampleocpath.Root().Parent().Child()
+	initial := []*gpb.SubscribeResponse{
+		notification(map[string]string{"one": "a", "two": "x"}),
+		syncResponse,
+	}
+
+	tests := []struct {
+		desc         string
+		changing     []ygnmi.UntypedQuery
+		stable       []ygnmi.UntypedQuery
+		initial      []*gpb.SubscribeResponse
+		stimulus     []*gpb.SubscribeResponse
+		wantMissing  []string
+		wantSpurious int
+		wantErr      bool
+	}{{
+		desc:     "changing path updated",
+		changing: []ygnmi.UntypedQuery{child.One().State()},
+		stable:   []ygnmi.UntypedQuery{child.Two().State()},
+		initial:  initial,
+		stimulus: []*gpb.SubscribeResponse{notification(map[string]string{"one": "b"})},
+	}, {
+		desc:     "changing path deleted",
+		changing: []ygnmi.UntypedQuery{child.One().State()},
+		initial:  initial,
+		stimulus: []*gpb.SubscribeResponse{notification(map[string]string{"one": ""})},
+	}, {
+		desc:     "leaf of changing container updated",
+		changing: []ygnmi.UntypedQuery{child.State()},
+		initial:  initial,
+		stimulus: []*gpb.SubscribeResponse{notification(map[string]string{"three": "c"})},
+	}, {
+		desc:        "changing path not updated",
+		changing:    []ygnmi.UntypedQuery{child.One().State()},
+		initial:     initial,
+		wantMissing: []string{"/parent/child/state/one"},
+	}, {
+		desc:     "stable path updated",
+		changing: []ygnmi.UntypedQuery{child.One().State()},
+		stable:   []ygnmi.UntypedQuery{child.Two().State()},
+		initial:  initial,
+		stimulus: []*gpb.SubscribeResponse{
+			notification(map[string]string{"one": "b"}),
+			notification(map[string]string{"two": "y"}),
+		},
+		wantSpurious: 1,
+	}, {
+		desc:     "redundant update",
+		changing: []ygnmi.UntypedQuery{child.One().State()},
+		initial:  initial,
+		stimulus: []*gpb.SubscribeResponse{
+			notification(map[string]string{"one": "b"}),
+			notification(map[string]string{"one": "b"}),
+		},
+		wantSpurious: 1,
+	}, {
+		desc:     "no sync response",
+		changing: []ygnmi.UntypedQuery{child.One().State()},
+		initial:  initial[:1],
+		wantErr:  true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			stream := &fakeStream{respc: make(chan *gpb.SubscribeResponse, len(tt.initial)+len(tt.stimulus))}
+			for _, r := range tt.initial {
+				stream.respc <- r
+			}
+			res, err := Run(context.Background(), &fakeClient{stream: stream}, &Spec{
+				Changing: tt.changing,
+				Stable:   tt.stable,
+				Stimulus: func() error {
+					for _, r := range tt.stimulus {
+						stream.respc <- r
+					}
+					return nil
+				},
+				SyncTimeout: 100 * time.Millisecond,
+				Timeout:     200 * time.Millisecond,
+				Settle:      100 * time.Millisecond,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() got error %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got, want := len(stream.req.GetSubscribe().GetSubscription()), len(tt.changing)+len(tt.stable); got != want {
+				t.Errorf("Run() subscribed to %d paths, want %d", got, want)
+			}
+			for _, s := range stream.req.GetSubscribe().GetSubscription() {
+				if s.GetMode() != gpb.SubscriptionMode_ON_CHANGE {
+					t.Errorf("Run() subscription mode: got %v, want ON_CHANGE", s.GetMode())
+				}
+			}
+			if diff := cmp.Diff(tt.wantMissing, res.Missing); diff != "" {
+				t.Errorf("Run() missing updates (-want +got):\n%s", diff)
+			}
+			if got := len(res.Spurious); got != tt.wantSpurious {
+				t.Errorf("Run() got %d spurious updates %v, want %d", got, res.Spurious, tt.wantSpurious)
+			}
+			if gotErr, wantErr := res.Err() != nil, len(tt.wantMissing) > 0 || tt.wantSpurious > 0; gotErr != wantErr {
+				t.Errorf("Result.Err() got %v, want error %t", res.Err(), wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package syslogcollector provides a syslog collector, which runs on the test
+// host, or in a container reachable by the DUT, and receives the remote
+// logging messages of the DUT over UDP.
+//
+// The messages are parsed as RFC 5424 or RFC 3164 messages, so that tests can
+// assert their fields. Typical usage looks like:
+//
+//	c, err := syslogcollector.Listen(":5514")
+//	if err != nil {
+//	  t.Fatal(err)
+//	}
+//	defer c.Close()
+//	... configure the DUT to log to the port of c, and trigger an event ...
+//	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+//	defer cancel()
+//	msg, err := c.Await(ctx, func(m *syslogcollector.Message) bool {
+//	  return strings.Contains(m.Text, "Loopback1")
+//	})
+package syslogcollector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Format is the format of a syslog message.
+type Format int
+
+const (
+	// RFC5424 is the syslog protocol of RFC 5424.
+	RFC5424 Format = iota + 1
+	// RFC3164 is the BSD syslog protocol of RFC 3164.
+	RFC3164
+)
+
+// String returns the name of the RFC of f.
+func (f Format) String() string {
+	switch f {
+	case RFC5424:
+		return "RFC5424"
+	case RFC3164:
+		return "RFC3164"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// Severities of syslog messages, RFC 5424 section 6.2.1.
+const (
+	Emergency = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Informational
+	Debug
+)
+
+// Message is a syslog message received by a Collector. Fields which are
+// absent from the message, or nil in RFC 5424, are empty.
+type Message struct {
+	// Source is the address from which the message was received, and
+	// Received the time at which it was received.
+	Source   net.Addr
+	Received time.Time
+
+	Format Format
+	// Facility and Severity are the numerical facility and severity of the
+	// priority of the message, RFC 5424 section 6.2.1.
+	Facility int
+	Severity int
+	// Timestamp is the timestamp of the message. RFC 3164 timestamps have
+	// no year nor time zone, so they are in the year of Received, in UTC.
+	Timestamp time.Time
+	Hostname  string
+	// AppName and ProcID are the TAG of RFC 3164 messages and its PID.
+	AppName string
+	ProcID  string
+	// MsgID and StructuredData are only present in RFC 5424 messages.
+	MsgID          string
+	StructuredData string
+	Text           string
+	// Raw is the message as received.
+	Raw string
+}
+
+// String returns the raw message and its source.
+func (m *Message) String() string {
+	return fmt.Sprintf("%v: %s", m.Source, m.Raw)
+}
+
+// nilValue is the NILVALUE of RFC 5424.
+const nilValue = "-"
+
+// Parse parses the syslog message b, in the format of RFC 5424 or, without its
+// VERSION, of RFC 3164. Received is the time at which the message was
+// received, which dates RFC 3164 timestamps.
+func Parse(b []byte, received time.Time) (*Message, error) {
+	raw := strings.TrimRight(string(b), "\r\n\x00")
+	m := &Message{Received: received, Raw: raw}
+	if !strings.HasPrefix(raw, "<") {
+		return nil, fmt.Errorf("message %q has no PRI", raw)
+	}
+	end := strings.IndexByte(raw, '>')
+	if end < 2 || end > 4 {
+		return nil, fmt.Errorf("message %q has an invalid PRI", raw)
+	}
+	pri, err := strconv.Atoi(raw[1:end])
+	if err != nil || pri > 191 {
+		return nil, fmt.Errorf("message %q has an invalid PRI", raw)
+	}
+	m.Facility, m.Severity = pri/8, pri%8
+	rest := raw[end+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		m.Format = RFC5424
+		err = parse5424(m, rest[2:])
+	} else {
+		m.Format = RFC3164
+		err = parse3164(m, rest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("message %q: %v", raw, err)
+	}
+	return m, nil
+}
+
+// parse5424 parses the header, structured data and message s of m, following
+// its VERSION.
+func parse5424(m *Message, s string) error {
+	fields := strings.SplitN(s, " ", 6)
+	if len(fields) < 6 {
+		return errors.New("RFC 5424 header is truncated")
+	}
+	if ts := fields[0]; ts != nilValue {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return fmt.Errorf("invalid TIMESTAMP: %v", err)
+		}
+		m.Timestamp = t
+	}
+	for i, f := range []*string{&m.Hostname, &m.AppName, &m.ProcID, &m.MsgID} {
+		if v := fields[i+1]; v != nilValue {
+			*f = v
+		}
+	}
+	sd, msg, err := splitStructuredData(fields[5])
+	if err != nil {
+		return err
+	}
+	if sd != nilValue {
+		m.StructuredData = sd
+	}
+	// A UTF-8 message may start with a byte order mark.
+	m.Text = strings.TrimPrefix(msg, "\ufeff")
+	return nil
+}
+
+// splitStructuredData splits s into the STRUCTURED-DATA of RFC 5424 and the
+// following MSG.
+func splitStructuredData(s string) (string, string, error) {
+	if strings.HasPrefix(s, nilValue) {
+		return nilValue, strings.TrimPrefix(s[1:], " "), nil
+	}
+	var inElement, inValue, escaped bool
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inValue && c == '\\':
+			escaped = true
+		case inElement && c == '"':
+			inValue = !inValue
+		case inValue:
+		case !inElement && c == '[':
+			inElement = true
+		case inElement && c == ']':
+			inElement = false
+		case !inElement:
+			if c != ' ' || i == 0 {
+				return "", "", errors.New("invalid STRUCTURED-DATA")
+			}
+			return s[:i], s[i+1:], nil
+		}
+	}
+	if inElement || len(s) == 0 {
+		return "", "", errors.New("STRUCTURED-DATA is truncated")
+	}
+	return s, "", nil
+}
+
+// stamp3164 is the TIMESTAMP of RFC 3164.
+const stamp3164 = time.Stamp
+
+// parse3164 parses the header and message s of m, following its PRI. Messages
+// without a valid TIMESTAMP are taken as a message of the source, as relays
+// do by RFC 3164 section 4.3.
+func parse3164(m *Message, s string) error {
+	if len(s) < len(stamp3164)+1 || s[len(stamp3164)] != ' ' {
+		m.Text = s
+		return nil
+	}
+	t, err := time.Parse(stamp3164, s[:len(stamp3164)])
+	if err != nil {
+		m.Text = s
+		return nil
+	}
+	m.Timestamp = t.AddDate(m.Received.UTC().Year(), 0, 0)
+	s = s[len(stamp3164)+1:]
+	host, s, ok := strings.Cut(s, " ")
+	if !ok {
+		return errors.New("RFC 3164 HOSTNAME is truncated")
+	}
+	m.Hostname = host
+	// The TAG is the alphanumeric prefix of the message, optionally
+	// followed by the PID in brackets, and ends with a colon.
+	tag, text, ok := strings.Cut(s, ": ")
+	if !ok || strings.ContainsAny(tag, " ") {
+		m.Text = s
+		return nil
+	}
+	if i := strings.IndexByte(tag, '['); i > 0 && strings.HasSuffix(tag, "]") {
+		tag, m.ProcID = tag[:i], tag[i+1:len(tag)-1]
+	}
+	m.AppName = tag
+	m.Text = text
+	return nil
+}
+
+// maxMessageSize is the maximum size of the UDP datagrams of the messages.
+const maxMessageSize = 65535
+
+// Collector collects the syslog messages received on a UDP socket.
+type Collector struct {
+	conn net.PacketConn
+	done chan struct{}
+
+	mu       sync.Mutex
+	msgs     []*Message
+	errs     []error
+	received chan struct{} // Closed and replaced when a message is received.
+	resets   int           // Number of calls to Reset.
+}
+
+// Listen starts a collector of the syslog messages received on the UDP address
+// addr, such as ":514". The port of addr may be 0 to pick any available port.
+func Listen(addr string) (*Collector, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for syslog messages on %s: %w", addr, err)
+	}
+	c := &Collector{
+		conn:     conn,
+		done:     make(chan struct{}),
+		received: make(chan struct{}),
+	}
+	go c.receive()
+	return c, nil
+}
+
+// receive receives messages until the collector is closed.
+func (c *Collector) receive() {
+	defer close(c.done)
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, src, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		m, err := Parse(buf[:n], time.Now())
+		c.mu.Lock()
+		if err != nil {
+			c.errs = append(c.errs, fmt.Errorf("from %v: %w", src, err))
+		} else {
+			m.Source = src
+			c.msgs = append(c.msgs, m)
+			close(c.received)
+			c.received = make(chan struct{})
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Addr returns the address on which the collector listens.
+func (c *Collector) Addr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Port returns the UDP port on which the collector listens.
+func (c *Collector) Port() uint16 {
+	return uint16(c.conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+// Close stops the collector.
+func (c *Collector) Close() error {
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// Messages returns the messages collected so far, in order of reception,
+// which match, or all of them if match is nil.
+func (c *Collector) Messages(match func(*Message) bool) []*Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var msgs []*Message
+	for _, m := range c.msgs {
+		if match == nil || match(m) {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// Errors returns the errors parsing the datagrams received so far, which were
+// not collected as messages.
+func (c *Collector) Errors() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]error(nil), c.errs...)
+}
+
+// Reset discards the messages and errors collected so far.
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs, c.errs = nil, nil
+	c.resets++
+}
+
+// Await waits for a collected message which matches, and returns the first.
+// It returns the error of ctx if it is done before.
+func (c *Collector) Await(ctx context.Context, match func(*Message) bool) (*Message, error) {
+	var next, resets int
+	for {
+		c.mu.Lock()
+		msgs, received := c.msgs, c.received
+		if c.resets != resets {
+			next, resets = 0, c.resets
+		}
+		c.mu.Unlock()
+		for _, m := range msgs[next:] {
+			if match(m) {
+				return m, nil
+			}
+		}
+		next = len(msgs)
+		select {
+		case <-received:
+		case <-c.done:
+			return nil, errors.New("syslog collector is closed")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syslogcollector
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var received = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		desc string
+		msg  string
+		want *Message
+	}{{
+		desc: "RFC 5424",
+		msg:  "<189>1 2024-03-01T11:59:58.123Z dut1 Ebra 1234 LINEPROTO-5-UPDOWN - Line protocol on Interface Loopback1, changed state to down\n",
+		want: &Message{
+			Format:    RFC5424,
+			Facility:  23,
+			Severity:  Notice,
+			Timestamp: time.Date(2024, 3, 1, 11, 59, 58, 123000000, time.UTC),
+			Hostname:  "dut1",
+			AppName:   "Ebra",
+			ProcID:    "1234",
+			MsgID:     "LINEPROTO-5-UPDOWN",
+			Text:      "Line protocol on Interface Loopback1, changed state to down",
+		},
+	}, {
+		desc: "RFC 5424 with structured data",
+		msg:  `<14>1 2024-03-01T11:59:58Z dut1 sshd - - [origin ip="192.0.2.1"][meta x="a\]b c"] ` + "\ufeff" + "login",
+		want: &Message{
+			Format:         RFC5424,
+			Facility:       1,
+			Severity:       Informational,
+			Timestamp:      time.Date(2024, 3, 1, 11, 59, 58, 0, time.UTC),
+			Hostname:       "dut1",
+			AppName:        "sshd",
+			StructuredData: `[origin ip="192.0.2.1"][meta x="a\]b c"]`,
+			Text:           "login",
+		},
+	}, {
+		desc: "RFC 5424 without message",
+		msg:  "<0>1 - - - - - -",
+		want: &Message{Format: RFC5424},
+	}, {
+		desc: "RFC 3164",
+		msg:  "<189>Mar  1 11:59:58 dut1 Ebra[1234]: %LINEPROTO-5-UPDOWN: Line protocol on Interface Loopback1, changed state to down",
+		want: &Message{
+			Format:    RFC3164,
+			Facility:  23,
+			Severity:  Notice,
+			Timestamp: time.Date(2024, 3, 1, 11, 59, 58, 0, time.UTC),
+			Hostname:  "dut1",
+			AppName:   "Ebra",
+			ProcID:    "1234",
+			Text:      "%LINEPROTO-5-UPDOWN: Line protocol on Interface Loopback1, changed state to down",
+		},
+	}, {
+		desc: "RFC 3164 without timestamp",
+		msg:  "<13>link down",
+		want: &Message{
+			Format:   RFC3164,
+			Facility: 1,
+			Severity: Notice,
+			Text:     "link down",
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := Parse([]byte(tt.msg), received)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			tt.want.Received = received
+			tt.want.Raw = strings.TrimRight(tt.msg, "\n")
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Parse() returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, msg := range []string{
+		"",
+		"no PRI",
+		"<>1 - - - - - -",
+		"<192>1 - - - - - -",
+		"<14>1 - dut1 sshd",
+		"<14>1 yesterday dut1 sshd - - - login",
+		`<14>1 - dut1 sshd - - [origin ip="192.0.2.1" login`,
+		"<14>1 - dut1 sshd - - [origin]login",
+	} {
+		if m, err := Parse([]byte(msg), received); err == nil {
+			t.Errorf("Parse(%q) got %+v, want error", msg, m)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	defer c.Close()
+
+	conn, err := net.Dial("udp", c.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer conn.Close()
+	send := func(msg string) {
+		t.Helper()
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	isUp := func(m *Message) bool { return strings.HasSuffix(m.Text, "up") }
+
+	send("not syslog")
+	send("<189>1 - dut1 Ebra - - - Loopback1 down")
+	// The message awaited is received after Await starts waiting.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		conn.Write([]byte("<189>1 - dut1 Ebra - - - Loopback1 up"))
+	}()
+	got, err := c.Await(ctx, isUp)
+	if err != nil {
+		t.Fatalf("Await() failed: %v", err)
+	}
+	if got.Text != "Loopback1 up" || got.Source == nil {
+		t.Errorf("Await() got %v, want the message of Loopback1 up with its source", got)
+	}
+	if got, want := len(c.Messages(nil)), 2; got != want {
+		t.Errorf("Messages() got %d messages, want %d", got, want)
+	}
+	if got, want := len(c.Errors()), 1; got != want {
+		t.Errorf("Errors() got %d errors, want %d", got, want)
+	}
+
+	c.Reset()
+	if got := c.Messages(nil); len(got) != 0 {
+		t.Errorf("Messages() after Reset() got %v, want none", got)
+	}
+	short, cancelShort := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelShort()
+	if _, err := c.Await(short, isUp); err != context.DeadlineExceeded {
+		t.Errorf("Await() after Reset() got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+	if _, err := c.Await(ctx, isUp); err == nil {
+		t.Errorf("Await() after Close() succeeded, want error")
+	}
+}
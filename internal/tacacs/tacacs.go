@@ -0,0 +1,648 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tacacs provides a TACACS+ server, RFC 8907, which runs on the test
+// host, or in a container reachable by the DUT, and serves the
+// authentication, authorization and accounting requests of the DUT for a set
+// of users.
+//
+// The server supports ASCII and PAP login authentication, the authorization
+// of shell sessions and of their commands, and accounting, which it records
+// so that tests can assert the requests of the DUT. Typical usage looks like:
+//
+//	s, err := tacacs.Listen(":4949", key, map[string]tacacs.User{
+//	  "fp-operator": {Password: "...", PrivLvl: 1, Commands: []string{"show version"}},
+//	})
+//	if err != nil {
+//	  t.Fatal(err)
+//	}
+//	defer s.Close()
+//	... configure the DUT with the TACACS+ server on the port of s, and log in ...
+//	r, err := s.Await(ctx, func(r *tacacs.Record) bool {
+//	  return r.Type == tacacs.Authorization && r.Command() == "show version"
+//	})
+package tacacs
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PacketType is the type of a TACACS+ packet.
+type PacketType uint8
+
+const (
+	// Authentication is the type of authentication packets.
+	Authentication PacketType = 1
+	// Authorization is the type of authorization packets.
+	Authorization PacketType = 2
+	// Accounting is the type of accounting packets.
+	Accounting PacketType = 3
+)
+
+// String returns the name of t.
+func (t PacketType) String() string {
+	switch t {
+	case Authentication:
+		return "Authentication"
+	case Authorization:
+		return "Authorization"
+	case Accounting:
+		return "Accounting"
+	default:
+		return fmt.Sprintf("PacketType(%d)", uint8(t))
+	}
+}
+
+// AccountingFlags are the flags of an accounting request.
+type AccountingFlags uint8
+
+const (
+	// Start marks the start of a task.
+	Start AccountingFlags = 0x02
+	// Stop marks the end of a task.
+	Stop AccountingFlags = 0x04
+	// Watchdog marks an update of a task.
+	Watchdog AccountingFlags = 0x08
+)
+
+// Header constants, RFC 8907 section 4.1.
+const (
+	headerLen    = 12
+	majorVersion = 0xc
+	// maxBodyLen bounds the body of the packets accepted by the server.
+	maxBodyLen = 1 << 16
+
+	unencryptedFlag   = 0x01
+	singleConnectFlag = 0x04
+)
+
+// Authentication constants, RFC 8907 section 5.
+const (
+	authenLogin = 0x01
+
+	authenTypeASCII = 0x01
+	authenTypePAP   = 0x02
+
+	authenStatusPass    = 0x01
+	authenStatusFail    = 0x02
+	authenStatusGetUser = 0x04
+	authenStatusGetPass = 0x05
+	authenStatusError   = 0x07
+
+	replyFlagNoEcho = 0x01
+	continueAbort   = 0x01
+)
+
+// Authorization and accounting constants, RFC 8907 sections 6 and 7.
+const (
+	authorStatusPassAdd = 0x01
+	authorStatusFail    = 0x10
+	authorStatusError   = 0x11
+
+	acctStatusSuccess = 0x01
+	acctStatusError   = 0x02
+)
+
+// idleTimeout is the time after which the server closes an idle connection.
+const idleTimeout = 5 * time.Minute
+
+// User is a user of the server.
+type User struct {
+	Password string
+	// PrivLvl is the privilege level granted to the shell sessions of the
+	// user, returned as the priv-lvl attribute of their authorization.
+	PrivLvl int
+	// Commands are the prefixes of the shell commands which the user is
+	// authorized to run. A user with nil Commands may run any command.
+	Commands []string
+}
+
+// permits returns whether u is authorized to run the shell command cmd.
+func (u User) permits(cmd string) bool {
+	if u.Commands == nil {
+		return true
+	}
+	for _, c := range u.Commands {
+		if cmd == c || strings.HasPrefix(cmd, c+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// Record is a request served by the server.
+type Record struct {
+	Type PacketType
+	// Client is the address of the TACACS+ client, the DUT.
+	Client net.Addr
+	// User is the user of the request, Port the port, such as the tty, on
+	// which the user is connected to the client, and RemAddr the address
+	// from which the user is connected.
+	User    string
+	Port    string
+	RemAddr string
+	// Args are the attribute-value pairs of authorization and accounting
+	// requests, such as "service=shell" or "cmd=show".
+	Args []string
+	// Flags are the flags of accounting requests.
+	Flags AccountingFlags
+	// Pass is whether the user is authenticated, or authorized. Accounting
+	// requests always pass.
+	Pass bool
+}
+
+// String returns a summary of r.
+func (r *Record) String() string {
+	s := fmt.Sprintf("%v of %q from %v", r.Type, r.User, r.Client)
+	if len(r.Args) > 0 {
+		s += fmt.Sprintf(" %q", r.Args)
+	}
+	if r.Type == Accounting {
+		return s + fmt.Sprintf(" flags %#x", uint8(r.Flags))
+	}
+	return s + fmt.Sprintf(" pass %t", r.Pass)
+}
+
+// Arg returns the value of the mandatory or optional attribute name of r, and
+// whether it is present.
+func (r *Record) Arg(name string) (string, bool) {
+	for _, a := range r.Args {
+		if i := strings.IndexAny(a, "=*"); i >= 0 && a[:i] == name {
+			return a[i+1:], true
+		}
+	}
+	return "", false
+}
+
+// Command returns the shell command of an authorization or accounting request,
+// joining its cmd and cmd-arg attributes, or "" if there is none.
+func (r *Record) Command() string {
+	cmd, _ := r.Arg("cmd")
+	if cmd == "" {
+		return ""
+	}
+	words := []string{cmd}
+	for _, a := range r.Args {
+		if i := strings.IndexAny(a, "=*"); i >= 0 && a[:i] == "cmd-arg" && a[i+1:] != "<cr>" {
+			words = append(words, a[i+1:])
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Server is a TACACS+ server.
+type Server struct {
+	key   string
+	users map[string]User
+	ln    net.Listener
+	wg    sync.WaitGroup
+
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	closed   bool
+	records  []*Record
+	received chan struct{} // Closed and replaced when a request is recorded.
+	resets   int           // Number of calls to Reset.
+}
+
+// Listen starts a TACACS+ server on the TCP address addr, such as ":49", which
+// shares key with its clients and serves users by name. The port of addr may
+// be 0 to pick any available port.
+func Listen(addr, key string, users map[string]User) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for TACACS+ on %s: %w", addr, err)
+	}
+	s := &Server{
+		key:      key,
+		users:    users,
+		ln:       ln,
+		conns:    make(map[net.Conn]bool),
+		received: make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Port returns the TCP port on which s listens.
+func (s *Server) Port() uint16 {
+	return uint16(s.ln.Addr().(*net.TCPAddr).Port)
+}
+
+// Close stops s, closing its connections, so that the server is dead to its
+// clients.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// accept serves the connections of s until it is closed.
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			s.serve(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// header is the header of a TACACS+ packet.
+type header struct {
+	version   uint8
+	typ       PacketType
+	seq       uint8
+	flags     uint8
+	sessionID uint32
+}
+
+// obfuscate obfuscates or deobfuscates body, the body of a packet with header
+// h, with the pseudo pad of key, RFC 8907 section 4.5.
+func obfuscate(body []byte, h header, key string) {
+	if key == "" || h.flags&unencryptedFlag != 0 {
+		return
+	}
+	var sid [4]byte
+	binary.BigEndian.PutUint32(sid[:], h.sessionID)
+	var prev []byte
+	for i := 0; i < len(body); i += md5.Size {
+		m := md5.New()
+		m.Write(sid[:])
+		m.Write([]byte(key))
+		m.Write([]byte{h.version, h.seq})
+		m.Write(prev)
+		prev = m.Sum(nil)
+		for j := 0; j < md5.Size && i+j < len(body); j++ {
+			body[i+j] ^= prev[j]
+		}
+	}
+}
+
+// readPacket reads a packet from r, and returns its header and deobfuscated
+// body.
+func readPacket(r io.Reader, key string) (header, []byte, error) {
+	var b [headerLen]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return header{}, nil, err
+	}
+	h := header{
+		version:   b[0],
+		typ:       PacketType(b[1]),
+		seq:       b[2],
+		flags:     b[3],
+		sessionID: binary.BigEndian.Uint32(b[4:8]),
+	}
+	if h.version>>4 != majorVersion {
+		return h, nil, fmt.Errorf("unsupported TACACS+ version %#x", h.version)
+	}
+	n := binary.BigEndian.Uint32(b[8:12])
+	if n > maxBodyLen {
+		return h, nil, fmt.Errorf("TACACS+ body length %d exceeds %d", n, maxBodyLen)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return h, nil, err
+	}
+	obfuscate(body, h, key)
+	return h, body, nil
+}
+
+// writePacket writes the packet of header h and body to w, obfuscating body.
+func writePacket(w io.Writer, h header, body []byte, key string) error {
+	b := make([]byte, headerLen, headerLen+len(body))
+	b[0], b[1], b[2], b[3] = h.version, uint8(h.typ), h.seq, h.flags
+	binary.BigEndian.PutUint32(b[4:8], h.sessionID)
+	binary.BigEndian.PutUint32(b[8:12], uint32(len(body)))
+	body = append([]byte(nil), body...)
+	obfuscate(body, h, key)
+	_, err := w.Write(append(b, body...))
+	return err
+}
+
+// session is the state of an ASCII authentication session, which takes
+// several packets.
+type session struct {
+	rec *Record
+	// awaiting is the status of the last reply, asking for the user or
+	// the password.
+	awaiting uint8
+}
+
+// serve serves the sessions of conn until it is closed. Without the single
+// connection flag, the connection is closed at the end of its session.
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	sessions := make(map[uint32]*session)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		h, body, err := readPacket(conn, s.key)
+		if err != nil {
+			return
+		}
+		var reply []byte
+		var done bool
+		switch h.typ {
+		case Authentication:
+			reply, done = s.authenticate(conn, sessions, h, body)
+		case Authorization:
+			reply, done = s.authorize(conn, body), true
+		case Accounting:
+			reply, done = s.account(conn, body), true
+		default:
+			return
+		}
+		if done {
+			delete(sessions, h.sessionID)
+		}
+		if reply != nil {
+			rh := h
+			rh.seq++
+			rh.flags &= unencryptedFlag | singleConnectFlag
+			if err := writePacket(conn, rh, reply, s.key); err != nil {
+				return
+			}
+		}
+		if done && h.flags&singleConnectFlag == 0 {
+			return
+		}
+	}
+}
+
+// fields splits b into fields of the lengths lens, and returns the remaining
+// bytes.
+func fields(b []byte, lens ...int) ([]string, []byte, error) {
+	var fs []string
+	for _, n := range lens {
+		if len(b) < n {
+			return nil, nil, errors.New("TACACS+ body is truncated")
+		}
+		fs = append(fs, string(b[:n]))
+		b = b[n:]
+	}
+	return fs, b, nil
+}
+
+// authenReply returns the body of an authentication reply.
+func authenReply(status, flags uint8, msg string) []byte {
+	b := []byte{status, flags, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(msg)))
+	return append(b, msg...)
+}
+
+// authenticate serves the authentication packet of header h and body, and
+// returns the reply and whether the session is done.
+func (s *Server) authenticate(conn net.Conn, sessions map[uint32]*session, h header, body []byte) ([]byte, bool) {
+	if h.seq == 1 {
+		return s.authenStart(conn, sessions, h, body)
+	}
+	sess := sessions[h.sessionID]
+	if sess == nil || len(body) < 5 {
+		return authenReply(authenStatusError, 0, "unexpected CONTINUE"), true
+	}
+	msgLen := int(binary.BigEndian.Uint16(body[0:2]))
+	dataLen := int(binary.BigEndian.Uint16(body[2:4]))
+	if body[4]&continueAbort != 0 {
+		return nil, true
+	}
+	fs, _, err := fields(body[5:], msgLen, dataLen)
+	if err != nil {
+		return authenReply(authenStatusError, 0, err.Error()), true
+	}
+	if sess.awaiting == authenStatusGetUser {
+		sess.rec.User = fs[0]
+		sess.awaiting = authenStatusGetPass
+		return authenReply(authenStatusGetPass, replyFlagNoEcho, "Password: "), false
+	}
+	return s.authenResult(sess.rec, fs[0]), true
+}
+
+// authenStart serves the authentication START of header h and body.
+func (s *Server) authenStart(conn net.Conn, sessions map[uint32]*session, h header, body []byte) ([]byte, bool) {
+	if len(body) < 8 {
+		return authenReply(authenStatusError, 0, "START is truncated"), true
+	}
+	action, authenType := body[0], body[2]
+	fs, _, err := fields(body[8:], int(body[4]), int(body[5]), int(body[6]), int(body[7]))
+	if err != nil {
+		return authenReply(authenStatusError, 0, err.Error()), true
+	}
+	rec := &Record{Type: Authentication, Client: conn.RemoteAddr(), User: fs[0], Port: fs[1], RemAddr: fs[2]}
+	if action != authenLogin {
+		s.record(rec)
+		return authenReply(authenStatusFail, 0, "unsupported authentication action"), true
+	}
+	switch authenType {
+	case authenTypePAP:
+		return s.authenResult(rec, fs[3]), true
+	case authenTypeASCII:
+		sess := &session{rec: rec, awaiting: authenStatusGetPass}
+		if rec.User == "" {
+			sess.awaiting = authenStatusGetUser
+		}
+		sessions[h.sessionID] = sess
+		if sess.awaiting == authenStatusGetUser {
+			return authenReply(authenStatusGetUser, 0, "Username: "), false
+		}
+		return authenReply(authenStatusGetPass, replyFlagNoEcho, "Password: "), false
+	default:
+		s.record(rec)
+		return authenReply(authenStatusFail, 0, "unsupported authentication type"), true
+	}
+}
+
+// authenResult records the authentication of rec with password, and returns
+// its reply.
+func (s *Server) authenResult(rec *Record, password string) []byte {
+	u, ok := s.users[rec.User]
+	rec.Pass = ok && u.Password == password
+	s.record(rec)
+	if !rec.Pass {
+		return authenReply(authenStatusFail, 0, "authentication failed")
+	}
+	return authenReply(authenStatusPass, 0, "")
+}
+
+// parseRequest parses the user, port, remote address and arguments of an
+// authorization or accounting request, following the fields before its
+// user_len.
+func parseRequest(conn net.Conn, typ PacketType, b []byte) (*Record, error) {
+	if len(b) < 4 {
+		return nil, errors.New("TACACS+ request is truncated")
+	}
+	argCnt := int(b[3])
+	if len(b) < 4+argCnt {
+		return nil, errors.New("TACACS+ request is truncated")
+	}
+	lens := []int{int(b[0]), int(b[1]), int(b[2])}
+	for _, n := range b[4 : 4+argCnt] {
+		lens = append(lens, int(n))
+	}
+	fs, _, err := fields(b[4+argCnt:], lens...)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{Type: typ, Client: conn.RemoteAddr(), User: fs[0], Port: fs[1], RemAddr: fs[2], Args: fs[3:]}, nil
+}
+
+// authorReply returns the body of an authorization response.
+func authorReply(status uint8, msg string, args ...string) []byte {
+	b := []byte{status, uint8(len(args)), 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(msg)))
+	for _, a := range args {
+		b = append(b, uint8(len(a)))
+	}
+	b = append(b, msg...)
+	for _, a := range args {
+		b = append(b, a...)
+	}
+	return b
+}
+
+// authorize serves the authorization REQUEST body, and returns the response.
+// Shell sessions of known users are authorized with their privilege level,
+// and their commands if they are permitted.
+func (s *Server) authorize(conn net.Conn, body []byte) []byte {
+	if len(body) < 4 {
+		return authorReply(authorStatusError, "REQUEST is truncated")
+	}
+	rec, err := parseRequest(conn, Authorization, body[4:])
+	if err != nil {
+		return authorReply(authorStatusError, err.Error())
+	}
+	u, ok := s.users[rec.User]
+	service, _ := rec.Arg("service")
+	cmd := rec.Command()
+	rec.Pass = ok && (service != "shell" || cmd == "" || u.permits(cmd))
+	s.record(rec)
+	switch {
+	case !rec.Pass:
+		return authorReply(authorStatusFail, "authorization denied")
+	case service == "shell" && cmd == "":
+		return authorReply(authorStatusPassAdd, "", "priv-lvl="+strconv.Itoa(u.PrivLvl))
+	default:
+		return authorReply(authorStatusPassAdd, "")
+	}
+}
+
+// acctReply returns the body of an accounting reply.
+func acctReply(status uint8, msg string) []byte {
+	b := []byte{0, 0, 0, 0, status}
+	binary.BigEndian.PutUint16(b[0:2], uint16(len(msg)))
+	return append(b, msg...)
+}
+
+// account records the accounting REQUEST body, and returns the reply.
+func (s *Server) account(conn net.Conn, body []byte) []byte {
+	if len(body) < 5 {
+		return acctReply(acctStatusError, "REQUEST is truncated")
+	}
+	rec, err := parseRequest(conn, Accounting, body[5:])
+	if err != nil {
+		return acctReply(acctStatusError, err.Error())
+	}
+	rec.Flags = AccountingFlags(body[0])
+	rec.Pass = true
+	s.record(rec)
+	return acctReply(acctStatusSuccess, "")
+}
+
+// record records rec.
+func (s *Server) record(rec *Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+	close(s.received)
+	s.received = make(chan struct{})
+}
+
+// Records returns the requests served so far, in order, which match, or all
+// of them if match is nil.
+func (s *Server) Records(match func(*Record) bool) []*Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var recs []*Record
+	for _, r := range s.records {
+		if match == nil || match(r) {
+			recs = append(recs, r)
+		}
+	}
+	return recs
+}
+
+// Reset discards the requests recorded so far.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = nil
+	s.resets++
+}
+
+// Await waits for a recorded request which matches, and returns the first. It
+// returns the error of ctx if it is done before.
+func (s *Server) Await(ctx context.Context, match func(*Record) bool) (*Record, error) {
+	var next, resets int
+	for {
+		s.mu.Lock()
+		recs, received := s.records, s.received
+		if s.resets != resets {
+			next, resets = 0, s.resets
+		}
+		s.mu.Unlock()
+		for _, r := range recs[next:] {
+			if match(r) {
+				return r, nil
+			}
+		}
+		next = len(recs)
+		select {
+		case <-received:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
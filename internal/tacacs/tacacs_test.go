@@ -0,0 +1,253 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tacacs
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const (
+	key      = "fp-tacacs-key"
+	user     = "fp-operator"
+	password = "fp-Passw0rd!"
+)
+
+var users = map[string]User{
+	user: {Password: password, PrivLvl: 1, Commands: []string{"show version"}},
+}
+
+// client is a TACACS+ client of a test server.
+type client struct {
+	t       *testing.T
+	conn    net.Conn
+	session uint32
+	flags   uint8
+}
+
+func dial(t *testing.T, s *Server, flags uint8) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, flags: flags}
+}
+
+// exchange sends the packet of type typ, sequence number seq and body, and
+// returns the body of the reply.
+func (c *client) exchange(typ PacketType, seq uint8, body []byte) []byte {
+	c.t.Helper()
+	if seq == 1 {
+		c.session++
+	}
+	h := header{version: majorVersion << 4, typ: typ, seq: seq, flags: c.flags, sessionID: c.session}
+	if typ == Authentication && seq == 1 && body[2] == authenTypePAP {
+		h.version |= 1
+	}
+	if err := writePacket(c.conn, h, body, key); err != nil {
+		c.t.Fatalf("writePacket() failed: %v", err)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	rh, reply, err := readPacket(c.conn, key)
+	if err != nil {
+		c.t.Fatalf("readPacket() failed: %v", err)
+	}
+	if rh.seq != seq+1 || rh.sessionID != c.session || rh.typ != typ {
+		c.t.Fatalf("reply header: got %+v, want sequence %d of session %d of type %v", rh, seq+1, c.session, typ)
+	}
+	return reply
+}
+
+// strs returns the lengths of ss as bytes, and their concatenation.
+func strs(ss ...string) ([]byte, []byte) {
+	var lens, b []byte
+	for _, s := range ss {
+		lens = append(lens, uint8(len(s)))
+		b = append(b, s...)
+	}
+	return lens, b
+}
+
+func authenStart(authenType uint8, user, data string) []byte {
+	lens, b := strs(user, "tty0", "198.51.100.1", data)
+	return append(append([]byte{authenLogin, 1, authenType, 1}, lens...), b...)
+}
+
+func authenContinue(msg string) []byte {
+	b := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(b[0:2], uint16(len(msg)))
+	return append(b, msg...)
+}
+
+func request(prefix []byte, user string, args ...string) []byte {
+	lens, b := strs(append([]string{user, "tty0", "198.51.100.1"}, args...)...)
+	b2 := append(append([]byte{}, prefix...), lens[:3]...)
+	b2 = append(b2, uint8(len(args)))
+	b2 = append(b2, lens[3:]...)
+	return append(b2, b...)
+}
+
+func listen(t *testing.T) *Server {
+	t.Helper()
+	s, err := Listen("127.0.0.1:0", key, users)
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestAuthentication(t *testing.T) {
+	s := listen(t)
+
+	t.Run("PAP", func(t *testing.T) {
+		for _, tt := range []struct {
+			password string
+			want     uint8
+		}{
+			{password, authenStatusPass},
+			{"wrong", authenStatusFail},
+		} {
+			c := dial(t, s, 0)
+			if got := c.exchange(Authentication, 1, authenStart(authenTypePAP, user, tt.password))[0]; got != tt.want {
+				t.Errorf("PAP with password %q: got status %#x, want %#x", tt.password, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("ASCII", func(t *testing.T) {
+		c := dial(t, s, 0)
+		if got := c.exchange(Authentication, 1, authenStart(authenTypeASCII, "", ""))[0]; got != authenStatusGetUser {
+			t.Fatalf("START: got status %#x, want GETUSER", got)
+		}
+		reply := c.exchange(Authentication, 3, authenContinue(user))
+		if reply[0] != authenStatusGetPass || reply[1]&replyFlagNoEcho == 0 {
+			t.Fatalf("CONTINUE with user: got status %#x and flags %#x, want GETPASS without echo", reply[0], reply[1])
+		}
+		if got := c.exchange(Authentication, 5, authenContinue(password))[0]; got != authenStatusPass {
+			t.Errorf("CONTINUE with password: got status %#x, want PASS", got)
+		}
+	})
+
+	want := []*Record{
+		{Type: Authentication, User: user, Port: "tty0", RemAddr: "198.51.100.1", Pass: true},
+		{Type: Authentication, User: user, Port: "tty0", RemAddr: "198.51.100.1"},
+		{Type: Authentication, User: user, Port: "tty0", RemAddr: "198.51.100.1", Pass: true},
+	}
+	if diff := cmp.Diff(want, s.Records(nil), cmpopts.IgnoreFields(Record{}, "Client")); diff != "" {
+		t.Errorf("Records() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	s := listen(t)
+	tests := []struct {
+		desc     string
+		user     string
+		args     []string
+		want     uint8
+		wantArgs []string
+	}{{
+		desc:     "shell",
+		user:     user,
+		args:     []string{"service=shell", "cmd="},
+		want:     authorStatusPassAdd,
+		wantArgs: []string{"priv-lvl=1"},
+	}, {
+		desc: "permitted command",
+		user: user,
+		args: []string{"service=shell", "cmd=show", "cmd-arg=version", "cmd-arg=<cr>"},
+		want: authorStatusPassAdd,
+	}, {
+		desc: "denied command",
+		user: user,
+		args: []string{"service=shell", "cmd=show", "cmd-arg=running-config", "cmd-arg=<cr>"},
+		want: authorStatusFail,
+	}, {
+		desc: "unknown user",
+		user: "fp-unknown",
+		args: []string{"service=shell", "cmd="},
+		want: authorStatusFail,
+	}}
+	// All the requests share a single connection.
+	c := dial(t, s, singleConnectFlag)
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			c.t = t
+			reply := c.exchange(Authorization, 1, request([]byte{6, 1, authenTypeASCII, 1}, tt.user, tt.args...))
+			if reply[0] != tt.want {
+				t.Errorf("authorization: got status %#x, want %#x", reply[0], tt.want)
+			}
+			argCnt := int(reply[1])
+			off := 6 + argCnt + int(binary.BigEndian.Uint16(reply[2:4])) + int(binary.BigEndian.Uint16(reply[4:6]))
+			var args []string
+			for _, n := range reply[6 : 6+argCnt] {
+				args = append(args, string(reply[off:off+int(n)]))
+				off += int(n)
+			}
+			if diff := cmp.Diff(tt.wantArgs, args); diff != "" {
+				t.Errorf("authorization arguments (-want +got):\n%s", diff)
+			}
+		})
+	}
+	recs := s.Records(func(r *Record) bool { return r.Type == Authorization })
+	if len(recs) != len(tests) {
+		t.Fatalf("Records() got %d authorizations, want %d", len(recs), len(tests))
+	}
+	if got, want := recs[1].Command(), "show version"; got != want {
+		t.Errorf("Command() got %q, want %q", got, want)
+	}
+}
+
+func TestAccounting(t *testing.T) {
+	s := listen(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := dial(t, s, 0)
+	reply := c.exchange(Accounting, 1, request([]byte{uint8(Stop), 6, 1, authenTypeASCII, 1}, user, "task_id=1", "service=shell", "cmd=show", "cmd-arg=version"))
+	if reply[4] != acctStatusSuccess {
+		t.Errorf("accounting: got status %#x, want SUCCESS", reply[4])
+	}
+	r, err := s.Await(ctx, func(r *Record) bool { return r.Type == Accounting })
+	if err != nil {
+		t.Fatalf("Await() failed: %v", err)
+	}
+	if r.Flags != Stop || r.Command() != "show version" || !r.Pass {
+		t.Errorf("Await() got %v, want the stop of show version", r)
+	}
+	if v, ok := r.Arg("task_id"); !ok || v != "1" {
+		t.Errorf("Arg(task_id) got %q, %t, want 1", v, ok)
+	}
+}
+
+func TestClose(t *testing.T) {
+	s := listen(t)
+	c := dial(t, s, singleConnectFlag)
+	c.exchange(Authentication, 1, authenStart(authenTypePAP, user, password))
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if _, err := net.DialTimeout("tcp", s.ln.Addr().String(), time.Second); err == nil {
+		t.Errorf("Dial() after Close() succeeded, want the server dead")
+	}
+}
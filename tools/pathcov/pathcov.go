@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// pathcov merges the path coverage reports written by tests run with
+// -path_coverage into the path coverage of a run.
+//
+// Usage:
+//
+//	go run ./tools/pathcov -reports_dir=<outputs dir> -output=run_coverage.json
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"flag"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/featureprofiles/internal/pathcov"
+)
+
+var (
+	reportsDir = flag.String("reports_dir", "", "directory searched recursively for path_coverage.*.json reports")
+	output     = flag.String("output", "", "file to write the merged report into; stdout if empty")
+)
+
+// readReports reads the path coverage reports below dir.
+func readReports(dir string) ([]*pathcov.Report, error) {
+	var reports []*pathcov.Report
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() || !strings.HasPrefix(name, "path_coverage.") || !strings.HasSuffix(name, ".json") {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rep := &pathcov.Report{}
+		if err := json.Unmarshal(b, rep); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		reports = append(reports, rep)
+		return nil
+	})
+	return reports, err
+}
+
+func main() {
+	flag.Parse()
+	if *reportsDir == "" {
+		log.Fatal("reports_dir must be set.")
+	}
+	reports, err := readReports(*reportsDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, err := json.MarshalIndent(pathcov.Merge(reports...), "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" {
+		fmt.Println(string(b))
+		return
+	}
+	if err := os.WriteFile(*output, b, 0644); err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Merged %d reports into %s", len(reports), *output)
+}